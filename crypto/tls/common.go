@@ -342,6 +342,37 @@ func (c *ClientHelloInfo) JA3Digest() string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+// ja3s creates the JA3S string of a marshaled server hello:
+// SSLVersion,Cipher,SSLExtension
+func ja3s(hello []byte) string {
+	// Handshake header, version, and random
+	if len(hello) < 39 {
+		return ""
+	}
+	vers := uint16(hello[4])<<8 | uint16(hello[5])
+	z := hello[39+int(hello[38]):]
+	if len(z) < 3 {
+		return ""
+	}
+	cipher := uint16(z[0])<<8 | uint16(z[1])
+	z = z[3:]
+
+	vals := []string{}
+	if len(z) >= 2 {
+		z = z[2:]
+		for len(z) >= 4 {
+			vals = append(vals, fmt.Sprintf("%d", uint16(z[0])<<8|uint16(z[1])))
+			length := int(z[2])<<8 | int(z[3])
+			if len(z) < 4+length {
+				break
+			}
+			z = z[4+length:]
+		}
+	}
+
+	return fmt.Sprintf("%d,%d,%s", vers, cipher, strings.Join(vals, "-"))
+}
+
 // CertificateRequestInfo contains information from a server's
 // CertificateRequest message, which is used to demand a certificate and proof
 // of control from a client.
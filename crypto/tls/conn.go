@@ -105,7 +105,9 @@ type Conn struct {
 
 	tmp            [16]byte
 
-	JA3Fingerprint string
+	JA3Fingerprint  string
+	JA3SFingerprint string
+	ClientHello     []byte
 }
 
 // Access to net.Conn methods.
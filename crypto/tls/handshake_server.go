@@ -51,6 +51,7 @@ func (c *Conn) serverHandshake() error {
 	}
 
 	c.JA3Fingerprint = hs.clientHelloInfo().JA3()
+	c.ClientHello = append([]byte(nil), hs.clientHello.marshal()...)
 
 	// For an overview of TLS handshaking, see https://tools.ietf.org/html/rfc5246#section-7.3
 	c.buffering = true
@@ -105,6 +106,7 @@ func (c *Conn) serverHandshake() error {
 			return err
 		}
 	}
+	c.JA3SFingerprint = ja3s(hs.hello.marshal())
 	c.handshakeComplete = true
 
 	return nil
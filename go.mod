@@ -1,6 +1,6 @@
 module github.com/t94j0/satellite
 
-go 1.12
+go 1.20
 
 require (
 	github.com/fsnotify/fsnotify v1.4.7
@@ -14,6 +14,8 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/viper v1.4.0
 	github.com/t94j0/array v0.0.0-20180426153242-68930562a6bd
+	github.com/tetratelabs/wazero v1.7.2
+	github.com/yuin/gopher-lua v1.1.1
 	golang.org/x/crypto v0.0.0-20191117063200-497ca9f6d64f
 	golang.org/x/net v0.0.0-20191119073136-fc4aabc6c914
 	golang.org/x/sys v0.0.0-20220422013727-9388b58f7150 // indirect
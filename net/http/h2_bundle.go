@@ -4247,6 +4247,7 @@ type http2serverConn struct {
 	inflow           http2flow                   // conn-wide inbound flow control
 	tlsState         *tls.ConnectionState        // shared by all handlers, like net/http
 	remoteAddrStr    string
+	fingerprint      http2clientFingerprint // frames the client sent before its first request
 	writeSched       http2WriteScheduler
 
 	// Everything following is owned by the serve loop; use serveG.check():
@@ -5181,6 +5182,9 @@ func (sc *http2serverConn) processPing(f *http2PingFrame) error {
 
 func (sc *http2serverConn) processWindowUpdate(f *http2WindowUpdateFrame) error {
 	sc.serveG.check()
+	if f.StreamID == 0 && !sc.fingerprint.headersSeen {
+		sc.fingerprint.windowUpdate = f.Increment
+	}
 	switch {
 	case f.StreamID != 0: // stream-level flow control
 		state, st := sc.state(f.StreamID)
@@ -5283,6 +5287,13 @@ func (sc *http2serverConn) processSettings(f *http2SettingsFrame) error {
 		// duplicate entries.
 		return http2ConnectionError(http2ErrCodeProtocol)
 	}
+	if !sc.fingerprint.settingsSeen {
+		sc.fingerprint.settingsSeen = true
+		f.ForeachSetting(func(s http2Setting) error {
+			sc.fingerprint.settings = append(sc.fingerprint.settings, fmt.Sprintf("%d:%d", uint16(s.ID), s.Val))
+			return nil
+		})
+	}
 	if err := f.ForeachSetting(sc.processSetting); err != nil {
 		return err
 	}
@@ -5505,6 +5516,7 @@ func (sc *http2serverConn) processHeaders(f *http2MetaHeadersFrame) error {
 		// Ignore.
 		return nil
 	}
+	sc.fingerprint.headersSeen = true
 	// http://tools.ietf.org/html/rfc7540#section-5.1.1
 	// Streams initiated by a client MUST use odd-numbered stream
 	// identifiers. [...] An endpoint that receives an unexpected
@@ -5661,6 +5673,13 @@ func (sc *http2serverConn) processPriority(f *http2PriorityFrame) error {
 	if err := http2checkPriority(f.StreamID, f.http2PriorityParam); err != nil {
 		return err
 	}
+	if !sc.fingerprint.headersSeen {
+		exclusive := 0
+		if f.Exclusive {
+			exclusive = 1
+		}
+		sc.fingerprint.priorities = append(sc.fingerprint.priorities, fmt.Sprintf("%d:%d:%d:%d", f.StreamID, exclusive, f.StreamDep, int(f.Weight)+1))
+	}
 	sc.writeSched.AdjustStream(f.StreamID, f.http2PriorityParam)
 	return nil
 }
@@ -5737,9 +5756,19 @@ func (sc *http2serverConn) newWriterAndRequest(st *http2stream, f *http2MetaHead
 		return nil, nil, http2streamError(f.StreamID, http2ErrCodeProtocol)
 	}
 
+	pseudo := make([]string, 0, 4)
+	for _, hf := range f.PseudoFields() {
+		pseudo = append(pseudo, hf.Name[1:2])
+	}
+	rp.pseudoOrder = strings.Join(pseudo, ",")
+
 	rp.header = make(Header)
 	for _, hf := range f.RegularFields() {
-		rp.header.Add(sc.canonicalHeader(hf.Name), hf.Value)
+		name := sc.canonicalHeader(hf.Name)
+		if _, ok := rp.header[name]; !ok {
+			rp.headerOrder = append(rp.headerOrder, name)
+		}
+		rp.header.Add(name, hf.Value)
 	}
 	if rp.authority == "" {
 		rp.authority = rp.header.Get("Host")
@@ -5766,6 +5795,32 @@ type http2requestParam struct {
 	method                  string
 	scheme, authority, path string
 	header                  Header
+	headerOrder             []string
+	pseudoOrder             string
+}
+
+// http2clientFingerprint is the passive fingerprint of an HTTP/2 client: its
+// first SETTINGS, connection WINDOW_UPDATE, and PRIORITY frames
+type http2clientFingerprint struct {
+	settingsSeen bool
+	headersSeen  bool
+	settings     []string
+	windowUpdate uint32
+	priorities   []string
+}
+
+// String formats the fingerprint like Akamai with the pseudo-header order of a request:
+// SETTINGS|WINDOW_UPDATE|PRIORITY|PSEUDO_HEADER_ORDER
+func (f http2clientFingerprint) String(pseudoOrder string) string {
+	windowUpdate := "00"
+	if f.windowUpdate != 0 {
+		windowUpdate = strconv.FormatUint(uint64(f.windowUpdate), 10)
+	}
+	priorities := "0"
+	if len(f.priorities) != 0 {
+		priorities = strings.Join(f.priorities, ",")
+	}
+	return strings.Join([]string{strings.Join(f.settings, ";"), windowUpdate, priorities, pseudoOrder}, "|")
 }
 
 func (sc *http2serverConn) newWriterAndRequestNoBody(st *http2stream, rp http2requestParam) (*http2responseWriter, *Request, error) {
@@ -5836,6 +5891,14 @@ func (sc *http2serverConn) newWriterAndRequestNoBody(st *http2stream, rp http2re
 		Host:       rp.authority,
 		Body:       body,
 		Trailer:    trailer,
+
+		HTTP2Fingerprint: sc.fingerprint.String(rp.pseudoOrder),
+		HeaderOrder:      rp.headerOrder,
+	}
+	if tc, ok := sc.conn.(*tls.Conn); ok {
+		req.JA3Fingerprint = tc.JA3Fingerprint
+		req.JA3SFingerprint = tc.JA3SFingerprint
+		req.ClientHello = tc.ClientHello
 	}
 	req = http2requestWithContext(req, st.ctx)
 
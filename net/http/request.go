@@ -318,7 +318,14 @@ type Request struct {
 	// and mutating the contexts held by callers of the same request.
 	ctx context.Context
 
-	JA3Fingerprint string
+	JA3Fingerprint  string
+	JA3SFingerprint string
+	ClientHello     []byte
+	// HTTP2Fingerprint is the Akamai style fingerprint of HTTP/2 clients
+	HTTP2Fingerprint string
+	// HeaderOrder is the canonical names of the request headers in the order
+	// the client first sent them
+	HeaderOrder []string
 }
 
 // Context returns the request's context. To change the context, use
@@ -1004,11 +1011,12 @@ func readRequest(b *bufio.Reader, deleteHostHeader bool) (req *Request, err erro
 	}
 
 	// Subsequent lines: Key: value.
-	mimeHeader, err := tp.ReadMIMEHeader()
+	mimeHeader, order, err := readOrderedHeader(tp)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = Header(mimeHeader)
+	req.HeaderOrder = order
 
 	// RFC 7230, section 5.3: Must treat
 	//	GET /index.html HTTP/1.1
@@ -1047,6 +1055,40 @@ func readRequest(b *bufio.Reader, deleteHostHeader bool) (req *Request, err erro
 	return req, nil
 }
 
+// readOrderedHeader reads a MIME header like textproto.Reader.ReadMIMEHeader
+// while recording the order the header names first appear in
+func readOrderedHeader(tp *textproto.Reader) (textproto.MIMEHeader, []string, error) {
+	var raw bytes.Buffer
+	var order []string
+	seen := make(map[string]bool)
+	for {
+		line, err := tp.ReadLineBytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw.Write(line)
+		raw.WriteString("\r\n")
+		if len(line) == 0 {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if i := bytes.IndexByte(line, ':'); i > 0 {
+			name := textproto.CanonicalMIMEHeaderKey(string(bytes.TrimRight(line[:i], " \t")))
+			if !seen[name] {
+				seen[name] = true
+				order = append(order, name)
+			}
+		}
+	}
+	header, err := textproto.NewReader(bufio.NewReader(&raw)).ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, order, nil
+}
+
 // MaxBytesReader is similar to io.LimitReader but is intended for
 // limiting the size of incoming request bodies. In contrast to
 // io.LimitReader, MaxBytesReader's result is a ReadCloser, returns a
@@ -1776,6 +1776,8 @@ func (c *conn) serve(ctx context.Context) {
 		return
 	}
 	JA3Fingerprint := tlsConn.JA3Fingerprint
+	JA3SFingerprint := tlsConn.JA3SFingerprint
+	ClientHello := tlsConn.ClientHello
 
 	// HTTP/1.x from here on.
 
@@ -1848,6 +1850,8 @@ func (c *conn) serve(ctx context.Context) {
 		// But we're not going to implement HTTP pipelining because it
 		// was never deployed in the wild and the answer is HTTP/2.
 		w.req.JA3Fingerprint = JA3Fingerprint
+		w.req.JA3SFingerprint = JA3SFingerprint
+		w.req.ClientHello = ClientHello
 		serverHandler{c.server}.ServeHTTP(w, w.req)
 		w.cancelCtx()
 		if c.hijacked() {
@@ -0,0 +1,362 @@
+// Package acme issues the TLS certificate of satellite with DNS-01 challenges,
+// so wildcard certificates can be issued without serving HTTP challenge paths
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/crypto/tls"
+	xacme "golang.org/x/crypto/acme"
+)
+
+// LetsEncrypt is the ACME directory used when acme.directory is not set
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+// DefaultCache is the directory the account key and certificate are kept in when acme.cache is not set
+const DefaultCache = "/var/lib/satellite/acme"
+
+// defaultPropagation is how long records are given to propagate when acme.propagation is not set
+const defaultPropagation = 2 * time.Minute
+
+// RenewBefore is how long before it expires the certificate is renewed
+const RenewBefore = 30 * 24 * time.Hour
+
+// ErrNoCertificate is returned when a certificate has not been issued yet
+var ErrNoCertificate = errors.New("no certificate has been issued")
+
+// Config is the acme section of the configuration
+type Config struct {
+	// Email is the contact of the ACME account
+	Email string `mapstructure:"email"`
+	// Domains are the names of the certificate, like example.com and *.example.com
+	Domains []string `mapstructure:"domains"`
+	// Directory is the ACME directory URL. Defaults to Let's Encrypt
+	Directory string `mapstructure:"directory"`
+	// Cache is the directory the account key and certificate are kept in
+	Cache string `mapstructure:"cache"`
+	// Provider is the DNS provider the challenge records are published with
+	Provider string `mapstructure:"provider"`
+	// Credentials are the API credentials of the provider
+	Credentials map[string]string `mapstructure:"credentials"`
+	// Propagation is how long records are given to propagate before the challenges are answered. Defaults to 2m
+	Propagation string `mapstructure:"propagation"`
+}
+
+// Enabled returns true when certificates are issued with ACME
+func (c Config) Enabled() bool {
+	return len(c.Domains) != 0
+}
+
+// Validate checks the provider exists and the durations parse
+func (c Config) Validate() error {
+	if _, ok := Providers[c.Provider]; !ok {
+		return errors.New(fmt.Sprintf("%s is not a DNS provider. Expected one of %s", c.Provider, strings.Join(ProviderNames(), ", ")))
+	}
+	for _, d := range c.Domains {
+		if d == "" || strings.Contains(strings.TrimPrefix(d, "*."), "*") {
+			return errors.New(fmt.Sprintf("%s is not a valid certificate domain", d))
+		}
+	}
+	if c.Propagation != "" {
+		if _, err := time.ParseDuration(c.Propagation); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid propagation duration", c.Propagation))
+		}
+	}
+	return nil
+}
+
+func (c Config) cache() string {
+	if c.Cache == "" {
+		return DefaultCache
+	}
+	return c.Cache
+}
+
+func (c Config) propagation() time.Duration {
+	d, err := time.ParseDuration(c.Propagation)
+	if err != nil {
+		return defaultPropagation
+	}
+	return d
+}
+
+// Manager issues and renews the certificate, and serves it to TLS clients
+type Manager struct {
+	config   Config
+	provider DNSProvider
+	client   *xacme.Client
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewManager creates a Manager, creating the ACME account key or loading the
+// account key and certificate from the cache
+func NewManager(config Config) (*Manager, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	provider, err := Providers[config.Provider](config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(config.cache(), 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadKey(filepath.Join(config.cache(), "account.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	directory := config.Directory
+	if directory == "" {
+		directory = LetsEncrypt
+	}
+	m := &Manager{
+		config:   config,
+		provider: provider,
+		client:   &xacme.Client{Key: key, DirectoryURL: directory},
+	}
+
+	if cert, err := loadCertificate(m.certPath(), m.keyPath()); err == nil {
+		m.cert = cert
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Unable to load the cached ACME certificate")
+	}
+	return m, nil
+}
+
+func (m *Manager) certPath() string {
+	return filepath.Join(m.config.cache(), "cert.pem")
+}
+
+func (m *Manager) keyPath() string {
+	return filepath.Join(m.config.cache(), "key.pem")
+}
+
+// loadKey reads the EC private key in name, or creates it if it does not exist
+func loadKey(name string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New(fmt.Sprintf("%s is not a PEM encoded key", name))
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// loadCertificate reads the certificate chain and key, and parses the leaf
+func loadCertificate(certPath, keyPath string) (*tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// GetCertificate serves the issued certificate. It is used as the GetCertificate of the TLS config
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return nil, ErrNoCertificate
+	}
+	return m.cert, nil
+}
+
+// NeedsRenewal returns true when there is no certificate for the configured
+// domains, or it expires within RenewBefore
+func (m *Manager) NeedsRenewal() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil || time.Until(m.cert.Leaf.NotAfter) < RenewBefore {
+		return true
+	}
+
+	names := append([]string{}, m.cert.Leaf.DNSNames...)
+	domains := append([]string{}, m.config.Domains...)
+	sort.Strings(names)
+	sort.Strings(domains)
+	return strings.Join(names, ",") != strings.Join(domains, ",")
+}
+
+// challenge is a published DNS-01 challenge record
+type challenge struct {
+	fqdn      string
+	value     string
+	challenge *xacme.Challenge
+	authz     string
+}
+
+// Renew issues a new certificate for the domains, answering every challenge
+// with a TXT record published by the DNS provider
+func (m *Manager) Renew(ctx context.Context) error {
+	account := &xacme.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+	if _, err := m.client.Register(ctx, account, xacme.AcceptTOS); err != nil && err != xacme.ErrAccountAlreadyExists {
+		return errors.Wrap(err, "unable to register ACME account")
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, xacme.DomainIDs(m.config.Domains...))
+	if err != nil {
+		return err
+	}
+
+	var challenges []challenge
+	defer func() {
+		for _, c := range challenges {
+			if err := m.provider.CleanUp(context.Background(), c.fqdn, c.value); err != nil {
+				log.WithFields(log.Fields{
+					"fqdn":  c.fqdn,
+					"error": err,
+				}).Warn("Unable to remove ACME challenge record")
+			}
+		}
+	}()
+
+	for _, url := range order.AuthzURLs {
+		authz, err := m.client.GetAuthorization(ctx, url)
+		if err != nil {
+			return err
+		}
+		if authz.Status != xacme.StatusPending {
+			continue
+		}
+
+		var chal *xacme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "dns-01" {
+				chal = c
+			}
+		}
+		if chal == nil {
+			return errors.New(fmt.Sprintf("no dns-01 challenge for %s", authz.Identifier.Value))
+		}
+		value, err := m.client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return err
+		}
+
+		fqdn := "_acme-challenge." + authz.Identifier.Value + "."
+		if err := m.provider.Present(ctx, fqdn, value); err != nil {
+			return errors.Wrapf(err, "unable to publish the challenge record of %s", authz.Identifier.Value)
+		}
+		challenges = append(challenges, challenge{fqdn: fqdn, value: value, challenge: chal, authz: url})
+	}
+
+	if len(challenges) != 0 {
+		log.WithFields(log.Fields{
+			"wait": m.config.propagation(),
+		}).Debug("Waiting for ACME challenge records to propagate")
+		select {
+		case <-time.After(m.config.propagation()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, c := range challenges {
+		if _, err := m.client.Accept(ctx, c.challenge); err != nil {
+			return err
+		}
+		if _, err := m.client.WaitAuthorization(ctx, c.authz); err != nil {
+			return errors.Wrapf(err, "challenge of %s failed", strings.TrimSuffix(strings.TrimPrefix(c.fqdn, "_acme-challenge."), "."))
+		}
+	}
+
+	if order, err = m.client.WaitOrder(ctx, order.URI); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.config.Domains[0]},
+		DNSNames: m.config.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return err
+	}
+
+	return m.store(chain, key)
+}
+
+// store writes the certificate chain and key to the cache and serves them
+func (m *Manager) store(chain [][]byte, key *ecdsa.PrivateKey) error {
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	if err := ioutil.WriteFile(m.keyPath(), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(m.certPath(), certPEM, 0644); err != nil {
+		return err
+	}
+	cert, err := loadCertificate(m.certPath(), m.keyPath())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = cert
+	return nil
+}
@@ -0,0 +1,66 @@
+package acme_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/acme"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{Domains: []string{"example.com", "*.example.com"}, Provider: "cloudflare", Propagation: "30s"}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []Config{
+		{Domains: []string{"example.com"}, Provider: "godaddy"},
+		{Domains: []string{"a.*.example.com"}, Provider: "cloudflare"},
+		{Domains: []string{"example.com"}, Provider: "cloudflare", Propagation: "soon"},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v was valid", c)
+		}
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	cache, err := ioutil.TempDir("", "satellitetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cache)
+
+	config := Config{
+		Domains:     []string{"example.com"},
+		Cache:       cache,
+		Provider:    "exec",
+		Credentials: map[string]string{"command": "/bin/true"},
+	}
+	manager, err := NewManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cache, "account.key")); err != nil {
+		t.Error("account key was not created")
+	}
+	if !manager.NeedsRenewal() {
+		t.Error("missing certificate does not need renewal")
+	}
+	if _, err := manager.GetCertificate(nil); err != ErrNoCertificate {
+		t.Error("certificate was served before it was issued")
+	}
+
+	// The account key is reused
+	if _, err := NewManager(config); err != nil {
+		t.Error(err)
+	}
+
+	config.Credentials = nil
+	if _, err := NewManager(config); err == nil {
+		t.Error("provider without credentials was created")
+	}
+}
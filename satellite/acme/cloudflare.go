@@ -0,0 +1,145 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// cloudflareEndpoint is the Cloudflare API used when acme.credentials.endpoint is not set
+const cloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+// cloudflare publishes records with an API token which can edit the DNS of the zone
+type cloudflare struct {
+	endpoint string
+	token    string
+	client   *http.Client
+
+	mu sync.Mutex
+	// records are the IDs of created records by fqdn and value
+	records map[string]string
+}
+
+func newCloudflare(credentials map[string]string) (DNSProvider, error) {
+	token, err := credential(credentials, "api_token")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := credentials["endpoint"]
+	if endpoint == "" {
+		endpoint = cloudflareEndpoint
+	}
+	return &cloudflare{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		records:  make(map[string]string),
+	}, nil
+}
+
+// cloudflareResponse is the envelope of every Cloudflare API response
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (p *cloudflare) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+path, &reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return errors.Wrapf(err, "cloudflare %s %s: %s", method, path, resp.Status)
+	}
+	if !envelope.Success {
+		messages := make([]string, 0, len(envelope.Errors))
+		for _, e := range envelope.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.New(fmt.Sprintf("cloudflare %s %s: %s", method, path, strings.Join(messages, ", ")))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// zone gets the ID of the zone of fqdn
+func (p *cloudflare) zone(ctx context.Context, fqdn string) (string, error) {
+	for _, name := range zoneCandidates(fqdn) {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		if err := p.do(ctx, "GET", "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) != 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("cloudflare: no zone for %s", fqdn))
+}
+
+// Present creates a TXT record
+func (p *cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	zone, err := p.zone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	record := map[string]interface{}{
+		"type":    "TXT",
+		"name":    strings.TrimSuffix(fqdn, "."),
+		"content": value,
+		"ttl":     120,
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, "POST", "/zones/"+zone+"/dns_records", record, &created); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[fqdn+"|"+value] = zone + "/dns_records/" + created.ID
+	return nil
+}
+
+// CleanUp deletes the TXT record created by Present
+func (p *cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	record, ok := p.records[fqdn+"|"+value]
+	delete(p.records, fqdn+"|"+value)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return p.do(ctx, "DELETE", "/zones/"+record, nil, nil)
+}
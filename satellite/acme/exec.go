@@ -0,0 +1,41 @@
+package acme
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// execProvider runs a command to publish records for DNS providers without
+// built in support. The command is run with present or cleanup, the FQDN, and
+// the value
+type execProvider struct {
+	command string
+}
+
+func newExec(credentials map[string]string) (DNSProvider, error) {
+	command, err := credential(credentials, "command")
+	if err != nil {
+		return nil, err
+	}
+	return &execProvider{command: command}, nil
+}
+
+func (p *execProvider) run(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, p.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s %s: %s", p.command, action, out)
+	}
+	return nil
+}
+
+// Present runs the command with present
+func (p *execProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+// CleanUp runs the command with cleanup
+func (p *execProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
@@ -0,0 +1,174 @@
+package acme
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// namecheapEndpoint is the Namecheap API used when acme.credentials.endpoint is not set
+const namecheapEndpoint = "https://api.namecheap.com/xml.response"
+
+// namecheap publishes records with an API key. The API replaces every host
+// record of a domain at once, so the records are read and written back with
+// the challenge added or removed
+type namecheap struct {
+	endpoint string
+	apiUser  string
+	apiKey   string
+	username string
+	clientIP string
+	client   *http.Client
+
+	// mu serializes changes, since each one rewrites every record of the domain
+	mu sync.Mutex
+}
+
+func newNamecheap(credentials map[string]string) (DNSProvider, error) {
+	apiUser, err := credential(credentials, "api_user")
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := credential(credentials, "api_key")
+	if err != nil {
+		return nil, err
+	}
+	clientIP, err := credential(credentials, "client_ip")
+	if err != nil {
+		return nil, err
+	}
+	username := credentials["username"]
+	if username == "" {
+		username = apiUser
+	}
+	endpoint := credentials["endpoint"]
+	if endpoint == "" {
+		endpoint = namecheapEndpoint
+	}
+	return &namecheap{
+		endpoint: endpoint,
+		apiUser:  apiUser,
+		apiKey:   apiKey,
+		username: username,
+		clientIP: clientIP,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// namecheapHost is a host record of a domain
+type namecheapHost struct {
+	Name    string `xml:"Name,attr"`
+	Type    string `xml:"Type,attr"`
+	Address string `xml:"Address,attr"`
+	MXPref  string `xml:"MXPref,attr"`
+	TTL     string `xml:"TTL,attr"`
+}
+
+// namecheapResponse is the envelope of every Namecheap API response
+type namecheapResponse struct {
+	Status string          `xml:"Status,attr"`
+	Errors []string        `xml:"Errors>Error"`
+	Hosts  []namecheapHost `xml:"CommandResponse>DomainDNSGetHostsResult>host"`
+}
+
+func (p *namecheap) do(ctx context.Context, command string, values url.Values) (namecheapResponse, error) {
+	var response namecheapResponse
+
+	values.Set("ApiUser", p.apiUser)
+	values.Set("ApiKey", p.apiKey)
+	values.Set("UserName", p.username)
+	values.Set("ClientIp", p.clientIP)
+	values.Set("Command", command)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return response, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return response, err
+	}
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return response, errors.Wrapf(err, "namecheap %s: %s", command, resp.Status)
+	}
+	if response.Status != "OK" {
+		return response, errors.New(fmt.Sprintf("namecheap %s: %s", command, strings.Join(response.Errors, ", ")))
+	}
+	return response, nil
+}
+
+// split gets the second and top level domain of fqdn and the host name relative to them
+func (p *namecheap) split(fqdn string) (sld, tld, host string, err error) {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	domain, err := publicsuffix.EffectiveTLDPlusOne(fqdn)
+	if err != nil {
+		return "", "", "", err
+	}
+	i := strings.Index(domain, ".")
+	return domain[:i], domain[i+1:], strings.TrimSuffix(strings.TrimSuffix(fqdn, domain), "."), nil
+}
+
+// update reads the host records of the domain of fqdn, changes them with f, and writes them back
+func (p *namecheap) update(ctx context.Context, fqdn string, f func(hosts []namecheapHost, host string) []namecheapHost) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sld, tld, host, err := p.split(fqdn)
+	if err != nil {
+		return err
+	}
+	domain := url.Values{"SLD": {sld}, "TLD": {tld}}
+	response, err := p.do(ctx, "namecheap.domains.dns.getHosts", domain)
+	if err != nil {
+		return err
+	}
+
+	values := url.Values{"SLD": {sld}, "TLD": {tld}}
+	for i, h := range f(response.Hosts, host) {
+		n := strconv.Itoa(i + 1)
+		values.Set("HostName"+n, h.Name)
+		values.Set("RecordType"+n, h.Type)
+		values.Set("Address"+n, h.Address)
+		values.Set("MXPref"+n, h.MXPref)
+		values.Set("TTL"+n, h.TTL)
+	}
+	_, err = p.do(ctx, "namecheap.domains.dns.setHosts", values)
+	return err
+}
+
+// Present adds a TXT record to the host records of the domain
+func (p *namecheap) Present(ctx context.Context, fqdn, value string) error {
+	return p.update(ctx, fqdn, func(hosts []namecheapHost, host string) []namecheapHost {
+		return append(hosts, namecheapHost{Name: host, Type: "TXT", Address: value, MXPref: "10", TTL: "60"})
+	})
+}
+
+// CleanUp removes the TXT record from the host records of the domain
+func (p *namecheap) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.update(ctx, fqdn, func(hosts []namecheapHost, host string) []namecheapHost {
+		kept := make([]namecheapHost, 0, len(hosts))
+		for _, h := range hosts {
+			if h.Name != host || h.Type != "TXT" || h.Address != value {
+				kept = append(kept, h)
+			}
+		}
+		return kept
+	})
+}
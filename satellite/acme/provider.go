@@ -0,0 +1,60 @@
+package acme
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DNSProvider publishes the TXT records of DNS-01 challenges
+type DNSProvider interface {
+	// Present creates a TXT record at fqdn with value. There may be several
+	// values at one fqdn, like for example.com and *.example.com
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes the TXT record at fqdn with value
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// NewProvider creates a DNS provider from the acme.credentials of the configuration
+type NewProvider func(credentials map[string]string) (DNSProvider, error)
+
+// Providers are the DNS providers usable in acme.provider by name. Add to it
+// to plug in another provider
+var Providers = map[string]NewProvider{
+	"cloudflare": newCloudflare,
+	"exec":       newExec,
+	"namecheap":  newNamecheap,
+	"route53":    newRoute53,
+}
+
+// ProviderNames gets the names of the DNS providers
+func ProviderNames() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// credential gets the required credential key
+func credential(credentials map[string]string, key string) (string, error) {
+	v := credentials[key]
+	if v == "" {
+		return "", errors.New(fmt.Sprintf("acme.credentials.%s is required", key))
+	}
+	return v, nil
+}
+
+// zoneCandidates are the names which may be the zone of fqdn, most specific first
+func zoneCandidates(fqdn string) []string {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	candidates := make([]string, 0, len(labels))
+	for i := 0; i < len(labels)-1; i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
@@ -0,0 +1,141 @@
+package acme_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/acme"
+)
+
+func TestProviders_cloudflare(t *testing.T) {
+	var created, deleted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.Write([]byte(`{"success": false, "errors": [{"message": "unauthorized"}]}`))
+			return
+		}
+		switch {
+		case req.Method == "GET" && req.URL.Query().Get("name") == "example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "zone"}]}`))
+		case req.Method == "GET":
+			w.Write([]byte(`{"success": true, "result": []}`))
+		case req.Method == "POST" && req.URL.Path == "/zones/zone/dns_records":
+			var record map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&record)
+			created = record["name"].(string) + " " + record["content"].(string)
+			w.Write([]byte(`{"success": true, "result": {"id": "record"}}`))
+		case req.Method == "DELETE":
+			deleted = req.URL.Path
+			w.Write([]byte(`{"success": true, "result": {"id": "record"}}`))
+		}
+	}))
+	defer server.Close()
+
+	provider, err := Providers["cloudflare"](map[string]string{"api_token": "token", "endpoint": server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := provider.Present(ctx, "_acme-challenge.www.example.com.", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if created != "_acme-challenge.www.example.com value" {
+		t.Errorf("unexpected record %q", created)
+	}
+	if err := provider.CleanUp(ctx, "_acme-challenge.www.example.com.", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != "/zones/zone/dns_records/record" {
+		t.Errorf("unexpected delete %q", deleted)
+	}
+}
+
+func TestProviders_route53(t *testing.T) {
+	var changes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/2013-04-01/hostedzonesbyname":
+			name := req.URL.Query().Get("dnsname")
+			w.Write([]byte(`<ListHostedZonesByNameResponse><HostedZones><HostedZone><Id>/hostedzone/Z1</Id><Name>` + name + `.</Name></HostedZone></HostedZones></ListHostedZonesByNameResponse>`))
+		case "/2013-04-01/hostedzone/Z1/rrset":
+			body, _ := ioutil.ReadAll(req.Body)
+			changes = append(changes, string(body))
+			w.Write([]byte(`<ChangeResourceRecordSetsResponse/>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider, err := Providers["route53"](map[string]string{"access_key_id": "AKID", "secret_access_key": "secret", "endpoint": server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	fqdn := "_acme-challenge.example.com."
+	for _, v := range []string{"one", "two"} {
+		if err := provider.Present(ctx, fqdn, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := provider.CleanUp(ctx, fqdn, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CleanUp(ctx, fqdn, "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 4 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	// Both values of a name are kept in one record set
+	if !strings.Contains(changes[1], "<Action>UPSERT</Action>") || !strings.Contains(changes[1], "&#34;one&#34;") || !strings.Contains(changes[1], "&#34;two&#34;") {
+		t.Errorf("unexpected change %s", changes[1])
+	}
+	if !strings.Contains(changes[3], "<Action>DELETE</Action>") || strings.Contains(changes[3], "one") {
+		t.Errorf("unexpected change %s", changes[3])
+	}
+}
+
+func TestProviders_namecheap(t *testing.T) {
+	hosts := `<host Name="@" Type="A" Address="192.0.2.1" MXPref="10" TTL="1800"/>`
+	var set string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		if req.Form.Get("ApiKey") != "key" || req.Form.Get("SLD") != "example" || req.Form.Get("TLD") != "co.uk" {
+			w.Write([]byte(`<ApiResponse Status="ERROR"><Errors><Error>bad request</Error></Errors></ApiResponse>`))
+			return
+		}
+		switch req.Form.Get("Command") {
+		case "namecheap.domains.dns.getHosts":
+			w.Write([]byte(`<ApiResponse Status="OK"><CommandResponse><DomainDNSGetHostsResult>` + hosts + `</DomainDNSGetHostsResult></CommandResponse></ApiResponse>`))
+		case "namecheap.domains.dns.setHosts":
+			set = req.Form.Encode()
+			w.Write([]byte(`<ApiResponse Status="OK"></ApiResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	provider, err := Providers["namecheap"](map[string]string{"api_user": "user", "api_key": "key", "client_ip": "192.0.2.2", "endpoint": server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Present(context.Background(), "_acme-challenge.www.example.co.uk.", "value"); err != nil {
+		t.Fatal(err)
+	}
+	// Existing records are written back with the challenge
+	for _, v := range []string{"HostName1=%40", "Address1=192.0.2.1", "HostName2=_acme-challenge.www", "RecordType2=TXT", "Address2=value"} {
+		if !strings.Contains(set, v) {
+			t.Errorf("%s was not set in %s", v, set)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// route53Endpoint is the Route 53 API used when acme.credentials.endpoint is not set
+const route53Endpoint = "https://route53.amazonaws.com"
+
+// route53 publishes records with an IAM access key which can change the
+// record sets of the hosted zone. Requests are signed with AWS Signature Version 4
+type route53 struct {
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	hostedZoneID string
+	client       *http.Client
+
+	mu sync.Mutex
+	// values are the published values by fqdn. Route 53 holds every value of a
+	// name in one record set, so they are changed together
+	values map[string][]string
+}
+
+func newRoute53(credentials map[string]string) (DNSProvider, error) {
+	accessKey, err := credential(credentials, "access_key_id")
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := credential(credentials, "secret_access_key")
+	if err != nil {
+		return nil, err
+	}
+	endpoint := credentials["endpoint"]
+	if endpoint == "" {
+		endpoint = route53Endpoint
+	}
+	return &route53{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: credentials["session_token"],
+		hostedZoneID: credentials["hosted_zone_id"],
+		client:       &http.Client{Timeout: 30 * time.Second},
+		values:       make(map[string][]string),
+	}, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign adds the AWS Signature Version 4 of req with body to its headers
+func (p *route53) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	signedHeaders := "host;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" + "x-amz-date:" + amzDate + "\n"
+	if p.sessionToken != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + p.sessionToken + "\n"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	// Route 53 is a global service signed in us-east-1
+	scope := date + "/us-east-1/route53/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+p.secretKey), date)
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "route53")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKey, scope, signedHeaders, signature))
+}
+
+func (p *route53) do(ctx context.Context, method, path string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	p.sign(req, body, time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("route53 %s %s: %s: %s", method, path, resp.Status, data))
+	}
+	if result == nil {
+		return nil
+	}
+	return xml.Unmarshal(data, result)
+}
+
+// zone gets the ID of the hosted zone of fqdn
+func (p *route53) zone(ctx context.Context, fqdn string) (string, error) {
+	if p.hostedZoneID != "" {
+		return p.hostedZoneID, nil
+	}
+	for _, name := range zoneCandidates(fqdn) {
+		var zones struct {
+			HostedZones []struct {
+				ID   string `xml:"Id"`
+				Name string `xml:"Name"`
+			} `xml:"HostedZones>HostedZone"`
+		}
+		path := "/2013-04-01/hostedzonesbyname?dnsname=" + url.QueryEscape(name) + "&maxitems=1"
+		if err := p.do(ctx, "GET", path, nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones.HostedZones) != 0 && zones.HostedZones[0].Name == name+"." {
+			return strings.TrimPrefix(zones.HostedZones[0].ID, "/hostedzone/"), nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("route53: no hosted zone for %s", fqdn))
+}
+
+// route53Change is a ChangeResourceRecordSets request changing one TXT record set
+type route53Change struct {
+	XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Action  string   `xml:"ChangeBatch>Changes>Change>Action"`
+	Name    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Name"`
+	Type    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Type"`
+	TTL     int      `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>TTL"`
+	Values  []string `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+// change sets the TXT record set of fqdn to values
+func (p *route53) change(ctx context.Context, action, fqdn string, values []string) error {
+	zone, err := p.zone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	body, err := xml.Marshal(route53Change{Action: action, Name: fqdn, Type: "TXT", TTL: 60, Values: quoted})
+	if err != nil {
+		return err
+	}
+	return p.do(ctx, "POST", "/2013-04-01/hostedzone/"+zone+"/rrset", append([]byte(xml.Header), body...), nil)
+}
+
+// Present adds value to the TXT record set of fqdn
+func (p *route53) Present(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	values := append(p.values[fqdn], value)
+	if err := p.change(ctx, "UPSERT", fqdn, values); err != nil {
+		return err
+	}
+	p.values[fqdn] = values
+	return nil
+}
+
+// CleanUp removes value from the TXT record set of fqdn, and deletes the set when it is the last value
+func (p *route53) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	values := p.values[fqdn]
+	remaining := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			remaining = append(remaining, v)
+		}
+	}
+	if len(remaining) == len(values) {
+		return nil
+	}
+
+	var err error
+	if len(remaining) == 0 {
+		err = p.change(ctx, "DELETE", fqdn, values)
+	} else {
+		err = p.change(ctx, "UPSERT", fqdn, remaining)
+	}
+	if err != nil {
+		return err
+	}
+	p.values[fqdn] = remaining
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package assets holds the files built into the satellite binary, so a release
+// needs no asset paths at runtime
+package assets
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed personas blocklists
+var files embed.FS
+
+// Persona is a set of built in error pages which look like those of a common web server
+type Persona struct {
+	name string
+}
+
+// Personas gets the names of the built in personas
+func Personas() []string {
+	entries, err := fs.ReadDir(files, "personas")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPersona gets the built in persona called name, like nginx, apache, or iis
+func NewPersona(name string) (Persona, error) {
+	if _, err := fs.Stat(files, "personas/"+name); err != nil || name == "" || strings.Contains(name, "/") {
+		return Persona{}, errors.New(fmt.Sprintf("%s is not a built in persona. Expected one of %s", name, strings.Join(Personas(), ", ")))
+	}
+	return Persona{name: name}, nil
+}
+
+// Page gets the error page of the persona for status, or with 200 the thank you page acknowledging forms
+func (p Persona) Page(status int) ([]byte, bool) {
+	if p.name == "" {
+		return nil, false
+	}
+	page, err := files.ReadFile("personas/" + p.name + "/" + strconv.Itoa(status) + ".html")
+	if err != nil {
+		return nil, false
+	}
+	return page, true
+}
+
+// Blocklist gets the built in blocklist called name, like bogons
+func Blocklist(name string) ([]byte, error) {
+	data, err := files.ReadFile("blocklists/" + name + ".txt")
+	if err != nil || strings.Contains(name, "/") {
+		return nil, errors.New(fmt.Sprintf("%s is not a built in blocklist", name))
+	}
+	return data, nil
+}
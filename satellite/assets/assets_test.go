@@ -0,0 +1,40 @@
+package assets_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/assets"
+)
+
+func TestNewPersona(t *testing.T) {
+	for _, name := range []string{"nginx", "apache", "iis"} {
+		persona, err := NewPersona(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range []int{200, 404, 500, 503} {
+			if page, ok := persona.Page(status); !ok || !strings.Contains(string(page), "<html") {
+				t.Errorf("%s has no %d page", name, status)
+			}
+		}
+		if _, ok := persona.Page(418); ok {
+			t.Errorf("%s has a 418 page", name)
+		}
+	}
+
+	for _, name := range []string{"", "tomcat", "../blocklists"} {
+		if _, err := NewPersona(name); err == nil {
+			t.Errorf("%q is a persona", name)
+		}
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	if _, err := Blocklist("bogons"); err != nil {
+		t.Error(err)
+	}
+	if _, err := Blocklist("missing"); err == nil {
+		t.Error("missing blocklist was found")
+	}
+}
@@ -0,0 +1,189 @@
+package blocklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/satellite/assets"
+	"github.com/t94j0/satellite/satellite/scope"
+)
+
+// Formats of blocklist feeds
+const (
+	// FormatText is a list of IPs, CIDRs, and IP ranges. Comments start with # or ;
+	FormatText = "text"
+	// FormatJSON is a JSON array, or newline delimited JSON values, of IPs and
+	// CIDRs or of objects holding them in Field
+	FormatJSON = "json"
+)
+
+// builtinPrefix prefixes the URL of feeds built into the binary, like builtin:bogons
+const builtinPrefix = "builtin:"
+
+// defaultField is the key of the CIDR in objects of JSON feeds
+const defaultField = "cidr"
+
+// Feed is a remote blocklist of IPs and CIDR ranges
+type Feed struct {
+	// URL is where the feed is downloaded from, or builtin:<name> for a feed built into the binary
+	URL string `mapstructure:"url"`
+	// Format is the format of the feed: text or json. Defaults to text
+	Format string `mapstructure:"format"`
+	// Field is the key of the CIDR in objects of a JSON feed. Defaults to cidr
+	Field string `mapstructure:"field"`
+}
+
+// Validate checks the feed can be fetched and parsed
+func (f Feed) Validate() error {
+	if strings.HasPrefix(f.URL, builtinPrefix) {
+		_, err := assets.Blocklist(strings.TrimPrefix(f.URL, builtinPrefix))
+		return err
+	}
+	if !strings.HasPrefix(f.URL, "http://") && !strings.HasPrefix(f.URL, "https://") {
+		return errors.New(fmt.Sprintf("%s is not a valid feed URL", f.URL))
+	}
+	switch f.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return errors.New(fmt.Sprintf("%s is not a valid feed format", f.Format))
+	}
+	return nil
+}
+
+// Fetcher downloads blocklist feeds
+type Fetcher struct {
+	client *http.Client
+}
+
+// NewFetcher creates a Fetcher
+func NewFetcher() *Fetcher {
+	return &Fetcher{client: &http.Client{Timeout: time.Minute}}
+}
+
+// Fetch downloads and parses feed
+func (f *Fetcher) Fetch(feed Feed) ([]*net.IPNet, error) {
+	if strings.HasPrefix(feed.URL, builtinPrefix) {
+		data, err := assets.Blocklist(strings.TrimPrefix(feed.URL, builtinPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return Parse(data, FormatText, "")
+	}
+
+	data, err := f.get(feed.URL)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, feed.Format, feed.Field)
+}
+
+// get downloads url
+func (f *Fetcher) get(url string) ([]byte, error) {
+	resp, err := f.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("fetching %s: %s", url, resp.Status))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Parse gets the IP ranges of a feed. Entries which are not IPs, CIDRs, or IP
+// ranges are ignored
+func Parse(data []byte, format, field string) ([]*net.IPNet, error) {
+	if field == "" {
+		field = defaultField
+	}
+	return parse(data, format, []string{field})
+}
+
+func parse(data []byte, format string, fields []string) ([]*net.IPNet, error) {
+	if format == FormatJSON {
+		targets, err := jsonTargets(data, fields)
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(strings.Join(targets, "\n"))
+	} else {
+		data = stripComments(data)
+	}
+
+	ranges, _, err := scope.Import(data)
+	if err != nil {
+		return nil, err
+	}
+
+	nets := make([]*net.IPNet, 0, len(ranges))
+	for _, r := range ranges {
+		_, network, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// stripComments removes ; comments, used by feeds like Spamhaus DROP
+func stripComments(data []byte) []byte {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if j := bytes.IndexByte(line, ';'); j >= 0 {
+			lines[i] = line[:j]
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// jsonTargets gets the top level strings of a JSON feed, and the strings held
+// by fields in objects at any depth
+func jsonTargets(data []byte, fields []string) ([]string, error) {
+	targets := make([]string, 0)
+	var collect func(v interface{}, take bool)
+	collect = func(v interface{}, take bool) {
+		switch t := v.(type) {
+		case string:
+			if take {
+				targets = append(targets, t)
+			}
+		case []interface{}:
+			for _, e := range t {
+				collect(e, take)
+			}
+		case map[string]interface{}:
+			for key, e := range t {
+				collect(e, isField(key, fields))
+			}
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var v interface{}
+		if err := decoder.Decode(&v); err == io.EOF {
+			return targets, nil
+		} else if err != nil {
+			return nil, err
+		}
+		collect(v, true)
+	}
+}
+
+func isField(key string, fields []string) bool {
+	for _, f := range fields {
+		if key == f {
+			return true
+		}
+	}
+	return false
+}
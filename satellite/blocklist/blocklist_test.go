@@ -0,0 +1,160 @@
+package blocklist_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/blocklist"
+)
+
+func contains(nets []*net.IPNet, ip string) bool {
+	for _, n := range nets {
+		if n.Contains(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParse_text(t *testing.T) {
+	feed := "; Spamhaus DROP List\n1.10.16.0/20 ; SBL256894\n# comment\n192.0.2.7\n"
+	nets, err := Parse([]byte(feed), FormatText, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 || !contains(nets, "1.10.17.1") || !contains(nets, "192.0.2.7") {
+		t.Errorf("unexpected ranges %v", nets)
+	}
+}
+
+func TestParse_json(t *testing.T) {
+	for _, feed := range []string{
+		`["1.10.16.0/20", "192.0.2.7"]`,
+		`[{"cidr": "1.10.16.0/20"}, {"cidr": "192.0.2.7"}]`,
+		"{\"cidr\": \"1.10.16.0/20\", \"sblid\": \"SBL256894\"}\n{\"cidr\": \"192.0.2.7\"}\n",
+	} {
+		nets, err := Parse([]byte(feed), FormatJSON, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nets) != 2 || !contains(nets, "1.10.17.1") || !contains(nets, "192.0.2.7") {
+			t.Errorf("unexpected ranges %v of %s", nets, feed)
+		}
+	}
+
+	if _, err := Parse([]byte("[1,"), FormatJSON, ""); err == nil {
+		t.Error("invalid JSON was parsed")
+	}
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/drop.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("10.0.0.0/8\n"))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	nets, err := fetcher.Fetch(Feed{URL: server.URL + "/drop.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(nets, "10.1.2.3") {
+		t.Errorf("unexpected ranges %v", nets)
+	}
+
+	if _, err := fetcher.Fetch(Feed{URL: server.URL + "/missing"}); err == nil {
+		t.Error("missing feed was fetched")
+	}
+}
+
+func TestFetcher_Fetch_builtin(t *testing.T) {
+	nets, err := NewFetcher().Fetch(Feed{URL: "builtin:bogons"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(nets, "10.1.2.3") || !contains(nets, "fe80::1") || contains(nets, "8.8.8.8") {
+		t.Errorf("unexpected ranges %v", nets)
+	}
+}
+
+func TestFeed_Validate(t *testing.T) {
+	for _, feed := range []Feed{{URL: "https://example.com/drop.txt", Format: FormatJSON}, {URL: "builtin:bogons"}} {
+		if err := feed.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, feed := range []Feed{{URL: "example.com/drop.txt"}, {URL: "https://example.com", Format: "csv"}, {URL: "builtin:missing"}} {
+		if err := feed.Validate(); err == nil {
+			t.Errorf("%+v was valid", feed)
+		}
+	}
+}
+
+func TestFetcher_FetchProvider(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/ip-ranges.json":
+			w.Write([]byte(`{"syncToken": "1", "prefixes": [{"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2"}],
+				"ipv6_prefixes": [{"ipv6_prefix": "2600:1f14::/35"}]}`))
+		case "/details":
+			w.Write([]byte(`<a href="` + server.URL + `/ServiceTags_Public_20240101.json">download</a>`))
+		case "/ServiceTags_Public_20240101.json":
+			w.Write([]byte(`{"values": [{"name": "AzureCloud", "properties": {"region": "", "addressPrefixes": ["13.64.0.0/16"]}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	defer func(providers map[string]Provider) { Providers = providers }(Providers)
+	aws, azure := Providers["aws"], Providers["azure"]
+	aws.URL = server.URL + "/ip-ranges.json"
+	azure.URL = server.URL + "/details"
+	azure.Link = regexp.MustCompile(`http://[^"]*ServiceTags_Public_\d+\.json`)
+	Providers = map[string]Provider{"aws": aws, "azure": azure}
+
+	fetcher := NewFetcher()
+	nets, err := fetcher.FetchProvider("aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 || !contains(nets, "3.5.141.1") || !contains(nets, "2600:1f14::1") {
+		t.Errorf("unexpected aws ranges %v", nets)
+	}
+
+	nets, err = fetcher.FetchProvider("azure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 1 || !contains(nets, "13.64.1.1") {
+		t.Errorf("unexpected azure ranges %v", nets)
+	}
+
+	if _, err := fetcher.FetchProvider("linode"); err == nil {
+		t.Error("unknown provider was fetched")
+	}
+}
+
+func TestFetcher_FetchTorExits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("185.220.101.1\n2a0b:f4c2::1\nnot an ip\n"))
+	}))
+	defer server.Close()
+
+	defer func(url string) { TorExitListURL = url }(TorExitListURL)
+	TorExitListURL = server.URL
+
+	ips, err := NewFetcher().FetchTorExits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 || !ips[0].Equal(net.ParseIP("185.220.101.1")) {
+		t.Errorf("unexpected exits %v", ips)
+	}
+}
@@ -0,0 +1,79 @@
+package blocklist
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Provider is a hosting provider which publishes its IP ranges
+type Provider struct {
+	// URL is where the provider publishes its ranges
+	URL string
+	// Format is the format of the published ranges
+	Format string
+	// Fields are the keys of the ranges in JSON objects
+	Fields []string
+	// Link finds the URL of the ranges in the page at URL, for providers which
+	// publish them at a new URL every release
+	Link *regexp.Regexp
+}
+
+// Providers are the hosting providers whose ranges can be blacklisted, by the
+// names used in blacklist_hosting_providers
+var Providers = map[string]Provider{
+	"aws": {
+		URL:    "https://ip-ranges.amazonaws.com/ip-ranges.json",
+		Format: FormatJSON,
+		Fields: []string{"ip_prefix", "ipv6_prefix"},
+	},
+	"azure": {
+		URL:    "https://www.microsoft.com/en-us/download/details.aspx?id=56519",
+		Format: FormatJSON,
+		Fields: []string{"addressPrefixes"},
+		Link:   regexp.MustCompile(`https://download\.microsoft\.com/download/[^"']*ServiceTags_Public_\d+\.json`),
+	},
+	"digitalocean": {
+		URL:    "https://digitalocean.com/geo/google.csv",
+		Format: FormatText,
+	},
+	"gcp": {
+		URL:    "https://www.gstatic.com/ipranges/cloud.json",
+		Format: FormatJSON,
+		Fields: []string{"ipv4Prefix", "ipv6Prefix"},
+	},
+	"oracle": {
+		URL:    "https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json",
+		Format: FormatJSON,
+		Fields: []string{"cidr"},
+	},
+}
+
+// FetchProvider downloads and parses the published ranges of the provider name
+func (f *Fetcher) FetchProvider(name string) ([]*net.IPNet, error) {
+	provider, ok := Providers[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s is not a known hosting provider", name))
+	}
+
+	url := provider.URL
+	if provider.Link != nil {
+		page, err := f.get(url)
+		if err != nil {
+			return nil, err
+		}
+		link := provider.Link.Find(page)
+		if link == nil {
+			return nil, errors.New(fmt.Sprintf("no %s ranges linked from %s", name, url))
+		}
+		url = string(link)
+	}
+
+	data, err := f.get(url)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, provider.Format, provider.Fields)
+}
@@ -0,0 +1,16 @@
+package blocklist_test
+
+import (
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/blocklist"
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+func TestProviders(t *testing.T) {
+	for _, name := range path.HostingProviders {
+		if _, ok := Providers[name]; !ok {
+			t.Errorf("%s has no published ranges", name)
+		}
+	}
+}
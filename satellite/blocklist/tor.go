@@ -0,0 +1,28 @@
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+)
+
+// TorExitListURL is the Tor Project's list of exit node IPs
+var TorExitListURL = "https://check.torproject.org/torbulkexitlist"
+
+// FetchTorExits downloads the IPs of Tor exit nodes
+func (f *Fetcher) FetchTorExits() ([]net.IP, error) {
+	data, err := f.get(TorExitListURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]net.IP, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if ip := net.ParseIP(strings.TrimSpace(scanner.Text())); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, scanner.Err()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/blocklist"
+	sPath "github.com/t94j0/satellite/satellite/path"
+)
+
+// defaultBlocklistRefresh is how often blocklist feeds are fetched when blocklists.refresh is not set
+const defaultBlocklistRefresh = time.Hour
+
+// defaultHostingProviderRefresh is how often hosting provider ranges are fetched when hosting_providers.refresh is not set
+const defaultHostingProviderRefresh = 24 * time.Hour
+
+// defaultTorRefresh is how often the Tor exit node list is fetched when tor.refresh is not set
+const defaultTorRefresh = time.Hour
+
+// fetchBlocklists fetches every blocklist feed into the global blacklist. A feed
+// which cannot be fetched keeps its last ranges
+func fetchBlocklists(fetcher *blocklist.Fetcher, config *Configuration, paths pathSet) {
+	for _, feed := range config.Blocklists.Feeds {
+		ranges, err := fetcher.Fetch(feed)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"feed":  feed.URL,
+				"error": err,
+			}).Warn("Unable to fetch blocklist feed")
+			continue
+		}
+		paths.SetBlocklist(feed.URL, ranges)
+		log.WithFields(log.Fields{
+			"feed":   feed.URL,
+			"ranges": len(ranges),
+		}).Debug("Fetched blocklist feed")
+	}
+}
+
+// refreshBlocklists fetches the blocklist feeds every blocklists.refresh
+func refreshBlocklists(fetcher *blocklist.Fetcher, config *Configuration, paths pathSet) {
+	refresh, err := time.ParseDuration(config.Blocklists.Refresh)
+	if err != nil {
+		refresh = defaultBlocklistRefresh
+	}
+
+	for range time.Tick(refresh) {
+		fetchBlocklists(fetcher, config, paths)
+	}
+}
+
+// fetchHostingProviders fetches the published ranges of every hosting provider
+// usable in blacklist_hosting_providers. A provider which cannot be fetched
+// keeps its last ranges
+func fetchHostingProviders(fetcher *blocklist.Fetcher, paths pathSet) {
+	for _, name := range sPath.HostingProviders {
+		ranges, err := fetcher.FetchProvider(name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"provider": name,
+				"error":    err,
+			}).Warn("Unable to fetch hosting provider ranges")
+			continue
+		}
+		paths.SetHostingProvider(name, ranges)
+		log.WithFields(log.Fields{
+			"provider": name,
+			"ranges":   len(ranges),
+		}).Debug("Fetched hosting provider ranges")
+	}
+}
+
+// refreshHostingProviders fetches the hosting provider ranges now and every hosting_providers.refresh
+func refreshHostingProviders(fetcher *blocklist.Fetcher, config *Configuration, paths pathSet) {
+	refresh, err := time.ParseDuration(config.HostingProviders.Refresh)
+	if err != nil {
+		refresh = defaultHostingProviderRefresh
+	}
+
+	fetchHostingProviders(fetcher, paths)
+	for range time.Tick(refresh) {
+		fetchHostingProviders(fetcher, paths)
+	}
+}
+
+// refreshTorExits fetches the Tor exit node list now and every tor.refresh. The
+// cached list is used until the first fetch succeeds
+func refreshTorExits(fetcher *blocklist.Fetcher, config *Configuration, paths pathSet) {
+	refresh, err := time.ParseDuration(config.Tor.Refresh)
+	if err != nil {
+		refresh = defaultTorRefresh
+	}
+
+	for {
+		if ips, err := fetcher.FetchTorExits(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Unable to fetch Tor exit nodes")
+		} else if err := paths.SetTorExits(ips); err != nil {
+			log.Error(err)
+		} else {
+			log.WithFields(log.Fields{
+				"exits": len(ips),
+			}).Debug("Fetched Tor exit nodes")
+		}
+		time.Sleep(refresh)
+	}
+}
@@ -0,0 +1,96 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic starts every bundle so other files are not mistaken for one
+var magic = []byte("SATBNDL1")
+
+const saltSize = 16
+
+// ErrNotBundle is returned when a file is not an encrypted bundle
+var ErrNotBundle = errors.New("not an encrypted bundle")
+
+// ErrBadPassphrase is returned when a bundle can not be decrypted with the passphrase
+var ErrBadPassphrase = errors.New("wrong passphrase or corrupted bundle")
+
+// key derives the AES-256 key of a bundle from passphrase and salt
+func key(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// Seal encrypts data with AES-256-GCM under a key derived from passphrase with scrypt,
+// and writes the bundle to w
+func Seal(w io.Writer, passphrase string, data []byte) error {
+	if passphrase == "" {
+		return errors.New("passphrase is required")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	header := append(append(append([]byte{}, magic...), salt...), nonce...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(aead.Seal(nil, nonce, data, magic))
+	return err
+}
+
+// Open decrypts the bundle read from r with passphrase
+func Open(r io.Reader, passphrase string) ([]byte, error) {
+	sealed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < len(magic)+saltSize || !bytes.Equal(sealed[:len(magic)], magic) {
+		return nil, ErrNotBundle
+	}
+	salt := sealed[len(magic) : len(magic)+saltSize]
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[len(magic)+saltSize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrNotBundle
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], magic)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return data, nil
+}
+
+// newAEAD creates the cipher of a bundle with salt
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	k, err := key(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
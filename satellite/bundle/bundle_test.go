@@ -0,0 +1,33 @@
+package bundle_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/bundle"
+)
+
+func TestSeal_Open(t *testing.T) {
+	var sealed bytes.Buffer
+	if err := Seal(&sealed, "correct horse", []byte("campaign")); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed.Bytes(), []byte("campaign")) {
+		t.Error("bundle is not encrypted")
+	}
+
+	data, err := Open(bytes.NewReader(sealed.Bytes()), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "campaign" {
+		t.Errorf("expected campaign, got %q", data)
+	}
+
+	if _, err := Open(bytes.NewReader(sealed.Bytes()), "battery staple"); err != ErrBadPassphrase {
+		t.Errorf("expected ErrBadPassphrase, got %v", err)
+	}
+	if _, err := Open(bytes.NewReader([]byte("campaign")), "correct horse"); err != ErrNotBundle {
+		t.Errorf("expected ErrNotBundle, got %v", err)
+	}
+}
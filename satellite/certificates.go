@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/acme"
+	"github.com/t94j0/satellite/satellite/certs"
+	"github.com/t94j0/satellite/satellite/metrics"
+	"github.com/t94j0/satellite/satellite/notify"
+)
+
+var (
+	certificateExpiry     = metrics.NewGaugeVec("satellite_certificate_expiry_timestamp_seconds", "Unix time served certificates expire at", "certificate")
+	certificateLoadFailed = metrics.NewGaugeVec("satellite_certificate_load_failed", "1 while a served certificate can not be loaded", "certificate")
+)
+
+// certificateCheck is how often the ACME certificate is checked for renewal
+const certificateCheck = 12 * time.Hour
+
+// certificateWatch is how often served certificates are checked for expiry
+const certificateWatch = time.Hour
+
+// certificateTimeout is how long issuing a certificate may take
+const certificateTimeout = 15 * time.Minute
+
+// issueCertificate issues the ACME certificate if it is missing or expiring. Without a
+// certificate nothing can be served, so failing to issue the first one is fatal
+func issueCertificate(manager *acme.Manager) {
+	if !manager.NeedsRenewal() {
+		return
+	}
+
+	log.Info("Issuing ACME certificate")
+	ctx, cancel := context.WithTimeout(context.Background(), certificateTimeout)
+	defer cancel()
+	if err := manager.Renew(ctx); err != nil {
+		if _, cerr := manager.GetCertificate(nil); cerr == acme.ErrNoCertificate {
+			log.Fatal(err)
+		}
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to renew ACME certificate")
+		return
+	}
+	log.Info("Issued ACME certificate")
+}
+
+// renewCertificate renews the ACME certificate before it expires
+func renewCertificate(manager *acme.Manager) {
+	for range time.Tick(certificateCheck) {
+		issueCertificate(manager)
+	}
+}
+
+// exportCertificates sets the expiry metrics of every served certificate
+func exportCertificates(tracker *certs.Tracker) {
+	for _, s := range tracker.List() {
+		if s.Error != "" {
+			certificateLoadFailed.With(s.Name).Set(1)
+			continue
+		}
+		certificateLoadFailed.With(s.Name).Set(0)
+		certificateExpiry.With(s.Name).Set(s.NotAfter.Unix())
+	}
+}
+
+// watchCertificates warns, and alerts certificates.webhook, once for every certificate
+// which starts expiring. The expiry of every certificate is exported as a metric
+func watchCertificates(config *Configuration, tracker *certs.Tracker) {
+	notifier := notify.New()
+	conf := notify.Config{Webhook: config.Certificates.Webhook}
+
+	for {
+		exportCertificates(tracker)
+		for _, s := range tracker.Expiring() {
+			log.WithFields(log.Fields{
+				"certificate": s.Name,
+				"domains":     s.Domains,
+				"expires":     s.NotAfter,
+			}).Warn("Certificate is expiring")
+
+			alert := notify.Alert{
+				Text: fmt.Sprintf("certificate %s for %s expires in %d day(s) on %s", s.Name, strings.Join(s.Domains, ", "), s.DaysLeft, s.NotAfter.Format(time.RFC3339)),
+			}
+			if err := notifier.Send(conf, alert); err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Error("Unable to send certificate expiry alert")
+			}
+		}
+		time.Sleep(certificateWatch)
+	}
+}
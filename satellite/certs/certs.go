@@ -0,0 +1,179 @@
+// Package certs tracks the domains and expiry of the certificates satellite serves
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/crypto/tls"
+)
+
+// DefaultWarn is how long before expiry a certificate is reported as expiring
+const DefaultWarn = 14 * 24 * time.Hour
+
+// Source loads the certificate which is currently served
+type Source func() (*x509.Certificate, error)
+
+// FileSource loads the first certificate in a PEM file
+func FileSource(certPath string) Source {
+	return func() (*x509.Certificate, error) {
+		data, err := ioutil.ReadFile(certPath)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				return nil, errors.New("no certificate found in " + certPath)
+			}
+			if block.Type == "CERTIFICATE" {
+				return x509.ParseCertificate(block.Bytes)
+			}
+		}
+	}
+}
+
+// IssuedSource loads the certificate returned by getCertificate, like those issued with ACME
+func IssuedSource(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) Source {
+	return func() (*x509.Certificate, error) {
+		cert, err := getCertificate(nil)
+		if err != nil {
+			return nil, err
+		}
+		if cert.Leaf != nil {
+			return cert.Leaf, nil
+		}
+		if len(cert.Certificate) == 0 {
+			return nil, errors.New("empty certificate chain")
+		}
+		return x509.ParseCertificate(cert.Certificate[0])
+	}
+}
+
+// Status is the state of a served certificate
+type Status struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+	// Wildcard is true when any domain is a wildcard
+	Wildcard  bool      `json:"wildcard"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+	// Expiring is true when the certificate expires within the warning period
+	Expiring bool `json:"expiring"`
+	// Error is why the certificate could not be loaded
+	Error string `json:"error,omitempty"`
+}
+
+// NewStatus describes cert at time now
+func NewStatus(name string, cert *x509.Certificate, warn time.Duration, now time.Time) Status {
+	domains := append([]string{}, cert.DNSNames...)
+	if len(domains) == 0 && cert.Subject.CommonName != "" {
+		domains = append(domains, cert.Subject.CommonName)
+	}
+	sort.Strings(domains)
+
+	wildcard := false
+	for _, d := range domains {
+		if strings.HasPrefix(d, "*.") {
+			wildcard = true
+		}
+	}
+
+	left := cert.NotAfter.Sub(now)
+	return Status{
+		Name:      name,
+		Domains:   domains,
+		Wildcard:  wildcard,
+		Issuer:    cert.Issuer.CommonName,
+		Serial:    cert.SerialNumber.Text(16),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		DaysLeft:  int(left / (24 * time.Hour)),
+		Expiring:  left < warn,
+	}
+}
+
+// Tracker tracks served certificates and which expiring certificates were alerted on
+type Tracker struct {
+	mu      sync.Mutex
+	warn    time.Duration
+	names   []string
+	sources map[string]Source
+	// alerted are the serials of expiring certificates which were already reported
+	alerted map[string]bool
+}
+
+// NewTracker creates a Tracker which reports certificates expiring within warn
+func NewTracker(warn time.Duration) *Tracker {
+	if warn <= 0 {
+		warn = DefaultWarn
+	}
+	return &Tracker{
+		warn:    warn,
+		sources: make(map[string]Source),
+		alerted: make(map[string]bool),
+	}
+}
+
+// Add tracks the certificate loaded by source under name
+func (t *Tracker) Add(name string, source Source) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.sources[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.sources[name] = source
+}
+
+// List gets the status of every tracked certificate, in the order they were added
+func (t *Tracker) List() []Status {
+	t.mu.Lock()
+	names := append([]string{}, t.names...)
+	sources := make([]Source, len(names))
+	for i, name := range names {
+		sources[i] = t.sources[name]
+	}
+	t.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]Status, 0, len(names))
+	for i, name := range names {
+		cert, err := sources[i]()
+		if err != nil {
+			statuses = append(statuses, Status{Name: name, Error: err.Error()})
+			continue
+		}
+		statuses = append(statuses, NewStatus(name, cert, t.warn, now))
+	}
+	return statuses
+}
+
+// Expiring gets the expiring certificates which were not reported before. A renewed
+// certificate has a new serial, so it is reported again when it is expiring
+func (t *Tracker) Expiring() []Status {
+	expiring := make([]Status, 0)
+	for _, s := range t.List() {
+		if !s.Expiring {
+			continue
+		}
+		t.mu.Lock()
+		key := s.Name + "|" + s.Serial
+		if !t.alerted[key] {
+			t.alerted[key] = true
+			expiring = append(expiring, s)
+		}
+		t.mu.Unlock()
+	}
+	return expiring
+}
@@ -0,0 +1,97 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/certs"
+)
+
+func writeCertificate(notAfter time.Time, serial int64, domains ...string) (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := ioutil.TempFile("", "satellitetest")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return f.Name(), pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestTracker_List(t *testing.T) {
+	name, err := writeCertificate(time.Now().Add(90*24*time.Hour), 1, "example.com", "*.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+
+	tracker := NewTracker(DefaultWarn)
+	tracker.Add("ssl", FileSource(name))
+	tracker.Add("missing", FileSource(name+".missing"))
+
+	statuses := tracker.List()
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 certificates, got %d", len(statuses))
+	}
+	s := statuses[0]
+	if len(s.Domains) != 2 || !s.Wildcard {
+		t.Errorf("unexpected domains %v", s.Domains)
+	}
+	if s.Expiring || s.DaysLeft != 89 {
+		t.Errorf("unexpected expiry of %d days", s.DaysLeft)
+	}
+	if statuses[1].Error == "" {
+		t.Error("missing certificate was loaded")
+	}
+}
+
+func TestTracker_Expiring(t *testing.T) {
+	name, err := writeCertificate(time.Now().Add(24*time.Hour), 1, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+
+	tracker := NewTracker(DefaultWarn)
+	tracker.Add("ssl", FileSource(name))
+
+	if expiring := tracker.Expiring(); len(expiring) != 1 {
+		t.Fatalf("expected 1 expiring certificate, got %d", len(expiring))
+	}
+	if expiring := tracker.Expiring(); len(expiring) != 0 {
+		t.Error("expiring certificate was reported twice")
+	}
+
+	renewed, err := writeCertificate(time.Now().Add(24*time.Hour), 2, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(renewed)
+	tracker.Add("ssl", FileSource(renewed))
+	if expiring := tracker.Expiring(); len(expiring) != 1 {
+		t.Error("new expiring certificate was not reported")
+	}
+}
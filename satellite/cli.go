@@ -0,0 +1,706 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/blocklist"
+	"github.com/t94j0/satellite/satellite/bundle"
+	"github.com/t94j0/satellite/satellite/certs"
+	"github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/malleable"
+	"github.com/t94j0/satellite/satellite/management"
+	sPath "github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/replay"
+	"github.com/t94j0/satellite/satellite/retention"
+	"github.com/t94j0/satellite/satellite/scope"
+	"github.com/t94j0/satellite/satellite/upgrade"
+)
+
+// ErrUnknownCommand is given when a subcommand does not exist
+var ErrUnknownCommand = errors.New("unknown command")
+
+// managementClient creates a client for the management API of the configured instance
+func managementClient(config *Configuration) (*management.Client, error) {
+	listen := config.Management.Listen
+	if listen == "" {
+		return nil, errors.New("management.listen is not configured")
+	}
+	if strings.HasPrefix(listen, ":") {
+		listen = "127.0.0.1" + listen
+	}
+	return management.NewClient(listen, config.Management.Token), nil
+}
+
+// runCommand runs a satellite subcommand
+func runCommand(config *Configuration, args []string) error {
+	switch args[0] {
+	case "maintenance":
+		return maintenanceCommand(config, args[1:])
+	case "upgrade":
+		return upgradeCommand(config, args[1:])
+	case "scope":
+		return scopeCommand(config, args[1:])
+	case "replay":
+		return replayCommand(config, args[1:])
+	case "certificates":
+		return certificatesCommand(config)
+	case "reload":
+		return reloadCommand(config, args[1:])
+	case "unban":
+		return unbanCommand(config, args[1:])
+	case "retention":
+		return retentionCommand(args[1:])
+	case "describe-conditions":
+		return describeConditionsCommand(args[1:])
+	case "schema":
+		return schemaCommand(args[1:])
+	case "lure-variants":
+		return lureVariantsCommand(args[1:])
+	case "archive":
+		return archiveCommand(config, args[1:])
+	case "malleable":
+		return malleableCommand(args[1:])
+	case "version":
+		fmt.Println(Version)
+		return nil
+	}
+	return errors.Wrap(ErrUnknownCommand, args[0])
+}
+
+// maintenanceCommand turns maintenance on or off, schedules a window, or gives the status
+//
+// Usage: satellite maintenance [on|off|status|schedule <start>/<end>]
+func maintenanceCommand(config *Configuration, args []string) error {
+	client, err := managementClient(config)
+	if err != nil {
+		return err
+	}
+
+	var update management.MaintenanceStatus
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "on", "off":
+		enabled := action == "on"
+		update.Enabled = &enabled
+	case "schedule":
+		if len(args) != 2 {
+			return errors.New("usage: satellite maintenance schedule <start>/<end>")
+		}
+		update.Window = args[1]
+	case "status":
+	default:
+		return errors.New("usage: satellite maintenance [on|off|status|schedule <start>/<end>]")
+	}
+
+	var status management.MaintenanceStatus
+	if action == "status" {
+		err = client.Do("GET", "/maintenance", nil, &status)
+	} else {
+		err = client.Do("POST", "/maintenance", update, &status)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("maintenance active: %t\n", status.Active)
+	for _, w := range status.Schedule {
+		fmt.Printf("scheduled: %s\n", w)
+	}
+	return nil
+}
+
+// certificatesCommand lists the domains and expiry of the certificates served by the running instance
+//
+// Usage: satellite certificates
+func certificatesCommand(config *Configuration) error {
+	client, err := managementClient(config)
+	if err != nil {
+		return err
+	}
+
+	var statuses []certs.Status
+	if err := client.Do("GET", "/certificates", nil, &statuses); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDOMAINS\tEXPIRES\tDAYS LEFT\tSTATUS")
+	for _, s := range statuses {
+		status := "ok"
+		if s.Error != "" {
+			status = s.Error
+		} else if s.Expiring {
+			status = "expiring"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", s.Name, strings.Join(s.Domains, ","), s.NotAfter.Format(time.RFC3339), s.DaysLeft, status)
+	}
+	return w.Flush()
+}
+
+// reloadCommand reloads one path of the running instance from the path list, or only validates it
+//
+// Usage: satellite reload [-validate] <path>
+func reloadCommand(config *Configuration, args []string) error {
+	flags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	validate := flags.Bool("validate", false, "only validate the path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: satellite reload [-validate] <path>")
+	}
+
+	client, err := managementClient(config)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"path": {flags.Arg(0)}}
+	if *validate {
+		query.Set("validate", "true")
+	}
+	var result management.ReloadResult
+	if err := client.Do("POST", "/paths/reload?"+query.Encode(), nil, &result); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s\n", result.Path, result.Status)
+	return nil
+}
+
+// unbanCommand removes an IP from the global blacklist of the running instance and
+// stops dropping its packets
+//
+// Usage: satellite unban <ip>
+func unbanCommand(config *Configuration, args []string) error {
+	if len(args) != 1 || net.ParseIP(args[0]) == nil {
+		return errors.New("usage: satellite unban <ip>")
+	}
+
+	client, err := managementClient(config)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"ip": {args[0]}}
+	if err := client.Do("DELETE", "/blacklist?"+query.Encode(), nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("%s: unbanned\n", args[0])
+	return nil
+}
+
+// archivePassphraseEnv is the environment variable holding the passphrase archives are encrypted with
+const archivePassphraseEnv = "SATELLITE_ARCHIVE_PASSPHRASE"
+
+// archiveCommand writes the paths, hosted files, decisions, totals, and state of a
+// campaign to a bundle encrypted with the passphrase in SATELLITE_ARCHIVE_PASSPHRASE.
+// With -wipe the running instance archives and removes the campaign in one step, so
+// no decision is lost in between. With -open a bundle is decrypted to its gzipped tar
+//
+// Usage: satellite archive [-wipe] [-o <file>] <campaign>, or satellite archive -open [-o <file>] <bundle>
+func archiveCommand(config *Configuration, args []string) error {
+	flags := flag.NewFlagSet("archive", flag.ContinueOnError)
+	wipe := flags.Bool("wipe", false, "remove the campaign from the server once it is archived")
+	open := flags.Bool("open", false, "decrypt a bundle")
+	output := flags.String("o", "", "file to write to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: satellite archive [-wipe | -open] [-o <file>] <campaign | bundle>")
+	}
+	passphrase := os.Getenv(archivePassphraseEnv)
+	if passphrase == "" {
+		return errors.New(archivePassphraseEnv + " is not set")
+	}
+
+	if *open {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err := bundle.Open(f, passphrase)
+		if err != nil {
+			return err
+		}
+		if *output == "" {
+			*output = strings.TrimSuffix(flags.Arg(0), filepath.Ext(flags.Arg(0))) + ".tar.gz"
+		}
+		if err := ioutil.WriteFile(*output, data, 0600); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", *output)
+		return nil
+	}
+
+	campaign := flags.Arg(0)
+	client, err := managementClient(config)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"campaign": {campaign}}.Encode()
+	method := "GET"
+	if *wipe {
+		method = "POST"
+	}
+	archive, err := client.Download(method, "/campaigns/archive?"+query)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = fmt.Sprintf("%s-%s.bundle", campaign, time.Now().UTC().Format("20060102"))
+	}
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Seal(f, passphrase, archive); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", *output)
+	if *wipe {
+		fmt.Printf("wiped %s\n", campaign)
+	}
+	return nil
+}
+
+// upgradeCommand checks for a newer release, or installs it and restarts the running instance
+//
+// Usage: satellite upgrade [check]
+func upgradeCommand(config *Configuration, args []string) error {
+	if config.Upgrade.URL == "" {
+		return errors.New("upgrade.url is not configured")
+	}
+	key, err := upgrade.ParsePublicKey(config.Upgrade.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "upgrade.public_key")
+	}
+
+	release, err := upgrade.Latest(config.Upgrade.URL, key)
+	if err != nil {
+		return err
+	}
+
+	newer := upgrade.Newer(Version, release.Version)
+	if len(args) > 0 && args[0] == "check" {
+		if newer {
+			fmt.Printf("%s is available (running %s)\n", release.Version, Version)
+		} else {
+			fmt.Printf("%s is up to date\n", Version)
+		}
+		return nil
+	} else if len(args) > 0 {
+		return errors.New("usage: satellite upgrade [check]")
+	}
+
+	if !newer {
+		fmt.Printf("%s is up to date\n", Version)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return err
+	}
+	if err := upgrade.Apply(release, executable); err != nil {
+		return err
+	}
+	fmt.Printf("upgraded %s to %s\n", Version, release.Version)
+
+	client, err := managementClient(config)
+	if err != nil {
+		fmt.Println("restart satellite to run the new version")
+		return nil
+	}
+	if err := client.Do("POST", "/restart", nil, nil); err != nil {
+		return errors.Wrap(err, "unable to restart satellite")
+	}
+	fmt.Println("restarting satellite")
+	return nil
+}
+
+// replayCommand replays captured traffic through the scope, paths, and conditions
+// of the server root, configured like the running instance, and reports each
+// decision. State is not shared with the running instance
+//
+// Usage: satellite replay [-ip <addr>] <capture.pcap|capture.har>
+func replayCommand(config *Configuration, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	ip := flags.String("ip", "127.0.0.1", "client address of HAR requests")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: satellite replay [-ip <addr>] <capture.pcap|capture.har>")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []replay.Entry
+	if strings.HasSuffix(strings.ToLower(flags.Arg(0)), ".har") {
+		entries, err = replay.ReadHAR(f, net.JoinHostPort(*ip, "0"))
+	} else {
+		var encrypted int
+		entries, encrypted, err = replay.ReadPcap(f)
+		if encrypted > 0 {
+			fmt.Printf("%d TLS connection(s) cannot be decrypted and are only checked against scope\n", encrypted)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	gcp := path.Join(path.Dir(config.ConfigFileUsed()), "conditions")
+	paths, done, err := replay.NewPaths(config.ServerRoot, gcp)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := configureReplay(config, paths); err != nil {
+		return err
+	}
+	scope, err := handlers.NewScope(config.Scope.Ranges, config.Scope.Countries)
+	if err != nil {
+		return errors.Wrap(err, "scope configuration error")
+	}
+
+	results := replay.Run(paths, entries, scope)
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCLIENT\tMETHOD\tURI\tPATH\tDECISION")
+	for _, r := range results {
+		decision := r.Decision
+		if r.Error != nil {
+			decision += ": " + r.Error.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Format(time.RFC3339), r.RemoteAddr, r.Method, r.URI, r.Path, decision)
+		counts[r.Decision]++
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d request(s): %d served, %d denied, %d rate limited, %d out of scope, %d encrypted, %d not found, %d error(s)\n",
+		len(results), counts[replay.DecisionServed], counts[replay.DecisionDenied], counts[replay.DecisionRateLimited],
+		counts[replay.DecisionOutOfScope], counts[replay.DecisionEncrypted], counts[replay.DecisionNotFound], counts[replay.DecisionError])
+	return nil
+}
+
+// configureReplay applies the global conditions, campaigns, GeoIP databases, and
+// blocklists of the running instance to paths. Feeds are fetched once
+func configureReplay(config *Configuration, paths *sPath.Paths) error {
+	all := pathSet{paths}
+
+	global, err := config.Conditions()
+	if err != nil {
+		return errors.Wrap(err, "global_conditions configuration error")
+	}
+	all.SetGlobalConditions(global)
+	campaigns, err := sPath.NewCampaigns(config.Campaigns)
+	if err != nil {
+		return errors.Wrap(err, "campaigns configuration error")
+	}
+	all.SetCampaigns(campaigns)
+
+	if err := all.AddGeoIP(config.GeoIPPath); err != nil {
+		log.Warn("Unable to access geoip_path. Geo to IP functionality disabled.")
+	}
+	all.SetCountryGroups(config.CountryGroups)
+	if config.ASNPath != "" {
+		if err := all.AddASN(config.ASNPath); err != nil {
+			log.Warn("Unable to access asn_path. ASN functionality disabled.")
+		}
+	}
+
+	fetcher := blocklist.NewFetcher()
+	fetchBlocklists(fetcher, config, all)
+	if !config.HostingProviders.Disabled {
+		fetchHostingProviders(fetcher, all)
+	}
+	if !config.Tor.Disabled {
+		if ips, err := fetcher.FetchTorExits(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Unable to fetch Tor exit nodes")
+		} else if err := all.SetTorExits(ips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retentionCommand generates the key pair purge receipts are signed with, or
+// verifies purge receipts against the public key
+//
+// Usage: satellite retention [keygen|verify -key <public key> <receipt>...]
+func retentionCommand(args []string) error {
+	usage := errors.New("usage: satellite retention [keygen|verify -key <public key> <receipt>...]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "keygen":
+		public, private, err := retention.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("signing_key: %s\npublic key: %s\n", private, public)
+		return nil
+	case "verify":
+		flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+		publicKey := flags.String("key", "", "base64 encoded ed25519 public key")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 || *publicKey == "" {
+			return usage
+		}
+		key, err := retention.ParsePublicKey(*publicKey)
+		if err != nil {
+			return err
+		}
+
+		var bad int
+		for _, file := range flags.Args() {
+			receipt, err := retention.Read(file)
+			if err == nil {
+				err = receipt.Verify(key)
+			}
+			if err != nil {
+				fmt.Printf("%s: %s\n", file, err)
+				bad++
+				continue
+			}
+			fmt.Printf("%s: purged %v collected before %s\n", file, receipt.Purged, receipt.Cutoff.Format(time.RFC3339))
+		}
+		if bad > 0 {
+			return fmt.Errorf("%d receipt(s) could not be verified", bad)
+		}
+		return nil
+	}
+	return usage
+}
+
+// describeConditionsCommand prints the reference of every condition, or the
+// JSON schema of conditions used for editor autocompletion of .info files
+//
+// Usage: satellite describe-conditions [-json]
+func describeConditionsCommand(args []string) error {
+	flags := flag.NewFlagSet("describe-conditions", flag.ContinueOnError)
+	schema := flags.Bool("json", false, "print the JSON schema")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *schema {
+		out, err := json.MarshalIndent(sPath.ConditionsSchema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	printConditions(sPath.DescribeConditions(), "")
+	return nil
+}
+
+// schemaCommand writes the JSON schema of .info files, or of pathList.yml with
+// -paths, so editors using yaml-language-server validate and complete path rules
+//
+// Usage: satellite schema [-paths] [-o <file>]
+func schemaCommand(args []string) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	paths := flags.Bool("paths", false, "write the schema of pathList.yml instead of .info files")
+	output := flags.String("o", "", "file to write the schema to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	schema, pattern := sPath.ConditionsSchema(), "*.info"
+	if *paths {
+		schema, pattern = sPath.PathListSchema(), "pathList.yml"
+	}
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Println(string(out))
+		return nil
+	}
+	if err := ioutil.WriteFile(*output, append(out, '\n'), 0644); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(*output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s. Add it to the VS Code settings of the server root:\n\n", *output)
+	fmt.Printf("  \"files.associations\": {\"*.info\": \"yaml\"},\n")
+	fmt.Printf("  \"yaml.schemas\": {%q: %q}\n", abs, pattern)
+	return nil
+}
+
+// lureVariantsCommand prints obfuscated variants of a lure URL which are routed to
+// the same path, for testing which get past email filters
+//
+// Usage: satellite lure-variants [-cover <host>] <url>
+func lureVariantsCommand(args []string) error {
+	flags := flag.NewFlagSet("lure-variants", flag.ContinueOnError)
+	cover := flags.String("cover", "", "host put in the userinfo of the URL")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: satellite lure-variants [-cover <host>] <url>")
+	}
+
+	variants, err := sPath.URLVariants(flags.Arg(0), *cover)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tURL")
+	for _, v := range variants {
+		fmt.Fprintf(w, "%s\t%s\n", v.Kind, v.URL)
+	}
+	return w.Flush()
+}
+
+// malleableCommand generates pathList.yml rules from a Malleable C2 profile, proxying
+// every URI of the profile to the team server for clients sending its user agent,
+// verbs, and headers
+//
+// Usage: satellite malleable -teamserver <url> [-redirect <url>] [-o <file>] <profile>
+func malleableCommand(args []string) error {
+	flags := flag.NewFlagSet("malleable", flag.ContinueOnError)
+	teamServer := flags.String("teamserver", "", "URL of the team server listener, like https://10.0.0.5:443")
+	redirect := flags.String("redirect", "", "URL clients which are not beacons are redirected to")
+	output := flags.String("o", "", "file to write the rules to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *teamServer == "" {
+		return errors.New("usage: satellite malleable -teamserver <url> [-redirect <url>] [-o <file>] <profile>")
+	}
+	if u, err := url.ParseRequestURI(*teamServer); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New(fmt.Sprintf("%s is not a valid team server URL", *teamServer))
+	}
+
+	data, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	profile, err := malleable.NewProfile(data)
+	if err != nil {
+		return errors.Wrap(err, flags.Arg(0))
+	}
+	rules, err := profile.PathList(*teamServer, *redirect)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Print(string(rules))
+		return nil
+	}
+	if err := ioutil.WriteFile(*output, rules, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s. Merge it into the pathList.yml of the server root\n", *output)
+	return nil
+}
+
+// printConditions prints the name, type, and description of conditions nested under prefix
+func printConditions(fields []sPath.ConditionField, prefix string) {
+	for _, f := range fields {
+		typ := f.Type
+		if f.Items != "" {
+			typ += " of " + f.Items
+		}
+		fmt.Printf("%s%s (%s)\n    %s\n", prefix, f.Name, typ, f.Description)
+		printConditions(f.Fields, prefix+f.Name+".")
+	}
+}
+
+// scopeCommand imports scoping files into a named rule set in the global
+// conditions directory, so authorized_iprange limits every path to the scope
+//
+// Usage: satellite scope import [-name <rule set>] <file>...
+func scopeCommand(config *Configuration, args []string) error {
+	usage := errors.New("usage: satellite scope import [-name <rule set>] <file>...")
+	if len(args) == 0 || args[0] != "import" {
+		return usage
+	}
+
+	flags := flag.NewFlagSet("scope", flag.ContinueOnError)
+	name := flags.String("name", "scope", "name of the rule set")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 || strings.ContainsAny(*name, "/\\") {
+		return usage
+	}
+
+	ranges := make([]string, 0)
+	for _, file := range flags.Args() {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fileRanges, skipped, err := scope.Import(data)
+		if err != nil {
+			return errors.Wrap(err, file)
+		}
+		for _, s := range skipped {
+			fmt.Printf("skipped %s: not an IP or range\n", s)
+		}
+		ranges = append(ranges, fileRanges...)
+	}
+	if len(ranges) == 0 {
+		return errors.New("no IP ranges found")
+	}
+
+	gcp := path.Join(path.Dir(config.ConfigFileUsed()), "conditions")
+	if err := os.MkdirAll(gcp, 0755); err != nil {
+		return err
+	}
+	target := path.Join(gcp, *name+".yml")
+	if err := scope.WriteRuleSet(target, ranges); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d range(s) to %s\n", len(ranges), target)
+	return nil
+}
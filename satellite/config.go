@@ -1,25 +1,494 @@
 package main
 
 import (
-	"errors"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"github.com/t94j0/satellite/satellite/acme"
+	"github.com/t94j0/satellite/satellite/assets"
+	"github.com/t94j0/satellite/satellite/blocklist"
+	"github.com/t94j0/satellite/satellite/decoy"
+	"github.com/t94j0/satellite/satellite/drop"
+	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/logfile"
+	"github.com/t94j0/satellite/satellite/management"
+	sPath "github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/retention"
+	"gopkg.in/yaml.v2"
 )
 
 // ErrNoConfigFound is given when no configuration file is found
 var ErrNoConfigFound = errors.New("Config file not found. Read the README to learn how to configure the satellite service")
 
-// Config sets the config
-func Config() (*viper.Viper, error) {
-	config := viper.New()
+// Configuration is the satellite configuration file
+type Configuration struct {
+	ServerRoot   string `mapstructure:"server_root"`
+	Listen       string `mapstructure:"listen"`
+	Index        string `mapstructure:"index"`
+	LogLevel     string `mapstructure:"log_level"`
+	ServerHeader string `mapstructure:"server_header"`
+	GeoIPPath    string `mapstructure:"geoip_path"`
+	ASNPath      string `mapstructure:"asn_path"`
+	RedirectHTTP bool   `mapstructure:"redirect_http"`
+	HTTP2        bool   `mapstructure:"http2"`
+	SSL          struct {
+		Key  string `mapstructure:"key"`
+		Cert string `mapstructure:"cert"`
+	} `mapstructure:"ssl"`
+	// ClientCerts asks HTTPS clients for a certificate so paths can be gated with
+	// require_client_cert, authorized_client_cert_cn, and authorized_client_cert_fingerprints
+	ClientCerts struct {
+		Request bool `mapstructure:"request"`
+		// CA is a PEM bundle of the CAs client certificates must be signed by. Without it,
+		// certificates are only checked by the path conditions
+		CA string `mapstructure:"ca"`
+	} `mapstructure:"client_certs"`
+	// ACME issues the certificate with DNS-01 challenges instead of using ssl.key and ssl.cert
+	ACME     acme.Config `mapstructure:"acme"`
+	NotFound struct {
+		Redirect string `mapstructure:"redirect"`
+		Render   string `mapstructure:"render"`
+	} `mapstructure:"not_found"`
+	ServerError struct {
+		Render string `mapstructure:"render"`
+	} `mapstructure:"server_error"`
+	// Persona is the built in web server, like nginx, apache, or iis, whose
+	// error pages are served when no not_found, maintenance, or server_error page is rendered
+	Persona    string `mapstructure:"persona"`
+	Management struct {
+		Listen string `mapstructure:"listen"`
+		Token  string `mapstructure:"token"`
+		// URL is the externally reachable URL used in approval notification links
+		URL string `mapstructure:"url"`
+		// OIDC logs operators in with the identity provider of the organization
+		OIDC management.OIDC `mapstructure:"oidc"`
+	} `mapstructure:"management"`
+	Maintenance struct {
+		Enabled    bool     `mapstructure:"enabled"`
+		Status     int      `mapstructure:"status"`
+		Render     string   `mapstructure:"render"`
+		RetryAfter string   `mapstructure:"retry_after"`
+		Schedule   []string `mapstructure:"schedule"`
+	} `mapstructure:"maintenance"`
+	Scrub struct {
+		Disabled bool     `mapstructure:"disabled"`
+		Strings  []string `mapstructure:"strings"`
+	} `mapstructure:"scrub"`
+	Upgrade struct {
+		// URL is the release endpoint describing the latest release
+		URL string `mapstructure:"url"`
+		// PublicKey is the base64 encoded ed25519 key releases are signed with
+		PublicKey string `mapstructure:"public_key"`
+	} `mapstructure:"upgrade"`
+	// Scope is enforced before any path conditions
+	Scope struct {
+		Ranges    []string `mapstructure:"ranges"`
+		Countries []string `mapstructure:"countries"`
+	} `mapstructure:"scope"`
+	// GeoIP downloads geoip_path and asn_path from MaxMind and keeps them up to date
+	GeoIP struct {
+		AccountID  string `mapstructure:"account_id"`
+		LicenseKey string `mapstructure:"license_key"`
+		// Edition is the database downloaded to geoip_path. Defaults to GeoLite2-Country
+		Edition string `mapstructure:"edition"`
+		// Refresh is how often the databases are downloaded. Defaults to 24h
+		Refresh string `mapstructure:"refresh"`
+	} `mapstructure:"geoip"`
+	// Blocklists are remote IP feeds denied on every path before path conditions
+	Blocklists struct {
+		// Refresh is how often the feeds are fetched. Defaults to 1h
+		Refresh string           `mapstructure:"refresh"`
+		Feeds   []blocklist.Feed `mapstructure:"feeds"`
+	} `mapstructure:"blocklists"`
+	// HostingProviders are the published IP ranges used by blacklist_hosting_providers
+	HostingProviders struct {
+		Disabled bool `mapstructure:"disabled"`
+		// Refresh is how often the ranges are fetched. Defaults to 24h
+		Refresh string `mapstructure:"refresh"`
+	} `mapstructure:"hosting_providers"`
+	// Tor is the Tor exit node list used by blacklist_tor
+	Tor struct {
+		Disabled bool `mapstructure:"disabled"`
+		// Refresh is how often the list is fetched. Defaults to 1h
+		Refresh string `mapstructure:"refresh"`
+	} `mapstructure:"tor"`
+	// DecoyVariation comments not_found and maintenance responses randomly so
+	// their content hash differs between responses
+	DecoyVariation struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Comments are used as the comment text. Defaults to random tokens
+		Comments []string `mapstructure:"comments"`
+	} `mapstructure:"decoy_variation"`
+	// FormAck answers POSTs which no path serves with a thank you page, so forms on
+	// decoy pages appear to work
+	FormAck struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Render is the path rendered as the thank you page. Defaults to the page of the persona
+		Render string `mapstructure:"render"`
+		// Store is the file submissions are appended to as lines of JSON. Without it they are discarded
+		Store string `mapstructure:"store"`
+		// MaxBody is the most bytes of a submission which are stored. Defaults to 65536
+		MaxBody int64 `mapstructure:"max_body"`
+	} `mapstructure:"form_ack"`
+	// SelfTest checks exec scripts, GeoIP DBs, webhooks, and the state DB on startup
+	SelfTest struct {
+		Disabled bool `mapstructure:"disabled"`
+		// Strict refuses to start when a critical check fails
+		Strict bool `mapstructure:"strict"`
+	} `mapstructure:"self_test"`
+	// State alerts when the state DB of any paths becomes unavailable and when it recovers
+	State struct {
+		// Webhook receives the alerts
+		Webhook string `mapstructure:"webhook"`
+	} `mapstructure:"state"`
+	// Log writes the log and a journal of every decision to files which are rotated
+	Log struct {
+		// File is where the log is written instead of stderr
+		File string `mapstructure:"file"`
+		// Journal is where every decision is written as a line of JSON
+		Journal string `mapstructure:"journal"`
+		// Rotate is how both files are rotated
+		Rotate logfile.Config `mapstructure:"rotate"`
+	} `mapstructure:"log"`
+	// DecoyRefresh fetches cloned decoy files from the imitated site again so they do not go stale
+	DecoyRefresh []decoy.Source `mapstructure:"decoy_refresh"`
+	// Retention purges collected data older than days and signs a receipt of each purge
+	Retention struct {
+		// Days is how long hits, captures, and client state are kept. 0 keeps them forever
+		Days int `mapstructure:"days"`
+		// Campaigns are how many days the hits, captures, and approvals of each campaign's paths are kept instead of days
+		Campaigns map[string]int `mapstructure:"campaigns"`
+		// Interval is how often old data is purged. Defaults to 1h
+		Interval string `mapstructure:"interval"`
+		// Receipts is the directory signed purge receipts are written to
+		Receipts string `mapstructure:"receipts"`
+		// SigningKey is the base64 encoded ed25519 private key receipts are signed with
+		SigningKey string `mapstructure:"signing_key"`
+	} `mapstructure:"retention"`
+	// Campaigns are the daily quotas of the paths sharing a campaign name
+	Campaigns map[string]sPath.QuotaConfig `mapstructure:"campaigns"`
+	// Forward sends copies of requests denied on paths setting forward_denied to an analysis service
+	Forward sPath.ForwardConfig `mapstructure:"forward"`
+	// Drop drops the packets of IPs on the global blacklist in the kernel
+	Drop drop.Config `mapstructure:"drop"`
+	// Certificates alerts before the served certificate expires
+	Certificates struct {
+		// Warn is how long before expiry a certificate is reported as expiring. Defaults to 336h
+		Warn string `mapstructure:"warn"`
+		// Webhook receives an alert when a certificate starts expiring
+		Webhook string `mapstructure:"webhook"`
+	} `mapstructure:"certificates"`
+	// GlobalConditions are conditions, like an engagement-wide blacklist, merged beneath
+	// the conditions of every path which does not set ignore_global
+	GlobalConditions map[string]interface{} `mapstructure:"global_conditions"`
+	// ResponseHeaders are sent with every served path, beneath the response_headers of the path
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+	// CountryGroups are named groups of ISO country codes used in conditions like
+	// authorized_countries: [group:offices], next to the built-in EU, EEA, and FVEY
+	CountryGroups map[string][]string `mapstructure:"country_groups"`
+	// VirtualHosts serve other domains from their own server root
+	VirtualHosts []VirtualHostConfig `mapstructure:"virtual_hosts"`
+	AllowedHosts []string            `mapstructure:"allowed_hosts"`
+	UnknownHost  string              `mapstructure:"unknown_host"`
 
-	config.SetDefault("server_root", "/var/www/html")
-	config.SetDefault("listen", "127.0.0.1:8080")
+	// file is the configuration file which was read
+	file string
+}
+
+// VirtualHostConfig serves hosts from a server root with its own paths and not_found handler
+type VirtualHostConfig struct {
+	// Hosts are globs of the Host header, like *.example.com
+	Hosts      []string `mapstructure:"hosts"`
+	ServerRoot string   `mapstructure:"server_root"`
+	Index      string   `mapstructure:"index"`
+	NotFound   struct {
+		Redirect string `mapstructure:"redirect"`
+		Render   string `mapstructure:"render"`
+	} `mapstructure:"not_found"`
+}
+
+// logLevels are the valid log_level values
+var logLevels = map[string]log.Level{
+	"":      log.DebugLevel,
+	"panic": log.PanicLevel,
+	"fatal": log.FatalLevel,
+	"error": log.ErrorLevel,
+	"warn":  log.WarnLevel,
+	"info":  log.InfoLevel,
+	"debug": log.DebugLevel,
+	"trace": log.TraceLevel,
+}
+
+// Conditions parses global_conditions
+func (c *Configuration) Conditions() (sPath.RequestConditions, error) {
+	if len(c.GlobalConditions) == 0 {
+		return sPath.RequestConditions{}, nil
+	}
+	// Each condition is checked on its own so errors name it
+	keys := make([]string, 0, len(c.GlobalConditions))
+	for key := range c.GlobalConditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		data, err := yaml.Marshal(map[string]interface{}{key: c.GlobalConditions[key]})
+		if err != nil {
+			return sPath.RequestConditions{}, errors.Wrap(err, key)
+		}
+		var condition sPath.RequestConditions
+		if err := yaml.UnmarshalStrict(data, &condition); err != nil {
+			err = conditionError(err)
+			if err.Error() != "unknown condition "+key {
+				err = fmt.Errorf("%s: %s", key, err)
+			}
+			return sPath.RequestConditions{}, err
+		}
+	}
+
+	data, err := yaml.Marshal(c.GlobalConditions)
+	if err != nil {
+		return sPath.RequestConditions{}, err
+	}
+	var conditions sPath.RequestConditions
+	if err := yaml.UnmarshalStrict(data, &conditions); err != nil {
+		return conditions, conditionError(err)
+	}
+	return conditions, conditions.Validate()
+}
+
+// yamlFieldError is how yaml reports keys which are not fields of the type
+var yamlFieldError = regexp.MustCompile(`field (\S+) not found in type \S+`)
+
+// conditionError removes the line numbers of the re-encoded global conditions
+// from yaml errors, which do not match the configuration file, and names unknown
+// conditions
+func conditionError(err error) error {
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	msgs := make([]string, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		if i := strings.Index(msg, ": "); strings.HasPrefix(msg, "line ") && i != -1 {
+			msg = msg[i+2:]
+		}
+		msgs = append(msgs, yamlFieldError.ReplaceAllString(msg, "unknown condition $1"))
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// ConfigFileUsed gets the path of the configuration file
+func (c *Configuration) ConfigFileUsed() string {
+	return c.file
+}
+
+// clientCAs loads the CAs client certificates must be signed by, which is nil when any are accepted
+func (c *Configuration) clientCAs() (*x509.CertPool, error) {
+	if c.ClientCerts.CA == "" {
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(c.ClientCerts.CA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return pool, nil
+}
+
+// Validate checks values which are the right type but not usable
+func (c *Configuration) Validate() error {
+	if c.Listen == "" {
+		return errors.New("listen: expected an address, got an empty string")
+	}
+
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return fmt.Errorf("log_level: expected one of panic, fatal, error, warn, info, debug, or trace, got %q", c.LogLevel)
+	}
+
+	if (c.SSL.Key == "") != (c.SSL.Cert == "") {
+		return errors.New("ssl: expected both key and cert to be set")
+	}
+
+	if c.ACME.Enabled() {
+		if c.SSL.Key != "" {
+			return errors.New("acme: expected ssl.key and ssl.cert not to be set")
+		}
+		if err := c.ACME.Validate(); err != nil {
+			return fmt.Errorf("acme: %s", err)
+		}
+	}
+
+	if c.ClientCerts.CA != "" {
+		if !c.ClientCerts.Request {
+			return errors.New("client_certs: expected request to be set with ca")
+		}
+		if _, err := c.clientCAs(); err != nil {
+			return fmt.Errorf("client_certs.ca: %s", err)
+		}
+	}
+
+	if c.Maintenance.Status != 0 && (c.Maintenance.Status < 100 || c.Maintenance.Status > 599) {
+		return fmt.Errorf("maintenance.status: expected an HTTP status code, got %d", c.Maintenance.Status)
+	}
+
+	if c.Persona != "" {
+		if _, err := assets.NewPersona(c.Persona); err != nil {
+			return fmt.Errorf("persona: expected one of %s, got %q", strings.Join(assets.Personas(), ", "), c.Persona)
+		}
+	}
+
+	if c.GeoIP.LicenseKey != "" {
+		if c.GeoIP.AccountID == "" {
+			return errors.New("geoip.account_id: expected to be set with geoip.license_key")
+		}
+		if c.GeoIPPath == "" {
+			return errors.New("geoip.license_key: expected geoip_path to be set")
+		}
+		if c.GeoIP.Refresh != "" {
+			if refresh, err := time.ParseDuration(c.GeoIP.Refresh); err != nil || refresh < time.Hour {
+				return fmt.Errorf("geoip.refresh: expected a duration of at least 1h, got %q", c.GeoIP.Refresh)
+			}
+		}
+	}
+
+	for i, feed := range c.Blocklists.Feeds {
+		if err := feed.Validate(); err != nil {
+			return fmt.Errorf("blocklists.feeds[%d]: %s", i, err)
+		}
+	}
+	if c.Blocklists.Refresh != "" {
+		if refresh, err := time.ParseDuration(c.Blocklists.Refresh); err != nil || refresh < time.Minute {
+			return fmt.Errorf("blocklists.refresh: expected a duration of at least 1m, got %q", c.Blocklists.Refresh)
+		}
+	}
+
+	if c.HostingProviders.Refresh != "" {
+		if refresh, err := time.ParseDuration(c.HostingProviders.Refresh); err != nil || refresh < time.Hour {
+			return fmt.Errorf("hosting_providers.refresh: expected a duration of at least 1h, got %q", c.HostingProviders.Refresh)
+		}
+	}
+
+	if c.Tor.Refresh != "" {
+		if refresh, err := time.ParseDuration(c.Tor.Refresh); err != nil || refresh < time.Minute {
+			return fmt.Errorf("tor.refresh: expected a duration of at least 1m, got %q", c.Tor.Refresh)
+		}
+	}
+
+	if err := c.Log.Rotate.Validate(); err != nil {
+		return fmt.Errorf("log.rotate.%s", err)
+	}
+
+	if c.Retention.Days < 0 {
+		return fmt.Errorf("retention.days: expected a positive number, got %d", c.Retention.Days)
+	}
+	for campaign, days := range c.Retention.Campaigns {
+		if days < 1 {
+			return fmt.Errorf("retention.campaigns.%s: expected a positive number, got %d", campaign, days)
+		}
+	}
+	if c.Retention.Interval != "" {
+		if interval, err := time.ParseDuration(c.Retention.Interval); err != nil || interval < time.Minute {
+			return fmt.Errorf("retention.interval: expected a duration of at least 1m, got %q", c.Retention.Interval)
+		}
+	}
+	if c.Retention.Receipts != "" {
+		if _, err := retention.ParsePrivateKey(c.Retention.SigningKey); err != nil {
+			return errors.New("retention.signing_key: expected a base64 encoded ed25519 private key")
+		}
+	}
+
+	if _, err := c.Conditions(); err != nil {
+		return fmt.Errorf("global_conditions: %s", err)
+	}
+
+	if c.Forward.Enabled() {
+		if err := c.Forward.Validate(); err != nil {
+			return fmt.Errorf("forward: %s", err)
+		}
+	}
+
+	for name, q := range c.Campaigns {
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("campaigns.%s: %s", name, err)
+		}
+	}
+
+	for i, source := range c.DecoyRefresh {
+		if err := source.Validate(); err != nil {
+			return fmt.Errorf("decoy_refresh[%d]: %s", i, err)
+		}
+	}
 
+	if c.Management.OIDC.Enabled() {
+		if err := c.Management.OIDC.Validate(); err != nil {
+			return fmt.Errorf("management.oidc.%s", err)
+		}
+	}
+
+	if c.Drop.Enabled() {
+		if err := c.Drop.Validate(); err != nil {
+			return fmt.Errorf("drop: %s", err)
+		}
+	}
+
+	if c.Certificates.Warn != "" {
+		if warn, err := time.ParseDuration(c.Certificates.Warn); err != nil || warn < time.Hour {
+			return fmt.Errorf("certificates.warn: expected a duration of at least 1h, got %q", c.Certificates.Warn)
+		}
+	}
+
+	roots := map[string]bool{path.Clean(c.ServerRoot): true}
+	for i, v := range c.VirtualHosts {
+		if len(v.Hosts) == 0 {
+			return fmt.Errorf("virtual_hosts[%d].hosts: expected at least one host", i)
+		}
+		if v.ServerRoot == "" {
+			return fmt.Errorf("virtual_hosts[%d].server_root: expected a directory, got an empty string", i)
+		}
+		if roots[path.Clean(v.ServerRoot)] {
+			return fmt.Errorf("virtual_hosts[%d].server_root: expected a server root of its own, got %q", i, v.ServerRoot)
+		}
+		roots[path.Clean(v.ServerRoot)] = true
+	}
+
+	if len(c.Scope.Countries) != 0 && c.GeoIPPath == "" {
+		return errors.New("scope.countries: expected geoip_path to be set")
+	}
+
+	if err := geoip.ValidateGroups(c.CountryGroups); err != nil {
+		return errors.Wrap(err, "country_groups")
+	}
+
+	return nil
+}
+
+// Config reads and validates the configuration file. Unknown keys and values
+// of the wrong type are errors so typos are not silently ignored
+func Config() (*Configuration, error) {
+	config := viper.New()
 	config.SetConfigName("config")
 	config.AddConfigPath("$HOME/.config/" + ProjectName)
 	config.AddConfigPath("$HOME/." + ProjectName)
 	config.AddConfigPath("/etc/" + ProjectName)
+	return readConfig(config)
+}
+
+// readConfig reads, decodes, and validates the configuration file config finds
+func readConfig(config *viper.Viper) (*Configuration, error) {
+	config.SetDefault("server_root", "/var/www/html")
+	config.SetDefault("listen", "127.0.0.1:8080")
 
 	err := config.ReadInConfig()
 	switch err.(type) {
@@ -30,5 +499,15 @@ func Config() (*viper.Viper, error) {
 		return nil, err
 	}
 
-	return config, nil
+	var ret Configuration
+	if err := config.UnmarshalExact(&ret); err != nil {
+		return nil, errors.Wrap(err, config.ConfigFileUsed())
+	}
+	ret.file = config.ConfigFileUsed()
+
+	if err := ret.Validate(); err != nil {
+		return nil, errors.Wrap(err, ret.file)
+	}
+
+	return &ret, nil
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// loadConfig reads the configuration file data
+func loadConfig(t *testing.T, data string) (*Configuration, error) {
+	dir, err := ioutil.TempDir("", "satellite-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := viper.New()
+	config.SetConfigFile(file)
+	return readConfig(config)
+}
+
+func TestConfig_valid(t *testing.T) {
+	config, err := loadConfig(t, `listen: 0.0.0.0:443
+log_level: info
+global_conditions:
+  authorized_methods: [GET]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != "0.0.0.0:443" || config.ServerRoot != "/var/www/html" {
+		t.Errorf("unexpected config %+v", config)
+	}
+}
+
+func TestConfig_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// key must be named in the error
+		key string
+	}{
+		{"unknown key", "bogus: 1", "bogus"},
+		{"unknown nested key", "ssl:\n  bogus: 1", "bogus"},
+		{"wrong type", "maintenance:\n  status: abc", "maintenance.status"},
+		{"wrong type list", "listen: [a, b]", "listen"},
+		{"listen", `listen: ""`, "listen"},
+		{"log_level", "log_level: loud", "log_level"},
+		{"ssl", "ssl:\n  key: a.key", "ssl"},
+		{"acme with ssl", "ssl:\n  key: a.key\n  cert: a.crt\nacme:\n  domains: [example.com]\n  provider: cloudflare", "acme"},
+		{"acme", "acme:\n  domains: [example.com]\n  provider: nope", "acme"},
+		{"client_certs", "client_certs:\n  ca: /nonexistent/ca.pem", "client_certs"},
+		{"client_certs.ca", "client_certs:\n  request: true\n  ca: /nonexistent/ca.pem", "client_certs.ca"},
+		{"maintenance.status", "maintenance:\n  status: 42", "maintenance.status"},
+		{"persona", "persona: nope", "persona"},
+		{"geoip.account_id", "geoip:\n  license_key: key", "geoip.account_id"},
+		{"geoip.license_key", "geoip:\n  license_key: key\n  account_id: '1'", "geoip.license_key"},
+		{"geoip.refresh", "geoip_path: /tmp/geoip.mmdb\ngeoip:\n  license_key: key\n  account_id: '1'\n  refresh: 1m", "geoip.refresh"},
+		{"blocklists.feeds", "blocklists:\n  feeds:\n    - url: ftp://example.com", "blocklists.feeds[0]"},
+		{"blocklists.refresh", "blocklists:\n  refresh: 1s", "blocklists.refresh"},
+		{"hosting_providers.refresh", "hosting_providers:\n  refresh: 1m", "hosting_providers.refresh"},
+		{"tor.refresh", "tor:\n  refresh: 1s", "tor.refresh"},
+		{"log.rotate", "log:\n  rotate:\n    max_files: -1", "log.rotate.max_files"},
+		{"retention.days", "retention:\n  days: -1", "retention.days"},
+		{"retention.campaigns", "retention:\n  campaigns:\n    q3: 0", "retention.campaigns.q3"},
+		{"retention.interval", "retention:\n  interval: 1s", "retention.interval"},
+		{"retention.signing_key", "retention:\n  receipts: /tmp/receipts", "retention.signing_key"},
+		{"global_conditions unknown", "global_conditions:\n  bogus: 1", "global_conditions: unknown condition bogus"},
+		{"global_conditions wrong type", "global_conditions:\n  max_identical_requests: abc", "global_conditions: max_identical_requests"},
+		{"global_conditions nested", "global_conditions:\n  any:\n    - bogus: 1", "global_conditions: any: unknown condition bogus"},
+		{"global_conditions invalid", "global_conditions:\n  authorized_headers:\n    x-token: \"(\"", "global_conditions"},
+		{"forward", "forward:\n  url: http://example.com", "forward"},
+		{"campaigns", "campaigns:\n  q3:\n    serves_per_day: -1", "campaigns.q3"},
+		{"decoy_refresh", "decoy_refresh:\n  - url: ftp://example.com", "decoy_refresh[0]"},
+		{"management.oidc", "management:\n  oidc:\n    issuer: nope", "management.oidc.issuer"},
+		{"drop", "drop:\n  backend: nope", "drop"},
+		{"certificates.warn", "certificates:\n  warn: 1m", "certificates.warn"},
+		{"virtual_hosts hosts", "virtual_hosts:\n  - server_root: /srv/a", "virtual_hosts[0].hosts"},
+		{"virtual_hosts server_root", "virtual_hosts:\n  - hosts: [a.example.com]", "virtual_hosts[0].server_root"},
+		{"virtual_hosts shared server_root", "virtual_hosts:\n  - hosts: [a.example.com]\n    server_root: /var/www/html", "virtual_hosts[0].server_root"},
+		{"scope.countries", "scope:\n  countries: [US]", "scope.countries"},
+		{"country_groups", "country_groups:\n  eu: [FR]", "country_groups"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfig(t, tt.data)
+			if err == nil {
+				t.Fatal("config was accepted")
+			}
+			if !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("expected the error to name %s, got %v", tt.key, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Package decoy keeps decoy files cloned from the imitated site fresh by
+// fetching them again from their origin
+package decoy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRefresh is how often a decoy is fetched when refresh is not set
+const DefaultRefresh = 24 * time.Hour
+
+// DefaultMaxChange is the fraction of lines which may change in one refresh when max_change is not set
+const DefaultMaxChange = 0.5
+
+// DefaultUserAgent is the User-Agent decoys are fetched with when user_agent is not set
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36"
+
+// ErrTooManyChanges is returned when the origin changed more of a decoy than max_change allows
+var ErrTooManyChanges = errors.New("origin changed more of the decoy than max_change allows")
+
+// Source is a decoy file cloned from a page of the imitated site
+type Source struct {
+	// URL is the page the decoy is cloned from
+	URL string `mapstructure:"url"`
+	// File is the decoy file, relative to server_root, which is replaced by the page
+	File string `mapstructure:"file"`
+	// Refresh is how often the page is fetched. Defaults to 24h
+	Refresh string `mapstructure:"refresh"`
+	// Hours is the daily UTC window the page is fetched in, like 09:00-17:00, so
+	// fetches look like a visitor. Windows may cross midnight
+	Hours string `mapstructure:"hours"`
+	// MaxChange is the largest fraction of lines which may change in one refresh.
+	// Larger changes, like the origin serving an error or block page, are not
+	// written. Defaults to 0.5
+	MaxChange float64 `mapstructure:"max_change"`
+	// UserAgent is the User-Agent the page is fetched with. Defaults to a current browser
+	UserAgent string `mapstructure:"user_agent"`
+}
+
+// Validate checks the source can be fetched on its schedule
+func (s Source) Validate() error {
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		return errors.New(fmt.Sprintf("%s is not a valid decoy URL", s.URL))
+	}
+	if s.File == "" {
+		return errors.New("file: expected a decoy file, got an empty string")
+	}
+	if s.Refresh != "" {
+		if d, err := time.ParseDuration(s.Refresh); err != nil || d < time.Minute {
+			return errors.New(fmt.Sprintf("%s is not a valid refresh of at least 1m", s.Refresh))
+		}
+	}
+	if s.Hours != "" {
+		if _, _, err := parseHours(s.Hours); err != nil {
+			return err
+		}
+	}
+	if s.MaxChange < 0 || s.MaxChange > 1 {
+		return errors.New(fmt.Sprintf("%g is not a valid max_change between 0 and 1", s.MaxChange))
+	}
+	return nil
+}
+
+// interval gets how often the source is fetched
+func (s Source) interval() time.Duration {
+	if d, err := time.ParseDuration(s.Refresh); err == nil {
+		return d
+	}
+	return DefaultRefresh
+}
+
+// InWindow returns true if t is within the hours the source is fetched in
+func (s Source) InWindow(t time.Time) bool {
+	if s.Hours == "" {
+		return true
+	}
+	start, end, err := parseHours(s.Hours)
+	if err != nil {
+		return false
+	}
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// parseHours parses a window like 09:00-17:00 into minutes since midnight
+func parseHours(hours string) (int, int, error) {
+	parts := strings.SplitN(hours, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New(fmt.Sprintf("%s is not a valid hours window", hours))
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("%s is not a valid hours window", hours))
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// Change is the fraction of lines which were removed from old or added in new
+func Change(old, new []byte) float64 {
+	oldLines := bytes.Split(old, []byte("\n"))
+	newLines := bytes.Split(new, []byte("\n"))
+
+	counts := make(map[string]int, len(oldLines))
+	for _, line := range oldLines {
+		counts[string(line)]++
+	}
+	changed := 0
+	for _, line := range newLines {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+		} else {
+			changed++
+		}
+	}
+	for _, n := range counts {
+		changed += n
+	}
+
+	total := len(oldLines)
+	if len(newLines) > total {
+		total = len(newLines)
+	}
+	return float64(changed) / float64(2*total)
+}
+
+// Refresher fetches decoys from their origin into the server root
+type Refresher struct {
+	client *http.Client
+	root   string
+}
+
+// NewRefresher creates a Refresher writing decoys relative to root
+func NewRefresher(root string) *Refresher {
+	return &Refresher{client: &http.Client{Timeout: time.Minute}, root: root}
+}
+
+// file gets the path of the decoy file of s
+func (r *Refresher) file(s Source) string {
+	if filepath.IsAbs(s.File) {
+		return s.File
+	}
+	return filepath.Join(r.root, s.File)
+}
+
+// Refresh fetches the page of s and replaces the decoy file with it. It returns
+// false when the page did not change
+func (r *Refresher) Refresh(s Source) (bool, error) {
+	page, err := r.fetch(s)
+	if err != nil {
+		return false, err
+	}
+
+	file := r.file(s)
+	mode := os.FileMode(0644)
+	old, err := ioutil.ReadFile(file)
+	if err == nil {
+		if bytes.Equal(old, page) {
+			return false, nil
+		}
+		maxChange := s.MaxChange
+		if maxChange == 0 {
+			maxChange = DefaultMaxChange
+		}
+		if change := Change(old, page); change > maxChange {
+			return false, errors.Wrap(ErrTooManyChanges, fmt.Sprintf("%.0f%% of lines changed", change*100))
+		}
+		if info, err := os.Stat(file); err == nil {
+			mode = info.Mode()
+		}
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	// Replace the file at once so a partially written decoy is never served
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".decoy")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(page); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), file)
+}
+
+// fetch downloads the page of s
+func (r *Refresher) fetch(s Source) ([]byte, error) {
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := s.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("fetching %s: %s", s.URL, resp.Status))
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(page) == 0 {
+		return nil, errors.New(fmt.Sprintf("fetching %s: empty page", s.URL))
+	}
+	return page, nil
+}
+
+// Run refreshes the decoy of s every refresh, waiting for its hours when they
+// are set. Each wait is jittered by up to a tenth of refresh so fetches are not periodic
+func (r *Refresher) Run(s Source) {
+	interval := s.interval()
+	for {
+		time.Sleep(interval + time.Duration(rand.Int63n(int64(interval/10)+1)))
+		for !s.InWindow(time.Now()) {
+			time.Sleep(time.Minute)
+		}
+
+		changed, err := r.Refresh(s)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"url":   s.URL,
+				"file":  s.File,
+				"error": err,
+			}).Warn("Unable to refresh decoy")
+			continue
+		}
+		log.WithFields(log.Fields{
+			"url":     s.URL,
+			"file":    s.File,
+			"changed": changed,
+		}).Debug("Refreshed decoy")
+	}
+}
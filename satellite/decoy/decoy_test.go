@@ -0,0 +1,90 @@
+package decoy_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/t94j0/satellite/satellite/decoy"
+)
+
+func TestSource_Validate(t *testing.T) {
+	for _, s := range []Source{
+		{URL: "example.com", File: "index.html"},
+		{URL: "https://example.com"},
+		{URL: "https://example.com", File: "index.html", Refresh: "1s"},
+		{URL: "https://example.com", File: "index.html", Hours: "9-17"},
+		{URL: "https://example.com", File: "index.html", MaxChange: 2},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%+v was valid", s)
+		}
+	}
+	if err := (Source{URL: "https://example.com", File: "index.html", Refresh: "12h", Hours: "22:00-06:00"}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSource_InWindow(t *testing.T) {
+	s := Source{Hours: "22:00-06:00"}
+	if !s.InWindow(time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)) || !s.InWindow(time.Date(2020, 1, 1, 5, 59, 0, 0, time.UTC)) {
+		t.Error("window crossing midnight did not match")
+	}
+	if s.InWindow(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Error("time outside of window matched")
+	}
+}
+
+func TestRefresher_Refresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellitetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := "<html>\n<title>Portal</title>\n<p>Copyright 2019</p>\n<p>Sign in</p>\n</html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != DefaultUserAgent {
+			t.Errorf("fetched with %s", r.UserAgent())
+		}
+		w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	refresher := NewRefresher(dir)
+	source := Source{URL: ts.URL, File: "index.html"}
+	file := filepath.Join(dir, "index.html")
+
+	// Missing decoys are cloned
+	if changed, err := refresher.Refresh(source); err != nil || !changed {
+		t.Fatalf("decoy was not cloned: %v", err)
+	}
+
+	// Small changes are written
+	page = strings.Replace(page, "2019", "2020", 1)
+	if changed, err := refresher.Refresh(source); err != nil || !changed {
+		t.Errorf("decoy was not refreshed: %v", err)
+	}
+	if changed, err := refresher.Refresh(source); err != nil || changed {
+		t.Error("unchanged decoy was written")
+	}
+
+	// Block pages are not
+	page = "Access denied"
+	if _, err := refresher.Refresh(source); errors.Cause(err) != ErrTooManyChanges {
+		t.Errorf("expected too many changes, got %v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Copyright 2020") {
+		t.Error("decoy was replaced by a block page")
+	}
+}
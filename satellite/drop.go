@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/drop"
+)
+
+// listenerPorts gets the TCP ports satellite serves clients on
+func listenerPorts(config *Configuration) []int {
+	ports := make([]int, 0, 2)
+	if _, p, err := net.SplitHostPort(config.Listen); err == nil {
+		if port, err := strconv.Atoi(p); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	if config.RedirectHTTP {
+		ports = append(ports, 80)
+	}
+	return ports
+}
+
+// dropBlacklisted drops the packets of blacklisted IPs to the listener ports in the
+// kernel, both those already on the global blacklist and those added while running.
+// IPs in drop.allow and scope.ranges are never dropped, and unbanned IPs are undropped
+func dropBlacklisted(config *Configuration, paths pathSet, scope []*net.IPNet) {
+	if len(config.Drop.Ports) == 0 {
+		config.Drop.Ports = listenerPorts(config)
+	}
+	dropper, err := drop.New(config.Drop)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "drop configuration error"))
+	}
+	if err := dropper.Setup(); err != nil {
+		log.Fatal(errors.Wrap(err, "unable to set up kernel packet dropping"))
+	}
+	allow, err := config.Drop.AllowRanges()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "drop configuration error"))
+	}
+	allow = append(allow, scope...)
+
+	dropIP := func(ip net.IP) {
+		// Never lock out the host itself, operators, or targets
+		if ip.IsLoopback() {
+			return
+		}
+		for _, r := range allow {
+			if r.Contains(ip) {
+				log.WithFields(log.Fields{
+					"ip": ip,
+				}).Debug("Not dropping packets of allowed IP")
+				return
+			}
+		}
+		if err := dropper.Drop(ip); err != nil {
+			log.WithFields(log.Fields{
+				"ip":    ip,
+				"error": err,
+			}).Error("Unable to drop blacklisted IP")
+			return
+		}
+		log.WithFields(log.Fields{
+			"ip": ip,
+		}).Debug("Dropping packets of blacklisted IP")
+	}
+
+	ips, err := paths.BlacklistedIPs()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to get blacklisted IPs")
+	}
+	for _, ip := range ips {
+		dropIP(ip)
+	}
+	paths.OnBlacklist(dropIP)
+	paths.OnUnblacklist(func(ip net.IP) {
+		if err := dropper.Undrop(ip); err != nil {
+			log.WithFields(log.Fields{
+				"ip":    ip,
+				"error": err,
+			}).Error("Unable to stop dropping unbanned IP")
+			return
+		}
+		log.WithFields(log.Fields{
+			"ip": ip,
+		}).Info("Stopped dropping packets of unbanned IP")
+	})
+}
@@ -0,0 +1,145 @@
+// Package drop drops the packets of blacklisted IPs in the kernel, before they reach the HTTP server
+package drop
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Dropper programs the kernel to drop the packets of IPs
+type Dropper interface {
+	// Setup prepares the kernel for dropping packets, like attaching the XDP
+	// program or creating the nftables sets
+	Setup() error
+	// Drop drops the packets from ip to the listener ports
+	Drop(ip net.IP) error
+	// Undrop stops dropping the packets from ip
+	Undrop(ip net.IP) error
+}
+
+// NewBackend creates a Dropper from the drop configuration
+type NewBackend func(config Config) (Dropper, error)
+
+// Backends are the droppers usable in drop.backend by name
+var Backends = map[string]NewBackend{
+	"exec":     newExec,
+	"nftables": newNFTables,
+	"xdp":      newXDP,
+}
+
+// BackendNames gets the names of the backends
+func BackendNames() []string {
+	names := make([]string, 0, len(Backends))
+	for name := range Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config is the drop section of the configuration
+type Config struct {
+	// Backend programs the kernel. One of nftables, xdp, or exec
+	Backend string `mapstructure:"backend"`
+	// Interface is the network interface the xdp backend attaches to
+	Interface string `mapstructure:"interface"`
+	// Command is run with the IP and the comma separated ports by the exec backend
+	Command string `mapstructure:"command"`
+	// UndropCommand is run with the IP by the exec backend when it is unbanned
+	UndropCommand string `mapstructure:"undrop_command"`
+	// Ports are the TCP ports packets are dropped on. Defaults to the ports satellite listens on
+	Ports []int `mapstructure:"ports"`
+	// Allow are the IPs and CIDR ranges which are never dropped, like the addresses of operators
+	Allow []string `mapstructure:"allow"`
+}
+
+// Enabled returns true when blacklisted IPs are dropped in the kernel
+func (c Config) Enabled() bool {
+	return c.Backend != ""
+}
+
+// Validate checks the backend exists and has what it requires
+func (c Config) Validate() error {
+	if _, ok := Backends[c.Backend]; !ok {
+		return errors.New(fmt.Sprintf("%s is not a drop backend. Expected one of %s", c.Backend, strings.Join(BackendNames(), ", ")))
+	}
+	if c.Backend == "xdp" && c.Interface == "" {
+		return errors.New("the xdp backend requires an interface")
+	}
+	if c.Backend == "exec" && c.Command == "" {
+		return errors.New("the exec backend requires a command")
+	}
+	// xdp-filter can not match an IP and a port together, so every port is dropped
+	if c.Backend == "xdp" && len(c.Allow) == 0 {
+		return errors.New("the xdp backend drops every port and requires allow")
+	}
+	for _, port := range c.Ports {
+		if port < 1 || port > 65535 {
+			return errors.New(fmt.Sprintf("%d is not a valid port", port))
+		}
+	}
+	if _, err := c.AllowRanges(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AllowRanges parses the IPs and CIDR ranges which are never dropped
+func (c Config) AllowRanges() ([]*net.IPNet, error) {
+	ranges := make([]*net.IPNet, 0, len(c.Allow))
+	for _, a := range c.Allow {
+		if ip := net.ParseIP(a); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s in allow is not a valid IP or CIDR range", a))
+		}
+		ranges = append(ranges, network)
+	}
+	return ranges, nil
+}
+
+// ports joins the ports with sep
+func (c Config) ports(sep string) string {
+	ports := make([]string, 0, len(c.Ports))
+	for _, port := range c.Ports {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return strings.Join(ports, sep)
+}
+
+// New creates the Dropper of the configured backend
+func New(config Config) (Dropper, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if len(config.Ports) == 0 {
+		return nil, errors.New("no ports to drop packets on")
+	}
+	return Backends[config.Backend](config)
+}
+
+// run runs a helper command, giving its output when it fails
+func run(stdin string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s %s: %s", name, strings.Join(args, " "), out)
+	}
+	return nil
+}
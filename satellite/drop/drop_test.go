@@ -0,0 +1,97 @@
+package drop_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/drop"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	for _, c := range []Config{
+		{Backend: "iptables"},
+		{Backend: "xdp"},
+		{Backend: "xdp", Interface: "eth0"},
+		{Backend: "exec"},
+		{Backend: "exec", Command: "ban", Ports: []int{0}},
+		{Backend: "exec", Command: "ban", Allow: []string{"10.0.0.0/33"}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v was valid", c)
+		}
+	}
+	if err := (Config{Backend: "xdp", Interface: "eth0", Allow: []string{"10.0.0.1", "10.1.0.0/16"}}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfig_AllowRanges(t *testing.T) {
+	ranges, err := (Config{Allow: []string{"10.0.0.1", "192.168.0.0/16", "2001:db8::1"}}).AllowRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ip := range []string{"10.0.0.1", "192.168.4.4", "2001:db8::1"} {
+		if !ranges[i].Contains(net.ParseIP(ip)) {
+			t.Errorf("%s is not in %s", ip, ranges[i])
+		}
+	}
+	if ranges[0].Contains(net.ParseIP("10.0.0.2")) {
+		t.Error("single IP allowed its neighbor")
+	}
+}
+
+func TestNew_exec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellitetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "dropped")
+	command := filepath.Join(dir, "drop.sh")
+	script := "#!/bin/sh\necho \"$0 $1 $2\" >> " + out + "\n"
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	undrop := filepath.Join(dir, "undrop.sh")
+	if err := os.Symlink(command, undrop); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Config{Backend: "exec", Command: command}); err == nil {
+		t.Error("dropper without ports was created")
+	}
+	dropper, err := New(Config{Backend: "exec", Command: command, UndropCommand: undrop, Ports: []int{80, 443}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropper.Setup(); err != nil {
+		t.Error(err)
+	}
+	if err := dropper.Drop(net.ParseIP("10.0.0.1")); err != nil {
+		t.Error(err)
+	}
+	if err := dropper.Undrop(net.ParseIP("10.0.0.1")); err != nil {
+		t.Error(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := command + " 10.0.0.1 80,443\n" + undrop + " 10.0.0.1 80,443\n"
+	if string(data) != expected {
+		t.Errorf("unexpected dropped IPs %q", data)
+	}
+
+	dropper, err = New(Config{Backend: "exec", Command: command, Ports: []int{443}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dropper.Undrop(net.ParseIP("10.0.0.1")); err == nil {
+		t.Error("exec backend without undrop_command unbanned")
+	}
+}
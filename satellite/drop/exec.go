@@ -0,0 +1,36 @@
+package drop
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// execDropper runs a command with the IP for firewalls without built in support
+type execDropper struct {
+	command       string
+	undropCommand string
+	ports         string
+}
+
+func newExec(config Config) (Dropper, error) {
+	return execDropper{command: config.Command, undropCommand: config.UndropCommand, ports: config.ports(",")}, nil
+}
+
+// Setup does nothing, as the command is expected to prepare the firewall itself
+func (execDropper) Setup() error {
+	return nil
+}
+
+// Drop runs the command with ip and the ports
+func (e execDropper) Drop(ip net.IP) error {
+	return run("", e.command, ip.String(), e.ports)
+}
+
+// Undrop runs the undrop command with ip
+func (e execDropper) Undrop(ip net.IP) error {
+	if e.undropCommand == "" {
+		return errors.New("the exec backend requires an undrop_command to unban")
+	}
+	return run("", e.undropCommand, ip.String(), e.ports)
+}
@@ -0,0 +1,61 @@
+package drop
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+)
+
+// nftablesRuleset replaces the satellite table with sets of dropped IPs, which are
+// checked on the listener ports before any other input rule
+const nftablesRuleset = `table inet satellite
+delete table inet satellite
+table inet satellite {
+	set dropped4 {
+		type ipv4_addr
+	}
+	set dropped6 {
+		type ipv6_addr
+	}
+	chain input {
+		type filter hook input priority -10; policy accept;
+		tcp dport { %[1]s } ip saddr @dropped4 drop
+		tcp dport { %[1]s } ip6 saddr @dropped6 drop
+	}
+}
+`
+
+// nftables drops IPs with nftables sets in the inet satellite table
+type nftables struct {
+	ports string
+}
+
+func newNFTables(config Config) (Dropper, error) {
+	if _, err := exec.LookPath("nft"); err != nil {
+		return nil, err
+	}
+	return nftables{ports: config.ports(", ")}, nil
+}
+
+// Setup replaces the satellite table, so rules are not duplicated on restarts
+func (n nftables) Setup() error {
+	return run(fmt.Sprintf(nftablesRuleset, n.ports), "nft", "-f", "-")
+}
+
+// Drop adds ip to the set of its address family
+func (nftables) Drop(ip net.IP) error {
+	return run("", "nft", "add", "element", "inet", "satellite", nftablesSet(ip), "{ "+ip.String()+" }")
+}
+
+// Undrop deletes ip from the set of its address family
+func (nftables) Undrop(ip net.IP) error {
+	return run("", "nft", "delete", "element", "inet", "satellite", nftablesSet(ip), "{ "+ip.String()+" }")
+}
+
+// nftablesSet gets the set of the address family of ip
+func nftablesSet(ip net.IP) string {
+	if ip.To4() != nil {
+		return "dropped4"
+	}
+	return "dropped6"
+}
@@ -0,0 +1,36 @@
+package drop
+
+import (
+	"net"
+	"os/exec"
+)
+
+// xdp drops IPs with the XDP program of xdp-filter from xdp-tools, which drops
+// packets in the network driver before the kernel allocates memory for them
+type xdp struct {
+	iface string
+}
+
+func newXDP(config Config) (Dropper, error) {
+	if _, err := exec.LookPath("xdp-filter"); err != nil {
+		return nil, err
+	}
+	return xdp{iface: config.Interface}, nil
+}
+
+// Setup attaches a fresh filter to the interface
+func (x xdp) Setup() error {
+	// The filter is still attached after a restart
+	run("", "xdp-filter", "unload", x.iface)
+	return run("", "xdp-filter", "load", "--features", "ipv4,ipv6", x.iface)
+}
+
+// Drop drops packets with ip as their source
+func (x xdp) Drop(ip net.IP) error {
+	return run("", "xdp-filter", "ip", "--mode", "src", ip.String())
+}
+
+// Undrop removes the filter of ip
+func (x xdp) Undrop(ip net.IP) error {
+	return run("", "xdp-filter", "ip", "--mode", "src", "--remove", ip.String())
+}
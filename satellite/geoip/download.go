@@ -0,0 +1,107 @@
+package geoip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gip "github.com/oschwald/geoip2-golang"
+	"github.com/pkg/errors"
+)
+
+// DownloadURL is the MaxMind download endpoint of a database edition
+var DownloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=tar.gz"
+
+// ErrNoMMDB is returned when a downloaded archive has no database
+var ErrNoMMDB = errors.New("no mmdb file in archive")
+
+// Updater downloads MaxMind databases with a MaxMind account
+type Updater struct {
+	accountID  string
+	licenseKey string
+	client     *http.Client
+}
+
+// NewUpdater creates an Updater for the MaxMind account
+func NewUpdater(accountID, licenseKey string) *Updater {
+	return &Updater{
+		accountID:  accountID,
+		licenseKey: licenseKey,
+		client:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Download downloads the latest database of edition, like GeoLite2-City, to
+// dest. dest is only replaced once the new database is known to open, and is
+// replaced by a rename so readers of the old file are not disturbed
+func (u *Updater) Download(edition, dest string) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf(DownloadURL, edition), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(u.accountID, u.licenseKey)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(fmt.Sprintf("downloading %s: %s", edition, resp.Status))
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := extractMMDB(resp.Body, tmp); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, edition)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	db, err := gip.Open(tmp.Name())
+	if err != nil {
+		return errors.Wrap(err, edition)
+	}
+	db.Close()
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// extractMMDB writes the database in a gzipped tar archive to w
+func extractMMDB(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return ErrNoMMDB
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".mmdb") {
+			_, err := io.Copy(w, archive)
+			return err
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package geoip_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/geoip"
+)
+
+// mmdbArchive creates a MaxMind download archive of the test country DB
+func mmdbArchive() ([]byte, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	db, err := ioutil.ReadFile(filepath.Join(wd, "..", "..", ".config", "var", "lib", "satellite", "GeoLite2-Country.mmdb"))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	files := map[string][]byte{
+		"GeoLite2-Country_20200101/LICENSE.txt":           []byte("license"),
+		"GeoLite2-Country_20200101/GeoLite2-Country.mmdb": db,
+	}
+	for name, data := range files {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return nil, err
+		}
+		if _, err := archive.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes(), nil
+}
+
+func TestUpdater_Download(t *testing.T) {
+	data, err := mmdbArchive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "1234" || pass != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+	DownloadURL = ts.URL + "/%s"
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "GeoLite2-Country.mmdb")
+
+	if err := NewUpdater("1234", "wrong").Download("GeoLite2-Country", dest); err == nil {
+		t.Error("download with the wrong license key succeeded")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("failed download created the DB")
+	}
+
+	if err := NewUpdater("1234", "key").Download("GeoLite2-Country", dest); err != nil {
+		t.Fatal(err)
+	}
+	gip, err := New(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc, err := gip.CountryCode(net.ParseIP("104.222.16.238")); err != nil || cc != "US" {
+		t.Error("downloaded DB did not work")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Error("temporary files were left behind")
+	}
+}
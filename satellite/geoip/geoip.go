@@ -9,22 +9,82 @@ import (
 
 // DB holds the DB reader
 type DB struct {
-	db *gip.Reader
+	db  *gip.Reader
+	asn *gip.Reader
+	// groups are the custom named groups of ISO country codes
+	groups map[string][]string
 }
 
 // New creates a new DB reader based on the mmdb path
 func New(dbpath string) (DB, error) {
+	return DB{}.WithDB(dbpath)
+}
+
+// WithDB replaces the country or city DB with the DB at dbpath
+func (g DB) WithDB(dbpath string) (DB, error) {
 	if _, err := os.Stat(dbpath); os.IsNotExist(err) {
-		return DB{}, os.ErrNotExist
+		return g, os.ErrNotExist
 	}
 
-	var geoip DB
 	db, err := gip.Open(dbpath)
 	if err != nil {
-		return DB{}, err
+		return g, err
+	}
+	g.db = db
+	return g, nil
+}
+
+// WithASN adds the ASN DB at dbpath
+func (g DB) WithASN(dbpath string) (DB, error) {
+	if _, err := os.Stat(dbpath); os.IsNotExist(err) {
+		return g, os.ErrNotExist
+	}
+
+	db, err := gip.Open(dbpath)
+	if err != nil {
+		return g, err
+	}
+	g.asn = db
+	return g, nil
+}
+
+// HasASN returns true when the ASN DB was configured properly
+func (g DB) HasASN() bool {
+	return g.asn != nil
+}
+
+// ASN returns the autonomous system number and organization of the target IP
+func (g DB) ASN(ip net.IP) (uint, string, error) {
+	a, err := g.asn.ASN(ip)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return a.AutonomousSystemNumber, a.AutonomousSystemOrganization, nil
+}
+
+// Location is the city level location of an IP
+type Location struct {
+	// City is the English name of the city
+	City string
+	// Regions are the ISO codes and English names of the subdivisions, most general first
+	Regions []string
+	// TimeZone is the IANA timezone
+	TimeZone string
+}
+
+// Location returns the city, regions, and timezone of the target IP. The DB must be a GeoIP2-City DB
+func (g DB) Location(ip net.IP) (Location, error) {
+	c, err := g.db.City(ip)
+	if err != nil {
+		return Location{}, err
+	}
+
+	location := Location{City: c.City.Names["en"], TimeZone: c.Location.TimeZone}
+	for _, s := range c.Subdivisions {
+		location.Regions = append(location.Regions, s.IsoCode, c.Country.IsoCode+"-"+s.IsoCode, s.Names["en"])
 	}
-	geoip.db = db
-	return geoip, nil
+	return location, nil
 }
 
 // HasDB returns true when the DB was configured properly
@@ -56,3 +56,89 @@ func TestNew_CountryCode(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestDB_WithASN_notexist(t *testing.T) {
+	gip, err := createGeoIP()
+	if err != nil {
+		t.Error(err)
+	}
+
+	gip, err = gip.WithASN("/nonexistent/GeoLite2-ASN.mmdb")
+	if err != os.ErrNotExist {
+		t.Error("missing ASN DB was opened")
+	}
+	if gip.HasASN() || !gip.HasDB() {
+		t.Error("country DB was not kept")
+	}
+}
+
+func TestDB_ASN_wrongdb(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Error(err)
+	}
+	fp := filepath.Join(wd, "..", "..", ".config", "var", "lib", "satellite", "GeoLite2-Country.mmdb")
+
+	gip, err := DB{}.WithASN(fp)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, _, err := gip.ASN(net.ParseIP("104.222.16.238")); err == nil {
+		t.Error("country DB was used for ASN lookups")
+	}
+}
+
+func TestDB_Location_countrydb(t *testing.T) {
+	gip, err := createGeoIP()
+	if err != nil {
+		t.Error(err)
+	}
+
+	location, err := gip.Location(net.ParseIP("104.222.16.238"))
+	if err != nil {
+		t.Error(err)
+	}
+	if location.City != "" || len(location.Regions) != 0 {
+		t.Error("country DB had a city")
+	}
+}
+
+func TestDB_ContinentCode(t *testing.T) {
+	gip, err := createGeoIP()
+	if err != nil {
+		t.Error(err)
+	}
+
+	continent, err := gip.ContinentCode(net.ParseIP("104.222.16.238"))
+	if err != nil {
+		t.Error(err)
+	}
+	if continent != "NA" {
+		t.Errorf("Address was said to be in %s", continent)
+	}
+}
+
+func TestDB_Group(t *testing.T) {
+	gip := DB{}.WithGroups(map[string][]string{"offices": {"DE", "JP"}})
+
+	if eu, ok := gip.Group("eu"); !ok || len(eu) != 27 {
+		t.Error("EU group was not built-in")
+	}
+	if offices, ok := gip.Group("OFFICES"); !ok || len(offices) != 2 {
+		t.Error("custom group was not found")
+	}
+	if _, ok := gip.Group("nordics"); ok {
+		t.Error("unknown group was found")
+	}
+}
+
+func TestValidateGroups_fail(t *testing.T) {
+	for _, groups := range []map[string][]string{
+		{"fvey": {"US"}},
+		{"offices": {"DEU"}},
+	} {
+		if err := ValidateGroups(groups); err == nil {
+			t.Errorf("%v was accepted", groups)
+		}
+	}
+}
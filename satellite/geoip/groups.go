@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Continents are the continent codes of the GeoIP DB
+var Continents = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
+
+// eu are the member states of the European Union
+var eu = []string{
+	"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+	"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+}
+
+// Groups are the built-in named groups of ISO country codes
+var Groups = map[string][]string{
+	"EU":   eu,
+	"EEA":  append(append([]string{}, eu...), "IS", "LI", "NO"),
+	"FVEY": {"AU", "CA", "GB", "NZ", "US"},
+}
+
+// ValidateGroups ensures custom country groups do not replace a built-in group
+// and only hold two letter ISO country codes
+func ValidateGroups(groups map[string][]string) error {
+	for name, countries := range groups {
+		if _, ok := Groups[strings.ToUpper(name)]; ok {
+			return errors.New(fmt.Sprintf("%s is a built-in country group", name))
+		}
+		for _, cc := range countries {
+			if len(cc) != 2 {
+				return errors.New(fmt.Sprintf("%s in country group %s is not an ISO country code", cc, name))
+			}
+		}
+	}
+	return nil
+}
+
+// WithGroups adds custom named groups of ISO country codes, like the countries of a target's offices
+func (g DB) WithGroups(groups map[string][]string) DB {
+	g.groups = make(map[string][]string, len(groups))
+	for name, countries := range groups {
+		g.groups[strings.ToUpper(name)] = countries
+	}
+	return g
+}
+
+// Group gets the ISO country codes of the built-in or custom group name
+func (g DB) Group(name string) ([]string, bool) {
+	name = strings.ToUpper(name)
+	if countries, ok := Groups[name]; ok {
+		return countries, true
+	}
+	countries, ok := g.groups[name]
+	return countries, ok
+}
+
+// ContinentCode returns the continent code of the target IP, like EU for Europe
+func (g DB) ContinentCode(ip net.IP) (string, error) {
+	c, err := g.db.Country(ip)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Continent.Code, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// DefaultFormMaxBody is the most bytes of a form submission stored when max_body is not set
+const DefaultFormMaxBody = 64 << 10
+
+// thanksPage is the thank you page when no path is rendered and there is no persona
+const thanksPage = `<!DOCTYPE html>
+<html>
+<head><title>Thank you</title></head>
+<body>
+<h1>Thank you</h1>
+<p>Your submission has been received.</p>
+</body>
+</html>
+`
+
+// Submission is a form POSTed to the decoy site
+type Submission struct {
+	Time        time.Time `json:"time"`
+	IP          string    `json:"ip"`
+	Host        string    `json:"host"`
+	Path        string    `json:"path"`
+	UserAgent   string    `json:"user_agent"`
+	ContentType string    `json:"content_type"`
+	// Form are the fields of URL encoded forms
+	Form url.Values `json:"form,omitempty"`
+	// Body is the body of other submissions, up to the max body size
+	Body string `json:"body,omitempty"`
+}
+
+// FormAck acknowledges POSTs which no path serves with a thank you page, so forms
+// on the decoy site appear to work instead of ending in not_found
+type FormAck struct {
+	render  string
+	maxBody int64
+
+	mu sync.Mutex
+	// store is written every submission as a line of JSON. Submissions are discarded when it is nil
+	store io.Writer
+}
+
+// NewFormAck creates a FormAck rendering the render path as the thank you page, or
+// the page of the persona when render is empty. Submissions are appended to the
+// store file, or discarded when store is empty
+func NewFormAck(render, store string, maxBody int64) (*FormAck, error) {
+	if maxBody <= 0 {
+		maxBody = DefaultFormMaxBody
+	}
+	a := &FormAck{render: render, maxBody: maxBody}
+	if store != "" {
+		f, err := os.OpenFile(store, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		a.store = f
+	}
+	return a, nil
+}
+
+// record writes the submission of req to the store
+func (a *FormAck) record(req *http.Request) {
+	if a.store == nil {
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, a.maxBody))
+	if err != nil {
+		return
+	}
+	submission := Submission{
+		Time:        time.Now(),
+		IP:          parseRemoteAddr(req.RemoteAddr).String(),
+		Host:        req.Host,
+		Path:        req.URL.Path,
+		UserAgent:   req.UserAgent(),
+		ContentType: req.Header.Get("Content-Type"),
+	}
+	if mediaType, _, _ := mime.ParseMediaType(submission.ContentType); mediaType == "application/x-www-form-urlencoded" {
+		submission.Form, err = url.ParseQuery(string(body))
+	}
+	if submission.Form == nil || err != nil {
+		submission.Form, submission.Body = nil, string(body)
+	}
+
+	line, err := json.Marshal(submission)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.store.Write(append(line, '\n')); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to store form submission")
+	}
+}
+
+// formAckHandler stores the form POSTed in req and answers with the thank you page
+func (h RootHandler) formAckHandler(w http.ResponseWriter, req *http.Request) {
+	h.formAck.record(req)
+
+	w, finish := h.scrub(w)
+	defer finish()
+
+	if h.varier != nil {
+		vw := newVaryWriter(w, h.varier)
+		defer vw.finish()
+		w = vw
+	}
+
+	if h.formAck.render != "" {
+		req.URL.Path = h.formAck.render
+		req.Method = http.MethodGet
+		err := h.paths.Serve(w, req)
+		if err == nil {
+			return
+		}
+		log.Error(err)
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if page, ok := h.persona.Page(http.StatusOK); ok {
+		w.Write(page)
+		return
+	}
+	io.WriteString(w, thanksPage)
+}
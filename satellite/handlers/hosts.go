@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+)
+
+// HostFilter only allows requests whose Host header is in an allow-list
+type HostFilter struct {
+	// Reset closes the connection of unknown hosts instead of serving the not_found page
+	Reset bool
+	hosts []glob.Glob
+}
+
+// NewHostFilter creates a HostFilter from a list of host globs. action is
+// either "reset" or "not_found"
+func NewHostFilter(hosts []string, action string) (*HostFilter, error) {
+	filter := &HostFilter{}
+
+	switch action {
+	case "", "not_found":
+	case "reset":
+		filter.Reset = true
+	default:
+		return nil, errors.New("unknown_host must be either not_found or reset")
+	}
+
+	globs, err := compileHosts(hosts)
+	if err != nil {
+		return nil, err
+	}
+	filter.hosts = globs
+
+	return filter, nil
+}
+
+// compileHosts compiles a list of host globs, like *.example.com
+func compileHosts(hosts []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, 0, len(hosts))
+	for _, h := range hosts {
+		g, err := glob.Compile(strings.ToLower(h), '.')
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to compile host glob: "+h)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// matchHost returns true if host matches any of globs. The port is ignored
+func matchHost(globs []glob.Glob, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	for _, g := range globs {
+		if g.Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if host is in the allow-list. The port is ignored
+func (f *HostFilter) Allowed(host string) bool {
+	if f == nil || len(f.hosts) == 0 {
+		return true
+	}
+	return matchHost(f.hosts, host)
+}
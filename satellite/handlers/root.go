@@ -5,21 +5,38 @@ import (
 	"encoding/hex"
 	"io"
 	"net"
+	"net/url"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/assets"
 	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/metrics"
 	"github.com/t94j0/satellite/satellite/path"
 	"github.com/t94j0/satellite/satellite/util"
 )
 
+var panicsTotal = metrics.NewCounter("satellite_panics_total", "Requests which panicked while being handled")
+
 // RootHandler is the Handler function for all incoming http requests
 type RootHandler struct {
 	defaultIndex string
 	serverHeader string
 	paths        *path.Paths
 	notFound     util.NotFound
+	maintenance  *util.Maintenance
+	serverError  string
+	scrubber     *Scrubber
+	hostFilter   *HostFilter
+	scope        *Scope
+	varier       *Varier
+	virtualHosts []VirtualHost
+	persona      assets.Persona
+	formAck      *FormAck
 }
 
 // NewRootHandler creates a new RootHandler object
@@ -32,25 +49,145 @@ func NewRootHandler(ps *path.Paths, notFound util.NotFound, defaultIndex, server
 	}
 }
 
+// WithMaintenance serves the maintenance persona instead of content while m is active
+func (h RootHandler) WithMaintenance(m *util.Maintenance) RootHandler {
+	h.maintenance = m
+	return h
+}
+
+// WithServerError renders the render path when a request fails unexpectedly
+func (h RootHandler) WithServerError(render string) RootHandler {
+	h.serverError = render
+	return h
+}
+
+// WithScrubber removes leaks from the error, maintenance, and form pages using s
+func (h RootHandler) WithScrubber(s *Scrubber) RootHandler {
+	h.scrubber = s
+	return h
+}
+
+// WithHostFilter rejects requests for hosts which are not allowed by f
+func (h RootHandler) WithHostFilter(f *HostFilter) RootHandler {
+	h.hostFilter = f
+	return h
+}
+
+// WithScope never serves clients outside of s
+func (h RootHandler) WithScope(s *Scope) RootHandler {
+	h.scope = s
+	return h
+}
+
+// WithVarier adds random variation to decoy responses using v
+func (h RootHandler) WithVarier(v *Varier) RootHandler {
+	h.varier = v
+	return h
+}
+
+// WithVirtualHosts serves requests for the hosts of vhosts from their paths.
+// Other hosts are served from the default paths
+func (h RootHandler) WithVirtualHosts(vhosts []VirtualHost) RootHandler {
+	h.virtualHosts = vhosts
+	return h
+}
+
+// WithPersona serves the error pages of p when no not_found, maintenance, or
+// server_error page is rendered
+func (h RootHandler) WithPersona(p assets.Persona) RootHandler {
+	h.persona = p
+	return h
+}
+
+// WithFormAck acknowledges POSTs which no path serves using a
+func (h RootHandler) WithFormAck(a *FormAck) RootHandler {
+	h.formAck = a
+	return h
+}
+
+// errorPage writes the persona page for status, or the status code when the persona has none
+func (h RootHandler) errorPage(w http.ResponseWriter, status int) {
+	if page, ok := h.persona.Page(status); ok {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(status)
+		w.Write(page)
+		return
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, strconv.Itoa(status)+"\n")
+}
+
+// route uses the paths, not_found handler, and index of the virtual host of host
+func (h RootHandler) route(host string) RootHandler {
+	for _, v := range h.virtualHosts {
+		if v.Match(host) {
+			h.paths = v.paths
+			h.notFound = v.notFound
+			h.defaultIndex = v.defaultIndex
+			return h
+		}
+	}
+	return h
+}
+
 // ServeHTTP redirects the task of handling based on
 // if the file exist, the file should be hosted (based on Path rules), and if
 // the file should not be hosted
 func (h RootHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h = h.route(req.Host)
 
-	// Redirect to specified index
-	if req.URL.Path == "/" && h.defaultIndex != "" {
+	defer func() {
+		if r := recover(); r != nil {
+			h.recoverPanic(w, req, r)
+		}
+	}()
+
+	if h.serverHeader != "" && (h.scrubber == nil || !h.scrubber.Leaks([]byte(h.serverHeader))) {
+		w.Header().Add("Server", h.serverHeader)
+	}
+
+	if !h.hostFilter.Allowed(req.Host) {
+		log.WithFields(log.Fields{
+			"host": req.Host,
+		}).Debug("Host not allowed")
+		h.unknownHostHandler(w, req)
+		return
+	}
+
+	// Scope is checked before anything else so no path conditions can override it
+	if reason := h.scope.Violation(req.RemoteAddr, h.paths.GeoIP()); reason != "" {
+		scopeViolations.With(reason).Inc()
+		log.WithFields(log.Fields{
+			"ip":      req.RemoteAddr,
+			"reason":  reason,
+			"req_uri": req.RequestURI,
+		}).Warn("Request from outside of scope")
+		h.log(req, 301)
+		h.notExistHandler(w, req)
+		return
+	}
+
+	// Redirect to specified index. WebDAV clients ask about the root itself
+	if req.URL.Path == "/" && h.defaultIndex != "" && req.Method != http.MethodOptions && req.Method != "PROPFIND" {
 		req.URL.Path = h.defaultIndex
 	}
 
-	if h.serverHeader != "" {
-		w.Header().Add("Server", h.serverHeader)
+	if h.maintenance.Active(time.Now()) {
+		log.Debug("Maintenance active. Serving maintenance page")
+		h.log(req, h.maintenance.Status)
+		h.maintenanceHandler(w, req)
+		return
 	}
 
 	served, err := h.paths.MatchAndServe(w, req)
 	if err != nil {
 		log.Error(err)
 	}
-	if !served {
+	if !served && req.Method == http.MethodPost && h.formAck != nil {
+		log.Debug("File not found. Acknowledging form")
+		h.log(req, 200)
+		h.formAckHandler(w, req)
+	} else if !served {
 		log.Debug("File not found. Redirecting to not_found")
 		h.log(req, 301)
 		h.notExistHandler(w, req)
@@ -59,8 +196,28 @@ func (h RootHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// scrub wraps w so the page satellite generates is scrubbed when finish is called
+func (h RootHandler) scrub(w http.ResponseWriter) (http.ResponseWriter, func()) {
+	if h.scrubber == nil {
+		return w, func() {}
+	}
+	sw := newScrubWriter(w, h.scrubber)
+	return sw, sw.finish
+}
+
 func (h RootHandler) notExistHandler(w http.ResponseWriter, req *http.Request) {
-	if h.notFound.Redirect != "" {
+	w, finish := h.scrub(w)
+	defer finish()
+
+	if h.varier != nil {
+		vw := newVaryWriter(w, h.varier)
+		defer vw.finish()
+		w = vw
+	}
+
+	if h.notFound.Handler != nil {
+		h.notFound.Handler.ServeHTTP(w, req)
+	} else if h.notFound.Redirect != "" {
 		http.Redirect(w, req, h.notFound.Redirect, http.StatusMovedPermanently)
 	} else if h.notFound.Render != "" {
 		req.URL.Path = h.notFound.Render
@@ -68,13 +225,95 @@ func (h RootHandler) notExistHandler(w http.ResponseWriter, req *http.Request) {
 			log.Error(err)
 		}
 	} else {
-		w.WriteHeader(http.StatusNotFound)
-		io.WriteString(w, "404\n")
+		h.errorPage(w, http.StatusNotFound)
+	}
+}
+
+// unknownHostHandler rejects a request for a host which is not allowed
+func (h RootHandler) unknownHostHandler(w http.ResponseWriter, req *http.Request) {
+	if h.hostFilter.Reset {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				h.log(req, 0)
+				conn.Close()
+				return
+			}
+		}
+	}
+
+	h.log(req, http.StatusNotFound)
+	h.notExistHandler(w, req)
+}
+
+// recoverPanic logs a panic to the operator log and serves the server error page
+// to the client. The stack trace is never given to the client
+func (h RootHandler) recoverPanic(w http.ResponseWriter, req *http.Request, r interface{}) {
+	// Aborting the handler is a deliberate way to close the connection
+	if r == http.ErrAbortHandler {
+		panic(r)
+	}
+
+	panicsTotal.Inc()
+	log.WithFields(log.Fields{
+		"panic":   r,
+		"stack":   string(debug.Stack()),
+		"req_uri": req.RequestURI,
+	}).Error("Recovered from panic while handling request")
+	h.log(req, http.StatusInternalServerError)
+
+	w, finish := h.scrub(w)
+	defer finish()
+
+	if h.serverError != "" {
+		// The panic may have left the request in any state
+		errReq := *req
+		errReq.URL = &url.URL{Path: h.serverError}
+		err := h.paths.Serve(&statusWriter{ResponseWriter: w, status: http.StatusInternalServerError}, &errReq)
+		if err == nil {
+			return
+		}
+		log.Error(err)
 	}
+
+	h.errorPage(w, http.StatusInternalServerError)
+}
+
+func (h RootHandler) maintenanceHandler(w http.ResponseWriter, req *http.Request) {
+	w, finish := h.scrub(w)
+	defer finish()
+
+	if h.varier != nil {
+		vw := newVaryWriter(w, h.varier)
+		defer vw.finish()
+		w = vw
+	}
+
+	if h.maintenance.RetryAfter != "" {
+		w.Header().Set("Retry-After", h.maintenance.RetryAfter)
+	}
+
+	if h.maintenance.Render != "" {
+		req.URL.Path = h.maintenance.Render
+		err := h.paths.Serve(&statusWriter{ResponseWriter: w, status: h.maintenance.Status}, req)
+		if err == nil {
+			return
+		}
+		log.Error(err)
+	}
+
+	h.errorPage(w, h.maintenance.Status)
 }
 
 func getJA3(req *http.Request) string {
-	hash := md5.Sum([]byte(req.JA3Fingerprint))
+	return digest(req.JA3Fingerprint)
+}
+
+func getJA3S(req *http.Request) string {
+	return digest(req.JA3SFingerprint)
+}
+
+func digest(fingerprint string) string {
+	hash := md5.Sum([]byte(fingerprint))
 	out := make([]byte, 32)
 	hex.Encode(out, hash[:])
 	return string(out)
@@ -99,7 +338,8 @@ func getCountryCode(remoteAddr string, gip *geoip.DB) (string, error) {
 
 func (h RootHandler) log(req *http.Request, respCode int) {
 	ja3 := getJA3(req)
-	cc, err := getCountryCode(req.RemoteAddr, &h.paths.GeoipDB)
+	gip := h.paths.GeoIP()
+	cc, err := getCountryCode(req.RemoteAddr, &gip)
 	if err != nil {
 		log.Error(err)
 	}
@@ -109,6 +349,8 @@ func (h RootHandler) log(req *http.Request, respCode int) {
 		"remote_addr": req.RemoteAddr,
 		"req_uri":     req.RequestURI,
 		"ja3":         ja3,
+		"ja3s":        getJA3S(req),
+		"http2":       req.HTTP2Fingerprint,
 		"response":    respCode,
 		"user_agent":  req.UserAgent(),
 		"geo_ip":      cc,
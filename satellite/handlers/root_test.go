@@ -1,13 +1,22 @@
 package handlers_test
 
 import (
+	"bufio"
+	"crypto/tls"
+	"io"
 	"io/ioutil"
 	"net/http"
+	stdhttptest "net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	sHTTP "github.com/t94j0/satellite/net/http"
 	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/assets"
+	"github.com/t94j0/satellite/satellite/geoip"
 	. "github.com/t94j0/satellite/satellite/handlers"
 	"github.com/t94j0/satellite/satellite/path"
 	"github.com/t94j0/satellite/satellite/util"
@@ -193,3 +202,411 @@ func TestRootHandler_ServeHTTP_notfound_404(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestRootHandler_ServeHTTP_notfound_handler(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	decoy := util.NewNotFoundHandler(sHTTP.HandlerFunc(func(w sHTTP.ResponseWriter, req *sHTTP.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("decoy " + req.URL.Path))
+	}))
+	if decoy.ShouldWarn() {
+		t.Error("not_found handler was reported as unset")
+	}
+	handler := NewRootHandler(paths, decoy, "/index.html", "Server")
+
+	req := httptest.NewRequest("GET", "/abc", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusTeapot || string(body) != "decoy /abc" {
+		t.Errorf("not_found handler was not used: %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestRootHandler_ServeHTTP_notfound_persona(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+	persona, err := assets.NewPersona("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithPersona(persona)
+
+	req := httptest.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(string(body), "<center>nginx</center>") {
+		t.Errorf("unexpected response %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestRootHandler_ServeHTTP_maintenance(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/index.html": "Hello!",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	maintenance, err := util.NewMaintenance(true, 0, "", "3600", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithMaintenance(maintenance)
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "3600" {
+		t.Fail()
+	}
+
+	maintenance.Set(false)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/index.html", nil))
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fail()
+	}
+}
+
+func TestRootHandler_ServeHTTP_maintenance_render(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/index.html":  "Hello!",
+		"/parked.html": "parked",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	maintenance, err := util.NewMaintenance(false, http.StatusOK, "/parked.html", "", []string{"2000-01-01T00:00:00Z/2100-01-01T00:00:00Z"})
+	if err != nil {
+		t.Error(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithMaintenance(maintenance)
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "parked" {
+		t.Fail()
+	}
+}
+
+func TestRootHandler_ServeHTTP_panic(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server")
+
+	// A request without a URL panics while being handled
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	req.URL = nil
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusInternalServerError || strings.Contains(string(body), "goroutine") {
+		t.Fail()
+	}
+}
+
+func TestRootHandler_ServeHTTP_hostfilter(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/index.html": "Hello!",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	filter, err := NewHostFilter([]string{"*.example.com"}, "not_found")
+	if err != nil {
+		t.Error(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithHostFilter(filter)
+
+	req := httptest.NewRequest("GET", "https://www.example.com:443/index.html", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Error("allowed host was not served")
+	}
+
+	req = httptest.NewRequest("GET", "/index.html", nil)
+	req.Host = "192.0.2.1"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Error("unknown host was served")
+	}
+}
+
+func TestRootHandler_ServeHTTP_virtualhost(t *testing.T) {
+	defaultDir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer defaultDir.Close()
+	defaultDir.CreateFiles(map[string]string{"/index.html": "default"})
+	vhostDir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer vhostDir.Close()
+	vhostDir.CreateFiles(map[string]string{"/home.html": "vhost", "/decoy.html": "decoy"})
+
+	paths, err := defaultDir.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+	vhostPaths, err := vhostDir.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+	vhost, err := NewVirtualHost([]string{"*.example.com"}, vhostPaths, util.NotFound{Render: "/decoy.html"}, "/home.html")
+	if err != nil {
+		t.Error(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithVirtualHosts([]VirtualHost{vhost})
+
+	for _, c := range []struct {
+		host, uri, body string
+	}{
+		{"other.com", "/", "default"},
+		{"www.example.com:443", "/", "vhost"},
+		{"www.example.com", "/index.html", "decoy"},
+		{"other.com", "/home.html", "404\n"},
+	} {
+		req := httptest.NewRequest("GET", c.uri, nil)
+		req.Host = c.host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if body := w.Body.String(); body != c.body {
+			t.Errorf("%s%s: expected %q, got %q", c.host, c.uri, c.body, body)
+		}
+	}
+}
+
+func TestNewHostFilter_badaction(t *testing.T) {
+	if _, err := NewHostFilter([]string{"example.com"}, "drop"); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRootHandler_ServeHTTP_scope(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/index.html": "Hello!",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+
+	scope, err := NewScope([]string{"10.0.0.0/8", "198.51.100.7"}, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithScope(scope)
+
+	for _, addr := range []string{"10.1.2.3:4444", "198.51.100.7:4444"} {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("in scope client %s was not served", addr)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	req.RemoteAddr = "192.0.2.1:4444"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Error("out of scope client was served")
+	}
+}
+
+func TestScope_Violation_country(t *testing.T) {
+	scope, err := NewScope(nil, []string{"us"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Without a GeoIP database the country cannot be known
+	if scope.Violation("192.0.2.1:4444", geoip.DB{}) != ScopeViolationCountry {
+		t.Fail()
+	}
+}
+
+func TestNewScope_badrange(t *testing.T) {
+	if _, err := NewScope([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRootHandler_ServeHTTP_formack(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	paths, err := td.Paths()
+	if err != nil {
+		t.Error(err)
+	}
+	persona, err := assets.NewPersona("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := filepath.Join(td.Path, "forms.jsonl")
+	formAck, err := NewFormAck("", store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "/index.html", "Server").WithPersona(persona).WithFormAck(formAck)
+
+	req := httptest.NewRequest("POST", "/contact", strings.NewReader("name=Alice&email=alice%40example.com"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Thank You") {
+		t.Errorf("unexpected response %d %q", resp.StatusCode, body)
+	}
+	stored, err := ioutil.ReadFile(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stored), `"email":["alice@example.com"]`) || !strings.Contains(string(stored), `"path":"/contact"`) {
+		t.Errorf("unexpected stored submission %q", stored)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/contact", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET was acknowledged with %d", w.Code)
+	}
+}
+
+func TestRootHandler_ServeHTTP_proxy_streams(t *testing.T) {
+	release := make(chan struct{})
+	upstream := stdhttptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	}))
+	defer upstream.Close()
+
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/pathList.yml": "- path: /poll\n  proxy: " + upstream.URL + "\n",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrubber, err := NewScrubber(td.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	varier, err := NewVarier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRootHandler(paths, NoNotFound, "", "").WithScrubber(scrubber).WithVarier(varier)
+	// Only TLS connections are served
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	first := make(chan string, 1)
+	go func() {
+		res, err := client.Get(server.URL + "/poll")
+		if err != nil {
+			first <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		line, _ := bufio.NewReader(res.Body).ReadString('\n')
+		first <- line
+	}()
+
+	select {
+	case line := <-first:
+		if line != "first\n" {
+			t.Errorf("unexpected first chunk %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("proxied response was not streamed before the upstream finished")
+	}
+	close(release)
+}
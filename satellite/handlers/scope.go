@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/metrics"
+)
+
+var scopeViolations = metrics.NewCounterVec("satellite_scope_violations_total", "Requests from clients outside of the engagement scope", "reason")
+
+// Reasons a client is out of scope
+const (
+	ScopeViolationIP      = "ip"
+	ScopeViolationCountry = "country"
+)
+
+// Scope is the engagement scope. Clients outside of it are never served, no
+// matter what the path conditions allow
+type Scope struct {
+	ranges    []*net.IPNet
+	countries []string
+}
+
+// NewScope creates a Scope from in-scope IPs and CIDR ranges and ISO country
+// codes. An empty list does not restrict clients
+func NewScope(ranges, countries []string) (*Scope, error) {
+	scope := &Scope{}
+
+	for _, r := range ranges {
+		if ip := net.ParseIP(r); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			scope.ranges = append(scope.ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, errors.New(r + " is not a valid IP or CIDR range")
+		}
+		scope.ranges = append(scope.ranges, network)
+	}
+
+	for _, c := range countries {
+		if len(c) != 2 {
+			return nil, errors.New(c + " is not a valid country code")
+		}
+		scope.countries = append(scope.countries, strings.ToUpper(c))
+	}
+
+	return scope, nil
+}
+
+// Ranges gets the in-scope IP ranges. It is empty when clients are not restricted by IP
+func (s *Scope) Ranges() []*net.IPNet {
+	return s.ranges
+}
+
+// Violation gets the reason the client at remoteAddr is out of scope. An empty
+// reason means the client is in scope. Clients whose location cannot be
+// determined are out of scope
+func (s *Scope) Violation(remoteAddr string, gip geoip.DB) string {
+	if s == nil || (len(s.ranges) == 0 && len(s.countries) == 0) {
+		return ""
+	}
+
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ScopeViolationIP
+	}
+
+	if len(s.ranges) != 0 {
+		inRange := false
+		for _, r := range s.ranges {
+			if r.Contains(ip) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return ScopeViolationIP
+		}
+	}
+
+	if len(s.countries) != 0 {
+		if !gip.HasDB() {
+			return ScopeViolationCountry
+		}
+		cc, err := gip.CountryCode(ip)
+		if err != nil {
+			return ScopeViolationCountry
+		}
+		for _, c := range s.countries {
+			if strings.EqualFold(cc, c) {
+				return ""
+			}
+		}
+		return ScopeViolationCountry
+	}
+
+	return ""
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/t94j0/satellite/net/http"
+)
+
+// defaultLeaks match Go runtime output and strings which identify satellite
+var defaultLeaks = []string{
+	`goroutine \d+ \[[^\]]*\]:`,
+	`panic: [^\n]*`,
+	`runtime error: [^\n]*`,
+	`(?m)^\s*\S+\.go:\d+[^\n]*$`,
+	`(?i)satellite`,
+	`t94j0`,
+}
+
+// Scrubber removes Go runtime strings, internal paths, and satellite
+// identifiers from the pages satellite generates itself. Hosted and proxied
+// content is never scrubbed
+type Scrubber struct {
+	leaks []*regexp.Regexp
+}
+
+// NewScrubber creates a Scrubber which also removes each of the literal strings
+// in internal, such as the server root
+func NewScrubber(internal ...string) (*Scrubber, error) {
+	var s Scrubber
+	for _, l := range defaultLeaks {
+		re, err := regexp.Compile(l)
+		if err != nil {
+			return nil, err
+		}
+		s.leaks = append(s.leaks, re)
+	}
+
+	for _, l := range internal {
+		if l == "" || l == "/" || l == "." {
+			continue
+		}
+		s.leaks = append(s.leaks, regexp.MustCompile(regexp.QuoteMeta(l)))
+	}
+
+	return &s, nil
+}
+
+// Scrub removes all leaks from data
+func (s *Scrubber) Scrub(data []byte) []byte {
+	for _, re := range s.leaks {
+		data = re.ReplaceAll(data, nil)
+	}
+	return data
+}
+
+// Leaks returns true if data contains a leak
+func (s *Scrubber) Leaks(data []byte) bool {
+	for _, re := range s.leaks {
+		if re.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubHeaders removes headers whose values leak
+func (s *Scrubber) scrubHeaders(h http.Header) {
+	for name, values := range h {
+		for _, v := range values {
+			if s.Leaks([]byte(v)) {
+				h.Del(name)
+				break
+			}
+		}
+	}
+}
+
+// isText returns true for content types which are scrubbed. Binary payloads are
+// never modified
+func isText(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range []string{"text/", "json", "javascript", "xml"} {
+		if strings.Contains(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// scrubWriter buffers text responses so they can be scrubbed before they are sent.
+// Encoded and partial responses are sent as they are
+type scrubWriter struct {
+	http.ResponseWriter
+	scrubber *Scrubber
+	status   int
+	decided  bool
+	buffered bool
+	buf      bytes.Buffer
+}
+
+func newScrubWriter(w http.ResponseWriter, s *Scrubber) *scrubWriter {
+	return &scrubWriter{ResponseWriter: w, scrubber: s, status: http.StatusOK}
+}
+
+func (s *scrubWriter) WriteHeader(code int) {
+	if !s.decided {
+		s.status = code
+	}
+}
+
+// decide chooses whether the response is buffered based on its content type
+func (s *scrubWriter) decide(first []byte) {
+	s.decided = true
+	contentType := s.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(first)
+	}
+	s.buffered = isText(contentType) &&
+		s.Header().Get("Content-Encoding") == "" &&
+		s.Header().Get("Content-Range") == "" &&
+		s.status != http.StatusPartialContent
+	if !s.buffered {
+		s.scrubber.scrubHeaders(s.Header())
+		s.ResponseWriter.WriteHeader(s.status)
+	}
+}
+
+func (s *scrubWriter) Write(b []byte) (int, error) {
+	if !s.decided {
+		s.decide(b)
+	}
+	if s.buffered {
+		return s.buf.Write(b)
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// finish sends the scrubbed response
+func (s *scrubWriter) finish() {
+	if !s.decided {
+		s.decided = true
+		s.scrubber.scrubHeaders(s.Header())
+		s.ResponseWriter.WriteHeader(s.status)
+		return
+	}
+	if !s.buffered {
+		return
+	}
+
+	body := s.scrubber.Scrub(s.buf.Bytes())
+	s.scrubber.scrubHeaders(s.Header())
+	s.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	s.ResponseWriter.WriteHeader(s.status)
+	s.ResponseWriter.Write(body)
+}
+
+// Flush sends responses which are not buffered as they are written
+func (s *scrubWriter) Flush() {
+	if !s.decided || s.buffered {
+		return
+	}
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the underlying connection be taken over
+func (s *scrubWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		// Nothing is written to a hijacked connection
+		s.decided = true
+		s.buffered = false
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	. "github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+var leakFile = "<html>\n" +
+	"goroutine 1 [running]:\n" +
+	"main.main()\n" +
+	"\t/home/user/satellite/main.go:12 +0x20\n" +
+	"</html>\n"
+
+func assertNoLeaks(t *testing.T, td TempDir, w *httptest.ResponseRecorder) {
+	body := w.Body.String()
+	for _, leak := range []string{"goroutine", "main.go", "satellite", td.Path} {
+		if strings.Contains(body, leak) {
+			t.Errorf("response leaked %q: %s", leak, body)
+		}
+	}
+	for name, values := range w.Result().Header {
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(v), "satellite") {
+				t.Errorf("header %s leaked: %s", name, v)
+			}
+		}
+	}
+}
+
+func createScrubbedHandler(t *testing.T, td TempDir, nf util.NotFound) RootHandler {
+	paths, err := td.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrubber, err := NewScrubber(td.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRootHandler(paths, nf, "/index.html", "satellite").WithScrubber(scrubber)
+}
+
+func TestScrubber_Scrub(t *testing.T) {
+	scrubber, err := NewScrubber("/var/www/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(scrubber.Scrub([]byte("open /var/www/html/index.html: no such file\npanic: runtime error: index out of range")))
+	if strings.Contains(out, "/var/www/html") || strings.Contains(out, "panic") {
+		t.Error("unexpected output", out)
+	}
+}
+
+func TestRootHandler_ServeHTTP_scrub_hosted(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	content := leakFile + filepath.Join(td.Path, "index.html")
+	td.CreateFiles(map[string]string{
+		"/index.html": content,
+	})
+	handler := createScrubbedHandler(t, td, NoNotFound)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/index.html", nil))
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fail()
+	}
+	if w.Body.String() != content {
+		t.Error("hosted content should not be modified")
+	}
+	if w.Result().Header.Get("Server") != "" {
+		t.Error("leaking server header should not be sent")
+	}
+}
+
+func TestRootHandler_ServeHTTP_scrub_encoded(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Name = "satellite.html"
+	zw.Write([]byte(leakFile))
+	zw.Close()
+	td.CreateFiles(map[string]string{
+		"/error.html": gz.String(),
+		"/pathList.yml": "- path: /error.html\n" +
+			"  response_headers:\n" +
+			"    Content-Type: text/html\n" +
+			"    Content-Encoding: gzip\n",
+	})
+	handler := createScrubbedHandler(t, td, util.NotFound{Render: "/error.html"})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/abc", nil))
+
+	if w.Body.String() != gz.String() {
+		t.Error("encoded responses should not be modified")
+	}
+}
+
+func TestRootHandler_ServeHTTP_scrub_content_length(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/error.html": leakFile,
+	})
+	handler := createScrubbedHandler(t, td, util.NotFound{Render: "/error.html"})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/abc", nil))
+
+	assertNoLeaks(t, td, w)
+	if w.Result().Header.Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+		t.Error("unexpected content length", w.Result().Header.Get("Content-Length"), w.Body.Len())
+	}
+}
+
+func TestRootHandler_ServeHTTP_scrub_binary(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	payload := "MZ\x90\x00\x03satellite"
+	td.CreateFiles(map[string]string{
+		"/payload.exe": payload,
+	})
+	handler := createScrubbedHandler(t, td, NoNotFound)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/payload.exe", nil))
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if string(body) != payload {
+		t.Error("binary payloads should not be modified")
+	}
+}
+
+func TestRootHandler_ServeHTTP_scrub_errors(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/error.html": leakFile,
+	})
+
+	for _, nf := range []util.NotFound{NoNotFound, {Render: "/error.html"}, {Redirect: "/satellite"}} {
+		handler := createScrubbedHandler(t, td, nf).WithServerError("/error.html")
+
+		// Not found
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/abc", nil))
+		assertNoLeaks(t, td, w)
+
+		// Panic
+		req := httptest.NewRequest("GET", "/abc", nil)
+		req.URL = nil
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assertNoLeaks(t, td, w)
+	}
+}
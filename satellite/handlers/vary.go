@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// trailingSpace is the whitespace randomly appended to varied responses
+var trailingSpace = []string{"\n", "\r\n", " \n", "\t\n", "\n\n"}
+
+// Varier adds harmless random variation to decoy responses so the same decoy
+// does not have the same content hash on every redirector
+type Varier struct {
+	comments []string
+}
+
+// NewVarier creates a Varier which comments responses with one of comments,
+// or with a random token when comments is empty
+func NewVarier(comments []string) (*Varier, error) {
+	for _, c := range comments {
+		if strings.Contains(c, "--") || strings.Contains(c, "*/") || strings.ContainsAny(c, "\r\n") {
+			return nil, errors.New(fmt.Sprintf("%s is not a valid decoy comment", c))
+		}
+	}
+	return &Varier{comments: comments}, nil
+}
+
+// Vary returns data with a random comment and trailing whitespace. Only the
+// comment syntax of contentType is used, so the rendered content is unchanged
+func (v *Varier) Vary(data []byte, contentType string) []byte {
+	contentType = strings.ToLower(contentType)
+	out := make([]byte, 0, len(data)+64)
+
+	switch {
+	case strings.Contains(contentType, "html"):
+		comment := []byte("<!-- " + v.comment() + " -->")
+		if i := bytes.LastIndex(bytes.ToLower(data), []byte("</body>")); i != -1 {
+			out = append(out, data[:i]...)
+			out = append(out, comment...)
+			out = append(out, data[i:]...)
+		} else {
+			out = append(append(out, data...), comment...)
+		}
+	case strings.Contains(contentType, "xml"):
+		out = append(append(out, data...), "\n<!-- "+v.comment()+" -->"...)
+	case strings.Contains(contentType, "css"), strings.Contains(contentType, "javascript"):
+		out = append(append(out, data...), "\n/* "+v.comment()+" */"...)
+	default:
+		out = append(out, data...)
+	}
+
+	return append(out, trailingSpace[randIntn(len(trailingSpace))]...)
+}
+
+// comment picks the text of the comment added to a response
+func (v *Varier) comment() string {
+	if len(v.comments) > 0 {
+		return v.comments[randIntn(len(v.comments))]
+	}
+	token := make([]byte, 4+randIntn(12))
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+func randIntn(n int) int {
+	var b [2]byte
+	rand.Read(b[:])
+	return (int(b[0])<<8 | int(b[1])) % n
+}
+
+// varyWriter buffers a decoy response so it can be varied before it is sent
+type varyWriter struct {
+	http.ResponseWriter
+	varier *Varier
+	status int
+	buf    bytes.Buffer
+}
+
+func newVaryWriter(w http.ResponseWriter, v *Varier) *varyWriter {
+	return &varyWriter{ResponseWriter: w, varier: v, status: http.StatusOK}
+}
+
+func (v *varyWriter) WriteHeader(code int) {
+	v.status = code
+}
+
+func (v *varyWriter) Write(b []byte) (int, error) {
+	return v.buf.Write(b)
+}
+
+// finish sends the varied response. Empty, partial, and binary responses are
+// sent as they are
+func (v *varyWriter) finish() {
+	body := v.buf.Bytes()
+	contentType := v.Header().Get("Content-Type")
+	if contentType == "" && len(body) > 0 {
+		contentType = http.DetectContentType(body)
+	}
+	if len(body) > 0 && v.status != http.StatusPartialContent && isText(contentType) {
+		body = v.varier.Vary(body, contentType)
+		if v.Header().Get("Content-Length") != "" {
+			v.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	v.ResponseWriter.WriteHeader(v.status)
+	v.ResponseWriter.Write(body)
+}
@@ -0,0 +1,78 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	. "github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+func TestVarier_Vary(t *testing.T) {
+	varier, err := NewVarier([]string{"cache"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(varier.Vary([]byte("<html><body>Not Found</body></html>"), "text/html; charset=utf-8"))
+	if !strings.HasPrefix(out, "<html><body>Not Found<!-- cache --></body></html>") {
+		t.Error("unexpected output", out)
+	}
+
+	out = string(varier.Vary([]byte("body {}"), "text/css"))
+	if !strings.HasPrefix(out, "body {}\n/* cache */") {
+		t.Error("unexpected output", out)
+	}
+}
+
+func TestNewVarier_invalid(t *testing.T) {
+	for _, c := range []string{"a -- b", "*/", "a\nb"} {
+		if _, err := NewVarier([]string{c}); err == nil {
+			t.Errorf("%q was valid", c)
+		}
+	}
+}
+
+func TestRootHandler_ServeHTTP_vary(t *testing.T) {
+	td, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer td.Close()
+	td.CreateFiles(map[string]string{
+		"/404.html":    "<html><body>Not Found</body></html>",
+		"/payload.exe": "MZ\x90\x00\x03",
+	})
+	paths, err := td.Paths()
+	if err != nil {
+		t.Fatal(err)
+	}
+	varier, err := NewVarier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRootHandler(paths, util.NotFound{Render: "/404.html"}, "/index.html", "Server").WithVarier(varier)
+
+	request := func(uri string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		return w
+	}
+
+	first, second := request("/abc"), request("/abc")
+	if first.Body.String() == second.Body.String() {
+		t.Error("decoy responses were identical")
+	}
+	if !strings.Contains(first.Body.String(), "Not Found") || first.Result().StatusCode != http.StatusOK {
+		t.Error("unexpected decoy", first.Body.String())
+	}
+	if cl := first.Result().ContentLength; cl != -1 && cl != int64(first.Body.Len()) {
+		t.Error("Content-Length does not match the varied body")
+	}
+
+	if w := request("/payload.exe"); w.Body.String() != "MZ\x90\x00\x03" {
+		t.Error("served files should not be varied")
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"github.com/gobwas/glob"
+	"github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+// VirtualHost serves the hosts it matches from its own paths and not_found
+// handler, so one instance can serve domains with isolated content trees
+type VirtualHost struct {
+	hosts        []glob.Glob
+	paths        *path.Paths
+	notFound     util.NotFound
+	defaultIndex string
+}
+
+// NewVirtualHost creates a VirtualHost serving ps for a list of host globs
+func NewVirtualHost(hosts []string, ps *path.Paths, notFound util.NotFound, defaultIndex string) (VirtualHost, error) {
+	globs, err := compileHosts(hosts)
+	if err != nil {
+		return VirtualHost{}, err
+	}
+	return VirtualHost{
+		hosts:        globs,
+		paths:        ps,
+		notFound:     notFound,
+		defaultIndex: defaultIndex,
+	}, nil
+}
+
+// Match returns true if the virtual host serves host. The port is ignored
+func (v VirtualHost) Match(host string) bool {
+	return matchHost(v.hosts, host)
+}
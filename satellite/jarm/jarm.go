@@ -0,0 +1,420 @@
+// Package jarm actively fingerprints TLS servers with the JARM method. Ten
+// crafted client hellos are sent and the server hellos are hashed into a 62
+// character fingerprint
+package jarm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Empty is the fingerprint of a host which did not answer any probe
+var Empty = strings.Repeat("0", 62)
+
+// probe describes one client hello
+type probe struct {
+	version        string
+	ciphers        string
+	cipherOrder    string
+	grease         bool
+	rareALPN       bool
+	support        string
+	extensionOrder string
+}
+
+var probes = []probe{
+	{"TLS_1.2", "ALL", "FORWARD", false, false, "1.2_SUPPORT", "REVERSE"},
+	{"TLS_1.2", "ALL", "REVERSE", false, false, "1.2_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "TOP_HALF", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "BOTTOM_HALF", false, true, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "MIDDLE_OUT", true, true, "NO_SUPPORT", "REVERSE"},
+	{"TLS_1.1", "ALL", "FORWARD", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "FORWARD", false, false, "1.3_SUPPORT", "REVERSE"},
+	{"TLS_1.3", "ALL", "REVERSE", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "NO1.3", "FORWARD", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "MIDDLE_OUT", true, false, "1.3_SUPPORT", "REVERSE"},
+}
+
+// allCiphers are offered by every probe except the invalid TLS 1.3 probe
+var allCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3,
+	0x009f, 0x0045, 0x00be, 0x0088, 0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac,
+	0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072, 0xc073, 0xcca9,
+	0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028,
+	0xc030, 0xc060, 0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13,
+	0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0, 0x009c, 0x0035, 0x003d, 0xc09d,
+	0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// hashCiphers orders the ciphers in the fuzzy part of the fingerprint
+var hashCiphers = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c,
+	0x003d, 0x0041, 0x0045, 0x0067, 0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d,
+	0x009e, 0x009f, 0x00ba, 0x00be, 0x00c0, 0x00c4, 0xc007, 0xc008, 0xc009, 0xc00a,
+	0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c,
+	0xc02f, 0xc030, 0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077, 0xc09c, 0xc09d,
+	0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3, 0xc0ac, 0xc0ad, 0xc0ae, 0xc0af,
+	0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+var alpns = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+
+var rareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+
+// Fingerprint probes the TLS server at host:port. Each probe waits up to timeout
+func Fingerprint(host, port string, timeout time.Duration) string {
+	results := make([]string, 0, len(probes))
+	for _, p := range probes {
+		hello, err := send(host, port, p.clientHello(host), timeout)
+		if err != nil {
+			return Empty
+		}
+		results = append(results, readServerHello(hello))
+	}
+	return Hash(results)
+}
+
+// send sends a client hello and reads the start of the response
+func send(host, port string, hello []byte, timeout time.Duration) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(hello); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1484)
+	n := 0
+	for n < len(buf) {
+		read, err := conn.Read(buf[n:])
+		n += read
+		if err != nil {
+			break
+		}
+		// Stop once the first record has arrived
+		if n >= 5 && n >= 5+int(binary.BigEndian.Uint16(buf[3:5])) {
+			break
+		}
+	}
+	return buf[:n], nil
+}
+
+// Hash creates the fingerprint from the results of each probe
+func Hash(results []string) string {
+	empty := true
+	for _, r := range results {
+		if r != "|||" {
+			empty = false
+		}
+	}
+	if empty {
+		return Empty
+	}
+
+	var fuzzy, alpnsAndExtensions strings.Builder
+	for _, r := range results {
+		components := strings.Split(r, "|")
+		for len(components) < 4 {
+			components = append(components, "")
+		}
+		fuzzy.WriteString(cipherByte(components[0]))
+		fuzzy.WriteString(versionByte(components[1]))
+		alpnsAndExtensions.WriteString(components[2])
+		alpnsAndExtensions.WriteString(components[3])
+	}
+
+	sum := sha256.Sum256([]byte(alpnsAndExtensions.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+func cipherByte(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	count := 1
+	for _, c := range hashCiphers {
+		if fmt.Sprintf("%04x", c) == cipher {
+			break
+		}
+		count++
+	}
+	return fmt.Sprintf("%02x", count)
+}
+
+func versionByte(version string) string {
+	if len(version) < 4 || version[3] < '0' || version[3] > '5' {
+		return "0"
+	}
+	return string("abcdef"[version[3]-'0'])
+}
+
+// mung reorders a list the way a probe asks for
+func mung(n int, order string) []int {
+	forward := make([]int, n)
+	for i := range forward {
+		forward[i] = i
+	}
+
+	switch order {
+	case "REVERSE":
+		reverse := make([]int, n)
+		for i := range forward {
+			reverse[i] = forward[n-1-i]
+		}
+		return reverse
+	case "BOTTOM_HALF":
+		if n%2 == 1 {
+			return forward[n/2+1:]
+		}
+		return forward[n/2:]
+	case "TOP_HALF":
+		out := make([]int, 0, n/2+1)
+		if n%2 == 1 {
+			out = append(out, n/2)
+		}
+		reverse := mung(n, "REVERSE")
+		for _, i := range mung(n, "BOTTOM_HALF") {
+			out = append(out, reverse[i])
+		}
+		return out
+	case "MIDDLE_OUT":
+		middle := n / 2
+		out := make([]int, 0, n)
+		if n%2 == 1 {
+			out = append(out, middle)
+			for i := 1; i <= middle; i++ {
+				out = append(out, middle+i, middle-i)
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, middle-1+i, middle-i)
+			}
+		}
+		return out
+	}
+	return forward
+}
+
+func grease() []byte {
+	b := make([]byte, 1)
+	rand.Read(b)
+	g := 0x0a + (b[0]%16)<<4
+	return []byte{g, g}
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func putUint16(b *bytes.Buffer, v int) {
+	b.WriteByte(byte(v >> 8))
+	b.WriteByte(byte(v))
+}
+
+// clientHello builds the TLS record for the probe
+func (p probe) clientHello(host string) []byte {
+	recordVersion, helloVersion := []byte{0x03, 0x03}, []byte{0x03, 0x03}
+	switch p.version {
+	case "TLS_1.3":
+		recordVersion = []byte{0x03, 0x01}
+	case "TLS_1.1":
+		recordVersion, helloVersion = []byte{0x03, 0x02}, []byte{0x03, 0x02}
+	}
+
+	var hello bytes.Buffer
+	hello.Write(helloVersion)
+	hello.Write(random(32))
+	hello.WriteByte(32)
+	hello.Write(random(32))
+
+	ciphers := p.cipherSuites()
+	putUint16(&hello, len(ciphers))
+	hello.Write(ciphers)
+	// One compression method, null
+	hello.Write([]byte{0x01, 0x00})
+	hello.Write(p.extensions(host))
+
+	var handshake bytes.Buffer
+	handshake.WriteByte(0x01)
+	handshake.WriteByte(0x00)
+	putUint16(&handshake, hello.Len())
+	handshake.Write(hello.Bytes())
+
+	var record bytes.Buffer
+	record.WriteByte(0x16)
+	record.Write(recordVersion)
+	putUint16(&record, handshake.Len())
+	record.Write(handshake.Bytes())
+	return record.Bytes()
+}
+
+func (p probe) cipherSuites() []byte {
+	list := make([]uint16, 0, len(allCiphers))
+	for _, c := range allCiphers {
+		if p.ciphers == "NO1.3" && c>>8 == 0x13 {
+			continue
+		}
+		list = append(list, c)
+	}
+
+	var out bytes.Buffer
+	if p.grease {
+		out.Write(grease())
+	}
+	for _, i := range mung(len(list), p.cipherOrder) {
+		putUint16(&out, int(list[i]))
+	}
+	return out.Bytes()
+}
+
+func (p probe) extensions(host string) []byte {
+	var ext bytes.Buffer
+	if p.grease {
+		ext.Write(grease())
+		ext.Write([]byte{0x00, 0x00})
+	}
+
+	// Server name
+	ext.Write([]byte{0x00, 0x00})
+	putUint16(&ext, len(host)+5)
+	putUint16(&ext, len(host)+3)
+	ext.WriteByte(0x00)
+	putUint16(&ext, len(host))
+	ext.WriteString(host)
+
+	// Extended master secret, max fragment length, renegotiation info,
+	// supported groups, EC point formats, and session ticket
+	ext.Write([]byte{0x00, 0x17, 0x00, 0x00})
+	ext.Write([]byte{0x00, 0x01, 0x00, 0x01, 0x01})
+	ext.Write([]byte{0xff, 0x01, 0x00, 0x01, 0x00})
+	ext.Write([]byte{0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19})
+	ext.Write([]byte{0x00, 0x0b, 0x00, 0x02, 0x01, 0x00})
+	ext.Write([]byte{0x00, 0x23, 0x00, 0x00})
+
+	// Application layer protocol negotiation
+	protocols := alpns
+	if p.rareALPN {
+		protocols = rareALPNs
+	}
+	var alpn bytes.Buffer
+	for _, i := range mung(len(protocols), p.extensionOrder) {
+		alpn.WriteByte(byte(len(protocols[i])))
+		alpn.WriteString(protocols[i])
+	}
+	ext.Write([]byte{0x00, 0x10})
+	putUint16(&ext, alpn.Len()+2)
+	putUint16(&ext, alpn.Len())
+	ext.Write(alpn.Bytes())
+
+	// Signature algorithms
+	ext.Write([]byte{0x00, 0x0d, 0x00, 0x14, 0x00, 0x12, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01})
+
+	// Key share
+	var share bytes.Buffer
+	if p.grease {
+		share.Write(grease())
+		share.Write([]byte{0x00, 0x01, 0x00})
+	}
+	share.Write([]byte{0x00, 0x1d, 0x00, 0x20})
+	share.Write(random(32))
+	ext.Write([]byte{0x00, 0x33})
+	putUint16(&ext, share.Len()+2)
+	putUint16(&ext, share.Len())
+	ext.Write(share.Bytes())
+
+	// PSK key exchange modes
+	ext.Write([]byte{0x00, 0x2d, 0x00, 0x02, 0x01, 0x01})
+
+	// Supported versions
+	if p.version == "TLS_1.3" || p.support == "1.2_SUPPORT" {
+		versions := []uint16{0x0301, 0x0302, 0x0303}
+		if p.support != "1.2_SUPPORT" {
+			versions = append(versions, 0x0304)
+		}
+		var list bytes.Buffer
+		if p.grease {
+			list.Write(grease())
+		}
+		for _, i := range mung(len(versions), p.extensionOrder) {
+			putUint16(&list, int(versions[i]))
+		}
+		ext.Write([]byte{0x00, 0x2b})
+		putUint16(&ext, list.Len()+1)
+		ext.WriteByte(byte(list.Len()))
+		ext.Write(list.Bytes())
+	}
+
+	var out bytes.Buffer
+	putUint16(&out, ext.Len())
+	out.Write(ext.Bytes())
+	return out.Bytes()
+}
+
+// readServerHello formats a server hello as cipher|version|alpn|extensions
+func readServerHello(data []byte) (result string) {
+	// Malformed responses are treated like no response
+	defer func() {
+		if recover() != nil {
+			result = "|||"
+		}
+	}()
+
+	if len(data) < 6 || data[0] != 0x16 || data[5] != 0x02 {
+		return "|||"
+	}
+
+	length := int(binary.BigEndian.Uint16(data[3:5]))
+	counter := int(data[43])
+	cipher := hex.EncodeToString(data[counter+44 : counter+46])
+	version := hex.EncodeToString(data[9:11])
+	return cipher + "|" + version + "|" + readExtensions(data, counter, length)
+}
+
+// readExtensions formats the server hello extensions as alpn|types
+func readExtensions(data []byte, counter, length int) (result string) {
+	defer func() {
+		if recover() != nil {
+			result = "|"
+		}
+	}()
+
+	if data[counter+47] == 11 {
+		return "|"
+	}
+	if bytes.Equal(data[counter+50:counter+53], []byte{0x0e, 0xac, 0x0b}) || bytes.Equal(data[82:85], []byte{0x0f, 0xf0, 0x0b}) {
+		return "|"
+	}
+	if counter+42 >= length {
+		return "|"
+	}
+
+	count := 49 + counter
+	maximum := int(binary.BigEndian.Uint16(data[counter+47:counter+49])) + count - 1
+	types := make([]string, 0)
+	alpn := ""
+	for count < maximum {
+		extType := hex.EncodeToString(data[count : count+2])
+		extLength := int(binary.BigEndian.Uint16(data[count+2 : count+4]))
+		value := data[count+4 : count+4+extLength]
+		if extType == "0010" && alpn == "" && len(value) > 3 {
+			alpn = string(value[3:])
+		}
+		types = append(types, extType)
+		count += extLength + 4
+	}
+
+	return alpn + "|" + strings.Join(types, "-")
+}
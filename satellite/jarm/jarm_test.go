@@ -0,0 +1,65 @@
+package jarm_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/jarm"
+)
+
+func TestFingerprint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := Fingerprint(host, port, time.Second)
+	if len(fingerprint) != 62 {
+		t.Errorf("fingerprint %s is not 62 characters", fingerprint)
+	}
+	if fingerprint == Empty {
+		t.Error("TLS server did not answer any probe")
+	}
+
+	if again := Fingerprint(host, port, time.Second); again != fingerprint {
+		t.Errorf("fingerprint changed from %s to %s", fingerprint, again)
+	}
+}
+
+func TestFingerprint_closed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	if fingerprint := Fingerprint(host, port, time.Second); fingerprint != Empty {
+		t.Errorf("closed port has fingerprint %s", fingerprint)
+	}
+}
+
+func TestHash_empty(t *testing.T) {
+	results := strings.Split(strings.Repeat("|||,", 9)+"|||", ",")
+	if Hash(results) != Empty {
+		t.Fail()
+	}
+}
+
+func TestHash(t *testing.T) {
+	results := strings.Split(strings.Repeat("c02f|0303|h2|ff01-0000-0010,", 9)+"|||", ",")
+	hash := Hash(results)
+	if !strings.HasPrefix(hash, strings.Repeat("29d", 9)+"000") {
+		t.Errorf("unexpected fuzzy hash %s", hash)
+	}
+	if len(hash) != 62 {
+		t.Errorf("hash %s is not 62 characters", hash)
+	}
+}
@@ -0,0 +1,377 @@
+// Package logfile writes logs to files which are rotated by size and age,
+// compressed, and pruned so they do not fill the disk
+package logfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxSizeMB is the size a log grows to before it is rotated when max_size_mb is not set
+const DefaultMaxSizeMB = 100
+
+// DefaultMaxFiles is the number of rotated logs kept when max_files is not set
+const DefaultMaxFiles = 5
+
+// timeFormat is appended to the name of rotated logs. It sorts in the order logs were rotated
+const timeFormat = "20060102T150405.000"
+
+// Config is how a log file is rotated
+type Config struct {
+	// MaxSizeMB is the size in megabytes a log grows to before it is rotated. Defaults to 100
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxAge is how long a log is written to before it is rotated, like 24h. Logs are only rotated by size when not set
+	MaxAge string `mapstructure:"max_age"`
+	// MaxFiles is the number of rotated logs kept. Defaults to 5
+	MaxFiles int `mapstructure:"max_files"`
+	// Compress gzips rotated logs
+	Compress bool `mapstructure:"compress"`
+}
+
+// Validate checks the sizes and age are usable
+func (c Config) Validate() error {
+	if c.MaxSizeMB < 0 {
+		return fmt.Errorf("max_size_mb: expected a positive number, got %d", c.MaxSizeMB)
+	}
+	if c.MaxFiles < 0 {
+		return fmt.Errorf("max_files: expected a positive number, got %d", c.MaxFiles)
+	}
+	if c.MaxAge != "" {
+		if age, err := time.ParseDuration(c.MaxAge); err != nil || age < time.Minute {
+			return fmt.Errorf("max_age: expected a duration of at least 1m, got %q", c.MaxAge)
+		}
+	}
+	return nil
+}
+
+// File is a log file which is rotated when it grows past its maximum size or age
+type File struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	// wg waits for rotated logs to be compressed and pruned, which bg does one rotation at a time
+	wg sync.WaitGroup
+	bg sync.Mutex
+}
+
+// Open opens the log at path for appending, creating it and its directory if needed
+func Open(path string, config Config) (*File, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	f := &File{
+		path:     path,
+		maxSize:  int64(config.MaxSizeMB) << 20,
+		maxFiles: config.MaxFiles,
+		compress: config.Compress,
+	}
+	if f.maxSize == 0 {
+		f.maxSize = DefaultMaxSizeMB << 20
+	}
+	if f.maxFiles == 0 {
+		f.maxFiles = DefaultMaxFiles
+	}
+	if config.MaxAge != "" {
+		f.maxAge, _ = time.ParseDuration(config.MaxAge)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to open log")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the log, rotating it first if p would take it past its
+// maximum size or the log is older than its maximum age
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.opened) >= f.maxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the log aside and starts a new one
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	rotated := f.path + "." + time.Now().UTC().Format(timeFormat)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return errors.Wrap(err, "unable to rotate log")
+	}
+	if err := f.open(); err != nil {
+		f.file = nil
+		return err
+	}
+
+	// Compressing a large log takes a while, so it is done without holding up writes
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.bg.Lock()
+		defer f.bg.Unlock()
+		if f.compress {
+			compress(rotated)
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// Close waits for rotated logs to be compressed and closes the log
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wg.Wait()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Rotated gets the paths of the rotated logs from oldest to newest
+func (f *File) Rotated() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	rotated := make([]string, 0, len(matches))
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, f.path+"."), ".gz")
+		if _, err := time.Parse(timeFormat, stamp); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// prune removes the oldest rotated logs past the maximum number of files
+func (f *File) prune() error {
+	rotated, err := f.Rotated()
+	if err != nil {
+		return err
+	}
+	for len(rotated) > f.maxFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// Purge removes the rotated logs whose newest line was written before cutoff,
+// which is when they were rotated. It returns the number of logs removed
+func (f *File) Purge(cutoff time.Time) (int, error) {
+	f.bg.Lock()
+	defer f.bg.Unlock()
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, r := range rotated {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(r, f.path+"."), ".gz")
+		if t, err := time.Parse(timeFormat, stamp); err != nil || !t.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(r); err != nil && !os.IsNotExist(err) {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Filter rewrites the log and its rotated logs without the lines drop returns true
+// for. Dropped lines are written to w, oldest first, when it is not nil. It
+// returns the number of lines dropped
+func (f *File) Filter(drop func(line []byte) bool, w io.Writer) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bg.Lock()
+	defer f.bg.Unlock()
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for _, r := range rotated {
+		n, err := filter(r, drop, w)
+		dropped += n
+		if err != nil {
+			return dropped, err
+		}
+	}
+
+	if f.file == nil {
+		return dropped, os.ErrClosed
+	}
+	if err := f.file.Close(); err != nil {
+		return dropped, err
+	}
+	n, err := filter(f.path, drop, w)
+	dropped += n
+	if openErr := f.open(); openErr != nil {
+		f.file = nil
+		return dropped, openErr
+	}
+	return dropped, err
+}
+
+// filter rewrites the log at path, which may be gzipped, without the lines drop
+// returns true for, writing them to w. The log is replaced only when lines are dropped
+func filter(path string, drop func(line []byte) bool, w io.Writer) (int, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	var r io.Reader = src
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			return 0, err
+		}
+		r = zr
+	}
+
+	var kept, removed bytes.Buffer
+	dropped := 0
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if drop(bytes.TrimSuffix(line, []byte("\n"))) {
+				removed.Write(line)
+				dropped++
+			} else {
+				kept.Write(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	var out io.WriteCloser = dst
+	if strings.HasSuffix(path, ".gz") {
+		out = gzip.NewWriter(dst)
+	}
+	_, err = kept.WriteTo(out)
+	if err == nil && out != dst {
+		err = out.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	if w != nil {
+		if _, err := removed.WriteTo(w); err != nil {
+			return dropped, err
+		}
+	}
+	return dropped, nil
+}
+
+// compress gzips the log at path and removes the uncompressed log
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
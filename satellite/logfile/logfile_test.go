@@ -0,0 +1,195 @@
+package logfile_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/logfile"
+)
+
+func TestFile_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellite-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "satellite.log")
+	f, err := Open(path, Config{MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		// Rotated logs are named by the millisecond
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated logs, got %v", rotated)
+	}
+	if !strings.HasSuffix(rotated[1], ".gz") {
+		t.Fatalf("rotated log %s was not compressed", rotated[1])
+	}
+
+	gz, err := os.Open(rotated[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "fourth\n" {
+		t.Errorf("expected newest rotated log to hold fourth, got %q", content)
+	}
+}
+
+func TestFile_Write_max_size(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellite-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hits.json")
+	f, err := Open(path, Config{MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("a", 1023) + "\n")
+	for i := 0; i < 1025; i++ {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _ := f.Rotated()
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 rotated log, got %v", rotated)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(line)) {
+		t.Errorf("expected the new log to hold one line, got %d bytes", info.Size())
+	}
+}
+
+func TestFile_Purge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellite-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hits.json")
+	f, err := Open(path, Config{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("old\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	f.Write([]byte("new\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := f.Purge(cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged log, got %d", purged)
+	}
+	if rotated, _ := f.Rotated(); len(rotated) != 1 {
+		t.Errorf("expected the newer rotated log to be kept, got %v", rotated)
+	}
+}
+
+func TestFile_Filter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satellite-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hits.json")
+	f, err := Open(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("drop 1\nkeep 1\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("keep 2\ndrop 2\n"))
+
+	var dropped strings.Builder
+	n, err := f.Filter(func(line []byte) bool {
+		return strings.HasPrefix(string(line), "drop")
+	}, &dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || dropped.String() != "drop 1\ndrop 2\n" {
+		t.Errorf("unexpected dropped lines %d %q", n, dropped.String())
+	}
+
+	// The log is still written to after it is filtered
+	f.Write([]byte("keep 3\n"))
+	if data, _ := ioutil.ReadFile(path); string(data) != "keep 2\nkeep 3\n" {
+		t.Errorf("unexpected log %q", data)
+	}
+	rotated, _ := f.Rotated()
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 rotated log, got %v", rotated)
+	}
+	if data, _ := ioutil.ReadFile(rotated[0]); string(data) != "keep 1\n" {
+		t.Errorf("unexpected rotated log %q", data)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := (Config{MaxAge: "1s"}).Validate(); err == nil {
+		t.Error("max_age shorter than a minute was accepted")
+	}
+	if err := (Config{MaxFiles: -1}).Validate(); err == nil {
+		t.Error("negative max_files was accepted")
+	}
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"os"
 	"path"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/acme"
+	"github.com/t94j0/satellite/satellite/assets"
+	"github.com/t94j0/satellite/satellite/blocklist"
+	"github.com/t94j0/satellite/satellite/certs"
+	"github.com/t94j0/satellite/satellite/decoy"
+	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/logfile"
+	"github.com/t94j0/satellite/satellite/management"
+	"github.com/t94j0/satellite/satellite/metrics"
 	sPath "github.com/t94j0/satellite/satellite/path"
 	"github.com/t94j0/satellite/satellite/server"
 	"github.com/t94j0/satellite/satellite/util"
@@ -14,6 +27,9 @@ import (
 // ProjectName is the current project name
 const ProjectName string = "satellite"
 
+// Version is the satellite version. It is set at build time with -ldflags "-X main.Version=v1.0.0"
+var Version = "dev"
+
 func main() {
 	log.SetLevel(log.DebugLevel)
 
@@ -22,70 +38,210 @@ func main() {
 		log.Fatal(err)
 	}
 
-	serverRoot := config.GetString("server_root")
-	listen := config.GetString("listen")
-	certPath := config.GetString("ssl.cert")
-	keyPath := config.GetString("ssl.key")
-	serverHeader := config.GetString("server_header")
-	notFoundRedirect := config.GetString("not_found.redirect")
-	notFoundRender := config.GetString("not_found.render")
-	indexPath := config.GetString("index")
-	redirectHTTP := config.GetBool("redirect_http")
-	logLevel := config.GetString("log_level")
-	geoipPath := config.GetString("geoip_path")
-
-	logOptions := map[string]log.Level{
-		"":      log.DebugLevel,
-		"panic": log.PanicLevel,
-		"fatal": log.FatalLevel,
-		"error": log.ErrorLevel,
-		"warn":  log.WarnLevel,
-		"info":  log.InfoLevel,
-		"debug": log.DebugLevel,
-		"trace": log.TraceLevel,
+	if len(os.Args) > 1 {
+		if err := runCommand(config, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	log.SetLevel(logOptions[logLevel])
+	serverRoot := config.ServerRoot
+	configDir := path.Dir(config.ConfigFileUsed())
+
+	log.SetLevel(logLevels[config.LogLevel])
+	// logs are the rotated logs purged with the rest of the collected data
+	var logs []*logfile.File
+	if config.Log.File != "" {
+		logFile, err := logfile.Open(config.Log.File, config.Log.Rotate)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "log.file configuration error"))
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+		logs = append(logs, logFile)
+	}
 
 	log.Debugf("Using config file %s", config.ConfigFileUsed())
 	log.Debugf("Using server path %s", serverRoot)
 
 	// Set up global conditions directory
-	configDir := path.Dir(config.ConfigFileUsed())
 	gcp := path.Join(configDir, "conditions")
 	paths, err := sPath.NewDefault(serverRoot, gcp)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := paths.AddGeoIP(geoipPath); err != nil {
+	vhosts, vhostPaths, err := virtualHosts(config, gcp)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "virtual_hosts configuration error"))
+	}
+	all := append(pathSet{paths}, vhostPaths...)
+
+	global, err := config.Conditions()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "global_conditions configuration error"))
+	}
+	all.SetGlobalConditions(global)
+	if err := all.SetResponseHeaders(config.ResponseHeaders); err != nil {
+		log.Fatal(errors.Wrap(err, "response_headers configuration error"))
+	}
+
+	if config.GeoIP.LicenseKey != "" {
+		updater := geoip.NewUpdater(config.GeoIP.AccountID, config.GeoIP.LicenseKey)
+		downloadGeoIP(updater, config)
+		go refreshGeoIP(updater, config, all)
+	}
+	if err := all.AddGeoIP(config.GeoIPPath); err != nil {
 		log.Warn("Unable to access geoip_path. Geo to IP functionality disabled.")
 	}
+	all.SetCountryGroups(config.CountryGroups)
+	if config.ASNPath != "" {
+		if err := all.AddASN(config.ASNPath); err != nil {
+			log.Warn("Unable to access asn_path. ASN functionality disabled.")
+		}
+	}
+
+	fetcher := blocklist.NewFetcher()
+	if len(config.Blocklists.Feeds) != 0 {
+		fetchBlocklists(fetcher, config, all)
+		go refreshBlocklists(fetcher, config, all)
+	}
+	if !config.HostingProviders.Disabled {
+		go refreshHostingProviders(fetcher, config, all)
+	}
+	if !config.Tor.Disabled {
+		go refreshTorExits(fetcher, config, all)
+	}
+	campaigns, err := sPath.NewCampaigns(config.Campaigns)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "campaigns configuration error"))
+	}
+	all.SetCampaigns(campaigns)
+	if config.Forward.Enabled() {
+		forwarder, err := sPath.NewForwarder(config.Forward)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "forward configuration error"))
+		}
+		all.SetForwarder(forwarder)
+	}
+
+	if config.Log.Journal != "" {
+		journal, err := logfile.Open(config.Log.Journal, config.Log.Rotate)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "log.journal configuration error"))
+		}
+		defer journal.Close()
+		all.SetJournal(journal)
+		logs = append(logs, journal)
+	}
+	if config.Retention.Days > 0 || len(config.Retention.Campaigns) != 0 {
+		go purgeRetention(config, all, logs)
+	}
+
+	all.OnStateUnavailable(stateAlert(config))
 
 	log.Debugf("Loaded %d path(s)", paths.Len())
 
-	// Listen for when files in serverRoot change
-	go func() {
-		if err := createWatcher(serverRoot, "1s", func() error {
-			return paths.Reload()
-		}); err != nil {
+	// Check the dependencies of the conditions before serving
+	if !config.SelfTest.Disabled {
+		if err := reportSelfTest(selfTest(config, all)); err != nil && config.SelfTest.Strict {
 			log.Fatal(err)
 		}
-	}()
+	}
+
+	// Listen for when files in serverRoot change
+	go watchPaths(serverRoot, paths)
+
+	// Keep cloned decoys fresh
+	refresher := decoy.NewRefresher(serverRoot)
+	for _, source := range config.DecoyRefresh {
+		go refresher.Run(source)
+	}
 
 	// NotFound information
-	nf, err := util.NewNotFound(notFoundRedirect, notFoundRender)
+	nf, err := util.NewNotFound(config.NotFound.Redirect, config.NotFound.Render)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if nf.ShouldWarn() {
+	if nf.ShouldWarn() && config.Persona == "" {
 		log.Warn("Use not_found handlers for opsec")
 	}
 
-	// Build SSL Key object
-	ssl, err := server.NewSSL(keyPath, certPath)
+	// Maintenance mode
+	maintenance, err := util.NewMaintenance(
+		config.Maintenance.Enabled,
+		config.Maintenance.Status,
+		config.Maintenance.Render,
+		config.Maintenance.RetryAfter,
+		config.Maintenance.Schedule,
+	)
 	if err != nil {
+		log.Fatal(errors.Wrap(err, "maintenance configuration error"))
+	}
+
+	// Served certificates are added to the tracker once they are loaded
+	warn, err := time.ParseDuration(config.Certificates.Warn)
+	if err != nil {
+		warn = certs.DefaultWarn
+	}
+	tracker := certs.NewTracker(warn)
+
+	// Management API
+	restart := make(chan struct{}, 1)
+	if config.Management.Listen != "" {
+		mgmt, err := management.NewOIDC(config.Management.Listen, config.Management.Token, config.Management.OIDC)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mgmt.Handle("/maintenance", management.MaintenanceHandler(maintenance))
+		mgmt.Handle("/metrics", metrics.Default)
+		mgmt.Handle("/approvals", management.ApprovalsHandler(paths.Approvals()))
+		mgmt.Handle("/captures", management.CapturesHandler(paths.Captures()))
+		mgmt.Handle("/hits", management.HitsHandler(paths.Hits()))
+		mgmt.Handle("/hits/series", management.HitSeriesHandler(paths))
+		mgmt.Handle("/timeline", management.TimelineHandler(paths))
+		mgmt.Handle("/profiles", management.ProfilesHandler(paths))
+		mgmt.Handle("/profiles/promoted", management.PromotedHandler(paths))
+		mgmt.Handle("/schema", management.SchemaHandler())
+		mgmt.Handle("/certificates", management.CertificatesHandler(tracker))
+		mgmt.Handle("/campaigns", management.CampaignsHandler(campaigns))
+		mgmt.Handle("/campaigns/archive", management.CampaignArchiveHandler(paths))
+		mgmt.Handle("/paths/reload", management.ReloadPathHandler(paths))
+		mgmt.Handle("/blacklist", management.BlacklistHandler(all))
+		mgmt.HandleUnauthenticated("/approvals/decide", management.ApprovalLinkHandler(paths.Approvals()))
+		mgmt.HandleUnauthenticated("/detonations", management.DetonationsHandler(paths))
+		mgmt.Handle("/restart", management.RestartHandler(func() {
+			select {
+			case restart <- struct{}{}:
+			default:
+			}
+		}))
+		paths.SetApprovalURL(config.Management.URL)
+
+		go func() {
+			log.Infof("Management API listening on %s", config.Management.Listen)
+			if err := mgmt.Start(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// Build SSL Key object, or issue the certificate with ACME
+	var ssl server.SSL
+	if config.ACME.Enabled() {
+		manager, err := acme.NewManager(config.ACME)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "acme configuration error"))
+		}
+		issueCertificate(manager)
+		go renewCertificate(manager)
+		ssl = server.NewIssuedSSL(manager.GetCertificate)
+		tracker.Add("acme", certs.IssuedSource(manager.GetCertificate))
+	} else if ssl, err = server.NewSSL(config.SSL.Key, config.SSL.Cert); err != nil {
 		log.Fatal(err)
+	} else {
+		tracker.Add("ssl", certs.FileSource(config.SSL.Cert))
 	}
+	go watchCertificates(config, tracker)
 
 	// Create server and listen
 	server, err := server.New(
@@ -93,17 +249,87 @@ func main() {
 		ssl,
 		nf,
 		serverRoot,
-		listen,
-		serverHeader,
-		indexPath,
-		redirectHTTP,
+		config.Listen,
+		config.ServerHeader,
+		config.Index,
+		config.RedirectHTTP,
 	)
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "server configuration error"))
 	}
+	server = server.WithMaintenance(maintenance).WithServerError(config.ServerError.Render).WithHTTP2(config.HTTP2)
+
+	// Ask clients for certificates so paths can be gated on them
+	if config.ClientCerts.Request {
+		cas, err := config.clientCAs()
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "client_certs configuration error"))
+		}
+		server = server.WithClientCerts(cas)
+	}
+
+	// Error pages of a common web server when none are rendered
+	if config.Persona != "" {
+		persona, err := assets.NewPersona(config.Persona)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server = server.WithPersona(persona)
+	}
 
-	log.Infof("Listening HTTPS on port %s", config.GetString("listen"))
-	if err := server.Start(); err != nil {
+	// Only serve allowed hosts
+	hostFilter, err := handlers.NewHostFilter(config.AllowedHosts, config.UnknownHost)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "allowed_hosts configuration error"))
+	}
+	server = server.WithHostFilter(hostFilter)
+
+	// Never serve clients outside of the engagement scope
+	scope, err := handlers.NewScope(config.Scope.Ranges, config.Scope.Countries)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "scope configuration error"))
+	}
+	server = server.WithScope(scope).WithVirtualHosts(vhosts)
+	// Only clients in scope are actively fingerprinted
+	all.SetScanScope(scope.Ranges())
+	if config.Drop.Enabled() {
+		dropBlacklisted(config, all, scope.Ranges())
+	}
+
+	// Remove leaks from the pages satellite generates
+	if !config.Scrub.Disabled {
+		scrubber, err := handlers.NewScrubber(append(append(config.Scrub.Strings, serverRoot, configDir), vhostRoots(config)...)...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server = server.WithScrubber(scrubber)
+	}
+
+	// Vary decoys so they cannot be matched by content hash
+	if config.DecoyVariation.Enabled {
+		varier, err := handlers.NewVarier(config.DecoyVariation.Comments)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "decoy_variation configuration error"))
+		}
+		server = server.WithVarier(varier)
+	}
+
+	// Acknowledge forms on decoy pages
+	if config.FormAck.Enabled {
+		formAck, err := handlers.NewFormAck(config.FormAck.Render, config.FormAck.Store, config.FormAck.MaxBody)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "form_ack configuration error"))
+		}
+		server = server.WithFormAck(formAck)
+	}
+
+	restarted := gracefulRestart(server, restart)
+
+	log.Infof("Listening HTTPS on port %s", config.Listen)
+	if err := server.Start(); err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+
+	<-restarted
+	log.Fatal(execSelf())
 }
@@ -0,0 +1,220 @@
+package malleable_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+	. "github.com/t94j0/satellite/satellite/malleable"
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+const profile = `# Amazon browsing traffic profile
+set sleeptime "5000";
+set useragent "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko";
+
+http-get {
+    set uri "/s/ref=nb_sb_noss_1/167-3294888-0262949/field-keywords=books";
+
+    client {
+        header "Accept" "*/*";
+        header "Host" "www.amazon.com";
+
+        metadata {
+            base64;
+            prepend "session-token=";
+            prepend "skin=noskin;";
+            append "csm-hit=s-24KU11BB82RZSYGJ3BDK|1419899012996";
+            header "Cookie";
+        }
+    }
+
+    server {
+        header "Server" "Server";
+        output {
+            print;
+        }
+    }
+}
+
+http-post {
+    set uri "/N4215/adj/amzn.us.sr.aps";
+
+    client {
+        header "Accept" "*/*";
+        header "Content-Type" "text/xml";
+        header "X-Requested-With" "XMLHttpRequest";
+        header "Host" "www.amazon.com";
+
+        parameter "sz" "160x600";
+
+        id {
+            parameter "dc_ref";
+        }
+
+        output {
+            base64url;
+            uri-append;
+        }
+    }
+
+    server {
+        output {
+            print;
+        }
+    }
+}
+
+http-get "variant" {
+    set uri "/s/ref=nb_sb_noss_1/167-3294888-0262949/field-keywords=books";
+    set verb "POST";
+
+    client {
+        header "Host" "cdn.amazon.com";
+        header "X-Variant" "1";
+        metadata {
+            print;
+        }
+    }
+}
+
+http-stager {
+    set uri_x86 "/_init.gif";
+    set uri_x64 "/__init.gif";
+}
+`
+
+func TestNewProfile(t *testing.T) {
+	p, err := NewProfile([]byte(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.UserAgent != "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko" {
+		t.Errorf("unexpected user agent %q", p.UserAgent)
+	}
+	if len(p.Transactions) != 4 {
+		t.Fatalf("expected 4 transactions, got %+v", p.Transactions)
+	}
+	post := p.Transactions[1]
+	if post.Verb != "POST" || !post.URIAppend || len(post.Headers) != 4 {
+		t.Errorf("unexpected http-post %+v", post)
+	}
+	if variant := p.Transactions[2]; variant.Variant != "variant" || variant.Verb != "POST" {
+		t.Errorf("unexpected variant %+v", variant)
+	}
+	if stager := p.Transactions[3]; !reflect.DeepEqual(stager.URIs, []string{"/_init.gif", "/__init.gif"}) {
+		t.Errorf("unexpected stager URIs %v", stager.URIs)
+	}
+}
+
+func TestProfile_Rules(t *testing.T) {
+	p, err := NewProfile([]byte(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := p.Rules("https://teamserver.example.com", "https://www.amazon.com")
+	if len(rules) != 4 {
+		t.Fatalf("expected 4 rules, got %+v", rules)
+	}
+	get := rules[3]
+	if get.Path != "/s/ref=nb_sb_noss_1/167-3294888-0262949/field-keywords=books" {
+		t.Fatalf("unexpected rule order %+v", rules)
+	}
+	if !reflect.DeepEqual(get.AuthorizedMethods, []string{"GET", "POST"}) {
+		t.Errorf("variant verbs were not merged: %v", get.AuthorizedMethods)
+	}
+	if !reflect.DeepEqual(get.AuthorizedHosts, []string{"www.amazon.com", "cdn.amazon.com"}) {
+		t.Errorf("Host was not matched with authorized_hosts: %v", get.AuthorizedHosts)
+	}
+	// The variants send different headers, so either set of headers is allowed
+	if len(get.All) != 0 || len(get.Any) != 2 || get.Any[0].All[0].AuthorizedHeaders["Accept"] != `\*/\*` || get.Any[1].All[0].AuthorizedHeaders["X-Variant"] != "1" {
+		t.Errorf("unexpected header blocks %+v %+v", get.All, get.Any)
+	}
+	post := rules[0]
+	if post.Path != "/N4215/adj/amzn.us.sr.aps*" {
+		t.Errorf("uri-append was not globbed: %s", post.Path)
+	}
+	if len(post.All) != 3 || len(post.Any) != 0 {
+		t.Errorf("expected every header to be required: %+v", post.All)
+	}
+
+	data, err := p.PathList("https://teamserver.example.com", "https://www.amazon.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := path.NewPathArrayData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 4 || paths[0].ProxyHost != "https://teamserver.example.com" || paths[0].OnFailure.Redirect != "https://www.amazon.com" {
+		t.Errorf("unexpected paths %+v", paths[0])
+	}
+}
+
+func TestProfile_PathList_host(t *testing.T) {
+	p, err := NewProfile([]byte(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.PathList("https://teamserver.example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := path.NewPathArrayData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "satellitetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state, err := path.NewState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	beacon := func() *http.Request {
+		req := httptest.NewRequest("POST", "https://www.amazon.com/N4215/adj/amzn.us.sr.aps?sz=160x600", nil)
+		req.Header.Set("User-Agent", p.UserAgent)
+		req.Header.Set("Accept", "*/*")
+		req.Header.Set("Content-Type", "text/xml")
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		return req
+	}
+	post := paths[0].Conditions
+	if !post.ShouldHost(beacon(), state, geoip.DB{}) {
+		t.Error("beacon was not allowed")
+	}
+
+	req := beacon()
+	req.Host = "example.com"
+	if post.ShouldHost(req, state, geoip.DB{}) {
+		t.Error("beacon with the wrong Host was allowed")
+	}
+
+	req = beacon()
+	req.Header.Del("X-Requested-With")
+	if post.ShouldHost(req, state, geoip.DB{}) {
+		t.Error("beacon missing one header was allowed")
+	}
+}
+
+func TestParse_fail(t *testing.T) {
+	for _, data := range []string{
+		`set useragent "unterminated;`,
+		`http-get { set uri "/a";`,
+		`set uri "/a"`,
+		`}`,
+		`set useragent "\xZZ";`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%q was parsed", data)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package malleable
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Statement is a statement of a profile, like set uri "/a"; or header "Accept" "*/*";
+// Blocks, like http-get { ... }, have their statements in Children
+type Statement struct {
+	Name     string
+	Args     []string
+	Children []Statement
+	// Block is true when the statement is a block, even an empty one
+	Block bool
+}
+
+// token is a word, string, or one of { } ;
+type token struct {
+	value string
+	// quoted is true for strings, so "{" is not taken for a block
+	quoted bool
+	line   int
+}
+
+// Parse parses the statements of a Malleable C2 profile
+func Parse(data []byte) ([]Statement, error) {
+	tokens, err := tokenize(string(data))
+	if err != nil {
+		return nil, err
+	}
+	statements, rest, err := parseStatements(tokens, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New(fmt.Sprintf("line %d: unexpected %s", rest[0].line, rest[0].value))
+	}
+	return statements, nil
+}
+
+// parseStatements parses statements until the end of tokens, or the } closing the
+// block when inBlock is set. It returns the tokens after the block
+func parseStatements(tokens []token, inBlock bool) ([]Statement, []token, error) {
+	statements := make([]Statement, 0)
+	for len(tokens) != 0 {
+		t := tokens[0]
+		if !t.quoted && t.value == "}" {
+			if !inBlock {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: unexpected }", t.line))
+			}
+			return statements, tokens[1:], nil
+		}
+		if t.quoted || t.value == "{" || t.value == ";" {
+			return nil, nil, errors.New(fmt.Sprintf("line %d: expected a statement, got %s", t.line, t.value))
+		}
+
+		s := Statement{Name: t.value}
+		tokens = tokens[1:]
+		for {
+			if len(tokens) == 0 {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: %s is not terminated", t.line, s.Name))
+			}
+			next := tokens[0]
+			tokens = tokens[1:]
+			if !next.quoted && next.value == ";" {
+				break
+			}
+			if !next.quoted && next.value == "{" {
+				children, rest, err := parseStatements(tokens, true)
+				if err != nil {
+					return nil, nil, err
+				}
+				s.Children, s.Block, tokens = children, true, rest
+				break
+			}
+			if !next.quoted && next.value == "}" {
+				return nil, nil, errors.New(fmt.Sprintf("line %d: %s is not terminated", t.line, s.Name))
+			}
+			s.Args = append(s.Args, next.value)
+		}
+		statements = append(statements, s)
+	}
+	if inBlock {
+		return nil, nil, errors.New("block is not closed")
+	}
+	return statements, nil, nil
+}
+
+// tokenize splits a profile into tokens. Comments start with # outside of strings
+func tokenize(data string) ([]token, error) {
+	tokens := make([]token, 0)
+	line := 1
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, token{value: string(c), line: line})
+			i++
+		case c == '"':
+			value, n, err := readString(data[i:])
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("line %d", line))
+			}
+			tokens = append(tokens, token{value: value, quoted: true, line: line})
+			line += strings.Count(data[i:i+n], "\n")
+			i += n
+		default:
+			start := i
+			for i < len(data) && !unicode.IsSpace(rune(data[i])) && !strings.ContainsRune("{};\"#", rune(data[i])) {
+				i++
+			}
+			tokens = append(tokens, token{value: data[start:i], line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// readString reads the string at the start of data, returning its unescaped value
+// and how many bytes it took. Profiles escape with \" \\ \n \r \t \xNN and \uNNNN
+func readString(data string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(data); i++ {
+		c := data[i]
+		if c == '"' {
+			return b.String(), i + 1, nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(data) {
+			break
+		}
+		switch data[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x', 'u':
+			size := 2
+			if data[i] == 'u' {
+				size = 4
+			}
+			if i+size >= len(data) {
+				return "", 0, errors.New("escape is not terminated")
+			}
+			v, err := strconv.ParseUint(data[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", 0, errors.New(fmt.Sprintf("\\%s is not a valid escape", data[i:i+1+size]))
+			}
+			if size == 2 {
+				b.WriteByte(byte(v))
+			} else {
+				b.WriteRune(rune(v))
+			}
+			i += size
+		default:
+			b.WriteByte(data[i])
+		}
+	}
+	return "", 0, errors.New("string is not terminated")
+}
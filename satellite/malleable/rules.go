@@ -0,0 +1,279 @@
+package malleable
+
+import (
+	"net/textproto"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Transaction is an http-get, http-post, or http-stager block of a profile, or one of its variants
+type Transaction struct {
+	// Kind is the name of the block, like http-get
+	Kind    string
+	Variant string
+	URIs    []string
+	Verb    string
+	// Headers are the headers sent by the beacon, as name and value pairs
+	Headers [][2]string
+	// URIAppend is true when the beacon appends data to the URI, so the path is a glob
+	URIAppend bool
+}
+
+// Profile is what satellite needs of a Malleable C2 profile to tell beacons from other clients
+type Profile struct {
+	// UserAgent is the user agent of beacons. Without it beacons pick a random one
+	UserAgent    string
+	Transactions []Transaction
+}
+
+// NewProfile parses the URIs, verbs, and client headers of a Malleable C2 profile
+func NewProfile(data []byte) (*Profile, error) {
+	statements, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{}
+	for _, s := range statements {
+		switch {
+		case s.Name == "set" && len(s.Args) == 2 && s.Args[0] == "useragent":
+			profile.UserAgent = s.Args[1]
+		case s.Block && (s.Name == "http-get" || s.Name == "http-post" || s.Name == "http-stager"):
+			t := newTransaction(s)
+			if len(t.URIs) != 0 {
+				profile.Transactions = append(profile.Transactions, t)
+			}
+		}
+	}
+	if len(profile.Transactions) == 0 {
+		return nil, errors.New("profile has no http-get, http-post, or http-stager URIs")
+	}
+	return profile, nil
+}
+
+// newTransaction gets the transaction of an http-get, http-post, or http-stager block
+func newTransaction(block Statement) Transaction {
+	t := Transaction{Kind: block.Name, Verb: "GET"}
+	if block.Name == "http-post" {
+		t.Verb = "POST"
+	}
+	if len(block.Args) != 0 {
+		t.Variant = block.Args[0]
+	}
+
+	for _, s := range block.Children {
+		switch {
+		case s.Name == "set" && len(s.Args) == 2:
+			switch s.Args[0] {
+			case "uri", "uri_x86", "uri_x64":
+				t.URIs = append(t.URIs, strings.Fields(s.Args[1])...)
+			case "verb":
+				t.Verb = strings.ToUpper(s.Args[1])
+			}
+		case s.Name == "client" && s.Block:
+			for _, c := range s.Children {
+				switch {
+				case c.Name == "header" && len(c.Args) == 2:
+					t.Headers = append(t.Headers, [2]string{c.Args[0], c.Args[1]})
+				case c.Block && containsStatement(c.Children, "uri-append"):
+					// metadata, id, or output sent in the URI
+					t.URIAppend = true
+				}
+			}
+		}
+	}
+	return t
+}
+
+// containsStatement checks if statements has a statement called name
+func containsStatement(statements []Statement, name string) bool {
+	for _, s := range statements {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// OnFailure is where clients which are not beacons are sent
+type OnFailure struct {
+	Redirect string `yaml:"redirect"`
+}
+
+// Conditions is a condition block of a rule
+type Conditions struct {
+	AuthorizedHeaders map[string]string `yaml:"authorized_headers,omitempty"`
+	All               []Conditions      `yaml:"all,omitempty"`
+}
+
+// Rule is a pathList.yml entry proxying a URI of the profile to the team server
+type Rule struct {
+	Path                 string   `yaml:"path"`
+	Proxy                string   `yaml:"proxy"`
+	AuthorizedUserAgents []string `yaml:"authorized_useragents,omitempty"`
+	AuthorizedMethods    []string `yaml:"authorized_methods,omitempty"`
+	AuthorizedHosts      []string `yaml:"authorized_hosts,omitempty"`
+	// All requires every header of the profile, as authorized_headers only needs one
+	All []Conditions `yaml:"all,omitempty"`
+	// Any holds the headers of each variant when variants sharing a URI send different headers
+	Any       []Conditions `yaml:"any,omitempty"`
+	OnFailure *OnFailure   `yaml:"on_failure,omitempty"`
+}
+
+// headerSet is the headers sent by a transaction, as value regexes by canonical name
+type headerSet map[string][]string
+
+// names gets the sorted names of the headers
+func (h headerSet) names() []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// all gets a block for every header, so all of them must be sent
+func (h headerSet) all() []Conditions {
+	all := make([]Conditions, 0, len(h))
+	for _, name := range h.names() {
+		all = append(all, Conditions{AuthorizedHeaders: map[string]string{name: strings.Join(h[name], "|")}})
+	}
+	return all
+}
+
+// Rules gets a rule for every URI of the profile, proxied to teamServer and only
+// allowing the user agent, verbs, Host, and headers of the profile. Clients failing
+// them are redirected to redirect, or get not_found without it. Variants sharing a
+// URI are merged, so a beacon of any of them is allowed
+func (p *Profile) Rules(teamServer, redirect string) []Rule {
+	type merged struct {
+		methods map[string]bool
+		hosts   []string
+		headers []headerSet
+	}
+	byPath := make(map[string]*merged)
+	for _, t := range p.Transactions {
+		// Host is not a header of requests, so it is matched with authorized_hosts
+		var hosts []string
+		headers := make(headerSet)
+		for _, h := range t.Headers {
+			name, value := textproto.CanonicalMIMEHeaderKey(h[0]), regexp.QuoteMeta(h[1])
+			if name == "Host" {
+				hosts = append(hosts, glob.QuoteMeta(h[1]))
+			} else if !containsString(headers[name], value) {
+				headers[name] = append(headers[name], value)
+			}
+		}
+
+		for _, uri := range t.URIs {
+			path := glob.QuoteMeta(uri)
+			if t.URIAppend {
+				path += "*"
+			}
+			m, ok := byPath[path]
+			if !ok {
+				m = &merged{methods: make(map[string]bool)}
+				byPath[path] = m
+			}
+			m.methods[t.Verb] = true
+			for _, host := range hosts {
+				if !containsString(m.hosts, host) {
+					m.hosts = append(m.hosts, host)
+				}
+			}
+			if !containsHeaders(m.headers, headers) {
+				m.headers = append(m.headers, headers)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rules := make([]Rule, 0, len(paths))
+	for _, path := range paths {
+		m := byPath[path]
+		rule := Rule{Path: path, Proxy: teamServer, AuthorizedHosts: m.hosts}
+		if p.UserAgent != "" {
+			rule.AuthorizedUserAgents = []string{"^" + regexp.QuoteMeta(p.UserAgent) + "$"}
+		}
+		for method := range m.methods {
+			rule.AuthorizedMethods = append(rule.AuthorizedMethods, method)
+		}
+		sort.Strings(rule.AuthorizedMethods)
+		rule.All, rule.Any = headerConditions(m.headers)
+		if redirect != "" {
+			rule.OnFailure = &OnFailure{Redirect: redirect}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// headerConditions gets the condition blocks requiring the headers of the
+// variants sharing a URI. Variants sending the same header names are merged
+// into one all block allowing the values of any of them. Otherwise each
+// variant gets an all block in an any block. Nothing is required when a
+// variant sends no headers
+func headerConditions(sets []headerSet) (all []Conditions, any []Conditions) {
+	merged := make(headerSet)
+	sameNames := true
+	for _, set := range sets {
+		if len(set) == 0 {
+			return nil, nil
+		}
+		if !reflect.DeepEqual(set.names(), sets[0].names()) {
+			sameNames = false
+		}
+		for name, values := range set {
+			for _, value := range values {
+				if !containsString(merged[name], value) {
+					merged[name] = append(merged[name], value)
+				}
+			}
+		}
+	}
+	if sameNames {
+		return merged.all(), nil
+	}
+
+	for _, set := range sets {
+		any = append(any, Conditions{All: set.all()})
+	}
+	return nil, any
+}
+
+// containsHeaders checks if sets contains set
+func containsHeaders(sets []headerSet, set headerSet) bool {
+	for _, s := range sets {
+		if reflect.DeepEqual(s, set) {
+			return true
+		}
+	}
+	return false
+}
+
+// PathList gets the rules of the profile as a pathList.yml
+func (p *Profile) PathList(teamServer, redirect string) ([]byte, error) {
+	return yaml.Marshal(p.Rules(teamServer, redirect))
+}
+
+// containsString checks if values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package management
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// Decision approves or denies a queued approval
+type Decision struct {
+	ID     string `json:"id"`
+	Action string `json:"action"`
+}
+
+// ApprovalsHandler lists queued approvals on GET and decides one on POST.
+// Listed approvals can be filtered by path, ip, decision (their status), since,
+// and until, and paged with limit and offset
+func ApprovalsHandler(approvals *path.Approvals) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			q, err := parseListQuery(req.URL.Query(), "path", "ip", "decision", "since", "until")
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			matched := make([]path.Approval, 0)
+			for _, a := range approvals.List() {
+				if q.match(a.Path, a.IP, "", a.Status, a.Requested) {
+					matched = append(matched, a)
+				}
+			}
+			start, end := q.page(w, len(matched))
+			writeJSON(w, http.StatusOK, matched[start:end])
+		case http.MethodPost:
+			var d Decision
+			if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if d.Action != "approve" && d.Action != "deny" {
+				writeError(w, http.StatusBadRequest, "action must be approve or deny")
+				return
+			}
+			approval, err := approvals.Decide(d.ID, d.Action == "approve")
+			if err != nil {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, approval)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// confirmPage asks the operator to confirm the decision of an approval link. Link
+// previews fetch the link with GET, so only the form's POST decides the approval
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Action}} {{.Approval.IP}}</title></head>
+<body>
+<p>{{.Action}} {{.Approval.IP}} ({{.Approval.UserAgent}}) for {{.Approval.Path}}?</p>
+<form method="POST">
+<input type="hidden" name="id" value="{{.Approval.ID}}">
+<input type="hidden" name="key" value="{{.Key}}">
+<input type="hidden" name="action" value="{{.Action}}">
+<button type="submit">{{.Action}}</button>
+</form>
+</body>
+</html>
+`))
+
+// ApprovalLinkHandler decides an approval from the link sent to the operator.
+// GET shows a confirmation page and the decision is made when it is POSTed.
+// The link is authorized by the approval's key rather than the API token
+func ApprovalLinkHandler(approvals *path.Approvals) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id, key, action := req.FormValue("id"), req.FormValue("key"), req.FormValue("action")
+		if action != "approve" && action != "deny" {
+			http.NotFound(w, req)
+			return
+		}
+
+		if req.Method == http.MethodGet {
+			approval, err := approvals.GetWithKey(id, key)
+			if err != nil {
+				http.NotFound(w, req)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Cache-Control", "no-store")
+			confirmPage.Execute(w, struct {
+				Approval path.Approval
+				Key      string
+				Action   string
+			}{approval, key, action})
+			return
+		}
+
+		approval, err := approvals.DecideWithKey(id, key, action == "approve")
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, approval.IP+" "+approval.Status+" for "+approval.Path+"\n")
+	}
+}
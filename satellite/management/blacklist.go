@@ -0,0 +1,47 @@
+package management
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// Blacklist is the global blacklist of the served paths
+type Blacklist interface {
+	BlacklistedIPs() ([]net.IP, error)
+	Unblacklist(ip net.IP) error
+}
+
+// BlacklistHandler lists the IPs on the global blacklist on GET, and unbans the IP
+// given by the ip query parameter on DELETE, which stops dropping its packets
+func BlacklistHandler(blacklist Blacklist) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			ips, err := blacklist.BlacklistedIPs()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, ips)
+		case http.MethodDelete:
+			ip := net.ParseIP(req.URL.Query().Get("ip"))
+			if ip == nil {
+				writeError(w, http.StatusBadRequest, "ip is required")
+				return
+			}
+			err := blacklist.Unblacklist(ip)
+			if err == path.ErrNotBlacklisted {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			} else if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
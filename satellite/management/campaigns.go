@@ -0,0 +1,64 @@
+package management
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// CampaignsHandler lists what every campaign used of its quotas today
+func CampaignsHandler(campaigns *path.Campaigns) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, campaigns.Usage())
+	}
+}
+
+// CampaignArchiveHandler gets the gzipped tar archive of the campaign given by the
+// campaign query parameter on GET, archives and wipes the campaign in one step on
+// POST, and wipes the campaign from the server on DELETE
+func CampaignArchiveHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		campaign := req.URL.Query().Get("campaign")
+		if campaign == "" {
+			writeError(w, http.StatusBadRequest, "campaign is required")
+			return
+		}
+
+		var err error
+		var archive bytes.Buffer
+		switch req.Method {
+		case http.MethodGet:
+			err = paths.Archive(campaign, &archive)
+		case http.MethodPost:
+			err = paths.ArchiveAndWipe(campaign, &archive)
+		case http.MethodDelete:
+			err = paths.WipeCampaign(campaign)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err == path.ErrCampaignNotFound {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if req.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", campaign+".tar.gz"))
+		archive.WriteTo(w)
+	}
+}
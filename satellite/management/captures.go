@@ -0,0 +1,32 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// CapturesHandler lists captured TLS client hellos. They can be filtered by
+// path, ip, since, and until, and paged with limit and offset
+func CapturesHandler(captures *path.Captures) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		q, err := parseListQuery(req.URL.Query(), "path", "ip", "since", "until")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		matched := make([]path.Capture, 0)
+		for _, c := range captures.List(q.Path) {
+			if q.match(c.Path, c.IP, "", "", c.Time) {
+				matched = append(matched, c)
+			}
+		}
+		start, end := q.page(w, len(matched))
+		writeJSON(w, http.StatusOK, matched[start:end])
+	}
+}
@@ -0,0 +1,18 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/certs"
+)
+
+// CertificatesHandler lists the domains and expiry of served certificates
+func CertificatesHandler(tracker *certs.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, tracker.List())
+	}
+}
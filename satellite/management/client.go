@@ -0,0 +1,87 @@
+package management
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Client calls the management API of a running satellite instance
+type Client struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a Client for the management API listening on addr
+func NewClient(addr, token string) *Client {
+	return &Client{
+		base:   "http://" + addr,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Do sends a request to the management API. in is encoded as the JSON body
+// when it is not nil and the JSON response is decoded into out when it is not nil
+func (c *Client) Do(method, uri string, in, out interface{}) error {
+	resp, err := c.send(method, uri, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Download sends a request to the management API and gets the raw response body
+func (c *Client) Download(method, uri string) ([]byte, error) {
+	resp, err := c.send(method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// send sends a request to the management API with in encoded as the JSON body when
+// it is not nil. Error responses are returned as errors
+func (c *Client) send(method, uri string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.base+uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("management API returned %s: %s", resp.Status, apiErr.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,35 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// DetonationsHandler receives detonation reports from sandbox monitors. Reports
+// are authorized by the key query parameter rather than the API token
+func DetonationsHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var report path.DetonationReport
+		if err := json.NewDecoder(req.Body).Decode(&report); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err := paths.Detonation(report, req.URL.Query().Get("key"))
+		if err == path.ErrDetonationKey {
+			http.NotFound(w, req)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
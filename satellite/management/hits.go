@@ -0,0 +1,89 @@
+package management
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// HitsHandler lists recent decisions, newest first. They can be filtered by
+// path, ip, country, decision, since, and until, and paged with limit and offset
+func HitsHandler(hits *path.Hits) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		q, err := parseListQuery(req.URL.Query(), "path", "ip", "country", "decision", "since", "until")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		all := hits.List()
+		matched := make([]path.Hit, 0)
+		for i := len(all) - 1; i >= 0; i-- {
+			if h := all[i]; q.match(h.Path, h.IP, h.Country, h.Decision, h.Time) {
+				matched = append(matched, h)
+			}
+		}
+		start, end := q.page(w, len(matched))
+		writeJSON(w, http.StatusOK, matched[start:end])
+	}
+}
+
+// defaultSeriesRange is how far back hit counts go when since is not set
+const defaultSeriesRange = 24 * time.Hour
+
+// HitSeriesHandler gets the hit counts of a path, or every path when path is not
+// set, over time. decision defaults to served, since to 24h ago, until to now,
+// and step, the width of each bucket, to 1h
+func HitSeriesHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		values := req.URL.Query()
+
+		decision := values.Get("decision")
+		if decision == "" {
+			decision = "served"
+		}
+		since, err := parseQueryTime(values.Get("since"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("since: %s", err))
+			return
+		}
+		if since.IsZero() {
+			since = time.Now().Add(-defaultSeriesRange)
+		}
+		until, err := parseQueryTime(values.Get("until"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("until: %s", err))
+			return
+		}
+		if until.IsZero() {
+			until = time.Now()
+		}
+		step := time.Hour
+		if v := values.Get("step"); v != "" {
+			if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("step: expected a duration, got %q", v))
+				return
+			}
+		}
+
+		buckets, err := paths.HitSeries(decision, values.Get("path"), since, until, step)
+		if err == path.ErrTooManyBuckets {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, buckets)
+	}
+}
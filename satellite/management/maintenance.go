@@ -0,0 +1,59 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+// MaintenanceStatus is the maintenance state given by the management API
+type MaintenanceStatus struct {
+	// Enabled turns on-demand maintenance on or off
+	Enabled *bool `json:"enabled,omitempty"`
+	// Window schedules a maintenance window in the form start/end
+	Window string `json:"window,omitempty"`
+	// Active is true when the maintenance persona is currently served
+	Active bool `json:"active"`
+	// Schedule are the scheduled maintenance windows
+	Schedule []string `json:"schedule,omitempty"`
+}
+
+func maintenanceStatus(m *util.Maintenance) MaintenanceStatus {
+	status := MaintenanceStatus{Active: m.Active(time.Now())}
+	for _, w := range m.Windows() {
+		status.Schedule = append(status.Schedule, w.Start.Format(time.RFC3339)+"/"+w.End.Format(time.RFC3339))
+	}
+	return status
+}
+
+// MaintenanceHandler reports the maintenance state on GET and changes it on POST
+func MaintenanceHandler(m *util.Maintenance) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, maintenanceStatus(m))
+		case http.MethodPost:
+			var update MaintenanceStatus
+			if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if update.Window != "" {
+				window, err := util.ParseWindow(update.Window)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				m.Schedule(window)
+			}
+			if update.Enabled != nil {
+				m.Set(*update.Enabled)
+			}
+			writeJSON(w, http.StatusOK, maintenanceStatus(m))
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
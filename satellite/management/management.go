@@ -0,0 +1,116 @@
+package management
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrNoToken is returned when the management API is enabled without a token or SSO
+var ErrNoToken = errors.New("management.token or management.oidc must be set to enable the management API")
+
+// Server is the operator management API. Every request must carry the
+// configured token as a bearer token, or the session of an operator logged in with SSO
+type Server struct {
+	listen string
+	token  string
+	sso    *provider
+	mux    *http.ServeMux
+	// public are handlers which do their own authorization
+	public *http.ServeMux
+}
+
+// New creates a new management Server
+func New(listen, token string) (*Server, error) {
+	return NewOIDC(listen, token, OIDC{})
+}
+
+// NewOIDC creates a new management Server which operators may also log in to
+// with an OpenID Connect identity provider. The token may be empty when SSO is enabled
+func NewOIDC(listen, token string, config OIDC) (*Server, error) {
+	if token == "" && !config.Enabled() {
+		return nil, ErrNoToken
+	}
+
+	s := &Server{
+		listen: listen,
+		token:  token,
+		mux:    http.NewServeMux(),
+		public: http.NewServeMux(),
+	}
+	if config.Enabled() {
+		sso, err := newProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		s.sso = sso
+		s.public.HandleFunc("/auth/login", sso.loginHandler)
+		s.public.HandleFunc("/auth/callback", sso.callbackHandler)
+		s.public.HandleFunc("/auth/session", sso.sessionHandler)
+		s.public.HandleFunc("/auth/logout", sso.logoutHandler)
+	}
+	return s, nil
+}
+
+// Handle registers a handler for an API pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function for an API pattern
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// HandleUnauthenticated registers a handler which is not protected by the
+// token. The handler must authorize requests itself
+func (s *Server) HandleUnauthenticated(pattern string, handler http.Handler) {
+	s.public.Handle(pattern, handler)
+}
+
+// authorized checks the bearer token or SSO session of a request
+func (s *Server) authorized(req *http.Request) bool {
+	if s.sso != nil {
+		if _, ok := s.sso.session(req); ok {
+			return true
+		}
+	}
+
+	auth := req.Header.Get("Authorization")
+	if s.token == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// ServeHTTP authorizes and routes a management request
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h, pattern := s.public.Handler(req); pattern != "" {
+		h.ServeHTTP(w, req)
+		return
+	}
+
+	if !s.authorized(req) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	s.mux.ServeHTTP(w, req)
+}
+
+// Start makes the management API begin listening
+func (s *Server) Start() error {
+	return http.ListenAndServe(s.listen, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
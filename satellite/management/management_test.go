@@ -0,0 +1,277 @@
+package management_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	shttptest "github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+	. "github.com/t94j0/satellite/satellite/management"
+	"github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+const Token = "token"
+
+func createServer() (*Server, *httptest.Server, error) {
+	s, err := New("127.0.0.1:0", Token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, httptest.NewServer(s), nil
+}
+
+func TestNew_notoken(t *testing.T) {
+	if _, err := New("127.0.0.1:0", ""); err != ErrNoToken {
+		t.Fail()
+	}
+}
+
+func TestServer_unauthorized(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+	s.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {})
+
+	req, _ := http.NewRequest("GET", ts.URL+"/test", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fail()
+	}
+}
+
+func TestClient_maintenance(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	m, err := util.NewMaintenance(false, 0, "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Handle("/maintenance", MaintenanceHandler(m))
+
+	client := NewClient(strings.TrimPrefix(ts.URL, "http://"), Token)
+
+	enabled := true
+	var status MaintenanceStatus
+	if err := client.Do("POST", "/maintenance", MaintenanceStatus{Enabled: &enabled}, &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Active {
+		t.Fail()
+	}
+
+	if err := client.Do("POST", "/maintenance", MaintenanceStatus{Window: "bad"}, &status); err == nil {
+		t.Fail()
+	}
+}
+
+func TestApprovalLinkHandler(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	approvals := path.NewApprovals()
+	s.HandleUnauthenticated("/approvals/decide", ApprovalLinkHandler(approvals))
+
+	var queued path.Approval
+	approvals.OnRequest(func(a path.Approval) {
+		queued = a
+	})
+	approvals.Check(net.ParseIP("127.0.0.1"), "/payload", "", time.Hour)
+
+	resp, err := http.Get(ts.URL + "/approvals/decide?action=approve&id=" + queued.ID + "&key=wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("approval link with the wrong key was accepted")
+	}
+
+	// Opening the link only asks for confirmation, so link previews do not decide
+	link := ts.URL + "/approvals/decide?action=approve&id=" + queued.ID + "&key=" + queued.Key
+	resp, err = http.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `method="POST"`) {
+		t.Errorf("approval link did not ask for confirmation: %s", page)
+	}
+	if approvals.Check(net.ParseIP("127.0.0.1"), "/payload", "", time.Hour) {
+		t.Error("opening the approval link approved")
+	}
+
+	resp, err = http.PostForm(ts.URL+"/approvals/decide", url.Values{"id": {queued.ID}, "key": {queued.Key}, "action": {"approve"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Error("approval link was not accepted")
+	}
+
+	if !approvals.Check(net.ParseIP("127.0.0.1"), "/payload", "", time.Hour) {
+		t.Fail()
+	}
+}
+
+func TestClient_schema(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+	s.Handle("/schema", SchemaHandler())
+
+	client := NewClient(strings.TrimPrefix(ts.URL, "http://"), Token)
+
+	var schema map[string]interface{}
+	if err := client.Do("GET", "/schema", nil, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["type"] != "object" {
+		t.Error(".info schema is not an object")
+	}
+
+	if err := client.Do("GET", "/schema?file=paths", nil, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["type"] != "array" {
+		t.Error("pathList.yml schema is not an array")
+	}
+}
+
+func TestClient_hits(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	hits := path.NewHits()
+	for i := 0; i < 5; i++ {
+		req := shttptest.NewRequest("GET", "/payload", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		hits.Add(req, "served", geoip.DB{})
+	}
+	req := shttptest.NewRequest("GET", "/other", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	hits.Add(req, "denied", geoip.DB{})
+	s.Handle("/hits", HitsHandler(hits))
+
+	client := NewClient(strings.TrimPrefix(ts.URL, "http://"), Token)
+
+	var list []path.Hit
+	if err := client.Do("GET", "/hits?decision=denied", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path != "/other" || list[0].IP != "10.0.0.2" {
+		t.Errorf("unexpected hits %+v", list)
+	}
+
+	if err := client.Do("GET", "/hits?path=/payload&since=1h&limit=2&offset=1", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("unexpected page %+v", list)
+	}
+
+	if err := client.Do("GET", "/hits?until=2000-01-01T00:00:00Z", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Error("hits after until were listed")
+	}
+
+	if err := client.Do("GET", "/hits?limit=0", nil, &list); err == nil {
+		t.Error("invalid limit was accepted")
+	}
+}
+
+func TestCapturesHandler_filters(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+	s.Handle("/captures", CapturesHandler(path.NewCaptures()))
+
+	client := NewClient(strings.TrimPrefix(ts.URL, "http://"), Token)
+
+	var list []path.Capture
+	if err := client.Do("GET", "/captures?ip=10.0.0.1", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Do("GET", "/captures?country=US", nil, &list); err == nil {
+		t.Error("unsupported filter was accepted")
+	}
+}
+
+// blacklist is the global blacklist of a test server
+type blacklist map[string]bool
+
+func (b blacklist) BlacklistedIPs() ([]net.IP, error) {
+	ips := make([]net.IP, 0, len(b))
+	for ip := range b {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	return ips, nil
+}
+
+func (b blacklist) Unblacklist(ip net.IP) error {
+	if !b[ip.String()] {
+		return path.ErrNotBlacklisted
+	}
+	delete(b, ip.String())
+	return nil
+}
+
+func TestClient_blacklist(t *testing.T) {
+	s, ts, err := createServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	b := blacklist{"10.0.0.1": true}
+	s.Handle("/blacklist", BlacklistHandler(b))
+	client := NewClient(strings.TrimPrefix(ts.URL, "http://"), Token)
+
+	var ips []net.IP
+	if err := client.Do("GET", "/blacklist", nil, &ips); err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected blacklist %v", ips)
+	}
+
+	if err := client.Do("DELETE", "/blacklist?ip=10.0.0.1", nil, nil); err != nil {
+		t.Error(err)
+	}
+	if len(b) != 0 {
+		t.Error("IP was not unbanned")
+	}
+	if err := client.Do("DELETE", "/blacklist?ip=10.0.0.1", nil, nil); err == nil {
+		t.Error("IP which is not blacklisted was unbanned")
+	}
+	if err := client.Do("DELETE", "/blacklist?ip=abc", nil, nil); err == nil {
+		t.Error("invalid IP was unbanned")
+	}
+}
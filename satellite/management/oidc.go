@@ -0,0 +1,558 @@
+package management
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long an SSO session lasts when session_ttl is not set
+const DefaultSessionTTL = time.Hour
+
+// sessionCookie holds the session of an operator logged in with SSO
+const sessionCookie = "satellite_session"
+
+// loginCookie holds the state and nonce of a login in progress
+const loginCookie = "satellite_login"
+
+// ErrInvalidIDToken is returned when an ID token is not signed by the identity provider or not meant for satellite
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// OIDC configures logging operators in with an OpenID Connect identity provider
+type OIDC struct {
+	// Issuer is the URL of the identity provider, which serves /.well-known/openid-configuration
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is the URL of /auth/callback registered with the identity provider
+	RedirectURL string `mapstructure:"redirect_url"`
+	// Scopes are requested along with openid. Defaults to email and profile
+	Scopes []string `mapstructure:"scopes"`
+	// AllowedEmails, AllowedDomains, and AllowedGroups limit who may log in. When
+	// none are set, every user the identity provider authenticates may log in
+	AllowedEmails  []string `mapstructure:"allowed_emails"`
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+	AllowedGroups  []string `mapstructure:"allowed_groups"`
+	// SessionTTL is how long a login lasts. Defaults to 1h
+	SessionTTL string `mapstructure:"session_ttl"`
+}
+
+// Enabled returns true if an identity provider is configured
+func (o OIDC) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// Validate checks the identity provider can be logged in with
+func (o OIDC) Validate() error {
+	if !strings.HasPrefix(o.Issuer, "https://") && !strings.HasPrefix(o.Issuer, "http://") {
+		return fmt.Errorf("issuer: expected a URL, got %q", o.Issuer)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("client_id: expected a client ID, got %q", o.ClientID)
+	}
+	if u, err := url.Parse(o.RedirectURL); err != nil || !strings.HasSuffix(u.Path, "/auth/callback") {
+		return fmt.Errorf("redirect_url: expected a URL of /auth/callback, got %q", o.RedirectURL)
+	}
+	if o.SessionTTL != "" {
+		if d, err := time.ParseDuration(o.SessionTTL); err != nil || d <= 0 {
+			return fmt.Errorf("session_ttl: expected a duration, got %q", o.SessionTTL)
+		}
+	}
+	return nil
+}
+
+// Session is an operator logged in with SSO
+type Session struct {
+	Subject string    `json:"sub"`
+	Email   string    `json:"email,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// oidcDiscovery is the part of the provider configuration satellite uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the claims of an ID token satellite checks
+type oidcClaims struct {
+	Issuer   string          `json:"iss"`
+	Subject  string          `json:"sub"`
+	Audience json.RawMessage `json:"aud"`
+	Expires  int64           `json:"exp"`
+	Nonce    string          `json:"nonce"`
+	Email    string          `json:"email"`
+	Groups   []string        `json:"groups"`
+}
+
+// provider logs operators in with an identity provider and signs their sessions
+type provider struct {
+	config OIDC
+	ttl    time.Duration
+	client *http.Client
+	// key signs session and login cookies. Sessions do not outlive the process
+	key []byte
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+}
+
+func newProvider(config OIDC) (*provider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	ttl := DefaultSessionTTL
+	if config.SessionTTL != "" {
+		ttl, _ = time.ParseDuration(config.SessionTTL)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &provider{
+		config: config,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+		key:    key,
+	}, nil
+}
+
+// getJSON fetches a JSON document from the identity provider
+func (p *provider) getJSON(uri string, v interface{}) error {
+	resp, err := p.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", uri, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover gets the provider configuration, fetching it on first use
+func (p *provider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("identity provider configuration is missing endpoints")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// publicKey gets the signing key identified by kid. Keys are fetched again
+// when kid is unknown so rotated keys are picked up
+func (p *provider) publicKey(kid string) (crypto.PublicKey, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidIDToken
+}
+
+// jwk is a signing key of the identity provider
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b), err
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, errors.New("unsupported key type " + k.Kty)
+}
+
+// verify checks the signature and claims of an ID token
+func (p *provider) verify(token, nonce string) (oidcClaims, error) {
+	var claims oidcClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	key, err := p.publicKey(header.Kid)
+	if err != nil {
+		return claims, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return claims, ErrInvalidIDToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return claims, ErrInvalidIDToken
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return claims, ErrInvalidIDToken
+		}
+	default:
+		return claims, ErrInvalidIDToken
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, ErrInvalidIDToken
+	}
+	d, _ := p.discover()
+	if claims.Issuer != d.Issuer || !claims.hasAudience(p.config.ClientID) ||
+		time.Now().Unix() >= claims.Expires || claims.Nonce != nonce || claims.Subject == "" {
+		return claims, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// hasAudience checks the aud claim, which is either a string or a list, contains clientID
+func (c oidcClaims) hasAudience(clientID string) bool {
+	var audiences []string
+	if err := json.Unmarshal(c.Audience, &audiences); err != nil {
+		var audience string
+		if err := json.Unmarshal(c.Audience, &audience); err != nil {
+			return false
+		}
+		audiences = []string{audience}
+	}
+	for _, a := range audiences {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// allowed checks the user of claims may log in
+func (p *provider) allowed(claims oidcClaims) bool {
+	c := p.config
+	if len(c.AllowedEmails) == 0 && len(c.AllowedDomains) == 0 && len(c.AllowedGroups) == 0 {
+		return true
+	}
+	email := strings.ToLower(claims.Email)
+	for _, e := range c.AllowedEmails {
+		if email != "" && email == strings.ToLower(e) {
+			return true
+		}
+	}
+	for _, d := range c.AllowedDomains {
+		if email != "" && strings.HasSuffix(email, "@"+strings.ToLower(d)) {
+			return true
+		}
+	}
+	for _, g := range c.AllowedGroups {
+		for _, group := range claims.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sign creates a cookie value of v which cannot be forged. The signature covers
+// the purpose so a value signed for one cookie is not accepted as another
+func (p *provider) sign(purpose string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(p.mac(purpose, payload)), nil
+}
+
+// mac signs payload for purpose
+func (p *provider) mac(purpose, payload string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// open checks the signature of a cookie value created by sign for purpose and
+// decodes it into v
+func (p *provider) open(purpose, value string, v interface{}) bool {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, p.mac(purpose, parts[0])) {
+		return false
+	}
+	return decodeSegment(parts[0], v) == nil
+}
+
+// session gets the unexpired session of a request
+func (p *provider) session(req *http.Request) (Session, bool) {
+	var s Session
+	cookie, err := req.Cookie(sessionCookie)
+	if err != nil || !p.open(sessionCookie, cookie.Value, &s) || s.Subject == "" {
+		return s, false
+	}
+	return s, time.Now().Before(s.Expires)
+}
+
+// setCookie sets a cookie scoped to the management API. SameSite keeps other
+// sites from making requests with the session
+func (p *provider) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.config.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// randomString creates an unguessable URL safe string
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// login is the state of a login in progress
+type login struct {
+	State   string    `json:"state"`
+	Nonce   string    `json:"nonce"`
+	Expires time.Time `json:"expires"`
+}
+
+// loginHandler sends operators to the identity provider
+func (p *provider) loginHandler(w http.ResponseWriter, req *http.Request) {
+	d, err := p.discover()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	state, err := randomString()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	value, err := p.sign(loginCookie, login{State: state, Nonce: nonce, Expires: time.Now().Add(10 * time.Minute)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	p.setCookie(w, loginCookie, value, 600)
+
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.config.ClientID},
+		"redirect_uri":  {p.config.RedirectURL},
+		"scope":         {strings.Join(append([]string{"openid"}, scopes...), " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, req, d.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// exchange trades an authorization code for an ID token
+func (p *provider) exchange(code string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {p.config.RedirectURL},
+	}
+	req, err := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("exchanging code: %s", resp.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", ErrInvalidIDToken
+	}
+	return tokens.IDToken, nil
+}
+
+// callbackHandler logs in operators returning from the identity provider
+func (p *provider) callbackHandler(w http.ResponseWriter, req *http.Request) {
+	var l login
+	cookie, err := req.Cookie(loginCookie)
+	if err != nil || !p.open(loginCookie, cookie.Value, &l) || time.Now().After(l.Expires) ||
+		!hmac.Equal([]byte(l.State), []byte(req.URL.Query().Get("state"))) {
+		writeError(w, http.StatusBadRequest, "invalid login state")
+		return
+	}
+	p.setCookie(w, loginCookie, "", -1)
+
+	if e := req.URL.Query().Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, e)
+		return
+	}
+
+	token, err := p.exchange(req.URL.Query().Get("code"))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	claims, err := p.verify(token, l.Nonce)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if !p.allowed(claims) {
+		writeError(w, http.StatusForbidden, "user is not allowed")
+		return
+	}
+
+	value, err := p.sign(sessionCookie, Session{Subject: claims.Subject, Email: claims.Email, Expires: time.Now().Add(p.ttl)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	p.setCookie(w, sessionCookie, value, int(p.ttl/time.Second))
+	http.Redirect(w, req, "/auth/session", http.StatusFound)
+}
+
+// sessionHandler gets the session of the logged in operator
+func (p *provider) sessionHandler(w http.ResponseWriter, req *http.Request) {
+	s, ok := p.session(req)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// logoutHandler ends the session of the operator
+func (p *provider) logoutHandler(w http.ResponseWriter, req *http.Request) {
+	p.setCookie(w, sessionCookie, "", -1)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "logged out"})
+}
@@ -0,0 +1,216 @@
+package management_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/management"
+)
+
+// identityProvider is an OpenID Connect provider which logs in email without asking
+type identityProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	email  string
+	nonces map[string]string
+}
+
+func newIdentityProvider(t *testing.T, email string) *identityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &identityProvider{key: key, email: email, nonces: make(map[string]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		idp.nonces["code"] = q.Get("nonce")
+		http.Redirect(w, req, q.Get("redirect_uri")+"?code=code&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if id, secret, _ := req.BasicAuth(); id != "satellite" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t, idp.nonces[req.FormValue("code")])})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *identityProvider) idToken(t *testing.T, nonce string) string {
+	segment := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": "RS256", "kid": "1"}) + "." + segment(map[string]interface{}{
+		"iss":   idp.URL,
+		"sub":   "operator",
+		"aud":   "satellite",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": nonce,
+		"email": idp.email,
+	})
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestServer_oidc(t *testing.T) {
+	for _, tc := range []struct {
+		email   string
+		allowed bool
+	}{
+		{"alice@example.com", true},
+		{"mallory@example.net", false},
+	} {
+		idp := newIdentityProvider(t, tc.email)
+		defer idp.Close()
+
+		// The redirect URL is only known once the server listens
+		var s *Server
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			s.ServeHTTP(w, req)
+		}))
+		defer ts.Close()
+		sso, err := NewOIDC("127.0.0.1:0", "", OIDC{
+			Issuer:         idp.URL,
+			ClientID:       "satellite",
+			ClientSecret:   "secret",
+			RedirectURL:    ts.URL + "/auth/callback",
+			AllowedDomains: []string{"example.com"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s = sso
+		s.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {})
+
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+
+		resp, err := client.Get(ts.URL + "/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: API was reachable before logging in", tc.email)
+		}
+
+		resp, err = client.Get(ts.URL + "/auth/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loggedIn := resp.StatusCode == http.StatusOK; loggedIn != tc.allowed {
+			t.Errorf("%s: expected logged in %t, got %s", tc.email, tc.allowed, resp.Status)
+		}
+
+		resp, err = client.Get(ts.URL + "/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authorized := resp.StatusCode == http.StatusOK; authorized != tc.allowed {
+			t.Errorf("%s: expected authorized %t, got %s", tc.email, tc.allowed, resp.Status)
+		}
+	}
+}
+
+func TestServer_oidc_forged_session(t *testing.T) {
+	s, err := NewOIDC("127.0.0.1:0", "", OIDC{
+		Issuer:      "https://login.example.com",
+		ClientID:    "satellite",
+		RedirectURL: "https://ops.example.com/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	s.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {})
+
+	session, _ := json.Marshal(Session{Subject: "operator", Expires: time.Now().Add(time.Hour)})
+	req, _ := http.NewRequest("GET", ts.URL+"/test", nil)
+	req.AddCookie(&http.Cookie{Name: "satellite_session", Value: base64.RawURLEncoding.EncodeToString(session) + ".forged"})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("forged session was authorized")
+	}
+}
+
+func TestServer_oidc_login_as_session(t *testing.T) {
+	idp := newIdentityProvider(t, "alice@example.com")
+	defer idp.Close()
+
+	s, err := NewOIDC("127.0.0.1:0", "", OIDC{
+		Issuer:      idp.URL,
+		ClientID:    "satellite",
+		RedirectURL: "https://ops.example.com/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	s.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var login *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "satellite_login" {
+			login = cookie
+		}
+	}
+	if login == nil {
+		t.Fatal("login cookie was not set")
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/test", nil)
+	req.AddCookie(&http.Cookie{Name: "satellite_session", Value: login.Value})
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login cookie was accepted as a session, got %s", resp.Status)
+	}
+}
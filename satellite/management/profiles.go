@@ -0,0 +1,88 @@
+package management
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// Promotion promotes a learned profile into its path's authorized list
+type Promotion struct {
+	ID string `json:"id"`
+}
+
+// ProfilesHandler lists learned profiles on GET and promotes one on POST.
+// Listed profiles can be filtered by path, and by since and until on when they
+// were last seen, and paged with limit and offset
+func ProfilesHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			q, err := parseListQuery(req.URL.Query(), "path", "since", "until")
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			matched := make([]path.Profile, 0)
+			for _, p := range paths.Profiles().List() {
+				if q.match(p.Path, "", "", "", p.LastSeen) {
+					matched = append(matched, p)
+				}
+			}
+			start, end := q.page(w, len(matched))
+			writeJSON(w, http.StatusOK, matched[start:end])
+		case http.MethodPost:
+			var p Promotion
+			if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			profile, err := paths.Promote(p.ID)
+			if err == path.ErrProfileNotFound {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			} else if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, profile)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// Demotion removes promoted fingerprints from a path's authorized lists
+type Demotion struct {
+	Path string `json:"path"`
+	path.Promoted
+}
+
+// PromotedHandler lists the fingerprints promoted to each path on GET and
+// demotes fingerprints on DELETE
+func PromotedHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, paths.Promoted())
+		case http.MethodDelete:
+			var d Demotion
+			if err := json.NewDecoder(req.Body).Decode(&d); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if d.Path == "" {
+				writeError(w, http.StatusBadRequest, "path is required")
+				return
+			}
+			if err := paths.Demote(d.Path, d.Promoted); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package management
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLimit is the page size of list endpoints when limit is not set
+const defaultLimit = 100
+
+// maxLimit is the largest page size of list endpoints
+const maxLimit = 1000
+
+// listQuery filters and paginates list endpoints. It is parsed from the path,
+// ip, country, decision, since, until, limit, and offset query parameters
+type listQuery struct {
+	Path     string
+	IP       string
+	Country  string
+	Decision string
+	// Since and Until bound the time of items. Either may be zero
+	Since time.Time
+	Until time.Time
+	Limit int
+	// Offset is the number of matching items skipped
+	Offset int
+}
+
+// parseListQuery parses the page of a list request and the filters, which
+// are the filters the list supports. Times are RFC 3339 or a duration before
+// now, like 24h
+func parseListQuery(values url.Values, filters ...string) (listQuery, error) {
+	for _, f := range []string{"path", "ip", "country", "decision", "since", "until"} {
+		if values.Get(f) != "" && !supported(f, filters) {
+			return listQuery{}, fmt.Errorf("%s: not a filter of this list", f)
+		}
+	}
+
+	q := listQuery{
+		Path:     values.Get("path"),
+		IP:       values.Get("ip"),
+		Country:  strings.ToUpper(values.Get("country")),
+		Decision: values.Get("decision"),
+		Limit:    defaultLimit,
+	}
+
+	var err error
+	if q.Since, err = parseQueryTime(values.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %s", err)
+	}
+	if q.Until, err = parseQueryTime(values.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %s", err)
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > maxLimit {
+			return q, fmt.Errorf("limit: expected 1 to %d, got %q", maxLimit, v)
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset: expected a positive number, got %q", v)
+		}
+	}
+
+	return q, nil
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func supported(filter string, filters []string) bool {
+	for _, f := range filters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns true if an item with the fields matches the filters. Lists
+// pass empty fields for filters they do not support
+func (q listQuery) match(path, ip, country, decision string, t time.Time) bool {
+	switch {
+	case q.Path != "" && q.Path != path:
+		return false
+	case q.IP != "" && q.IP != ip:
+		return false
+	case q.Country != "" && q.Country != country:
+		return false
+	case q.Decision != "" && q.Decision != decision:
+		return false
+	case !q.Since.IsZero() && t.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && t.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// page gets the bounds of the page of n matching items, and sets the
+// X-Total-Count header to n
+func (q listQuery) page(w http.ResponseWriter, n int) (start, end int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(n))
+	start = q.Offset
+	if start > n {
+		start = n
+	}
+	end = start + q.Limit
+	if end > n {
+		end = n
+	}
+	return start, end
+}
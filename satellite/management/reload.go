@@ -0,0 +1,49 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// ReloadResult is the outcome of reloading a single path
+type ReloadResult struct {
+	Path string `json:"path"`
+	// Status is reloaded, removed, or valid when the path was only validated
+	Status string `json:"status"`
+}
+
+// ReloadPathHandler reloads the path given by the path query parameter from the
+// path list on POST, without waiting for the watcher or reloading every path.
+// With validate=true the path is only validated
+func ReloadPathHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		uri := req.URL.Query().Get("path")
+		if uri == "" {
+			writeError(w, http.StatusBadRequest, "path is required")
+			return
+		}
+		dryRun := req.URL.Query().Get("validate") == "true"
+
+		reloaded, err := paths.ReloadPath(uri, dryRun)
+		if err == path.ErrPathNotFound {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+		result := ReloadResult{Path: uri, Status: "reloaded"}
+		if dryRun {
+			result.Status = "valid"
+		} else if reloaded == nil {
+			result.Status = "removed"
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
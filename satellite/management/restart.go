@@ -0,0 +1,17 @@
+package management
+
+import (
+	"net/http"
+)
+
+// RestartHandler calls restart in the background on POST
+func RestartHandler(restart func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "restarting"})
+		go restart()
+	}
+}
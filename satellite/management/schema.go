@@ -0,0 +1,27 @@
+package management
+
+import (
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// SchemaHandler gives the JSON schema of .info files, or of pathList.yml when
+// the file query parameter is paths
+func SchemaHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		switch req.URL.Query().Get("file") {
+		case "", "info":
+			writeJSON(w, http.StatusOK, path.ConditionsSchema())
+		case "paths":
+			writeJSON(w, http.StatusOK, path.PathListSchema())
+		default:
+			writeError(w, http.StatusBadRequest, "file must be info or paths")
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package management
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// TimelineHandler gets every decision made for a client IP across every path,
+// oldest first, with the stages it reached. ip is required, and ja3 limits the
+// timeline to one client profile behind the IP
+func TimelineHandler(paths *path.Paths) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		values := req.URL.Query()
+		ip := net.ParseIP(values.Get("ip"))
+		if ip == nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("ip: expected an IP address, got %q", values.Get("ip")))
+			return
+		}
+
+		timeline, err := paths.Timeline(ip.String(), values.Get("ja3"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, timeline)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/geoip"
+)
+
+// defaultGeoIPRefresh is how often MaxMind databases are downloaded when geoip.refresh is not set
+const defaultGeoIPRefresh = 24 * time.Hour
+
+// downloadGeoIP downloads the MaxMind databases of geoip_path and asn_path. It
+// returns which databases were downloaded
+func downloadGeoIP(updater *geoip.Updater, config *Configuration) (country bool, asn bool) {
+	edition := config.GeoIP.Edition
+	if edition == "" {
+		edition = "GeoLite2-Country"
+	}
+
+	if err := updater.Download(edition, config.GeoIPPath); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Unable to download geoip_path")
+	} else {
+		country = true
+	}
+
+	if config.ASNPath != "" {
+		if err := updater.Download("GeoLite2-ASN", config.ASNPath); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Unable to download asn_path")
+		} else {
+			asn = true
+		}
+	}
+
+	return country, asn
+}
+
+// refreshGeoIP downloads the MaxMind databases every geoip.refresh and swaps
+// them into paths without interrupting requests
+func refreshGeoIP(updater *geoip.Updater, config *Configuration, paths pathSet) {
+	refresh, err := time.ParseDuration(config.GeoIP.Refresh)
+	if err != nil {
+		refresh = defaultGeoIPRefresh
+	}
+
+	for range time.Tick(refresh) {
+		country, asn := downloadGeoIP(updater, config)
+		if country {
+			if err := paths.AddGeoIP(config.GeoIPPath); err != nil {
+				log.Error(err)
+			}
+		}
+		if asn {
+			if err := paths.AddASN(config.ASNPath); err != nil {
+				log.Error(err)
+			}
+		}
+		log.Debug("Refreshed MaxMind databases")
+	}
+}
@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a metric which only increases
+type Counter struct {
+	value uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value gets the current value of the counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// CounterVec is a set of counters partitioned by the value of a label
+type CounterVec struct {
+	label    string
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// With gets the counter for a label value
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, ok := v.counters[value]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.counters[value]; ok {
+		return c
+	}
+	c = &Counter{}
+	v.counters[value] = c
+	return c
+}
+
+// Gauge is a metric which is set to its current value, like a timestamp or whether something is down
+type Gauge struct {
+	value int64
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v int64) {
+	atomic.StoreInt64(&g.value, v)
+}
+
+// Value gets the current value of the gauge
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+// GaugeVec is a set of gauges partitioned by the value of a label
+type GaugeVec struct {
+	label  string
+	mu     sync.RWMutex
+	gauges map[string]*Gauge
+}
+
+// With gets the gauge for a label value
+func (v *GaugeVec) With(value string) *Gauge {
+	v.mu.RLock()
+	g, ok := v.gauges[value]
+	v.mu.RUnlock()
+	if ok {
+		return g
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if g, ok := v.gauges[value]; ok {
+		return g
+	}
+	g = &Gauge{}
+	v.gauges[value] = g
+	return g
+}
+
+// Delete stops exposing the gauge for a label value, like for a certificate which is no longer served
+func (v *GaugeVec) Delete(value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.gauges, value)
+}
+
+type metric struct {
+	name     string
+	help     string
+	counter  *Counter
+	vec      *CounterVec
+	gauge    *Gauge
+	gaugeVec *GaugeVec
+}
+
+// sample is a value of a metric, with the value of its label for partitioned metrics
+type sample struct {
+	label string
+	value string
+}
+
+// kind is the Prometheus type of the metric
+func (m metric) kind() string {
+	if m.gauge != nil || m.gaugeVec != nil {
+		return "gauge"
+	}
+	return "counter"
+}
+
+// samples gets the current values of the metric, sorted by label value
+func (m metric) samples() []sample {
+	switch {
+	case m.counter != nil:
+		return []sample{{value: fmt.Sprint(m.counter.Value())}}
+	case m.gauge != nil:
+		return []sample{{value: fmt.Sprint(m.gauge.Value())}}
+	case m.vec != nil:
+		m.vec.mu.RLock()
+		defer m.vec.mu.RUnlock()
+		samples := make([]sample, 0, len(m.vec.counters))
+		for value, c := range m.vec.counters {
+			samples = append(samples, sample{label: value, value: fmt.Sprint(c.Value())})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].label < samples[j].label })
+		return samples
+	default:
+		m.gaugeVec.mu.RLock()
+		defer m.gaugeVec.mu.RUnlock()
+		samples := make([]sample, 0, len(m.gaugeVec.gauges))
+		for value, g := range m.gaugeVec.gauges {
+			samples = append(samples, sample{label: value, value: fmt.Sprint(g.Value())})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].label < samples[j].label })
+		return samples
+	}
+}
+
+// labelName is the name of the label partitioning the metric, or empty
+func (m metric) labelName() string {
+	switch {
+	case m.vec != nil:
+		return m.vec.label
+	case m.gaugeVec != nil:
+		return m.gaugeVec.label
+	}
+	return ""
+}
+
+// Registry holds all metrics exposed by satellite
+type Registry struct {
+	mu      sync.RWMutex
+	metrics []metric
+}
+
+// Default is the registry used by the package level functions
+var Default = &Registry{}
+
+// NewCounter registers a new counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(metric{name: name, help: help, counter: c})
+	return c
+}
+
+// NewCounterVec registers a new counter partitioned by label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	r.register(metric{name: name, help: help, vec: v})
+	return v
+}
+
+// NewGauge registers a new gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(metric{name: name, help: help, gauge: g})
+	return g
+}
+
+// NewGaugeVec registers a new gauge partitioned by label
+func (r *Registry) NewGaugeVec(name, help, label string) *GaugeVec {
+	v := &GaugeVec{label: label, gauges: make(map[string]*Gauge)}
+	r.register(metric{name: name, help: help, gaugeVec: v})
+	return v
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, m := range r.metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind()); err != nil {
+			return err
+		}
+
+		label := m.labelName()
+		for _, s := range m.samples() {
+			var err error
+			if label == "" {
+				_, err = fmt.Fprintf(w, "%s %s\n", m.name, s.value)
+			} else {
+				_, err = fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", m.name, label, escapeLabel(s.label), s.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP exposes the registry to a Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Write(w)
+}
+
+// NewCounter registers a new counter in the Default registry
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounterVec registers a new counter partitioned by label in the Default registry
+func NewCounterVec(name, help, label string) *CounterVec {
+	return Default.NewCounterVec(name, help, label)
+}
+
+// NewGauge registers a new gauge in the Default registry
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGaugeVec registers a new gauge partitioned by label in the Default registry
+func NewGaugeVec(name, help, label string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, label)
+}
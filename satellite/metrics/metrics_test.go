@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/metrics"
+)
+
+func TestRegistry_Write_counter(t *testing.T) {
+	r := &Registry{}
+	c := r.NewCounter("test_total", "Test counter")
+	c.Inc()
+	c.Add(2)
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(buf.String(), "test_total 3\n") {
+		t.Error("unexpected output", buf.String())
+	}
+}
+
+func TestRegistry_Write_vec(t *testing.T) {
+	r := &Registry{}
+	v := r.NewCounterVec("test_total", "Test counter", "path")
+	v.With("/index.html").Inc()
+	v.With("/a\"b").Inc()
+	v.With("/index.html").Inc()
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Error(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, `test_total{path="/index.html"} 2`) || !strings.Contains(out, `test_total{path="/a\"b"} 1`) {
+		t.Error("unexpected output", out)
+	}
+}
+
+func TestRegistry_Write_gauge(t *testing.T) {
+	r := &Registry{}
+	g := r.NewGauge("test_up", "Test gauge")
+	g.Set(1)
+	v := r.NewGaugeVec("test_expiry", "Test gauge", "name")
+	v.With("a").Set(-5)
+	v.With("b").Set(7)
+	v.Delete("b")
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Error(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "# TYPE test_up gauge\ntest_up 1\n") || !strings.Contains(out, `test_expiry{name="a"} -5`) || strings.Contains(out, `name="b"`) {
+		t.Error("unexpected output", out)
+	}
+}
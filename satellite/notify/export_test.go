@@ -0,0 +1,18 @@
+package notify
+
+import (
+	"net"
+	"time"
+)
+
+// Allow checks and records if an alert for the path and IP should be sent at time now
+func (n *Notifier) Allow(conf Config, path string, ip net.IP, now time.Time) bool {
+	return n.allow(conf, path, ip, now)
+}
+
+// Seen gets the number of alerts kept for deduplication
+func (n *Notifier) Seen() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.seen)
+}
@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the notification configuration for a path
+type Config struct {
+	// Webhook is the URL which receives a JSON alert when the path is requested
+	Webhook string `yaml:"webhook"`
+	// Dedup is the window in which only one alert is sent per client IP
+	Dedup string `yaml:"dedup,omitempty"`
+	// Limit is the maximum number of alerts sent for the path within the dedup window
+	Limit int `yaml:"limit,omitempty"`
+}
+
+// Enabled returns true when a webhook is configured
+func (c Config) Enabled() bool {
+	return c.Webhook != ""
+}
+
+// Validate ensures the dedup window can be parsed
+func (c Config) Validate() error {
+	if c.Dedup == "" {
+		return nil
+	}
+	if _, err := time.ParseDuration(c.Dedup); err != nil {
+		return errors.Wrap(err, "invalid notify dedup window")
+	}
+	return nil
+}
+
+func (c Config) window() time.Duration {
+	d, err := time.ParseDuration(c.Dedup)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// Alert is the message sent to a webhook
+type Alert struct {
+	Text     string `json:"text"`
+	Path     string `json:"path"`
+	IP       string `json:"ip"`
+	Decision string `json:"decision"`
+	// Links are actions the operator can take on the alert
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// sweepInterval is how often alerts outside their dedup window are forgotten
+const sweepInterval = time.Minute
+
+// seenAlert is when an alert was last sent for a path and IP, and the dedup window it suppresses alerts for
+type seenAlert struct {
+	at     time.Time
+	window time.Duration
+}
+
+// Notifier sends alerts to webhooks while suppressing duplicate alerts
+type Notifier struct {
+	mu sync.Mutex
+	// seen is the last alert sent for a path and IP
+	seen map[string]seenAlert
+	// swept is when seen was last swept of alerts outside their dedup window
+	swept time.Time
+	// sent are the times alerts were sent for a path
+	sent   map[string][]time.Time
+	client *http.Client
+}
+
+// New creates a new Notifier
+func New() *Notifier {
+	return &Notifier{
+		seen:   make(map[string]seenAlert),
+		sent:   make(map[string][]time.Time),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// allow checks and records if an alert for the path and IP should be sent at time now
+func (n *Notifier) allow(conf Config, path string, ip net.IP, now time.Time) bool {
+	window := conf.window()
+	if window == 0 {
+		return true
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if now.Sub(n.swept) >= sweepInterval {
+		n.sweep(now)
+	}
+
+	key := path + "|" + ip.String()
+	if last, ok := n.seen[key]; ok && now.Sub(last.at) < window {
+		return false
+	}
+
+	recent := make([]time.Time, 0, len(n.sent[path]))
+	for _, t := range n.sent[path] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if conf.Limit > 0 && len(recent) >= conf.Limit {
+		n.sent[path] = recent
+		return false
+	}
+
+	n.seen[key] = seenAlert{at: now, window: window}
+	n.sent[path] = append(recent, now)
+	return true
+}
+
+// sweep forgets the alerts which no longer suppress others, so every client IP
+// alerted on is not kept. The lock must be held
+func (n *Notifier) sweep(now time.Time) {
+	for key, last := range n.seen {
+		if now.Sub(last.at) >= last.window {
+			delete(n.seen, key)
+		}
+	}
+	n.swept = now
+}
+
+// Notify sends an alert that ip requested path. It returns false when the
+// alert was suppressed by the dedup window or limit
+func (n *Notifier) Notify(conf Config, path string, ip net.IP, decision string) (bool, error) {
+	if !conf.Enabled() {
+		return false, nil
+	}
+
+	if !n.allow(conf, path, ip, time.Now()) {
+		return false, nil
+	}
+
+	alert := Alert{
+		Text:     fmt.Sprintf("%s requested %s (%s)", ip, path, decision),
+		Path:     path,
+		IP:       ip.String(),
+		Decision: decision,
+	}
+
+	return true, n.Send(conf, alert)
+}
+
+// Send sends an alert to the webhook without deduplication
+func (n *Notifier) Send(conf Config, alert Alert) error {
+	if !conf.Enabled() {
+		return nil
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(conf.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to send notification")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package notify_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/notify"
+)
+
+func createWebhook() (*httptest.Server, *int32) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&count, 1)
+	}))
+	return server, &count
+}
+
+func TestNotifier_Notify_disabled(t *testing.T) {
+	n := New()
+	sent, err := n.Notify(Config{}, "/index.html", net.ParseIP("127.0.0.1"), "served")
+	if err != nil {
+		t.Error(err)
+	}
+	if sent {
+		t.Fail()
+	}
+}
+
+func TestNotifier_Notify_nodedup(t *testing.T) {
+	server, count := createWebhook()
+	defer server.Close()
+
+	n := New()
+	conf := Config{Webhook: server.URL}
+	for i := 0; i < 3; i++ {
+		if _, err := n.Notify(conf, "/index.html", net.ParseIP("127.0.0.1"), "served"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if atomic.LoadInt32(count) != 3 {
+		t.Error("expected 3 notifications, got", atomic.LoadInt32(count))
+	}
+}
+
+func TestNotifier_Notify_dedup(t *testing.T) {
+	server, count := createWebhook()
+	defer server.Close()
+
+	n := New()
+	conf := Config{Webhook: server.URL, Dedup: "1h"}
+	for i := 0; i < 3; i++ {
+		if _, err := n.Notify(conf, "/index.html", net.ParseIP("127.0.0.1"), "served"); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := n.Notify(conf, "/index.html", net.ParseIP("127.0.0.2"), "served"); err != nil {
+		t.Error(err)
+	}
+
+	if atomic.LoadInt32(count) != 2 {
+		t.Error("expected 2 notifications, got", atomic.LoadInt32(count))
+	}
+}
+
+func TestNotifier_Notify_limit(t *testing.T) {
+	server, count := createWebhook()
+	defer server.Close()
+
+	n := New()
+	conf := Config{Webhook: server.URL, Dedup: "1h", Limit: 2}
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+		if _, err := n.Notify(conf, "/index.html", net.ParseIP(ip), "served"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if atomic.LoadInt32(count) != 2 {
+		t.Error("expected 2 notifications, got", atomic.LoadInt32(count))
+	}
+}
+
+func TestNotifier_allow_sweep(t *testing.T) {
+	n := New()
+	conf := Config{Dedup: "1m"}
+	start := time.Now()
+	if !n.Allow(conf, "/index.html", net.ParseIP("127.0.0.1"), start) {
+		t.Error("first alert was suppressed")
+	}
+	if n.Allow(conf, "/index.html", net.ParseIP("127.0.0.1"), start.Add(time.Second)) {
+		t.Error("duplicate alert was sent")
+	}
+
+	// Alerts outside their dedup window are forgotten
+	if !n.Allow(conf, "/index.html", net.ParseIP("127.0.0.2"), start.Add(2*time.Minute)) {
+		t.Error("alert for another IP was suppressed")
+	}
+	if seen := n.Seen(); seen != 1 {
+		t.Errorf("expected 1 alert to be kept, got %d", seen)
+	}
+}
+
+func TestConfig_Validate_fail(t *testing.T) {
+	if err := (Config{Webhook: "http://localhost", Dedup: "abc"}).Validate(); err == nil {
+		t.Fail()
+	}
+}
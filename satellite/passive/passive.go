@@ -0,0 +1,268 @@
+// Package passive fingerprints the operating system of clients from the TCP SYN of their connection
+package passive
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Operating systems guessed from a SYN
+const (
+	OSWindows = "windows"
+	OSLinux   = "linux"
+	OSMacOS   = "macos"
+	OSFreeBSD = "freebsd"
+	OSUnknown = "unknown"
+)
+
+// OSes are the operating systems which can be guessed
+var OSes = []string{OSWindows, OSLinux, OSMacOS, OSFreeBSD, OSUnknown}
+
+// ErrUnsupported is returned when SYNs cannot be saved on this platform
+var ErrUnsupported = errors.New("saving SYNs is not supported on this platform")
+
+// ErrBadSYN is returned when a SYN cannot be parsed
+var ErrBadSYN = errors.New("malformed SYN")
+
+// Fingerprint are the characteristics of the SYN which opened a connection
+type Fingerprint struct {
+	// TTL is the TTL, or hop limit, the SYN arrived with
+	TTL int `json:"ttl"`
+	// InitialTTL is the TTL the SYN was likely sent with
+	InitialTTL int `json:"initial_ttl"`
+	// DontFragment is set when the IPv4 DF flag is set
+	DontFragment bool `json:"dont_fragment"`
+	Window       int  `json:"window"`
+	MSS          int  `json:"mss"`
+	WindowScale  int  `json:"window_scale"`
+	// Options is the order of TCP options, like mss,nop,ws,nop,nop,sok
+	Options string `json:"options"`
+}
+
+// Parse parses the IP and TCP headers of a SYN
+func Parse(syn []byte) (Fingerprint, error) {
+	var f Fingerprint
+	if len(syn) < 1 {
+		return f, ErrBadSYN
+	}
+
+	var tcp []byte
+	switch syn[0] >> 4 {
+	case 4:
+		ihl := int(syn[0]&0x0f) * 4
+		if ihl < 20 || len(syn) < ihl {
+			return f, ErrBadSYN
+		}
+		f.TTL = int(syn[8])
+		f.DontFragment = syn[6]&0x40 != 0
+		tcp = syn[ihl:]
+	case 6:
+		// Extension headers are not followed
+		if len(syn) < 40 || syn[6] != 6 {
+			return f, ErrBadSYN
+		}
+		f.TTL = int(syn[7])
+		tcp = syn[40:]
+	default:
+		return f, ErrBadSYN
+	}
+
+	if len(tcp) < 20 {
+		return f, ErrBadSYN
+	}
+	offset := int(tcp[12]>>4) * 4
+	if offset < 20 || len(tcp) < offset {
+		return f, ErrBadSYN
+	}
+	f.Window = int(binary.BigEndian.Uint16(tcp[14:16]))
+	f.InitialTTL = initialTTL(f.TTL)
+
+	options := make([]string, 0)
+	for opts := tcp[20:offset]; len(opts) > 0; {
+		kind := opts[0]
+		if kind == 0 {
+			options = append(options, "eol")
+			break
+		}
+		if kind == 1 {
+			options = append(options, "nop")
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || int(opts[1]) < 2 || len(opts) < int(opts[1]) {
+			return f, ErrBadSYN
+		}
+		value := opts[2:opts[1]]
+		switch kind {
+		case 2:
+			options = append(options, "mss")
+			if len(value) == 2 {
+				f.MSS = int(binary.BigEndian.Uint16(value))
+			}
+		case 3:
+			options = append(options, "ws")
+			if len(value) == 1 {
+				f.WindowScale = int(value[0])
+			}
+		case 4:
+			options = append(options, "sok")
+		case 8:
+			options = append(options, "ts")
+		default:
+			options = append(options, "?")
+		}
+		opts = opts[opts[1]:]
+	}
+	f.Options = strings.Join(options, ",")
+
+	return f, nil
+}
+
+// initialTTL rounds ttl up to the closest common initial TTL
+func initialTTL(ttl int) int {
+	for _, initial := range []int{32, 64, 128} {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+// OS guesses the operating system which sent the SYN
+func (f Fingerprint) OS() string {
+	switch f.InitialTTL {
+	case 128:
+		return OSWindows
+	case 64:
+		switch {
+		case strings.HasPrefix(f.Options, "mss,nop,ws,nop,nop,ts,sok,eol"):
+			return OSMacOS
+		case strings.HasPrefix(f.Options, "mss,nop,ws,sok,ts"):
+			return OSFreeBSD
+		case strings.HasPrefix(f.Options, "mss,sok,ts,nop,ws"), strings.HasPrefix(f.Options, "mss,nop,nop,sok,nop,ws"):
+			return OSLinux
+		}
+	}
+	return OSUnknown
+}
+
+// UserAgentOS is the operating system a User-Agent claims to run on
+func UserAgentOS(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Windows"):
+		return OSWindows
+	case strings.Contains(userAgent, "Macintosh"), strings.Contains(userAgent, "Mac OS X"),
+		strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		return OSMacOS
+	case strings.Contains(userAgent, "FreeBSD"):
+		return OSFreeBSD
+	case strings.Contains(userAgent, "Linux"), strings.Contains(userAgent, "Android"), strings.Contains(userAgent, "CrOS"):
+		return OSLinux
+	}
+	return OSUnknown
+}
+
+// Registry holds the fingerprints of open connections by remote address
+type Registry struct {
+	mu           sync.RWMutex
+	fingerprints map[string]Fingerprint
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{fingerprints: make(map[string]Fingerprint)}
+}
+
+// Default is the registry connections are recorded in by Listen
+var Default = NewRegistry()
+
+// Set records the fingerprint of the connection from remoteAddr
+func (r *Registry) Set(remoteAddr string, f Fingerprint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fingerprints[remoteAddr] = f
+}
+
+// Get gets the fingerprint of the connection from remoteAddr
+func (r *Registry) Get(remoteAddr string) (Fingerprint, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.fingerprints[remoteAddr]
+	return f, ok
+}
+
+// Delete forgets the connection from remoteAddr
+func (r *Registry) Delete(remoteAddr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.fingerprints, remoteAddr)
+}
+
+// Lookup gets the fingerprint of the connection from remoteAddr in the Default registry
+func Lookup(remoteAddr string) (Fingerprint, bool) {
+	return Default.Get(remoteAddr)
+}
+
+// Listener records the fingerprint of every accepted connection until it is closed
+type Listener struct {
+	*net.TCPListener
+	registry *Registry
+}
+
+// NewListener saves the SYNs of connections accepted by ln, recording them in registry
+func NewListener(ln *net.TCPListener, registry *Registry) (*Listener, error) {
+	if err := saveSYN(ln); err != nil {
+		return nil, err
+	}
+	return &Listener{TCPListener: ln, registry: registry}, nil
+}
+
+// Accept accepts a connection and records its fingerprint
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+
+	syn, err := savedSYN(c)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ip":    c.RemoteAddr(),
+			"error": err,
+		}).Trace("Unable to get saved SYN")
+		return c, nil
+	}
+	f, err := Parse(syn)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ip":    c.RemoteAddr(),
+			"error": err,
+		}).Trace("Unable to parse saved SYN")
+		return c, nil
+	}
+
+	addr := c.RemoteAddr().String()
+	l.registry.Set(addr, f)
+	return &conn{TCPConn: c, registry: l.registry, addr: addr}, nil
+}
+
+// conn forgets its fingerprint when it is closed
+type conn struct {
+	*net.TCPConn
+	registry *Registry
+	addr     string
+	once     sync.Once
+}
+
+// Close closes the connection and forgets its fingerprint
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.registry.Delete(c.addr)
+	})
+	return c.TCPConn.Close()
+}
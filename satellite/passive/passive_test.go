@@ -0,0 +1,84 @@
+package passive_test
+
+import (
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/passive"
+)
+
+// syn builds an IPv4 SYN with the ttl, window, and TCP options
+func syn(ttl byte, window uint16, options []byte) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[6] = 0x40
+	ip[8] = ttl
+	ip[9] = 6
+
+	tcp := make([]byte, 20)
+	tcp[12] = byte((20+len(options))/4) << 4
+	tcp[13] = 0x02
+	tcp[14] = byte(window >> 8)
+	tcp[15] = byte(window)
+
+	return append(append(ip, tcp...), options...)
+}
+
+var (
+	linuxOptions   = []byte{2, 4, 0x05, 0xb4, 4, 2, 8, 10, 0, 0, 0, 1, 0, 0, 0, 0, 1, 3, 3, 7}
+	windowsOptions = []byte{2, 4, 0x05, 0xb4, 1, 3, 3, 8, 1, 1, 4, 2}
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse(syn(52, 64240, linuxOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TTL != 52 || f.InitialTTL != 64 || !f.DontFragment {
+		t.Errorf("unexpected IP fields %+v", f)
+	}
+	if f.Window != 64240 || f.MSS != 1460 || f.WindowScale != 7 {
+		t.Errorf("unexpected TCP fields %+v", f)
+	}
+	if f.Options != "mss,sok,ts,nop,ws" {
+		t.Errorf("unexpected options %s", f.Options)
+	}
+
+	if _, err := Parse([]byte{0x45, 0}); err != ErrBadSYN {
+		t.Error("truncated SYN was parsed")
+	}
+	if _, err := Parse(syn(64, 0, []byte{2, 6, 0x05, 0xb4})); err != ErrBadSYN {
+		t.Error("truncated option was parsed")
+	}
+}
+
+func TestFingerprint_OS(t *testing.T) {
+	for name, tc := range map[string]struct {
+		syn []byte
+		os  string
+	}{
+		"linux":   {syn(57, 64240, linuxOptions), OSLinux},
+		"windows": {syn(116, 64240, windowsOptions), OSWindows},
+		"router":  {syn(250, 4128, []byte{2, 4, 0x05, 0xb4}), OSUnknown},
+	} {
+		f, err := Parse(tc.syn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os := f.OS(); os != tc.os {
+			t.Errorf("%s: expected %s, got %s", name, tc.os, os)
+		}
+	}
+}
+
+func TestUserAgentOS(t *testing.T) {
+	for ua, os := range map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":       OSWindows,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15": OSMacOS,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                                                OSLinux,
+		"curl/8.4.0": OSUnknown,
+	} {
+		if got := UserAgentOS(ua); got != os {
+			t.Errorf("%s: expected %s, got %s", ua, os, got)
+		}
+	}
+}
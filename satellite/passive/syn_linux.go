@@ -0,0 +1,54 @@
+//go:build linux && !386
+// +build linux,!386
+
+package passive
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// Socket options of Linux 4.3 and later to keep the SYN of accepted connections
+const (
+	tcpSaveSYN  = 27
+	tcpSavedSYN = 28
+)
+
+// saveSYN makes the kernel keep the SYN of connections accepted by ln
+func saveSYN(ln *net.TCPListener) error {
+	raw, err := ln.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpSaveSYN, 1)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// savedSYN gets the IP and TCP headers of the SYN which opened c. The kernel
+// only returns the SYN once
+func savedSYN(c *net.TCPConn) ([]byte, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 512)
+	size := uint32(len(buf))
+	var errno syscall.Errno
+	if err := raw.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, tcpSavedSYN,
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)), 0)
+	}); err != nil {
+		return nil, err
+	}
+	if errno != 0 {
+		return nil, errno
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux || 386
+// +build !linux 386
+
+package passive
+
+import "net"
+
+// saveSYN is only supported on Linux
+func saveSYN(ln *net.TCPListener) error {
+	return ErrUnsupported
+}
+
+// savedSYN is only supported on Linux
+func savedSYN(c *net.TCPConn) ([]byte, error) {
+	return nil, ErrUnsupported
+}
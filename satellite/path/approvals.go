@@ -0,0 +1,182 @@
+package path
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Approval statuses
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+// ErrApprovalNotFound is returned when an approval does not exist or has expired
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// Approval is a request which is held until an operator approves or denies it
+type Approval struct {
+	ID        string    `json:"id"`
+	IP        string    `json:"ip"`
+	Path      string    `json:"path"`
+	UserAgent string    `json:"user_agent"`
+	Status    string    `json:"status"`
+	Requested time.Time `json:"requested"`
+	Expires   time.Time `json:"expires"`
+	// Key authorizes the approve and deny links sent to the operator
+	Key string `json:"-"`
+}
+
+// Approvals holds the queue of requests waiting on an operator
+type Approvals struct {
+	mu        sync.Mutex
+	list      map[string]*Approval
+	onRequest func(Approval)
+}
+
+// NewApprovals creates an empty approval queue
+func NewApprovals() *Approvals {
+	return &Approvals{list: make(map[string]*Approval)}
+}
+
+// OnRequest sets the function called when a new approval is queued
+func (a *Approvals) OnRequest(f func(Approval)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onRequest = f
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// expire removes approvals which have passed their TTL. The lock must be held
+func (a *Approvals) expire(now time.Time) {
+	for id, approval := range a.list {
+		if now.After(approval.Expires) {
+			delete(a.list, id)
+		}
+	}
+}
+
+// Check returns true when the IP has been approved for path. When there is no
+// approval for the IP, a pending approval is queued which expires after ttl
+func (a *Approvals) Check(ip net.IP, path, userAgent string, ttl time.Duration) bool {
+	now := time.Now()
+
+	a.mu.Lock()
+	a.expire(now)
+	for _, approval := range a.list {
+		if approval.IP == ip.String() && approval.Path == path {
+			status := approval.Status
+			a.mu.Unlock()
+			return status == ApprovalApproved
+		}
+	}
+
+	approval := &Approval{
+		ID:        randomHex(8),
+		IP:        ip.String(),
+		Path:      path,
+		UserAgent: userAgent,
+		Status:    ApprovalPending,
+		Requested: now,
+		Expires:   now.Add(ttl),
+		Key:       randomHex(16),
+	}
+	a.list[approval.ID] = approval
+	onRequest := a.onRequest
+	a.mu.Unlock()
+
+	if onRequest != nil {
+		onRequest(*approval)
+	}
+	return false
+}
+
+// Decide approves or denies an approval. An approved IP may access the path
+// until the approval expires
+func (a *Approvals) Decide(id string, approve bool) (Approval, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+
+	approval, ok := a.list[id]
+	if !ok {
+		return Approval{}, ErrApprovalNotFound
+	}
+
+	if approve {
+		approval.Status = ApprovalApproved
+	} else {
+		approval.Status = ApprovalDenied
+	}
+	return *approval, nil
+}
+
+// GetWithKey gets an approval for requests authorized by the approval's key
+func (a *Approvals) GetWithKey(id, key string) (Approval, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+
+	approval, ok := a.list[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(approval.Key), []byte(key)) != 1 {
+		return Approval{}, ErrApprovalNotFound
+	}
+	return *approval, nil
+}
+
+// DecideWithKey is Decide for requests authorized by the approval's key
+func (a *Approvals) DecideWithKey(id, key string, approve bool) (Approval, error) {
+	if _, err := a.GetWithKey(id, key); err != nil {
+		return Approval{}, err
+	}
+	return a.Decide(id, approve)
+}
+
+// List returns all approvals which have not expired, oldest first
+func (a *Approvals) List() []Approval {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.expire(time.Now())
+
+	list := make([]Approval, 0, len(a.list))
+	for _, approval := range a.list {
+		list = append(list, *approval)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Requested.Before(list[j].Requested)
+	})
+	return list
+}
+
+// Purge removes approvals requested before cutoff. It returns the number removed
+func (a *Approvals) Purge(cutoff time.Time) int {
+	return a.purge(before(cutoff))
+}
+
+// purge removes the approvals expired returns true for. It returns the number removed
+func (a *Approvals) purge(expired func(path string, t time.Time) bool) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	purged := 0
+	for id, approval := range a.list {
+		if expired(approval.Path, approval.Requested) {
+			delete(a.list, id)
+			purged++
+		}
+	}
+	return purged
+}
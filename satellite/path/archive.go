@@ -0,0 +1,374 @@
+package path
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCampaignNotFound is returned when no path in the path list has the campaign
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// CampaignStats are the totals of a campaign kept in its archive
+type CampaignStats struct {
+	Campaign string    `json:"campaign"`
+	Archived time.Time `json:"archived"`
+	// Today is what the campaign used of its quotas today
+	Today CampaignUsage `json:"today"`
+	// Decisions are the number of requests served, denied, and rate limited
+	Decisions map[string]int `json:"decisions"`
+	// Served are the times each URI of the campaign was served
+	Served map[string]uint64 `json:"served"`
+}
+
+// campaignList is the path list split into the rules of a campaign and the others
+type campaignList struct {
+	// head is the text before the first rule
+	head []byte
+	// kept and archived are the text of the other rules and of the campaign's rules,
+	// with their comments
+	kept, archived [][]byte
+	// keptRules and rules are the parsed other rules and campaign's rules
+	keptRules, rules []*Path
+}
+
+// isRuleStart checks whether line starts a rule of the path list
+func isRuleStart(line []byte) bool {
+	return len(line) > 0 && line[0] == '-' && (len(line) == 1 || line[1] == ' ' || line[1] == '\n' || line[1] == '\r')
+}
+
+// splitPathList splits the raw path list into the text before its first rule and
+// the text of each rule. Comments right above a rule belong to it, and comments
+// separated from it by a blank line belong to the text above
+func splitPathList(data []byte) (head []byte, rules [][]byte) {
+	var current, pending []byte
+	started := false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		switch {
+		case len(trimmed) == 0 || line[0] == '#':
+			pending = append(pending, line...)
+		case isRuleStart(line):
+			split := 0
+			for offset, l := 0, pending; len(l) > 0; {
+				end := bytes.IndexByte(l, '\n') + 1
+				if end == 0 {
+					end = len(l)
+				}
+				offset += end
+				if len(bytes.TrimSpace(l[:end])) == 0 {
+					split = offset
+				}
+				l = l[end:]
+			}
+			if started {
+				rules = append(rules, append(current, pending[:split]...))
+			} else {
+				head = append(head, pending[:split]...)
+			}
+			current = append(append([]byte{}, pending[split:]...), line...)
+			pending = nil
+			started = true
+		case started:
+			current = append(append(current, pending...), line...)
+			pending = nil
+		default:
+			head = append(append(head, pending...), line...)
+			pending = nil
+		}
+	}
+	if started {
+		rules = append(rules, append(current, pending...))
+	} else {
+		head = append(head, pending...)
+	}
+	return head, rules
+}
+
+// campaignRules splits the path list into the rules of campaign and the others,
+// keeping the text of each rule so the path list is edited without losing comments
+func (paths *Paths) campaignRules(campaign string) (campaignList, error) {
+	var list campaignList
+	data, err := ioutil.ReadFile(paths.pathsList)
+	if err != nil {
+		return list, err
+	}
+	all, err := NewPathArrayData(data)
+	if err != nil {
+		return list, err
+	}
+
+	head, rules := splitPathList(data)
+	if len(rules) != len(all) {
+		return list, errors.New("unable to split the path list into rules")
+	}
+	list.head = head
+	for _, text := range rules {
+		parsed, err := NewPathArrayData(text)
+		if err != nil || len(parsed) != 1 {
+			return list, errors.New("unable to split the path list into rules")
+		}
+		if parsed[0].Campaign == campaign {
+			list.archived = append(list.archived, text)
+			list.rules = append(list.rules, parsed[0])
+		} else {
+			list.kept = append(list.kept, text)
+			list.keptRules = append(list.keptRules, parsed[0])
+		}
+	}
+	if len(list.rules) == 0 {
+		return list, ErrCampaignNotFound
+	}
+	return list, nil
+}
+
+// inCampaign checks whether uri is routed to a path of campaign
+func (paths *Paths) inCampaign(uri, campaign string) bool {
+	matched, ok := paths.Match(uri)
+	return ok && matched.Campaign == campaign
+}
+
+// campaignState gets the state DB entries of campaign by key, which are the serve
+// counters of its URIs and its decisions in client timelines. The decisions are
+// returned oldest first
+func (paths *Paths) campaignState(campaign string, rules []*Path) (map[string][]byte, []Hit, error) {
+	s := paths.state
+	var keys [][]byte
+	err := s.db.Scan([]byte(timelinePrefix), func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, s.check(err)
+	}
+
+	entries := make(map[string][]byte)
+	hits := make([]Hit, 0)
+	uris := make(map[string]bool)
+	for _, v := range rules {
+		uris[v.Path] = true
+	}
+	for _, key := range keys {
+		v, err := s.db.Get(key)
+		if err != nil {
+			return nil, nil, s.check(err)
+		}
+		var hit Hit
+		if err := json.Unmarshal(v, &hit); err != nil || !paths.inCampaign(hit.Path, campaign) {
+			continue
+		}
+		entries[string(key)] = v
+		hits = append(hits, hit)
+		uris[hit.Path] = true
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Time.Before(hits[j].Time)
+	})
+
+	for uri := range uris {
+		if !s.exists(uri) {
+			continue
+		}
+		v, err := s.db.Get([]byte(uri))
+		if err != nil {
+			return nil, nil, s.check(err)
+		}
+		entries[uri] = v
+	}
+	return entries, hits, nil
+}
+
+// Archive writes a gzipped tar of everything campaign left on the server to w. It
+// holds the campaign's rules as pathList.yml, its hosted files under files/, its
+// decisions as hits.jsonl, its journaled decisions as journal.jsonl, its totals as
+// stats.json, and its state DB entries as state.json
+func (paths *Paths) Archive(campaign string, w io.Writer) error {
+	list, err := paths.campaignRules(campaign)
+	if err != nil {
+		return err
+	}
+	return paths.archive(campaign, list, w)
+}
+
+// ArchiveAndWipe writes the archive of campaign to w and wipes campaign from the
+// server, without any decision being made in between. w holds the archive even
+// when the wipe fails
+func (paths *Paths) ArchiveAndWipe(campaign string, w io.Writer) error {
+	paths.recordMu.Lock()
+	defer paths.recordMu.Unlock()
+
+	list, err := paths.campaignRules(campaign)
+	if err != nil {
+		return err
+	}
+	if err := paths.archive(campaign, list, w); err != nil {
+		return err
+	}
+	return paths.wipe(campaign, list)
+}
+
+func (paths *Paths) archive(campaign string, list campaignList, w io.Writer) error {
+	entries, hits, err := paths.campaignState(campaign, list.rules)
+	if err != nil {
+		return err
+	}
+	var journal bytes.Buffer
+	err = paths.state.Hits().journaled(func(hit Hit) bool {
+		return paths.inCampaign(hit.Path, campaign)
+	}, false, &journal)
+	if err != nil {
+		return errors.Wrap(err, "unable to read the journal")
+	}
+
+	stats := CampaignStats{
+		Campaign:  campaign,
+		Archived:  time.Now(),
+		Today:     paths.campaigns.Usage()[campaign],
+		Decisions: make(map[string]int),
+		Served:    make(map[string]uint64),
+	}
+	for _, hit := range hits {
+		stats.Decisions[hit.Decision]++
+	}
+	for key := range entries {
+		if !strings.HasPrefix(key, timelinePrefix) {
+			stats.Served[key], _ = paths.state.GetHits(key)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: stats.Archived}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := add("pathList.yml", bytes.Join(list.archived, nil)); err != nil {
+		return err
+	}
+	for _, file := range hostedFiles(list.rules) {
+		data, err := ioutil.ReadFile(path.Join(paths.base, file))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := add(path.Join("files", file), data); err != nil {
+			return err
+		}
+	}
+
+	var lines []byte
+	for _, hit := range hits {
+		line, err := json.Marshal(hit)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if err := add("hits.jsonl", lines); err != nil {
+		return err
+	}
+	if err := add("journal.jsonl", journal.Bytes()); err != nil {
+		return err
+	}
+	for name, v := range map[string]interface{}{"stats.json": stats, "state.json": entries} {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := add(name, data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WipeCampaign removes campaign from the server: its rules are removed from the
+// path list, the hosted files no other path serves are deleted, and its state DB
+// entries, decisions, and journaled decisions are forgotten. The paths are reloaded after
+func (paths *Paths) WipeCampaign(campaign string) error {
+	paths.recordMu.Lock()
+	defer paths.recordMu.Unlock()
+
+	list, err := paths.campaignRules(campaign)
+	if err != nil {
+		return err
+	}
+	return paths.wipe(campaign, list)
+}
+
+func (paths *Paths) wipe(campaign string, list campaignList) error {
+	entries, _, err := paths.campaignState(campaign, list.rules)
+	if err != nil {
+		return err
+	}
+
+	// Only the campaign's rules are removed, so the comments of the others are kept
+	pathList := append(append([]byte{}, list.head...), bytes.Join(list.kept, nil)...)
+	if err := ioutil.WriteFile(paths.pathsList, pathList, 0644); err != nil {
+		return err
+	}
+
+	shared := make(map[string]bool)
+	for _, file := range hostedFiles(list.keptRules) {
+		shared[file] = true
+	}
+	for _, file := range hostedFiles(list.rules) {
+		if shared[file] {
+			continue
+		}
+		if err := os.Remove(path.Join(paths.base, file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for key := range entries {
+		if err := paths.state.check(paths.state.db.Delete([]byte(key))); err != nil {
+			return err
+		}
+		if seen := seenKey([]byte(key)); paths.state.db.Has(seen) {
+			if err := paths.state.check(paths.state.db.Delete(seen)); err != nil {
+				return err
+			}
+		}
+	}
+	inCampaign := func(hit Hit) bool {
+		return paths.inCampaign(hit.Path, campaign)
+	}
+	paths.state.Hits().remove(inCampaign)
+	if err := paths.state.Hits().journaled(inCampaign, true, nil); err != nil {
+		return errors.Wrap(err, "unable to remove the campaign from the journal")
+	}
+
+	return paths.Reload()
+}
+
+// hostedFiles gets the hosted files of rules, which can not be outside the server root
+func hostedFiles(rules []*Path) []string {
+	files := make([]string, 0, len(rules))
+	for _, v := range rules {
+		if v.HostedFile != "" {
+			files = append(files, path.Clean("/"+v.HostedFile))
+		}
+	}
+	return files
+}
@@ -0,0 +1,123 @@
+package path_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/logfile"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_Archive(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreateFile("keep.html", "keep")
+	tmpdir.CreatePathList(`# Engagement paths
+
+# Phishing landing page
+- path: /index.html
+  hosted_file: /index.html
+  campaign: q3
+# Kept after the campaign
+- path: /keep.html
+  # Hosted from the server root
+  hosted_file: /keep.html
+`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := logfile.Open(filepath.Join(tmpdir.Path, "journal.json"), logfile.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	paths.Hits().SetJournal(journal)
+
+	for _, uri := range []string{"/index.html", "/keep.html"} {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if _, err := paths.MatchAndServe(httptest.NewRecorder(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := paths.ArchiveAndWipe("q3", &archive); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(tr)
+		files[header.Name] = string(data)
+	}
+	if files["pathList.yml"] != "# Phishing landing page\n- path: /index.html\n  hosted_file: /index.html\n  campaign: q3\n" {
+		t.Errorf("unexpected archived path list %q", files["pathList.yml"])
+	}
+	if files["files/index.html"] != Sentinal {
+		t.Errorf("hosted file was not archived: %v", files)
+	}
+	if strings.Count(files["hits.jsonl"], "\n") != 1 || !strings.Contains(files["hits.jsonl"], `"path":"/index.html"`) {
+		t.Errorf("unexpected archived hits %q", files["hits.jsonl"])
+	}
+	if strings.Count(files["journal.jsonl"], "\n") != 1 || !strings.Contains(files["journal.jsonl"], `"path":"/index.html"`) {
+		t.Errorf("unexpected archived journal %q", files["journal.jsonl"])
+	}
+	if !strings.Contains(files["stats.json"], `"served": 1`) {
+		t.Errorf("unexpected archived stats %q", files["stats.json"])
+	}
+
+	// Only the campaign's rules are cut from the path list
+	if data, _ := ioutil.ReadFile(filepath.Join(tmpdir.Path, "pathList.yml")); string(data) != `# Engagement paths
+
+# Kept after the campaign
+- path: /keep.html
+  # Hosted from the server root
+  hosted_file: /keep.html
+` {
+		t.Errorf("unexpected path list after wipe %q", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(tmpdir.Path, "journal.json")); strings.Contains(string(data), "/index.html") || !strings.Contains(string(data), "/keep.html") {
+		t.Errorf("unexpected journal after wipe %q", data)
+	}
+	if _, ok := paths.Match("/index.html"); ok {
+		t.Error("wiped path is still served")
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir.Path, "index.html")); !os.IsNotExist(err) {
+		t.Error("hosted file of the wiped path was not deleted")
+	}
+	if _, ok := paths.Match("/keep.html"); !ok {
+		t.Error("path of no campaign was wiped")
+	}
+	if timeline, _ := paths.Timeline("192.0.2.1", ""); len(timeline.Hits) != 1 || timeline.Hits[0].Path != "/keep.html" {
+		t.Errorf("unexpected timeline after wipe %+v", timeline.Hits)
+	}
+	if err := paths.Archive("q3", ioutil.Discard); err != ErrCampaignNotFound {
+		t.Errorf("expected ErrCampaignNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package path
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultRealm is the realm clients are challenged with when basic_auth.realm is not set
+const defaultRealm = "Restricted"
+
+// ErrUnsupportedHash is returned for htpasswd entries which are not hashed with bcrypt or SHA1
+var ErrUnsupportedHash = errors.New("htpasswd entry is not hashed with bcrypt or SHA1")
+
+// basicAuthEnabled returns true if clients must send basic credentials
+func (c *RequestConditions) basicAuthEnabled() bool {
+	return c.BasicAuth.Username != "" || c.BasicAuth.Htpasswd != ""
+}
+
+// basicAuthChallenge challenges clients which have not sent basic credentials.
+// It returns true when a challenge was written to w
+func basicAuthChallenge(w http.ResponseWriter, req *http.Request, conditions RequestConditions) bool {
+	if _, _, ok := req.BasicAuth(); ok {
+		return false
+	}
+
+	realm := conditions.BasicAuth.Realm
+	if realm == "" {
+		realm = defaultRealm
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+	w.WriteHeader(http.StatusUnauthorized)
+	return true
+}
+
+// basicAuthMatch checks the basic credentials sent by the client against the
+// username and password, then the htpasswd file
+func (c *RequestConditions) basicAuthMatch(req *http.Request) bool {
+	if !c.basicAuthEnabled() {
+		log.Trace("No basic auth")
+		return true
+	}
+
+	user, pass, ok := req.BasicAuth()
+	if !ok {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Trace("No basic credentials")
+		return false
+	}
+
+	fields := log.Fields{
+		"ip":   req.RemoteAddr,
+		"user": user,
+	}
+	if c.BasicAuth.Username != "" && user == c.BasicAuth.Username &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(c.BasicAuth.Password)) == 1 {
+		log.WithFields(fields).Debug("Basic credentials matched")
+		return true
+	}
+
+	if c.BasicAuth.Htpasswd != "" {
+		matched, err := checkHtpasswd(c.BasicAuth.Htpasswd, user, pass)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"htpasswd": c.BasicAuth.Htpasswd,
+				"user":     user,
+				"error":    err,
+			}).Error("Unable to check htpasswd")
+			return false
+		}
+		if matched {
+			log.WithFields(fields).Debug("htpasswd credentials matched")
+			return true
+		}
+	}
+
+	log.WithFields(fields).Debug("Basic credentials not authorized")
+	return false
+}
+
+// checkHtpasswd checks user and pass against the entries of an htpasswd file
+func checkHtpasswd(file, user, pass string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] != user {
+			continue
+		}
+		return checkHash(parts[1], pass)
+	}
+	return false, scanner.Err()
+}
+
+// checkHash checks pass against an htpasswd hash
+func checkHash(hash, pass string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil, nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(expected)) == 1, nil
+	}
+	return false, ErrUnsupportedHash
+}
@@ -0,0 +1,72 @@
+package path_test
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	"golang.org/x/crypto/bcrypt"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_MatchAndServe_basic_auth(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SHA1 entry is bob:secret
+	tmpdir.CreateFile("htpasswd", "# operators\nalice:"+string(hash)+"\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload
+  hosted_file: payload
+  basic_auth:
+    username: operator
+    password: tools
+    htpasswd: ` + filepath.Join(tmpdir.Path, "htpasswd") + `
+    realm: cache`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clients without credentials are challenged
+	req := httptest.NewRequest("GET", "/payload", nil)
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="cache"` {
+		t.Error("client was not challenged")
+	}
+
+	for _, tc := range []struct {
+		user, pass string
+		served     bool
+	}{
+		{"operator", "tools", true},
+		{"alice", "hunter2", true},
+		{"bob", "secret", true},
+		{"operator", "wrong", false},
+		{"alice", "tools", false},
+		{"mallory", "hunter2", false},
+	} {
+		req := httptest.NewRequest("GET", "/payload", nil)
+		req.SetBasicAuth(tc.user, tc.pass)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		if served := w.Body.String() == Sentinal; served != tc.served {
+			t.Errorf("%s:%s: expected served %t, got %t", tc.user, tc.pass, tc.served, served)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package path
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/metrics"
+)
+
+var (
+	campaignServes        = metrics.NewCounterVec("satellite_campaign_serves_total", "Paths served per campaign", "campaign")
+	campaignBytes         = metrics.NewCounterVec("satellite_campaign_bytes_total", "Response bytes served per campaign", "campaign")
+	campaignNotifications = metrics.NewCounterVec("satellite_campaign_notifications_total", "Notifications sent per campaign", "campaign")
+	campaignQuotaExceeded = metrics.NewCounterVec("satellite_campaign_quota_exceeded_total", "Serves and notifications rejected because a campaign quota was used up", "campaign")
+)
+
+// QuotaConfig are the daily quotas of a campaign. Zero is unlimited
+type QuotaConfig struct {
+	// BandwidthPerDay is the number of response bytes served per day
+	BandwidthPerDay int64 `mapstructure:"bandwidth_per_day"`
+	// ServesPerDay is the number of times the campaign's paths are served per day
+	ServesPerDay int `mapstructure:"serves_per_day"`
+	// NotificationsPerDay is the number of notifications sent for the campaign's paths per day
+	NotificationsPerDay int `mapstructure:"notifications_per_day"`
+}
+
+// Validate ensures the quotas are not negative
+func (q QuotaConfig) Validate() error {
+	if q.BandwidthPerDay < 0 || q.ServesPerDay < 0 || q.NotificationsPerDay < 0 {
+		return errors.New("campaign quotas must not be negative")
+	}
+	return nil
+}
+
+// CampaignUsage is what a campaign used today
+type CampaignUsage struct {
+	Serves        int   `json:"serves"`
+	Bytes         int64 `json:"bytes"`
+	Notifications int   `json:"notifications"`
+}
+
+// Campaigns enforces the daily quotas of campaigns, which group the paths sharing a
+// campaign name, so one campaign cannot starve the others. Usage resets at midnight UTC
+// and is kept in memory
+type Campaigns struct {
+	mu     sync.Mutex
+	quotas map[string]QuotaConfig
+	// day is the UTC date usage is counted for
+	day   string
+	usage map[string]*CampaignUsage
+}
+
+// NewCampaigns creates the campaigns with quotas by campaign name
+func NewCampaigns(quotas map[string]QuotaConfig) (*Campaigns, error) {
+	for name, q := range quotas {
+		if err := q.Validate(); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("campaign %s", name))
+		}
+	}
+	return &Campaigns{quotas: quotas, usage: make(map[string]*CampaignUsage)}, nil
+}
+
+// today gets the usage of campaign today. c.mu must be held
+func (c *Campaigns) today(campaign string, now time.Time) *CampaignUsage {
+	if day := now.UTC().Format("2006-01-02"); day != c.day {
+		c.day = day
+		c.usage = make(map[string]*CampaignUsage)
+	}
+	u, ok := c.usage[campaign]
+	if !ok {
+		u = &CampaignUsage{}
+		c.usage[campaign] = u
+	}
+	return u
+}
+
+// Serve checks the serve and bandwidth quotas of campaign on the day of now and
+// counts a serve when they are not used up. Paths without a campaign are always served
+func (c *Campaigns) Serve(campaign string, now time.Time) bool {
+	if c == nil || campaign == "" {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := c.quotas[campaign]
+	u := c.today(campaign, now)
+	if (q.ServesPerDay > 0 && u.Serves >= q.ServesPerDay) || (q.BandwidthPerDay > 0 && u.Bytes >= q.BandwidthPerDay) {
+		log.WithFields(log.Fields{
+			"campaign": campaign,
+			"serves":   u.Serves,
+			"bytes":    u.Bytes,
+		}).Warn("Campaign quota used up")
+		campaignQuotaExceeded.With(campaign).Inc()
+		return false
+	}
+	u.Serves++
+	campaignServes.With(campaign).Inc()
+	return true
+}
+
+// Notify checks the notification quota of campaign and counts a notification when it
+// is not used up
+func (c *Campaigns) Notify(campaign string) bool {
+	if c == nil || campaign == "" {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := c.quotas[campaign]
+	u := c.today(campaign, time.Now())
+	if q.NotificationsPerDay > 0 && u.Notifications >= q.NotificationsPerDay {
+		log.WithFields(log.Fields{
+			"campaign":      campaign,
+			"notifications": u.Notifications,
+		}).Debug("Campaign notification quota used up")
+		campaignQuotaExceeded.With(campaign).Inc()
+		return false
+	}
+	u.Notifications++
+	campaignNotifications.With(campaign).Inc()
+	return true
+}
+
+// addBytes counts n bytes served for campaign
+func (c *Campaigns) addBytes(campaign string, n int) {
+	if c == nil || campaign == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.today(campaign, time.Now()).Bytes += int64(n)
+	campaignBytes.With(campaign).Add(uint64(n))
+}
+
+// Usage gets what every campaign used today
+func (c *Campaigns) Usage() map[string]CampaignUsage {
+	usage := make(map[string]CampaignUsage)
+	if c == nil {
+		return usage
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.quotas {
+		usage[name] = *c.today(name, time.Now())
+	}
+	for name, u := range c.usage {
+		usage[name] = *u
+	}
+	return usage
+}
+
+// campaignWriter counts the bytes written for a campaign
+type campaignWriter struct {
+	http.ResponseWriter
+	campaigns *Campaigns
+	campaign  string
+}
+
+func (w *campaignWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.campaigns.addBytes(w.campaign, n)
+	return n, err
+}
+
+// Flush flushes proxied responses which are streamed
+func (w *campaignWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writer counts the bytes written to w against the bandwidth of campaign
+func (c *Campaigns) writer(w http.ResponseWriter, campaign string) http.ResponseWriter {
+	if c == nil || campaign == "" {
+		return w
+	}
+	return &campaignWriter{ResponseWriter: w, campaigns: c, campaign: campaign}
+}
@@ -0,0 +1,85 @@
+package path_test
+
+import (
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_SetCampaigns(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /serves.exe
+  hosted_file: payload
+  campaign: serves
+- path: /bandwidth.exe
+  hosted_file: payload
+  campaign: bandwidth
+- path: /other.exe
+  hosted_file: payload`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	campaigns, err := NewCampaigns(map[string]QuotaConfig{
+		"serves":    {ServesPerDay: 2},
+		"bandwidth": {BandwidthPerDay: int64(len(Sentinal))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths.SetCampaigns(campaigns)
+
+	served := func(uri string) bool {
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, httptest.NewRequest("GET", uri, nil)); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	for i, expected := range []bool{true, true, false} {
+		if served("/serves.exe") != expected {
+			t.Errorf("serve %d: expected %t", i, expected)
+		}
+	}
+	for i, expected := range []bool{true, false} {
+		if served("/bandwidth.exe") != expected {
+			t.Errorf("bandwidth serve %d: expected %t", i, expected)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if !served("/other.exe") {
+			t.Error("path without a campaign was limited")
+		}
+	}
+
+	usage := campaigns.Usage()
+	if usage["serves"].Serves != 2 || usage["bandwidth"].Bytes != int64(len(Sentinal)) {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestCampaigns_Notify(t *testing.T) {
+	campaigns, err := NewCampaigns(map[string]QuotaConfig{"loud": {NotificationsPerDay: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !campaigns.Notify("loud") || campaigns.Notify("loud") {
+		t.Error("notification quota was not enforced")
+	}
+	if !campaigns.Notify("quiet") {
+		t.Error("campaign without a quota was limited")
+	}
+
+	if _, err := NewCampaigns(map[string]QuotaConfig{"bad": {ServesPerDay: -1}}); err == nil {
+		t.Error("negative quota was accepted")
+	}
+}
@@ -0,0 +1,136 @@
+package path
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/t94j0/satellite/net/http"
+)
+
+// Client hello capture limits
+const (
+	// MaxCaptures is the number of client hellos kept for each path before its oldest is overwritten
+	MaxCaptures = 256
+	// MaxCaptureSize is the largest client hello stored. Larger hellos are truncated
+	MaxCaptureSize = 16 << 10
+)
+
+// Capture is a raw TLS client hello sent by a client which requested a path
+type Capture struct {
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	Path      string    `json:"path"`
+	UserAgent string    `json:"user_agent"`
+	JA3       string    `json:"ja3"`
+	JA3S      string    `json:"ja3s"`
+	Truncated bool      `json:"truncated"`
+	// ClientHello is the raw handshake message, base64 encoded in JSON
+	ClientHello []byte `json:"client_hello"`
+}
+
+// captureRing is a fixed size ring buffer of client hellos
+type captureRing struct {
+	list []Capture
+	next int
+}
+
+// Captures are fixed size ring buffers of client hellos, one for each path of the
+// path list, so a busy path does not overwrite the captures of the others
+type Captures struct {
+	mu    sync.Mutex
+	rings map[string]*captureRing
+}
+
+// NewCaptures creates an empty capture archive
+func NewCaptures() *Captures {
+	return &Captures{rings: make(map[string]*captureRing)}
+}
+
+// Add stores the client hello from req in the ring of path, the path list entry
+// req matched. Requests without a TLS client hello are ignored
+func (c *Captures) Add(path string, req *http.Request) {
+	if len(req.ClientHello) == 0 || req.URL == nil {
+		return
+	}
+
+	hello := req.ClientHello
+	truncated := len(hello) > MaxCaptureSize
+	if truncated {
+		hello = hello[:MaxCaptureSize]
+	}
+
+	capture := Capture{
+		Time:        time.Now(),
+		IP:          parseRemoteAddr(req.RemoteAddr).String(),
+		Path:        req.URL.Path,
+		UserAgent:   req.UserAgent(),
+		JA3:         req.JA3Fingerprint,
+		JA3S:        req.JA3SFingerprint,
+		Truncated:   truncated,
+		ClientHello: append([]byte(nil), hello...),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ring, ok := c.rings[path]
+	if !ok {
+		ring = &captureRing{}
+		c.rings[path] = ring
+	}
+	if len(ring.list) < MaxCaptures {
+		ring.list = append(ring.list, capture)
+		return
+	}
+	ring.list[ring.next] = capture
+	ring.next = (ring.next + 1) % MaxCaptures
+}
+
+// List returns the stored client hellos from oldest to newest. When path is
+// not empty, only captures for path are returned
+func (c *Captures) List(path string) []Capture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := make([]Capture, 0)
+	for _, ring := range c.rings {
+		for i := range ring.list {
+			capture := ring.list[(ring.next+i)%len(ring.list)]
+			if path == "" || capture.Path == path {
+				ret = append(ret, capture)
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return ret
+}
+
+// Purge removes client hellos captured before cutoff. It returns the number removed
+func (c *Captures) Purge(cutoff time.Time) int {
+	return c.purge(before(cutoff))
+}
+
+// purge removes the client hellos expired returns true for. It returns the number removed
+func (c *Captures) purge(expired func(path string, t time.Time) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for path, ring := range c.rings {
+		kept := make([]Capture, 0, len(ring.list))
+		for i := range ring.list {
+			if capture := ring.list[(ring.next+i)%len(ring.list)]; !expired(capture.Path, capture.Time) {
+				kept = append(kept, capture)
+			}
+		}
+		purged += len(ring.list) - len(kept)
+		if len(kept) == 0 {
+			delete(c.rings, path)
+			continue
+		}
+		ring.list, ring.next = kept, 0
+	}
+	return purged
+}
@@ -0,0 +1,56 @@
+package path_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestCaptures_Add(t *testing.T) {
+	captures := NewCaptures()
+
+	// Plain HTTP requests have no client hello
+	captures.Add("/", httptest.NewRequest("GET", "/", nil))
+	if len(captures.List("")) != 0 {
+		t.Error("request without a client hello was captured")
+	}
+
+	req := httptest.NewRequest("GET", "/payload", nil)
+	req.ClientHello = bytes.Repeat([]byte{0x16}, MaxCaptureSize+1)
+	captures.Add("/payload", req)
+
+	list := captures.List("/payload")
+	if len(list) != 1 || !list[0].Truncated || len(list[0].ClientHello) != MaxCaptureSize {
+		t.Error("client hello was not truncated")
+	}
+	if len(captures.List("/other")) != 0 {
+		t.Error("captures were not filtered by path")
+	}
+}
+
+func TestCaptures_Add_ring(t *testing.T) {
+	captures := NewCaptures()
+
+	quiet := httptest.NewRequest("GET", "/quiet", nil)
+	quiet.ClientHello = []byte{0x16}
+	captures.Add("/quiet", quiet)
+	for i := 0; i < MaxCaptures+10; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d", i), nil)
+		req.ClientHello = []byte{0x16}
+		captures.Add("/files/*", req)
+	}
+
+	list := captures.List("")
+	if len(list) != MaxCaptures+1 {
+		t.Error("capture archive grew past its size:", len(list))
+	}
+	if list[0].Path != "/quiet" {
+		t.Error("a busy path overwrote the captures of another")
+	}
+	if list[1].Path != "/files/10" || list[len(list)-1].Path != fmt.Sprintf("/files/%d", MaxCaptures+9) {
+		t.Error("oldest captures were not overwritten first")
+	}
+}
@@ -2,34 +2,87 @@ package path
 
 import (
 	"net"
+	"sync"
+	"time"
 )
 
-// ClientID is client identification
+// clientHit is a target a client hit and when
+type clientHit struct {
+	path string
+	at   time.Time
+}
+
+// ClientID is client identification. Clients are identified by their IP, or
+// by a key like their session
 type ClientID struct {
-	list map[string][]string
+	mu   sync.Mutex
+	list map[string][]clientHit
+	// seen is when each client last hit a target
+	seen map[string]time.Time
 }
 
 // NewClientID creates a new ClientID object
 func NewClientID() *ClientID {
 	return &ClientID{
-		list: make(map[string][]string),
+		list: make(map[string][]clientHit),
+		seen: make(map[string]time.Time),
 	}
 }
 
+// ipKey is the key of the client at ip
+func ipKey(ip net.IP) string {
+	return "ip:" + ip.String()
+}
+
 // Hit notifies ClientID that an IP hit a target
 func (c *ClientID) Hit(ip net.IP, path string) {
-	ipstr := ip.String()
-	c.list[ipstr] = append(c.list[ipstr], path)
+	c.HitKey(ipKey(ip), path, time.Now())
+}
+
+// HitKey notifies ClientID that the client identified by key hit a target at now
+func (c *ClientID) HitKey(key, path string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list[key] = append(c.list[key], clientHit{path: path, at: now})
+	c.seen[key] = now
+}
+
+// Purge forgets clients which have not hit a target since cutoff. It returns the number of clients forgotten
+func (c *ClientID) Purge(cutoff time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := 0
+	for key, seen := range c.seen {
+		if seen.Before(cutoff) {
+			delete(c.list, key)
+			delete(c.seen, key)
+			purged++
+		}
+	}
+	return purged
 }
 
 // Match asks ClientID if the target IP has succeeded in hitting the prereqs
 func (c *ClientID) Match(ip net.IP, targetList []string) bool {
+	return c.MatchKeyWithin(ipKey(ip), targetList, 0, time.Now())
+}
+
+// MatchWithin asks ClientID if the target IP has hit the prereqs, in order, as
+// its latest hits, and hit the first of them no longer than within ago. A
+// within of 0 does not limit when the prereqs were hit
+func (c *ClientID) MatchWithin(ip net.IP, targetList []string, within time.Duration) bool {
+	return c.MatchKeyWithin(ipKey(ip), targetList, within, time.Now())
+}
+
+// MatchKeyWithin is MatchWithin for the client identified by key, at now
+func (c *ClientID) MatchKeyWithin(key string, targetList []string, within time.Duration, now time.Time) bool {
 	if len(targetList) == 0 {
 		return true
 	}
 
-	ipstr := ip.String()
-	list, ok := c.list[ipstr]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, ok := c.list[key]
 	if !ok {
 		return false
 	}
@@ -38,13 +91,17 @@ func (c *ClientID) Match(ip net.IP, targetList []string) bool {
 		return false
 	}
 
-	lastSubset := list[len(list)-len(targetList) : ]
+	lastSubset := list[len(list)-len(targetList):]
 
 	for i := range lastSubset {
-		if lastSubset[i] != targetList[i] {
+		if lastSubset[i].path != targetList[i] {
 			return false
 		}
 	}
 
+	if within != 0 && now.Sub(lastSubset[0].at) > within {
+		return false
+	}
+
 	return true
 }
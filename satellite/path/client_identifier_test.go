@@ -3,6 +3,7 @@ package path_test
 import (
 	"net"
 	"testing"
+	"time"
 
 	. "github.com/t94j0/satellite/satellite/path"
 )
@@ -89,3 +90,20 @@ func TestClientID_match_four_mod_fail(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestClientID_match_within(t *testing.T) {
+	cid := NewClientID()
+	cid.Hit(net.ParseIP("127.0.0.1"), "/landing")
+	cid.Hit(net.ParseIP("127.0.0.1"), "/stage1")
+	if !cid.MatchWithin(net.ParseIP("127.0.0.1"), []string{"/landing", "/stage1"}, time.Minute) {
+		t.Error("chain within the window did not match")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if cid.MatchWithin(net.ParseIP("127.0.0.1"), []string{"/landing", "/stage1"}, 10*time.Millisecond) {
+		t.Error("chain outside the window matched")
+	}
+	if !cid.MatchWithin(net.ParseIP("127.0.0.1"), []string{"/landing", "/stage1"}, 0) {
+		t.Error("chain without a window did not match")
+	}
+}
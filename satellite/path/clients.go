@@ -0,0 +1,67 @@
+package path
+
+import (
+	"regexp"
+
+	"github.com/t94j0/satellite/net/http"
+)
+
+// ClientMatcher recognizes an application by its user agent and headers
+type ClientMatcher struct {
+	// UserAgents are user agent regexes used by the application
+	UserAgents []*regexp.Regexp
+	// Headers are headers only the application sends, and regexes of their values
+	Headers map[string]*regexp.Regexp
+}
+
+// Match returns true when req was made by the application
+func (m ClientMatcher) Match(req *http.Request) bool {
+	userAgent := req.UserAgent()
+	for _, ua := range m.UserAgents {
+		if ua.MatchString(userAgent) {
+			return true
+		}
+	}
+
+	for name, value := range m.Headers {
+		for _, v := range req.Header[http.CanonicalHeaderKey(name)] {
+			if value.MatchString(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Clients are the built in matchers usable in authorized_clients
+var Clients = map[string]ClientMatcher{
+	// Word, Excel, and PowerPoint fetching remote templates and resources,
+	// either directly or through the Office discovery requests
+	"office": {
+		UserAgents: []*regexp.Regexp{
+			regexp.MustCompile(`^Microsoft Office (Word|Excel|PowerPoint|Access|Outlook|Visio|Publisher|Project) \d+`),
+			regexp.MustCompile(`^Microsoft Office/\d+\.\d+ \(.*Microsoft (Word|Excel|PowerPoint|Access|Outlook|Visio|Publisher|Project) \d+`),
+			regexp.MustCompile(`^Microsoft Office (Existence|Protocol) Discovery`),
+			regexp.MustCompile(`ms-office; MSOffice \d+`),
+		},
+		Headers: map[string]*regexp.Regexp{
+			"X-Office-Major-Version": regexp.MustCompile(`^\d+$`),
+		},
+	},
+	"onenote": {
+		UserAgents: []*regexp.Regexp{
+			regexp.MustCompile(`^Microsoft Office OneNote \d+`),
+			regexp.MustCompile(`^Microsoft Office/\d+\.\d+ \(.*Microsoft OneNote \d+`),
+			regexp.MustCompile(`^OneNote/\d+`),
+		},
+	},
+	// Windows components which fetch URLs opened by protocol and file handlers
+	"windows_url_handler": {
+		UserAgents: []*regexp.Regexp{
+			regexp.MustCompile(`^Microsoft-WebDAV-MiniRedir/`),
+			regexp.MustCompile(`^Microsoft URL Control`),
+			regexp.MustCompile(`^Mozilla/4\.0 \(compatible; MSIE 7\.0; Windows NT [\d.]+;.*Trident/`),
+		},
+	},
+}
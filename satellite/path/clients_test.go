@@ -0,0 +1,93 @@
+package path_test
+
+import (
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestClients(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		header    [2]string
+		client    string
+	}{
+		{"Microsoft Office Word 2014", [2]string{}, "office"},
+		{"Microsoft Office/16.0 (Windows NT 10.0; Microsoft Excel 16.0.14326; Pro)", [2]string{}, "office"},
+		{"Microsoft Office Existence Discovery", [2]string{}, "office"},
+		{"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 10.0; Win64; x64; Trident/7.0; .NET4.0C; .NET4.0E; ms-office; MSOffice 16)", [2]string{}, "office"},
+		{"", [2]string{"X-Office-Major-Version", "16"}, "office"},
+		{"Microsoft Office OneNote 2014", [2]string{}, "onenote"},
+		{"Microsoft Office/16.0 (Windows NT 10.0; Microsoft OneNote 16.0.14326; Pro)", [2]string{}, "onenote"},
+		{"Microsoft-WebDAV-MiniRedir/10.0.19045", [2]string{}, "windows_url_handler"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", [2]string{}, ""},
+		{"python-requests/2.31.0", [2]string{"X-Office-Major-Version", "sixteen"}, ""},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", test.userAgent)
+		if test.header[0] != "" {
+			req.Header.Set(test.header[0], test.header[1])
+		}
+
+		if test.client != "" && !Clients[test.client].Match(req) {
+			t.Errorf("%q did not match %s", test.userAgent, test.client)
+		}
+		for name, matcher := range Clients {
+			if test.client == "" && matcher.Match(req) {
+				t.Errorf("%q matched %s", test.userAgent, name)
+			}
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_authorized_clients(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/template.dotm", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.Header.Set("User-Agent", "Microsoft Office Word 2014")
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+authorized_clients:
+  - office
+  - onenote`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("Office client was not hosted")
+	}
+
+	mockRequest.Header.Set("User-Agent", "curl/8.4.0")
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("curl was hosted")
+	}
+}
+
+func TestNewRequestConditions_authorized_clients_fail(t *testing.T) {
+	data := `
+authorized_clients:
+  - wordpad`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
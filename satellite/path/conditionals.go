@@ -1,13 +1,20 @@
 package path
 
 import (
+	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
-	"os/exec"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/imdario/mergo"
@@ -16,12 +23,13 @@ import (
 	"github.com/t94j0/satellite/net/http"
 	"github.com/t94j0/satellite/net/http/httputil"
 	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/passive"
 	"gopkg.in/yaml.v2"
 )
 
 // RequestConditions are the conditions in the http.Request object
 type RequestConditions struct {
-	// AUserAgent is the authorized user agents for a file
+	// AuthorizedUserAgents is the authorized user agents for a file
 	AuthorizedUserAgents []string `yaml:"authorized_useragents,omitempty"`
 	// BlacklistUserAgents are blacklisted user agents
 	BlacklistUserAgents []string `yaml:"blacklist_useragents,omitempty"`
@@ -29,31 +37,316 @@ type RequestConditions struct {
 	AuthorizedUserAgentsGlob []string `yaml:"authorized_useragents_glob,omitempty"`
 	// BlacklistUserAgentsGlob are blacklisted user agents
 	BlacklistUserAgentsGlob []string `yaml:"blacklist_useragents_glob,omitempty"`
+	// AuthorizedClients are names of built in client matchers, like office, onenote, and
+	// windows_url_handler. The request must come from one of the clients
+	AuthorizedClients []string `yaml:"authorized_clients,omitempty"`
 	// AuthorizedIPRange is the authorized range of IPs who are allowed to access a file
 	AuthorizedIPRange []string `yaml:"authorized_iprange,omitempty"`
 	// BlacklistIPRange are blacklisted IPs
 	BlacklistIPRange []string `yaml:"blacklist_iprange,omitempty"`
 	// AuthorizedMethods are the HTTP methods which can access the page
 	AuthorizedMethods []string `yaml:"authorized_methods,omitempty"`
-	// AuthorizedHeaders are HTTP headers which must be present in order to access a file
+	// BlacklistMethods are the HTTP methods denied access to the page, like OPTIONS, HEAD, or TRACE
+	BlacklistMethods []string `yaml:"blacklist_methods,omitempty"`
+	// BlacklistMethodsStatus is the status code answered to blacklisted methods instead of the
+	// on_failure or not_found response
+	BlacklistMethodsStatus int `yaml:"blacklist_methods_status,omitempty"`
+	// AuthorizedHosts are globs of the Host header, like *.example.com, which can access the page.
+	// The TLS server name must also match when the client sends one
+	AuthorizedHosts []string `yaml:"authorized_hosts,omitempty"`
+	// AuthorizedHeaders are HTTP headers of which one must be sent, with a value matching its regex,
+	// in order to access a file. Regexes match the whole value, so plain values match exactly. An
+	// empty regex only checks the header is sent
 	AuthorizedHeaders map[string]string `yaml:"authorized_headers,omitempty"`
+	// BlacklistHeaders are HTTP headers which deny access to a file when a value matches their
+	// regex, like X-Forwarded-For. An empty regex denies any request sending the header
+	BlacklistHeaders map[string]string `yaml:"blacklist_headers,omitempty"`
+	// AuthorizedLanguages are the Accept-Language languages of which one must be accepted in order
+	// to access a file. A language like en matches every region of it, en-US only matches the
+	// region, and *-US matches any language of the region
+	AuthorizedLanguages []string `yaml:"authorized_languages,omitempty"`
+	// BlacklistLanguages are the Accept-Language languages, in the form of authorized_languages,
+	// which deny access to a file when any is accepted
+	BlacklistLanguages []string `yaml:"blacklist_languages,omitempty"`
+	// RequireAcceptLanguage denies clients which send no Accept-Language, like most sandboxes
+	RequireAcceptLanguage bool `yaml:"require_accept_language,omitempty"`
+	// AuthorizedAccept are regexes of which one must match the Accept header in order to access a file
+	AuthorizedAccept []string `yaml:"authorized_accept,omitempty"`
+	// BlacklistAccept are regexes which deny access to a file when any matches the Accept header,
+	// like ^\*/\*$ sent by scripted clients
+	BlacklistAccept []string `yaml:"blacklist_accept,omitempty"`
+	// AuthorizedReferer are regexes of which one must match the Referer header in order to access a
+	// file, like the phishing page or email tracking domain the click came from. Clients sending no
+	// Referer, like scanners given the pasted URL, are denied
+	AuthorizedReferer []string `yaml:"authorized_referer,omitempty"`
+	// BlacklistReferer are regexes which deny access to a file when any matches the Referer header
+	BlacklistReferer []string `yaml:"blacklist_referer,omitempty"`
+	// AuthorizedQuery are regexes of URL query parameters, like id: ^[0-9a-f]{32}$, which must all be
+	// present and match in order to access a file
+	AuthorizedQuery map[string]string `yaml:"authorized_query,omitempty"`
+	// BlacklistQuery are regexes of URL query parameters which deny access to a file when any value
+	// matches. An empty regex denies any request with the parameter
+	BlacklistQuery map[string]string `yaml:"blacklist_query,omitempty"`
+	// AuthorizedCookies are regexes of cookie values by cookie name, which must all be present and
+	// match in order to access a file
+	AuthorizedCookies map[string]string `yaml:"authorized_cookies,omitempty"`
+	// RequireCookieAbsent are the names of cookies which deny access to a file when they are sent
+	RequireCookieAbsent []string `yaml:"require_cookie_absent,omitempty"`
+	// AuthorizedBody are regexes of which one must match the request body in order to access a file
+	AuthorizedBody []string `yaml:"authorized_body,omitempty"`
+	// BlacklistBody are regexes which deny access to a file when any matches the request body
+	BlacklistBody []string `yaml:"blacklist_body,omitempty"`
+	// MaxBodyRead is the number of bytes of the request body which are matched. Defaults to 65536
+	MaxBodyRead int64 `yaml:"max_body_read,omitempty"`
 	// AuthorizedJA3 are valid JA3 hashes
 	AuthorizedJA3 []string `yaml:"authorized_ja3,omitempty"`
+	// AuthorizedJA3Raw are regexes matched against the full JA3 string
+	AuthorizedJA3Raw []string `yaml:"authorized_ja3_raw,omitempty"`
+	// AuthorizedJA4 are valid FoxIO JA4 fingerprints
+	AuthorizedJA4 []string `yaml:"authorized_ja4,omitempty"`
+	// AuthorizedHeaderOrder are valid orders of the request headers, as comma
+	// separated header names like Host,User-Agent,Accept. Names are not case sensitive
+	AuthorizedHeaderOrder []string `yaml:"authorized_header_order,omitempty"`
+	// AuthorizedHTTP2Fingerprint are valid Akamai style HTTP/2 fingerprints, or their MD5 hashes.
+	// Requests over HTTP/1 have no HTTP/2 fingerprint
+	AuthorizedHTTP2Fingerprint []string `yaml:"authorized_http2_fingerprint,omitempty"`
+	// RequireClientCert denies clients which did not send a TLS client certificate. The server must
+	// request them with client_certs in config.yml
+	RequireClientCert bool `yaml:"require_client_cert,omitempty"`
+	// AuthorizedClientCertCN are the common names of the client certificates which may access a file
+	AuthorizedClientCertCN []string `yaml:"authorized_client_cert_cn,omitempty"`
+	// AuthorizedClientCertFingerprints are the SHA256 fingerprints, in hex, of the client
+	// certificates which may access a file
+	AuthorizedClientCertFingerprints []string `yaml:"authorized_client_cert_fingerprints,omitempty"`
+	// AuthorizedHTTPVersions are the HTTP versions which may access a file. One of HTTP/1.0,
+	// HTTP/1.1, or HTTP/2. Browsers negotiate HTTP/2 when the server offers it with http2 in
+	// config.yml, while most scripted clients use HTTP/1.1
+	AuthorizedHTTPVersions []string `yaml:"authorized_http_versions,omitempty"`
+	// AuthorizedTLSVersions are the negotiated TLS versions which may access a file. One of SSL3.0,
+	// TLS1.0, TLS1.1, TLS1.2, or TLS1.3
+	AuthorizedTLSVersions []string `yaml:"authorized_tls_versions,omitempty"`
+	// BlacklistTLSVersions are the negotiated TLS versions denied access to a file, like the TLS1.0
+	// and TLS1.1 of middleboxes and scanners
+	BlacklistTLSVersions []string `yaml:"blacklist_tls_versions,omitempty"`
+	// AuthorizedCipherSuites are the negotiated cipher suites which may access a file, by IANA
+	// name like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or in hex like 0xc02f
+	AuthorizedCipherSuites []string `yaml:"authorized_cipher_suites,omitempty"`
+	// BlacklistCipherSuites are the negotiated cipher suites denied access to a file
+	BlacklistCipherSuites []string `yaml:"blacklist_cipher_suites,omitempty"`
+	// AuthorizedCipherOrder are regexes of which one must match the cipher suites offered by the
+	// client, in order as decimal IDs joined by -, like in JA3
+	AuthorizedCipherOrder []string `yaml:"authorized_cipher_order,omitempty"`
+	// BlacklistCipherOrder are regexes which deny access to a file when any matches the offered cipher suites
+	BlacklistCipherOrder []string `yaml:"blacklist_cipher_order,omitempty"`
+	// RequireSupportedGroups are the groups, like x25519 or 29, which the client hello must all offer
+	RequireSupportedGroups []string `yaml:"require_supported_groups,omitempty"`
+	// BlacklistSupportedGroups are the groups which deny access to a file when any is offered
+	BlacklistSupportedGroups []string `yaml:"blacklist_supported_groups,omitempty"`
+	// AuthorizedJARM are valid JARM fingerprints of the TLS server running on the client
+	AuthorizedJARM []string `yaml:"authorized_jarm,omitempty"`
+	// BlacklistJARM are blacklisted JARM fingerprints of the TLS server running on the client
+	BlacklistJARM []string `yaml:"blacklist_jarm,omitempty"`
+	// JARMPort is the port of the client which is fingerprinted. Defaults to 443
+	JARMPort int `yaml:"jarm_port,omitempty"`
+	// JARMPending is open to pass or closed to deny clients which are still being scanned. Defaults to closed
+	JARMPending string `yaml:"jarm_pending,omitempty"`
+	// AuthorizedOSPassive are the operating systems, guessed from the TTL and TCP options of the
+	// client SYN, which may access a file. One of windows, linux, macos, freebsd, or unknown
+	AuthorizedOSPassive []string `yaml:"authorized_os_passive,omitempty"`
+	// BlacklistOSPassive are the operating systems, guessed from the client SYN, denied access to a file
+	BlacklistOSPassive []string `yaml:"blacklist_os_passive,omitempty"`
+	// OSPassiveMatchesUserAgent denies clients whose SYN was sent by another operating system than
+	// the one their User-Agent claims, like Linux sandboxes with a Windows browser User-Agent
+	OSPassiveMatchesUserAgent bool `yaml:"os_passive_matches_user_agent,omitempty"`
+	// AuthorizedSourcePorts are the client source ports, or port ranges like 1024-65535, which may
+	// access a file
+	AuthorizedSourcePorts []string `yaml:"authorized_source_ports,omitempty"`
+	// AuthorizedDomains are the Windows domains clients must authenticate from
+	// using NTLM. Clients are challenged for their credentials, which are never verified
+	AuthorizedDomains []string `yaml:"authorized_domains,omitempty"`
 	// Exec file executes script/binary and checks stdout
 	Exec struct {
+		// ScriptPath is the script or binary which is given the request dump on stdin, and the
+		// request's IP, method, host, path, query, user agent, JA3, and country in SATELLITE_*
+		// variables, like SATELLITE_IP
 		ScriptPath string `yaml:"script"`
-		Output     string `yaml:"output"`
+		// Args are the arguments the script is run with
+		Args []string `yaml:"args"`
+		// Output is what the script must print for the request to be served
+		Output string `yaml:"output"`
+		// OutputRegex is a regex the output of the script must match instead of Output
+		OutputRegex string `yaml:"output_regex"`
+		// ExitCodes are the exit codes of the script which serve the request. Without them, the
+		// script must exit successfully
+		ExitCodes []int `yaml:"exit_codes"`
+		// Timeout is how long the script may run before it is killed and the request denied. Defaults to 10s
+		Timeout string `yaml:"timeout"`
+		// MaxCPU is the CPU time the script may use, rounded up to seconds
+		MaxCPU string `yaml:"max_cpu"`
+		// MaxMemoryMB is the memory, in megabytes, the script may map
+		MaxMemoryMB uint64 `yaml:"max_memory_mb"`
+		// User runs the script as another user. Satellite must run as root
+		User string `yaml:"user"`
+		// Env are KEY=VALUE variables given to the script. Only PATH is kept from the environment of satellite
+		Env []string `yaml:"env"`
 	} `yaml:"exec,omitempty"`
+	// ExternalAuth asks an HTTP authorizer, which can keep its own state, whether to serve the request
+	ExternalAuth struct {
+		// URL is POSTed a JSON summary of the request, with its headers, IP, JA3, GeoIP, and the
+		// client's recent hits, and answers with {"allow": true} to serve it
+		URL string `yaml:"url"`
+		// Token is sent to the authorizer as a bearer token
+		Token string `yaml:"token" json:"-"`
+		// Timeout is how long the authorizer has to answer. Defaults to 2s
+		Timeout string `yaml:"timeout"`
+		// Cache is how long answers are reused for the same client and request. Answers are not cached by default
+		Cache string `yaml:"cache"`
+		// FailOpen serves requests when the authorizer can not be reached or fails. Defaults to denying them
+		FailOpen bool `yaml:"fail_open"`
+	} `yaml:"external_auth,omitempty"`
+	// Script is inline Lua deciding whether to serve the request. It is given the request,
+	// geoip, and state tables, and returns true to serve it, or a table of host, and the
+	// status, headers, and body to change the response to. It runs for up to a second
+	Script string `yaml:"script,omitempty"`
+	// WASM asks a WebAssembly condition plugin whether to serve the request
+	WASM struct {
+		// Module is the .wasm file of the plugin. It exports allocate(size) and verdict(ptr, len), which
+		// is given the JSON summary of the request sent to external_auth and returns 1 to serve it
+		Module string `yaml:"module"`
+		// Timeout is how long the plugin may run before the request is denied. Defaults to 1s
+		Timeout string `yaml:"timeout"`
+		// MaxMemoryMB is the memory, in megabytes, the plugin may use. Defaults to 16
+		MaxMemoryMB uint32 `yaml:"max_memory_mb"`
+	} `yaml:"wasm,omitempty"`
 	// NotServing does not serve the page when NotServing is true
 	NotServing bool `yaml:"not_serving,omitempty"`
 	// Serve is the number of times the file should be served
 	Serve uint64 `yaml:"serve,omitempty"`
-	// PrereqPaths path of hits that need to happen before the current one will succeed
+	// ServePerIP is the number of times the file is served to each IP
+	ServePerIP uint64 `yaml:"serve_per_ip,omitempty"`
+	// ServePerSession is the number of times the file is served to each value of SessionCookie
+	ServePerSession uint64 `yaml:"serve_per_session,omitempty"`
+	// SessionCookie is the cookie identifying a client's session
+	SessionCookie string `yaml:"session_cookie,omitempty"`
+	// CounterGroup shares the serve, serve_per_ip, and serve_per_session counters
+	// between every path in the group, like mirrors of the same payload
+	CounterGroup string `yaml:"counter_group,omitempty"`
+	// MaxAge is how long rules are trusted after pathList.yml was last modified.
+	// Stale rules are not served so forgotten payloads are not left live
+	MaxAge string `yaml:"max_age,omitempty"`
+	// ServeAfter is the RFC 3339 time the path starts being served
+	ServeAfter string `yaml:"serve_after,omitempty"`
+	// ServeBefore is the RFC 3339 time the path stops being served
+	ServeBefore string `yaml:"serve_before,omitempty"`
+	// ServeHours is the daily window the path is served in, like 09:00-17:00. Windows may cross midnight
+	ServeHours string `yaml:"serve_hours,omitempty"`
+	// ServeDays are the days of the week the path is served, like Mon or Tuesday
+	ServeDays []string `yaml:"serve_days,omitempty"`
+	// Timezone is the IANA timezone of ServeHours and ServeDays. Defaults to UTC
+	Timezone string `yaml:"timezone,omitempty"`
+	// PrereqPaths path of hits that need to happen before the current one will succeed.
+	// They must be the latest paths served to the client, in order
 	PrereqPaths []string `yaml:"prereq,omitempty"`
-	GeoIP       struct {
+	// PrereqWithin is how long the client has to work through the prereqs, from the
+	// first prereq being served to this request, so replayed chains do not qualify
+	PrereqWithin string `yaml:"prereq_within,omitempty"`
+	// PrereqKey is what the prereq hits of a client are kept under: ip, fingerprint, a hash of the IP,
+	// User-Agent, and JA3, or session, a cookie satellite issues, so clients behind one IP
+	// cannot satisfy each other's prereqs. Defaults to ip
+	PrereqKey string `yaml:"prereq_key,omitempty"`
+	// GeoIP limits the countries of clients using the geoip_path DB
+	GeoIP struct {
+		// AuthorizedCountries are the countries allowed to access the path, by ISO country code,
+		// continent code like continent:EU, or country group like group:EU, group:EEA, group:FVEY,
+		// or a group from country_groups of the configuration
 		AuthorizedCountries []string `yaml:"authorized_countries"`
-		BlacklistCountries  []string `yaml:"blacklist_countries"`
+		// BlacklistCountries are the countries denied access to the path, like authorized_countries
+		BlacklistCountries []string `yaml:"blacklist_countries"`
+		// AuthorizedCities are the English names of cities allowed to access the path. Requires a GeoIP2-City DB
+		AuthorizedCities []string `yaml:"authorized_cities,omitempty"`
+		// AuthorizedRegions are the subdivisions allowed to access the path, by ISO code like CA or US-CA,
+		// or by English name like California. Requires a GeoIP2-City DB
+		AuthorizedRegions []string `yaml:"authorized_regions,omitempty"`
+		// AuthorizedTimezones are the IANA timezones allowed to access the path. Requires a GeoIP2-City DB
+		AuthorizedTimezones []string `yaml:"authorized_timezones,omitempty"`
 	} `yaml:"geoip"`
+	// AuthorizedASN are the AS numbers, like AS8075, or regexes of AS organizations allowed to access the path
+	AuthorizedASN []string `yaml:"authorized_asn,omitempty"`
+	// BlacklistASN are the AS numbers, like AS8075, or regexes of AS organizations denied access to the path
+	BlacklistASN []string `yaml:"blacklist_asn,omitempty"`
+	// AuthorizedRDNS are regexes of the reverse DNS name of clients allowed to access the path.
+	// Only names which resolve back to the client IP are matched
+	AuthorizedRDNS []string `yaml:"authorized_rdns,omitempty"`
+	// BlacklistRDNS are regexes of the reverse DNS name of clients denied access to the path, like \.amazonaws\.com$
+	BlacklistRDNS []string `yaml:"blacklist_rdns,omitempty"`
+	// BlacklistHostingProviders are the hosting providers, like aws, azure, gcp, oracle, or
+	// digitalocean, whose published IP ranges are denied access to the path
+	BlacklistHostingProviders []string `yaml:"blacklist_hosting_providers,omitempty"`
+	// BlacklistTor denies Tor exit nodes access to the path
+	BlacklistTor bool `yaml:"blacklist_tor,omitempty"`
+	// DenyForwarded denies clients sending proxy headers when satellite is not behind a proxy
+	DenyForwarded struct {
+		// Enabled turns on forwarded header detection
+		Enabled bool `yaml:"enabled"`
+		// TrustedProxies are the IPs and ranges of proxies in front of satellite which may send forwarded headers
+		TrustedProxies []string `yaml:"trusted_proxies"`
+	} `yaml:"deny_forwarded,omitempty"`
+	// MaxIdenticalRequests pins clients to the decoy once they repeat the same request too often
+	MaxIdenticalRequests struct {
+		// Count is the number of identical requests allowed within Window
+		Count int `yaml:"count"`
+		// Window is the duration identical requests are counted in
+		Window string `yaml:"window"`
+	} `yaml:"max_identical_requests,omitempty"`
+	// StickyDeny pins clients to the decoy once they were denied this many times, so a scanner
+	// which later sends the right user agent still never gets the payload. Denials are counted
+	// by IP on every path setting it, so set it in global conditions to pin clients on every path
+	StickyDeny int `yaml:"sticky_deny,omitempty"`
+	// OnStateError is how conditionals depending on the state DB behave while it is unavailable,
+	// like when its disk is full, by conditional: serve, serve_per_client, max_identical_requests,
+	// or sticky_deny. Each is open, passing the conditional, or closed, failing it. serve and
+	// serve_per_client default to closed and max_identical_requests and sticky_deny to open
+	OnStateError map[string]string `yaml:"on_state_error,omitempty"`
+	// RateLimit limits how often each IP may request the path
+	RateLimit struct {
+		// Requests is the number of requests allowed every Per
+		Requests int `yaml:"requests"`
+		// Per is the duration Requests are allowed in. Defaults to a minute
+		Per string `yaml:"per"`
+		// Burst is the number of requests allowed at once. Defaults to Requests
+		Burst int `yaml:"burst"`
+		// Action is taken when the limit is exceeded: deny, tarpit, or redirect.
+		// Denied and tarpitted requests are served not_found
+		Action string `yaml:"action"`
+		// Tarpit is how long tarpitted requests are held before they are answered
+		Tarpit string `yaml:"tarpit"`
+		// Redirect is where redirected requests are sent
+		Redirect string `yaml:"redirect"`
+	} `yaml:"rate_limit,omitempty"`
+	// BasicAuth hosts the file only to clients sending valid HTTP basic credentials.
+	// Clients which have not sent credentials are challenged
+	BasicAuth struct {
+		// Username is the user of a valid credential
+		Username string `yaml:"username"`
+		// Password is the password of Username
+		Password string `yaml:"password"`
+		// Htpasswd is an htpasswd file of valid credentials hashed with bcrypt or SHA1
+		Htpasswd string `yaml:"htpasswd"`
+		// Realm is shown by browsers when they prompt for credentials. Defaults to Restricted
+		Realm string `yaml:"realm"`
+	} `yaml:"basic_auth,omitempty"`
+	// Any are condition blocks of which at least one must pass, like a browser
+	// from a country, or an operator IP range
+	Any []RequestConditions `yaml:"any,omitempty"`
+	// All are condition blocks which must all pass
+	All []RequestConditions `yaml:"all,omitempty"`
+	// Not is a condition block which must not pass
+	Not *RequestConditions `yaml:"not,omitempty"`
+	// Approval holds clients which pass every other condition until an operator approves them
+	Approval struct {
+		// TTL is how long a request waits for approval, and how long an approval lasts
+		TTL string `yaml:"ttl"`
+	} `yaml:"approval,omitempty"`
 }
 
 // NewRequestConditions creates an object based on a YAML blob
@@ -64,30 +357,334 @@ func NewRequestConditions(data []byte) (RequestConditions, error) {
 		return conditions, err
 	}
 
-	regexes := append(conditions.AuthorizedUserAgents, conditions.BlacklistUserAgents...)
+	return conditions, conditions.Validate()
+}
+
+// validateBlock checks the conditions of an any, all, or not block. Conditions which
+// record the request, like rate_limit, only apply to the top level conditions
+func (c *RequestConditions) validateBlock() error {
+	if c.RateLimit.Requests != 0 || c.Approval.TTL != "" || c.MaxIdenticalRequests.Count != 0 || c.StickyDeny != 0 {
+		return errors.New("rate_limit, approval, max_identical_requests, and sticky_deny are not valid in condition blocks")
+	}
+	return c.Validate()
+}
+
+// Validate checks values which are the right type but not usable
+func (c *RequestConditions) Validate() error {
+	for i := range c.Any {
+		if err := c.Any[i].validateBlock(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("any[%d]", i))
+		}
+	}
+	for i := range c.All {
+		if err := c.All[i].validateBlock(); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("all[%d]", i))
+		}
+	}
+	if c.Not != nil {
+		if err := c.Not.validateBlock(); err != nil {
+			return errors.Wrap(err, "not")
+		}
+	}
+
+	regexes := append(c.AuthorizedUserAgents, c.BlacklistUserAgents...)
+	regexes = append(regexes, c.AuthorizedJA3Raw...)
+	regexes = append(regexes, c.AuthorizedASN...)
+	regexes = append(regexes, c.BlacklistASN...)
+	regexes = append(regexes, c.AuthorizedRDNS...)
+	regexes = append(regexes, c.BlacklistRDNS...)
+	regexes = append(regexes, c.AuthorizedBody...)
+	regexes = append(regexes, c.AuthorizedAccept...)
+	regexes = append(regexes, c.BlacklistAccept...)
+	regexes = append(regexes, c.AuthorizedReferer...)
+	regexes = append(regexes, c.BlacklistReferer...)
+	regexes = append(regexes, c.BlacklistBody...)
+	regexes = append(regexes, c.AuthorizedCipherOrder...)
+	regexes = append(regexes, c.BlacklistCipherOrder...)
 	for _, ua := range regexes {
 		if _, err := regexp.Compile(ua); err != nil {
-			return conditions, errors.New(fmt.Sprintf("%s is not valid regex", ua))
+			return errors.New(fmt.Sprintf("%s is not valid regex", ua))
+		}
+	}
+
+	for _, queries := range []map[string]string{c.AuthorizedHeaders, c.BlacklistHeaders, c.AuthorizedQuery, c.BlacklistQuery, c.AuthorizedCookies} {
+		for param, re := range queries {
+			if _, err := regexp.Compile(re); err != nil {
+				return errors.New(fmt.Sprintf("%s is not valid regex for %s", re, param))
+			}
+		}
+	}
+
+	for _, name := range c.AuthorizedClients {
+		if _, ok := Clients[name]; !ok {
+			return errors.New(fmt.Sprintf("%s is not a known client", name))
+		}
+	}
+
+	for _, name := range c.BlacklistHostingProviders {
+		if !isHostingProvider(name) {
+			return errors.New(fmt.Sprintf("%s is not a known hosting provider", name))
+		}
+	}
+
+	for _, r := range c.DenyForwarded.TrustedProxies {
+		if _, _, err := net.ParseCIDR(r); err != nil && net.ParseIP(r) == nil {
+			return errors.New(fmt.Sprintf("%s is not a valid trusted proxy", r))
+		}
+	}
+
+	jarms := append(c.AuthorizedJARM, c.BlacklistJARM...)
+	for _, j := range jarms {
+		if len(j) != 62 {
+			return errors.New(fmt.Sprintf("%s is not a valid JARM fingerprint", j))
+		}
+	}
+
+	for _, v := range c.AuthorizedHTTPVersions {
+		if !httpVersions[v] {
+			return errors.New(fmt.Sprintf("%s is not a valid HTTP version", v))
+		}
+	}
+
+	for _, v := range append(append([]string(nil), c.AuthorizedTLSVersions...), c.BlacklistTLSVersions...) {
+		if _, ok := tlsVersions[v]; !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid TLS version", v))
+		}
+	}
+
+	for _, suite := range append(append([]string(nil), c.AuthorizedCipherSuites...), c.BlacklistCipherSuites...) {
+		if _, ok := parseCipherSuite(suite); !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid cipher suite", suite))
+		}
+	}
+
+	for _, g := range append(append([]string(nil), c.RequireSupportedGroups...), c.BlacklistSupportedGroups...) {
+		if _, ok := parseSupportedGroup(g); !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid supported group", g))
+		}
+	}
+
+	for _, f := range c.AuthorizedClientCertFingerprints {
+		if !validCertFingerprint(f) {
+			return errors.New(fmt.Sprintf("%s is not a valid client certificate fingerprint", f))
+		}
+	}
+
+	for _, d := range []string{c.Exec.Timeout, c.Exec.MaxCPU} {
+		if d == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d); err != nil || duration <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid exec duration", d))
+		}
+	}
+
+	for _, e := range c.Exec.Env {
+		if !strings.Contains(e, "=") {
+			return errors.New(fmt.Sprintf("%s is not a valid exec variable", e))
+		}
+	}
+
+	if c.ExternalAuth.URL != "" {
+		if u, err := url.Parse(c.ExternalAuth.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New(fmt.Sprintf("%s is not a valid external_auth url", c.ExternalAuth.URL))
+		}
+	}
+	for _, d := range []string{c.ExternalAuth.Timeout, c.ExternalAuth.Cache} {
+		if d == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d); err != nil || duration <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid external_auth duration", d))
+		}
+	}
+
+	if c.Script != "" {
+		if _, err := compileScript(c.Script); err != nil {
+			return errors.Wrap(err, "script")
+		}
+	}
+
+	if c.WASM.Timeout != "" {
+		if duration, err := time.ParseDuration(c.WASM.Timeout); err != nil || duration <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid wasm timeout", c.WASM.Timeout))
+		}
+	}
+	if c.WASM.MaxMemoryMB > MaxWASMMemoryMB {
+		return errors.New(fmt.Sprintf("%d is not a valid wasm max_memory_mb", c.WASM.MaxMemoryMB))
+	}
+
+	if c.Exec.OutputRegex != "" {
+		if _, err := regexp.Compile(c.Exec.OutputRegex); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid exec output_regex", c.Exec.OutputRegex))
+		}
+	}
+
+	if c.BasicAuth.Password != "" && c.BasicAuth.Username == "" {
+		return errors.New("basic_auth.username: expected a username with the password, got an empty string")
+	}
+
+	for _, o := range append(c.AuthorizedOSPassive, c.BlacklistOSPassive...) {
+		if !validOS(o) {
+			return errors.New(fmt.Sprintf("%s is not a valid passive OS", o))
+		}
+	}
+
+	for _, p := range c.AuthorizedSourcePorts {
+		if _, _, err := parsePortRange(p); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid source port range", p))
+		}
+	}
+
+	if c.BlacklistMethodsStatus != 0 && (c.BlacklistMethodsStatus < 100 || c.BlacklistMethodsStatus > 599) {
+		return errors.New(fmt.Sprintf("%d is not a valid blacklist_methods_status", c.BlacklistMethodsStatus))
+	}
+
+	for _, l := range append(c.AuthorizedLanguages, c.BlacklistLanguages...) {
+		if !languageRegex.MatchString(l) {
+			return errors.New(fmt.Sprintf("%s is not a valid language", l))
+		}
+	}
+
+	if c.MaxBodyRead < 0 {
+		return errors.New(fmt.Sprintf("%d is not a valid max_body_read", c.MaxBodyRead))
+	}
+
+	if c.JARMPort < 0 || c.JARMPort > 65535 {
+		return errors.New(fmt.Sprintf("%d is not a valid jarm_port", c.JARMPort))
+	}
+	if c.JARMPending != "" && c.JARMPending != FailOpen && c.JARMPending != FailClosed {
+		return errors.New(fmt.Sprintf("%s is not a valid jarm_pending", c.JARMPending))
+	}
+
+	if err := validateStateFallbacks(c.OnStateError); err != nil {
+		return err
+	}
+
+	if c.PrereqKey != "" && !prereqKeys[c.PrereqKey] {
+		return errors.New(fmt.Sprintf("%s is not a valid prereq_key", c.PrereqKey))
+	}
+
+	if c.PrereqWithin != "" {
+		if d, err := time.ParseDuration(c.PrereqWithin); err != nil || d <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid prereq_within", c.PrereqWithin))
+		}
+	}
+
+	if c.MaxAge != "" {
+		if _, err := time.ParseDuration(c.MaxAge); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid max_age", c.MaxAge))
+		}
+	}
+
+	for _, t := range []string{c.ServeAfter, c.ServeBefore} {
+		if t == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, t); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid RFC 3339 time", t))
+		}
+	}
+
+	if c.ServeHours != "" {
+		if _, _, err := parseServeHours(c.ServeHours); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range c.ServeDays {
+		if _, ok := parseWeekday(d); !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid day", d))
+		}
+	}
+
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid timezone", c.Timezone))
+		}
+	}
+
+	for _, country := range append(append([]string{}, c.GeoIP.AuthorizedCountries...), c.GeoIP.BlacklistCountries...) {
+		if err := validateCountry(country); err != nil {
+			return err
+		}
+	}
+
+	for _, tz := range c.GeoIP.AuthorizedTimezones {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid timezone", tz))
+		}
+	}
+
+	if c.ServePerSession != 0 && c.SessionCookie == "" {
+		return errors.New("serve_per_session requires a session_cookie")
+	}
+
+	if c.RateLimit.Requests < 0 || c.RateLimit.Burst < 0 {
+		return errors.New("rate_limit requests and burst must be positive")
+	}
+	for _, d := range []string{c.RateLimit.Per, c.RateLimit.Tarpit} {
+		if d == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(d); err != nil || duration <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid rate_limit duration", d))
+		}
+	}
+	switch c.RateLimit.Action {
+	case "", RateLimitDeny, RateLimitTarpit:
+	case RateLimitRedirect:
+		if c.RateLimit.Redirect == "" {
+			return errors.New("rate_limit redirect action requires a redirect")
+		}
+	default:
+		return errors.New(fmt.Sprintf("%s is not a valid rate_limit action", c.RateLimit.Action))
+	}
+
+	if c.Approval.TTL != "" {
+		if _, err := time.ParseDuration(c.Approval.TTL); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid approval ttl", c.Approval.TTL))
+		}
+	}
+
+	if c.MaxIdenticalRequests.Window != "" {
+		if _, err := time.ParseDuration(c.MaxIdenticalRequests.Window); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid max_identical_requests window", c.MaxIdenticalRequests.Window))
 		}
 	}
 
-	globs := append(conditions.AuthorizedUserAgentsGlob, conditions.BlacklistUserAgentsGlob...)
+	if c.StickyDeny < 0 {
+		return errors.New(fmt.Sprintf("%d is not a valid sticky_deny", c.StickyDeny))
+	}
+
+	globs := append(c.AuthorizedUserAgentsGlob, c.BlacklistUserAgentsGlob...)
 	for _, ua := range globs {
 		if _, err := glob.Compile(ua); err != nil {
-			return conditions, errors.New(fmt.Sprintf("%s is not valid glob", ua))
+			return errors.New(fmt.Sprintf("%s is not valid glob", ua))
+		}
+	}
+
+	for _, h := range c.AuthorizedHosts {
+		if _, err := glob.Compile(strings.ToLower(h), '.'); err != nil {
+			return errors.New(fmt.Sprintf("%s is not valid glob", h))
 		}
 	}
 
-	return conditions, nil
+	return nil
 }
 
 // MergeRequestConditions merges a list of RequestCondition. They are applied starting from the first to the last. It will overwrite later RequestCondition
 func MergeRequestConditions(conds ...RequestConditions) (RequestConditions, error) {
 	var target RequestConditions
 	for _, c := range conds {
+		// Headers are merged by their case insensitive names
+		authorized, blacklist := c.AuthorizedHeaders, c.BlacklistHeaders
+		c.AuthorizedHeaders, c.BlacklistHeaders = nil, nil
 		if err := mergo.Merge(&target, c, mergo.WithOverride, mergo.WithAppendSlice); err != nil {
 			return target, err
 		}
+		target.AuthorizedHeaders = mergeHeaders(target.AuthorizedHeaders, authorized)
+		target.BlacklistHeaders = mergeHeaders(target.BlacklistHeaders, blacklist)
 	}
 	return target, nil
 }
@@ -280,6 +877,35 @@ func (c *RequestConditions) blacklistIPRange(req *http.Request) bool {
 	return true
 }
 
+func (c *RequestConditions) blacklistHostingProviders(req *http.Request, state *State) bool {
+	if len(c.BlacklistHostingProviders) == 0 {
+		return true
+	}
+
+	if name, ok := state.hostingProvider(parseRemoteAddr(req.RemoteAddr), c.BlacklistHostingProviders); ok {
+		log.WithFields(log.Fields{
+			"ip":       req.RemoteAddr,
+			"provider": name,
+		}).Debug("Matched blacklisted hosting provider")
+		return false
+	}
+	return true
+}
+
+func (c *RequestConditions) blacklistTor(req *http.Request, state *State) bool {
+	if !c.BlacklistTor {
+		return true
+	}
+
+	if state.TorExit(parseRemoteAddr(req.RemoteAddr)) {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("Matched Tor exit node")
+		return false
+	}
+	return true
+}
+
 func (c *RequestConditions) authorizedMethods(req *http.Request) bool {
 	if len(c.AuthorizedMethods) == 0 {
 		log.Trace("No authorized methods")
@@ -301,21 +927,95 @@ func (c *RequestConditions) authorizedMethods(req *http.Request) bool {
 	return false
 }
 
-func (c *RequestConditions) authorizedHeaders(req *http.Request) bool {
-	correctHeaders := false
+// blacklistMethods denies requests using a blacklisted HTTP method
+func (c *RequestConditions) blacklistMethods(req *http.Request) bool {
+	for _, m := range c.BlacklistMethods {
+		if strings.EqualFold(req.Method, m) {
+			log.WithFields(log.Fields{
+				"method": m,
+			}).Debug("Matched blacklist HTTP method")
+			return false
+		}
+	}
+	return true
+}
+
+// hostMatches checks if host, without the port, matches any of the host globs
+func hostMatches(hosts []string, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	for _, h := range hosts {
+		if glob.MustCompile(strings.ToLower(h), '.').Match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizedHosts checks the Host header, and the TLS server name if the client sent one,
+// so requests fronted through another domain are not served
+func (c *RequestConditions) authorizedHosts(req *http.Request) bool {
+	if len(c.AuthorizedHosts) == 0 {
+		log.Trace("No authorized hosts")
+		return true
+	}
+
+	if !hostMatches(c.AuthorizedHosts, req.Host) {
+		log.WithFields(log.Fields{
+			"host": req.Host,
+		}).Debug("Host not authorized")
+		return false
+	}
+
+	if req.TLS != nil && req.TLS.ServerName != "" && !hostMatches(c.AuthorizedHosts, req.TLS.ServerName) {
+		log.WithFields(log.Fields{
+			"host":        req.Host,
+			"server_name": req.TLS.ServerName,
+		}).Debug("TLS server name not authorized")
+		return false
+	}
+
+	return true
+}
+
+func (c *RequestConditions) authorizedClients(req *http.Request) bool {
+	if len(c.AuthorizedClients) == 0 {
+		log.Trace("No authorized clients")
+		return true
+	}
+
+	for _, name := range c.AuthorizedClients {
+		if Clients[name].Match(req) {
+			log.WithFields(log.Fields{
+				"client":     name,
+				"user_agent": req.UserAgent(),
+			}).Debug("Matched authorized client")
+			return true
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"user_agent": req.UserAgent(),
+	}).Trace("Did not match an authorized client")
+	return false
+}
 
+func (c *RequestConditions) authorizedHeaders(req *http.Request) bool {
 	if len(c.AuthorizedHeaders) == 0 {
-		log.Trace("No authorized methods")
+		log.Trace("No authorized headers")
 		return true
 	}
 
 	for k, v := range c.AuthorizedHeaders {
-		if req.Header.Get(k) == v {
+		if headerMatches(req, k, v) {
 			log.WithFields(log.Fields{
 				"header_key":   k,
 				"header_value": v,
 			}).Debug("Matched header")
-			correctHeaders = true
+			return true
 		}
 		log.WithFields(log.Fields{
 			"header_key":   k,
@@ -323,178 +1023,1750 @@ func (c *RequestConditions) authorizedHeaders(req *http.Request) bool {
 		}).Trace("Did not match header")
 	}
 
-	return correctHeaders
+	return false
 }
 
-func (c *RequestConditions) authorizedJA3(req *http.Request) bool {
-	hash := md5.Sum([]byte(req.JA3Fingerprint))
-	out := make([]byte, 32)
-	hex.Encode(out, hash[:])
-	ja3 := string(out)
-
-	correctJA3 := false
-
-	if len(c.AuthorizedJA3) == 0 {
-		log.Trace("No authorized JA3 signatures")
-		return true
-	}
-
-	for _, j := range c.AuthorizedJA3 {
-		if ja3 == j {
-			log.WithFields(log.Fields{
-				"target_ja3": j,
-				"req_ja3":    ja3,
-			}).Debug("Authorized JA3 signature matched")
-			correctJA3 = true
-		} else {
+// blacklistHeaders denies requests sending a blacklisted header
+func (c *RequestConditions) blacklistHeaders(req *http.Request) bool {
+	for k, v := range c.BlacklistHeaders {
+		if headerMatches(req, k, v) {
 			log.WithFields(log.Fields{
-				"target_ja3": j,
-				"req_ja3":    ja3,
-			}).Trace("Authorized JA3 signature did not match")
+				"header_key":   k,
+				"header_value": v,
+			}).Debug("Matched blacklist header")
+			return false
 		}
 	}
+	return true
+}
 
-	return correctJA3
+// headerMatches checks if any value of the header key matches the whole regex. An empty regex
+// matches when the header is sent
+func headerMatches(req *http.Request, key, re string) bool {
+	values := req.Header[http.CanonicalHeaderKey(key)]
+	if re == "" {
+		return len(values) != 0
+	}
+	target := regexp.MustCompile("^(?:" + re + ")$")
+	for _, value := range values {
+		if target.MatchString(value) {
+			return true
+		}
+	}
+	return false
 }
 
-func (c *RequestConditions) authorizedExec(req *http.Request) bool {
-	correctExec := false
-	if c.Exec.ScriptPath != "" {
-		cmd := exec.Command(c.Exec.ScriptPath)
+// mergeHeaders overrides the header conditions of headers with those of override. Header names
+// are case insensitive, so the capitalization which was set first is kept
+func mergeHeaders(headers, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return headers
+	}
 
-		stdin, err := cmd.StdinPipe()
-		if err != nil {
-			return false
+	merged := make(map[string]string, len(headers)+len(override))
+	names := make(map[string]string)
+	for k, v := range headers {
+		merged[k] = v
+		names[http.CanonicalHeaderKey(k)] = k
+	}
+	for k, v := range override {
+		if name, ok := names[http.CanonicalHeaderKey(k)]; ok {
+			k = name
 		}
+		names[http.CanonicalHeaderKey(k)] = k
+		merged[k] = v
+	}
+	return merged
+}
 
-		go func() {
-			defer stdin.Close()
-			dump, err := httputil.DumpRequest(req, true)
-			if err == nil {
-				stdin.Write(dump)
+// languageRegex matches languages of authorized_languages and blacklist_languages
+var languageRegex = regexp.MustCompile(`^([a-zA-Z]{2,8}|\*)(-[a-zA-Z0-9]{1,8})?$`)
+
+// acceptLanguages gets the languages accepted by the Accept-Language header. Languages with
+// a quality of 0 are not accepted
+func acceptLanguages(header string) []string {
+	languages := make([]string, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		rejected := false
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+					rejected = true
+				}
 			}
-		}()
-
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return false
 		}
-
-		if c.Exec.Output == strings.TrimSuffix(string(out), "\n") {
-			correctExec = true
+		if !rejected {
+			languages = append(languages, tag)
 		}
-	} else {
-		correctExec = true
 	}
-	return correctExec
+	return languages
 }
 
-func (c *RequestConditions) serveLimit(req *http.Request, state *State) bool {
-	correctServe := true
-	if c.Serve != 0 && req.URL != nil {
-		hits, err := state.GetHits(req.URL.Path)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err,
-			}).Debug("Error getting times served")
-			correctServe = false
-		}
-		if hits >= c.Serve {
-			log.WithFields(log.Fields{
-				"serve_limit":  c.Serve,
-				"times_served": hits,
-			}).Debug("Route exceeds times served")
-			correctServe = false
+// languageMatches checks if the accepted language tag matches target. A target without a
+// region matches every region of the language, and * matches any language
+func languageMatches(target, tag string) bool {
+	target = strings.ToLower(target)
+	targetLang, targetRegion := target, ""
+	if i := strings.Index(target, "-"); i != -1 {
+		targetLang, targetRegion = target[:i], target[i+1:]
+	}
+	lang, region := tag, ""
+	if i := strings.Index(tag, "-"); i != -1 {
+		lang, region = tag[:i], tag[i+1:]
+	}
+
+	if targetLang != "*" && targetLang != lang {
+		return false
+	}
+	return targetRegion == "" || targetRegion == region
+}
+
+// languageMatch checks the languages of the Accept-Language header
+func (c *RequestConditions) languageMatch(req *http.Request) bool {
+	if len(c.AuthorizedLanguages) == 0 && len(c.BlacklistLanguages) == 0 && !c.RequireAcceptLanguage {
+		log.Trace("No language conditions")
+		return true
+	}
+
+	languages := acceptLanguages(req.Header.Get("Accept-Language"))
+	if c.RequireAcceptLanguage && len(languages) == 0 {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("No Accept-Language")
+		return false
+	}
+
+	for _, target := range c.BlacklistLanguages {
+		for _, l := range languages {
+			if languageMatches(target, l) {
+				log.WithFields(log.Fields{
+					"target_language": target,
+					"language":        l,
+				}).Debug("Matched blacklist language")
+				return false
+			}
+		}
+	}
+
+	if len(c.AuthorizedLanguages) == 0 {
+		return true
+	}
+	for _, target := range c.AuthorizedLanguages {
+		for _, l := range languages {
+			if languageMatches(target, l) {
+				log.WithFields(log.Fields{
+					"target_language": target,
+					"language":        l,
+				}).Debug("Matched authorized language")
+				return true
+			}
+		}
+	}
+	log.WithFields(log.Fields{
+		"languages": languages,
+	}).Debug("Did not match authorized language")
+	return false
+}
+
+// acceptMatch checks the Accept header against the authorized and blacklisted regexes
+func (c *RequestConditions) acceptMatch(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	for _, a := range c.BlacklistAccept {
+		if regexp.MustCompile(a).MatchString(accept) {
+			log.WithFields(log.Fields{
+				"target_accept": a,
+				"accept":        accept,
+			}).Debug("Matched blacklist Accept")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedAccept) == 0 {
+		return true
+	}
+	for _, a := range c.AuthorizedAccept {
+		if regexp.MustCompile(a).MatchString(accept) {
+			log.WithFields(log.Fields{
+				"target_accept": a,
+				"accept":        accept,
+			}).Debug("Matched authorized Accept")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"accept": accept,
+	}).Debug("Did not match authorized Accept")
+	return false
+}
+
+// refererMatch checks the Referer header against the authorized and blacklisted regexes
+func (c *RequestConditions) refererMatch(req *http.Request) bool {
+	referer := req.Referer()
+	for _, r := range c.BlacklistReferer {
+		if regexp.MustCompile(r).MatchString(referer) {
+			log.WithFields(log.Fields{
+				"target_referer": r,
+				"referer":        referer,
+			}).Debug("Matched blacklist Referer")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedReferer) == 0 {
+		return true
+	}
+	if referer == "" {
+		log.Debug("No Referer")
+		return false
+	}
+	for _, r := range c.AuthorizedReferer {
+		if regexp.MustCompile(r).MatchString(referer) {
+			log.WithFields(log.Fields{
+				"target_referer": r,
+				"referer":        referer,
+			}).Debug("Matched authorized Referer")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"referer": referer,
+	}).Debug("Did not match authorized Referer")
+	return false
+}
+
+// queryValues gets the URL query parameters of req
+func queryValues(req *http.Request) url.Values {
+	if req.URL == nil {
+		return url.Values{}
+	}
+	return req.URL.Query()
+}
+
+// authorizedQuery checks every authorized query parameter is present with a matching value
+func (c *RequestConditions) authorizedQuery(req *http.Request) bool {
+	if len(c.AuthorizedQuery) == 0 {
+		log.Trace("No authorized query parameters")
+		return true
+	}
+
+	query := queryValues(req)
+	for param, target := range c.AuthorizedQuery {
+		re := regexp.MustCompile(target)
+		matched := false
+		for _, v := range query[param] {
+			if re.MatchString(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			log.WithFields(log.Fields{
+				"param":        param,
+				"target_value": target,
+			}).Debug("Did not match query parameter")
+			return false
+		}
+	}
+	return true
+}
+
+// blacklistQuery denies requests with a query parameter value matching the blacklist
+func (c *RequestConditions) blacklistQuery(req *http.Request) bool {
+	if len(c.BlacklistQuery) == 0 {
+		log.Trace("No blacklisted query parameters")
+		return true
+	}
+
+	query := queryValues(req)
+	for param, target := range c.BlacklistQuery {
+		re := regexp.MustCompile(target)
+		for _, v := range query[param] {
+			if re.MatchString(v) {
+				log.WithFields(log.Fields{
+					"param":        param,
+					"value":        v,
+					"target_value": target,
+				}).Debug("Matched blacklisted query parameter")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// authorizedCookies checks every authorized cookie is sent with a matching value
+func (c *RequestConditions) authorizedCookies(req *http.Request) bool {
+	if len(c.AuthorizedCookies) == 0 {
+		log.Trace("No authorized cookies")
+		return true
+	}
+
+	for name, target := range c.AuthorizedCookies {
+		cookie, err := req.Cookie(name)
+		if err != nil || !regexp.MustCompile(target).MatchString(cookie.Value) {
+			log.WithFields(log.Fields{
+				"cookie":       name,
+				"target_value": target,
+			}).Debug("Did not match cookie")
+			return false
+		}
+	}
+	return true
+}
+
+// cookieAbsent denies requests which send a cookie which must be absent
+func (c *RequestConditions) cookieAbsent(req *http.Request) bool {
+	for _, name := range c.RequireCookieAbsent {
+		if _, err := req.Cookie(name); err == nil {
+			log.WithFields(log.Fields{
+				"cookie": name,
+			}).Debug("Cookie which must be absent was sent")
+			return false
+		}
+	}
+	return true
+}
+
+// defaultMaxBodyRead is the number of bytes of the request body matched when max_body_read is not set
+const defaultMaxBodyRead = 1 << 16
+
+// peekBody reads up to max bytes of the request body and puts them back for anything which is
+// served afterwards
+func peekBody(req *http.Request, max int64) []byte {
+	if req.Body == nil {
+		return []byte{}
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Unable to read request body")
+	}
+	req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	return body
+}
+
+// maxBodyRead gets the number of bytes of the request body which are matched
+func (c *RequestConditions) maxBodyRead() int64 {
+	if c.MaxBodyRead == 0 {
+		return defaultMaxBodyRead
+	}
+	return c.MaxBodyRead
+}
+
+// bodyMatch checks the request body against the authorized and blacklisted body regexes
+func (c *RequestConditions) bodyMatch(req *http.Request) bool {
+	if len(c.AuthorizedBody) == 0 && len(c.BlacklistBody) == 0 {
+		log.Trace("No body conditions")
+		return true
+	}
+
+	body := peekBody(req, c.maxBodyRead())
+
+	for _, b := range c.BlacklistBody {
+		if regexp.MustCompile(b).Match(body) {
+			log.WithFields(log.Fields{
+				"target_body": b,
+			}).Debug("Matched blacklist body")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedBody) == 0 {
+		return true
+	}
+	for _, b := range c.AuthorizedBody {
+		if regexp.MustCompile(b).Match(body) {
+			log.WithFields(log.Fields{
+				"target_body": b,
+			}).Debug("Matched authorized body")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"length": len(body),
+	}).Debug("Did not match authorized body")
+	return false
+}
+
+// globalBlacklist denies clients whose IP or JA3 was reported by a detonation
+func globalBlacklist(req *http.Request, state *State) bool {
+	var ja3 string
+	if req.JA3Fingerprint != "" {
+		ja3 = ja3Digest(req.JA3Fingerprint)
+	}
+	if state.Blacklisted(parseRemoteAddr(req.RemoteAddr), ja3) {
+		log.WithFields(log.Fields{
+			"ip":  req.RemoteAddr,
+			"ja3": ja3,
+		}).Debug("Client is blacklisted")
+		return false
+	}
+	return true
+}
+
+func (c *RequestConditions) authorizedJA3(req *http.Request) bool {
+	hash := md5.Sum([]byte(req.JA3Fingerprint))
+	out := make([]byte, 32)
+	hex.Encode(out, hash[:])
+	ja3 := string(out)
+
+	correctJA3 := false
+
+	if len(c.AuthorizedJA3) == 0 {
+		log.Trace("No authorized JA3 signatures")
+		return true
+	}
+
+	for _, j := range c.AuthorizedJA3 {
+		if ja3 == j {
+			log.WithFields(log.Fields{
+				"target_ja3": j,
+				"req_ja3":    ja3,
+			}).Debug("Authorized JA3 signature matched")
+			correctJA3 = true
 		} else {
 			log.WithFields(log.Fields{
-				"serve_limit":  c.Serve,
-				"times_served": hits,
-			}).Trace("Route served")
+				"target_ja3": j,
+				"req_ja3":    ja3,
+			}).Trace("Authorized JA3 signature did not match")
+		}
+	}
+
+	return correctJA3
+}
+
+func (c *RequestConditions) authorizedJA3Raw(req *http.Request) bool {
+	if len(c.AuthorizedJA3Raw) == 0 {
+		log.Trace("No authorized raw JA3 signatures")
+		return true
+	}
+
+	for _, j := range c.AuthorizedJA3Raw {
+		re := regexp.MustCompile(j)
+		if re.MatchString(req.JA3Fingerprint) {
+			log.WithFields(log.Fields{
+				"target_ja3": j,
+				"req_ja3":    req.JA3Fingerprint,
+			}).Debug("Authorized raw JA3 signature matched")
+			return true
+		}
+		log.WithFields(log.Fields{
+			"target_ja3": j,
+			"req_ja3":    req.JA3Fingerprint,
+		}).Trace("Authorized raw JA3 signature did not match")
+	}
+
+	return false
+}
+
+func (c *RequestConditions) authorizedJA4(req *http.Request) bool {
+	if len(c.AuthorizedJA4) == 0 {
+		log.Trace("No authorized JA4 fingerprints")
+		return true
+	}
+
+	ja4, err := JA4(req.ClientHello)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Unable to fingerprint client hello with JA4")
+		return false
+	}
+
+	for _, j := range c.AuthorizedJA4 {
+		if ja4 == j {
+			log.WithFields(log.Fields{
+				"target_ja4": j,
+				"req_ja4":    ja4,
+			}).Debug("Authorized JA4 fingerprint matched")
+			return true
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"req_ja4": ja4,
+	}).Trace("No authorized JA4 fingerprint matched")
+	return false
+}
+
+func (c *RequestConditions) authorizedHeaderOrder(req *http.Request) bool {
+	if len(c.AuthorizedHeaderOrder) == 0 {
+		log.Trace("No authorized header orders")
+		return true
+	}
+
+	order := strings.Join(req.HeaderOrder, ",")
+	for _, o := range c.AuthorizedHeaderOrder {
+		if strings.EqualFold(strings.Replace(o, " ", "", -1), order) {
+			log.WithFields(log.Fields{
+				"header_order": order,
+			}).Debug("Authorized header order matched")
+			return true
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"header_order": order,
+	}).Trace("No authorized header order matched")
+	return false
+}
+
+func (c *RequestConditions) authorizedExec(req *http.Request, gip geoip.DB) bool {
+	if c.Exec.ScriptPath == "" {
+		return true
+	}
+
+	dump, err := httputil.DumpRequest(req, true)
+	if err != nil {
+		return false
+	}
+
+	out, code, err := c.runExec(dump, requestEnv(req, gip))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"script": c.Exec.ScriptPath,
+			"error":  err,
+		}).Debug("Exec script failed")
+		return false
+	}
+
+	if !c.execMatch(out, code) {
+		log.WithFields(log.Fields{
+			"script":    c.Exec.ScriptPath,
+			"exit_code": code,
+		}).Debug("Exec script did not match")
+		return false
+	}
+	return true
+}
+
+func (c *RequestConditions) fresh(state *State) bool {
+	if c.MaxAge == "" {
+		return true
+	}
+
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"max_age": c.MaxAge,
+		}).Debug("Could not parse max_age")
+		return false
+	}
+
+	modified := state.RulesModified()
+	if modified.IsZero() {
+		log.Trace("No rules modification time")
+		return true
+	}
+
+	if age := time.Since(modified); age > maxAge {
+		log.WithFields(log.Fields{
+			"max_age":  c.MaxAge,
+			"modified": modified,
+		}).Warn("Rules are older than max_age. Not serving")
+		return false
+	}
+
+	return true
+}
+
+// parseWeekday parses a short or long English day name
+func parseWeekday(day string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(day, d.String()) || strings.EqualFold(day, d.String()[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// parseServeHours parses a window like 09:00-17:00 into minutes since midnight
+func parseServeHours(hours string) (int, int, error) {
+	parts := strings.SplitN(hours, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, errors.New(fmt.Sprintf("%s is not a valid serve_hours window", hours))
+	}
+
+	var minutes [2]int
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return 0, 0, errors.New(fmt.Sprintf("%s is not a valid serve_hours window", hours))
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, errors.New(fmt.Sprintf("%s is an empty serve_hours window", hours))
+	}
+
+	return minutes[0], minutes[1], nil
+}
+
+// servingWindow checks now is within the dates, hours, and days the path is served
+func (c *RequestConditions) servingWindow(now time.Time) bool {
+	if c.ServeAfter != "" {
+		after, err := time.Parse(time.RFC3339, c.ServeAfter)
+		if err != nil || now.Before(after) {
+			log.WithFields(log.Fields{
+				"serve_after": c.ServeAfter,
+			}).Debug("Path is not served yet")
+			return false
+		}
+	}
+
+	if c.ServeBefore != "" {
+		before, err := time.Parse(time.RFC3339, c.ServeBefore)
+		if err != nil || !now.Before(before) {
+			log.WithFields(log.Fields{
+				"serve_before": c.ServeBefore,
+			}).Debug("Path is no longer served")
+			return false
+		}
+	}
+
+	if c.ServeHours == "" && len(c.ServeDays) == 0 {
+		return true
+	}
+
+	location := time.UTC
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"timezone": c.Timezone,
+			}).Debug("Could not load timezone")
+			return false
+		}
+		location = loc
+	}
+	local := now.In(location)
+
+	if len(c.ServeDays) != 0 {
+		served := false
+		for _, d := range c.ServeDays {
+			if day, ok := parseWeekday(d); ok && day == local.Weekday() {
+				served = true
+			}
+		}
+		if !served {
+			log.WithFields(log.Fields{
+				"day": local.Weekday(),
+			}).Debug("Path is not served today")
+			return false
+		}
+	}
+
+	if c.ServeHours != "" {
+		start, end, err := parseServeHours(c.ServeHours)
+		if err != nil {
+			return false
+		}
+		minute := local.Hour()*60 + local.Minute()
+		inWindow := minute >= start && minute < end
+		// Windows crossing midnight
+		if start > end {
+			inWindow = minute >= start || minute < end
+		}
+		if !inWindow {
+			log.WithFields(log.Fields{
+				"serve_hours": c.ServeHours,
+				"time":        local.Format("15:04"),
+			}).Debug("Path is not served at this time")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *RequestConditions) serveLimit(req *http.Request, state *State) bool {
+	correctServe := true
+	if c.Serve != 0 && req.URL != nil {
+		if !state.Available() {
+			return c.stateFallback("serve")
+		}
+		hits, err := state.GetHits(c.counter(req))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Debug("Error getting times served")
+			return c.stateFallback("serve")
+		}
+		if hits >= c.Serve {
+			log.WithFields(log.Fields{
+				"serve_limit":  c.Serve,
+				"times_served": hits,
+			}).Debug("Route exceeds times served")
+			correctServe = false
+		} else {
+			log.WithFields(log.Fields{
+				"serve_limit":  c.Serve,
+				"times_served": hits,
+			}).Trace("Route served")
+		}
+	}
+	return correctServe
+}
+
+// ClientKeys identifies the client of req for each per-client serve limit
+func (c *RequestConditions) ClientKeys(req *http.Request) map[string]uint64 {
+	keys := make(map[string]uint64)
+	if c.ServePerIP != 0 {
+		keys["ip:"+parseRemoteAddr(req.RemoteAddr).String()] = c.ServePerIP
+	}
+	if c.ServePerSession != 0 {
+		if cookie, err := req.Cookie(c.SessionCookie); err == nil && cookie.Value != "" {
+			keys["session:"+cookie.Value] = c.ServePerSession
+		}
+	}
+	return keys
+}
+
+// counter gets the key the serve counters of req are kept under, which is
+// shared by every path in the same counter group
+func (c *RequestConditions) counter(req *http.Request) string {
+	if c.CounterGroup != "" {
+		return counterGroupKey(c.CounterGroup)
+	}
+	return req.URL.Path
+}
+
+// clientLimited is true when serves are limited per client
+func (c *RequestConditions) clientLimited() bool {
+	return c.ServePerIP != 0 || c.ServePerSession != 0
+}
+
+// serveLimited is true when serves are limited in total or per client, which
+// are counted under the path or its counter group
+func (c *RequestConditions) serveLimited() bool {
+	return c.Serve != 0 || c.clientLimited()
+}
+
+func (c *RequestConditions) clientServeLimit(req *http.Request, state *State) bool {
+	if !c.clientLimited() || req.URL == nil {
+		return true
+	}
+
+	keys := c.ClientKeys(req)
+	if cookie, err := req.Cookie(c.SessionCookie); c.ServePerSession != 0 && (err != nil || cookie.Value == "") {
+		log.WithFields(log.Fields{
+			"ip":     req.RemoteAddr,
+			"cookie": c.SessionCookie,
+		}).Debug("No session cookie")
+		return false
+	}
+
+	if !state.Available() {
+		return c.stateFallback("serve_per_client")
+	}
+	for key, limit := range keys {
+		hits, err := state.GetClientHits(c.counter(req), key)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Debug("Error getting times served to client")
+			return c.stateFallback("serve_per_client")
+		}
+		if hits >= limit {
+			log.WithFields(log.Fields{
+				"client":       key,
+				"serve_limit":  limit,
+				"times_served": hits,
+			}).Debug("Route exceeds times served to client")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *RequestConditions) prereqMatch(req *http.Request, state *State) bool {
+	filledPrereq := true
+	if len(c.PrereqPaths) == 0 {
+		return true
+	}
+
+	var within time.Duration
+	if c.PrereqWithin != "" {
+		within, _ = time.ParseDuration(c.PrereqWithin)
+	}
+
+	kind := c.PrereqKey
+	if kind == "" {
+		kind = "ip"
+	}
+
+	filledPrereq = state.MatchClientPaths(req, kind, c.PrereqPaths, within)
+	if filledPrereq {
+		log.WithFields(log.Fields{
+			"prereqs": c.PrereqPaths,
+			"within":  c.PrereqWithin,
+			"key":     kind,
+		}).Debug("Matched prerequisites")
+	} else {
+		log.WithFields(log.Fields{
+			"prereqs": c.PrereqPaths,
+			"within":  c.PrereqWithin,
+			"key":     kind,
+		}).Debug("Did not match prerequisites")
+	}
+
+	return filledPrereq
+}
+
+func (c *RequestConditions) geoipMatch(req *http.Request, gip geoip.DB) bool {
+	targetHost := parseRemoteAddr(req.RemoteAddr)
+	correctGeoIP := true
+	if gip.HasDB() {
+		cc, err := gip.CountryCode(targetHost)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Error getting country code")
+			return false
+		}
+
+		// Authorized GeoIP
+		if len(c.GeoIP.AuthorizedCountries) != 0 {
+			correctGeoIP = false
+			for _, targetCC := range c.GeoIP.AuthorizedCountries {
+				if countryMatch(targetCC, cc, targetHost, gip) {
+					log.WithFields(log.Fields{
+						"target_countrycode": targetCC,
+						"countrycode":        cc,
+					}).Debug("Matched authorized country code")
+					correctGeoIP = true
+				} else {
+					log.WithFields(log.Fields{
+						"target_countrycode": targetCC,
+						"countrycode":        cc,
+					}).Trace("Did not match authorized country code")
+				}
+			}
+		}
+
+		// Blacklist GeoIP
+		if len(c.GeoIP.BlacklistCountries) != 0 {
+			for _, targetCC := range c.GeoIP.BlacklistCountries {
+				if countryMatch(targetCC, cc, targetHost, gip) {
+					log.WithFields(log.Fields{
+						"target_countrycode": targetCC,
+						"countrycode":        cc,
+					}).Debug("Matched blacklist country code")
+					return false
+				}
+				log.WithFields(log.Fields{
+					"target_countrycode": targetCC,
+					"countrycode":        cc,
+				}).Trace("Did not match blacklist country code")
+			}
+		}
+
+		if correctGeoIP {
+			correctGeoIP = c.geoipLocationMatch(targetHost, gip)
+		}
+	}
+	return correctGeoIP
+}
+
+// validateCountry checks an entry of authorized_countries or blacklist_countries. Groups
+// from country_groups are only known once the configuration is loaded, so any group name is valid
+func validateCountry(country string) error {
+	switch kind, name := splitAttribute(country); kind {
+	case "continent":
+		if _, ok := geoip.Continents[strings.ToUpper(name)]; !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid continent", name))
+		}
+	case "group":
+		if name == "" {
+			return errors.New(fmt.Sprintf("%s is not a valid country group", country))
+		}
+	}
+	return nil
+}
+
+// countryMatch checks if the client at ip in country cc is in country, an ISO country
+// code, continent:<code>, or group:<name>
+func countryMatch(country, cc string, ip net.IP, gip geoip.DB) bool {
+	switch kind, name := splitAttribute(country); kind {
+	case "continent":
+		continent, err := gip.ContinentCode(ip)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Error getting continent code")
+			return false
+		}
+		return strings.EqualFold(continent, name)
+	case "group":
+		countries, ok := gip.Group(name)
+		if !ok {
+			log.WithFields(log.Fields{
+				"group": name,
+			}).Warn("Unknown country group. Add it to country_groups")
+			return false
+		}
+		return containsFold(countries, cc)
+	}
+	return country == cc
+}
+
+// containsFold checks if targets contains any of values, ignoring case
+func containsFold(targets []string, values ...string) bool {
+	for _, t := range targets {
+		for _, v := range values {
+			if v != "" && strings.EqualFold(t, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *RequestConditions) geoipLocationMatch(targetHost net.IP, gip geoip.DB) bool {
+	if len(c.GeoIP.AuthorizedCities) == 0 && len(c.GeoIP.AuthorizedRegions) == 0 && len(c.GeoIP.AuthorizedTimezones) == 0 {
+		return true
+	}
+
+	location, err := gip.Location(targetHost)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Error getting location. Is geoip_path a GeoIP2-City DB?")
+		return false
+	}
+
+	fields := log.Fields{
+		"city":     location.City,
+		"regions":  location.Regions,
+		"timezone": location.TimeZone,
+	}
+	if len(c.GeoIP.AuthorizedCities) != 0 && !containsFold(c.GeoIP.AuthorizedCities, location.City) {
+		log.WithFields(fields).Debug("Did not match authorized city")
+		return false
+	}
+	if len(c.GeoIP.AuthorizedRegions) != 0 && !containsFold(c.GeoIP.AuthorizedRegions, location.Regions...) {
+		log.WithFields(fields).Debug("Did not match authorized region")
+		return false
+	}
+	if len(c.GeoIP.AuthorizedTimezones) != 0 && !containsFold(c.GeoIP.AuthorizedTimezones, location.TimeZone) {
+		log.WithFields(fields).Debug("Did not match authorized timezone")
+		return false
+	}
+
+	log.WithFields(fields).Debug("Matched authorized location")
+	return true
+}
+
+// asnRegex matches an AS number, like AS8075 or 8075
+var asnRegex = regexp.MustCompile(`^(?i:AS)?([0-9]+)$`)
+
+// asnMatches checks if target is the AS number or matches the organization of an AS
+func asnMatches(target string, number uint, org string) bool {
+	if m := asnRegex.FindStringSubmatch(target); m != nil {
+		return m[1] == strconv.FormatUint(uint64(number), 10)
+	}
+	return regexp.MustCompile(target).MatchString(org)
+}
+
+func (c *RequestConditions) asnMatch(req *http.Request, gip geoip.DB) bool {
+	if len(c.AuthorizedASN) == 0 && len(c.BlacklistASN) == 0 {
+		return true
+	}
+
+	if !gip.HasASN() {
+		log.Trace("No ASN DB")
+		return true
+	}
+
+	targetHost := parseRemoteAddr(req.RemoteAddr)
+	number, org, err := gip.ASN(targetHost)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Error getting ASN")
+		return false
+	}
+
+	for _, target := range c.BlacklistASN {
+		if asnMatches(target, number, org) {
+			log.WithFields(log.Fields{
+				"target_asn": target,
+				"asn":        number,
+				"org":        org,
+			}).Debug("Matched blacklist ASN")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedASN) == 0 {
+		return true
+	}
+	for _, target := range c.AuthorizedASN {
+		if asnMatches(target, number, org) {
+			log.WithFields(log.Fields{
+				"target_asn": target,
+				"asn":        number,
+				"org":        org,
+			}).Debug("Matched authorized ASN")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"asn": number,
+		"org": org,
+	}).Debug("Did not match authorized ASN")
+	return false
+}
+
+// forwardedHeaders are headers set by proxies which spoofing tools also send
+var forwardedHeaders = []string{"X-Forwarded-For", "Forwarded"}
+
+func (c *RequestConditions) denyForwarded(req *http.Request) bool {
+	if !c.DenyForwarded.Enabled {
+		return true
+	}
+
+	targetHost := parseRemoteAddr(req.RemoteAddr)
+	for _, r := range c.DenyForwarded.TrustedProxies {
+		_, tmpRange, err := net.ParseCIDR(r)
+		if (err == nil && tmpRange.Contains(targetHost)) || net.ParseIP(r).Equal(targetHost) {
+			log.WithFields(log.Fields{
+				"ip": r,
+			}).Trace("Request from trusted proxy")
+			return true
+		}
+	}
+
+	for _, header := range forwardedHeaders {
+		if value := req.Header.Get(header); value != "" {
+			log.WithFields(log.Fields{
+				"ip":     req.RemoteAddr,
+				"header": header,
+				"value":  value,
+			}).Info("Client sent forwarded header without a trusted proxy")
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *RequestConditions) authorizedHTTP2Fingerprint(req *http.Request) bool {
+	if len(c.AuthorizedHTTP2Fingerprint) == 0 {
+		log.Trace("No authorized HTTP/2 fingerprints")
+		return true
+	}
+
+	if req.HTTP2Fingerprint == "" {
+		log.WithFields(log.Fields{
+			"ip":    req.RemoteAddr,
+			"proto": req.Proto,
+		}).Trace("No HTTP/2 fingerprint")
+		return false
+	}
+
+	hash := md5.Sum([]byte(req.HTTP2Fingerprint))
+	digest := hex.EncodeToString(hash[:])
+	for _, f := range c.AuthorizedHTTP2Fingerprint {
+		if f == req.HTTP2Fingerprint || strings.EqualFold(f, digest) {
+			log.WithFields(log.Fields{
+				"target_http2": f,
+				"req_http2":    req.HTTP2Fingerprint,
+			}).Debug("Authorized HTTP/2 fingerprint matched")
+			return true
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"req_http2": req.HTTP2Fingerprint,
+	}).Trace("Authorized HTTP/2 fingerprint did not match")
+	return false
+}
+
+// httpVersions are the HTTP versions usable in authorized_http_versions
+var httpVersions = map[string]bool{"HTTP/1.0": true, "HTTP/1.1": true, "HTTP/2": true}
+
+// httpVersion gets the HTTP version of req, like HTTP/1.1 or HTTP/2
+func httpVersion(req *http.Request) string {
+	if req.ProtoMajor == 2 {
+		return "HTTP/2"
+	}
+	return fmt.Sprintf("HTTP/%d.%d", req.ProtoMajor, req.ProtoMinor)
+}
+
+// authorizedHTTPVersions checks the HTTP version of req against the authorized ones
+func (c *RequestConditions) authorizedHTTPVersions(req *http.Request) bool {
+	if len(c.AuthorizedHTTPVersions) == 0 {
+		return true
+	}
+
+	version := httpVersion(req)
+	for _, v := range c.AuthorizedHTTPVersions {
+		if v == version {
+			return true
+		}
+	}
+
+	alpn := ""
+	if req.TLS != nil {
+		alpn = req.TLS.NegotiatedProtocol
+	}
+	log.WithFields(log.Fields{
+		"http_version": version,
+		"alpn":         alpn,
+	}).Debug("Did not match authorized HTTP version")
+	return false
+}
+
+// tlsMatch checks the negotiated TLS version and cipher suite, and the cipher suites and groups
+// offered by the client, against the authorized and blacklisted ones
+func (c *RequestConditions) tlsMatch(req *http.Request) bool {
+	authorized := len(c.AuthorizedTLSVersions) != 0 || len(c.AuthorizedCipherSuites) != 0 || len(c.AuthorizedCipherOrder) != 0 || len(c.RequireSupportedGroups) != 0
+	if req.TLS == nil {
+		if authorized {
+			log.WithFields(log.Fields{
+				"ip": req.RemoteAddr,
+			}).Debug("Request was not made over TLS")
+		}
+		return !authorized
+	}
+
+	version := tlsVersionName(req.TLS.Version)
+	for _, v := range c.BlacklistTLSVersions {
+		if v == version {
+			log.WithFields(log.Fields{
+				"tls_version": version,
+			}).Debug("Matched blacklist TLS version")
+			return false
+		}
+	}
+	if len(c.AuthorizedTLSVersions) != 0 {
+		matched := false
+		for _, v := range c.AuthorizedTLSVersions {
+			matched = matched || v == version
+		}
+		if !matched {
+			log.WithFields(log.Fields{
+				"tls_version": version,
+			}).Debug("Did not match authorized TLS version")
+			return false
+		}
+	}
+
+	for _, suite := range c.BlacklistCipherSuites {
+		if id, _ := parseCipherSuite(suite); id == req.TLS.CipherSuite {
+			log.WithFields(log.Fields{
+				"cipher_suite": suite,
+			}).Debug("Matched blacklist cipher suite")
+			return false
+		}
+	}
+	if len(c.AuthorizedCipherSuites) != 0 {
+		matched := false
+		for _, suite := range c.AuthorizedCipherSuites {
+			id, _ := parseCipherSuite(suite)
+			matched = matched || id == req.TLS.CipherSuite
+		}
+		if !matched {
+			log.WithFields(log.Fields{
+				"cipher_suite": fmt.Sprintf("0x%04x", req.TLS.CipherSuite),
+			}).Debug("Did not match authorized cipher suite")
+			return false
+		}
+	}
+
+	order := ja3Field(req.JA3Fingerprint, 1)
+	for _, re := range c.BlacklistCipherOrder {
+		if regexp.MustCompile(re).MatchString(order) {
+			log.WithFields(log.Fields{
+				"target_cipher_order": re,
+				"cipher_order":        order,
+			}).Debug("Matched blacklist cipher order")
+			return false
+		}
+	}
+	if len(c.AuthorizedCipherOrder) != 0 {
+		matched := false
+		for _, re := range c.AuthorizedCipherOrder {
+			matched = matched || regexp.MustCompile(re).MatchString(order)
+		}
+		if !matched {
+			log.WithFields(log.Fields{
+				"cipher_order": order,
+			}).Debug("Did not match authorized cipher order")
+			return false
+		}
+	}
+
+	groups := offeredGroups(req.JA3Fingerprint)
+	for _, g := range c.BlacklistSupportedGroups {
+		if id, _ := parseSupportedGroup(g); groups[id] {
+			log.WithFields(log.Fields{
+				"group": g,
+			}).Debug("Client offered blacklisted group")
+			return false
+		}
+	}
+	for _, g := range c.RequireSupportedGroups {
+		if id, _ := parseSupportedGroup(g); !groups[id] {
+			log.WithFields(log.Fields{
+				"group": g,
+			}).Debug("Client did not offer required group")
+			return false
+		}
+	}
+
+	return true
+}
+
+// normalizeCertFingerprint lower cases a hex fingerprint and removes the colons between bytes
+func normalizeCertFingerprint(f string) string {
+	return strings.ToLower(strings.ReplaceAll(f, ":", ""))
+}
+
+func validCertFingerprint(f string) bool {
+	b, err := hex.DecodeString(normalizeCertFingerprint(f))
+	return err == nil && len(b) == sha256.Size
+}
+
+// clientCertMatch checks the TLS client certificate against require_client_cert and the authorized
+// common names and fingerprints
+func (c *RequestConditions) clientCertMatch(req *http.Request) bool {
+	if !c.RequireClientCert && len(c.AuthorizedClientCertCN) == 0 && len(c.AuthorizedClientCertFingerprints) == 0 {
+		return true
+	}
+
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("No client certificate")
+		return false
+	}
+	cert := req.TLS.PeerCertificates[0]
+
+	if len(c.AuthorizedClientCertCN) != 0 {
+		authorized := false
+		for _, cn := range c.AuthorizedClientCertCN {
+			if cn == cert.Subject.CommonName {
+				authorized = true
+				break
+			}
+		}
+		if !authorized {
+			log.WithFields(log.Fields{
+				"cn": cert.Subject.CommonName,
+			}).Debug("Client certificate common name not authorized")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedClientCertFingerprints) != 0 {
+		sum := sha256.Sum256(cert.Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+		for _, f := range c.AuthorizedClientCertFingerprints {
+			if normalizeCertFingerprint(f) == fingerprint {
+				return true
+			}
+		}
+		log.WithFields(log.Fields{
+			"fingerprint": fingerprint,
+		}).Debug("Client certificate fingerprint not authorized")
+		return false
+	}
+
+	return true
+}
+
+// authorizedDomains checks the domain of the NTLM authenticate message sent by the client
+func (c *RequestConditions) authorizedDomains(req *http.Request) bool {
+	if len(c.AuthorizedDomains) == 0 {
+		log.Trace("No authorized domains")
+		return true
+	}
+
+	msg, msgType, err := ntlmMessage(req)
+	if err != nil || msgType != ntlmAuthenticate {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Trace("No NTLM authenticate message")
+		return false
+	}
+
+	auth, err := ParseNTLMAuthenticate(msg)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ip":    req.RemoteAddr,
+			"error": err,
+		}).Debug("Invalid NTLM authenticate message")
+		return false
+	}
+
+	fields := log.Fields{
+		"ip":          req.RemoteAddr,
+		"domain":      auth.Domain,
+		"user":        auth.User,
+		"workstation": auth.Workstation,
+	}
+	for _, d := range c.AuthorizedDomains {
+		if auth.Domain != "" && strings.EqualFold(auth.Domain, d) {
+			log.WithFields(fields).Debug("Authorized domain matched")
+			return true
+		}
+	}
+
+	log.WithFields(fields).Debug("NTLM domain not authorized")
+	return false
+}
+
+// rdnsMatch checks the reverse DNS names of the client against the rDNS lists.
+// Blacklisted names match any PTR name, but authorized names must resolve back
+// to the client so a spoofed PTR record cannot grant access
+func (c *RequestConditions) rdnsMatch(req *http.Request, state *State) bool {
+	if len(c.AuthorizedRDNS) == 0 && len(c.BlacklistRDNS) == 0 {
+		log.Trace("No rDNS names")
+		return true
+	}
+
+	names, confirmed := state.RDNS(parseRemoteAddr(req.RemoteAddr))
+
+	for _, target := range c.BlacklistRDNS {
+		re := regexp.MustCompile(target)
+		for _, name := range names {
+			if re.MatchString(name) {
+				log.WithFields(log.Fields{
+					"target_rdns": target,
+					"rdns":        name,
+				}).Debug("Matched blacklist rDNS")
+				return false
+			}
+		}
+	}
+
+	if len(c.AuthorizedRDNS) == 0 {
+		return true
+	}
+	for _, target := range c.AuthorizedRDNS {
+		re := regexp.MustCompile(target)
+		for _, name := range confirmed {
+			if re.MatchString(name) {
+				log.WithFields(log.Fields{
+					"target_rdns": target,
+					"rdns":        name,
+				}).Debug("Matched authorized rDNS")
+				return true
+			}
+		}
+	}
+	log.WithFields(log.Fields{
+		"rdns": names,
+	}).Debug("Did not match authorized rDNS")
+	return false
+}
+
+// validOS checks if name is an operating system which can be guessed from a SYN
+func validOS(name string) bool {
+	for _, o := range passive.OSes {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePortRange parses a port, or a range of ports like 1024-65535
+func parsePortRange(r string) (int, int, error) {
+	parts := strings.SplitN(r, "-", 2)
+	low, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	high := low
+	if len(parts) == 2 {
+		if high, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if low < 0 || high > 65535 || low > high {
+		return 0, 0, errors.New("port out of range")
+	}
+	return low, high, nil
+}
+
+// authorizedSourcePorts checks the client source port is in an authorized range
+func (c *RequestConditions) authorizedSourcePorts(req *http.Request) bool {
+	if len(c.AuthorizedSourcePorts) == 0 {
+		log.Trace("No authorized source ports")
+		return true
+	}
+
+	_, p, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return false
+	}
+
+	for _, r := range c.AuthorizedSourcePorts {
+		low, high, _ := parsePortRange(r)
+		if port >= low && port <= high {
+			log.WithFields(log.Fields{
+				"target_ports": r,
+				"port":         port,
+			}).Debug("Matched authorized source port")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"port": port,
+	}).Debug("Did not match authorized source port")
+	return false
+}
+
+// osPassiveMatch checks the operating system guessed from the client SYN. Clients whose SYN was
+// not saved are only allowed when no authorized passive OS is configured
+func (c *RequestConditions) osPassiveMatch(req *http.Request) bool {
+	if len(c.AuthorizedOSPassive) == 0 && len(c.BlacklistOSPassive) == 0 && !c.OSPassiveMatchesUserAgent {
+		log.Trace("No passive OS conditions")
+		return true
+	}
+
+	fingerprint, ok := passive.Lookup(req.RemoteAddr)
+	if !ok {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("No passive OS fingerprint")
+		return len(c.AuthorizedOSPassive) == 0
+	}
+	guess := fingerprint.OS()
+
+	for _, o := range c.BlacklistOSPassive {
+		if o == guess {
+			log.WithFields(log.Fields{
+				"os":      guess,
+				"ttl":     fingerprint.TTL,
+				"options": fingerprint.Options,
+			}).Debug("Matched blacklist passive OS")
+			return false
+		}
+	}
+
+	if c.OSPassiveMatchesUserAgent {
+		claimed := passive.UserAgentOS(req.UserAgent())
+		if guess != passive.OSUnknown && claimed != passive.OSUnknown && guess != claimed {
+			log.WithFields(log.Fields{
+				"os":         guess,
+				"user_agent": claimed,
+			}).Debug("Passive OS does not match User-Agent")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedOSPassive) == 0 {
+		return true
+	}
+	for _, o := range c.AuthorizedOSPassive {
+		if o == guess {
+			log.WithFields(log.Fields{
+				"os": guess,
+			}).Debug("Matched authorized passive OS")
+			return true
+		}
+	}
+	log.WithFields(log.Fields{
+		"os":      guess,
+		"ttl":     fingerprint.TTL,
+		"options": fingerprint.Options,
+	}).Debug("Did not match authorized passive OS")
+	return false
+}
+
+// jarmMatch fingerprints the TLS server of the client and checks it against the JARM lists.
+// Scanning is slow, so it is only done when a JARM list is configured, and clients
+// are passed or denied by jarm_pending until their scan is done
+func (c *RequestConditions) jarmMatch(req *http.Request, state *State) bool {
+	if len(c.AuthorizedJARM) == 0 && len(c.BlacklistJARM) == 0 {
+		log.Trace("No JARM fingerprints")
+		return true
+	}
+
+	port := 443
+	if c.JARMPort != 0 {
+		port = c.JARMPort
+	}
+	fingerprint, scanned := state.JARM(parseRemoteAddr(req.RemoteAddr).String(), strconv.Itoa(port))
+	if !scanned {
+		log.WithFields(log.Fields{
+			"ip":      req.RemoteAddr,
+			"pending": c.JARMPending,
+		}).Debug("JARM fingerprint pending")
+		return c.JARMPending == FailOpen
+	}
+
+	for _, j := range c.BlacklistJARM {
+		if strings.EqualFold(fingerprint, j) {
+			log.WithFields(log.Fields{
+				"ip":   req.RemoteAddr,
+				"jarm": fingerprint,
+			}).Debug("Blacklisted JARM fingerprint matched")
+			return false
+		}
+	}
+
+	if len(c.AuthorizedJARM) == 0 {
+		return true
+	}
+
+	for _, j := range c.AuthorizedJARM {
+		if strings.EqualFold(fingerprint, j) {
+			log.WithFields(log.Fields{
+				"ip":   req.RemoteAddr,
+				"jarm": fingerprint,
+			}).Debug("Authorized JARM fingerprint matched")
+			return true
 		}
 	}
-	return correctServe
+
+	log.WithFields(log.Fields{
+		"ip":   req.RemoteAddr,
+		"jarm": fingerprint,
+	}).Trace("Authorized JARM fingerprint did not match")
+	return false
 }
 
-func (c *RequestConditions) prereqMatch(req *http.Request, state *State) bool {
-	filledPrereq := true
-	if len(c.PrereqPaths) == 0 {
+// identicalRequestKey identifies the same client making the same request
+func identicalRequestKey(req *http.Request) string {
+	hash := md5.Sum([]byte(req.JA3Fingerprint))
+	return strings.Join([]string{
+		parseRemoteAddr(req.RemoteAddr).String(),
+		req.Method,
+		req.URL.Path,
+		req.UserAgent(),
+		hex.EncodeToString(hash[:]),
+	}, "|")
+}
+
+func (c *RequestConditions) identicalRequests(req *http.Request, state *State) bool {
+	if c.MaxIdenticalRequests.Count == 0 || req.URL == nil {
+		return true
+	}
+
+	if !state.Available() {
+		return c.stateFallback("max_identical_requests")
+	}
+
+	key := identicalRequestKey(req)
+	if state.Pinned(key) {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("Client pinned to decoy for identical requests")
+		return false
+	}
+
+	window, err := time.ParseDuration(c.MaxIdenticalRequests.Window)
+	if err != nil {
+		// Without a window, all identical requests are counted
+		window = time.Duration(math.MaxInt64)
+	}
+
+	count := state.Repeat(key, window, requestTime(req))
+	if count > c.MaxIdenticalRequests.Count {
+		log.WithFields(log.Fields{
+			"ip":    req.RemoteAddr,
+			"count": count,
+		}).Debug("Too many identical requests. Pinning client to decoy")
+		if err := state.Pin(key); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Error pinning client")
+		}
+		return false
+	}
+
+	log.WithFields(log.Fields{
+		"ip":    req.RemoteAddr,
+		"count": count,
+	}).Trace("Identical requests within limit")
+	return true
+}
+
+// stickyDeny denies clients which were denied sticky_deny times before
+func (c *RequestConditions) stickyDeny(req *http.Request, state *State) bool {
+	if c.StickyDeny == 0 {
+		return true
+	}
+
+	if !state.Available() {
+		return c.stateFallback("sticky_deny")
+	}
+
+	ip := parseRemoteAddr(req.RemoteAddr)
+	if ip == nil {
+		return true
+	}
+	if denials := state.Denials(ip.String()); denials >= uint64(c.StickyDeny) {
+		log.WithFields(log.Fields{
+			"ip":      req.RemoteAddr,
+			"denials": denials,
+		}).Debug("Client pinned to decoy after denials")
+		return false
+	}
+	return true
+}
+
+// Actions taken on requests exceeding rate_limit
+const (
+	RateLimitDeny     = "deny"
+	RateLimitTarpit   = "tarpit"
+	RateLimitRedirect = "redirect"
+)
+
+// rateLimitKey identifies the client and path of req for rate limiting
+func rateLimitKey(req *http.Request) string {
+	return parseRemoteAddr(req.RemoteAddr).String() + "|" + req.URL.Path
+}
+
+func (c *RequestConditions) rateLimit(req *http.Request, state *State) bool {
+	if c.RateLimit.Requests == 0 || req.URL == nil {
+		return true
+	}
+
+	per, err := time.ParseDuration(c.RateLimit.Per)
+	if err != nil {
+		per = time.Minute
+	}
+	burst := c.RateLimit.Burst
+	if burst == 0 {
+		burst = c.RateLimit.Requests
+	}
+
+	if !state.RateLimit(rateLimitKey(req), float64(c.RateLimit.Requests)/per.Seconds(), burst, requestTime(req)) {
+		log.WithFields(log.Fields{
+			"ip":       req.RemoteAddr,
+			"requests": c.RateLimit.Requests,
+			"per":      per,
+		}).Debug("Rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+func (c *RequestConditions) approvalMatch(req *http.Request, state *State) bool {
+	if c.Approval.TTL == "" || req.URL == nil {
 		return true
 	}
 
+	ttl, err := time.ParseDuration(c.Approval.TTL)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"ttl": c.Approval.TTL,
+		}).Debug("Could not parse approval ttl")
+		return false
+	}
+
 	targetHost := parseRemoteAddr(req.RemoteAddr)
-	filledPrereq = state.MatchPaths(targetHost, c.PrereqPaths)
-	if filledPrereq {
+	approved := state.Approvals().Check(targetHost, req.URL.Path, req.UserAgent(), ttl)
+	if approved {
 		log.WithFields(log.Fields{
-			"prereqs": c.PrereqPaths,
-		}).Debug("Matched prerequisites")
+			"ip": targetHost,
+		}).Debug("Request approved by operator")
 	} else {
 		log.WithFields(log.Fields{
-			"prereqs": c.PrereqPaths,
-		}).Debug("Did not match prerequisites")
+			"ip": targetHost,
+		}).Debug("Request waiting on operator approval")
 	}
 
-	return filledPrereq
+	return approved
 }
 
-func (c *RequestConditions) geoipMatch(req *http.Request, gip geoip.DB) bool {
-	targetHost := parseRemoteAddr(req.RemoteAddr)
-	correctGeoIP := true
-	if gip.HasDB() {
-		cc, err := gip.CountryCode(targetHost)
-		if err != nil {
+// ShouldHost returns when an HTTP request should be hosted or not
+func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoip.DB) bool {
+	if ok := c.evaluate(req, state, gip); !ok {
+		return false
+	}
+
+	// Approval must be last so only requests which pass every other condition are queued
+	if ok := c.approvalMatch(req, state); !ok {
+		return false
+	}
+
+	return true
+}
+
+// groupsMatch checks the any, all, and not blocks of the conditions
+func (c *RequestConditions) groupsMatch(req *http.Request, state *State, gip geoip.DB) bool {
+	if len(c.Any) != 0 {
+		matched := false
+		for i := range c.Any {
+			if c.Any[i].evaluate(req, state, gip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
 			log.WithFields(log.Fields{
-				"error": err,
-			}).Error("Error getting country code")
+				"blocks": len(c.Any),
+			}).Debug("No any block matched")
 			return false
 		}
+	}
 
-		// Authorized GeoIP
-		if len(c.GeoIP.AuthorizedCountries) != 0 {
-			correctGeoIP = false
-			for _, targetCC := range c.GeoIP.AuthorizedCountries {
-				if cc == targetCC {
-					log.WithFields(log.Fields{
-						"target_countrycode": targetCC,
-						"countrycode":        cc,
-					}).Debug("Matched authorized country code")
-					correctGeoIP = true
-				} else {
-					log.WithFields(log.Fields{
-						"target_countrycode": targetCC,
-						"countrycode":        cc,
-					}).Trace("Did not match authorized country code")
-				}
-			}
+	for i := range c.All {
+		if !c.All[i].evaluate(req, state, gip) {
+			log.WithFields(log.Fields{
+				"block": i,
+			}).Debug("All block did not match")
+			return false
 		}
+	}
 
-		// Blacklist GeoIP
-		if len(c.GeoIP.BlacklistCountries) != 0 {
-			for _, targetCC := range c.GeoIP.BlacklistCountries {
-				if targetCC == cc {
-					log.WithFields(log.Fields{
-						"target_countrycode": targetCC,
-						"countrycode":        cc,
-					}).Debug("Matched blacklist country code")
-					return false
-				}
-				log.WithFields(log.Fields{
-					"target_countrycode": targetCC,
-					"countrycode":        cc,
-				}).Trace("Did not match blacklist country code")
-			}
-		}
+	if c.Not != nil && c.Not.evaluate(req, state, gip) {
+		log.Debug("Not block matched")
+		return false
 	}
-	return correctGeoIP
+
+	return true
 }
 
-// ShouldHost returns when an HTTP request should be hosted or not
-func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoip.DB) bool {
+// evaluate checks every condition and condition block except approval, which
+// only applies to the top level conditions
+func (c *RequestConditions) evaluate(req *http.Request, state *State, gip geoip.DB) bool {
 	// Not Serving
 	if c.NotServing {
 		log.Trace("Not serving")
 		return false
 	}
 
+	if ok := c.fresh(state); !ok {
+		return false
+	}
+
+	if ok := c.servingWindow(requestTime(req)); !ok {
+		return false
+	}
+
+	if ok := globalBlacklist(req, state); !ok {
+		return false
+	}
+
+	if ok := c.stickyDeny(req, state); !ok {
+		return false
+	}
+
+	// Rate limiting counts every request, including ones failing the other conditions
+	if ok := c.rateLimit(req, state); !ok {
+		return false
+	}
+
 	if ok := c.authorizedUserAgents(req); !ok {
 		return false
 	}
@@ -511,6 +2783,10 @@ func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoi
 		return false
 	}
 
+	if ok := c.authorizedClients(req); !ok {
+		return false
+	}
+
 	if ok := c.authorizedIPRange(req); !ok {
 		return false
 	}
@@ -519,19 +2795,127 @@ func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoi
 		return false
 	}
 
+	if ok := c.blacklistHostingProviders(req, state); !ok {
+		return false
+	}
+
+	if ok := c.blacklistTor(req, state); !ok {
+		return false
+	}
+
 	if ok := c.authorizedMethods(req); !ok {
 		return false
 	}
 
+	if ok := c.blacklistMethods(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedHosts(req); !ok {
+		return false
+	}
+
 	if ok := c.authorizedHeaders(req); !ok {
 		return false
 	}
 
+	if ok := c.blacklistHeaders(req); !ok {
+		return false
+	}
+
+	if ok := c.languageMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.acceptMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.refererMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedQuery(req); !ok {
+		return false
+	}
+
+	if ok := c.blacklistQuery(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedCookies(req); !ok {
+		return false
+	}
+
+	if ok := c.cookieAbsent(req); !ok {
+		return false
+	}
+
+	if ok := c.bodyMatch(req); !ok {
+		return false
+	}
+
 	if ok := c.authorizedJA3(req); !ok {
 		return false
 	}
 
-	if ok := c.authorizedExec(req); !ok {
+	if ok := c.authorizedJA3Raw(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedJA4(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedHeaderOrder(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedHTTP2Fingerprint(req); !ok {
+		return false
+	}
+
+	if ok := c.clientCertMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.tlsMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedHTTPVersions(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedSourcePorts(req); !ok {
+		return false
+	}
+
+	if ok := c.osPassiveMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedDomains(req); !ok {
+		return false
+	}
+
+	if ok := c.basicAuthMatch(req); !ok {
+		return false
+	}
+
+	if ok := c.denyForwarded(req); !ok {
+		return false
+	}
+
+	if ok := c.authorizedExec(req, gip); !ok {
+		return false
+	}
+
+	if ok := c.scriptMatch(req, state, gip); !ok {
+		return false
+	}
+
+	if ok := c.wasmMatch(req, state, gip); !ok {
 		return false
 	}
 
@@ -539,6 +2923,10 @@ func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoi
 		return false
 	}
 
+	if ok := c.clientServeLimit(req, state); !ok {
+		return false
+	}
+
 	if ok := c.prereqMatch(req, state); !ok {
 		return false
 	}
@@ -547,5 +2935,30 @@ func (c *RequestConditions) ShouldHost(req *http.Request, state *State, gip geoi
 		return false
 	}
 
+	if ok := c.asnMatch(req, gip); !ok {
+		return false
+	}
+
+	if ok := c.rdnsMatch(req, state); !ok {
+		return false
+	}
+
+	if ok := c.jarmMatch(req, state); !ok {
+		return false
+	}
+
+	if ok := c.identicalRequests(req, state); !ok {
+		return false
+	}
+
+	// The authorizer is only asked about requests passing every local condition
+	if ok := c.externalAuth(req, state, gip); !ok {
+		return false
+	}
+
+	if ok := c.groupsMatch(req, state, gip); !ok {
+		return false
+	}
+
 	return true
 }
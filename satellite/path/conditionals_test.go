@@ -1,16 +1,28 @@
 package path_test
 
 import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/t94j0/array"
+	"github.com/t94j0/satellite/crypto/tls"
 	"github.com/t94j0/satellite/net/http"
 	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/jarm"
+	"github.com/t94j0/satellite/satellite/passive"
 
 	. "github.com/t94j0/satellite/satellite/path"
 )
@@ -700,6 +712,41 @@ authorized_methods:
 
 }
 
+func TestRequestConditions_ShouldHost_hosts(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	conditions, err := NewRequestConditions([]byte("authorized_hosts: ['*.example.com']"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, c := range []struct {
+		host, serverName string
+		expected         bool
+	}{
+		{"www.example.com", "", true},
+		{"WWW.example.com.:443", "www.example.com", true},
+		{"example.org", "", false},
+		{"www.example.com", "fronted.example.org", false},
+	} {
+		mockRequest := &http.Request{Method: "GET", Host: c.host}
+		if c.serverName != "" {
+			mockRequest.TLS = &tls.ConnectionState{ServerName: c.serverName}
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != c.expected {
+			t.Errorf("%s (%s): expected %t", c.host, c.serverName, c.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_hosts: ['[']")); err == nil {
+		t.Error("invalid glob was accepted")
+	}
+}
+
 func TestRequestConditions_ShouldHost_method_auth_fail(t *testing.T) {
 	// Create HTTP Request
 	mockRequest := &http.Request{Method: "POST"}
@@ -784,6 +831,530 @@ authorized_headers:
 	}
 }
 
+func TestRequestConditions_ShouldHost_header_regex(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_headers:
+  Accept-Language: en-(US|GB)
+  X-Implant: ""
+blacklist_headers:
+  X-Forwarded-For: ""
+  Via: .*squid.*
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		headers  map[string]string
+		expected bool
+	}{
+		{map[string]string{"Accept-Language": "en-US"}, true},
+		{map[string]string{"Accept-Language": "en-US,en;q=0.9"}, false},
+		{map[string]string{"X-Implant": "1"}, true},
+		{map[string]string{"X-Implant": "1", "X-Forwarded-For": "10.0.0.1"}, false},
+		{map[string]string{"X-Implant": "1", "Via": "1.1 squid"}, false},
+		{map[string]string{"X-Implant": "1", "Via": "1.1 example"}, true},
+		{map[string]string{}, false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		for k, v := range tc.headers {
+			mockRequest.Header.Set(k, v)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%v: expected %t", tc.headers, tc.expected)
+		}
+	}
+}
+
+func TestMergeRequestConditions_headers(t *testing.T) {
+	rq1 := RequestConditions{
+		AuthorizedHeaders: map[string]string{"X-Token": "a"},
+		BlacklistHeaders:  map[string]string{"X-Forwarded-For": ""},
+	}
+	rq2 := RequestConditions{
+		AuthorizedHeaders: map[string]string{"x-token": "b"},
+		BlacklistHeaders:  map[string]string{"Via": ""},
+	}
+
+	rq, err := MergeRequestConditions(rq1, rq2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rq.AuthorizedHeaders, map[string]string{"X-Token": "b"}) {
+		t.Errorf("unexpected authorized headers %v", rq.AuthorizedHeaders)
+	}
+	if len(rq.BlacklistHeaders) != 2 {
+		t.Errorf("unexpected blacklist headers %v", rq.BlacklistHeaders)
+	}
+	if rq1.AuthorizedHeaders["X-Token"] != "a" {
+		t.Error("merge modified the merged conditions")
+	}
+}
+
+func TestRequestConditions_ShouldHost_language(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_languages:
+  - en
+  - "*-CH"
+blacklist_languages:
+  - en-IN
+require_accept_language: true
+blacklist_accept:
+  - ^\*/\*$
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browser := "text/html,application/xhtml+xml,*/*;q=0.8"
+	for _, tc := range []struct {
+		language, accept string
+		expected         bool
+	}{
+		{"en-US,en;q=0.9", browser, true},
+		{"fr-CH, fr;q=0.9", browser, true},
+		{"de-DE,de;q=0.9", browser, false},
+		{"de-DE,en;q=0", browser, false},
+		{"en-US,en-IN;q=0.5", browser, false},
+		{"", browser, false},
+		{"en-US", "*/*", false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if tc.language != "" {
+			mockRequest.Header.Set("Accept-Language", tc.language)
+		}
+		mockRequest.Header.Set("Accept", tc.accept)
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%q %q: expected %t", tc.language, tc.accept, tc.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_languages: [en_US]")); err == nil {
+		t.Error("invalid language was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_accept(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_accept:
+  - ^text/html,application/xhtml\+xml
+blacklist_accept:
+  - ^\*/\*$
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		accept   string
+		expected bool
+	}{
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", true},
+		{"*/*", false},
+		{"application/json", false},
+		{"", false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.Header.Set("Accept", tc.accept)
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%q: expected %t", tc.accept, tc.expected)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_referer(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_referer:
+  - ^https://login\.example\.com/
+  - ^https://click\.tracking\.example/
+blacklist_referer:
+  - /preview
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		referer  string
+		expected bool
+	}{
+		{"https://login.example.com/portal", true},
+		{"https://click.tracking.example/c/1234", true},
+		{"https://login.example.com/preview", false},
+		{"https://scanner.example/", false},
+		{"", false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if tc.referer != "" {
+			mockRequest.Header.Set("Referer", tc.referer)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%q: expected %t", tc.referer, tc.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_referer: [\"(\"]")); err == nil {
+		t.Error("invalid regex was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_tls(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+blacklist_tls_versions: [TLS1.0, TLS1.1]
+blacklist_cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]
+authorized_cipher_order: ["^(2570-)?49195-"]
+require_supported_groups: [x25519, "23"]
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browser := "771,2570-49195-49199-49196,0-23-65281-10-11,29-23-24,0"
+	for _, tc := range []struct {
+		version, suite uint16
+		ja3            string
+		expected       bool
+	}{
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, browser, true},
+		{tls.VersionTLS10, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, browser, false},
+		{tls.VersionTLS12, tls.TLS_RSA_WITH_RC4_128_SHA, browser, false},
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, "771,47-49195,0-10-11,29-23,0", false},
+		{tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, "771,49195-49199,0-10-11,23-24,0", false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.TLS = &tls.ConnectionState{Version: tc.version, CipherSuite: tc.suite}
+		mockRequest.JA3Fingerprint = tc.ja3
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%x %x %s: expected %t", tc.version, tc.suite, tc.ja3, tc.expected)
+		}
+	}
+
+	// Plain HTTP has no TLS to authorize
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("plain HTTP request was authorized")
+	}
+
+	for _, data := range []string{"blacklist_tls_versions: [TLSv1]", "authorized_cipher_suites: [TLS_FAKE]", "require_supported_groups: [curve9]"} {
+		if _, err := NewRequestConditions([]byte(data)); err == nil {
+			t.Errorf("%s was accepted", data)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_http_versions(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	conditions, err := NewRequestConditions([]byte("authorized_http_versions: [HTTP/2]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		major, minor int
+		expected     bool
+	}{
+		{2, 0, true},
+		{1, 1, false},
+		{1, 0, false},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.ProtoMajor, mockRequest.ProtoMinor = tc.major, tc.minor
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("HTTP/%d.%d: expected %t", tc.major, tc.minor, tc.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_http_versions: [HTTP/3]")); err == nil {
+		t.Error("invalid HTTP version was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_client_cert(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	operator := &x509.Certificate{Raw: []byte("operator"), Subject: pkix.Name{CommonName: "operator"}}
+	other := &x509.Certificate{Raw: []byte("other"), Subject: pkix.Name{CommonName: "operator"}}
+	sum := sha256.Sum256(operator.Raw)
+	fingerprint := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	for _, tc := range []struct {
+		data     string
+		cert     *x509.Certificate
+		expected bool
+	}{
+		{"require_client_cert: true", operator, true},
+		{"require_client_cert: true", nil, false},
+		{"authorized_client_cert_cn: [operator]", other, true},
+		{"authorized_client_cert_cn: [admin]", operator, false},
+		{"authorized_client_cert_fingerprints: [" + fingerprint + "]", operator, true},
+		{"authorized_client_cert_fingerprints: [" + fingerprint + "]", other, false},
+		{"authorized_client_cert_fingerprints: [" + fingerprint + "]", nil, false},
+	} {
+		conditions, err := NewRequestConditions([]byte(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.TLS = &tls.ConnectionState{}
+		if tc.cert != nil {
+			mockRequest.TLS.PeerCertificates = []*x509.Certificate{tc.cert}
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%s with %v: expected %t", tc.data, tc.cert != nil, tc.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_client_cert_fingerprints: [abcd]")); err == nil {
+		t.Error("invalid fingerprint was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_query(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_query:
+  id: ^[0-9a-f]{8}$
+blacklist_query:
+  debug: ""
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	for uri, expected := range map[string]bool{
+		"/?id=deadbeef":          true,
+		"/?id=other&id=deadbeef": true,
+		"/?id=deadbeef0":         false,
+		"/":                      false,
+		"/?id=deadbeef&debug":    false,
+	} {
+		mockRequest, err := http.NewRequest("GET", uri, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != expected {
+			t.Errorf("%s: expected %t", uri, expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_query: {id: '('}")); err == nil {
+		t.Error("invalid regex was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_osPassive(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_source_ports:
+  - 1024-65535
+blacklist_os_passive:
+  - unknown
+os_passive_matches_user_agent: true
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passive.Default.Set("10.0.0.1:50000", passive.Fingerprint{InitialTTL: 64, Options: "mss,sok,ts,nop,ws"})
+	passive.Default.Set("10.0.0.2:50000", passive.Fingerprint{InitialTTL: 128, Options: "mss,nop,ws,nop,nop,sok"})
+	passive.Default.Set("10.0.0.3:50000", passive.Fingerprint{InitialTTL: 255})
+	passive.Default.Set("10.0.0.4:80", passive.Fingerprint{InitialTTL: 128, Options: "mss,nop,ws,nop,nop,sok"})
+	defer func() {
+		for _, addr := range []string{"10.0.0.1:50000", "10.0.0.2:50000", "10.0.0.3:50000", "10.0.0.4:80"} {
+			passive.Default.Delete(addr)
+		}
+	}()
+
+	windows := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	for _, tc := range []struct {
+		addr     string
+		expected bool
+	}{
+		{"10.0.0.1:50000", false},
+		{"10.0.0.2:50000", true},
+		{"10.0.0.3:50000", false},
+		{"10.0.0.4:80", false},
+		{"10.0.0.5:50000", true},
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.RemoteAddr = tc.addr
+		mockRequest.Header.Set("User-Agent", windows)
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != tc.expected {
+			t.Errorf("%s: expected %t", tc.addr, tc.expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("authorized_os_passive: [beos]")); err == nil {
+		t.Error("invalid passive OS was accepted")
+	}
+	if _, err := NewRequestConditions([]byte("authorized_source_ports: [80-22]")); err == nil {
+		t.Error("invalid source port range was accepted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_body(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_body:
+  - ^id=[0-9a-f]{8}&
+blacklist_body:
+  - (?i)<script
+max_body_read: 32
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for body, expected := range map[string]bool{
+		"id=deadbeef&data=1":                                  true,
+		"id=deadbeef&data=<SCRIPT>":                           false,
+		"id=deadbeef&" + strings.Repeat("a", 32) + "<script>": true,
+		"id=zz": false,
+		"":      false,
+	} {
+		mockRequest, err := http.NewRequest("POST", "/", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != expected {
+			t.Errorf("%q: expected %t", body, expected)
+		}
+		read, err := ioutil.ReadAll(mockRequest.Body)
+		if err != nil || string(read) != body {
+			t.Errorf("%q: body was not put back", body)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_cookies(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := `
+authorized_cookies:
+  stage: ^2$
+require_cookie_absent:
+  - seen
+`
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	for cookie, expected := range map[string]bool{
+		"stage=2":           true,
+		"other=1; stage=2":  true,
+		"stage=1":           false,
+		"":                  false,
+		"stage=2; seen=yes": false,
+	} {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if cookie != "" {
+			mockRequest.Header.Set("Cookie", cookie)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != expected {
+			t.Errorf("%q: expected %t", cookie, expected)
+		}
+	}
+}
+
 func TestRequestConditions_ShouldHost_ja3(t *testing.T) {
 	// TODO: Add tests for JA3
 
@@ -889,8 +1460,7 @@ func TestRequestConditions_ShouldHost_exec_fail(t *testing.T) {
 	}
 }
 
-func TestRequestConditions_ShouldHost_notserving(t *testing.T) {
-	// Create HTTP Request
+func TestRequestConditions_ShouldHost_exec_isolation(t *testing.T) {
 	mockRequest, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
 		t.Error(err)
@@ -900,25 +1470,139 @@ func TestRequestConditions_ShouldHost_notserving(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	defer RemoveDB(file)
 
-	// Create RequestConditions object
-	data := `
-not_serving: true`
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	conditions, err := NewRequestConditions([]byte(data))
+	os.Setenv("SATELLITE_SECRET", "leaked")
+	defer os.Unsetenv("SATELLITE_SECRET")
+
+	for _, tc := range []struct {
+		name, script, options string
+		hosted                bool
+	}{
+		{"env", "echo ${CAMPAIGN}${SATELLITE_SECRET}", "env: [CAMPAIGN=ok]", true},
+		{"timeout", "sleep 5; echo ok", "timeout: 100ms", false},
+		{"background", "sleep 5 & echo ok; wait", "timeout: 100ms", false},
+		{"memory", `[ "$(ulimit -v)" = 65536 ] && echo ok`, "max_memory_mb: 64", true},
+		{"cpu", `[ "$(ulimit -t)" = 2 ] && echo ok`, "max_cpu: 1500ms", true},
+	} {
+		script := filepath.Join(dir, tc.name+".sh")
+		if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"+tc.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf("exec:\n  script: %s\n  output: ok\n  %s", script, tc.options)
+		conditions, err := NewRequestConditions([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if hosted := conditions.ShouldHost(mockRequest, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("%s: expected hosted %t, got %t", tc.name, tc.hosted, hosted)
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Errorf("%s: script was not killed", tc.name)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_exec_interface(t *testing.T) {
+	state, file, err := TemporaryDB()
 	if err != nil {
 		t.Error(err)
 	}
-	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
-		t.Fail()
+	defer RemoveDB(file)
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	if err := RemoveDB(file); err != nil {
-		t.Error(err)
+	for _, tc := range []struct {
+		name, script, options string
+		hosted                bool
+	}{
+		{"args", `[ "$1" = stage ] && echo ok`, "args: [stage]\n  output: ok", true},
+		{"metadata", `echo "$SATELLITE_IP $SATELLITE_USER_AGENT $SATELLITE_PATH"`, "output_regex: ^192\\.0\\.2\\.1 implant /stage$", true},
+		{"regex", "echo score=12", `output_regex: "score=[0-9]{3}"`, false},
+		{"exit_code", "exit 3", "exit_codes: [3]", true},
+		{"exit_code_denied", "exit 1", "exit_codes: [3]", false},
+		{"exit_code_output", "echo no; exit 3", "exit_codes: [3]\n  output: ok", false},
+	} {
+		script := filepath.Join(dir, tc.name+".sh")
+		if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"+tc.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := fmt.Sprintf("exec:\n  script: %s\n  %s", script, tc.options)
+		conditions, err := NewRequestConditions([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", "implant")
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("%s: expected hosted %t, got %t", tc.name, tc.hosted, hosted)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("exec:\n  script: /bin/true\n  output_regex: '('")); err == nil {
+		t.Error("invalid output_regex was validated")
 	}
 }
 
-func TestRequestConditions_ShouldHost_serve_one_succeed(t *testing.T) {
+func TestRequestConditions_ShouldHost_groups(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	conditions, err := NewRequestConditions([]byte(`
+any:
+  - authorized_useragents: [Chrome]
+    not:
+      authorized_methods: [POST]
+  - authorized_iprange: [10.0.0.0/8]
+blacklist_iprange: [10.6.6.6]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, ip, ua string
+		hosted         bool
+	}{
+		{"GET", "192.0.2.1", "Chrome", true},
+		{"POST", "192.0.2.1", "Chrome", false},
+		{"GET", "192.0.2.1", "curl", false},
+		{"POST", "10.0.0.1", "curl", true},
+		{"GET", "10.6.6.6", "Chrome", false},
+	} {
+		req, _ := http.NewRequest(tc.method, "/", nil)
+		req.RemoteAddr = tc.ip + ":1234"
+		req.Header.Set("User-Agent", tc.ua)
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("%s %s %s: expected hosted %t, got %t", tc.method, tc.ip, tc.ua, tc.hosted, hosted)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("all:\n  - authorized_useragents: ['(']")); err == nil {
+		t.Error("invalid block was validated")
+	}
+	if _, err := NewRequestConditions([]byte("not:\n  rate_limit:\n    requests: 1")); err == nil {
+		t.Error("rate limited block was validated")
+	}
+}
+
+func TestRequestConditions_ShouldHost_notserving(t *testing.T) {
 	// Create HTTP Request
 	mockRequest, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -932,13 +1616,13 @@ func TestRequestConditions_ShouldHost_serve_one_succeed(t *testing.T) {
 
 	// Create RequestConditions object
 	data := `
-serve: 1`
+not_serving: true`
 
 	conditions, err := NewRequestConditions([]byte(data))
 	if err != nil {
 		t.Error(err)
 	}
-	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
 		t.Fail()
 	}
 
@@ -947,7 +1631,7 @@ serve: 1`
 	}
 }
 
-func TestRequestConditions_ShouldHost_serve_one_fail(t *testing.T) {
+func TestRequestConditions_ShouldHost_serve_one_succeed(t *testing.T) {
 	// Create HTTP Request
 	mockRequest, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -959,10 +1643,6 @@ func TestRequestConditions_ShouldHost_serve_one_fail(t *testing.T) {
 		t.Error(err)
 	}
 
-	if err := state.Hit(mockRequest); err != nil {
-		t.Error(err)
-	}
-
 	// Create RequestConditions object
 	data := `
 serve: 1`
@@ -971,7 +1651,7 @@ serve: 1`
 	if err != nil {
 		t.Error(err)
 	}
-	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
 		t.Fail()
 	}
 
@@ -980,7 +1660,7 @@ serve: 1`
 	}
 }
 
-func TestRequestConditions_ShouldHost_prereq_none(t *testing.T) {
+func TestRequestConditions_ShouldHost_serve_one_fail(t *testing.T) {
 	// Create HTTP Request
 	mockRequest, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -998,13 +1678,13 @@ func TestRequestConditions_ShouldHost_prereq_none(t *testing.T) {
 
 	// Create RequestConditions object
 	data := `
-prereq:`
+serve: 1`
 
 	conditions, err := NewRequestConditions([]byte(data))
 	if err != nil {
 		t.Error(err)
 	}
-	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
 		t.Fail()
 	}
 
@@ -1013,36 +1693,44 @@ prereq:`
 	}
 }
 
-func TestRequestConditions_ShouldHost_prereq_one_succeed(t *testing.T) {
+func TestRequestConditions_ShouldHost_serve_per_ip(t *testing.T) {
 	state, file, err := TemporaryDB()
 	if err != nil {
 		t.Error(err)
 	}
 
-	firstHit, err := http.NewRequest("GET", "/", nil)
+	data := `
+serve_per_ip: 1`
+
+	conditions, err := NewRequestConditions([]byte(data))
 	if err != nil {
 		t.Error(err)
 	}
 
-	payloadHit, err := http.NewRequest("GET", "/payload", nil)
+	first, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
 		t.Error(err)
 	}
-
-	if err := state.Hit(firstHit); err != nil {
-		t.Error(err)
+	first.RemoteAddr = "10.0.0.1:1234"
+	if !conditions.ShouldHost(first, state, geoip.DB{}) {
+		t.Fail()
+	}
+	for key := range conditions.ClientKeys(first) {
+		if err := state.HitClient("/", key); err != nil {
+			t.Error(err)
+		}
+	}
+	if conditions.ShouldHost(first, state, geoip.DB{}) {
+		t.Fail()
 	}
 
-	// Create RequestConditions object
-	data := `
-prereq:
-  - /`
-
-	conditions, err := NewRequestConditions([]byte(data))
+	// Other targets can still fetch the path
+	second, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
 		t.Error(err)
 	}
-	if !conditions.ShouldHost(payloadHit, state, geoip.DB{}) {
+	second.RemoteAddr = "10.0.0.2:1234"
+	if !conditions.ShouldHost(second, state, geoip.DB{}) {
 		t.Fail()
 	}
 
@@ -1051,18 +1739,243 @@ prereq:
 	}
 }
 
-func TestRequestConditions_ShouldHost_prereq_one_fail(t *testing.T) {
+func TestRequestConditions_ShouldHost_serve_per_session(t *testing.T) {
 	state, file, err := TemporaryDB()
 	if err != nil {
 		t.Error(err)
 	}
 
-	firstHit, err := http.NewRequest("GET", "/one", nil)
+	data := `
+serve_per_session: 2
+session_cookie: sid`
+
+	conditions, err := NewRequestConditions([]byte(data))
 	if err != nil {
 		t.Error(err)
 	}
 
-	payloadHit, err := http.NewRequest("GET", "/two", nil)
+	noCookie, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if conditions.ShouldHost(noCookie, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.AddCookie(&http.Cookie{Name: "sid", Value: "abc"})
+	for i := 0; i < 2; i++ {
+		if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+			t.Fail()
+		}
+		if err := state.HitClient("/", "session:abc"); err != nil {
+			t.Error(err)
+		}
+	}
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestConditions_ShouldHost_rate_limit(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	data := `
+rate_limit:
+  requests: 1
+  per: 1h
+  burst: 2`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(remoteAddr string) bool {
+		mockRequest, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		mockRequest.RemoteAddr = remoteAddr
+		return conditions.ShouldHost(mockRequest, state, geoip.DB{})
+	}
+
+	if !request("10.0.0.1:1234") || !request("10.0.0.1:1234") {
+		t.Error("burst was limited")
+	}
+	if request("10.0.0.1:1234") {
+		t.Error("rate limit was not applied")
+	}
+	if !request("10.0.0.2:1234") {
+		t.Error("rate limit was applied to another client")
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewRequestConditions_rate_limit_invalid(t *testing.T) {
+	invalid := []string{`
+rate_limit:
+  requests: 1
+  per: minute`, `
+rate_limit:
+  requests: 1
+  action: block`, `
+rate_limit:
+  requests: 1
+  action: redirect`}
+
+	for _, data := range invalid {
+		if _, err := NewRequestConditions([]byte(data)); err == nil {
+			t.Errorf("%s was valid", data)
+		}
+	}
+}
+
+func TestNewRequestConditions_asn_invalid(t *testing.T) {
+	data := `
+blacklist_asn:
+  - "Microsoft (Corporation"`
+
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_asn_nodb(t *testing.T) {
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	data := `
+blacklist_asn:
+  - AS8075
+  - ^DIGITALOCEAN`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+	// ASN conditions are skipped without an ASN DB, like geoip
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewRequestConditions_serve_per_session_no_cookie(t *testing.T) {
+	data := `
+serve_per_session: 1`
+
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_prereq_none(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := state.Hit(mockRequest); err != nil {
+		t.Error(err)
+	}
+
+	// Create RequestConditions object
+	data := `
+prereq:`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestConditions_ShouldHost_prereq_one_succeed(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	firstHit, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	payloadHit, err := http.NewRequest("GET", "/payload", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := state.Hit(firstHit); err != nil {
+		t.Error(err)
+	}
+
+	// Create RequestConditions object
+	data := `
+prereq:
+  - /`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+	if !conditions.ShouldHost(payloadHit, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestConditions_ShouldHost_prereq_one_fail(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	firstHit, err := http.NewRequest("GET", "/one", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	payloadHit, err := http.NewRequest("GET", "/two", nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -1137,6 +2050,99 @@ geoip:
 	}
 }
 
+func TestRequestConditions_ShouldHost_geoip_city_countrydb(t *testing.T) {
+	mockRequest := &http.Request{RemoteAddr: "72.229.28.185:54321"}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	gip, err := createGeoIP()
+	if err != nil {
+		t.Error(err)
+	}
+
+	data := `
+geoip:
+  authorized_countries:
+    - US
+  authorized_cities:
+    - New York`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+	// Country DBs have no cities, so they are never matched
+	if conditions.ShouldHost(mockRequest, state, gip) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestConditions_ShouldHost_geoip_groups(t *testing.T) {
+	mockRequest := &http.Request{RemoteAddr: "72.229.28.185:54321"}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	gip, err := createGeoIP()
+	if err != nil {
+		t.Error(err)
+	}
+	gip = gip.WithGroups(map[string][]string{"offices": {"US", "JP"}})
+
+	for data, expected := range map[string]bool{
+		"geoip:\n  authorized_countries: [continent:NA]":  true,
+		"geoip:\n  authorized_countries: [continent:EU]":  false,
+		"geoip:\n  authorized_countries: [group:FVEY]":    true,
+		"geoip:\n  authorized_countries: [group:EU]":      false,
+		"geoip:\n  authorized_countries: [group:offices]": true,
+		"geoip:\n  blacklist_countries: [group:FVEY]":     false,
+		"geoip:\n  authorized_countries: [group:unknown]": false,
+	} {
+		conditions, err := NewRequestConditions([]byte(data))
+		if err != nil {
+			t.Error(err)
+		}
+		if conditions.ShouldHost(mockRequest, state, gip) != expected {
+			t.Errorf("%q: expected hosted %v", data, expected)
+		}
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewRequestConditions_geoip_continent_invalid(t *testing.T) {
+	for _, data := range []string{
+		"geoip:\n  authorized_countries: [continent:XX]",
+		"geoip:\n  blacklist_countries: [\"group:\"]",
+	} {
+		if _, err := NewRequestConditions([]byte(data)); err == nil {
+			t.Errorf("%q was accepted", data)
+		}
+	}
+}
+
+func TestNewRequestConditions_geoip_timezone_invalid(t *testing.T) {
+	data := `
+geoip:
+  authorized_timezones:
+    - America/Gotham`
+
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
 func TestRequestConditions_ShouldHost_geoip_failure(t *testing.T) {
 	// Create HTTP Request
 	mockRequest := &http.Request{RemoteAddr: "72.229.28.185:54321"}
@@ -1229,3 +2235,579 @@ func TestRequestConditions_ShouldHost_geoip_blacklist_accept(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRequestConditions_ShouldHost_approval(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:1234"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create RequestConditions object
+	data := `
+approval:
+  ttl: 1h`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Queued for approval
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+	pending := state.Approvals().List()
+	if len(pending) != 1 || pending[0].Status != ApprovalPending {
+		t.Fatal("request was not queued")
+	}
+
+	// Still waiting on approval
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if _, err := state.Approvals().Decide(pending[0].ID, true); err != nil {
+		t.Error(err)
+	}
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewRequestConditions_approval_fail(t *testing.T) {
+	data := `
+approval:
+  ttl: abc`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_max_identical_requests(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:1234"
+	mockRequest.Header.Set("User-Agent", "sandbox")
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create RequestConditions object
+	data := `
+max_identical_requests:
+  count: 2
+  window: 1h`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+			t.Error("request", i, "should have been hosted")
+		}
+	}
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("third identical request should not have been hosted")
+	}
+
+	// A different client is unaffected
+	otherRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	otherRequest.RemoteAddr = "127.0.0.2:1234"
+	if !conditions.ShouldHost(otherRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	// Pinned clients stay pinned without the window
+	conditions.MaxIdenticalRequests.Count = 100
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("pinned client should not have been hosted")
+	}
+
+	if err := RemoveDB(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestConditions_ShouldHost_deny_forwarded(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:1234"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+deny_forwarded:
+  enabled: true
+  trusted_proxies:
+    - 10.0.0.0/8`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("request without forwarded headers should have been hosted")
+	}
+
+	mockRequest.Header.Set("X-Forwarded-For", "8.8.8.8")
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("request with X-Forwarded-For should not have been hosted")
+	}
+
+	mockRequest.Header.Del("X-Forwarded-For")
+	mockRequest.Header.Set("Forwarded", "for=8.8.8.8")
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("request with Forwarded should not have been hosted")
+	}
+
+	// Trusted proxies may forward requests
+	mockRequest.RemoteAddr = "10.1.2.3:1234"
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("request from trusted proxy should have been hosted")
+	}
+}
+
+func TestNewRequestConditions_deny_forwarded_fail(t *testing.T) {
+	data := `
+deny_forwarded:
+  enabled: true
+  trusted_proxies:
+    - proxy.local`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_max_age(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+max_age: 24h`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	state.SetRulesModified(time.Now().Add(-time.Hour))
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("fresh rules should have been hosted")
+	}
+
+	state.SetRulesModified(time.Now().Add(-48 * time.Hour))
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("stale rules should not have been hosted")
+	}
+}
+
+func TestNewRequestConditions_max_age_fail(t *testing.T) {
+	data := `
+max_age: 30 days`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+// waitJARM waits for the client at host:port to be scanned
+func waitJARM(t *testing.T, state *State, host, port string) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := state.JARM(host, port); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("client was not scanned")
+}
+
+func TestRequestConditions_ShouldHost_jarm(t *testing.T) {
+	server := httptest.NewTLSServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Error(err)
+	}
+	fingerprint := jarm.Fingerprint(host, port, time.Second)
+
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = host + ":34567"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := fmt.Sprintf(`
+authorized_jarm:
+  - %s
+jarm_port: %s`, fingerprint, port)
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Clients are denied while they are scanned
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("client was hosted before it was scanned")
+	}
+	waitJARM(t, state, host, port)
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_jarm_pending(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:34567"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	data := fmt.Sprintf(`
+authorized_jarm:
+  - %s
+jarm_pending: open`, strings.Repeat("1", 62))
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Error("pending client was not hosted")
+	}
+}
+
+func TestRequestConditions_ShouldHost_jarm_blacklist(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:34567"
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Clients without a TLS server have the empty fingerprint
+	data := fmt.Sprintf(`
+blacklist_jarm:
+  - %s
+jarm_port: %s
+jarm_pending: open`, jarm.Empty, port)
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	waitJARM(t, state, "127.0.0.1", port)
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+}
+
+func TestState_JARM_scope(t *testing.T) {
+	server := httptest.NewTLSServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Error(err)
+	}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	_, scope, _ := net.ParseCIDR("10.0.0.0/8")
+	state.SetScanScope([]*net.IPNet{scope})
+	for i := 0; i < 10; i++ {
+		if _, ok := state.JARM(host, port); ok {
+			t.Fatal("client outside of the scan scope was scanned")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNewRequestConditions_jarm_pending_fail(t *testing.T) {
+	data := `
+jarm_pending: maybe`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestNewRequestConditions_jarm_fail(t *testing.T) {
+	data := `
+authorized_jarm:
+  - abc`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_ja3_raw(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.JA3Fingerprint = "771,4865-4866-4867,0-23-65281,29-23-24,0"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+authorized_ja3_raw:
+  - ^771,4865-`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_ja3_raw_fail(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.JA3Fingerprint = "769,47-53-5-10,0-10-11,23-24-25,0"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+authorized_ja3_raw:
+  - ^771,4865-`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+}
+
+func TestNewRequestConditions_ja3_raw_fail(t *testing.T) {
+	data := `
+authorized_ja3_raw:
+  - "771,(4865"`
+	if _, err := NewRequestConditions([]byte(data)); err == nil {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_http2_fingerprint(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.HTTP2Fingerprint = "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101|m,p,a,s"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	// Create RequestConditions object
+	data := `
+authorized_http2_fingerprint:
+  - "1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101|m,p,a,s"`
+
+	conditions, err := NewRequestConditions([]byte(data))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+
+	// HTTP/1 requests have no fingerprint
+	mockRequest.HTTP2Fingerprint = ""
+	if conditions.ShouldHost(mockRequest, state, geoip.DB{}) {
+		t.Fail()
+	}
+}
+
+func TestRequestConditions_ShouldHost_serve_window(t *testing.T) {
+	// Create HTTP Request
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	now := time.Now().UTC()
+	today := now.Weekday().String()
+	tomorrow := now.Add(24 * time.Hour).Weekday().String()
+	window := func(from, to time.Duration) string {
+		return now.Add(from).Format("15:04") + "-" + now.Add(to).Format("15:04")
+	}
+
+	tests := []struct {
+		data  string
+		serve bool
+	}{
+		{fmt.Sprintf("serve_after: %s", now.Add(-time.Hour).Format(time.RFC3339)), true},
+		{fmt.Sprintf("serve_after: %s", now.Add(time.Hour).Format(time.RFC3339)), false},
+		{fmt.Sprintf("serve_before: %s", now.Add(time.Hour).Format(time.RFC3339)), true},
+		{fmt.Sprintf("serve_before: %s", now.Add(-time.Hour).Format(time.RFC3339)), false},
+		{fmt.Sprintf("serve_days: [%s]", today[:3]), true},
+		{fmt.Sprintf("serve_days: [%s]", tomorrow), false},
+		{fmt.Sprintf("serve_hours: %s", window(-time.Hour, time.Hour)), true},
+		{fmt.Sprintf("serve_hours: %s", window(time.Hour, 2*time.Hour)), false},
+		// Windows crossing midnight
+		{fmt.Sprintf("serve_hours: %s", window(time.Hour, -time.Hour)), false},
+		{fmt.Sprintf("serve_hours: %s", window(-time.Hour, -2*time.Hour)), true},
+	}
+
+	for _, test := range tests {
+		conditions, err := NewRequestConditions([]byte(test.data + "\ntimezone: UTC"))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != test.serve {
+			t.Errorf("%s: expected served to be %v", test.data, test.serve)
+		}
+	}
+}
+
+func TestNewRequestConditions_serve_window_fail(t *testing.T) {
+	for _, data := range []string{
+		"serve_after: tomorrow",
+		"serve_hours: 9am-5pm",
+		"serve_hours: 09:00-09:00",
+		"serve_days: [Funday]",
+		"timezone: Mars/Olympus_Mons",
+	} {
+		if _, err := NewRequestConditions([]byte(data)); err == nil {
+			t.Errorf("%s was valid", data)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_rdns(t *testing.T) {
+	// 127.0.0.1 resolves to localhost through the hosts file
+	mockRequest, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	mockRequest.RemoteAddr = "127.0.0.1:34567"
+
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+	}
+	defer RemoveDB(file)
+
+	for data, expected := range map[string]bool{
+		"authorized_rdns: ['^localhost$']":                true,
+		"authorized_rdns: ['\\.amazonaws\\.com$']":        false,
+		"blacklist_rdns: ['^localhost$']":                 false,
+		"blacklist_rdns: ['\\.googleusercontent\\.com$']": true,
+	} {
+		conditions, err := NewRequestConditions([]byte(data))
+		if err != nil {
+			t.Error(err)
+		}
+		if conditions.ShouldHost(mockRequest, state, geoip.DB{}) != expected {
+			t.Errorf("%s: expected %t", data, expected)
+		}
+	}
+
+	if _, err := NewRequestConditions([]byte("blacklist_rdns: ['(']")); err == nil {
+		t.Error("invalid regex was accepted")
+	}
+}
@@ -0,0 +1,112 @@
+package path
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prologic/bitcask"
+	log "github.com/sirupsen/logrus"
+)
+
+// StateProbeInterval is how often an unavailable state DB is written to, to check if it recovered
+const StateProbeInterval = 10 * time.Second
+
+// Fallbacks usable in on_state_error
+const (
+	// FailOpen passes the conditional while the state DB is unavailable
+	FailOpen = "open"
+	// FailClosed fails the conditional while the state DB is unavailable
+	FailClosed = "closed"
+)
+
+// stateFallbacks are the conditionals which depend on the state DB, and how each behaves while
+// it is unavailable unless on_state_error says otherwise. Serve limits can not be enforced without
+// their counts, so they fail closed. Pinning only keeps clients on the decoy, so it fails open.
+// Prereqs are kept in memory and do not depend on the state DB
+var stateFallbacks = map[string]string{
+	"serve":                  FailClosed,
+	"serve_per_client":       FailClosed,
+	"max_identical_requests": FailOpen,
+	"sticky_deny":            FailOpen,
+}
+
+// validateStateFallbacks checks on_state_error only names conditionals depending on the state DB
+func validateStateFallbacks(fallbacks map[string]string) error {
+	for conditional, fallback := range fallbacks {
+		if _, ok := stateFallbacks[conditional]; !ok {
+			return errors.New(fmt.Sprintf("%s is not a valid on_state_error conditional", conditional))
+		}
+		if fallback != FailOpen && fallback != FailClosed {
+			return errors.New(fmt.Sprintf("%s is not a valid on_state_error fallback", fallback))
+		}
+	}
+	return nil
+}
+
+// stateFallback returns whether conditional passes while the state DB is unavailable
+func (c *RequestConditions) stateFallback(conditional string) bool {
+	fallback, ok := c.OnStateError[conditional]
+	if !ok {
+		fallback = stateFallbacks[conditional]
+	}
+	log.WithFields(log.Fields{
+		"conditional": conditional,
+		"fallback":    fallback,
+	}).Debug("State DB unavailable. Using fallback")
+	return fallback == FailOpen
+}
+
+// OnUnavailable sets the function called with the error when the state DB becomes
+// unavailable, and with nil when it recovers
+func (s *State) OnUnavailable(f func(error)) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.onUnavailable = f
+}
+
+// check records err as the state DB being unavailable. Keys which do not exist
+// are not failures. It returns err so it can wrap DB calls
+func (s *State) check(err error) error {
+	if err == nil || err == bitcask.ErrKeyNotFound {
+		return err
+	}
+
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.unavailable != nil {
+		return err
+	}
+	s.unavailable, s.probed = err, time.Now()
+	log.WithFields(log.Fields{
+		"error": err,
+	}).Error("State DB is unavailable. Conditionals depending on it are using their fallbacks")
+	if s.onUnavailable != nil {
+		go s.onUnavailable(err)
+	}
+	return err
+}
+
+// Available returns true unless the state DB failed and has not recovered. An
+// unavailable DB is written to at most every StateProbeInterval to check if it recovered
+func (s *State) Available() bool {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.unavailable == nil {
+		return true
+	}
+	if time.Since(s.probed) < StateProbeInterval {
+		return false
+	}
+
+	s.probed = time.Now()
+	if err := s.Writable(); err != nil {
+		return false
+	}
+	s.unavailable = nil
+	log.Info("State DB recovered")
+	if s.onUnavailable != nil {
+		go s.onUnavailable(nil)
+	}
+	return true
+}
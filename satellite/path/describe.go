@@ -0,0 +1,130 @@
+package path
+
+//go:generate go run gen_doc.go
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ConditionField describes a condition which can be set in .info files and pathList.yml,
+// or another field of a path
+type ConditionField struct {
+	// Name is the YAML key of the condition
+	Name string `json:"name"`
+	// Type is the JSON schema type of the condition
+	Type string `json:"type"`
+	// Items is the JSON schema type of the elements of array and object conditions
+	Items string `json:"items,omitempty"`
+	// Description is the doc comment of the condition
+	Description string `json:"description"`
+	// Fields are the conditions nested in object conditions
+	Fields []ConditionField `json:"fields,omitempty"`
+}
+
+// DescribeConditions describes every field of RequestConditions. Descriptions
+// are the doc comments of the fields, generated into conditions_doc.go
+func DescribeConditions() []ConditionField {
+	return describeStruct(reflect.TypeOf(RequestConditions{}), "", conditionDocs)
+}
+
+// DescribePaths describes every field of the paths in pathList.yml, including their conditions
+func DescribePaths() []ConditionField {
+	return describeStruct(reflect.TypeOf(Path{}), "", pathDocs)
+}
+
+func describeStruct(t reflect.Type, prefix string, docs map[string]string) []ConditionField {
+	fields := make([]ConditionField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		options := strings.Split(t.Field(i).Tag.Get("yaml"), ",")
+		if len(options) > 1 && options[1] == "inline" {
+			fields = append(fields, describeStruct(t.Field(i).Type, prefix, docs)...)
+			continue
+		}
+		name := options[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		field := ConditionField{Name: name, Description: docs[prefix+name]}
+		ft := t.Field(i).Type
+		switch ft.Kind() {
+		case reflect.Struct:
+			field.Type = "object"
+			field.Fields = describeStruct(ft, prefix+name+".", docs)
+		case reflect.Slice:
+			field.Type, field.Items = "array", schemaType(ft.Elem())
+		case reflect.Map:
+			field.Type, field.Items = "object", schemaType(ft.Elem())
+		case reflect.Ptr:
+			// Condition blocks nest RequestConditions, so their fields are not described again
+			field.Type = "object"
+		default:
+			field.Type = schemaType(ft)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// schemaType gets the JSON schema type of a scalar type
+func schemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Struct:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+// ConditionsSchema creates a JSON schema of RequestConditions, which editors
+// use to autocomplete .info files
+func ConditionsSchema() map[string]interface{} {
+	schema := fieldsSchema(DescribeConditions())
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "satellite request conditions"
+	return schema
+}
+
+// PathListSchema creates a JSON schema of pathList.yml
+func PathListSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title":   "satellite path list",
+		"type":    "array",
+		"items":   fieldsSchema(DescribePaths()),
+	}
+}
+
+func fieldsSchema(fields []ConditionField) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, f := range fields {
+		var property map[string]interface{}
+		if f.Fields != nil {
+			property = fieldsSchema(f.Fields)
+		} else {
+			property = map[string]interface{}{"type": f.Type}
+			switch {
+			case f.Type == "array":
+				property["items"] = map[string]interface{}{"type": f.Items}
+			case f.Type == "object" && f.Items != "":
+				property["additionalProperties"] = map[string]interface{}{"type": f.Items}
+			}
+		}
+		property["description"] = f.Description
+		properties[f.Name] = property
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,57 @@
+package path_test
+
+import (
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func checkDescribed(t *testing.T, fields []ConditionField, prefix string) {
+	for _, f := range fields {
+		if f.Description == "" {
+			t.Errorf("%s%s has no description. Run go generate", prefix, f.Name)
+		}
+		checkDescribed(t, f.Fields, prefix+f.Name+".")
+	}
+}
+
+func TestDescribeConditions(t *testing.T) {
+	fields := DescribeConditions()
+	checkDescribed(t, fields, "")
+
+	found := false
+	for _, f := range fields {
+		if f.Name == "rate_limit" {
+			found = f.Type == "object" && len(f.Fields) != 0
+		}
+	}
+	if !found {
+		t.Error("rate_limit was not described")
+	}
+}
+
+func TestConditionsSchema(t *testing.T) {
+	properties := ConditionsSchema()["properties"].(map[string]interface{})
+	ua, ok := properties["authorized_useragents"].(map[string]interface{})
+	if !ok || ua["type"] != "array" {
+		t.Error("authorized_useragents is not an array")
+	}
+	geo, ok := properties["geoip"].(map[string]interface{})
+	if !ok || geo["properties"].(map[string]interface{})["authorized_countries"] == nil {
+		t.Error("geoip fields are missing")
+	}
+}
+
+func TestPathListSchema(t *testing.T) {
+	checkDescribed(t, DescribePaths(), "")
+
+	properties := PathListSchema()["items"].(map[string]interface{})["properties"].(map[string]interface{})
+	for _, name := range []string{"hosted_file", "queue", "authorized_useragents"} {
+		if properties[name] == nil {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if properties["Conditions"] != nil {
+		t.Error("inline conditions were nested")
+	}
+}
@@ -0,0 +1,59 @@
+package path
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"regexp"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrDetonationKey is returned when a detonation report is not authorized by the path's detonation_key
+var ErrDetonationKey = errors.New("invalid detonation key")
+
+// ja3DigestRegex matches the MD5 digest of a JA3 fingerprint
+var ja3DigestRegex = regexp.MustCompile("^[0-9a-f]{32}$")
+
+// DetonationReport is sent by a sandbox monitor when a payload served from
+// Path was detonated, for example when it shows up on VirusTotal or any.run
+type DetonationReport struct {
+	Path string `json:"path"`
+	// IP is the address which fetched the payload for the sandbox
+	IP string `json:"ip,omitempty"`
+	// JA3 is the JA3 fingerprint or digest of the sandbox's client
+	JA3 string `json:"ja3,omitempty"`
+}
+
+// Detonation adds the IP and JA3 of report to the global blacklist. The report
+// is authorized by the detonation_key of its path
+func (paths *Paths) Detonation(report DetonationReport, key string) error {
+	matchedPath, exists := paths.Match(report.Path)
+	if !exists || matchedPath.DetonationKey == "" ||
+		subtle.ConstantTimeCompare([]byte(key), []byte(matchedPath.DetonationKey)) != 1 {
+		return ErrDetonationKey
+	}
+
+	var ip net.IP
+	if report.IP != "" {
+		if ip = net.ParseIP(report.IP); ip == nil {
+			return errors.New(fmt.Sprintf("%s is not a valid IP", report.IP))
+		}
+	}
+	ja3 := report.JA3
+	if ja3 != "" && !ja3DigestRegex.MatchString(ja3) {
+		ja3 = ja3Digest(ja3)
+	}
+	if ip == nil && ja3 == "" {
+		return errors.New("detonation report requires an ip or ja3")
+	}
+
+	log.WithFields(log.Fields{
+		"path": report.Path,
+		"ip":   report.IP,
+		"ja3":  ja3,
+	}).Warn("Payload detonation reported")
+
+	return paths.state.Blacklist(ip, ja3)
+}
@@ -0,0 +1,262 @@
+package path_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_Detonation(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload.exe
+  hosted_file: payload
+  detonation_key: secret
+- path: /other.exe
+  hosted_file: payload`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(uri, remoteAddr, ja3 string) bool {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.RemoteAddr = remoteAddr
+		req.JA3Fingerprint = ja3
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	report := DetonationReport{Path: "/payload.exe", IP: "10.0.0.1", JA3: "771,4865-4866,0-23,29-23,0"}
+	if err := paths.Detonation(report, "wrong"); err != ErrDetonationKey {
+		t.Error("detonation with the wrong key was accepted")
+	}
+	if err := paths.Detonation(DetonationReport{Path: "/other.exe", IP: "10.0.0.1"}, ""); err != ErrDetonationKey {
+		t.Error("detonation of a path without a key was accepted")
+	}
+	if err := paths.Detonation(DetonationReport{Path: "/payload.exe"}, "secret"); err == nil {
+		t.Error("detonation without an ip or ja3 was accepted")
+	}
+
+	if !request("/other.exe", "10.0.0.1:1234", "") {
+		t.Error("client was denied before the detonation")
+	}
+	if err := paths.Detonation(report, "secret"); err != nil {
+		t.Error(err)
+	}
+
+	// The blacklist applies to every path
+	if request("/other.exe", "10.0.0.1:1234", "") {
+		t.Error("reported IP was served")
+	}
+	if request("/other.exe", "10.0.0.2:1234", report.JA3) {
+		t.Error("reported JA3 was served")
+	}
+	if !request("/other.exe", "10.0.0.2:1234", "") {
+		t.Error("other client was denied")
+	}
+}
+
+func TestPaths_OnBlacklist(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload.exe
+  hosted_file: payload
+  detonation_key: secret`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := make([]net.IP, 0)
+	paths.OnBlacklist(func(ip net.IP) {
+		dropped = append(dropped, ip)
+	})
+
+	if err := paths.Detonation(DetonationReport{Path: "/payload.exe", JA3: "771,4865-4866,0-23,29-23,0"}, "secret"); err != nil {
+		t.Error(err)
+	}
+	if len(dropped) != 0 {
+		t.Error("JA3 report called OnBlacklist")
+	}
+	if err := paths.Detonation(DetonationReport{Path: "/payload.exe", IP: "10.0.0.1"}, "secret"); err != nil {
+		t.Error(err)
+	}
+	if len(dropped) != 1 || !dropped[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected blacklisted IPs %v", dropped)
+	}
+
+	ips, err := paths.BlacklistedIPs()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected blacklisted IPs %v", ips)
+	}
+
+	undropped := make([]net.IP, 0)
+	paths.OnUnblacklist(func(ip net.IP) {
+		undropped = append(undropped, ip)
+	})
+	if err := paths.Unblacklist(net.ParseIP("10.0.0.2")); err != ErrNotBlacklisted {
+		t.Errorf("expected ErrNotBlacklisted, got %v", err)
+	}
+	if err := paths.Unblacklist(net.ParseIP("10.0.0.1")); err != nil {
+		t.Error(err)
+	}
+	if len(undropped) != 1 || !undropped[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected unblacklisted IPs %v", undropped)
+	}
+	if ips, _ := paths.BlacklistedIPs(); len(ips) != 0 {
+		t.Errorf("unblacklisted IP is still blacklisted %v", ips)
+	}
+}
+
+func TestPaths_SetBlocklist(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload.exe
+  hosted_file: payload
+  authorized_iprange:
+    - 10.0.0.0/8`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(remoteAddr string) bool {
+		req := httptest.NewRequest("GET", "/payload.exe", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	_, feed, _ := net.ParseCIDR("10.1.0.0/16")
+	paths.SetBlocklist("feed", []*net.IPNet{feed})
+
+	// Feeds are denied before the path's authorized_iprange
+	if request("10.1.2.3:1234") {
+		t.Error("IP in the blocklist feed was served")
+	}
+	if !request("10.2.0.1:1234") {
+		t.Error("IP outside of the blocklist feed was denied")
+	}
+
+	paths.SetBlocklist("feed", nil)
+	if !request("10.1.2.3:1234") {
+		t.Error("IP removed from the blocklist feed was denied")
+	}
+}
+
+func TestPaths_SetHostingProvider(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload.exe
+  hosted_file: payload
+  blacklist_hosting_providers:
+    - aws`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(remoteAddr string) bool {
+		req := httptest.NewRequest("GET", "/payload.exe", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	_, aws, _ := net.ParseCIDR("3.5.140.0/22")
+	_, gcp, _ := net.ParseCIDR("34.80.0.0/15")
+	paths.SetHostingProvider("aws", []*net.IPNet{aws})
+	paths.SetHostingProvider("gcp", []*net.IPNet{gcp})
+
+	if request("3.5.141.1:1234") {
+		t.Error("blacklisted hosting provider was served")
+	}
+	if !request("34.80.0.1:1234") {
+		t.Error("hosting provider which is not blacklisted was denied")
+	}
+}
+
+func TestNewRequestConditions_hostingProviders(t *testing.T) {
+	if _, err := NewRequestConditions([]byte("blacklist_hosting_providers: [aws, linode]")); err == nil {
+		t.Error("unknown hosting provider was valid")
+	}
+}
+
+func TestPaths_SetTorExits(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload.exe
+  hosted_file: payload
+  blacklist_tor: true
+- path: /other.exe
+  hosted_file: payload`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(uri, remoteAddr string) bool {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	if err := paths.SetTorExits([]net.IP{net.ParseIP("185.220.101.1")}); err != nil {
+		t.Error(err)
+	}
+
+	if request("/payload.exe", "185.220.101.1:1234") {
+		t.Error("Tor exit node was served")
+	}
+	if !request("/payload.exe", "185.220.101.2:1234") {
+		t.Error("client which is not a Tor exit node was denied")
+	}
+	if !request("/other.exe", "185.220.101.1:1234") {
+		t.Error("Tor exit node was denied on a path without blacklist_tor")
+	}
+}
@@ -0,0 +1,102 @@
+package path
+
+import (
+	"net"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/passive"
+)
+
+// Enrichment is everything known about a client when a payload was served to
+// it, kept with the hit so it does not need to be resolved again later
+type Enrichment struct {
+	Country  string   `json:"country,omitempty"`
+	City     string   `json:"city,omitempty"`
+	Regions  []string `json:"regions,omitempty"`
+	TimeZone string   `json:"time_zone,omitempty"`
+	ASN      uint     `json:"asn,omitempty"`
+	ASOrg    string   `json:"as_org,omitempty"`
+	// RDNS are the PTR names of the client and RDNSConfirmed are the ones which resolve back to it
+	RDNS          []string `json:"rdns,omitempty"`
+	RDNSConfirmed []string `json:"rdns_confirmed,omitempty"`
+	// Blacklisted is set when the IP or JA3 is on the global blacklist, including blocklist feeds
+	Blacklisted bool `json:"blacklisted"`
+	// Blocklisted is set when the IP is in a blocklist feed
+	Blocklisted     bool   `json:"blocklisted"`
+	HostingProvider string `json:"hosting_provider,omitempty"`
+	TorExit         bool   `json:"tor_exit"`
+	JA3             string `json:"ja3,omitempty"`
+	JA3Full         string `json:"ja3_full,omitempty"`
+	JA3S            string `json:"ja3s,omitempty"`
+	JA4             string `json:"ja4,omitempty"`
+	HTTP2           string `json:"http2,omitempty"`
+	// Proto is the HTTP version of the request and ALPN the protocol negotiated in the TLS handshake
+	Proto string `json:"proto"`
+	ALPN  string `json:"alpn,omitempty"`
+	// HeaderOrder is the order the client sent its headers in
+	HeaderOrder []string `json:"header_order,omitempty"`
+	// TCP is the passive fingerprint of the SYN the client connected with, and OS the OS it suggests
+	TCP *passive.Fingerprint `json:"tcp,omitempty"`
+	OS  string               `json:"os,omitempty"`
+}
+
+// Enrich snapshots everything known about the client of req. Reverse DNS
+// names come from the cache shared with the rdns conditions
+func (s *State) Enrich(req *http.Request, gip geoip.DB) Enrichment {
+	ip := parseRemoteAddr(req.RemoteAddr)
+	e := Enrichment{
+		JA3Full:     req.JA3Fingerprint,
+		JA3S:        req.JA3SFingerprint,
+		HTTP2:       req.HTTP2Fingerprint,
+		HeaderOrder: req.HeaderOrder,
+		Proto:       req.Proto,
+	}
+	if req.TLS != nil {
+		e.ALPN = req.TLS.NegotiatedProtocol
+	}
+	if req.JA3Fingerprint != "" {
+		e.JA3 = ja3Digest(req.JA3Fingerprint)
+	}
+	if len(req.ClientHello) > 0 {
+		e.JA4, _ = JA4(req.ClientHello)
+	}
+	if fingerprint, ok := passive.Lookup(req.RemoteAddr); ok {
+		e.TCP = &fingerprint
+		e.OS = fingerprint.OS()
+	}
+	if ip == nil {
+		return e
+	}
+
+	if gip.HasDB() {
+		e.Country, _ = gip.CountryCode(ip)
+		if location, err := gip.Location(ip); err == nil {
+			e.City, e.Regions, e.TimeZone = location.City, location.Regions, location.TimeZone
+		}
+	}
+	if gip.HasASN() {
+		e.ASN, e.ASOrg, _ = gip.ASN(ip)
+	}
+	e.RDNS, e.RDNSConfirmed = s.RDNS(ip)
+
+	e.Blacklisted = s.Blacklisted(ip, e.JA3)
+	e.Blocklisted = s.inFeed(ip)
+	e.HostingProvider = s.anyHostingProvider(ip)
+	e.TorExit = s.TorExit(ip)
+	return e
+}
+
+// anyHostingProvider gets which hosting provider ip belongs to, if any
+func (s *State) anyHostingProvider(ip net.IP) string {
+	s.feedsMu.RLock()
+	defer s.feedsMu.RUnlock()
+	for name, ranges := range s.providers {
+		for _, r := range ranges {
+			if r.Contains(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
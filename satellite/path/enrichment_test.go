@@ -0,0 +1,100 @@
+package path_test
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func helloExtension(typ uint16, data ...byte) []byte {
+	return append([]byte{byte(typ >> 8), byte(typ), byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func clientHello() []byte {
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0)
+	// GREASE, TLS_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	body = append(body, 0, 6, 0x0a, 0x0a, 0x13, 0x01, 0xc0, 0x2b)
+	body = append(body, 1, 0)
+
+	var exts []byte
+	exts = append(exts, helloExtension(0x1a1a)...)
+	exts = append(exts, helloExtension(0x0000, 0, 6, 0, 0, 3, 'a', '.', 'b')...)
+	exts = append(exts, helloExtension(0x0010, 0, 12, 2, 'h', '2', 8, 'h', 't', 't', 'p', '/', '1', '.', '1')...)
+	exts = append(exts, helloExtension(0x000d, 0, 4, 0x04, 0x03, 0x08, 0x04)...)
+	exts = append(exts, helloExtension(0x002b, 6, 0x2a, 0x2a, 0x03, 0x04, 0x03, 0x03)...)
+	body = append(body, byte(len(exts)>>8), byte(len(exts)))
+	body = append(body, exts...)
+
+	return append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func sha12(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func TestJA4(t *testing.T) {
+	fingerprint, err := JA4(clientHello())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "t13d0204h2_" + sha12("1301,c02b") + "_" + sha12("000d,002b_0403,0804")
+	if fingerprint != expected {
+		t.Errorf("expected %s, got %s", expected, fingerprint)
+	}
+
+	if _, err := JA4(clientHello()[:50]); err != ErrBadClientHello {
+		t.Error("truncated client hello was parsed")
+	}
+}
+
+func TestState_Enrich(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	raw := "GET /payload HTTP/1.1\r\nHost: example.com\r\nuser-agent: curl\r\nAccept: */*\r\nUser-Agent: again\r\n\r\n"
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.JA3Fingerprint = "771,4865,0,29,0"
+	req.ClientHello = clientHello()
+
+	state.Hits().AddServed(req, state.Enrich(req, geoip.DB{}))
+	hits := state.Hits().List()
+	if len(hits) != 1 || hits[0].Enrichment == nil {
+		t.Fatal("served hit was not enriched")
+	}
+
+	e := hits[0].Enrichment
+	if !reflect.DeepEqual(e.HeaderOrder, []string{"Host", "User-Agent", "Accept"}) {
+		t.Errorf("header order was not kept: %v", e.HeaderOrder)
+	}
+	if e.JA4 == "" || e.JA3 != hits[0].JA3 || e.JA3Full != req.JA3Fingerprint {
+		t.Error("TLS fingerprints were not snapshotted")
+	}
+	if e.Blacklisted || e.TorExit {
+		t.Error("unlisted client has verdicts")
+	}
+
+	if err := state.Blacklist(net.ParseIP("127.0.0.1"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if e := state.Enrich(req, geoip.DB{}); !e.Blacklisted {
+		t.Error("blacklisted client was not marked blacklisted")
+	}
+}
@@ -0,0 +1,135 @@
+package path
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+)
+
+// DefaultExecTimeout is how long exec scripts may run when exec.timeout is not set
+const DefaultExecTimeout = 10 * time.Second
+
+// ErrExecTimeout is returned when an exec script runs longer than its timeout
+var ErrExecTimeout = errors.New("exec script timed out")
+
+// ErrExecIsolation is returned when exec limits or users are not supported on this platform
+var ErrExecIsolation = errors.New("exec limits and users are not supported on this platform")
+
+// execLimits are the resources an exec script may use
+type execLimits struct {
+	// CPU is the CPU time in seconds
+	CPU uint64
+	// Memory is the address space in megabytes
+	Memory uint64
+	// User runs the script as another user
+	User string
+}
+
+// execEnv gets the environment exec scripts run with. Only PATH is kept from
+// the environment of satellite so scripts cannot read its secrets
+func execEnv(env []string) []string {
+	return append([]string{"PATH=" + os.Getenv("PATH")}, env...)
+}
+
+// requestEnv gets the variables describing req given to exec scripts, so they
+// do not need to parse the request dump. The country is looked up in gip when it has a DB
+func requestEnv(req *http.Request, gip geoip.DB) []string {
+	ip := parseRemoteAddr(req.RemoteAddr)
+	var ja3, country string
+	if req.JA3Fingerprint != "" {
+		ja3 = ja3Digest(req.JA3Fingerprint)
+	}
+	if ip != nil && gip.HasDB() {
+		country, _ = gip.CountryCode(ip)
+	}
+	env := []string{
+		"SATELLITE_IP=" + ip.String(),
+		"SATELLITE_METHOD=" + req.Method,
+		"SATELLITE_HOST=" + req.Host,
+		"SATELLITE_USER_AGENT=" + req.UserAgent(),
+		"SATELLITE_JA3=" + ja3,
+		"SATELLITE_JA3_FULL=" + req.JA3Fingerprint,
+		"SATELLITE_COUNTRY=" + country,
+	}
+	if req.URL != nil {
+		env = append(env, "SATELLITE_PATH="+req.URL.Path, "SATELLITE_QUERY="+req.URL.RawQuery)
+	}
+	return env
+}
+
+// execMatch checks the output and exit code of an exec script against exec.output,
+// exec.output_regex, and exec.exit_codes. Without output_regex or exit_codes, the
+// script must exit successfully and print exactly exec.output
+func (c *RequestConditions) execMatch(out []byte, code int) bool {
+	output := strings.TrimSuffix(string(out), "\n")
+	if c.Exec.OutputRegex == "" && len(c.Exec.ExitCodes) == 0 {
+		return code == 0 && output == c.Exec.Output
+	}
+
+	codeMatched := len(c.Exec.ExitCodes) == 0 && code == 0
+	for _, expected := range c.Exec.ExitCodes {
+		codeMatched = codeMatched || code == expected
+	}
+	if !codeMatched {
+		return false
+	}
+
+	if c.Exec.Output != "" && output != c.Exec.Output {
+		return false
+	}
+	if c.Exec.OutputRegex != "" {
+		re, err := regexp.Compile(c.Exec.OutputRegex)
+		return err == nil && re.MatchString(output)
+	}
+	return true
+}
+
+// runExec runs the exec script of c with stdin and the variables describing req, and gets
+// its combined output and exit code. Scripts are killed, along with any processes they
+// started, after the timeout
+func (c *RequestConditions) runExec(stdin []byte, env []string) ([]byte, int, error) {
+	timeout := DefaultExecTimeout
+	if c.Exec.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Exec.Timeout)
+	}
+	limits := execLimits{Memory: c.Exec.MaxMemoryMB, User: c.Exec.User}
+	if c.Exec.MaxCPU != "" {
+		cpu, _ := time.ParseDuration(c.Exec.MaxCPU)
+		limits.CPU = uint64((cpu + time.Second - 1) / time.Second)
+	}
+
+	cmd, err := execCommand(c.Exec.ScriptPath, c.Exec.Args, limits)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out bytes.Buffer
+	cmd.Env = execEnv(append(env, c.Exec.Env...))
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return nil, 0, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		// Exiting unsuccessfully is a result, not a failure to run the script
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return out.Bytes(), exitErr.ExitCode(), nil
+		}
+		return out.Bytes(), 0, err
+	case <-time.After(timeout):
+		killExec(cmd)
+		<-done
+		return nil, 0, ErrExecTimeout
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+// +build !windows
+
+package path
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// execCommand creates the command running script with args within limits. Resource
+// limits are set by a shell which then replaces itself with the script
+func execCommand(script string, args []string, limits execLimits) (*exec.Cmd, error) {
+	cmd := exec.Command(script, args...)
+	if limits.CPU != 0 || limits.Memory != 0 {
+		ulimit := "ulimit"
+		if limits.CPU != 0 {
+			ulimit += fmt.Sprintf(" -t %d", limits.CPU)
+		}
+		if limits.Memory != 0 {
+			ulimit += fmt.Sprintf(" -v %d", limits.Memory*1024)
+		}
+		cmd = exec.Command("/bin/sh", append([]string{"-c", ulimit + ` && exec "$0" "$@"`, script}, args...)...)
+	}
+
+	// Scripts get their own process group so everything they start can be killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if limits.User != "" {
+		credential, err := lookupCredential(limits.User)
+		if err != nil {
+			return nil, err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+	return cmd, nil
+}
+
+// lookupCredential gets the user and primary group IDs of username
+func lookupCredential(username string) (*syscall.Credential, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}, nil
+}
+
+// killExec kills the process group of a script
+func killExec(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,21 @@
+package path
+
+import "os/exec"
+
+// execCommand creates the command running script with args. Limits and users are only supported on Unix
+func execCommand(script string, args []string, limits execLimits) (*exec.Cmd, error) {
+	if limits != (execLimits{}) {
+		return nil, ErrExecIsolation
+	}
+	return exec.Command(script, args...), nil
+}
+
+// killExec kills a script
+func killExec(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// lookupCredential is only supported on Unix
+func lookupCredential(username string) (interface{}, error) {
+	return nil, ErrExecIsolation
+}
@@ -0,0 +1,44 @@
+package path
+
+import "time"
+
+// FailDB records err as a state DB failure, as the DB does on a full disk
+func (s *State) FailDB(err error) {
+	s.check(err)
+}
+
+// ProbeDB makes the next Available write to the state DB to check if it recovered
+func (s *State) ProbeDB() {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.probed = time.Now().Add(-StateProbeInterval)
+}
+
+// Repeats gets the number of keys identical requests are kept for
+func (s *State) Repeats() int {
+	s.repeatsMu.Lock()
+	defer s.repeatsMu.Unlock()
+	return len(s.repeats)
+}
+
+// Limits gets the number of rate limit buckets kept
+func (s *State) Limits() int {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	return len(s.limits)
+}
+
+// MaxAuthCache is the most cached answers of external authorizers kept
+const MaxAuthCache = maxAuthCache
+
+// CacheAuth caches the answer of an external authorizer for key
+func (s *State) CacheAuth(key string, allow bool, ttl time.Duration) {
+	s.cacheAuth(key, allow, ttl)
+}
+
+// AuthCache gets the number of cached answers of external authorizers
+func (s *State) AuthCache() int {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return len(s.auth)
+}
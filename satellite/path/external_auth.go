@@ -0,0 +1,204 @@
+package path
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+)
+
+// DefaultExternalAuthTimeout is how long the authorizer has to answer when external_auth.timeout is not set
+const DefaultExternalAuthTimeout = 2 * time.Second
+
+// MaxAuthHistory is the number of the client's most recent hits sent to the authorizer
+const MaxAuthHistory = 50
+
+// maxAuthCache is the most cached answers kept. Expired answers are removed
+// first, then the oldest
+const maxAuthCache = 10000
+
+// AuthRequest is the summary of a request POSTed to the external authorizer and given to WASM plugins
+type AuthRequest struct {
+	Time   time.Time   `json:"time"`
+	IP     string      `json:"ip"`
+	Method string      `json:"method"`
+	Host   string      `json:"host"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header"`
+	// Enrichment is what is known about the client, like its GeoIP location and fingerprints
+	Enrichment Enrichment `json:"enrichment"`
+	// History are the most recent decisions made for the client's IP, oldest first
+	History []Hit `json:"history"`
+}
+
+// AuthResponse is the answer of the external authorizer
+type AuthResponse struct {
+	Allow bool `json:"allow"`
+	// Reason is logged with the decision
+	Reason string `json:"reason,omitempty"`
+}
+
+// authResult is a cached answer of the external authorizer
+type authResult struct {
+	allow    bool
+	answered time.Time
+	expires  time.Time
+}
+
+// authCacheKey identifies the client and request an answer of the authorizer at url is reused for
+func authCacheKey(url string, req *http.Request) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		url,
+		parseRemoteAddr(req.RemoteAddr).String(),
+		req.Method,
+		req.Host,
+		req.URL.Path,
+		req.UserAgent(),
+		req.JA3Fingerprint,
+	}, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+// cachedAuth gets the cached answer for key
+func (s *State) cachedAuth(key string) (bool, bool) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	result, ok := s.auth[key]
+	if !ok || time.Now().After(result.expires) {
+		return false, false
+	}
+	return result.allow, true
+}
+
+// cacheAuth caches the answer for key for ttl
+func (s *State) cacheAuth(key string, allow bool, ttl time.Duration) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	now := time.Now()
+	if len(s.auth) >= maxAuthCache {
+		oldest := ""
+		for k, result := range s.auth {
+			if now.After(result.expires) {
+				delete(s.auth, k)
+			} else if oldest == "" || result.answered.Before(s.auth[oldest].answered) {
+				oldest = k
+			}
+		}
+		if len(s.auth) >= maxAuthCache {
+			delete(s.auth, oldest)
+		}
+	}
+	s.auth[key] = authResult{allow: allow, answered: now, expires: now.Add(ttl)}
+}
+
+// clientHistory gets the most recent decisions made for ip
+func (s *State) clientHistory(ip string) []Hit {
+	history := make([]Hit, 0)
+	for _, hit := range s.Hits().List() {
+		if hit.IP == ip {
+			history = append(history, hit)
+		}
+	}
+	if len(history) > MaxAuthHistory {
+		history = history[len(history)-MaxAuthHistory:]
+	}
+	return history
+}
+
+// summarize gets the summary of req sent to external authorizers and condition plugins
+func summarize(req *http.Request, state *State, gip geoip.DB) AuthRequest {
+	ip := parseRemoteAddr(req.RemoteAddr).String()
+	return AuthRequest{
+		Time:       time.Now(),
+		IP:         ip,
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       req.URL.Path,
+		Query:      req.URL.RawQuery,
+		Header:     req.Header,
+		Enrichment: state.Enrich(req, gip),
+		History:    state.clientHistory(ip),
+	}
+}
+
+// askAuthorizer POSTs the summary of req to the external authorizer of c
+func (c *RequestConditions) askAuthorizer(req *http.Request, state *State, gip geoip.DB) (AuthResponse, error) {
+	var answer AuthResponse
+	timeout := DefaultExternalAuthTimeout
+	if c.ExternalAuth.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.ExternalAuth.Timeout)
+	}
+
+	body, err := json.Marshal(summarize(req, state, gip))
+	if err != nil {
+		return answer, err
+	}
+
+	authReq, err := http.NewRequest(http.MethodPost, c.ExternalAuth.URL, bytes.NewReader(body))
+	if err != nil {
+		return answer, err
+	}
+	authReq.Header.Set("Content-Type", "application/json")
+	if c.ExternalAuth.Token != "" {
+		authReq.Header.Set("Authorization", "Bearer "+c.ExternalAuth.Token)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(authReq)
+	if err != nil {
+		return answer, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return answer, errors.New("authorizer returned " + resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&answer)
+	return answer, err
+}
+
+// externalAuth asks the external authorizer whether to serve req. Answers are reused
+// for the same client and request for external_auth.cache
+func (c *RequestConditions) externalAuth(req *http.Request, state *State, gip geoip.DB) bool {
+	if c.ExternalAuth.URL == "" || req.URL == nil {
+		return true
+	}
+
+	key := authCacheKey(c.ExternalAuth.URL, req)
+	if allow, ok := state.cachedAuth(key); ok {
+		log.WithFields(log.Fields{
+			"ip":    req.RemoteAddr,
+			"allow": allow,
+		}).Trace("Using cached external authorizer answer")
+		return allow
+	}
+
+	answer, err := c.askAuthorizer(req, state, gip)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"url":       c.ExternalAuth.URL,
+			"fail_open": c.ExternalAuth.FailOpen,
+		}).Warn("External authorizer failed")
+		return c.ExternalAuth.FailOpen
+	}
+
+	if c.ExternalAuth.Cache != "" {
+		ttl, _ := time.ParseDuration(c.ExternalAuth.Cache)
+		state.cacheAuth(key, answer.Allow, ttl)
+	}
+	if !answer.Allow {
+		log.WithFields(log.Fields{
+			"ip":     req.RemoteAddr,
+			"reason": answer.Reason,
+		}).Debug("External authorizer denied request")
+	}
+	return answer.Allow
+}
@@ -0,0 +1,92 @@
+package path_test
+
+import (
+	"encoding/json"
+	"fmt"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestRequestConditions_ShouldHost_external_auth(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	var asked int32
+	authorizer := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {
+		atomic.AddInt32(&asked, 1)
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(stdhttp.StatusUnauthorized)
+			return
+		}
+		var summary AuthRequest
+		if err := json.NewDecoder(req.Body).Decode(&summary); err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(AuthResponse{Allow: summary.Header.Get("User-Agent") == "implant"})
+	}))
+	defer authorizer.Close()
+
+	conditions, err := NewRequestConditions([]byte(fmt.Sprintf("external_auth:\n  url: %s\n  token: secret\n  cache: 1m", authorizer.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		ua     string
+		hosted bool
+		asked  int32
+	}{
+		{"implant", true, 1},
+		{"implant", true, 1},
+		{"scanner", false, 2},
+	} {
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", tc.ua)
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("%s: expected hosted %t, got %t", tc.ua, tc.hosted, hosted)
+		}
+		if n := atomic.LoadInt32(&asked); n != tc.asked {
+			t.Errorf("%s: expected the authorizer to be asked %d time(s), got %d", tc.ua, tc.asked, n)
+		}
+	}
+
+	// Authorizers which can not be reached deny unless fail_open is set
+	authorizer.Close()
+	for _, failOpen := range []bool{false, true} {
+		conditions, err := NewRequestConditions([]byte(fmt.Sprintf("external_auth:\n  url: %s\n  fail_open: %t", authorizer.URL, failOpen)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != failOpen {
+			t.Errorf("fail_open %t: expected hosted %t, got %t", failOpen, failOpen, hosted)
+		}
+	}
+}
+
+func TestState_CacheAuth_full(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	for i := 0; i < MaxAuthCache+10; i++ {
+		state.CacheAuth(fmt.Sprint(i), true, time.Hour)
+	}
+	if n := state.AuthCache(); n != MaxAuthCache {
+		t.Errorf("expected %d cached answers, got %d", MaxAuthCache, n)
+	}
+}
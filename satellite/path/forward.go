@@ -0,0 +1,184 @@
+package path
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httputil"
+)
+
+// ForwardQueue is the number of denied requests waiting to be forwarded before more are dropped
+const ForwardQueue = 256
+
+// MaxForwardBody is the number of bytes of a request body forwarded
+const MaxForwardBody = 1 << 20
+
+// ForwardTimeout is how long the analysis service has to accept a forwarded request
+const ForwardTimeout = 10 * time.Second
+
+// ForwardConfig sends full copies of requests denied on paths setting
+// forward_denied to an analysis service over mutual TLS
+type ForwardConfig struct {
+	// URL receives every forwarded request as a JSON POST. It must be https
+	URL string `mapstructure:"url"`
+	// Cert and Key are the client certificate satellite authenticates to the analysis service with
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+	// CA verifies the certificate of the analysis service. Defaults to the system roots
+	CA string `mapstructure:"ca"`
+}
+
+// Enabled returns true when denied requests are forwarded
+func (f ForwardConfig) Enabled() bool {
+	return f.URL != ""
+}
+
+// Validate checks the analysis service is reached over mutual TLS
+func (f ForwardConfig) Validate() error {
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New(fmt.Sprintf("%s is not a valid forward url", f.URL))
+	}
+	if f.Cert == "" || f.Key == "" {
+		return errors.New("forward requires a client cert and key")
+	}
+	return nil
+}
+
+// Forwarded is a denied request sent to the analysis service
+type Forwarded struct {
+	Time time.Time `json:"time"`
+	// Path is the path which was requested
+	Path     string `json:"path"`
+	Decision string `json:"decision"`
+	// Enrichment is everything known about the client, including its fingerprints
+	Enrichment Enrichment `json:"enrichment"`
+	// Request is the request as it was received, with up to MaxForwardBody bytes of its body
+	Request []byte `json:"request"`
+}
+
+// Forwarder sends denied requests to the analysis service in the background, so
+// a slow service never holds up the response
+type Forwarder struct {
+	url    string
+	client *http.Client
+	queue  chan Forwarded
+}
+
+// NewForwarder creates a forwarder with the client certificate of config and
+// starts sending forwarded requests
+func NewForwarder(config ForwardConfig) (*Forwarder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load forward client certificate")
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if config.CA != "" {
+		pem, err := ioutil.ReadFile(config.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(config.CA + " has no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	f := &Forwarder{
+		url: config.URL,
+		client: &http.Client{
+			Timeout:   ForwardTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		queue: make(chan Forwarded, ForwardQueue),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Forward queues a copy of req. It is dropped when the queue is full
+func (f *Forwarder) Forward(req *http.Request, decision string, enrichment Enrichment) {
+	body := peekBody(req, MaxForwardBody)
+	raw, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Unable to copy request to forward")
+		return
+	}
+
+	forwarded := Forwarded{
+		Time:       time.Now(),
+		Path:       req.URL.Path,
+		Decision:   decision,
+		Enrichment: enrichment,
+		Request:    append(raw, body...),
+	}
+	select {
+	case f.queue <- forwarded:
+	default:
+		log.WithFields(log.Fields{
+			"path": req.URL.Path,
+			"ip":   req.RemoteAddr,
+		}).Warn("Forward queue full. Dropping denied request")
+	}
+}
+
+func (f *Forwarder) run() {
+	for forwarded := range f.queue {
+		if err := f.send(forwarded); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  forwarded.Path,
+			}).Error("Unable to forward denied request")
+		}
+	}
+}
+
+// send posts forwarded to the analysis service
+func (f *Forwarder) send(forwarded Forwarded) error {
+	body, err := json.Marshal(forwarded)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Post(f.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("analysis service returned " + resp.Status)
+	}
+	return nil
+}
+
+// forward forwards req to the analysis service when matchedPath sets forward_denied
+func (paths *Paths) forward(matchedPath *Path, req *http.Request, decision string) {
+	paths.forwarderMu.RLock()
+	forwarder := paths.forwarder
+	paths.forwarderMu.RUnlock()
+	if forwarder == nil || !matchedPath.ForwardDenied {
+		return
+	}
+	forwarder.Forward(req, decision, paths.state.Enrich(req, paths.GeoIP()))
+}
+
+// SetForwarder sets where requests denied on paths setting forward_denied are forwarded
+func (paths *Paths) SetForwarder(forwarder *Forwarder) {
+	paths.forwarderMu.Lock()
+	defer paths.forwarderMu.Unlock()
+	paths.forwarder = forwarder
+}
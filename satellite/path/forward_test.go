@@ -0,0 +1,116 @@
+package path_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "satellite"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestPaths_MatchAndServe_forward_denied(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("canary", Sentinal)
+	tmpdir.CreatePathList(`- path: /canary
+  hosted_file: canary
+  forward_denied: true
+  authorized_useragents: [^implant$]`)
+
+	forwarded := make(chan Forwarded, 1)
+	analysis := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var f Forwarded
+		if err := json.NewDecoder(req.Body).Decode(&f); err != nil {
+			t.Error(err)
+		}
+		forwarded <- f
+	}))
+	analysis.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	analysis.StartTLS()
+	defer analysis.Close()
+
+	ca := filepath.Join(tmpdir.Path, "ca.crt")
+	ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: analysis.Certificate().Raw}), 0600)
+	cert, key := writeClientCert(t, tmpdir.Path)
+	forwarder, err := NewForwarder(ForwardConfig{URL: analysis.URL, Cert: cert, Key: key, CA: ca})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths.SetForwarder(forwarder)
+
+	req := httptest.NewRequest("POST", "/canary", strings.NewReader("beacon"))
+	req.Header.Set("User-Agent", "scanner")
+	if didMatch, _ := paths.MatchAndServe(httptest.NewRecorder(), req); didMatch {
+		t.Fatal("canary was served to a scanner")
+	}
+
+	select {
+	case f := <-forwarded:
+		if f.Path != "/canary" || f.Decision != "denied" {
+			t.Errorf("unexpected forwarded request %+v", f)
+		}
+		if !strings.Contains(string(f.Request), "User-Agent: scanner") || !strings.HasSuffix(string(f.Request), "beacon") {
+			t.Errorf("forwarded request is not a full copy: %q", f.Request)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("denied request was not forwarded")
+	}
+
+	if err := (ForwardConfig{URL: "http://analysis.internal", Cert: cert, Key: key}).Validate(); err == nil {
+		t.Error("forward without TLS was validated")
+	}
+}
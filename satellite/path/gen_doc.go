@@ -0,0 +1,131 @@
+//go:build ignore
+// +build ignore
+
+// gen_doc generates conditions_doc.go from the doc comments of RequestConditions and Path
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// structs are the struct types of the path package and the packages it configures, by qualified name
+var structs = make(map[string]*ast.StructType)
+
+// parsePackage adds the struct types of the package in dir to structs
+func parsePackage(dir, qualifier string) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != "gen_doc.go"
+	}, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			if s, ok := spec.Type.(*ast.StructType); ok {
+				structs[qualifier+spec.Name.Name] = s
+			}
+			return false
+		})
+	}
+}
+
+// resolve gets the struct of a field type
+func resolve(expr ast.Expr) *ast.StructType {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return t
+	case *ast.Ident:
+		return structs[t.Name]
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return structs[pkg.Name+"."+t.Sel.Name]
+		}
+	}
+	return nil
+}
+
+// collect adds the doc comments of the fields of s to docs, keyed by their YAML path
+func collect(s *ast.StructType, prefix string, docs map[string]string) {
+	for _, field := range s.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options := strings.Split(reflect.StructTag(tag).Get("yaml"), ",")
+		name := options[0]
+		if len(options) > 1 && options[1] == "inline" {
+			if nested := resolve(field.Type); nested != nil {
+				collect(nested, prefix, docs)
+			}
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		docs[key] = strings.Join(strings.Fields(field.Doc.Text()), " ")
+
+		if nested := resolve(field.Type); nested != nil {
+			collect(nested, key+".", docs)
+		}
+	}
+}
+
+// write writes docs as the map variable name
+func write(buf *bytes.Buffer, name, comment string, docs map[string]string) {
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(buf, "\n// %s %s\n", name, comment)
+	fmt.Fprintf(buf, "var %s = map[string]string{\n", name)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%q: %q,\n", key, docs[key])
+	}
+	buf.WriteString("}\n")
+}
+
+func main() {
+	parsePackage(".", "")
+	parsePackage("../notify", "notify.")
+
+	conditionDocs := make(map[string]string)
+	collect(structs["RequestConditions"], "", conditionDocs)
+	pathDocs := make(map[string]string)
+	collect(structs["Path"], "", pathDocs)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen_doc.go; DO NOT EDIT.\n\npackage path\n")
+	write(&buf, "conditionDocs", "are the doc comments of the RequestConditions fields by YAML key", conditionDocs)
+	write(&buf, "pathDocs", "are the doc comments of the Path fields by YAML key", pathDocs)
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("conditions_doc.go", out, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
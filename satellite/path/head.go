@@ -0,0 +1,47 @@
+package path
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// HEAD behaviours usable in head
+const (
+	// HeadMirror decides HEAD requests like GET requests, so they are answered with
+	// the headers of the GET response
+	HeadMirror = "mirror"
+	// HeadDecoy answers every HEAD request with not_found without deciding it
+	HeadDecoy = "decoy"
+	// HeadDeny answers every HEAD request with 405 Method Not Allowed
+	HeadDeny = "deny"
+)
+
+// validateHead checks head is a HEAD behaviour
+func validateHead(head string) error {
+	switch head {
+	case "", HeadMirror, HeadDecoy, HeadDeny:
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%s is not a valid head", head))
+}
+
+// headAsGet gets req as a GET request. The server still leaves the body out of the response
+func headAsGet(req *http.Request) *http.Request {
+	get := *req
+	get.Method = http.MethodGet
+	return &get
+}
+
+// answerHead answers a HEAD request to matchedPath which is not mirrored. It
+// returns false when not_found should be served
+func (paths *Paths) answerHead(w http.ResponseWriter, req *http.Request, matchedPath *Path) bool {
+	paths.state.Hits().Add(req, "denied", paths.GeoIP())
+	if matchedPath.Head == HeadDeny {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package path
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+	"golang.org/x/net/http/httpguts"
+)
+
+// ValidateHeaders checks response headers have valid names and values
+func ValidateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return errors.New(fmt.Sprintf("%s is not a valid header name", name))
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return errors.New(fmt.Sprintf("%q is not a valid %s header value", value, name))
+		}
+	}
+	return nil
+}
+
+// setHeaders sets headers on the response, replacing headers of the same name
+func setHeaders(w http.ResponseWriter, headers map[string]string) {
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+}
+
+// SetResponseHeaders sets the headers sent with every served path, beneath the
+// response_headers of the path
+func (paths *Paths) SetResponseHeaders(headers map[string]string) error {
+	if err := ValidateHeaders(headers); err != nil {
+		return err
+	}
+	paths.globalMu.Lock()
+	defer paths.globalMu.Unlock()
+	paths.responseHeaders = headers
+	return nil
+}
+
+// writeResponseHeaders sets the global response headers on the response
+func (paths *Paths) writeResponseHeaders(w http.ResponseWriter) {
+	paths.globalMu.RLock()
+	defer paths.globalMu.RUnlock()
+	setHeaders(w, paths.responseHeaders)
+}
@@ -0,0 +1,177 @@
+package path
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+)
+
+// MaxHits is the number of decisions kept before the oldest is overwritten
+const MaxHits = 4096
+
+// Hit is the decision made for a request to a path
+type Hit struct {
+	Time    time.Time `json:"time"`
+	IP      string    `json:"ip"`
+	Path    string    `json:"path"`
+	Country string    `json:"country,omitempty"`
+	// Decision is served, denied, or rate_limited
+	Decision  string `json:"decision"`
+	UserAgent string `json:"user_agent"`
+	JA3       string `json:"ja3"`
+	// Enrichment is the snapshot of the client taken when a payload was served
+	Enrichment *Enrichment `json:"enrichment,omitempty"`
+}
+
+// Hits is a fixed size ring buffer of decisions
+type Hits struct {
+	mu   sync.Mutex
+	list []Hit
+	next int
+	// record is called with every decision so it can be counted over time and kept in client timelines
+	record func(Hit)
+	// journal is written every decision as a line of JSON
+	journal io.Writer
+}
+
+// NewHits creates an empty decision log
+func NewHits() *Hits {
+	return &Hits{list: make([]Hit, 0, MaxHits)}
+}
+
+// Add records decision for req. The country is looked up in gip when it has a DB
+func (h *Hits) Add(req *http.Request, decision string, gip geoip.DB) {
+	h.add(req, decision, gip, nil)
+}
+
+// AddServed records a payload served for req with the enrichment snapshot of its client
+func (h *Hits) AddServed(req *http.Request, enrichment Enrichment) {
+	h.add(req, "served", geoip.DB{}, &enrichment)
+}
+
+func (h *Hits) add(req *http.Request, decision string, gip geoip.DB, enrichment *Enrichment) {
+	if req.URL == nil {
+		return
+	}
+
+	ip := parseRemoteAddr(req.RemoteAddr)
+	hit := Hit{
+		Time:       requestTime(req),
+		IP:         ip.String(),
+		Path:       req.URL.Path,
+		Decision:   decision,
+		UserAgent:  req.UserAgent(),
+		Enrichment: enrichment,
+	}
+	if req.JA3Fingerprint != "" {
+		hit.JA3 = ja3Digest(req.JA3Fingerprint)
+	}
+	if enrichment != nil {
+		hit.Country = enrichment.Country
+	} else if gip.HasDB() {
+		hit.Country, _ = gip.CountryCode(ip)
+	}
+	if h.record != nil {
+		h.record(hit)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.journal != nil {
+		if line, err := json.Marshal(hit); err == nil {
+			h.journal.Write(append(line, '\n'))
+		}
+	}
+	if len(h.list) < MaxHits {
+		h.list = append(h.list, hit)
+		return
+	}
+	h.list[h.next] = hit
+	h.next = (h.next + 1) % MaxHits
+}
+
+// SetJournal writes every decision made from now on to w as a line of JSON
+func (h *Hits) SetJournal(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.journal = w
+}
+
+// List returns the recorded decisions from oldest to newest
+func (h *Hits) List() []Hit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ret := make([]Hit, 0, len(h.list))
+	for i := range h.list {
+		ret = append(ret, h.list[(h.next+i)%len(h.list)])
+	}
+	return ret
+}
+
+// remove removes the decisions match returns true for
+func (h *Hits) remove(match func(Hit) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := make([]Hit, 0, MaxHits)
+	for i := range h.list {
+		if hit := h.list[(h.next+i)%len(h.list)]; !match(hit) {
+			kept = append(kept, hit)
+		}
+	}
+	h.list, h.next = kept, 0
+}
+
+// journalFilter is a journal decisions can be read from and removed from, like a log file
+type journalFilter interface {
+	Filter(drop func(line []byte) bool, w io.Writer) (int, error)
+}
+
+// journaled writes the journaled decisions match returns true for to w, removing
+// them from the journal when remove is set. Journals which cannot be read are skipped
+func (h *Hits) journaled(match func(Hit) bool, remove bool, w io.Writer) error {
+	h.mu.Lock()
+	journal, ok := h.journal.(journalFilter)
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	_, err := journal.Filter(func(line []byte) bool {
+		var hit Hit
+		if json.Unmarshal(line, &hit) != nil || !match(hit) {
+			return false
+		}
+		if !remove {
+			w.Write(append(append([]byte{}, line...), '\n'))
+		}
+		return remove
+	}, w)
+	return err
+}
+
+// Purge removes decisions made before cutoff. It returns the number removed
+func (h *Hits) Purge(cutoff time.Time) int {
+	return h.purge(before(cutoff))
+}
+
+// purge removes the decisions expired returns true for. It returns the number removed
+func (h *Hits) purge(expired func(path string, t time.Time) bool) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := make([]Hit, 0, MaxHits)
+	for i := range h.list {
+		if hit := h.list[(h.next+i)%len(h.list)]; !expired(hit.Path, hit.Time) {
+			kept = append(kept, hit)
+		}
+	}
+	purged := len(h.list) - len(kept)
+	h.list, h.next = kept, 0
+	return purged
+}
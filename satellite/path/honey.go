@@ -0,0 +1,97 @@
+package path
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/metrics"
+	"github.com/t94j0/satellite/satellite/notify"
+)
+
+// maxHoneyBody is the largest request body searched for honey credentials
+const maxHoneyBody = 1 << 20
+
+var honeyCredentialsUsed = metrics.NewCounterVec("satellite_honey_credentials_used_total", "Honey credentials used against a honey login path", "path")
+
+// honeyTokens gets the honey credentials seeded in every path
+func (paths *Paths) honeyTokens() []string {
+	tokens := make([]string, 0)
+	for _, p := range paths.pathList() {
+		tokens = append(tokens, p.HoneyCredentials.Tokens...)
+	}
+	return tokens
+}
+
+// usedHoneyToken returns the honey credential found in the headers, query, or
+// body of req
+func usedHoneyToken(req *http.Request, tokens []string) (string, bool) {
+	if len(tokens) == 0 {
+		return "", false
+	}
+
+	var haystack bytes.Buffer
+	for _, values := range req.Header {
+		for _, v := range values {
+			haystack.WriteString(v + "\n")
+		}
+	}
+	if req.URL != nil {
+		haystack.WriteString(req.URL.RawQuery + "\n")
+	}
+	if username, password, ok := req.BasicAuth(); ok {
+		haystack.WriteString(username + "\n" + password + "\n")
+	}
+
+	haystack.Write(peekBody(req, maxHoneyBody))
+
+	content := haystack.String()
+	for _, token := range tokens {
+		if token != "" && strings.Contains(content, token) {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// honeyLogin alerts the operator and rejects the request when honey
+// credentials are used against a honey login path. It returns true when the
+// request was handled
+func (paths *Paths) honeyLogin(w http.ResponseWriter, req *http.Request, matchedPath *Path) bool {
+	token, used := usedHoneyToken(req, paths.honeyTokens())
+	if !used {
+		return false
+	}
+
+	ip := parseRemoteAddr(req.RemoteAddr)
+	honeyCredentialsUsed.With(matchedPath.Path).Inc()
+	log.WithFields(log.Fields{
+		"ip":         ip,
+		"path":       req.URL.Path,
+		"user_agent": req.UserAgent(),
+	}).Warn("Honey credentials used")
+
+	if matchedPath.Notify.Enabled() {
+		conf := matchedPath.Notify
+		alert := notify.Alert{
+			Text:     fmt.Sprintf("Honey credentials %s...%s used by %s against %s", token[:1], token[len(token)-1:], ip, req.URL.Path),
+			Path:     req.URL.Path,
+			IP:       ip.String(),
+			Decision: "honey_credentials",
+		}
+		go func() {
+			if err := paths.notifier.Send(conf, alert); err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Error("Unable to send honey credential notification")
+			}
+		}()
+	}
+
+	w.WriteHeader(http.StatusUnauthorized)
+	io.WriteString(w, "Invalid username or password\n")
+	return true
+}
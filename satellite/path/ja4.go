@@ -0,0 +1,216 @@
+package path
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBadClientHello is returned when a raw TLS client hello cannot be parsed
+var ErrBadClientHello = errors.New("malformed client hello")
+
+// TLS extensions which change the JA4 fingerprint
+const (
+	extensionServerName          = 0x0000
+	extensionSignatureAlgorithms = 0x000d
+	extensionALPN                = 0x0010
+	extensionSupportedVersions   = 0x002b
+)
+
+// helloReader reads the length prefixed fields of a client hello
+type helloReader []byte
+
+func (r *helloReader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *helloReader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+// vector reads a field prefixed by its size in n bytes
+func (r *helloReader) vector(n int) (helloReader, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	size := 0
+	for _, b := range (*r)[:n] {
+		size = size<<8 | int(b)
+	}
+	*r = (*r)[n:]
+	if len(*r) < size {
+		return nil, false
+	}
+	v := (*r)[:size]
+	*r = (*r)[size:]
+	return v, true
+}
+
+func (r *helloReader) uint16s() []uint16 {
+	var values []uint16
+	for {
+		v, ok := r.uint16()
+		if !ok {
+			return values
+		}
+		values = append(values, v)
+	}
+}
+
+// grease returns true for the reserved values clients send to keep servers tolerant of unknown values
+func grease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// JA4 computes the FoxIO JA4 fingerprint of a raw TLS client hello handshake message
+func JA4(hello []byte) (string, error) {
+	r := helloReader(hello)
+	if !r.skip(4) {
+		return "", ErrBadClientHello
+	}
+	version, ok := r.uint16()
+	if !ok || !r.skip(32) {
+		return "", ErrBadClientHello
+	}
+	if _, ok := r.vector(1); !ok {
+		return "", ErrBadClientHello
+	}
+	suites, ok := r.vector(2)
+	if !ok {
+		return "", ErrBadClientHello
+	}
+	if _, ok := r.vector(1); !ok {
+		return "", ErrBadClientHello
+	}
+
+	var ciphers []string
+	for _, c := range suites.uint16s() {
+		if !grease(c) {
+			ciphers = append(ciphers, fmt.Sprintf("%04x", c))
+		}
+	}
+
+	var extensions, sigAlgs []string
+	sni, alpn, count := "i", "00", 0
+	if len(r) > 0 {
+		exts, ok := r.vector(2)
+		if !ok {
+			return "", ErrBadClientHello
+		}
+		for len(exts) > 0 {
+			typ, ok := exts.uint16()
+			if !ok {
+				return "", ErrBadClientHello
+			}
+			data, ok := exts.vector(2)
+			if !ok {
+				return "", ErrBadClientHello
+			}
+			if grease(typ) {
+				continue
+			}
+			count++
+
+			switch typ {
+			case extensionServerName:
+				sni = "d"
+				continue
+			case extensionALPN:
+				if protocols, ok := data.vector(2); ok {
+					if first, ok := protocols.vector(1); ok && len(first) > 0 {
+						alpn = ja4ALPN(first)
+					}
+				}
+				continue
+			case extensionSignatureAlgorithms:
+				if algs, ok := data.vector(2); ok {
+					for _, a := range algs.uint16s() {
+						if !grease(a) {
+							sigAlgs = append(sigAlgs, fmt.Sprintf("%04x", a))
+						}
+					}
+				}
+			case extensionSupportedVersions:
+				if versions, ok := data.vector(1); ok {
+					for _, v := range versions.uint16s() {
+						if !grease(v) && v > version {
+							version = v
+						}
+					}
+				}
+			}
+			extensions = append(extensions, fmt.Sprintf("%04x", typ))
+		}
+	}
+
+	sort.Strings(ciphers)
+	sort.Strings(extensions)
+	suffix := strings.Join(extensions, ",")
+	if len(sigAlgs) > 0 {
+		suffix += "_" + strings.Join(sigAlgs, ",")
+	}
+
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s", ja4Version(version), sni, min99(len(ciphers)), min99(count), alpn,
+		ja4Hash(strings.Join(ciphers, ",")), ja4Hash(suffix)), nil
+}
+
+func ja4Version(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	}
+	return "00"
+}
+
+// ja4ALPN gets the first and last characters of the first ALPN protocol, or
+// of its hex encoding when either is not alphanumeric
+func ja4ALPN(protocol []byte) string {
+	first, last := protocol[0], protocol[len(protocol)-1]
+	if alphanumeric(first) && alphanumeric(last) {
+		return string([]byte{first, last})
+	}
+	encoded := hex.EncodeToString(protocol)
+	return encoded[:1] + encoded[len(encoded)-1:]
+}
+
+func alphanumeric(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// ja4Hash is the truncated SHA256 of a JA4 list. Empty lists are all zeroes
+func ja4Hash(list string) string {
+	if list == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(list))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
@@ -0,0 +1,134 @@
+package path
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// KeyingPlaceholder is replaced in keying stubs by the encrypted payload
+const KeyingPlaceholder = "{{payload}}"
+
+// keyingSaltSize is the size of the random salt of every encrypted payload
+const keyingSaltSize = 16
+
+// KeyingConfig encrypts the hosted file with a key derived from attributes of the
+// client, so the payload only decrypts in the environment it was served to.
+//
+// The key is the SHA-256 digest of a random 16 byte salt followed by the values of
+// the attributes, trimmed, lowercased, and joined with newlines. The payload is
+// the salt, a 12 byte nonce, and the AES-256-GCM ciphertext, which is served as
+// is or base64 encoded in the stub
+type KeyingConfig struct {
+	// Attributes are the client attributes the key is derived from, in order: ip for
+	// the external IP of the client, query:<name> for a query parameter like a domain
+	// token, or header:<name> for a request header
+	Attributes []string `yaml:"attributes,omitempty"`
+	// Stub is the file, relative to the server root, served with the base64 encoded
+	// payload in place of {{payload}}. It derives the key from its environment and
+	// decrypts the payload. Without it the payload is served alone
+	Stub string `yaml:"stub,omitempty"`
+}
+
+// Enabled returns true when the hosted file is encrypted
+func (k KeyingConfig) Enabled() bool {
+	return len(k.Attributes) != 0
+}
+
+// Validate ensures the attributes are known
+func (k KeyingConfig) Validate() error {
+	if k.Stub != "" && !k.Enabled() {
+		return errors.New("keying stub requires attributes")
+	}
+	for _, attribute := range k.Attributes {
+		kind, name := splitAttribute(attribute)
+		switch {
+		case kind == "ip" && name == "":
+		case (kind == "query" || kind == "header") && name != "":
+		default:
+			return errors.New(fmt.Sprintf("%s is not a valid keying attribute", attribute))
+		}
+	}
+	return nil
+}
+
+// splitAttribute splits an attribute like query:domain into its kind and name
+func splitAttribute(attribute string) (string, string) {
+	parts := strings.SplitN(attribute, ":", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// values gets the values of the attributes of the client of req. Every attribute must be sent
+func (k KeyingConfig) values(req *http.Request) ([]string, error) {
+	values := make([]string, 0, len(k.Attributes))
+	for _, attribute := range k.Attributes {
+		var value string
+		switch kind, name := splitAttribute(attribute); kind {
+		case "ip":
+			if ip := parseRemoteAddr(req.RemoteAddr); ip != nil {
+				value = ip.String()
+			}
+		case "query":
+			if req.URL != nil {
+				value = req.URL.Query().Get(name)
+			}
+		case "header":
+			value = req.Header.Get(name)
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			return nil, errors.New(fmt.Sprintf("keying attribute %s was not sent", attribute))
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// seal encrypts data with the key of the client of req, and puts it in the stub from root
+func (k KeyingConfig) seal(data []byte, req *http.Request, root string) ([]byte, error) {
+	values, err := k.values(req)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, keyingSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append(salt, strings.Join(values, "\n")...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	payload := aead.Seal(append(salt, nonce...), nonce, data, nil)
+
+	if k.Stub == "" {
+		return payload, nil
+	}
+	stub, err := ioutil.ReadFile(path.Join(root, path.Clean("/"+k.Stub)))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Replace(stub, []byte(KeyingPlaceholder), []byte(base64.StdEncoding.EncodeToString(payload)), -1), nil
+}
@@ -0,0 +1,86 @@
+package path_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+// openKeyed decrypts a keyed payload like a stub run by the client with values would
+func openKeyed(payload []byte, values ...string) ([]byte, error) {
+	salt, payload := payload[:16], payload[16:]
+	key := sha256.Sum256(append(append([]byte{}, salt...), strings.Join(values, "\n")...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil)
+}
+
+func TestPaths_MatchAndServe_keying(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreateFile("stub.ps1", "$p = '{{payload}}'")
+	tmpdir.CreatePathListIndex(`keying:
+    attributes: [ip, "query:domain"]
+    stub: /stub.ps1`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/index.html?domain=CORP.example.com", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Fatal(err)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "$p = '") || !strings.HasSuffix(body, "'") {
+		t.Fatalf("payload was not put in the stub: %q", body)
+	}
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(body, "$p = '"), "'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := openKeyed(payload, "192.0.2.1", "corp.example.com"); err != nil || string(data) != Sentinal {
+		t.Errorf("payload did not decrypt in the keyed environment: %q %v", data, err)
+	}
+	if _, err := openKeyed(payload, "192.0.2.1", "other.example.com"); err == nil {
+		t.Error("payload decrypted in another environment")
+	}
+
+	req = httptest.NewRequest("GET", "/index.html", nil)
+	if _, err := paths.MatchAndServe(httptest.NewRecorder(), req); err == nil {
+		t.Error("payload was served without the domain token")
+	}
+}
+
+func TestKeyingConfig_Validate_fail(t *testing.T) {
+	for _, k := range []KeyingConfig{
+		{Attributes: []string{"ja3"}},
+		{Attributes: []string{"query:"}},
+		{Stub: "/stub.ps1"},
+	} {
+		if err := k.Validate(); err == nil {
+			t.Errorf("%+v was accepted", k)
+		}
+	}
+}
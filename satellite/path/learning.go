@@ -0,0 +1,157 @@
+package path
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// MaxProfiles is the number of learned profiles kept. The least recently seen profile is dropped first
+const MaxProfiles = 1024
+
+// ErrProfileNotFound is returned when a learned profile does not exist
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile is the fingerprint of clients which passed a learning path's conditions
+type Profile struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	// JA3 is the MD5 digest of the JA3 fingerprint, as used in authorized_ja3
+	JA3     string `json:"ja3"`
+	JA3Full string `json:"ja3_full"`
+	JA3S    string `json:"ja3s"`
+	// JA4 is the FoxIO JA4 fingerprint, as used in authorized_ja4
+	JA4       string `json:"ja4"`
+	HTTP2     string `json:"http2"`
+	UserAgent string `json:"user_agent"`
+	// Headers are the sorted request header names
+	Headers []string `json:"headers"`
+	// HeaderOrder is the order the request headers were sent in, as used in authorized_header_order
+	HeaderOrder string    `json:"header_order"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Profiles are the fingerprints recorded by paths in learning mode
+type Profiles struct {
+	mu   sync.Mutex
+	list map[string]*Profile
+}
+
+// NewProfiles creates an empty set of learned profiles
+func NewProfiles() *Profiles {
+	return &Profiles{list: make(map[string]*Profile)}
+}
+
+func ja3Digest(ja3 string) string {
+	hash := md5.Sum([]byte(ja3))
+	return hex.EncodeToString(hash[:])
+}
+
+// Record learns the profile of req for path
+func (p *Profiles) Record(path string, req *http.Request) Profile {
+	headers := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+
+	ja3 := ja3Digest(req.JA3Fingerprint)
+	ja4, _ := JA4(req.ClientHello)
+	order := strings.Join(req.HeaderOrder, ",")
+	id := ja3Digest(strings.Join([]string{path, req.JA3Fingerprint, ja4, req.HTTP2Fingerprint, req.UserAgent(), order, strings.Join(headers, ",")}, "|"))[:16]
+	now := requestTime(req)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile, ok := p.list[id]
+	if !ok {
+		if len(p.list) >= MaxProfiles {
+			p.evict()
+		}
+		profile = &Profile{
+			ID:          id,
+			Path:        path,
+			JA3:         ja3,
+			JA3Full:     req.JA3Fingerprint,
+			JA3S:        req.JA3SFingerprint,
+			JA4:         ja4,
+			HTTP2:       req.HTTP2Fingerprint,
+			UserAgent:   req.UserAgent(),
+			Headers:     headers,
+			HeaderOrder: order,
+			FirstSeen:   now,
+		}
+		p.list[id] = profile
+	}
+	profile.Count++
+	profile.LastSeen = now
+
+	return *profile
+}
+
+// evict removes the least recently seen profile. The lock must be held
+func (p *Profiles) evict() {
+	var oldest *Profile
+	for _, profile := range p.list {
+		if oldest == nil || profile.LastSeen.Before(oldest.LastSeen) {
+			oldest = profile
+		}
+	}
+	if oldest != nil {
+		delete(p.list, oldest.ID)
+	}
+}
+
+// Get gets a learned profile by ID
+func (p *Profiles) Get(id string) (Profile, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	profile, ok := p.list[id]
+	if !ok {
+		return Profile{}, ErrProfileNotFound
+	}
+	return *profile, nil
+}
+
+// List returns the learned profiles, most frequently seen first
+func (p *Profiles) List() []Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	list := make([]Profile, 0, len(p.list))
+	for _, profile := range p.list {
+		list = append(list, *profile)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Purge removes profiles last seen before cutoff. It returns the number removed
+func (p *Profiles) Purge(cutoff time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	purged := 0
+	for id, profile := range p.list {
+		if profile.LastSeen.Before(cutoff) {
+			delete(p.list, id)
+			purged++
+		}
+	}
+	return purged
+}
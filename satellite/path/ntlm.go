@@ -0,0 +1,189 @@
+package path
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// ErrNoNTLM is returned when a request has no NTLM message
+var ErrNoNTLM = errors.New("No NTLM message in request")
+
+// NTLM message types
+const (
+	ntlmNegotiate    = 1
+	ntlmChallenge    = 2
+	ntlmAuthenticate = 3
+)
+
+// ntlmSignature starts every NTLM message
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmTarget is the NetBIOS domain satellite claims to be in
+const ntlmTarget = "WORKGROUP"
+
+// NTLMAuthenticate is the identity a client sends in an NTLM authenticate message
+type NTLMAuthenticate struct {
+	Domain      string
+	User        string
+	Workstation string
+}
+
+// ntlmMessage gets the NTLM message and its type from the Authorization header
+// of req. Negotiate headers may wrap the message in SPNEGO
+func ntlmMessage(req *http.Request) ([]byte, uint32, error) {
+	auth := req.Header.Get("Authorization")
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || (!strings.EqualFold(parts[0], "NTLM") && !strings.EqualFold(parts[0], "Negotiate")) {
+		return nil, 0, ErrNoNTLM
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, 0, ErrNoNTLM
+	}
+
+	start := bytes.Index(data, ntlmSignature)
+	if start < 0 || len(data) < start+12 {
+		return nil, 0, ErrNoNTLM
+	}
+	msg := data[start:]
+	return msg, binary.LittleEndian.Uint32(msg[8:]), nil
+}
+
+// ntlmField reads a length, max length, offset field of an NTLM message
+func ntlmField(msg []byte, at int, unicode bool) (string, error) {
+	if len(msg) < at+8 {
+		return "", errors.New("NTLM message too short")
+	}
+	length := int(binary.LittleEndian.Uint16(msg[at:]))
+	offset := int(binary.LittleEndian.Uint32(msg[at+4:]))
+	if offset+length > len(msg) || offset < 0 {
+		return "", errors.New("NTLM field out of bounds")
+	}
+	value := msg[offset : offset+length]
+
+	if !unicode {
+		return string(value), nil
+	}
+	chars := make([]uint16, len(value)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(value[i*2:])
+	}
+	return string(utf16.Decode(chars)), nil
+}
+
+// ParseNTLMAuthenticate reads the identity in an NTLM authenticate message
+func ParseNTLMAuthenticate(msg []byte) (NTLMAuthenticate, error) {
+	var auth NTLMAuthenticate
+	if len(msg) < 64 || !bytes.HasPrefix(msg, ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != ntlmAuthenticate {
+		return auth, errors.New("not an NTLM authenticate message")
+	}
+
+	unicode := binary.LittleEndian.Uint32(msg[60:])&0x1 != 0
+	var err error
+	if auth.Domain, err = ntlmField(msg, 28, unicode); err != nil {
+		return auth, err
+	}
+	if auth.User, err = ntlmField(msg, 36, unicode); err != nil {
+		return auth, err
+	}
+	if auth.Workstation, err = ntlmField(msg, 44, unicode); err != nil {
+		return auth, err
+	}
+	return auth, nil
+}
+
+func utf16le(s string) []byte {
+	chars := utf16.Encode([]rune(s))
+	out := make([]byte, len(chars)*2)
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(out[i*2:], c)
+	}
+	return out
+}
+
+// ntlmChallengeMessage creates the challenge sent in response to a negotiate message
+func ntlmChallengeMessage(computer string) []byte {
+	target := utf16le(ntlmTarget)
+
+	// Target info is required by NTLMv2 clients
+	var info bytes.Buffer
+	avPair := func(id uint16, value []byte) {
+		binary.Write(&info, binary.LittleEndian, id)
+		binary.Write(&info, binary.LittleEndian, uint16(len(value)))
+		info.Write(value)
+	}
+	avPair(2, target)
+	avPair(1, utf16le(computer))
+	avPair(0, nil)
+
+	challenge := make([]byte, 8)
+	rand.Read(challenge)
+
+	// Unicode, request target, NTLM, always sign, domain target, extended
+	// session security, target info, version, 128 bit, and 56 bit
+	flags := uint32(0xa2898205)
+
+	msg := make([]byte, 56)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmChallenge)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(target)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(target)))
+	binary.LittleEndian.PutUint32(msg[16:], 56)
+	binary.LittleEndian.PutUint32(msg[20:], flags)
+	copy(msg[24:], challenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(info.Len()))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(info.Len()))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(56+len(target)))
+	// Windows 10 1809
+	copy(msg[48:], []byte{10, 0, 0x63, 0x45, 0, 0, 0, 15})
+
+	msg = append(msg, target...)
+	return append(msg, info.Bytes()...)
+}
+
+// ntlmComputerName gets a NetBIOS computer name from the requested host
+func ntlmComputerName(host string) string {
+	name := strings.SplitN(host, ".", 2)[0]
+	name = strings.SplitN(name, ":", 2)[0]
+	if name == "" {
+		name = "SERVER"
+	}
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return strings.ToUpper(name)
+}
+
+// ntlmExchange challenges clients which have not sent an NTLM authenticate
+// message. It returns true when a challenge was written to w
+func ntlmExchange(w http.ResponseWriter, req *http.Request) bool {
+	msg, msgType, err := ntlmMessage(req)
+	if err == nil && msgType == ntlmAuthenticate {
+		return false
+	}
+
+	if err == nil && msgType == ntlmNegotiate {
+		challenge := base64.StdEncoding.EncodeToString(ntlmChallengeMessage(ntlmComputerName(req.Host)))
+		w.Header().Set("WWW-Authenticate", "NTLM "+challenge)
+	} else {
+		if err == nil {
+			log.WithFields(log.Fields{
+				"ip":   req.RemoteAddr,
+				"type": msgType,
+				"size": len(msg),
+			}).Debug("Unexpected NTLM message")
+		}
+		w.Header().Add("WWW-Authenticate", "NTLM")
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	return true
+}
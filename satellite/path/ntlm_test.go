@@ -0,0 +1,116 @@
+package path_test
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+// ntlmAuthenticate creates a unicode NTLM authenticate message
+func ntlmAuthenticate(domain, user, workstation string) []byte {
+	msg := make([]byte, 64)
+	copy(msg, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	binary.LittleEndian.PutUint32(msg[60:], 0x1)
+
+	for i, value := range []string{domain, user, workstation} {
+		chars := utf16.Encode([]rune(value))
+		field := 28 + i*8
+		binary.LittleEndian.PutUint16(msg[field:], uint16(len(chars)*2))
+		binary.LittleEndian.PutUint16(msg[field+2:], uint16(len(chars)*2))
+		binary.LittleEndian.PutUint32(msg[field+4:], uint32(len(msg)))
+		for _, c := range chars {
+			msg = append(msg, byte(c), byte(c>>8))
+		}
+	}
+	return msg
+}
+
+func TestParseNTLMAuthenticate(t *testing.T) {
+	auth, err := ParseNTLMAuthenticate(ntlmAuthenticate("CORP", "alice", "WS01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Domain != "CORP" || auth.User != "alice" || auth.Workstation != "WS01" {
+		t.Errorf("unexpected identity %+v", auth)
+	}
+}
+
+func TestParseNTLMAuthenticate_fail(t *testing.T) {
+	msg := ntlmAuthenticate("CORP", "alice", "WS01")
+	// Domain offset past the end of the message
+	binary.LittleEndian.PutUint32(msg[32:], 4096)
+	if _, err := ParseNTLMAuthenticate(msg); err == nil {
+		t.Fail()
+	}
+}
+
+func TestPaths_MatchAndServe_ntlm(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload
+  hosted_file: payload
+  authorized_domains:
+    - corp`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Clients without credentials are asked for NTLM
+	req := httptest.NewRequest("GET", "/payload", nil)
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "NTLM" {
+		t.Error("client was not asked for NTLM")
+	}
+
+	// Negotiate messages get a challenge
+	negotiate := make([]byte, 32)
+	copy(negotiate, "NTLMSSP\x00")
+	negotiate[8] = 1
+	req = httptest.NewRequest("GET", "/payload", nil)
+	req.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(negotiate))
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	challenge, err := base64.StdEncoding.DecodeString(w.Header().Get("WWW-Authenticate")[len("NTLM "):])
+	if err != nil || w.Code != http.StatusUnauthorized || len(challenge) < 56 || challenge[8] != 2 {
+		t.Error("client was not sent a challenge")
+	}
+
+	// Authenticate messages from the authorized domain are served
+	req = httptest.NewRequest("GET", "/payload", nil)
+	req.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmAuthenticate("CORP", "alice", "WS01")))
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() != Sentinal {
+		t.Error("authorized domain was not served")
+	}
+
+	req = httptest.NewRequest("GET", "/payload", nil)
+	req.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmAuthenticate("SANDBOX", "admin", "WIN-1")))
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() == Sentinal {
+		t.Error("unauthorized domain was served")
+	}
+}
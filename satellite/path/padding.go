@@ -0,0 +1,102 @@
+package path
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// Padding fills
+const (
+	// PaddingZero pads with zero bytes
+	PaddingZero = "zero"
+	// PaddingRandom pads with random bytes
+	PaddingRandom = "random"
+)
+
+// PaddingConfig appends junk to the hosted file so the payload served does not
+// have the size of the file. The file is unchanged on disk
+type PaddingConfig struct {
+	// Size is the exact size in bytes the payload is padded to
+	Size int64 `yaml:"size,omitempty"`
+	// Min is the smallest size in bytes of a payload padded to a random size between min and max
+	Min int64 `yaml:"min,omitempty"`
+	// Max is the largest size in bytes of a payload padded to a random size between min and max
+	Max int64 `yaml:"max,omitempty"`
+	// Fill is the junk the payload is padded with: zero or random. Defaults to zero
+	Fill string `yaml:"fill,omitempty"`
+}
+
+// Enabled returns true when the payload is padded
+func (p PaddingConfig) Enabled() bool {
+	return p.Size > 0 || p.Max > 0
+}
+
+// Validate ensures the padding sizes are usable
+func (p PaddingConfig) Validate() error {
+	if p.Size < 0 || p.Min < 0 || p.Max < 0 {
+		return errors.New("padding sizes must not be negative")
+	}
+	if p.Size > 0 && (p.Min > 0 || p.Max > 0) {
+		return errors.New("padding size cannot be used with min and max")
+	}
+	if p.Min > p.Max {
+		return errors.New("padding min must not be larger than max")
+	}
+
+	switch p.Fill {
+	case "", PaddingZero, PaddingRandom:
+	default:
+		return errors.New(fmt.Sprintf("%s is not a valid padding fill", p.Fill))
+	}
+
+	return nil
+}
+
+// size chooses the size of a padded payload
+func (p PaddingConfig) size() int64 {
+	if p.Size > 0 {
+		return p.Size
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(p.Max-p.Min+1))
+	if err != nil {
+		return p.Max
+	}
+	return p.Min + n.Int64()
+}
+
+// write writes data padded to the configured size. Data which is already
+// larger is written as it is
+func (p PaddingConfig) write(w http.ResponseWriter, data []byte) error {
+	size := p.size()
+	if size <= int64(len(data)) {
+		_, err := w.Write(data)
+		return err
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	var fill io.Reader = zeroReader{}
+	if p.Fill == PaddingRandom {
+		fill = rand.Reader
+	}
+	_, err := io.CopyN(w, fill, size-int64(len(data)))
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
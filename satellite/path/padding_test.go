@@ -0,0 +1,75 @@
+package path_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_MatchAndServe_padding(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /exact
+  hosted_file: payload
+  padding:
+    size: 1024
+- path: /range
+  hosted_file: payload
+  padding:
+    min: 2048
+    max: 4096
+    fill: random`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", uri, nil)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w
+	}
+
+	w := request("/exact")
+	if w.Body.Len() != 1024 || !strings.HasPrefix(w.Body.String(), Sentinal) {
+		t.Errorf("payload was not padded to 1024 bytes: %d", w.Body.Len())
+	}
+	if w.Header().Get("Content-Length") != "1024" {
+		t.Error("Content-Length is not the padded size")
+	}
+
+	w = request("/range")
+	if w.Body.Len() < 2048 || w.Body.Len() > 4096 || !strings.HasPrefix(w.Body.String(), Sentinal) {
+		t.Errorf("payload was not padded to the range: %d", w.Body.Len())
+	}
+}
+
+func TestPaddingConfig_Validate(t *testing.T) {
+	valid := PaddingConfig{Min: 10, Max: 20, Fill: PaddingRandom}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []PaddingConfig{
+		{Size: -1},
+		{Size: 10, Max: 20},
+		{Min: 20, Max: 10},
+		{Size: 10, Fill: "ones"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v was valid", p)
+		}
+	}
+}
@@ -1,51 +1,136 @@
 package path
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/url"
 	"os"
 	"path"
+	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
-	"github.com/t94j0/satellite/crypto/tls"
 	"github.com/t94j0/satellite/net/http"
-	"github.com/t94j0/satellite/net/http/httputil"
 	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/notify"
 	"gopkg.in/yaml.v2"
 )
 
 // Path is an available path that can be accessed on the server
 type Path struct {
+	// Path is the URI of the path, which may be a glob
 	Path string `yaml:"path,omitempty"`
 	// HostedFile is the file to host
 	HostedFile string `yaml:"hosted_file" json:"-"`
 	// ContentType tells the browser what content should be parsed. A list of MIME
-	// types can be found here: https://www.freeformatter.com/mime-types-list.html
+	// types can be found here: https://www.freeformatter.com/mime-types-list.html.
+	// Without it, the type is found from the extension of disposition.file_name
 	ContentType string `yaml:"content_type,omitempty"`
 	// Disposition sets the Content-Disposition header
 	Disposition struct {
-		// Type is the type of disposition. Usually either inline or attachment
+		// Type is the type of disposition, either inline or attachment. It is attachment when only file_name is set
 		Type string `yaml:"type"`
-		// FileName is the name of the file if Content.Type is attachment
+		// FileName is the name the file is saved as, whatever the extension of the hosted file
 		FileName string `yaml:"file_name"`
 	} `yaml:"disposition,omitempty"`
-	// OnFailure instructs the Path what to do when a failure occurs
+	// ResponseHeaders are set on the response when the path is served, like Cache-Control,
+	// CORS, or HSTS headers. They replace content_type, disposition, and response_headers
+	// of the configuration
+	ResponseHeaders map[string]string `yaml:"response_headers,omitempty"`
+	// OnFailure instructs the Path what to do when a failure occurs. The first route which is set of
+	// redirect, status, proxy, file, and render is taken, and not_found is served without one
 	OnFailure struct {
 		// Redirect will redirect the user with a 301 to a target address
 		Redirect string `yaml:"redirect"`
 		// Render will render the following path
 		Render string `yaml:"render"`
+		// Proxy proxies the request to another origin, like the site the path hides in
+		Proxy string `yaml:"proxy"`
+		// Status answers with a bare status code, like 403 or 503
+		Status int `yaml:"status"`
+		// File serves a decoy file, relative to the server root
+		File string `yaml:"file"`
 	} `yaml:"on_failure,omitempty"`
-	//ProxyHost proxies the path to this address
+	// SourceURL fetches the content of the path from a remote origin instead of hosted_file,
+	// so payloads hosted elsewhere are still served behind the conditions
+	SourceURL string `yaml:"source_url,omitempty"`
+	// SourceCache is how long content fetched from source_url is reused, like 10m. Cached
+	// content is served while the origin fails. Without it every serve fetches the origin
+	SourceCache string `yaml:"source_cache,omitempty"`
+	// ProxyHost proxies requests passing the conditions to this upstream, like a C2
+	// listener, keeping their method, headers, and body and streaming the response back
 	ProxyHost string `yaml:"proxy,omitempty"`
 	// CredentialCapture returns the credentials POSTed to the path
 	CredentialCapture struct {
+		// FileOutput is the file credentials are appended to
 		FileOutput string `yaml:"file_output"`
 	} `yaml:"credential_capture,omitempty"`
+	// HoneyCredentials are decoy credentials served by the path. They are
+	// served one per line when the path has no file
+	HoneyCredentials struct {
+		// Tokens are the decoy credentials
+		Tokens []string `yaml:"tokens"`
+	} `yaml:"honey_credentials,omitempty"`
+	// HoneyLogin makes the path a fake login which alerts when any path's honey credentials are used
+	HoneyLogin bool `yaml:"honey_login,omitempty"`
+	// CaptureClientHello stores the raw TLS client hello of clients requesting the path
+	CaptureClientHello bool `yaml:"capture_client_hello,omitempty"`
+	// Learning records the fingerprints of clients which pass the other conditions instead of enforcing
+	// authorized_ja3, authorized_ja3_raw, authorized_ja4, and authorized_header_order
+	Learning bool `yaml:"learning,omitempty"`
+	// WebDAV answers OPTIONS and PROPFIND so the file can be fetched by WebDAV
+	// clients, for example through a \\host@SSL\share\file UNC path. Gate it on the
+	// WebDAV client with authorized_useragents like ^Microsoft-WebDAV-MiniRedir/
+	WebDAV bool `yaml:"webdav,omitempty"`
+	// Update serves a software update manifest at the path and the hosted file at update.binary_path
+	Update UpdateConfig `yaml:"update,omitempty"`
+	// Padding pads the served payload with junk to a size or a random size range,
+	// so the payload does not have a fixed size
+	Padding PaddingConfig `yaml:"padding,omitempty"`
+	// ServeOnce only serves the path at one-time URLs issued to the client of a stage-1 path.
+	// The path must be a glob ending in /*
+	ServeOnce ServeOnceConfig `yaml:"serve_once,omitempty"`
+	// DetonationKey authorizes sandbox monitors to report detonations of the
+	// path's payload, which blacklists the reported IP and JA3 on every path
+	DetonationKey string `yaml:"detonation_key,omitempty" json:"-"`
+	// Queue limits concurrent requests to the path so bursts wait rather than pile up
+	Queue QueueConfig `yaml:"queue,omitempty"`
+	// Notify sends an alert to a webhook when the path is requested
+	Notify notify.Config `yaml:"notify,omitempty"`
+	// ForwardDenied sends full copies of denied requests, like canary hits, to the forward analysis service
+	ForwardDenied bool `yaml:"forward_denied,omitempty"`
+	// Canary marks a path no target should ever request, like a URL only planted where
+	// the blue team looks. Every request is counted in satellite_canary_hits_total
+	Canary bool `yaml:"canary,omitempty"`
+	// Signature sends an HMAC of the response in a header so implants can verify the redirector
+	Signature SignatureConfig `yaml:"signature,omitempty"`
+	// Campaign is the campaign whose daily quotas the path counts against
+	Campaign string `yaml:"campaign,omitempty"`
+	// IgnoreGlobal does not merge the global conditions, from global_conditions in the
+	// configuration or the global conditions directory, beneath the path's conditions
+	IgnoreGlobal bool `yaml:"ignore_global,omitempty"`
+	// Head is how HEAD requests, which many scanners send first, are answered: mirror decides them
+	// like GET requests and answers with the GET headers, decoy always answers with not_found, and
+	// deny answers with 405. By default HEAD requests are decided with their own method
+	Head string `yaml:"head,omitempty"`
+
+	// Template renders the hosted file with Go's text/template before it is served. Templates
+	// are given the request as .IP, .UserAgent, .Host, .Path, .Query, .Country, .Hits, and
+	// .Time, and can call randomHex and randomInt
+	Template bool `yaml:"template,omitempty"`
+	// Keying encrypts the hosted file with a key derived from attributes of the client, like
+	// its external IP or a domain token in the query, and serves it in a decrypting stub
+	Keying KeyingConfig `yaml:"keying,omitempty"`
 
 	Conditions RequestConditions `yaml:",inline"`
+
+	// issued are the serve_once URLs issued to the client being served, by placeholder
+	issued map[string]string
+	// templateData is the request data the hosted file of the client being served is rendered with
+	templateData *TemplateData
 }
 
 // NewPath parses a yaml file path to create a new Path object
@@ -94,21 +179,63 @@ func NewPathArrayData(data []byte) ([]*Path, error) {
 func (f *Path) ContentHeaders() map[string]string {
 	headers := make(map[string]string)
 
-	if f.ContentType != "" {
-		headers["Content-Type"] = f.ContentType
+	contentType := f.ContentType
+	if contentType == "" && f.Disposition.FileName != "" {
+		contentType = mime.TypeByExtension(path.Ext(f.Disposition.FileName))
+	}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
 	}
 
-	if f.Disposition.Type != "" {
+	dispositionType := f.Disposition.Type
+	if dispositionType == "" && f.Disposition.FileName != "" {
+		dispositionType = "attachment"
+	}
+	if dispositionType != "" {
 		if f.Disposition.FileName != "" {
-			headers["Content-Disposition"] = fmt.Sprintf("%s; filename=\"%s\"", f.Disposition.Type, f.Disposition.FileName)
+			headers["Content-Disposition"] = fmt.Sprintf("%s; %s", dispositionType, fileNameParams(f.Disposition.FileName))
 		} else {
-			headers["Content-Disposition"] = f.Disposition.Type
+			headers["Content-Disposition"] = dispositionType
 		}
 	}
 
 	return headers
 }
 
+// fileNameParams are the Content-Disposition parameters of name. Names which are not
+// ASCII are sent in filename* too, with an ASCII fallback in filename for old clients
+func fileNameParams(name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, name)
+	params := fmt.Sprintf("filename=\"%s\"", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(fallback))
+	if fallback != name {
+		params += "; filename*=UTF-8''" + strings.Replace(url.QueryEscape(name), "+", "%20", -1)
+	}
+	return params
+}
+
+// validateContent checks content_type is a media type and the disposition is inline or attachment
+func (f *Path) validateContent() error {
+	if f.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(f.ContentType); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid content_type", f.ContentType))
+		}
+	}
+	switch strings.ToLower(f.Disposition.Type) {
+	case "", "inline", "attachment":
+	default:
+		return errors.New(fmt.Sprintf("%s is not a valid disposition type", f.Disposition.Type))
+	}
+	if strings.ContainsAny(f.Disposition.FileName, "/\\\r\n") {
+		return errors.New(fmt.Sprintf("%q is not a valid disposition file_name", f.Disposition.FileName))
+	}
+	return nil
+}
+
 // ShouldHost does the checking to see if the requested file should be given to a target
 func (f *Path) ShouldHost(req *http.Request, state *State, gipDB geoip.DB) bool {
 	shouldHost := f.Conditions.ShouldHost(req, state, gipDB)
@@ -143,20 +270,68 @@ func (f *Path) FailRender(w http.ResponseWriter, req *http.Request, check func(s
 	return false, nil
 }
 
-func writeHeaders(w http.ResponseWriter, headers map[string]string) {
-	for name, value := range headers {
-		w.Header().Add(name, value)
+// FailProxy will check if the proxy failure route is on and proxy the request to its origin
+func (f *Path) FailProxy(w http.ResponseWriter, req *http.Request) (bool, error) {
+	if f.OnFailure.Proxy != "" {
+		return true, proxyTo(w, req, f.OnFailure.Proxy)
+	}
+	return false, nil
+}
+
+// FailStatus will check if the status failure route is on and answer with the status
+func (f *Path) FailStatus(w http.ResponseWriter) bool {
+	if f.OnFailure.Status != 0 {
+		w.WriteHeader(f.OnFailure.Status)
+		return true
+	}
+	return false
+}
+
+// FailFile will check if the file failure route is on and serve the decoy file from root
+func (f *Path) FailFile(w http.ResponseWriter, req *http.Request, root string) (bool, error) {
+	if f.OnFailure.File == "" {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(path.Join(root, f.OnFailure.File))
+	if err != nil {
+		return false, err
 	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	_, err = w.Write(data)
+	return true, err
+}
+
+// validateOnFailure checks the failure routes are valid
+func (f *Path) validateOnFailure() error {
+	if f.OnFailure.Proxy != "" {
+		if _, err := url.ParseRequestURI(f.OnFailure.Proxy); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid on_failure proxy", f.OnFailure.Proxy))
+		}
+	}
+	if f.OnFailure.Status != 0 && (f.OnFailure.Status < 100 || f.OnFailure.Status > 599) {
+		return errors.New(fmt.Sprintf("%d is not a valid on_failure status", f.OnFailure.Status))
+	}
+	return nil
 }
 
 // ServeHTTP is an http.HandlerFunc with error which chooses the correct way to
 // respond to an HTTP request
 //
-// A single path can be either a ProxyHost, Render, Redirect, or CredentialCapture
+// A single path can be either a WebDAV, Update, ProxyHost, Render, Redirect, or CredentialCapture
 func (f *Path) ServeHTTP(w http.ResponseWriter, req *http.Request, root string) error {
 	var err error
-	writeHeaders(w, f.ContentHeaders())
-	if f.ProxyHost != "" {
+	var signer *signingWriter
+	if f.Signature.Enabled() {
+		signer = f.Signature.writer(w, req)
+		w = signer
+	}
+	setHeaders(w, f.ContentHeaders())
+	setHeaders(w, f.ResponseHeaders)
+	if f.WebDAV && req.Method != http.MethodGet {
+		err = f.webdav(w, req, root)
+	} else if f.Update.Enabled() {
+		err = f.update(w, req, root)
+	} else if f.ProxyHost != "" {
 		err = f.proxy(w, req)
 	} else if f.CredentialCapture.FileOutput != "" {
 		err = f.credentialCapture(w, req)
@@ -166,29 +341,45 @@ func (f *Path) ServeHTTP(w http.ResponseWriter, req *http.Request, root string)
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-// Proxy executes a proxy
-func (f *Path) proxy(w http.ResponseWriter, req *http.Request) error {
-	proxyURL, err := url.ParseRequestURI(f.ProxyHost)
-	if err != nil {
-		return err
+	if signer != nil {
+		return signer.finish()
 	}
-	proxy := httputil.NewSingleHostReverseProxy(proxyURL)
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-	proxy.Transport = tr
-	proxy.ServeHTTP(w, req)
 	return nil
 }
 
 // Render will render the path
 func (f *Path) render(w http.ResponseWriter, req *http.Request, root string) error {
-	filePath := path.Join(root, f.HostedFile)
-	data, err := ioutil.ReadFile(filePath)
+	var data []byte
+	var err error
+	if f.SourceURL != "" {
+		data, err = f.source()
+	} else {
+		filePath := path.Join(root, f.HostedFile)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) && len(f.HoneyCredentials.Tokens) != 0 {
+			_, err := io.WriteString(w, strings.Join(f.HoneyCredentials.Tokens, "\n")+"\n")
+			return err
+		}
+		data, err = ioutil.ReadFile(filePath)
+	}
 	if err != nil {
 		return err
 	}
+	for placeholder, url := range f.issued {
+		data = bytes.Replace(data, []byte(placeholder), []byte(url), -1)
+	}
+	if f.Template {
+		if data, err = f.executeTemplate(data, req); err != nil {
+			return err
+		}
+	}
+	if f.Keying.Enabled() {
+		if data, err = f.Keying.seal(data, req, root); err != nil {
+			return err
+		}
+	}
+	if f.Padding.Enabled() {
+		return f.Padding.write(w, data)
+	}
 	_, err = io.WriteString(w, string(data))
 	return err
 }
@@ -153,6 +153,49 @@ disposition:
 	}
 }
 
+func TestPath_ContentHeaders_filename(t *testing.T) {
+	for _, tc := range []struct {
+		data        string
+		contentType string
+		disposition string
+	}{
+		{"disposition:\n  file_name: invoice.pdf", "application/pdf", `attachment; filename="invoice.pdf"`},
+		{"content_type: application/hta\ndisposition:\n  type: inline\n  file_name: update.hta", "application/hta", `inline; filename="update.hta"`},
+		{"disposition:\n  file_name: 'Rechnung \"März\".pdf'", "application/pdf", `attachment; filename="Rechnung \"M_rz\".pdf"; filename*=UTF-8''Rechnung%20%22M%C3%A4rz%22.pdf`},
+	} {
+		path, err := NewPathData([]byte(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers := path.ContentHeaders()
+		if headers["Content-Type"] != tc.contentType || headers["Content-Disposition"] != tc.disposition {
+			t.Errorf("expected %q and %q, got %q and %q", tc.contentType, tc.disposition, headers["Content-Type"], headers["Content-Disposition"])
+		}
+	}
+}
+
+func TestNewDefault_content_fail(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	for _, content := range []string{
+		"content_type: 'text/html; charset'",
+		"disposition:\n    type: download",
+		"disposition:\n    file_name: ../invoice.pdf",
+		"source_url: ftp://example.com/payload.bin",
+		"source_cache: 10m",
+		"proxy: localhost:50050",
+	} {
+		tmpdir.CreatePathListIndex(content)
+		if _, err := NewDefaultTest(tmpdir.Path); err == nil {
+			t.Errorf("%s was accepted", content)
+		}
+	}
+}
+
 func TestPath_ShouldHost(t *testing.T) {
 	// Create Request
 	req, err := http.NewRequest("GET", "/", nil)
@@ -1,17 +1,28 @@
 package path
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/t94j0/satellite/net/http"
 	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/t94j0/satellite/satellite/metrics"
+	"github.com/t94j0/satellite/satellite/notify"
 )
 
+var canaryHits = metrics.NewCounterVec("satellite_canary_hits_total", "Requests to canary paths, served or not", "path")
+
 // Paths is the compilation of parsed paths
 type Paths struct {
 	base                 string
@@ -19,16 +30,45 @@ type Paths struct {
 	dbRoot               string
 	globalConditionsPath string
 
-	state   *State
-	GeoipDB geoip.DB
-	list    []*Path
+	state       *State
+	notifier    *notify.Notifier
+	approvalURL string
+	campaigns   *Campaigns
+
+	// reloadMu serializes reloads, so a path reloaded alone is not lost to a full reload
+	reloadMu sync.Mutex
+	// recordMu is held for reading while a decision is made and recorded, and for
+	// writing while a campaign is wiped, so no decision is lost between an archive and its wipe
+	recordMu sync.RWMutex
+	listMu   sync.RWMutex
+	// list is replaced, never modified, by reloads
+	list []*Path
+	// queues are the admission queues of paths, keyed by path
+	queues map[string]*Queue
+
+	geoipMu sync.RWMutex
+	geoipDB geoip.DB
+
+	forwarderMu sync.RWMutex
+	// forwarder sends requests denied on paths setting forward_denied to the analysis service
+	forwarder *Forwarder
+
+	globalMu sync.RWMutex
+	// globalConditions are the global_conditions of the configuration, merged beneath the global conditions directory
+	globalConditions RequestConditions
+	// responseHeaders are the response_headers of the configuration, sent with every served path
+	responseHeaders map[string]string
 }
 
-// New creates a new Paths variable from the specified base path
+// New creates a new Paths variable from the specified base path. dbPath is
+// relative to serverRoot unless it is absolute
 func New(serverRoot, pathsList, dbPath, gcp string) (*Paths, error) {
 	list := make([]*Path, 0)
 
-	state, err := NewState(path.Join(serverRoot, dbPath))
+	if !path.IsAbs(dbPath) {
+		dbPath = path.Join(serverRoot, dbPath)
+	}
+	state, err := NewState(dbPath)
 	if err != nil {
 		return nil, err
 	}
@@ -39,9 +79,12 @@ func New(serverRoot, pathsList, dbPath, gcp string) (*Paths, error) {
 		dbRoot:               dbPath,
 		globalConditionsPath: gcp,
 
-		list:  list,
-		state: state,
+		list:     list,
+		queues:   make(map[string]*Queue),
+		state:    state,
+		notifier: notify.New(),
 	}
+	state.Approvals().OnRequest(ret.notifyApproval)
 
 	if err := ret.Reload(); err != nil {
 		return ret, err
@@ -60,25 +103,199 @@ func NewDefaultTest(serverRoot string) (*Paths, error) {
 	return New(serverRoot, "pathList.yml", ".db", "")
 }
 
-// AddGeoIP adds the GeoIP path to this location
+// AddGeoIP adds the GeoIP path to this location. It may be called again to
+// swap in an updated DB while requests are served
 func (paths *Paths) AddGeoIP(path string) error {
-	db, err := geoip.New(path)
+	paths.geoipMu.Lock()
+	defer paths.geoipMu.Unlock()
+
+	db, err := paths.geoipDB.WithDB(path)
+	if err != nil {
+		return err
+	}
+	paths.geoipDB = db
+
+	return nil
+}
+
+// AddASN adds the GeoIP ASN DB path to this location. It may be called again to
+// swap in an updated DB while requests are served
+func (paths *Paths) AddASN(path string) error {
+	paths.geoipMu.Lock()
+	defer paths.geoipMu.Unlock()
+
+	db, err := paths.geoipDB.WithASN(path)
 	if err != nil {
 		return err
 	}
-	paths.GeoipDB = db
+	paths.geoipDB = db
+
+	return nil
+}
+
+// SetCountryGroups sets the custom named groups of ISO country codes usable in
+// authorized_countries and blacklist_countries as group:<name>
+func (paths *Paths) SetCountryGroups(groups map[string][]string) {
+	paths.geoipMu.Lock()
+	defer paths.geoipMu.Unlock()
+	paths.geoipDB = paths.geoipDB.WithGroups(groups)
+}
+
+// GeoIP gets the GeoIP DBs. Replaced DBs are closed once no request uses them
+func (paths *Paths) GeoIP() geoip.DB {
+	paths.geoipMu.RLock()
+	defer paths.geoipMu.RUnlock()
+	return paths.geoipDB
+}
+
+// SetBlocklist replaces the IP ranges of the blocklist feed name, which are
+// denied on every path
+func (paths *Paths) SetBlocklist(name string, ranges []*net.IPNet) {
+	paths.state.SetFeed(name, ranges)
+}
+
+// SetScanScope sets the only ranges of clients which are scanned by authorized_jarm
+// and blacklist_jarm. Every client is scanned when ranges is empty
+func (paths *Paths) SetScanScope(ranges []*net.IPNet) {
+	paths.state.SetScanScope(ranges)
+}
+
+// SetHostingProvider replaces the published IP ranges of the hosting provider
+// name used by blacklist_hosting_providers
+func (paths *Paths) SetHostingProvider(name string, ranges []*net.IPNet) {
+	paths.state.SetHostingProvider(name, ranges)
+}
+
+// SetTorExits replaces the Tor exit node list used by blacklist_tor
+func (paths *Paths) SetTorExits(ips []net.IP) error {
+	return paths.state.SetTorExits(ips)
+}
+
+// OnBlacklist sets the function called when an IP is added to the global blacklist
+func (paths *Paths) OnBlacklist(f func(net.IP)) {
+	paths.state.OnBlacklist(f)
+}
+
+// OnStateUnavailable sets the function called with the path of the state DB and the
+// error when it becomes unavailable, and with a nil error when it recovers
+func (paths *Paths) OnStateUnavailable(f func(db string, err error)) {
+	paths.state.OnUnavailable(func(err error) {
+		f(paths.dbRoot, err)
+	})
+}
+
+// OnUnblacklist sets the function called when an IP is removed from the global blacklist
+func (paths *Paths) OnUnblacklist(f func(net.IP)) {
+	paths.state.OnUnblacklist(f)
+}
+
+// Unblacklist removes ip from the global blacklist
+func (paths *Paths) Unblacklist(ip net.IP) error {
+	return paths.state.Unblacklist(ip)
+}
+
+// BlacklistedIPs gets the IPs on the global blacklist
+func (paths *Paths) BlacklistedIPs() ([]net.IP, error) {
+	return paths.state.BlacklistedIPs()
+}
+
+// SetCampaigns sets the campaigns whose quotas paths count against
+func (paths *Paths) SetCampaigns(campaigns *Campaigns) {
+	paths.campaigns = campaigns
+}
+
+// SetApprovalURL sets the base URL of the management API used in approval links
+func (paths *Paths) SetApprovalURL(url string) {
+	paths.approvalURL = strings.TrimSuffix(url, "/")
+}
+
+// Approvals gets the queue of requests waiting on operator approval
+func (paths *Paths) Approvals() *Approvals {
+	return paths.state.Approvals()
+}
+
+// Captures gets the archive of captured TLS client hellos
+func (paths *Paths) Captures() *Captures {
+	return paths.state.Captures()
+}
+
+// Hits gets the log of recent decisions
+func (paths *Paths) Hits() *Hits {
+	return paths.state.Hits()
+}
+
+// Profiles gets the fingerprints learned by paths in learning mode
+func (paths *Paths) Profiles() *Profiles {
+	return paths.state.Profiles()
+}
+
+// Promote adds the JA3 digest, JA4 fingerprint, and header order of a learned
+// profile to its path's authorized lists. Fingerprints the client did not have are skipped
+func (paths *Paths) Promote(id string) (Profile, error) {
+	profile, err := paths.state.Profiles().Get(id)
+	if err != nil {
+		return profile, err
+	}
 
+	var promoted Promoted
+	if profile.JA3Full != "" {
+		promoted.JA3 = []string{profile.JA3}
+	}
+	if profile.JA4 != "" {
+		promoted.JA4 = []string{profile.JA4}
+	}
+	if profile.HeaderOrder != "" {
+		promoted.HeaderOrder = []string{profile.HeaderOrder}
+	}
+	if err := paths.state.Promote(profile.Path, promoted); err != nil {
+		return profile, errors.Wrap(err, "unable to promote profile")
+	}
+	return profile, nil
+}
+
+// Demote removes promoted fingerprints from the authorized lists of path
+func (paths *Paths) Demote(path string, p Promoted) error {
+	if err := paths.state.Demote(path, p); err != nil {
+		return errors.Wrap(err, "unable to demote fingerprints")
+	}
 	return nil
 }
 
+// Promoted gets the fingerprints promoted to the authorized lists of each path
+func (paths *Paths) Promoted() map[string]Promoted {
+	promoted := make(map[string]Promoted)
+	for _, p := range paths.pathList() {
+		if list := paths.state.Promoted(p.Path); !list.Empty() {
+			promoted[p.Path] = list
+		}
+	}
+	return promoted
+}
+
 // Len gets the number of paths
 func (paths *Paths) Len() int {
-	return len(paths.list)
+	return len(paths.pathList())
+}
+
+// queue gets the admission queue of the path uri
+func (paths *Paths) queue(uri string) (*Queue, bool) {
+	paths.listMu.RLock()
+	defer paths.listMu.RUnlock()
+	queue, ok := paths.queues[uri]
+	return queue, ok
+}
+
+// pathList gets the paths of the last reload
+func (paths *Paths) pathList() []*Path {
+	paths.listMu.RLock()
+	defer paths.listMu.RUnlock()
+	return paths.list
 }
 
 // Match matches a page given a URI. It returns the specified Path and a boolean
 // value to determine if there was a page that matched the URI
 func (paths *Paths) Match(uri string) (*Path, bool) {
+	uri = normalizeURI(uri)
 	hostedFileFromPath := func(v *Path) (*Path, bool) {
 		if v.HostedFile != "" {
 			return v, true
@@ -91,15 +308,17 @@ func (paths *Paths) Match(uri string) (*Path, bool) {
 		return v, true
 	}
 
+	list := paths.pathList()
+
 	// Prioritize direct matches over globs
-	for _, v := range paths.list {
-		if v.Path == uri {
+	for _, v := range list {
+		if v.Path == uri || (v.Update.Enabled() && v.Update.BinaryPath == uri) {
 			return hostedFileFromPath(v)
 		}
 	}
 
 	// Secondarily accept globs. Path is indeterminate if multiple globs match
-	for _, v := range paths.list {
+	for _, v := range list {
 		g := glob.MustCompile(v.Path, '/')
 		if g.Match(uri) {
 			return hostedFileFromPath(v)
@@ -170,13 +389,92 @@ func (paths *Paths) collectConditionalsDirectory(targetPath string) (RequestCond
 
 func (paths *Paths) validate(pathList []*Path) error {
 	for _, v := range pathList {
-		// Ensure all path URI globbing compiles
-		if _, err := glob.Compile(v.Path); err != nil {
-			return errors.Wrap(err, "unable to compile glob: "+v.Path)
+		if err := validatePath(v); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+// validatePath checks the configuration of a single path
+func validatePath(v *Path) error {
+	// Ensure all path URI globbing compiles
+	if _, err := glob.Compile(v.Path); err != nil {
+		return errors.Wrap(err, "unable to compile glob: "+v.Path)
+	}
+
+	if err := v.Conditions.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.Notify.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.Queue.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.Update.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+	if v.Update.Enabled() && v.HostedFile == "" {
+		return errors.New(v.Path + ": update requires a hosted_file")
+	}
+
+	if err := v.Padding.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+	if v.Padding.Enabled() && v.Update.Enabled() {
+		// The manifest advertises the size and hash of the hosted file
+		return errors.New(v.Path + ": padding cannot be used with update")
+	}
+	if v.Template && v.Update.Enabled() {
+		return errors.New(v.Path + ": template cannot be used with update")
+	}
+
+	if err := v.Keying.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+	if v.Keying.Enabled() && (v.Update.Enabled() || v.Padding.Enabled()) {
+		// The encrypted payload is not the file the manifest describes, and junk would break the ciphertext
+		return errors.New(v.Path + ": keying cannot be used with update or padding")
+	}
+
+	if err := v.Signature.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.validateContent(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.validateSource(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.validateProxy(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := ValidateHeaders(v.ResponseHeaders); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
 
-		// Ensure paths are backed up by a file
-		// fmt.Println(v.Path)
+	if err := validateHead(v.Head); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.validateOnFailure(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+
+	if err := v.ServeOnce.Validate(); err != nil {
+		return errors.Wrap(err, v.Path)
+	}
+	if v.ServeOnce.Enabled() && (!strings.HasSuffix(v.Path, "/*") || v.HostedFile == "") {
+		return errors.New(v.Path + ": serve_once requires a path ending in /* and a hosted_file")
 	}
 
 	return nil
@@ -184,6 +482,9 @@ func (paths *Paths) validate(pathList []*Path) error {
 
 // Reload refreshes the list of paths internally to Paths
 func (paths *Paths) Reload() error {
+	paths.reloadMu.Lock()
+	defer paths.reloadMu.Unlock()
+
 	pathsList, err := paths.ingestPathList()
 	if err != nil {
 		return err
@@ -193,13 +494,123 @@ func (paths *Paths) Reload() error {
 		return err
 	}
 
+	queues := make(map[string]*Queue)
+	for _, v := range pathsList {
+		if !v.Queue.Enabled() {
+			continue
+		}
+		// Keep queues with unchanged configuration so in-flight requests are still counted
+		if old, ok := paths.queues[v.Path]; ok && old.conf == v.Queue {
+			queues[v.Path] = old
+			continue
+		}
+		queues[v.Path] = NewQueue(v.Queue)
+	}
+
+	paths.listMu.Lock()
 	paths.list = pathsList
+	paths.queues = queues
+	paths.listMu.Unlock()
+
+	var modified time.Time
+	if info, err := os.Stat(paths.pathsList); err == nil {
+		modified = info.ModTime()
+	}
+	paths.state.SetRulesModified(modified)
 
 	return nil
 }
 
+// ErrPathNotFound is returned when a path is not in the path list
+var ErrPathNotFound = errors.New("path not found")
+
+// ReloadPath reloads the path uri from the path list immediately, without
+// reloading the other paths. The path and its hosted file are validated first,
+// and only validated when dryRun is set. A path removed from the path list is
+// removed, which returns a nil Path
+func (paths *Paths) ReloadPath(uri string, dryRun bool) (*Path, error) {
+	paths.reloadMu.Lock()
+	defer paths.reloadMu.Unlock()
+
+	pathsList, err := paths.ingestPathList()
+	if err != nil {
+		return nil, err
+	}
+
+	var reloaded *Path
+	for _, v := range pathsList {
+		if v.Path == uri {
+			reloaded = v
+			break
+		}
+	}
+
+	current := -1
+	for i, v := range paths.pathList() {
+		if v.Path == uri {
+			current = i
+			break
+		}
+	}
+
+	if reloaded == nil && current == -1 {
+		return nil, ErrPathNotFound
+	}
+	if reloaded != nil {
+		if err := validatePath(reloaded); err != nil {
+			return nil, err
+		}
+		if reloaded.HostedFile != "" && reloaded.ProxyHost == "" && reloaded.SourceURL == "" && len(reloaded.HoneyCredentials.Tokens) == 0 {
+			if _, err := os.Stat(path.Join(paths.base, reloaded.HostedFile)); err != nil {
+				return nil, errors.Wrap(err, uri)
+			}
+		}
+	}
+	if dryRun {
+		return reloaded, nil
+	}
+
+	list := make([]*Path, 0, len(paths.list)+1)
+	for i, v := range paths.pathList() {
+		if i != current {
+			list = append(list, v)
+		} else if reloaded != nil {
+			list = append(list, reloaded)
+		}
+	}
+	if current == -1 {
+		list = append(list, reloaded)
+	}
+
+	queues := make(map[string]*Queue, len(paths.queues))
+	for k, q := range paths.queues {
+		if k != uri {
+			queues[k] = q
+		}
+	}
+	if reloaded != nil && reloaded.Queue.Enabled() {
+		if old, ok := paths.queues[uri]; ok && old.conf == reloaded.Queue {
+			queues[uri] = old
+		} else {
+			queues[uri] = NewQueue(reloaded.Queue)
+		}
+	}
+
+	paths.listMu.Lock()
+	paths.list = list
+	paths.queues = queues
+	paths.listMu.Unlock()
+
+	if info, err := os.Stat(paths.pathsList); err == nil {
+		paths.state.SetRulesModified(info.ModTime())
+	}
+
+	return reloaded, nil
+}
+
 // Serve serves a page without checking conditionals
 func (paths *Paths) Serve(w http.ResponseWriter, req *http.Request) error {
+	req = normalizeRequest(req)
 	uri := req.URL.Path
 	targetPath, exists := paths.Match(uri)
 	if !exists {
@@ -214,12 +625,16 @@ func (paths *Paths) Serve(w http.ResponseWriter, req *http.Request) error {
 
 func getAllConditionals(uri string, paths *Paths, matchedPath *Path) (RequestConditions, error) {
 	target := matchedPath.Conditions
-	globalConditions, err := paths.getGlobalConditionals()
-	if err != nil {
-		return target, err
+	var globalConditions RequestConditions
+	if !matchedPath.IgnoreGlobal {
+		global, err := paths.getGlobalConditionals()
+		if err != nil {
+			return target, err
+		}
+		globalConditions = global
 	}
 
-	matchingConditions, err := paths.getMatchingConditionals(uri)
+	matchingConditions, err := paths.getMatchingConditionals(uri, matchedPath)
 	if err != nil {
 		return RequestConditions{}, err
 	}
@@ -227,10 +642,14 @@ func getAllConditionals(uri string, paths *Paths, matchedPath *Path) (RequestCon
 	return MergeRequestConditions(globalConditions, matchingConditions, target)
 }
 
-// getMatchingConditionals gets all conditions that apply to `uri` (since some paths can be globbed) and apply them to matchedPath.Conditions
-func (paths *Paths) getMatchingConditionals(uri string) (RequestConditions, error) {
+// getMatchingConditionals gets all conditions that apply to `uri` (since some paths can be globbed) and apply them to matchedPath.Conditions.
+// matchedPath is skipped since its conditions are merged last, and merging them twice would repeat their lists
+func (paths *Paths) getMatchingConditionals(uri string, matchedPath *Path) (RequestConditions, error) {
 	conditions := make([]RequestConditions, 0)
-	for _, path := range paths.list {
+	for _, path := range paths.pathList() {
+		if path == matchedPath {
+			continue
+		}
 		g := glob.MustCompile(path.Path, '/')
 		if g.Match(uri) {
 			conditions = append(conditions, path.Conditions)
@@ -239,24 +658,36 @@ func (paths *Paths) getMatchingConditionals(uri string) (RequestConditions, erro
 	return MergeRequestConditions(conditions...)
 }
 
-// getGlobalConditionals gets all conditions from the paths.globalConditionsPath
+// getGlobalConditionals gets all conditions from the paths.globalConditionsPath, merged
+// over the global_conditions of the configuration
 func (paths *Paths) getGlobalConditionals() (RequestConditions, error) {
-	var empty RequestConditions
+	paths.globalMu.RLock()
+	configured := paths.globalConditions
+	paths.globalMu.RUnlock()
+
 	gcp := paths.globalConditionsPath
 	if gcp == "" {
-		return empty, nil
+		return configured, nil
 	}
 
 	if f, err := os.Stat(gcp); err != nil || !f.IsDir() {
-		return empty, nil
+		return configured, nil
 	}
 
 	globalConditions, err := paths.collectConditionalsDirectory(gcp)
 	if err != nil {
-		return empty, err
+		return RequestConditions{}, err
 	}
 
-	return globalConditions, nil
+	return MergeRequestConditions(configured, globalConditions)
+}
+
+// SetGlobalConditions sets the conditions merged beneath the conditions of every
+// path which does not set ignore_global
+func (paths *Paths) SetGlobalConditions(conditions RequestConditions) {
+	paths.globalMu.Lock()
+	defer paths.globalMu.Unlock()
+	paths.globalConditions = conditions
 }
 
 // MatchAndServe matches a path, determines if the path should be served, and serves the file based on an HTTP request. If a failure occurs, this function will serve failed pages.
@@ -265,30 +696,127 @@ func (paths *Paths) getGlobalConditionals() (RequestConditions, error) {
 //
 // Returns true when the file was served and false when a 404 page should be returned
 func (paths *Paths) MatchAndServe(w http.ResponseWriter, req *http.Request) (bool, error) {
+	req = normalizeRequest(req)
 	uri := req.URL.Path
 
 	matchedPath, exists := paths.Match(uri)
 	if !exists {
-		return false, nil
+		return paths.webdavCollection(w, req)
 	}
 
-	conditions, err := getAllConditionals(uri, paths, matchedPath)
+	if matchedPath.CaptureClientHello {
+		paths.state.Captures().Add(matchedPath.Path, req)
+	}
+
+	if matchedPath.Canary {
+		log.WithFields(log.Fields{
+			"path": matchedPath.Path,
+			"ip":   req.RemoteAddr,
+		}).Warn("Canary path requested")
+		canaryHits.With(matchedPath.Path).Inc()
+	}
+
+	// Honey credentials are always detected, even when conditions fail
+	if matchedPath.HoneyLogin && paths.honeyLogin(w, req, matchedPath) {
+		return true, nil
+	}
+
+	if req.Method == http.MethodHead && matchedPath.Head == HeadMirror {
+		req = headAsGet(req)
+	} else if req.Method == http.MethodHead && matchedPath.Head != "" {
+		return paths.answerHead(w, req, matchedPath), nil
+	}
+
+	if queue, ok := paths.queue(matchedPath.Path); ok {
+		if !queue.Acquire() {
+			log.WithFields(log.Fields{
+				"path": matchedPath.Path,
+				"ip":   req.RemoteAddr,
+			}).Warn("Admission queue full")
+			queueRejected.With(matchedPath.Path).Inc()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true, nil
+		}
+		defer queue.Release()
+	}
+
+	conditions, err := paths.pathConditionals(uri, matchedPath)
 	if err != nil {
 		return false, err
 	}
 
-	if conditions.ShouldHost(req, paths.state, paths.GeoipDB) {
-		paths.state.Hit(req)
-		if err := matchedPath.ServeHTTP(w, req, paths.base); err != nil {
+	// Clients are challenged until they send the domain they are joined to
+	if len(conditions.AuthorizedDomains) > 0 && ntlmExchange(w, req) {
+		return true, nil
+	}
+	// Clients are challenged until they send basic credentials
+	if conditions.basicAuthEnabled() && basicAuthChallenge(w, req, conditions) {
+		return true, nil
+	}
+
+	req, response := withScriptResponse(req)
+	decision, hit, err := paths.decideAndRecord(w, req, matchedPath, conditions)
+	if err != nil {
+		return false, err
+	}
+	if decision == DecisionServed {
+		if hit {
+			paths.notify(matchedPath, req, "served")
+		}
+		if urls := paths.issueURLs(req, matchedPath); urls != nil {
+			issuer := *matchedPath
+			issuer.issued = urls
+			matchedPath = &issuer
+		}
+		if matchedPath.Template {
+			templated := *matchedPath
+			templated.templateData = paths.templateData(req)
+			matchedPath = &templated
+		}
+		if answered, err := response.answer(w); answered || err != nil {
+			return answered, err
+		}
+		paths.writeResponseHeaders(w)
+		if err := matchedPath.ServeHTTP(paths.campaigns.writer(w, matchedPath.Campaign), req, paths.base); err != nil {
 			return false, err
 		}
 		return true, nil
 	}
 
+	if decision == DecisionRateLimited {
+		return rateLimitAction(w, req, conditions), nil
+	}
+
+	paths.notify(matchedPath, req, "denied")
+	paths.forward(matchedPath, req, "denied")
+
+	if answered, err := response.answer(w); answered || err != nil {
+		return answered, err
+	}
+
+	// Probes with blacklisted methods get a plain status rather than the failure page
+	if conditions.BlacklistMethodsStatus != 0 && !conditions.blacklistMethods(req) {
+		w.WriteHeader(conditions.BlacklistMethodsStatus)
+		return true, nil
+	}
+
 	if matchedPath.FailRedirect(w, req) {
 		return true, nil
 	}
 
+	if matchedPath.FailStatus(w) {
+		return true, nil
+	}
+
+	if proxied, err := matchedPath.FailProxy(w, req); proxied || err != nil {
+		return proxied, err
+	}
+
+	if served, err := matchedPath.FailFile(w, req, paths.base); served || err != nil {
+		return served, err
+	}
+
 	matched, err := matchedPath.FailRender(w, req, func(uri string) *Path {
 		newPath, found := paths.Match(matchedPath.OnFailure.Render)
 		if !found {
@@ -301,3 +829,252 @@ func (paths *Paths) MatchAndServe(w http.ResponseWriter, req *http.Request) (boo
 	}
 	return matched, nil
 }
+
+// rateLimitAction answers a request exceeding the rate limit of conditions.
+// It returns false when not_found should be served
+func rateLimitAction(w http.ResponseWriter, req *http.Request, conditions RequestConditions) bool {
+	switch conditions.RateLimit.Action {
+	case RateLimitRedirect:
+		http.Redirect(w, req, conditions.RateLimit.Redirect, http.StatusFound)
+		return true
+	case RateLimitTarpit:
+		tarpit, err := time.ParseDuration(conditions.RateLimit.Tarpit)
+		if err != nil {
+			tarpit = 10 * time.Second
+		}
+		select {
+		case <-time.After(tarpit):
+		case <-req.Context().Done():
+		}
+	}
+	return false
+}
+
+// pathConditionals gets the conditions applied to matchedPath when it is requested as uri
+func (paths *Paths) pathConditionals(uri string, matchedPath *Path) (RequestConditions, error) {
+	conditions, err := getAllConditionals(uri, paths, matchedPath)
+	if err != nil {
+		return conditions, err
+	}
+
+	if promoted := paths.state.Promoted(matchedPath.Path); !promoted.Empty() {
+		conditions.AuthorizedJA3 = append(append([]string(nil), conditions.AuthorizedJA3...), promoted.JA3...)
+		conditions.AuthorizedJA4 = append(append([]string(nil), conditions.AuthorizedJA4...), promoted.JA4...)
+		conditions.AuthorizedHeaderOrder = append(append([]string(nil), conditions.AuthorizedHeaderOrder...), promoted.HeaderOrder...)
+	}
+
+	// Updaters download the binary right after fetching the manifest
+	if matchedPath.Update.Enabled() && uri == matchedPath.Update.BinaryPath {
+		conditions.PrereqPaths = append(append([]string(nil), conditions.PrereqPaths...), matchedPath.Path)
+	}
+
+	// Learning paths record fingerprints rather than enforcing them
+	if matchedPath.Learning {
+		conditions.AuthorizedJA3 = nil
+		conditions.AuthorizedJA3Raw = nil
+		conditions.AuthorizedJA4 = nil
+		conditions.AuthorizedHeaderOrder = nil
+	}
+
+	return conditions, nil
+}
+
+// Decisions made for a request to a path
+const (
+	DecisionServed      = "served"
+	DecisionDenied      = "denied"
+	DecisionRateLimited = "rate_limited"
+)
+
+// requestTimeKey is the context key of the time a request is decided at
+type requestTimeKey struct{}
+
+// withRequestTime decides req as if it was made at t
+func withRequestTime(req *http.Request, t time.Time) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestTimeKey{}, t))
+}
+
+// requestTime gets the time req is decided at, which is now unless it is replayed
+func requestTime(req *http.Request) time.Time {
+	if t, ok := req.Context().Value(requestTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// serves applies conditions, serve once URLs, and the campaign quotas to req for
+// matchedPath, in that order so quotas are only charged for requests which are served
+func (paths *Paths) serves(req *http.Request, matchedPath *Path, conditions RequestConditions) bool {
+	if !conditions.ShouldHost(req, paths.state, paths.GeoIP()) {
+		return false
+	}
+	restore, ok := paths.redeemURL(req, matchedPath)
+	if !ok {
+		return false
+	}
+	if !paths.campaigns.Serve(matchedPath.Campaign, requestTime(req)) {
+		restore()
+		return false
+	}
+	return true
+}
+
+// decide applies conditions, serve once URLs, and the campaign quotas to req for
+// matchedPath. Denials are recorded and count towards sticky_deny. It returns
+// served, rate_limited, or denied
+func (paths *Paths) decide(req *http.Request, matchedPath *Path, conditions RequestConditions) string {
+	if paths.serves(req, matchedPath, conditions) {
+		if matchedPath.Learning {
+			paths.state.Profiles().Record(matchedPath.Path, req)
+		}
+		return DecisionServed
+	}
+
+	if conditions.RateLimit.Requests != 0 && paths.state.RateLimited(rateLimitKey(req)) {
+		paths.state.Hits().Add(req, DecisionRateLimited, paths.GeoIP())
+		return DecisionRateLimited
+	}
+
+	paths.state.Hits().Add(req, DecisionDenied, paths.GeoIP())
+	if conditions.StickyDeny != 0 {
+		if err := paths.state.Deny(parseRemoteAddr(req.RemoteAddr).String()); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Debug("Unable to record denial")
+		}
+	}
+	return DecisionDenied
+}
+
+// decideAndRecord makes the decision for req and records it when it is served.
+// WebDAV clients look up a file before downloading it, which is not a hit
+func (paths *Paths) decideAndRecord(w http.ResponseWriter, req *http.Request, matchedPath *Path, conditions RequestConditions) (decision string, hit bool, err error) {
+	paths.recordMu.RLock()
+	defer paths.recordMu.RUnlock()
+	if conditions.serveLimited() {
+		defer paths.state.LockCounter(conditions.counter(req))()
+	}
+
+	decision = paths.decide(req, matchedPath, conditions)
+	if decision != DecisionServed || matchedPath.webdavMetadata(req) {
+		return decision, false, nil
+	}
+	if paths.sessionPrereqs() {
+		if err := issuePrereqSession(w, req); err != nil {
+			return decision, false, err
+		}
+	}
+	paths.hit(req, conditions)
+	paths.state.Hits().AddServed(req, paths.state.Enrich(req, paths.GeoIP()))
+	return decision, true, nil
+}
+
+// Decide makes the decision MatchAndServe would make for req at now without
+// serving it or notifying anyone. Decisions are recorded so serve limits, quotas,
+// and sticky_deny behave like live traffic. It returns the matched path, or nil
+// when no path matches, and the decision
+func (paths *Paths) Decide(req *http.Request, now time.Time) (*Path, string, error) {
+	req = withRequestTime(normalizeRequest(req), now)
+	matchedPath, exists := paths.Match(req.URL.Path)
+	if !exists {
+		return nil, "", nil
+	}
+
+	conditions, err := paths.pathConditionals(req.URL.Path, matchedPath)
+	if err != nil {
+		return matchedPath, "", err
+	}
+
+	paths.recordMu.RLock()
+	defer paths.recordMu.RUnlock()
+	if conditions.serveLimited() {
+		defer paths.state.LockCounter(conditions.counter(req))()
+	}
+	decision := paths.decide(req, matchedPath, conditions)
+	if decision == DecisionServed && !matchedPath.webdavMetadata(req) {
+		paths.hit(req, conditions)
+		paths.state.Hits().Add(req, DecisionServed, paths.GeoIP())
+	}
+	return matchedPath, decision, nil
+}
+
+// hit records that req was served, globally and for the client limits in conditions
+func (paths *Paths) hit(req *http.Request, conditions RequestConditions) {
+	if err := paths.state.Hit(req); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Unable to record hit")
+	}
+	if conditions.CounterGroup != "" {
+		if err := paths.state.HitGroup(conditions.CounterGroup); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"group": conditions.CounterGroup,
+			}).Debug("Unable to record counter group hit")
+		}
+	}
+	for key := range conditions.ClientKeys(req) {
+		if err := paths.state.HitClient(conditions.counter(req), key); err != nil {
+			log.WithFields(log.Fields{
+				"error":  err,
+				"client": key,
+			}).Debug("Unable to record client hit")
+		}
+	}
+}
+
+// notify sends the path's notification in the background
+func (paths *Paths) notify(matchedPath *Path, req *http.Request, decision string) {
+	if !matchedPath.Notify.Enabled() || !paths.campaigns.Notify(matchedPath.Campaign) {
+		return
+	}
+
+	conf := matchedPath.Notify
+	uri := req.URL.Path
+	ip := parseRemoteAddr(req.RemoteAddr)
+	go func() {
+		if _, err := paths.notifier.Notify(conf, uri, ip, decision); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  uri,
+			}).Error("Unable to send notification")
+		}
+	}()
+}
+
+// notifyApproval sends the operator approve and deny links for a queued approval
+func (paths *Paths) notifyApproval(a Approval) {
+	matchedPath, exists := paths.Match(a.Path)
+	if !exists || !matchedPath.Notify.Enabled() {
+		log.WithFields(log.Fields{
+			"id":   a.ID,
+			"ip":   a.IP,
+			"path": a.Path,
+		}).Warn("Request waiting on approval without a notify webhook")
+		return
+	}
+
+	alert := notify.Alert{
+		Text:     fmt.Sprintf("%s requested %s and is waiting on approval (id %s)", a.IP, a.Path, a.ID),
+		Path:     a.Path,
+		IP:       a.IP,
+		Decision: ApprovalPending,
+	}
+	if paths.approvalURL != "" {
+		link := fmt.Sprintf("%s/approvals/decide?id=%s&key=%s&action=", paths.approvalURL, a.ID, a.Key)
+		alert.Links = map[string]string{
+			"approve": link + "approve",
+			"deny":    link + "deny",
+		}
+	}
+
+	conf := matchedPath.Notify
+	go func() {
+		if err := paths.notifier.Send(conf, alert); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  a.Path,
+			}).Error("Unable to send approval notification")
+		}
+	}()
+}
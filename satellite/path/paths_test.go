@@ -1,13 +1,23 @@
 package path_test
 
 import (
+	stdtls "crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
+	stdhttp "net/http"
+	stdhttptest "net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
 	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/metrics"
 	. "github.com/t94j0/satellite/satellite/path"
 )
 
@@ -297,6 +307,104 @@ func TestPaths_MatchAndServe_file_failure_redirect(t *testing.T) {
 	}
 }
 
+func TestPaths_MatchAndServe_failure_routes(t *testing.T) {
+	origin := stdhttptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {
+		io.WriteString(w, "origin "+req.URL.Path)
+	}))
+	defer origin.Close()
+
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreateFile("cover.html", "<html>cover</html>")
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /status
+  hosted_file: /index.html
+  authorized_useragents: [none]
+  on_failure:
+    status: 503
+- path: /proxy
+  hosted_file: /index.html
+  authorized_useragents: [none]
+  on_failure:
+    proxy: %s
+- path: /file
+  hosted_file: /index.html
+  authorized_useragents: [none]
+  on_failure:
+    file: /cover.html`, origin.URL))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/status", 503, ""},
+		{"/proxy", 200, "origin /proxy"},
+		{"/file", 200, "<html>cover</html>"},
+	} {
+		w := httptest.NewRecorder()
+		didMatch, err := paths.MatchAndServe(w, httptest.NewRequest("GET", tc.uri, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !didMatch || w.Code != tc.status || w.Body.String() != tc.body {
+			t.Errorf("%s: expected %d %q, got %t %d %q", tc.uri, tc.status, tc.body, didMatch, w.Code, w.Body.String())
+		}
+	}
+
+	tmpdir.CreatePathList("- path: /status\n  on_failure:\n    status: 999")
+	if _, err := NewDefaultTest(tmpdir.Path); err == nil {
+		t.Error("invalid on_failure status was accepted")
+	}
+}
+
+func TestPaths_MatchAndServe_rate_limit_redirect(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	pathData := `- path: /index.html
+  hosted_file: /index.html
+  rate_limit:
+    requests: 1
+    per: 1h
+    action: redirect
+    redirect: https://aws.amazon.com`
+	tmpdir.CreatePathList(pathData)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w
+	}
+
+	if w := request(); w.Code != 200 {
+		t.Error("first request was limited")
+	}
+	if w := request(); w.Code != 302 || w.Header().Get("Location") != "https://aws.amazon.com" {
+		t.Error("limited request was not redirected")
+	}
+}
+
 func TestPaths_MatchAndServe_file_failure_render(t *testing.T) {
 	// Create project directory
 	tmpdir, err := NewTempDir()
@@ -636,6 +744,259 @@ func TestPaths_MatchAndServe_glob_extensions_block(t *testing.T) {
 	}
 }
 
+func TestPaths_MatchAndServe_blacklist_methods(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	pathList := `- path: /second.html
+  blacklist_methods: [OPTIONS, TRACE]
+  blacklist_methods_status: 405
+- path: /testdir1/first.html
+  blacklist_methods: [HEAD]`
+	tmpdir.CreatePathList(pathList)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		method, uri string
+		matched     bool
+		status      int
+	}{
+		{"GET", "/second.html", true, 200},
+		{"OPTIONS", "/second.html", true, 405},
+		{"trace", "/second.html", true, 405},
+		{"HEAD", "/testdir1/first.html", false, 200},
+		{"GET", "/testdir1/first.html", true, 200},
+	} {
+		req := httptest.NewRequest(tc.method, tc.uri, nil)
+		w := httptest.NewRecorder()
+		didMatch, err := paths.MatchAndServe(w, req)
+		if err != nil {
+			t.Error(err)
+		}
+		if didMatch != tc.matched || w.Code != tc.status {
+			t.Errorf("%s %s: expected %t %d, got %t %d", tc.method, tc.uri, tc.matched, tc.status, didMatch, w.Code)
+		}
+	}
+}
+
+func TestPaths_MatchAndServe_counter_group(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	pathList := `- path: /second.html
+  serve: 2
+  counter_group: mirrors
+- path: /testdir1/first.html
+  serve: 2
+  counter_group: mirrors`
+	tmpdir.CreatePathList(pathList)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Both mirrors count toward the same two serves
+	for i, tc := range []struct {
+		uri     string
+		matched bool
+	}{
+		{"/second.html", true},
+		{"/testdir1/first.html", true},
+		{"/second.html", false},
+		{"/testdir1/first.html", false},
+	} {
+		req := httptest.NewRequest("GET", tc.uri, nil)
+		didMatch, err := paths.MatchAndServe(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Error(err)
+		}
+		if didMatch != tc.matched {
+			t.Errorf("request %d to %s: expected %t, got %t", i, tc.uri, tc.matched, didMatch)
+		}
+	}
+}
+
+// slowAuthorizer allows every request after holding it between checking and
+// charging its serve limits
+func slowAuthorizer() *stdhttptest.Server {
+	return stdhttptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, `{"allow": true}`)
+	}))
+}
+
+// serveConcurrently requests every uri at once and counts the requests served
+func serveConcurrently(t *testing.T, paths *Paths, uris ...string) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served := 0
+	for _, uri := range uris {
+		wg.Add(1)
+		go func(uri string) {
+			defer wg.Done()
+			didMatch, err := paths.MatchAndServe(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil))
+			if err != nil {
+				t.Error(err)
+			}
+			if didMatch {
+				mu.Lock()
+				served++
+				mu.Unlock()
+			}
+		}(uri)
+	}
+	wg.Wait()
+	return served
+}
+
+func TestPaths_MatchAndServe_serve_per_ip_concurrent(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	authorizer := slowAuthorizer()
+	defer authorizer.Close()
+
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /second.html
+  serve_per_ip: 3
+  external_auth:
+    url: %s`, authorizer.URL))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uris := make([]string, 10)
+	for i := range uris {
+		uris[i] = "/second.html"
+	}
+	if served := serveConcurrently(t, paths, uris...); served != 3 {
+		t.Errorf("expected 3 concurrent requests served, got %d", served)
+	}
+}
+
+func TestPaths_MatchAndServe_counter_group_concurrent(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	authorizer := slowAuthorizer()
+	defer authorizer.Close()
+
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /second.html
+  serve: 3
+  counter_group: mirrors
+  external_auth:
+    url: %[1]s
+- path: /testdir1/first.html
+  serve: 3
+  counter_group: mirrors
+  external_auth:
+    url: %[1]s`, authorizer.URL))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uris := make([]string, 10)
+	for i := range uris {
+		uris[i] = "/second.html"
+		if i%2 == 1 {
+			uris[i] = "/testdir1/first.html"
+		}
+	}
+	if served := serveConcurrently(t, paths, uris...); served != 3 {
+		t.Errorf("expected 3 concurrent requests to the group served, got %d", served)
+	}
+}
+
+func TestPaths_MatchAndServe_prereq_session(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(`- path: /second.html
+- path: /testdir1/first.html
+  prereq: [/second.html]
+  prereq_key: session`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both clients share an IP, but only the first was served the prereq
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, httptest.NewRequest("GET", "/second.html", nil)); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != PrereqSessionCookie {
+		t.Fatal("client was not issued a session")
+	}
+
+	req := httptest.NewRequest("GET", "/testdir1/first.html", nil)
+	if didMatch, _ := paths.MatchAndServe(httptest.NewRecorder(), req); didMatch {
+		t.Error("client without a session satisfied the prereqs of another")
+	}
+
+	req = httptest.NewRequest("GET", "/testdir1/first.html", nil)
+	req.AddCookie(cookies[0])
+	if didMatch, _ := paths.MatchAndServe(httptest.NewRecorder(), req); !didMatch {
+		t.Error("client with a session did not satisfy its prereqs")
+	}
+}
+
+func TestPaths_MatchAndServe_global_conditions(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(`- path: /second.html
+- path: /testdir1/first.html
+  ignore_global: true`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, err := NewRequestConditions([]byte("blacklist_iprange: [192.0.2.0/24]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths.SetGlobalConditions(global)
+
+	for _, tc := range []struct {
+		uri     string
+		matched bool
+	}{
+		{"/second.html", false},
+		{"/testdir1/first.html", true},
+	} {
+		req := httptest.NewRequest("GET", tc.uri, nil)
+		if didMatch, _ := paths.MatchAndServe(httptest.NewRecorder(), req); didMatch != tc.matched {
+			t.Errorf("%s: expected matched %t, got %t", tc.uri, tc.matched, didMatch)
+		}
+	}
+}
+
 func TestPaths_MatchAndServe_glob_extensions_block_multiple(t *testing.T) {
 	tmpdir, err := buildTestEnv()
 	if err != nil {
@@ -721,6 +1082,152 @@ func TestPaths_MatchAndServe_jlob_directory(t *testing.T) {
 	}
 }
 
+func TestPaths_ReloadPath(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(`- path: /second.html
+  not_serving: true
+- path: /testdir1/first.html`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir.CreatePathList(`- path: /second.html
+- path: /testdir1/first.html
+  not_serving: true
+- path: /bad.html
+  authorized_useragents: ["("]
+- path: /missing.html
+  hosted_file: /missing.html`)
+
+	// Invalid paths are not reloaded
+	for _, uri := range []string{"/bad.html", "/missing.html"} {
+		if _, err := paths.ReloadPath(uri, false); err == nil {
+			t.Errorf("%s was reloaded", uri)
+		}
+	}
+	if _, err := paths.ReloadPath("/unknown.html", false); err != ErrPathNotFound {
+		t.Errorf("expected ErrPathNotFound, got %v", err)
+	}
+
+	// Validating does not reload
+	if _, err := paths.ReloadPath("/second.html", true); err != nil {
+		t.Error(err)
+	}
+	if p, _ := paths.Match("/second.html"); !p.Conditions.NotServing {
+		t.Error("validated path was reloaded")
+	}
+
+	// Only the requested path is reloaded
+	if _, err := paths.ReloadPath("/second.html", false); err != nil {
+		t.Error(err)
+	}
+	if p, _ := paths.Match("/second.html"); p.Conditions.NotServing {
+		t.Error("path was not reloaded")
+	}
+	if p, _ := paths.Match("/testdir1/first.html"); p.Conditions.NotServing {
+		t.Error("other path was reloaded")
+	}
+
+	// Paths removed from the path list are removed
+	tmpdir.CreatePathList(`- path: /testdir1/first.html`)
+	if p, err := paths.ReloadPath("/second.html", false); err != nil || p != nil {
+		t.Errorf("path was not removed: %v", err)
+	}
+	if paths.Len() != 1 {
+		t.Errorf("expected 1 path, got %d", paths.Len())
+	}
+}
+
+func TestPaths_ReloadPath_concurrent(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(`- path: /second.html
+  hosted_file: /second.html
+- path: /testdir1/first.html
+  hosted_file: /testdir1/first.html
+  queue:
+    concurrency: 2`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				switch i {
+				case 0:
+					paths.Reload()
+				case 1:
+					paths.ReloadPath("/second.html", false)
+				default:
+					req := httptest.NewRequest("GET", "/testdir1/first.html", nil)
+					paths.MatchAndServe(httptest.NewRecorder(), req)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if paths.Len() != 2 {
+		t.Errorf("expected 2 paths, got %d", paths.Len())
+	}
+}
+
+func TestPaths_SelfTest(t *testing.T) {
+	tmpdir, err := buildTestEnv()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateFile("script.sh", "#!/bin/sh\necho ok")
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /second.html
+  exec:
+    script: %s
+    output: ok
+- path: /testdir1/first.html
+  exec:
+    script: %s
+    output: ok`, filepath.Join(tmpdir.Path, "script.sh"), filepath.Join(tmpdir.Path, "missing.sh")))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := make(map[string]bool)
+	for _, c := range paths.SelfTest() {
+		if !c.OK() {
+			failed[filepath.Base(c.Target)] = c.Critical
+		}
+	}
+	if !failed["script.sh"] || !failed["missing.sh"] {
+		t.Errorf("unusable scripts passed: %v", failed)
+	}
+
+	if err := os.Chmod(filepath.Join(tmpdir.Path, "script.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range paths.SelfTest() {
+		if !c.OK() && filepath.Base(c.Target) != "missing.sh" {
+			t.Errorf("%s %s failed: %s", c.Name, c.Target, c.Error)
+		}
+	}
+}
+
 func TestPaths_Reload_globalconditionals_makeNone(t *testing.T) {
 	serverRoot, err := NewTempDir()
 	if err != nil {
@@ -837,3 +1344,527 @@ func TestPaths_Reload_globalconditionals_two(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestPaths_MatchAndServe_honey_credentials(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("login.html", Sentinal)
+	tmpdir.CreatePathList(`- path: /.env
+  honey_credentials:
+    tokens:
+      - AKIAHONEYTOKEN
+- path: /login.html
+  honey_login: true`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Credentials are served without a backing file
+	req := httptest.NewRequest("GET", "/.env", nil)
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() != "AKIAHONEYTOKEN\n" {
+		t.Error("honey credentials were not served:", w.Body.String())
+	}
+
+	// Login without honey credentials
+	req = httptest.NewRequest("POST", "/login.html", strings.NewReader("user=admin&password=admin"))
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Code != 200 || w.Body.String() != Sentinal {
+		t.Error("login page should have been served")
+	}
+
+	// Login with honey credentials
+	req = httptest.NewRequest("POST", "/login.html", strings.NewReader("key=AKIAHONEYTOKEN"))
+	w = httptest.NewRecorder()
+	served, err := paths.MatchAndServe(w, req)
+	if err != nil {
+		t.Error(err)
+	}
+	if !served || w.Code != 401 {
+		t.Error("honey credentials should have been rejected")
+	}
+}
+
+func TestPaths_MatchAndServe_learning(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /payload
+  hosted_file: payload
+  learning: true
+  authorized_ja3:
+    - 00000000000000000000000000000000`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Learning paths do not enforce authorized_ja3
+	req := httptest.NewRequest("GET", "/payload", nil)
+	req.JA3Fingerprint = "771,4865,0,29,0"
+	req.HeaderOrder = []string{"Host", "User-Agent"}
+	served, err := paths.MatchAndServe(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Error(err)
+	}
+	if !served {
+		t.Error("learning path should have been served")
+	}
+
+	profiles := paths.Profiles().List()
+	if len(profiles) != 1 || profiles[0].Path != "/payload" || profiles[0].Count != 1 || profiles[0].HeaderOrder != "Host,User-Agent" {
+		t.Fatal("profile was not learned")
+	}
+
+	if _, err := paths.Promote("missing"); err != ErrProfileNotFound {
+		t.Error("promoted a missing profile")
+	}
+	if _, err := paths.Promote(profiles[0].ID); err != nil {
+		t.Error(err)
+	}
+
+	// Promoted fingerprints are enforced once learning is turned off
+	tmpdir.CreatePathList(`- path: /payload
+  hosted_file: payload
+  authorized_ja3:
+    - 00000000000000000000000000000000`)
+	if err := paths.Reload(); err != nil {
+		t.Error(err)
+	}
+
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() != Sentinal {
+		t.Error("promoted fingerprint was not authorized")
+	}
+
+	req.JA3Fingerprint = "771,4866,0,29,0"
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() == Sentinal {
+		t.Error("unknown fingerprint was authorized")
+	}
+
+	// The promoted header order is enforced too
+	req.JA3Fingerprint = "771,4865,0,29,0"
+	req.HeaderOrder = []string{"User-Agent", "Host"}
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() == Sentinal {
+		t.Error("unknown header order was authorized")
+	}
+
+	promoted := paths.Promoted()["/payload"]
+	if len(promoted.JA3) != 1 || len(promoted.HeaderOrder) != 1 || len(promoted.JA4) != 0 {
+		t.Fatal("promoted fingerprints were not listed:", promoted)
+	}
+	if err := paths.Demote("/payload", promoted); err != nil {
+		t.Error(err)
+	}
+	if len(paths.Promoted()) != 0 {
+		t.Error("fingerprints were not demoted")
+	}
+
+	req.HeaderOrder = []string{"Host", "User-Agent"}
+	w = httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Body.String() == Sentinal {
+		t.Error("demoted fingerprint was authorized")
+	}
+}
+
+func TestPaths_MatchAndServe_http2(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fingerprint" {
+			io.WriteString(w, req.HTTP2Fingerprint)
+			return
+		}
+		if served, _ := paths.MatchAndServe(w, req); !served {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(client *stdhttp.Client, uri string) (*stdhttp.Response, string) {
+		resp, err := client.Get(server.URL + uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	h2Client := &stdhttp.Client{Transport: &stdhttp.Transport{
+		TLSClientConfig:   &stdtls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, fingerprint := get(h2Client, "/fingerprint")
+	if resp.ProtoMajor != 2 || len(strings.Split(fingerprint, "|")) != 4 {
+		t.Fatalf("invalid HTTP/2 fingerprint %q over %s", fingerprint, resp.Proto)
+	}
+
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /payload
+  hosted_file: payload
+  authorized_http2_fingerprint:
+    - "%s"`, fingerprint))
+	if err := paths.Reload(); err != nil {
+		t.Error(err)
+	}
+
+	if _, body := get(h2Client, "/payload"); body != Sentinal {
+		t.Error("authorized HTTP/2 client was not served")
+	}
+
+	h1Client := &stdhttp.Client{Transport: &stdhttp.Transport{
+		TLSClientConfig: &stdtls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}},
+	}}
+	if _, body := get(h1Client, "/payload"); body == Sentinal {
+		t.Error("HTTP/1 client was served")
+	}
+}
+
+func TestPaths_MatchAndServe_head(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathList(`- path: /default
+  hosted_file: /index.html
+  authorized_methods: [GET]
+- path: /mirror
+  hosted_file: /index.html
+  content_type: text/plain
+  authorized_methods: [GET]
+  head: mirror
+- path: /decoy
+  hosted_file: /index.html
+  head: decoy
+- path: /deny
+  hosted_file: /index.html
+  head: deny`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		uri     string
+		matched bool
+		status  int
+	}{
+		{"/default", false, http.StatusOK},
+		{"/mirror", true, http.StatusOK},
+		{"/decoy", false, http.StatusOK},
+		{"/deny", true, http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		didMatch, err := paths.MatchAndServe(w, httptest.NewRequest("HEAD", tc.uri, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if didMatch != tc.matched || w.Code != tc.status {
+			t.Errorf("%s: expected matched %t with %d, got %t with %d", tc.uri, tc.matched, tc.status, didMatch, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	paths.MatchAndServe(w, httptest.NewRequest("HEAD", "/mirror", nil))
+	if w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("mirrored HEAD did not get the GET headers: %v", w.Header())
+	}
+
+	tmpdir.CreatePathList("- path: /skip\n  head: skip")
+	if _, err := NewDefaultTest(tmpdir.Path); err == nil {
+		t.Error("invalid head was accepted")
+	}
+}
+
+func TestPaths_MatchAndServe_response_headers(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathListIndex(`content_type: text/plain
+  response_headers:
+    Content-Type: application/javascript
+    Access-Control-Allow-Origin: "*"`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := paths.SetResponseHeaders(map[string]string{"x-powered-by": "ASP.NET", "Access-Control-Allow-Origin": "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, httptest.NewRequest("GET", "/index.html", nil)); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"Content-Type":                "application/javascript",
+		"Access-Control-Allow-Origin": "*",
+		"X-Powered-By":                "ASP.NET",
+	} {
+		if got := w.Header()[name]; len(got) != 1 || got[0] != value {
+			t.Errorf("expected %s %q, got %q", name, value, got)
+		}
+	}
+
+	if err := paths.SetResponseHeaders(map[string]string{"Bad Header": "1"}); err == nil {
+		t.Error("invalid header name was accepted")
+	}
+	tmpdir.CreatePathListIndex("response_headers:\n    X-Split: \"a\\r\\nSet-Cookie: b\"")
+	if _, err := NewDefaultTest(tmpdir.Path); err == nil {
+		t.Error("invalid header value was accepted")
+	}
+}
+
+func TestPaths_MatchAndServe_template(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateFile("index.html", `{{.IP}} {{.Query.Get "id"}} {{.Hits}} {{len (randomHex 4)}}`)
+	tmpdir.CreatePathListIndex("template: true")
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"192.0.2.1 42 1 8", "192.0.2.1 42 2 8"} {
+		req := httptest.NewRequest("GET", "/index.html?id=42", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Fatal(err)
+		}
+		if w.Body.String() != expected {
+			t.Errorf("expected %q, got %q", expected, w.Body.String())
+		}
+	}
+
+	tmpdir.CreateFile("index.html", `{{.IP`)
+	if _, err := paths.MatchAndServe(httptest.NewRecorder(), httptest.NewRequest("GET", "/index.html", nil)); err == nil {
+		t.Error("template which does not parse was served")
+	}
+}
+
+func TestPaths_MatchAndServe_sticky_deny(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathListIndex("authorized_useragents: [^implant$]", "sticky_deny: 2")
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(ip, ua string) bool {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w.Body.String() == Sentinal
+	}
+
+	for i := 0; i < 2; i++ {
+		if serve("192.0.2.1", "scanner") {
+			t.Fatal("scanner was served")
+		}
+	}
+	if serve("192.0.2.1", "implant") {
+		t.Error("client denied twice was served with the right user agent")
+	}
+	if !serve("192.0.2.2", "implant") {
+		t.Error("client never denied was not served")
+	}
+}
+
+func TestPaths_MatchAndServe_canary(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathList(`- path: /canary.html
+  hosted_file: /index.html
+  canary: true
+  authorized_useragents: [none]`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := paths.MatchAndServe(httptest.NewRecorder(), httptest.NewRequest("GET", "/canary.html", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := metrics.Default.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `satellite_canary_hits_total{path="/canary.html"} 1`) {
+		t.Error("denied canary hit was not counted", out.String())
+	}
+}
+
+func TestPaths_MatchAndServe_source_url(t *testing.T) {
+	fetches := 0
+	origin := stdhttptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {
+		fetches++
+		io.WriteString(w, "remote "+req.URL.Path)
+	}))
+	defer origin.Close()
+
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /payload.bin
+  source_url: %s/payload.bin
+  source_cache: 1h
+  authorized_useragents: [^implant$]`, origin.URL))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(ua string) string {
+		req := httptest.NewRequest("GET", "/payload.bin", nil)
+		req.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Fatal(err)
+		}
+		return w.Body.String()
+	}
+
+	if body := serve("scanner"); body == "remote /payload.bin" {
+		t.Error("remote content was served to a denied client")
+	}
+	for i := 0; i < 2; i++ {
+		if body := serve("implant"); body != "remote /payload.bin" {
+			t.Errorf("unexpected body %q", body)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected the source to be fetched once, got %d", fetches)
+	}
+
+	// Cached content is served while the origin is down
+	origin.Close()
+	if body := serve("implant"); body != "remote /payload.bin" {
+		t.Errorf("cached content was not served, got %q", body)
+	}
+}
+
+func TestPaths_MatchAndServe_proxy(t *testing.T) {
+	upstreamHits := 0
+	upstream := stdhttptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, req *stdhttp.Request) {
+		upstreamHits++
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(stdhttp.StatusAccepted)
+		fmt.Fprintf(w, "%s %s %s %s", req.Method, req.URL.Path, req.Header.Get("Cookie"), body)
+	}))
+	defer upstream.Close()
+
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreatePathList(fmt.Sprintf(`- path: /api/*
+  proxy: %s
+  authorized_useragents: [^implant$]
+  response_headers:
+    Content-Type: text/html
+    X-Frame-Options: DENY`, upstream.URL))
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/submit", strings.NewReader("task output"))
+	req.Header.Set("User-Agent", "implant")
+	req.Header.Set("Cookie", "session=beacon")
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusAccepted || w.Body.String() != "POST /api/submit session=beacon task output" {
+		t.Errorf("unexpected proxied response %d %q", w.Code, w.Body.String())
+	}
+	if types := w.Header()["Content-Type"]; len(types) != 1 || types[0] != "application/octet-stream" {
+		t.Errorf("upstream Content-Type did not replace response_headers: %v", types)
+	}
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("response_headers the upstream did not send were dropped")
+	}
+
+	req = httptest.NewRequest("POST", "/api/submit", strings.NewReader("scan"))
+	if _, err := paths.MatchAndServe(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+	if upstreamHits != 1 {
+		t.Errorf("denied request reached the upstream, %d hits", upstreamHits)
+	}
+}
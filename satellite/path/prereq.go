@@ -0,0 +1,72 @@
+package path
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/t94j0/satellite/net/http"
+)
+
+// PrereqSessionCookie is the cookie satellite issues to clients so their prereqs can be keyed on their session
+const PrereqSessionCookie = "sessionid"
+
+// prereqKeys are what the prereqs of a client can be keyed on: its IP, a hash
+// of its IP, User-Agent, and JA3, or the session cookie issued by satellite
+var prereqKeys = map[string]bool{
+	"ip":          true,
+	"fingerprint": true,
+	"session":     true,
+}
+
+// prereqKey gets the key the hits of the client of req are kept under for
+// kind. It is empty when kind is session and req has no session cookie
+func prereqKey(kind string, req *http.Request) string {
+	ip := parseRemoteAddr(req.RemoteAddr).String()
+	switch kind {
+	case "session":
+		if cookie, err := req.Cookie(PrereqSessionCookie); err == nil && cookie.Value != "" {
+			return "session:" + cookie.Value
+		}
+		return ""
+	case "fingerprint":
+		sum := sha256.Sum256([]byte(ip + "|" + req.UserAgent() + "|" + req.JA3Fingerprint))
+		return "fingerprint:" + hex.EncodeToString(sum[:16])
+	}
+	return "ip:" + ip
+}
+
+// issuePrereqSession gives the client of req a session cookie when it has none.
+// The cookie is added to req so the hit of req is kept under the new session
+func issuePrereqSession(w http.ResponseWriter, req *http.Request) error {
+	if cookie, err := req.Cookie(PrereqSessionCookie); err == nil && cookie.Value != "" {
+		return nil
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	cookie := &http.Cookie{
+		Name:     PrereqSessionCookie,
+		Value:    hex.EncodeToString(id),
+		Path:     "/",
+		HttpOnly: true,
+	}
+	http.SetCookie(w, cookie)
+	req.AddCookie(cookie)
+	return nil
+}
+
+// sessionPrereqs returns true if any path keys its prereqs on the session cookie
+func (paths *Paths) sessionPrereqs() bool {
+	if global, err := paths.getGlobalConditionals(); err == nil && global.PrereqKey == "session" {
+		return true
+	}
+	for _, v := range paths.pathList() {
+		if v.Conditions.PrereqKey == "session" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package path
+
+// HostingProviders are the hosting providers usable in blacklist_hosting_providers
+var HostingProviders = []string{"aws", "azure", "digitalocean", "gcp", "oracle"}
+
+func isHostingProvider(name string) bool {
+	for _, p := range HostingProviders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
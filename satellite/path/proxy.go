@@ -0,0 +1,74 @@
+package path
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httputil"
+)
+
+// proxyFlushInterval is how often proxied responses are flushed to the client, so
+// long polls and chunked C2 responses stream instead of waiting for the whole body
+const proxyFlushInterval = 100 * time.Millisecond
+
+// proxyTransport is shared by every proxied request so connections to upstreams are
+// reused. Upstreams like C2 listeners often use self-signed certificates, so they are not verified
+var proxyTransport = &http.Transport{
+	TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// validateProxy ensures proxy is an http or https URL and is not combined with
+// options which transform hosted files
+func (f *Path) validateProxy() error {
+	if f.ProxyHost == "" {
+		return nil
+	}
+	u, err := url.ParseRequestURI(f.ProxyHost)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(fmt.Sprintf("%s is not a valid proxy", f.ProxyHost))
+	}
+	if f.Template || f.Keying.Enabled() || f.Padding.Enabled() {
+		return errors.New("proxy cannot be used with template, keying, or padding")
+	}
+	return nil
+}
+
+// Proxy executes a proxy
+func (f *Path) proxy(w http.ResponseWriter, req *http.Request) error {
+	return proxyTo(w, req, f.ProxyHost)
+}
+
+// proxyTo proxies req to the origin at target. Headers the upstream sends replace
+// the ones satellite set, like content_type or response_headers
+func proxyTo(w http.ResponseWriter, req *http.Request, target string) error {
+	proxyURL, err := url.ParseRequestURI(target)
+	if err != nil {
+		return err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(proxyURL)
+	proxy.Transport = proxyTransport
+	proxy.FlushInterval = proxyFlushInterval
+	proxy.ModifyResponse = func(res *http.Response) error {
+		for name := range res.Header {
+			w.Header().Del(name)
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(rw http.ResponseWriter, outreq *http.Request, err error) {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"upstream": target,
+			"path":     outreq.URL.Path,
+		}).Error("Unable to proxy request")
+		rw.WriteHeader(http.StatusBadGateway)
+	}
+	proxy.ServeHTTP(w, req)
+	return nil
+}
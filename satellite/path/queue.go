@@ -0,0 +1,101 @@
+package path
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/satellite/metrics"
+)
+
+var queueRejected = metrics.NewCounterVec("satellite_queue_rejected_total", "Requests rejected because a path's admission queue was full", "path")
+
+// QueueConfig limits how many requests to a path are handled at once
+type QueueConfig struct {
+	// Concurrency is the number of requests handled at once
+	Concurrency int `yaml:"concurrency"`
+	// Depth is the number of requests which wait for a free slot
+	Depth int `yaml:"depth"`
+	// Timeout is how long a request waits for a free slot. Requests wait until a slot is free when empty
+	Timeout string `yaml:"timeout"`
+}
+
+// Enabled returns true when the path has an admission queue
+func (c QueueConfig) Enabled() bool {
+	return c.Concurrency > 0
+}
+
+// Validate checks the queue configuration
+func (c QueueConfig) Validate() error {
+	if c.Concurrency < 0 || c.Depth < 0 {
+		return errors.New("queue concurrency and depth must not be negative")
+	}
+	if c.Depth > 0 && c.Concurrency == 0 {
+		return errors.New("queue depth requires concurrency")
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			return errors.Wrap(err, "invalid queue timeout")
+		}
+	}
+	return nil
+}
+
+// Queue admits a limited number of concurrent requests and holds a limited
+// number of waiting requests. Requests over both limits are rejected
+type Queue struct {
+	conf    QueueConfig
+	slots   chan struct{}
+	waiting int32
+	depth   int32
+	timeout time.Duration
+}
+
+// NewQueue creates an admission queue from its configuration
+func NewQueue(conf QueueConfig) *Queue {
+	timeout, err := time.ParseDuration(conf.Timeout)
+	if err != nil {
+		timeout = 0
+	}
+	return &Queue{
+		conf:    conf,
+		slots:   make(chan struct{}, conf.Concurrency),
+		depth:   int32(conf.Depth),
+		timeout: timeout,
+	}
+}
+
+// Acquire waits for a free slot. It returns false when the queue is full or
+// the timeout passed. Release must be called after a successful Acquire
+func (q *Queue) Acquire() bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt32(&q.waiting, 1) > q.depth {
+		atomic.AddInt32(&q.waiting, -1)
+		return false
+	}
+	defer atomic.AddInt32(&q.waiting, -1)
+
+	if q.timeout == 0 {
+		q.slots <- struct{}{}
+		return true
+	}
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Release frees the slot taken by Acquire
+func (q *Queue) Release() {
+	<-q.slots
+}
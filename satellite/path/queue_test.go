@@ -0,0 +1,51 @@
+package path_test
+
+import (
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestQueue_Acquire(t *testing.T) {
+	queue := NewQueue(QueueConfig{Concurrency: 1, Depth: 1, Timeout: "10ms"})
+
+	if !queue.Acquire() {
+		t.Fatal("first request was not admitted")
+	}
+
+	// The waiting request times out while the slot is held
+	if queue.Acquire() {
+		t.Error("request was admitted while the slot was held")
+	}
+
+	queue.Release()
+	if !queue.Acquire() {
+		t.Error("request was not admitted after release")
+	}
+	queue.Release()
+}
+
+func TestQueue_Acquire_full(t *testing.T) {
+	queue := NewQueue(QueueConfig{Concurrency: 1})
+
+	if !queue.Acquire() {
+		t.Fatal("first request was not admitted")
+	}
+	// Without a queue depth, requests over the concurrency are rejected immediately
+	if queue.Acquire() {
+		t.Error("request over the concurrency was admitted")
+	}
+	queue.Release()
+}
+
+func TestQueueConfig_Validate(t *testing.T) {
+	if err := (QueueConfig{Depth: 10}).Validate(); err == nil {
+		t.Error("depth without concurrency is valid")
+	}
+	if err := (QueueConfig{Concurrency: 1, Timeout: "abc"}).Validate(); err == nil {
+		t.Error("bad timeout is valid")
+	}
+	if err := (QueueConfig{Concurrency: 10, Depth: 100, Timeout: "5s"}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
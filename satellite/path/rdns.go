@@ -0,0 +1,96 @@
+package path
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// RDNSTTL is how long the reverse DNS names of a client are reused before they are looked up again
+const RDNSTTL = time.Hour
+
+// RDNSTimeout is how long the PTR and forward lookups of a client may take
+const RDNSTimeout = 2 * time.Second
+
+// RDNSCacheSize is the most reverse DNS results kept. The oldest are dropped first
+const RDNSCacheSize = 4096
+
+// rdnsResult are the reverse DNS names of an IP and when they were looked up
+type rdnsResult struct {
+	// names are every PTR name of the IP
+	names []string
+	// confirmed are the names which resolve back to the IP
+	confirmed []string
+	resolved  time.Time
+}
+
+// RDNS gets the PTR names of ip, and the names which are forward-confirmed
+// because they resolve back to ip. Results are cached for RDNSTTL so clients
+// are not looked up on every request. Failed lookups have no names
+func (s *State) RDNS(ip net.IP) (names, confirmed []string) {
+	key := ip.String()
+
+	s.rdnsMu.Lock()
+	result, ok := s.rdns[key]
+	s.rdnsMu.Unlock()
+	if ok && time.Since(result.resolved) < RDNSTTL {
+		return result.names, result.confirmed
+	}
+
+	result = lookupRDNS(ip)
+
+	s.rdnsMu.Lock()
+	defer s.rdnsMu.Unlock()
+	s.pruneRDNS()
+	s.rdns[key] = result
+	return result.names, result.confirmed
+}
+
+// pruneRDNS drops expired results once the cache is full, then the oldest
+// result if it is still full. The lock must be held
+func (s *State) pruneRDNS() {
+	if len(s.rdns) < RDNSCacheSize {
+		return
+	}
+	oldest := ""
+	for key, result := range s.rdns {
+		if time.Since(result.resolved) >= RDNSTTL {
+			delete(s.rdns, key)
+		} else if oldest == "" || result.resolved.Before(s.rdns[oldest].resolved) {
+			oldest = key
+		}
+	}
+	if len(s.rdns) >= RDNSCacheSize {
+		delete(s.rdns, oldest)
+	}
+}
+
+// lookupRDNS looks up the PTR names of ip and forward-confirms them within RDNSTimeout
+func lookupRDNS(ip net.IP) rdnsResult {
+	result := rdnsResult{resolved: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RDNSTimeout)
+	defer cancel()
+
+	ptrs, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		return result
+	}
+	for _, ptr := range ptrs {
+		name := strings.ToLower(strings.TrimSuffix(ptr, "."))
+		result.names = append(result.names, name)
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(ip) {
+				result.confirmed = append(result.confirmed, name)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package path
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// seenPrefix prefixes the DB keys recording when client keyed entries were last written
+const seenPrefix = "seen:"
+
+// seenKey is the DB key for when the entry at key was last written
+func seenKey(key []byte) []byte {
+	return append([]byte(seenPrefix), key...)
+}
+
+// touch records that the client keyed entry at key was written now, so it can be purged
+func (s *State) touch(key []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutVarint(buf, time.Now().Unix())
+	return s.db.Put(seenKey(key), buf)
+}
+
+// purgeDB deletes the client keyed entries written before cutoff. The global
+// blacklist is kept
+func (s *State) purgeDB(cutoff time.Time) (int, error) {
+	var keys [][]byte
+	err := s.db.Scan([]byte(seenPrefix), func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, key := range keys {
+		v, err := s.db.Get(key)
+		if err != nil {
+			return purged, err
+		}
+		if seen, n := binary.Varint(v); n > 0 && !time.Unix(seen, 0).Before(cutoff) {
+			continue
+		}
+		if err := s.db.Delete(key[len(seenPrefix):]); err != nil {
+			return purged, err
+		}
+		if err := s.db.Delete(key); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeMemory forgets the in-memory client state last updated before cutoff
+func (s *State) purgeMemory(cutoff time.Time) int {
+	purged := 0
+
+	s.repeatsMu.Lock()
+	for key, r := range s.repeats {
+		if r.times[len(r.times)-1].Before(cutoff) {
+			delete(s.repeats, key)
+			purged++
+		}
+	}
+	s.repeatsMu.Unlock()
+
+	s.limitsMu.Lock()
+	for key, bucket := range s.limits {
+		if bucket.updated.Before(cutoff) {
+			delete(s.limits, key)
+			purged++
+		}
+	}
+	s.limitsMu.Unlock()
+
+	s.jarmsMu.Lock()
+	for key, result := range s.jarms {
+		if result.scanned.Before(cutoff) {
+			delete(s.jarms, key)
+			purged++
+		}
+	}
+	s.jarmsMu.Unlock()
+
+	s.rdnsMu.Lock()
+	for key, result := range s.rdns {
+		if result.resolved.Before(cutoff) {
+			delete(s.rdns, key)
+			purged++
+		}
+	}
+	s.rdnsMu.Unlock()
+
+	s.authMu.Lock()
+	for key, result := range s.auth {
+		if result.answered.Before(cutoff) {
+			delete(s.auth, key)
+			purged++
+		}
+	}
+	s.authMu.Unlock()
+
+	return purged
+}
+
+// before reports whether records were made before cutoff, whatever their path
+func before(cutoff time.Time) func(string, time.Time) bool {
+	return func(_ string, t time.Time) bool {
+		return t.Before(cutoff)
+	}
+}
+
+// Purge removes hits, hit counts, captures, approvals, profiles, and client
+// state older than cutoff. It returns the number of records purged by kind
+func (s *State) Purge(cutoff time.Time) (map[string]int, error) {
+	return s.purge(cutoff, before(cutoff))
+}
+
+// purge removes the hits, captures, and approvals expired returns true for, and
+// the profiles and client state older than cutoff
+func (s *State) purge(cutoff time.Time, expired func(path string, t time.Time) bool) (map[string]int, error) {
+	purged := map[string]int{
+		"hits":      s.hits.purge(expired),
+		"captures":  s.captures.purge(expired),
+		"approvals": s.approvals.purge(expired),
+		"profiles":  s.profiles.Purge(cutoff),
+		"clients":   s.pathIdentifier.Purge(cutoff),
+	}
+
+	n, err := s.purgeDB(cutoff)
+	purged["state"] = n + s.purgeMemory(cutoff)
+	if err != nil {
+		return purged, err
+	}
+
+	purged["series"], err = s.purgeSeries(cutoff)
+	return purged, err
+}
+
+// Purge removes hits, captures, approvals, profiles, and client state older
+// than cutoff. The hits, captures, and approvals of paths in campaigns are
+// removed when older than the cutoff of their campaign instead. It returns the
+// number of records purged by kind
+func (paths *Paths) Purge(cutoff time.Time, campaigns map[string]time.Time) (map[string]int, error) {
+	if len(campaigns) == 0 {
+		return paths.state.Purge(cutoff)
+	}
+	return paths.state.purge(cutoff, func(uri string, t time.Time) bool {
+		if matched, ok := paths.Match(uri); ok && matched.Campaign != "" {
+			if campaignCutoff, ok := campaigns[matched.Campaign]; ok {
+				return t.Before(campaignCutoff)
+			}
+		}
+		return t.Before(cutoff)
+	})
+}
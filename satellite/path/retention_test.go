@@ -0,0 +1,97 @@
+package path_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestState_Purge(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer RemoveDB(file)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	state.Hits().Add(req, "served", geoip.DB{})
+	if err := state.HitClient("/", "ip:10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if err := state.Pin("ip:10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing is older than an hour ago
+	purged, err := state.Purge(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Error(err)
+	}
+	if purged["hits"] != 0 || purged["state"] != 0 || !state.Pinned("ip:10.0.0.1") {
+		t.Errorf("unexpected purge %v", purged)
+	}
+
+	purged, err = state.Purge(time.Now().Add(time.Second))
+	if err != nil {
+		t.Error(err)
+	}
+	// The client hits, pin, and timeline entry of the hit are purged from the state DB
+	if purged["hits"] != 1 || purged["state"] != 3 {
+		t.Errorf("unexpected purge %v", purged)
+	}
+	if len(state.Hits().List()) != 0 || state.Pinned("ip:10.0.0.1") {
+		t.Error("hits and pins were not purged")
+	}
+	if hits, err := state.GetClientHits("/", "ip:10.0.0.1"); err != nil || hits != 0 {
+		t.Error("client hits were not purged")
+	}
+	if timeline, err := state.Timeline("192.0.2.1", ""); err != nil || len(timeline.Hits) != 0 {
+		t.Error("timeline was not purged")
+	}
+}
+
+func TestPaths_Purge_campaigns(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreateFile("keep.html", "keep")
+	tmpdir.CreatePathList(`- path: /index.html
+  hosted_file: /index.html
+  campaign: q3
+- path: /keep.html
+  hosted_file: /keep.html`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uri := range []string{"/index.html", "/keep.html"} {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if _, err := paths.MatchAndServe(httptest.NewRecorder(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// q3 keeps its hits for less time than everything else
+	now := time.Now().Add(time.Second)
+	purged, err := paths.Purge(now.Add(-time.Hour), map[string]time.Time{"q3": now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged["hits"] != 1 {
+		t.Errorf("expected the q3 hit to be purged, got %v", purged)
+	}
+	hits := paths.Hits().List()
+	if len(hits) != 1 || hits[0].Path != "/keep.html" {
+		t.Errorf("unexpected hits after purge %v", hits)
+	}
+}
@@ -0,0 +1,273 @@
+package path
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// ScriptTimeout is how long a script may run before it is stopped and the request denied
+const ScriptTimeout = time.Second
+
+// scripts are compiled scripts by source, so each is only compiled once
+var scripts sync.Map
+
+// compileScript compiles the Lua source of a script
+func compileScript(source string) (*lua.FunctionProto, error) {
+	if proto, ok := scripts.Load(source); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(source), "script")
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, "script")
+	if err != nil {
+		return nil, err
+	}
+	scripts.Store(source, proto)
+	return proto, nil
+}
+
+// scriptKey is the DB key of a value stored by scripts
+func scriptKey(key string) []byte {
+	return []byte("script:" + key)
+}
+
+// ScriptValue gets the value a script stored at key
+func (s *State) ScriptValue(key string) (string, bool) {
+	v, err := s.db.Get(scriptKey(key))
+	if s.check(err) != nil {
+		return "", false
+	}
+	return string(v), true
+}
+
+// SetScriptValue stores value at key for scripts until it is purged by the retention policy
+func (s *State) SetScriptValue(key, value string) error {
+	if err := s.check(s.db.Put(scriptKey(key), []byte(value))); err != nil {
+		return err
+	}
+	return s.touch(scriptKey(key))
+}
+
+// ScriptResponse are the changes scripts made to the response of a request
+type ScriptResponse struct {
+	// Headers are set on the response, whether the request is served or not
+	Headers map[string]string
+	// Status and Body replace the response when either is set
+	Status int
+	Body   []byte
+}
+
+type scriptResponseKey struct{}
+
+// withScriptResponse returns req with a response scripts evaluated for it can change
+func withScriptResponse(req *http.Request) (*http.Request, *ScriptResponse) {
+	response := &ScriptResponse{Headers: make(map[string]string)}
+	return req.WithContext(context.WithValue(req.Context(), scriptResponseKey{}, response)), response
+}
+
+// answer writes the headers set by scripts and, when they replaced the response, the
+// status and body. It returns true when the response was replaced
+func (r *ScriptResponse) answer(w http.ResponseWriter) (bool, error) {
+	for name, value := range r.Headers {
+		w.Header().Set(name, value)
+	}
+	if r.Status == 0 && r.Body == nil {
+		return false, nil
+	}
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, err := w.Write(r.Body)
+	return true, err
+}
+
+// newScriptState creates a Lua state with the base, table, string, and math libraries.
+// Scripts can not load files or modules
+func newScriptState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for name, open := range map[string]lua.LGFunction{
+		lua.BaseLibName:   lua.OpenBase,
+		lua.TabLibName:    lua.OpenTable,
+		lua.StringLibName: lua.OpenString,
+		lua.MathLibName:   lua.OpenMath,
+	} {
+		L.Push(L.NewFunction(open))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	return L
+}
+
+// scriptRequest is the request table given to scripts
+func (c *RequestConditions) scriptRequest(L *lua.LState, req *http.Request) *lua.LTable {
+	ip := parseRemoteAddr(req.RemoteAddr)
+	t := L.NewTable()
+	t.RawSetString("ip", lua.LString(ip.String()))
+	t.RawSetString("method", lua.LString(req.Method))
+	t.RawSetString("host", lua.LString(req.Host))
+	t.RawSetString("user_agent", lua.LString(req.UserAgent()))
+	t.RawSetString("ja3_full", lua.LString(req.JA3Fingerprint))
+	if req.JA3Fingerprint != "" {
+		t.RawSetString("ja3", lua.LString(ja3Digest(req.JA3Fingerprint)))
+	}
+	if req.URL != nil {
+		t.RawSetString("path", lua.LString(req.URL.Path))
+		t.RawSetString("query", lua.LString(req.URL.RawQuery))
+	}
+	t.RawSetString("body", lua.LString(peekBody(req, c.maxBodyRead())))
+	t.RawSetString("header", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(req.Header.Get(L.CheckString(1))))
+		return 1
+	}))
+	return t
+}
+
+// scriptGeoIP is the geoip table given to scripts, with what the GeoIP DBs know of the client
+func scriptGeoIP(L *lua.LState, req *http.Request, gip geoip.DB) *lua.LTable {
+	ip := parseRemoteAddr(req.RemoteAddr)
+	t := L.NewTable()
+	if ip == nil {
+		return t
+	}
+	if gip.HasDB() {
+		if country, err := gip.CountryCode(ip); err == nil {
+			t.RawSetString("country", lua.LString(country))
+		}
+		if location, err := gip.Location(ip); err == nil {
+			t.RawSetString("city", lua.LString(location.City))
+			t.RawSetString("time_zone", lua.LString(location.TimeZone))
+		}
+	}
+	if gip.HasASN() {
+		if number, org, err := gip.ASN(ip); err == nil {
+			t.RawSetString("asn", lua.LNumber(number))
+			t.RawSetString("as_org", lua.LString(org))
+		}
+	}
+	return t
+}
+
+// scriptState is the state table given to scripts, which keeps values in the state DB
+func scriptState(L *lua.LState, state *State) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("get", L.NewFunction(func(L *lua.LState) int {
+		if v, ok := state.ScriptValue(L.CheckString(1)); ok {
+			L.Push(lua.LString(v))
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 1
+	}))
+	t.RawSetString("set", L.NewFunction(func(L *lua.LState) int {
+		if err := state.SetScriptValue(L.CheckString(1), L.CheckString(2)); err != nil {
+			L.RaiseError("%s", err)
+		}
+		return 0
+	}))
+	t.RawSetString("incr", L.NewFunction(func(L *lua.LState) int {
+		key := L.CheckString(1)
+		v, _ := state.ScriptValue(key)
+		n, _ := strconv.ParseInt(v, 10, 64)
+		n++
+		if err := state.SetScriptValue(key, strconv.FormatInt(n, 10)); err != nil {
+			L.RaiseError("%s", err)
+		}
+		L.Push(lua.LNumber(n))
+		return 1
+	}))
+	return t
+}
+
+// runScript runs the script of c. It returns whether to host the request, and the
+// changes the script made to the response
+func (c *RequestConditions) runScript(req *http.Request, state *State, gip geoip.DB) (bool, *ScriptResponse, error) {
+	proto, err := compileScript(c.Script)
+	if err != nil {
+		return false, nil, err
+	}
+
+	L := newScriptState()
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(req.Context(), ScriptTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+
+	L.SetGlobal("request", c.scriptRequest(L, req))
+	L.SetGlobal("geoip", scriptGeoIP(L, req, gip))
+	L.SetGlobal("state", scriptState(L, state))
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return false, nil, err
+	}
+
+	switch result := L.Get(-1).(type) {
+	case lua.LBool:
+		return bool(result), nil, nil
+	case *lua.LTable:
+		response := &ScriptResponse{Headers: make(map[string]string)}
+		if headers, ok := result.RawGetString("headers").(*lua.LTable); ok {
+			headers.ForEach(func(name, value lua.LValue) {
+				response.Headers[name.String()] = value.String()
+			})
+		}
+		if status, ok := result.RawGetString("status").(lua.LNumber); ok {
+			response.Status = int(status)
+		}
+		if body, ok := result.RawGetString("body").(lua.LString); ok {
+			response.Body = []byte(body)
+		}
+		return lua.LVAsBool(result.RawGetString("host")), response, nil
+	}
+	return false, nil, nil
+}
+
+// scriptMatch runs the script of c and keeps the changes it made to the response
+func (c *RequestConditions) scriptMatch(req *http.Request, state *State, gip geoip.DB) bool {
+	if c.Script == "" {
+		return true
+	}
+
+	host, response, err := c.runScript(req, state, gip)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Script failed")
+		return false
+	}
+
+	if kept, ok := req.Context().Value(scriptResponseKey{}).(*ScriptResponse); ok && response != nil {
+		for name, value := range response.Headers {
+			kept.Headers[name] = value
+		}
+		if response.Status != 0 {
+			kept.Status = response.Status
+		}
+		if response.Body != nil {
+			kept.Body = response.Body
+		}
+	}
+
+	if !host {
+		log.WithFields(log.Fields{
+			"ip": req.RemoteAddr,
+		}).Debug("Script denied request")
+	}
+	return host
+}
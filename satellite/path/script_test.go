@@ -0,0 +1,113 @@
+package path_test
+
+import (
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestRequestConditions_ShouldHost_script(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	conditions, err := NewRequestConditions([]byte(`script: |
+  if request.header("X-Implant") ~= "1" then
+    return false
+  end
+  return state.incr("stage:" .. request.ip) <= 2`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		implant bool
+		hosted  bool
+	}{
+		{false, false},
+		{true, true},
+		{true, true},
+		{true, false},
+	} {
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if tc.implant {
+			req.Header.Set("X-Implant", "1")
+		}
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("request %d: expected hosted %t, got %t", i, tc.hosted, hosted)
+		}
+	}
+}
+
+func TestRequestConditions_ShouldHost_script_sandbox(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	for _, script := range []string{
+		`return os.execute("true") == 0`,
+		`return dofile("/etc/passwd") ~= nil`,
+		`while true do end`,
+	} {
+		conditions, err := NewRequestConditions([]byte("script: '" + script + "'"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		if conditions.ShouldHost(req, state, geoip.DB{}) {
+			t.Errorf("%s: expected the script to fail", script)
+		}
+	}
+}
+
+func TestNewRequestConditions_script_fail(t *testing.T) {
+	if _, err := NewRequestConditions([]byte("script: 'return ('")); err == nil {
+		t.Error("script which does not compile was accepted")
+	}
+}
+
+func TestPaths_MatchAndServe_script_response(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathListIndex(`script: |
+    if request.query == "decoy" then
+      return {host = false, status = 200, body = "nothing here"}
+    end
+    return {host = true, headers = {["X-Stage"] = request.method}}`)
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		uri   string
+		body  string
+		stage string
+	}{
+		{"/index.html", Sentinal, "GET"},
+		{"/index.html?decoy", "nothing here", ""},
+	} {
+		w := httptest.NewRecorder()
+		didMatch, err := paths.MatchAndServe(w, httptest.NewRequest("GET", tc.uri, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !didMatch || w.Body.String() != tc.body || w.Header().Get("X-Stage") != tc.stage {
+			t.Errorf("%s: expected %q with X-Stage %q, got %t %q %q", tc.uri, tc.body, tc.stage, didMatch, w.Body.String(), w.Header().Get("X-Stage"))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package path
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// WebhookTimeout is how long the self-test waits for a webhook to answer
+const WebhookTimeout = 5 * time.Second
+
+// Check is the result of one startup self-test of a dependency
+type Check struct {
+	// Name is what was checked, like exec, webhook, or state
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	// Critical checks make paths fail closed when they fail, so they can refuse startup
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// OK returns true if the check passed
+func (c Check) OK() bool {
+	return c.Error == ""
+}
+
+func newCheck(name, target string, critical bool, err error) Check {
+	check := Check{Name: name, Target: target, Critical: critical}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// SelfTest checks the dependencies of the conditions of every path: exec
+// scripts exist and are executable, exec users exist, htpasswd files are readable, notify
+// webhooks and external authorizers are reachable, and the state DB is writable
+func (paths *Paths) SelfTest() []Check {
+	checks := []Check{newCheck("state", paths.dbRoot, true, paths.state.Writable())}
+
+	list := paths.pathList()
+	conditions := make([]RequestConditions, 0, len(list)+1)
+	global, err := paths.getGlobalConditionals()
+	if err != nil {
+		checks = append(checks, newCheck("global_conditions", paths.globalConditionsPath, true, err))
+	}
+	conditions = append(conditions, global)
+
+	webhooks := make([]string, 0)
+	for _, v := range list {
+		conditions = append(conditions, v.Conditions)
+		if v.Notify.Enabled() {
+			webhooks = append(webhooks, v.Notify.Webhook)
+		}
+	}
+
+	client := &http.Client{Timeout: WebhookTimeout}
+	files, users := make(map[string]bool), make(map[string]bool)
+	for _, c := range conditions {
+		if authorizer := c.ExternalAuth.URL; authorizer != "" && !files[authorizer] {
+			files[authorizer] = true
+			checks = append(checks, newCheck("external_auth", authorizer, !c.ExternalAuth.FailOpen, CheckReachable(client, authorizer)))
+		}
+		if script := c.Exec.ScriptPath; script != "" && !files[script] {
+			files[script] = true
+			checks = append(checks, newCheck("exec", script, true, checkExecutable(script)))
+		}
+		if u := c.Exec.User; u != "" && !users[u] {
+			users[u] = true
+			_, err := lookupCredential(u)
+			checks = append(checks, newCheck("exec_user", u, true, err))
+		}
+		if htpasswd := c.BasicAuth.Htpasswd; htpasswd != "" && !files[htpasswd] {
+			files[htpasswd] = true
+			_, err := checkHtpasswd(htpasswd, "", "")
+			checks = append(checks, newCheck("htpasswd", htpasswd, true, err))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, webhook := range webhooks {
+		if !seen[webhook] {
+			seen[webhook] = true
+			checks = append(checks, newCheck("webhook", webhook, false, CheckReachable(client, webhook)))
+		}
+	}
+
+	return checks
+}
+
+// checkExecutable checks that script is a file which can be executed
+func checkExecutable(script string) error {
+	info, err := os.Stat(script)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return errors.New(script + " is not executable")
+	}
+	return nil
+}
+
+// CheckReachable checks that url answers HTTP requests. Any response counts,
+// since webhooks usually only accept POSTs
+func CheckReachable(client *http.Client, url string) error {
+	resp, err := client.Head(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,140 @@
+package path
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SeriesResolution is the width of the buckets hit counts are kept in
+const SeriesResolution = time.Minute
+
+// MaxSeriesBuckets is the most buckets a series may be read in
+const MaxSeriesBuckets = 10000
+
+// seriesPrefix prefixes the DB keys of hit count buckets
+const seriesPrefix = "series:"
+
+// ErrTooManyBuckets is returned when a series is read in more than MaxSeriesBuckets buckets
+var ErrTooManyBuckets = errors.New("series spans too many buckets. Use a larger step or a shorter range")
+
+// Bucket is the number of hits in the interval starting at Time
+type Bucket struct {
+	Time time.Time `json:"time"`
+	Hits uint64    `json:"hits"`
+}
+
+// seriesPathPrefix is the prefix of the bucket keys of decision for path, or of every path when path is empty
+func seriesPathPrefix(decision, path string) string {
+	prefix := seriesPrefix + decision + ":"
+	if path != "" {
+		prefix += path + "|"
+	}
+	return prefix
+}
+
+// seriesKey is the DB key of the bucket of decision for path holding t
+func seriesKey(decision, path string, t time.Time) []byte {
+	return []byte(seriesPathPrefix(decision, path) + strconv.FormatInt(t.Truncate(SeriesResolution).Unix(), 10))
+}
+
+// seriesBucketTime gets the start of the bucket stored at key
+func seriesBucketTime(key []byte) (time.Time, bool) {
+	i := bytes.LastIndexByte(key, '|')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(string(key[i+1:]), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// countHit increments the bucket of the decision made for a hit
+func (s *State) countHit(hit Hit) {
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+
+	key := seriesKey(hit.Decision, hit.Path, hit.Time)
+	var count uint64
+	if s.db.Has(key) {
+		if v, err := s.db.Get(key); err == nil {
+			count, _ = binary.Uvarint(v)
+		}
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutUvarint(buf, count+1)
+	s.db.Put(key, buf)
+}
+
+// HitSeries gets the number of decision made for path between since and until
+// in buckets of step, which is rounded to SeriesResolution. Every path is
+// counted when path is empty. Empty buckets are included so the series can be plotted
+func (s *State) HitSeries(decision, path string, since, until time.Time, step time.Duration) ([]Bucket, error) {
+	step = step.Round(SeriesResolution)
+	if step < SeriesResolution {
+		step = SeriesResolution
+	}
+	since = since.Truncate(step)
+	if until.Before(since) {
+		return []Bucket{}, nil
+	}
+	n := int(until.Sub(since)/step) + 1
+	if n > MaxSeriesBuckets {
+		return nil, ErrTooManyBuckets
+	}
+
+	buckets := make([]Bucket, n)
+	for i := range buckets {
+		buckets[i].Time = since.Add(time.Duration(i) * step)
+	}
+
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+	err := s.db.Scan([]byte(seriesPathPrefix(decision, path)), func(key []byte) error {
+		t, ok := seriesBucketTime(key)
+		if !ok || t.Before(since) || t.After(until) {
+			return nil
+		}
+		v, err := s.db.Get(key)
+		if err != nil {
+			return err
+		}
+		count, _ := binary.Uvarint(v)
+		buckets[int(t.Sub(since)/step)].Hits += count
+		return nil
+	})
+	return buckets, err
+}
+
+// purgeSeries deletes the hit count buckets before cutoff
+func (s *State) purgeSeries(cutoff time.Time) (int, error) {
+	s.seriesMu.Lock()
+	defer s.seriesMu.Unlock()
+
+	var keys [][]byte
+	err := s.db.Scan([]byte(seriesPrefix), func(key []byte) error {
+		if t, ok := seriesBucketTime(key); ok && t.Add(SeriesResolution).Before(cutoff) {
+			keys = append(keys, append([]byte{}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := s.db.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// HitSeries gets the number of decision made for path between since and until in buckets of step
+func (paths *Paths) HitSeries(decision, path string, since, until time.Time, step time.Duration) ([]Bucket, error) {
+	return paths.state.HitSeries(decision, path, since, until, step)
+}
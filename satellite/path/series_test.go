@@ -0,0 +1,58 @@
+package path_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestState_HitSeries(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	for _, uri := range []string{"/a", "/a", "/ab"} {
+		state.Hits().Add(httptest.NewRequest("GET", uri, nil), "served", geoip.DB{})
+	}
+	state.Hits().Add(httptest.NewRequest("GET", "/a", nil), "denied", geoip.DB{})
+
+	now := time.Now()
+	sum := func(buckets []Bucket) uint64 {
+		var total uint64
+		for _, b := range buckets {
+			total += b.Hits
+		}
+		return total
+	}
+
+	buckets, err := state.HitSeries("served", "/a", now.Add(-time.Hour), now, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 61 || sum(buckets) != 2 {
+		t.Errorf("expected 2 hits in 61 buckets, got %d in %d", sum(buckets), len(buckets))
+	}
+
+	if buckets, _ := state.HitSeries("served", "", now.Add(-time.Hour), now, time.Hour); sum(buckets) != 3 {
+		t.Errorf("expected 3 hits of every path, got %d", sum(buckets))
+	}
+	if buckets, _ := state.HitSeries("denied", "/a", now.Add(-time.Hour), now, time.Hour); sum(buckets) != 1 {
+		t.Errorf("expected 1 denied hit, got %d", sum(buckets))
+	}
+	if _, err := state.HitSeries("served", "/a", now.Add(-24*time.Hour*30), now, time.Minute); err != ErrTooManyBuckets {
+		t.Error("unbounded series was read")
+	}
+
+	// Retention purges old counts
+	if _, err := state.Purge(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if buckets, _ := state.HitSeries("served", "", now.Add(-time.Hour), now, time.Hour); sum(buckets) != 0 {
+		t.Error("purged hit counts were kept")
+	}
+}
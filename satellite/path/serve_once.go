@@ -0,0 +1,212 @@
+package path
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// Client properties serve_once URLs are bound to
+const (
+	// BindIP binds the URL to the IP of the client
+	BindIP = "ip"
+	// BindJA3 binds the URL to the JA3 fingerprint of the client
+	BindJA3 = "ja3"
+	// BindTLS binds the URL to the TLS connection stage 1 was served on, so
+	// stage 2 must be fetched over the same kept-alive connection
+	BindTLS = "tls"
+)
+
+// defaultServeOncePlaceholder is replaced by the issued URL when serve_once.placeholder is not set
+const defaultServeOncePlaceholder = "{{serve_once}}"
+
+// defaultServeOnceTTL is how long an issued URL is valid when serve_once.ttl is not set
+const defaultServeOnceTTL = 5 * time.Minute
+
+// ServeOnceConfig serves a stage-2 path only at one-time URLs issued to the
+// client which was served the stage-1 issuer path. The URLs are bound to the
+// client, so replaying one from another client or connection is served the decoy
+type ServeOnceConfig struct {
+	// Issuer is the stage-1 path whose hosted file has the issued URL in place of placeholder
+	Issuer string `yaml:"issuer"`
+	// Placeholder is replaced by the issued URL in the issuer's hosted file. Defaults to {{serve_once}}
+	Placeholder string `yaml:"placeholder,omitempty"`
+	// Bind are the client properties the URL is bound to: ip, ja3, and tls. Defaults to ip and ja3
+	Bind []string `yaml:"bind,omitempty"`
+	// TTL is how long an issued URL is valid. Defaults to 5m
+	TTL string `yaml:"ttl,omitempty"`
+}
+
+// Enabled returns true when the path is only served at issued URLs
+func (c ServeOnceConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Validate ensures the issuer, bindings, and TTL are usable
+func (c ServeOnceConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	if !strings.HasPrefix(c.Issuer, "/") {
+		return errors.New(fmt.Sprintf("%s is not a valid serve_once issuer", c.Issuer))
+	}
+
+	for _, b := range c.Bind {
+		switch b {
+		case BindIP, BindJA3, BindTLS:
+		default:
+			return errors.New(fmt.Sprintf("%s is not a valid serve_once binding", b))
+		}
+	}
+
+	if c.TTL != "" {
+		if ttl, err := time.ParseDuration(c.TTL); err != nil || ttl <= 0 {
+			return errors.New(fmt.Sprintf("%s is not a valid serve_once ttl", c.TTL))
+		}
+	}
+
+	return nil
+}
+
+func (c ServeOnceConfig) placeholder() string {
+	if c.Placeholder == "" {
+		return defaultServeOncePlaceholder
+	}
+	return c.Placeholder
+}
+
+func (c ServeOnceConfig) ttl() time.Duration {
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return defaultServeOnceTTL
+	}
+	return ttl
+}
+
+// binding gets the properties of the client of req the URL is bound to
+func (c ServeOnceConfig) binding(req *http.Request) string {
+	bind := c.Bind
+	if len(bind) == 0 {
+		bind = []string{BindIP, BindJA3}
+	}
+
+	values := make([]string, 0, len(bind))
+	for _, b := range bind {
+		switch b {
+		case BindIP:
+			values = append(values, "ip="+parseRemoteAddr(req.RemoteAddr).String())
+		case BindJA3:
+			values = append(values, "ja3="+req.JA3Fingerprint)
+		case BindTLS:
+			var unique []byte
+			if req.TLS != nil {
+				unique = req.TLS.TLSUnique
+			}
+			values = append(values, "tls="+hex.EncodeToString(unique))
+		}
+	}
+	return strings.Join(values, "|")
+}
+
+// serveOnceToken is an issued URL which has not been used
+type serveOnceToken struct {
+	path    string
+	binding string
+	expires time.Time
+}
+
+// IssueToken creates a one-time token for path, bound to binding
+func (s *State) IssueToken(path, binding string, ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	now := time.Now()
+	for t, v := range s.tokens {
+		if now.After(v.expires) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = serveOnceToken{path: path, binding: binding, expires: now.Add(ttl)}
+	return token, nil
+}
+
+// RedeemToken uses up token and returns true if it was issued for path and
+// binding. A token can only be redeemed once, even by the wrong client
+func (s *State) RedeemToken(token, path, binding string) bool {
+	_, ok := s.redeemToken(token, path, binding)
+	return ok
+}
+
+// redeemToken uses up token like RedeemToken and returns it so it can be restored
+func (s *State) redeemToken(token, path, binding string) (serveOnceToken, bool) {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	t, ok := s.tokens[token]
+	if !ok {
+		return t, false
+	}
+	delete(s.tokens, token)
+	return t, t.path == path && t.binding == binding && time.Now().Before(t.expires)
+}
+
+// restoreToken makes a redeemed token usable again until it expires
+func (s *State) restoreToken(token string, t serveOnceToken) {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+	s.tokens[token] = t
+}
+
+// issueURLs issues a URL for every serve_once path issued by issuer to the
+// client of req. It returns the URLs by placeholder
+func (paths *Paths) issueURLs(req *http.Request, issuer *Path) map[string]string {
+	var urls map[string]string
+	for _, v := range paths.pathList() {
+		if v.ServeOnce.Issuer != issuer.Path {
+			continue
+		}
+		token, err := paths.state.IssueToken(v.Path, v.ServeOnce.binding(req), v.ServeOnce.ttl())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  v.Path,
+			}).Error("Unable to issue serve_once URL")
+			continue
+		}
+		if urls == nil {
+			urls = make(map[string]string)
+		}
+		urls[v.ServeOnce.placeholder()] = strings.TrimSuffix(v.Path, "*") + token
+	}
+	return urls
+}
+
+// redeemURL returns true if req is for a URL issued to its client, or the
+// matched path is not serve_once. The returned func makes the URL usable again
+// when req is not served after all
+func (paths *Paths) redeemURL(req *http.Request, matchedPath *Path) (func(), bool) {
+	if !matchedPath.ServeOnce.Enabled() {
+		return func() {}, true
+	}
+
+	token := strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(matchedPath.Path, "*"))
+	if t, ok := paths.state.redeemToken(token, matchedPath.Path, matchedPath.ServeOnce.binding(req)); ok {
+		return func() { paths.state.restoreToken(token, t) }, true
+	}
+	log.WithFields(log.Fields{
+		"ip":      req.RemoteAddr,
+		"req_uri": req.RequestURI,
+	}).Debug("serve_once URL was not issued to the client")
+	return nil, false
+}
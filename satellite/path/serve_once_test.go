@@ -0,0 +1,139 @@
+package path_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_MatchAndServe_serveOnce(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("stage1", "fetch('{{serve_once}}')")
+	tmpdir.CreateFile("stage2", Sentinal)
+	tmpdir.CreatePathList(`- path: /stage1.js
+  hosted_file: stage1
+- path: /s/*
+  hosted_file: stage2
+  serve_once:
+    issuer: /stage1.js
+    bind: [ip, ja3]`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(uri, remoteAddr, ja3 string) string {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.RemoteAddr = remoteAddr
+		req.JA3Fingerprint = ja3
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String()
+	}
+
+	if request("/s/abc", "10.0.0.1:1234", "ja3") == Sentinal {
+		t.Error("stage 2 was served without an issued URL")
+	}
+
+	issued := regexp.MustCompile(`/s/[0-9a-f]{32}`)
+	url := issued.FindString(request("/stage1.js", "10.0.0.1:1234", "ja3"))
+	if url == "" {
+		t.Fatal("stage 1 was not served an issued URL")
+	}
+	if request(url, "10.0.0.1:5678", "ja3") != Sentinal {
+		t.Error("stage 2 was not served at the issued URL")
+	}
+	if request(url, "10.0.0.1:5678", "ja3") == Sentinal {
+		t.Error("issued URL was served twice")
+	}
+
+	// Replays from another client use up the URL
+	url = issued.FindString(request("/stage1.js", "10.0.0.1:1234", "ja3"))
+	if request(url, "10.0.0.2:1234", "ja3") == Sentinal {
+		t.Error("issued URL was served to another IP")
+	}
+	if request(url, "10.0.0.1:1234", "ja3") == Sentinal {
+		t.Error("replayed URL was served")
+	}
+
+	url = issued.FindString(request("/stage1.js", "10.0.0.1:1234", "ja3"))
+	if request(url, "10.0.0.1:1234", "other") == Sentinal {
+		t.Error("issued URL was served to another JA3")
+	}
+}
+
+func TestPaths_MatchAndServe_serveOnce_campaign(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("stage1", "fetch('{{serve_once}}')")
+	tmpdir.CreateFile("stage2", Sentinal)
+	tmpdir.CreatePathList(`- path: /stage1.js
+  hosted_file: stage1
+- path: /s/*
+  hosted_file: stage2
+  campaign: q3
+  serve_once:
+    issuer: /stage1.js`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	campaigns, err := NewCampaigns(map[string]QuotaConfig{"q3": {ServesPerDay: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths.SetCampaigns(campaigns)
+
+	request := func(uri string) string {
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, httptest.NewRequest("GET", uri, nil)); err != nil {
+			t.Error(err)
+		}
+		return w.Body.String()
+	}
+
+	url := regexp.MustCompile(`/s/[0-9a-f]{32}`).FindString(request("/stage1.js"))
+	if request(url) != Sentinal {
+		t.Fatal("stage 2 was not served at the issued URL")
+	}
+
+	// Replaying the spent URL is denied without using up the campaign's serves
+	if request(url) == Sentinal {
+		t.Error("replayed URL was served")
+	}
+	if serves := campaigns.Usage()["q3"].Serves; serves != 1 {
+		t.Errorf("expected 1 campaign serve, got %d", serves)
+	}
+}
+
+func TestServeOnceConfig_Validate(t *testing.T) {
+	valid := ServeOnceConfig{Issuer: "/stage1.js", Bind: []string{BindTLS}, TTL: "1m"}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []ServeOnceConfig{
+		{Issuer: "stage1.js"},
+		{Issuer: "/stage1.js", Bind: []string{"cookie"}},
+		{Issuer: "/stage1.js", TTL: "soon"},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%+v was valid", c)
+		}
+	}
+}
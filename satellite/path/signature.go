@@ -0,0 +1,137 @@
+package path
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// DefaultSignatureHeader is the response header signatures are sent in when signature.header is not set
+const DefaultSignatureHeader = "X-Signature"
+
+// DefaultNonceHeader is the request header implants send their nonce in when signature.nonce_header is not set
+const DefaultNonceHeader = "X-Nonce"
+
+// signatureFields are the parts of a response which can be signed
+var signatureFields = map[string]bool{
+	"body":         true,
+	"path":         true,
+	"nonce":        true,
+	"date":         true,
+	"content_type": true,
+}
+
+// SignatureConfig adds an HMAC-SHA256 of the response to a header, so implants
+// holding the key can check the stage came from the redirector and not an
+// interception proxy before acting on it
+type SignatureConfig struct {
+	// Key is the HMAC key
+	Key string `yaml:"key,omitempty" json:"-"`
+	// Header is the response header the base64 encoded HMAC is sent in. Defaults to X-Signature
+	Header string `yaml:"header,omitempty"`
+	// Fields are signed in order, each followed by a newline: body, path, nonce, date,
+	// or content_type. Defaults to body
+	Fields []string `yaml:"fields,omitempty"`
+	// NonceHeader is the request header whose value is signed as nonce, so a
+	// recorded response can not be replayed. Defaults to X-Nonce
+	NonceHeader string `yaml:"nonce_header,omitempty"`
+}
+
+// Enabled returns true when responses are signed
+func (s SignatureConfig) Enabled() bool {
+	return s.Key != ""
+}
+
+// Validate checks the signed fields exist
+func (s SignatureConfig) Validate() error {
+	if !s.Enabled() {
+		if s.Header != "" || len(s.Fields) != 0 || s.NonceHeader != "" {
+			return errors.New("signature requires a key")
+		}
+		return nil
+	}
+	for _, field := range s.Fields {
+		if !signatureFields[field] {
+			return errors.New(fmt.Sprintf("%s is not a valid signature field", field))
+		}
+	}
+	return nil
+}
+
+// Sign gets the base64 encoded HMAC of the fields of a response with body and header to req
+func (s SignatureConfig) Sign(req *http.Request, header http.Header, body []byte) string {
+	fields := s.Fields
+	if len(fields) == 0 {
+		fields = []string{"body"}
+	}
+	nonceHeader := s.NonceHeader
+	if nonceHeader == "" {
+		nonceHeader = DefaultNonceHeader
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.Key))
+	for _, field := range fields {
+		switch field {
+		case "body":
+			mac.Write(body)
+		case "path":
+			mac.Write([]byte(req.URL.Path))
+		case "nonce":
+			mac.Write([]byte(req.Header.Get(nonceHeader)))
+		case "date":
+			mac.Write([]byte(header.Get("Date")))
+		case "content_type":
+			mac.Write([]byte(header.Get("Content-Type")))
+		}
+		mac.Write([]byte{'\n'})
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// header gets the response header the signature is sent in
+func (s SignatureConfig) header() string {
+	if s.Header != "" {
+		return s.Header
+	}
+	return DefaultSignatureHeader
+}
+
+// signingWriter holds the response back until it is complete, so its signature
+// can be sent in a header before the body
+type signingWriter struct {
+	http.ResponseWriter
+	req    *http.Request
+	config SignatureConfig
+	status int
+	body   bytes.Buffer
+}
+
+func (s SignatureConfig) writer(w http.ResponseWriter, req *http.Request) *signingWriter {
+	return &signingWriter{ResponseWriter: w, req: req, config: s, status: http.StatusOK}
+}
+
+func (w *signingWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *signingWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+// finish signs the response and writes it
+func (w *signingWriter) finish() error {
+	header := w.Header()
+	if header.Get("Date") == "" {
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	header.Set(w.config.header(), w.config.Sign(w.req, header, w.body.Bytes()))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
@@ -0,0 +1,55 @@
+package path_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_MatchAndServe_signature(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("stage", Sentinal)
+	tmpdir.CreatePathList(`- path: /stage
+  hosted_file: stage
+  signature:
+    key: secret
+    header: X-Request-Id
+    fields: [nonce, body]`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/stage", nil)
+	req.Header.Set("X-Nonce", "4f2a")
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != Sentinal {
+		t.Fatalf("expected the stage to be served, got %q", w.Body.String())
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("4f2a\n" + Sentinal + "\n"))
+	if signature := w.Header().Get("X-Request-Id"); signature != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature %q does not match the nonce and body", signature)
+	}
+
+	if err := (SignatureConfig{Fields: []string{"body"}}).Validate(); err == nil {
+		t.Error("signature without a key was validated")
+	}
+	if err := (SignatureConfig{Key: "secret", Fields: []string{"status"}}).Validate(); err == nil {
+		t.Error("unknown signature field was validated")
+	}
+}
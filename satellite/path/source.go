@@ -0,0 +1,122 @@
+package path
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// sourceTimeout is how long fetching the content of a path from its source_url may take
+const sourceTimeout = 30 * time.Second
+
+// maxSourceSize is the largest content fetched from a source_url
+const maxSourceSize = 512 << 20
+
+// sourceClient fetches source_url content. Like proxied origins, sources are not verified
+var sourceClient = &http.Client{
+	Timeout:   sourceTimeout,
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+}
+
+// sourceEntry is content fetched from a source_url
+type sourceEntry struct {
+	data    []byte
+	fetched time.Time
+}
+
+// sourceCache holds the content fetched from every source_url, shared by all paths
+// so reloading the path list does not refetch it
+type sourceCache struct {
+	mu      sync.Mutex
+	entries map[string]sourceEntry
+}
+
+var sources = &sourceCache{entries: make(map[string]sourceEntry)}
+
+// validateSource ensures source_url is an http or https URL and source_cache is a duration
+func (f *Path) validateSource() error {
+	if f.SourceURL == "" {
+		if f.SourceCache != "" {
+			return errors.New("source_cache requires a source_url")
+		}
+		return nil
+	}
+
+	u, err := url.ParseRequestURI(f.SourceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(fmt.Sprintf("%s is not a valid source_url", f.SourceURL))
+	}
+	if f.SourceCache != "" {
+		if _, err := time.ParseDuration(f.SourceCache); err != nil {
+			return errors.New(fmt.Sprintf("%s is not a valid source_cache", f.SourceCache))
+		}
+	}
+	if f.WebDAV || f.Update.Enabled() || f.ProxyHost != "" || f.CredentialCapture.FileOutput != "" {
+		return errors.New("source_url cannot be used with webdav, update, proxy, or credential_capture")
+	}
+	return nil
+}
+
+// source gets the content of the path from its source_url, reusing content fetched
+// within source_cache. When the origin fails, content fetched before is served stale
+func (f *Path) source() ([]byte, error) {
+	var ttl time.Duration
+	if f.SourceCache != "" {
+		ttl, _ = time.ParseDuration(f.SourceCache)
+	}
+
+	sources.mu.Lock()
+	cached, ok := sources.entries[f.SourceURL]
+	sources.mu.Unlock()
+	if ok && time.Since(cached.fetched) < ttl {
+		return cached.data, nil
+	}
+
+	data, err := fetchSource(f.SourceURL)
+	if err != nil {
+		if ok && ttl != 0 {
+			log.WithFields(log.Fields{
+				"error":  err,
+				"source": f.SourceURL,
+			}).Warn("Unable to fetch source. Serving cached content")
+			return cached.data, nil
+		}
+		return nil, err
+	}
+
+	if ttl != 0 {
+		sources.mu.Lock()
+		sources.entries[f.SourceURL] = sourceEntry{data: data, fetched: time.Now()}
+		sources.mu.Unlock()
+	}
+	return data, nil
+}
+
+// fetchSource downloads the content at target
+func fetchSource(target string) ([]byte, error) {
+	resp, err := sourceClient.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("source %s answered %s", target, resp.Status))
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceSize {
+		return nil, errors.New(fmt.Sprintf("source %s is larger than %d bytes", target, maxSourceSize))
+	}
+	return data, nil
+}
@@ -3,14 +3,19 @@ package path
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"net"
 	"strings"
+	"sync"
+	"time"
 
 	// Used for gosql
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 	"github.com/prologic/bitcask"
+	log "github.com/sirupsen/logrus"
 	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/jarm"
 )
 
 // State contains all state for Paths configuration
@@ -18,17 +23,95 @@ type State struct {
 	db *bitcask.Bitcask
 	// PathIdentifier is the global ClientID
 	pathIdentifier *ClientID
+	approvals      *Approvals
+	captures       *Captures
+	hits           *Hits
+	profiles       *Profiles
+
+	rulesMu sync.Mutex
+	// rulesModified is when the path rules were last modified
+	rulesModified time.Time
+
+	repeatsMu sync.Mutex
+	// repeats are the recent identical requests by key
+	repeats map[string]repeatWindow
+	// repeatsSwept is when repeats were last swept of windows without recent requests
+	repeatsSwept time.Time
+
+	limitsMu sync.Mutex
+	// limits are the token buckets of rate limited clients
+	limits map[string]*rateBucket
+	// limitsSwept is when limits were last swept of idle buckets
+	limitsSwept time.Time
+
+	jarmsMu sync.Mutex
+	// jarms are recent JARM fingerprints of client TLS servers
+	jarms map[string]jarmResult
+	// jarmScans are the clients being scanned
+	jarmScans map[string]bool
+	// scanScope are the only ranges of clients which are scanned. Every client is scanned when it is empty
+	scanScope []*net.IPNet
+
+	authMu sync.Mutex
+	// auth are cached answers of external authorizers
+	auth map[string]authResult
+
+	rdnsMu sync.Mutex
+	// rdns are recent reverse DNS names of client IPs
+	rdns map[string]rdnsResult
+
+	feedsMu sync.RWMutex
+	// feeds are the IP ranges of blocklist feeds by feed name
+	feeds map[string][]*net.IPNet
+	// providers are the published IP ranges of hosting providers by provider name
+	providers map[string][]*net.IPNet
+
+	tokensMu sync.Mutex
+	// tokens are the unused serve_once URLs by token
+	tokens map[string]serveOnceToken
+
+	torMu sync.RWMutex
+	// torExits are the IPs of Tor exit nodes
+	torExits map[string]bool
+
+	// seriesMu guards the hit count buckets, which are read and written back
+	seriesMu sync.Mutex
+
+	// promotedMu guards the promoted fingerprint lists, which are read and written back
+	promotedMu sync.Mutex
+
+	// countersMu guards the serve and denial counters, which are read and written back
+	countersMu sync.Mutex
+
+	counterLocksMu sync.Mutex
+	// counterLocks serialize deciding and recording serves by counter key
+	counterLocks map[string]*counterLock
+
+	healthMu sync.Mutex
+	// unavailable is the error the state DB failed with until it recovers, and probed is when it was last checked
+	unavailable error
+	probed      time.Time
+	// onUnavailable is called when the state DB becomes unavailable and when it recovers
+	onUnavailable func(error)
+
+	blacklistMu sync.Mutex
+	// onBlacklist is called with IPs added to the global blacklist
+	onBlacklist func(net.IP)
+	// onUnblacklist is called with IPs removed from the global blacklist
+	onUnblacklist func(net.IP)
 }
 
 // NewState creates the prereqs for managing state in Satellite
 func NewState(dbPath string) (*State, error) {
-	state := &State{db: nil, pathIdentifier: NewClientID()}
+	state := &State{db: nil, pathIdentifier: NewClientID(), approvals: NewApprovals(), captures: NewCaptures(), hits: NewHits(), profiles: NewProfiles(), repeats: make(map[string]repeatWindow), limits: make(map[string]*rateBucket), jarms: make(map[string]jarmResult), jarmScans: make(map[string]bool), rdns: make(map[string]rdnsResult), auth: make(map[string]authResult), feeds: make(map[string][]*net.IPNet), providers: make(map[string][]*net.IPNet), tokens: make(map[string]serveOnceToken), counterLocks: make(map[string]*counterLock)}
 
 	database, err := bitcask.Open(dbPath)
 	if err != nil {
 		return nil, err
 	}
 	state.db = database
+	state.hits.record = state.recordHit
+	state.loadTorExits()
 
 	return state, nil
 }
@@ -42,14 +125,21 @@ func (s *State) exists(path string) bool {
 func (s *State) create(path string) error {
 	buf := make([]byte, binary.MaxVarintLen64)
 	binary.PutUvarint(buf, 1)
-	return s.db.Put([]byte(path), buf)
+	return s.check(s.db.Put([]byte(path), buf))
 }
 
-// incrementServed increments the times_served for a path
+// incrementServed increments the times_served for a path, creating it when it
+// does not exist
 func (s *State) incrementServed(path string) error {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	if !s.exists(path) {
+		return s.create(path)
+	}
 	n, err := s.db.Get([]byte(path))
 	if err != nil {
-		return err
+		return s.check(err)
 	}
 
 	timesRead, err := binary.ReadUvarint(bytes.NewBuffer(n))
@@ -59,7 +149,18 @@ func (s *State) incrementServed(path string) error {
 
 	newTimesRead := make([]byte, binary.MaxVarintLen64)
 	binary.PutUvarint(newTimesRead, timesRead+1)
-	return s.db.Put([]byte(path), newTimesRead)
+	return s.check(s.db.Put([]byte(path), newTimesRead))
+}
+
+// writableKey is the DB key written to check the DB is writable
+const writableKey = "selftest:writable"
+
+// Writable checks the DB can be written to
+func (s *State) Writable() error {
+	if err := s.db.Put([]byte(writableKey), []byte{1}); err != nil {
+		return err
+	}
+	return s.db.Delete([]byte(writableKey))
 }
 
 // ErrNoURL is returned when a request has no URL in the request
@@ -72,17 +173,92 @@ func (s *State) Hit(req *http.Request) error {
 	}
 	path := req.URL.Path
 
-	// ClientID Hit
-	ip := strings.Split(req.RemoteAddr, ":")[0]
-	remoteAddr := net.ParseIP(ip)
-	s.pathIdentifier.Hit(remoteAddr, path)
+	// ClientID Hit, under every key prereqs may be matched on
+	for kind := range prereqKeys {
+		if key := prereqKey(kind, req); key != "" {
+			s.pathIdentifier.HitKey(key, path, requestTime(req))
+		}
+	}
 
 	// DB Hit
-	if exists := s.exists(path); !exists {
-		return s.create(path)
+	return s.incrementServed(path)
+}
+
+// counterGroupKey is the DB key for the serves of every path in the counter group name
+func counterGroupKey(name string) string {
+	return "group:" + name
+}
+
+// HitGroup increments the times a path in the counter group name was served
+func (s *State) HitGroup(name string) error {
+	return s.incrementServed(counterGroupKey(name))
+}
+
+// clientHitsKey is the DB key for the hits of path by a client
+func clientHitsKey(path, client string) []byte {
+	return []byte("hits:" + path + "|" + client)
+}
+
+// HitClient increments the times path was served to the client identified by client
+func (s *State) HitClient(path, client string) error {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	hits, err := s.GetClientHits(path, client)
+	if err != nil {
+		return err
 	}
 
-	return s.incrementServed(path)
+	buf := make([]byte, binary.MaxVarintLen64)
+	binary.PutUvarint(buf, hits+1)
+	if err := s.check(s.db.Put(clientHitsKey(path, client), buf)); err != nil {
+		return err
+	}
+	return s.touch(clientHitsKey(path, client))
+}
+
+// counterLock is a lock on a counter key and how many requests hold or wait on it
+type counterLock struct {
+	sync.Mutex
+	refs int
+}
+
+// LockCounter holds the serve counters under key until the returned func is
+// called, so the serve limits of concurrent requests are checked and charged one
+// at a time
+func (s *State) LockCounter(key string) func() {
+	s.counterLocksMu.Lock()
+	l, ok := s.counterLocks[key]
+	if !ok {
+		l = &counterLock{}
+		s.counterLocks[key] = l
+	}
+	l.refs++
+	s.counterLocksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.counterLocksMu.Lock()
+		defer s.counterLocksMu.Unlock()
+		if l.refs--; l.refs == 0 {
+			delete(s.counterLocks, key)
+		}
+	}
+}
+
+// GetClientHits gets the times path was served to the client identified by client
+func (s *State) GetClientHits(path, client string) (uint64, error) {
+	key := clientHitsKey(path, client)
+	if !s.db.Has(key) {
+		return 0, nil
+	}
+
+	n, err := s.db.Get(key)
+	if err != nil {
+		return 0, s.check(err)
+	}
+	return binary.ReadUvarint(bytes.NewBuffer(n))
 }
 
 // GetHits gets the number of hits for a target path using the SQLite DB
@@ -93,7 +269,7 @@ func (s *State) GetHits(path string) (uint64, error) {
 
 	n, err := s.db.Get([]byte(path))
 	if err != nil {
-		return 0, err
+		return 0, s.check(err)
 	}
 
 	timesRead, err := binary.ReadUvarint(bytes.NewBuffer(n))
@@ -108,7 +284,516 @@ func (s *State) MatchPaths(ip net.IP, paths []string) bool {
 	return s.pathIdentifier.Match(ip, paths)
 }
 
+// MatchClientPaths checks if the client of req, identified by the prereq key kind, has hit
+// the specified paths in order, starting no longer than within ago
+func (s *State) MatchClientPaths(req *http.Request, kind string, paths []string, within time.Duration) bool {
+	key := prereqKey(kind, req)
+	if key == "" {
+		return false
+	}
+	return s.pathIdentifier.MatchKeyWithin(key, paths, within, requestTime(req))
+}
+
 // Remove removes path from DB
 func (s *State) Remove(path string) error {
 	return s.db.Delete([]byte(path))
 }
+
+// Approvals gets the queue of requests waiting on operator approval
+func (s *State) Approvals() *Approvals {
+	return s.approvals
+}
+
+// Captures gets the archive of captured TLS client hellos
+func (s *State) Captures() *Captures {
+	return s.captures
+}
+
+// Hits gets the log of recent decisions
+func (s *State) Hits() *Hits {
+	return s.hits
+}
+
+// Profiles gets the fingerprints learned by paths in learning mode
+func (s *State) Profiles() *Profiles {
+	return s.profiles
+}
+
+// Promoted are the learned fingerprints promoted to the authorized lists of a path
+type Promoted struct {
+	// JA3 are added to authorized_ja3
+	JA3 []string `json:"ja3,omitempty"`
+	// JA4 are added to authorized_ja4
+	JA4 []string `json:"ja4,omitempty"`
+	// HeaderOrder are added to authorized_header_order
+	HeaderOrder []string `json:"header_order,omitempty"`
+}
+
+// Empty checks whether nothing is promoted
+func (p Promoted) Empty() bool {
+	return len(p.JA3) == 0 && len(p.JA4) == 0 && len(p.HeaderOrder) == 0
+}
+
+// promotedKey is the DB key for fingerprints of kind promoted to path's authorized list
+func promotedKey(kind, path string) []byte {
+	return []byte(kind + ":" + path)
+}
+
+// promotedList gets the fingerprints of kind promoted for path
+func (s *State) promotedList(kind, path string) []string {
+	if !s.db.Has(promotedKey(kind, path)) {
+		return nil
+	}
+	n, err := s.db.Get(promotedKey(kind, path))
+	if err != nil || len(n) == 0 {
+		return nil
+	}
+	return strings.Split(string(n), "\n")
+}
+
+// updatePromoted adds the fingerprints in add to and removes the ones in remove
+// from the list of kind promoted for path
+func (s *State) updatePromoted(kind, path string, add, remove []string) error {
+	seen := make(map[string]bool)
+	for _, f := range remove {
+		seen[f] = true
+	}
+	list := make([]string, 0)
+	for _, f := range append(s.promotedList(kind, path), add...) {
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		list = append(list, f)
+	}
+
+	if len(list) == 0 {
+		if !s.db.Has(promotedKey(kind, path)) {
+			return nil
+		}
+		return s.db.Delete(promotedKey(kind, path))
+	}
+	return s.db.Put(promotedKey(kind, path), []byte(strings.Join(list, "\n")))
+}
+
+// updateAllPromoted applies add and remove to every promoted list of path
+func (s *State) updateAllPromoted(path string, add, remove Promoted) error {
+	s.promotedMu.Lock()
+	defer s.promotedMu.Unlock()
+
+	if err := s.updatePromoted("ja3", path, add.JA3, remove.JA3); err != nil {
+		return err
+	}
+	if err := s.updatePromoted("ja4", path, add.JA4, remove.JA4); err != nil {
+		return err
+	}
+	return s.updatePromoted("header_order", path, add.HeaderOrder, remove.HeaderOrder)
+}
+
+// Promote adds the fingerprints in p to the authorized lists of path
+func (s *State) Promote(path string, p Promoted) error {
+	return s.updateAllPromoted(path, p, Promoted{})
+}
+
+// Demote removes the fingerprints in p from the authorized lists of path
+func (s *State) Demote(path string, p Promoted) error {
+	return s.updateAllPromoted(path, Promoted{}, p)
+}
+
+// Promoted gets the fingerprints promoted to the authorized lists of path
+func (s *State) Promoted(path string) Promoted {
+	s.promotedMu.Lock()
+	defer s.promotedMu.Unlock()
+
+	return Promoted{
+		JA3:         s.promotedList("ja3", path),
+		JA4:         s.promotedList("ja4", path),
+		HeaderOrder: s.promotedList("header_order", path),
+	}
+}
+
+// blacklistKey is the DB key for a globally blacklisted IP or JA3 digest
+func blacklistKey(kind, value string) []byte {
+	return []byte("blacklist:" + kind + ":" + value)
+}
+
+// OnBlacklist sets the function called when an IP is added to the global blacklist
+func (s *State) OnBlacklist(f func(net.IP)) {
+	s.blacklistMu.Lock()
+	defer s.blacklistMu.Unlock()
+	s.onBlacklist = f
+}
+
+// OnUnblacklist sets the function called when an IP is removed from the global blacklist
+func (s *State) OnUnblacklist(f func(net.IP)) {
+	s.blacklistMu.Lock()
+	defer s.blacklistMu.Unlock()
+	s.onUnblacklist = f
+}
+
+// ErrNotBlacklisted is returned when an IP which is not on the global blacklist is removed
+var ErrNotBlacklisted = errors.New("IP is not blacklisted")
+
+// Unblacklist removes ip from the global blacklist
+func (s *State) Unblacklist(ip net.IP) error {
+	key := blacklistKey("ip", ip.String())
+	if !s.db.Has(key) {
+		return ErrNotBlacklisted
+	}
+	if err := s.db.Delete(key); err != nil {
+		return err
+	}
+	s.blacklistMu.Lock()
+	onUnblacklist := s.onUnblacklist
+	s.blacklistMu.Unlock()
+	if onUnblacklist != nil {
+		onUnblacklist(ip)
+	}
+	return nil
+}
+
+// Blacklist denies ip and the JA3 digest ja3 on every path. Either may be empty
+func (s *State) Blacklist(ip net.IP, ja3 string) error {
+	if ip != nil {
+		if err := s.db.Put(blacklistKey("ip", ip.String()), []byte{1}); err != nil {
+			return err
+		}
+		s.blacklistMu.Lock()
+		onBlacklist := s.onBlacklist
+		s.blacklistMu.Unlock()
+		if onBlacklist != nil {
+			onBlacklist(ip)
+		}
+	}
+	if ja3 != "" {
+		return s.db.Put(blacklistKey("ja3", ja3), []byte{1})
+	}
+	return nil
+}
+
+// BlacklistedIPs gets the IPs on the global blacklist. Blocklist feeds are not included
+func (s *State) BlacklistedIPs() ([]net.IP, error) {
+	prefix := blacklistKey("ip", "")
+	ips := make([]net.IP, 0)
+	err := s.db.Scan(prefix, func(key []byte) error {
+		if ip := net.ParseIP(string(key[len(prefix):])); ip != nil {
+			ips = append(ips, ip)
+		}
+		return nil
+	})
+	return ips, err
+}
+
+// Blacklisted returns true if ip or the JA3 digest ja3 is on the global blacklist
+func (s *State) Blacklisted(ip net.IP, ja3 string) bool {
+	if ip != nil && (s.db.Has(blacklistKey("ip", ip.String())) || s.inFeed(ip)) {
+		return true
+	}
+	return ja3 != "" && s.db.Has(blacklistKey("ja3", ja3))
+}
+
+// SetFeed replaces the IP ranges of the blocklist feed name on the global blacklist
+func (s *State) SetFeed(name string, ranges []*net.IPNet) {
+	s.feedsMu.Lock()
+	defer s.feedsMu.Unlock()
+	s.feeds[name] = ranges
+}
+
+// SetHostingProvider replaces the published IP ranges of the hosting provider name
+func (s *State) SetHostingProvider(name string, ranges []*net.IPNet) {
+	s.feedsMu.Lock()
+	defer s.feedsMu.Unlock()
+	s.providers[name] = ranges
+}
+
+// hostingProvider gets which of the hosting providers names ip belongs to
+func (s *State) hostingProvider(ip net.IP, names []string) (string, bool) {
+	s.feedsMu.RLock()
+	defer s.feedsMu.RUnlock()
+	for _, name := range names {
+		for _, r := range s.providers[name] {
+			if r.Contains(ip) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// inFeed returns true if ip is in a blocklist feed
+func (s *State) inFeed(ip net.IP) bool {
+	s.feedsMu.RLock()
+	defer s.feedsMu.RUnlock()
+	for _, ranges := range s.feeds {
+		for _, r := range ranges {
+			if r.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetRulesModified sets when the path rules were last modified
+func (s *State) SetRulesModified(t time.Time) {
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+	s.rulesModified = t
+}
+
+// RulesModified gets when the path rules were last modified
+func (s *State) RulesModified() time.Time {
+	s.rulesMu.Lock()
+	defer s.rulesMu.Unlock()
+	return s.rulesModified
+}
+
+// pinnedKey is the DB key for a client pinned to the decoy
+func pinnedKey(key string) []byte {
+	return []byte("pinned:" + key)
+}
+
+// repeatSweepInterval is how often repeats are swept of windows without recent requests
+const repeatSweepInterval = time.Minute
+
+// repeatWindow are the times identical requests were made within window
+type repeatWindow struct {
+	times  []time.Time
+	window time.Duration
+}
+
+// Repeat records an identical request identified by key made at now and returns
+// the number of identical requests within window, including this one
+func (s *State) Repeat(key string, window time.Duration, now time.Time) int {
+	s.repeatsMu.Lock()
+	defer s.repeatsMu.Unlock()
+
+	if now.Sub(s.repeatsSwept) >= repeatSweepInterval {
+		s.sweepRepeats(now)
+	}
+
+	recent := make([]time.Time, 0, len(s.repeats[key].times)+1)
+	for _, t := range s.repeats[key].times {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	s.repeats[key] = repeatWindow{times: recent, window: window}
+
+	return len(recent)
+}
+
+// sweepRepeats forgets the keys whose last identical request is outside their
+// window, so clients which do not come back are not kept. The lock must be held
+func (s *State) sweepRepeats(now time.Time) {
+	for key, r := range s.repeats {
+		if now.Sub(r.times[len(r.times)-1]) >= r.window {
+			delete(s.repeats, key)
+		}
+	}
+	s.repeatsSwept = now
+}
+
+// limitSweepInterval is how often limits are swept of idle buckets
+const limitSweepInterval = time.Minute
+
+// rateBucket is a token bucket for a rate limited client
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+	limited bool
+	rate    float64
+	burst   int
+}
+
+// idle returns true if the bucket has been full for longer than it takes to
+// refill, so dropping it does not change any decision
+func (b *rateBucket) idle(now time.Time) bool {
+	refill := float64(b.burst) / b.rate
+	return now.Sub(b.updated).Seconds() >= (float64(b.burst)-b.tokens)/b.rate+refill
+}
+
+// RateLimit takes a token at now from the bucket identified by key, which is refilled
+// at rate tokens per second up to burst. It returns false when the bucket is empty
+func (s *State) RateLimit(key string, rate float64, burst int, now time.Time) bool {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+
+	bucket, ok := s.limits[key]
+	if !ok {
+		if now.Sub(s.limitsSwept) >= limitSweepInterval {
+			s.sweepLimits(now)
+		}
+		bucket = &rateBucket{tokens: float64(burst), updated: now}
+		s.limits[key] = bucket
+	}
+	bucket.rate, bucket.burst = rate, burst
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	bucket.limited = bucket.tokens < 1
+	if !bucket.limited {
+		bucket.tokens--
+	}
+	return !bucket.limited
+}
+
+// sweepLimits forgets idle buckets, so clients which do not come back are not
+// kept. The lock must be held
+func (s *State) sweepLimits(now time.Time) {
+	for key, bucket := range s.limits {
+		if bucket.idle(now) {
+			delete(s.limits, key)
+		}
+	}
+	s.limitsSwept = now
+}
+
+// RateLimited returns true if the last request in the bucket identified by key was limited
+func (s *State) RateLimited(key string) bool {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	bucket, ok := s.limits[key]
+	return ok && bucket.limited
+}
+
+// Pin pins the client identified by key to the decoy until it is purged by the retention policy
+func (s *State) Pin(key string) error {
+	if err := s.check(s.db.Put(pinnedKey(key), []byte{1})); err != nil {
+		return err
+	}
+	return s.touch(pinnedKey(key))
+}
+
+// Pinned returns true if the client identified by key was pinned to the decoy
+func (s *State) Pinned(key string) bool {
+	return s.db.Has(pinnedKey(key))
+}
+
+// denialsKey is the DB key counting the denials of the client at ip
+func denialsKey(ip string) []byte {
+	return []byte("denials:" + ip)
+}
+
+// Deny counts a denial of the client at ip until it is purged by the retention policy
+func (s *State) Deny(ip string) error {
+	s.countersMu.Lock()
+	defer s.countersMu.Unlock()
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, s.Denials(ip)+1)
+	if err := s.check(s.db.Put(denialsKey(ip), buf[:n])); err != nil {
+		return err
+	}
+	return s.touch(denialsKey(ip))
+}
+
+// Denials gets the number of times the client at ip was denied
+func (s *State) Denials(ip string) uint64 {
+	v, err := s.db.Get(denialsKey(ip))
+	if err != nil {
+		return 0
+	}
+	n, _ := binary.Uvarint(v)
+	return n
+}
+
+// JARMTTL is how long the JARM fingerprint of a client is reused before it is scanned again
+const JARMTTL = time.Hour
+
+// JARMTimeout is how long each JARM probe waits for the client to answer
+const JARMTimeout = 2 * time.Second
+
+// JARMCacheSize is the most JARM fingerprints kept. The oldest are dropped first
+const JARMCacheSize = 4096
+
+// JARMMaxScans is the most clients scanned at once
+const JARMMaxScans = 16
+
+// jarmResult is a JARM fingerprint and when it was scanned
+type jarmResult struct {
+	fingerprint string
+	scanned     time.Time
+}
+
+// SetScanScope sets the only ranges of clients which are actively scanned, so
+// hosts outside of the engagement scope are never probed
+func (s *State) SetScanScope(ranges []*net.IPNet) {
+	s.jarmsMu.Lock()
+	defer s.jarmsMu.Unlock()
+	s.scanScope = ranges
+}
+
+// inScanScope returns true when the client at host may be scanned
+func (s *State) inScanScope(host string) bool {
+	if len(s.scanScope) == 0 {
+		return true
+	}
+	ip := net.ParseIP(host)
+	for _, r := range s.scanScope {
+		if ip != nil && r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// JARM gets the JARM fingerprint of the TLS server at host:port. Scanning takes
+// up to 10 probes, so it is done in the background and false is returned until
+// the fingerprint is known. Results are cached for JARMTTL, each client is
+// scanned once at a time, and clients outside of the scan scope are never scanned
+func (s *State) JARM(host, port string) (string, bool) {
+	key := net.JoinHostPort(host, port)
+
+	s.jarmsMu.Lock()
+	defer s.jarmsMu.Unlock()
+	if result, ok := s.jarms[key]; ok && time.Since(result.scanned) < JARMTTL {
+		return result.fingerprint, true
+	}
+	if s.jarmScans[key] {
+		return "", false
+	}
+	if !s.inScanScope(host) {
+		log.WithField("ip", host).Debug("Client is outside of the scan scope. Not scanning JARM")
+		return "", false
+	}
+	if len(s.jarmScans) >= JARMMaxScans {
+		log.WithField("ip", host).Debug("Too many JARM scans. Not scanning JARM")
+		return "", false
+	}
+
+	s.jarmScans[key] = true
+	go s.scanJARM(key, host, port)
+	return "", false
+}
+
+// scanJARM scans the client at host:port and caches its fingerprint
+func (s *State) scanJARM(key, host, port string) {
+	fingerprint := jarm.Fingerprint(host, port, JARMTimeout)
+
+	s.jarmsMu.Lock()
+	defer s.jarmsMu.Unlock()
+	delete(s.jarmScans, key)
+	s.pruneJARMs()
+	s.jarms[key] = jarmResult{fingerprint: fingerprint, scanned: time.Now()}
+}
+
+// pruneJARMs drops expired fingerprints once the cache is full, then the oldest
+// fingerprint if it is still full
+func (s *State) pruneJARMs() {
+	if len(s.jarms) < JARMCacheSize {
+		return
+	}
+	oldest := ""
+	for key, result := range s.jarms {
+		if time.Since(result.scanned) >= JARMTTL {
+			delete(s.jarms, key)
+		} else if oldest == "" || result.scanned.Before(s.jarms[oldest].scanned) {
+			oldest = key
+		}
+	}
+	if len(s.jarms) >= JARMCacheSize {
+		delete(s.jarms, oldest)
+	}
+}
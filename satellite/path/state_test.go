@@ -1,11 +1,14 @@
 package path_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
 	. "github.com/t94j0/satellite/satellite/path"
 )
 
@@ -162,3 +165,93 @@ func TestState_hit_urlfail(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestState_Available(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	alerts := make(chan error, 2)
+	state.OnUnavailable(func(err error) { alerts <- err })
+
+	served, _ := NewRequestConditions([]byte("serve: 1"))
+	fallback, _ := NewRequestConditions([]byte("serve: 1\non_state_error:\n  serve: open"))
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	state.FailDB(errors.New("no space left on device"))
+	if state.Available() {
+		t.Fatal("state DB available after failing")
+	}
+	if err := <-alerts; err == nil {
+		t.Error("no unavailable alert")
+	}
+	if served.ShouldHost(req, state, geoip.DB{}) {
+		t.Error("serve limit did not fail closed")
+	}
+	if !fallback.ShouldHost(req, state, geoip.DB{}) {
+		t.Error("serve limit did not fail open with on_state_error")
+	}
+
+	state.ProbeDB()
+	if !state.Available() {
+		t.Fatal("state DB did not recover")
+	}
+	if err := <-alerts; err != nil {
+		t.Errorf("expected recovered alert, got %s", err)
+	}
+	if !served.ShouldHost(req, state, geoip.DB{}) {
+		t.Error("serve limit did not recover")
+	}
+
+	if _, err := NewRequestConditions([]byte("on_state_error:\n  prereq: open")); err == nil {
+		t.Error("on_state_error of a conditional not depending on the state DB was validated")
+	}
+}
+
+func TestState_Repeat_sweep(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	start := time.Now()
+	if n := state.Repeat("a", time.Second, start); n != 1 {
+		t.Errorf("expected 1 repeat, got %d", n)
+	}
+	if n := state.Repeat("a", time.Second, start.Add(time.Millisecond)); n != 2 {
+		t.Errorf("expected 2 repeats, got %d", n)
+	}
+	state.Repeat("b", time.Hour, start)
+
+	// Windows without recent requests are forgotten once repeats are swept
+	state.Repeat("c", time.Second, start.Add(2*time.Minute))
+	if n := state.Repeats(); n != 2 {
+		t.Errorf("expected the expired window to be swept, got %d keys", n)
+	}
+}
+
+func TestState_RateLimit_sweep(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	start := time.Now()
+	if !state.RateLimit("a", 1, 2, start) || !state.RateLimit("a", 1, 2, start) {
+		t.Error("expected the burst to be allowed")
+	}
+	if state.RateLimit("a", 1, 2, start) {
+		t.Error("expected the empty bucket to be limited")
+	}
+	state.RateLimit("b", 0.001, 2, start)
+
+	// Buckets full for longer than they take to refill are forgotten once limits are swept
+	state.RateLimit("c", 1, 2, start.Add(2*time.Minute))
+	if n := state.Limits(); n != 2 {
+		t.Errorf("expected the idle bucket to be swept, got %d buckets", n)
+	}
+}
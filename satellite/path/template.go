@@ -0,0 +1,97 @@
+package path
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// TemplateData is the request data hosted files with template set are rendered with
+type TemplateData struct {
+	IP        string
+	UserAgent string
+	Host      string
+	Path      string
+	// Query are the query parameters, like {{.Query.Get "id"}}
+	Query url.Values
+	// Country is the ISO country code of the client when there is a GeoIP DB
+	Country string
+	// Hits is the number of times the path has been served, including this time
+	Hits uint64
+	Time time.Time
+}
+
+// templateFuncs are the functions templates can call for random values
+var templateFuncs = template.FuncMap{
+	// randomHex gets n random bytes encoded as hex
+	"randomHex": func(n int) (string, error) {
+		if n <= 0 || n > 1024 {
+			return "", errors.New("randomHex expects 1 to 1024 bytes")
+		}
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(b), nil
+	},
+	// randomInt gets a random integer in [min, max)
+	"randomInt": func(min, max int64) (int64, error) {
+		if max <= min {
+			return 0, errors.New("randomInt expects min to be less than max")
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(max-min))
+		if err != nil {
+			return 0, err
+		}
+		return min + n.Int64(), nil
+	},
+}
+
+// newTemplateData gets the template data of req which is known without the state or GeoIP DBs
+func newTemplateData(req *http.Request) *TemplateData {
+	data := &TemplateData{
+		IP:        parseRemoteAddr(req.RemoteAddr).String(),
+		UserAgent: req.UserAgent(),
+		Host:      req.Host,
+		Time:      time.Now(),
+	}
+	if req.URL != nil {
+		data.Path = req.URL.Path
+		data.Query = req.URL.Query()
+	}
+	return data
+}
+
+// templateData gets the template data of req with the country and serve count of the client
+func (paths *Paths) templateData(req *http.Request) *TemplateData {
+	data := newTemplateData(req)
+	if gip := paths.GeoIP(); gip.HasDB() {
+		data.Country, _ = gip.CountryCode(parseRemoteAddr(req.RemoteAddr))
+	}
+	data.Hits, _ = paths.state.GetHits(data.Path)
+	return data
+}
+
+// executeTemplate renders the hosted file contents in with the template data of req
+func (f *Path) executeTemplate(in []byte, req *http.Request) ([]byte, error) {
+	t, err := template.New(f.HostedFile).Funcs(templateFuncs).Option("missingkey=zero").Parse(string(in))
+	if err != nil {
+		return nil, err
+	}
+	data := f.templateData
+	if data == nil {
+		data = newTemplateData(req)
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+package path
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// timelinePrefix prefixes the DB keys of the decisions kept in client timelines
+const timelinePrefix = "timeline:"
+
+// timelineKey is the DB key of a decision made for ip at t
+func timelineKey(ip string, t time.Time) []byte {
+	return []byte(fmt.Sprintf("%s%s|%020d", timelinePrefix, ip, t.UnixNano()))
+}
+
+// Timeline is every decision made for a client IP across every path, kept in the
+// state DB until it is purged by the retention policy
+type Timeline struct {
+	IP        string    `json:"ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Stages are the paths served to the client, in the order they were first reached
+	Stages []string `json:"stages"`
+	// Hits are the decisions, oldest first
+	Hits []Hit `json:"hits"`
+}
+
+// recordHit counts a decision and adds it to the timeline of its client
+func (s *State) recordHit(hit Hit) {
+	s.countHit(hit)
+
+	v, err := json.Marshal(hit)
+	if err != nil {
+		return
+	}
+	key := timelineKey(hit.IP, hit.Time)
+	if s.check(s.db.Put(key, v)) != nil {
+		return
+	}
+	s.touch(key)
+}
+
+// Timeline gets the timeline of ip. When ja3 is set, only the decisions made for
+// the client profile with the JA3 digest are included
+func (s *State) Timeline(ip, ja3 string) (Timeline, error) {
+	timeline := Timeline{IP: ip, Stages: make([]string, 0), Hits: make([]Hit, 0)}
+
+	var keys [][]byte
+	err := s.db.Scan([]byte(timelinePrefix+ip+"|"), func(key []byte) error {
+		keys = append(keys, append([]byte{}, key...))
+		return nil
+	})
+	if err != nil {
+		return timeline, s.check(err)
+	}
+
+	for _, key := range keys {
+		v, err := s.db.Get(key)
+		if err != nil {
+			return timeline, s.check(err)
+		}
+		var hit Hit
+		if err := json.Unmarshal(v, &hit); err != nil {
+			continue
+		}
+		if ja3 == "" || hit.JA3 == ja3 {
+			timeline.Hits = append(timeline.Hits, hit)
+		}
+	}
+	sort.Slice(timeline.Hits, func(i, j int) bool {
+		return timeline.Hits[i].Time.Before(timeline.Hits[j].Time)
+	})
+
+	reached := make(map[string]bool)
+	for _, hit := range timeline.Hits {
+		if hit.Decision == "served" && !reached[hit.Path] {
+			reached[hit.Path] = true
+			timeline.Stages = append(timeline.Stages, hit.Path)
+		}
+	}
+	if n := len(timeline.Hits); n != 0 {
+		timeline.FirstSeen, timeline.LastSeen = timeline.Hits[0].Time, timeline.Hits[n-1].Time
+	}
+	return timeline, nil
+}
+
+// Timeline gets the timeline of ip, limited to the client profile with the JA3 digest when ja3 is set
+func (paths *Paths) Timeline(ip, ja3 string) (Timeline, error) {
+	return paths.state.Timeline(ip, ja3)
+}
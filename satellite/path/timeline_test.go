@@ -0,0 +1,51 @@
+package path_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/geoip"
+)
+
+func TestState_Timeline(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	for _, hit := range []struct {
+		ip       string
+		uri      string
+		decision string
+	}{
+		{"192.0.2.1", "/", "denied"},
+		{"192.0.2.1", "/stage1", "served"},
+		{"192.0.2.10", "/stage1", "served"},
+		{"192.0.2.1", "/stage1", "served"},
+		{"192.0.2.1", "/stage2", "served"},
+	} {
+		req := httptest.NewRequest("GET", hit.uri, nil)
+		req.RemoteAddr = hit.ip + ":1234"
+		state.Hits().Add(req, hit.decision, geoip.DB{})
+	}
+
+	timeline, err := state.Timeline("192.0.2.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline.Hits) != 4 || timeline.Hits[0].Path != "/" || timeline.Hits[3].Path != "/stage2" {
+		t.Errorf("unexpected timeline %+v", timeline.Hits)
+	}
+	if !reflect.DeepEqual(timeline.Stages, []string{"/stage1", "/stage2"}) {
+		t.Errorf("unexpected stages %v", timeline.Stages)
+	}
+	if timeline.FirstSeen != timeline.Hits[0].Time || timeline.LastSeen != timeline.Hits[3].Time {
+		t.Error("first and last seen are not the first and last hits")
+	}
+
+	if timeline, _ := state.Timeline("192.0.2.1", "771,4865"); len(timeline.Hits) != 0 {
+		t.Errorf("hits of other client profiles were included: %+v", timeline.Hits)
+	}
+}
@@ -0,0 +1,115 @@
+package path
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tlsVersions are the names of TLS versions usable in authorized_tls_versions and blacklist_tls_versions
+var tlsVersions = map[string]uint16{
+	"SSL3.0": 0x0300,
+	"TLS1.0": 0x0301,
+	"TLS1.1": 0x0302,
+	"TLS1.2": 0x0303,
+	"TLS1.3": 0x0304,
+}
+
+// cipherSuites are the IANA names of cipher suites usable in authorized_cipher_suites and blacklist_cipher_suites
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                0x0005,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           0x000a,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            0x002f,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            0x0035,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         0x003c,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         0x009c,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         0x009d,
+	"TLS_AES_128_GCM_SHA256":                  0x1301,
+	"TLS_AES_256_GCM_SHA384":                  0x1302,
+	"TLS_CHACHA20_POLY1305_SHA256":            0x1303,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        0xc007,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    0xc009,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    0xc00a,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          0xc011,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     0xc012,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      0xc013,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      0xc014,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": 0xc023,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   0xc027,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": 0xc02b,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": 0xc02c,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   0xc02f,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   0xc030,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    0xcca8,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  0xcca9,
+}
+
+// supportedGroups are the names of the groups, or curves, a client hello may offer
+var supportedGroups = map[string]uint16{
+	"secp256r1": 23,
+	"secp384r1": 24,
+	"secp521r1": 25,
+	"x25519":    29,
+	"x448":      30,
+	"ffdhe2048": 256,
+	"ffdhe3072": 257,
+	"ffdhe4096": 258,
+	"ffdhe6144": 259,
+	"ffdhe8192": 260,
+}
+
+// tlsVersionName gets the name of a TLS version, like TLS1.2
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// parseCipherSuite gets the ID of a cipher suite given by its IANA name or in hex, like 0xc02f
+func parseCipherSuite(suite string) (uint16, bool) {
+	if id, ok := cipherSuites[suite]; ok {
+		return id, true
+	}
+	return parseHexID(suite)
+}
+
+// parseSupportedGroup gets the ID of a group given by its name, like x25519, or its decimal ID
+func parseSupportedGroup(group string) (uint16, bool) {
+	if id, ok := supportedGroups[strings.ToLower(group)]; ok {
+		return id, true
+	}
+	id, err := strconv.ParseUint(group, 10, 16)
+	return uint16(id), err == nil
+}
+
+func parseHexID(s string) (uint16, bool) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(s[2:], 16, 16)
+	return uint16(id), err == nil
+}
+
+// ja3Field gets a field of a JA3 string: 0 is the version, 1 the cipher suites,
+// 2 the extensions, 3 the supported groups, and 4 the point formats
+func ja3Field(ja3 string, field int) string {
+	fields := strings.Split(ja3, ",")
+	if field >= len(fields) {
+		return ""
+	}
+	return fields[field]
+}
+
+// offeredGroups gets the supported groups offered in the client hello of a JA3 string
+func offeredGroups(ja3 string) map[uint16]bool {
+	groups := make(map[uint16]bool)
+	for _, g := range strings.Split(ja3Field(ja3, 3), "-") {
+		if id, err := strconv.ParseUint(g, 10, 16); err == nil {
+			groups[uint16(id)] = true
+		}
+	}
+	return groups
+}
@@ -0,0 +1,55 @@
+package path
+
+import (
+	"net"
+	"strings"
+)
+
+// torExitsKey is the DB key of the cached Tor exit node list
+var torExitsKey = []byte("tor:exits")
+
+// SetTorExits replaces the Tor exit node list used by blacklist_tor. The list
+// is cached in the DB so it is used after a restart until it is fetched again
+func (s *State) SetTorExits(ips []net.IP) error {
+	exits := make(map[string]bool, len(ips))
+	lines := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		exits[ip.String()] = true
+		lines = append(lines, ip.String())
+	}
+
+	s.torMu.Lock()
+	s.torExits = exits
+	s.torMu.Unlock()
+
+	return s.db.Put(torExitsKey, []byte(strings.Join(lines, "\n")))
+}
+
+// loadTorExits loads the cached Tor exit node list
+func (s *State) loadTorExits() {
+	data, err := s.db.Get(torExitsKey)
+	if err != nil {
+		return
+	}
+
+	exits := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			exits[line] = true
+		}
+	}
+
+	s.torMu.Lock()
+	defer s.torMu.Unlock()
+	s.torExits = exits
+}
+
+// TorExit returns true if ip is a Tor exit node
+func (s *State) TorExit(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	s.torMu.RLock()
+	defer s.torMu.RUnlock()
+	return s.torExits[ip.String()]
+}
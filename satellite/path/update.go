@@ -0,0 +1,229 @@
+package path
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats of software update manifests
+const (
+	// UpdateSparkle is a Sparkle appcast, used by macOS apps
+	UpdateSparkle = "sparkle"
+	// UpdateSquirrel is a Squirrel.Mac update response, used by Electron autoUpdater
+	UpdateSquirrel = "squirrel"
+	// UpdateElectron is an electron-updater latest.yml
+	UpdateElectron = "electron"
+	// UpdateJSON is a generic JSON manifest
+	UpdateJSON = "json"
+)
+
+// UpdateConfig emulates an auto-update endpoint. The path serves the manifest
+// and BinaryPath serves the hosted file the manifest points to
+type UpdateConfig struct {
+	// Format is the manifest format: sparkle, squirrel, electron, or json
+	Format string `yaml:"format"`
+	// Version is the version advertised by the manifest
+	Version string `yaml:"version"`
+	// BinaryPath is the URI of the update binary
+	BinaryPath string `yaml:"binary_path"`
+	// Notes are the release notes in the manifest
+	Notes string `yaml:"notes,omitempty"`
+	// Signature is the signature of the binary, like the sparkle:edSignature of an appcast
+	Signature string `yaml:"signature,omitempty"`
+}
+
+// Enabled returns true when the path emulates an update endpoint
+func (u UpdateConfig) Enabled() bool {
+	return u.Format != ""
+}
+
+// Validate ensures the update endpoint is configured
+func (u UpdateConfig) Validate() error {
+	if !u.Enabled() {
+		return nil
+	}
+
+	switch u.Format {
+	case UpdateSparkle, UpdateSquirrel, UpdateElectron, UpdateJSON:
+	default:
+		return errors.New(fmt.Sprintf("%s is not a valid update format", u.Format))
+	}
+
+	if u.Version == "" {
+		return errors.New("update requires a version")
+	}
+
+	if u.BinaryPath == "" || !path.IsAbs(u.BinaryPath) {
+		return errors.New(fmt.Sprintf("%s is not a valid binary_path", u.BinaryPath))
+	}
+
+	return nil
+}
+
+// updateManifest is the information about the binary written to manifests
+type updateManifest struct {
+	URL    string
+	Name   string
+	Size   int
+	SHA256 string
+	SHA512 string
+	Date   time.Time
+}
+
+type sparkleEnclosure struct {
+	URL          string `xml:"url,attr"`
+	Version      string `xml:"sparkle:version,attr"`
+	ShortVersion string `xml:"sparkle:shortVersionString,attr"`
+	Signature    string `xml:"sparkle:edSignature,attr,omitempty"`
+	Length       int    `xml:"length,attr"`
+	Type         string `xml:"type,attr"`
+}
+
+type sparkleItem struct {
+	Title       string           `xml:"title"`
+	Description string           `xml:"description,omitempty"`
+	PubDate     string           `xml:"pubDate"`
+	Enclosure   sparkleEnclosure `xml:"enclosure"`
+}
+
+type sparkleAppcast struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	XMLNS   string   `xml:"xmlns:sparkle,attr"`
+	Channel struct {
+		Title string      `xml:"title"`
+		Item  sparkleItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type electronFile struct {
+	URL    string `yaml:"url"`
+	SHA512 string `yaml:"sha512"`
+	Size   int    `yaml:"size"`
+}
+
+type electronLatest struct {
+	Version      string         `yaml:"version"`
+	Files        []electronFile `yaml:"files"`
+	Path         string         `yaml:"path"`
+	SHA512       string         `yaml:"sha512"`
+	ReleaseNotes string         `yaml:"releaseNotes,omitempty"`
+	ReleaseDate  string         `yaml:"releaseDate"`
+}
+
+// isUpdateBinary returns true when req is for the binary of an update path
+func (f *Path) isUpdateBinary(req *http.Request) bool {
+	return f.Update.Enabled() && req.URL != nil && req.URL.Path == f.Update.BinaryPath
+}
+
+// update serves the manifest or binary of an update path
+func (f *Path) update(w http.ResponseWriter, req *http.Request, root string) error {
+	data, err := ioutil.ReadFile(path.Join(root, f.HostedFile))
+	if err != nil {
+		return err
+	}
+
+	if f.isUpdateBinary(req) {
+		if f.ContentType == "" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, err := w.Write(data)
+		return err
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	sha256Sum := sha256.Sum256(data)
+	sha512Sum := sha512.Sum512(data)
+	manifest := updateManifest{
+		URL:    scheme + "://" + req.Host + f.Update.BinaryPath,
+		Name:   path.Base(f.Update.BinaryPath),
+		Size:   len(data),
+		SHA256: hex.EncodeToString(sha256Sum[:]),
+		SHA512: base64.StdEncoding.EncodeToString(sha512Sum[:]),
+		Date:   time.Now().UTC(),
+	}
+
+	var body []byte
+	switch f.Update.Format {
+	case UpdateSparkle:
+		w.Header().Set("Content-Type", "application/rss+xml")
+		body, err = f.Update.sparkle(manifest)
+	case UpdateSquirrel:
+		w.Header().Set("Content-Type", "application/json")
+		body, err = json.Marshal(map[string]string{
+			"url":      manifest.URL,
+			"name":     f.Update.Version,
+			"notes":    f.Update.Notes,
+			"pub_date": manifest.Date.Format(time.RFC3339),
+		})
+	case UpdateElectron:
+		w.Header().Set("Content-Type", "text/yaml")
+		body, err = yaml.Marshal(electronLatest{
+			Version:      f.Update.Version,
+			Files:        []electronFile{{URL: manifest.Name, SHA512: manifest.SHA512, Size: manifest.Size}},
+			Path:         manifest.Name,
+			SHA512:       manifest.SHA512,
+			ReleaseNotes: f.Update.Notes,
+			ReleaseDate:  manifest.Date.Format("2006-01-02T15:04:05.000Z"),
+		})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		body, err = json.Marshal(map[string]interface{}{
+			"version": f.Update.Version,
+			"url":     manifest.URL,
+			"sha256":  manifest.SHA256,
+			"size":    manifest.Size,
+			"notes":   f.Update.Notes,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+	return err
+}
+
+// sparkle creates a Sparkle appcast with a single item for the binary
+func (u UpdateConfig) sparkle(manifest updateManifest) ([]byte, error) {
+	var appcast sparkleAppcast
+	appcast.Version = "2.0"
+	appcast.XMLNS = "http://www.andymatuschak.org/xml-namespaces/sparkle"
+	appcast.Channel.Title = "Updates"
+	appcast.Channel.Item = sparkleItem{
+		Title:       "Version " + u.Version,
+		Description: u.Notes,
+		PubDate:     manifest.Date.Format(time.RFC1123Z),
+		Enclosure: sparkleEnclosure{
+			URL:          manifest.URL,
+			Version:      u.Version,
+			ShortVersion: u.Version,
+			Signature:    u.Signature,
+			Length:       manifest.Size,
+			Type:         "application/octet-stream",
+		},
+	}
+
+	body, err := xml.Marshal(appcast)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
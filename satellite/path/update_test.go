@@ -0,0 +1,113 @@
+package path_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+func TestPaths_MatchAndServe_update(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /update.json
+  hosted_file: payload
+  update:
+    format: json
+    version: 2.4.1
+    binary_path: /download/App-2.4.1.exe`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", uri, nil)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w
+	}
+
+	// The binary is only served to clients which fetched the manifest
+	if w := request("/download/App-2.4.1.exe"); w.Body.String() == Sentinal {
+		t.Error("binary was served before the manifest")
+	}
+
+	var manifest struct {
+		Version string `json:"version"`
+		URL     string `json:"url"`
+		Size    int    `json:"size"`
+	}
+	if err := json.Unmarshal(request("/update.json").Body.Bytes(), &manifest); err != nil {
+		t.Error(err)
+	}
+	if manifest.Version != "2.4.1" || manifest.URL != "http://example.com/download/App-2.4.1.exe" || manifest.Size != len(Sentinal) {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	if w := request("/download/App-2.4.1.exe"); w.Body.String() != Sentinal {
+		t.Error("binary was not served")
+	}
+}
+
+func TestPaths_MatchAndServe_update_sparkle(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /appcast.xml
+  hosted_file: payload
+  update:
+    format: sparkle
+    version: "3.1"
+    binary_path: /App-3.1.zip
+    signature: c2lnbmF0dXJl`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req := httptest.NewRequest("GET", "/appcast.xml", nil)
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+
+	body := w.Body.String()
+	for _, s := range []string{`url="http://example.com/App-3.1.zip"`, `sparkle:version="3.1"`, `sparkle:edSignature="c2lnbmF0dXJl"`, `length="8"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("appcast is missing %s", s)
+		}
+	}
+}
+
+func TestUpdateConfig_Validate(t *testing.T) {
+	valid := UpdateConfig{Format: UpdateElectron, Version: "1.0.0", BinaryPath: "/App.exe"}
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalid := []UpdateConfig{
+		{Format: "msi", Version: "1.0.0", BinaryPath: "/App.exe"},
+		{Format: UpdateSparkle, BinaryPath: "/App.exe"},
+		{Format: UpdateSquirrel, Version: "1.0.0", BinaryPath: "App.exe"},
+	}
+	for _, u := range invalid {
+		if err := u.Validate(); err == nil {
+			t.Errorf("%+v was valid", u)
+		}
+	}
+}
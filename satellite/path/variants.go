@@ -0,0 +1,145 @@
+package path
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// Variant is a lure URL rewritten so it looks different to filters but is routed to the same path
+type Variant struct {
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+}
+
+// URLVariants generates obfuscated variants of lure for testing which get past email
+// filters. Every variant is routed to the same path as lure. When cover is set, a
+// variant puts it in the userinfo so the URL appears to be for the cover host
+func URLVariants(lure, cover string) ([]Variant, error) {
+	u, err := url.Parse(lure)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New(fmt.Sprintf("%s is not a valid lure URL", lure))
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	variant := func(kind string, change func(v *url.URL)) Variant {
+		v := *u
+		change(&v)
+		return Variant{Kind: kind, URL: v.String()}
+	}
+	variants := []Variant{
+		variant("percent", func(v *url.URL) {
+			v.RawPath = encodePath(u.Path, func(i int, c byte) string {
+				return fmt.Sprintf("%%%02X", c)
+			})
+		}),
+		variant("mixed_case_percent", func(v *url.URL) {
+			v.RawPath = encodePath(u.Path, func(i int, c byte) string {
+				switch i % 3 {
+				case 0:
+					return fmt.Sprintf("%%%02x", c)
+				case 1:
+					return fmt.Sprintf("%%%02X", c)
+				}
+				return string(c)
+			})
+		}),
+		variant("host_case", func(v *url.URL) {
+			v.Host = alternateCase(u.Host)
+		}),
+		variant("duplicate_slash", func(v *url.URL) {
+			v.Path = strings.Replace(u.Path, "/", "//", -1)
+		}),
+		variant("dot_segment", func(v *url.URL) {
+			v.Path = "/." + u.Path
+		}),
+	}
+
+	// Userinfo is only safe to add when the lure does not use it and the cover can
+	// not change where the URL points
+	if cover != "" && u.User == nil {
+		if strings.ContainsAny(cover, "@/?#:\\") {
+			return nil, errors.New(fmt.Sprintf("%s is not a valid cover host", cover))
+		}
+		variants = append(variants, variant("userinfo", func(v *url.URL) {
+			v.User = url.User(cover)
+		}))
+	}
+	return variants, nil
+}
+
+// encodePath percent-encodes the letters and digits of p with encode, which is given
+// the index of the character among them. Slashes are kept so the path is routed the same
+func encodePath(p string, encode func(i int, c byte) string) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '/':
+			b.WriteByte(c)
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+			b.WriteString(encode(n, c))
+			n++
+		default:
+			b.WriteString(url.PathEscape(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// alternateCase alternates the case of the letters of s
+func alternateCase(s string) string {
+	b := []byte(s)
+	upper := true
+	for i, c := range b {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			continue
+		}
+		if upper {
+			b[i] = c &^ 0x20
+		} else {
+			b[i] = c | 0x20
+		}
+		upper = !upper
+	}
+	return string(b)
+}
+
+// normalizeURI removes dot segments and repeated slashes from uri, keeping a
+// trailing slash, so variants of a URL match the same path
+func normalizeURI(uri string) string {
+	if uri == "" {
+		return uri
+	}
+	clean := path.Clean("/" + uri)
+	if strings.HasSuffix(uri, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// normalizeRequest returns req with its URL path normalized by normalizeURI
+func normalizeRequest(req *http.Request) *http.Request {
+	if req.URL == nil {
+		return req
+	}
+	clean := normalizeURI(req.URL.Path)
+	if clean == req.URL.Path {
+		return req
+	}
+	normalized := req.WithContext(req.Context())
+	u := *req.URL
+	u.Path, u.RawPath = clean, ""
+	normalized.URL = &u
+	return normalized
+}
@@ -0,0 +1,97 @@
+package path_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/server"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+func TestURLVariants(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+
+	tmpdir.CreateIndexFile()
+	tmpdir.CreatePathListIndex("")
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Variants are sent to the handler the server uses, so any path cleaning before
+	// the paths are matched is tested too
+	srv, err := server.New(paths, server.SSL{}, util.NotFound{}, tmpdir.Path, ":0", "", "/index.html", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewTLSServer(srv.Handler())
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	lure := "https://example.com/index.html?id=1"
+	variants, err := URLVariants(lure, "login.example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 6 {
+		t.Errorf("expected 6 variants, got %d", len(variants))
+	}
+
+	for _, v := range variants {
+		if v.URL == lure {
+			t.Errorf("%s: URL was not changed", v.Kind)
+		}
+		if !strings.HasSuffix(v.URL, "?id=1") {
+			t.Errorf("%s: query was not kept in %s", v.Kind, v.URL)
+		}
+
+		u, err := url.Parse(v.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		host := u.Host
+		u.Host = ts.Listener.Addr().String()
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != Sentinal {
+			t.Errorf("%s: %s was not routed to /index.html, got %d", v.Kind, v.URL, resp.StatusCode)
+		}
+	}
+}
+
+func TestURLVariants_fail(t *testing.T) {
+	for _, tc := range []struct {
+		lure  string
+		cover string
+	}{
+		{"ftp://example.com/index.html", ""},
+		{"/index.html", ""},
+		{"https://example.com/index.html", "evil.example@"},
+	} {
+		if _, err := URLVariants(tc.lure, tc.cover); err == nil {
+			t.Errorf("%s with cover %q was accepted", tc.lure, tc.cover)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package path
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// DefaultWASMTimeout is how long a plugin may run when wasm.timeout is not set
+const DefaultWASMTimeout = time.Second
+
+// DefaultWASMMemoryMB is the memory a plugin may use when wasm.max_memory_mb is not set
+const DefaultWASMMemoryMB = 16
+
+// MaxWASMMemoryMB is the most memory a 32 bit WebAssembly module can address
+const MaxWASMMemoryMB = 4096
+
+// wasmPagesPerMB is the number of 64 KiB WebAssembly memory pages in a megabyte
+const wasmPagesPerMB = 16
+
+// wasmPlugin is a compiled condition plugin and the runtime it is compiled for
+//
+// Plugins are WebAssembly reactor modules, like TinyGo modules built with
+// -buildmode=c-shared or Rust cdylibs for wasm32-wasi, exporting:
+//
+//	allocate(size i32) i32 returning where size bytes can be written in its memory
+//	verdict(ptr i32, len i32) i32 returning 1 to serve the request
+//
+// verdict is given the JSON summary of the request external_auth authorizers are
+// sent. Plugins can use WASI, without access to files or the network
+type wasmPlugin struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	modified time.Time
+}
+
+var (
+	pluginsMu sync.Mutex
+	// plugins are compiled plugins by file and memory limit
+	plugins = make(map[string]*wasmPlugin)
+)
+
+// loadPlugin gets the plugin compiled from module, which is compiled again when the file changes
+func loadPlugin(module string, memoryMB uint32) (*wasmPlugin, error) {
+	info, err := os.Stat(module)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	key := fmt.Sprintf("%s|%d", module, memoryMB)
+	if plugin, ok := plugins[key]; ok && plugin.modified.Equal(info.ModTime()) {
+		return plugin, nil
+	}
+
+	binary, err := ioutil.ReadFile(module)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(memoryMB * wasmPagesPerMB)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, errors.Wrap(err, module)
+	}
+
+	// Requests still running the old plugin are denied
+	if old, ok := plugins[key]; ok {
+		old.runtime.Close(ctx)
+	}
+	plugin := &wasmPlugin{runtime: runtime, compiled: compiled, modified: info.ModTime()}
+	plugins[key] = plugin
+	return plugin, nil
+}
+
+// verdict runs the plugin with input in a new instance, so requests do not share memory
+func (p *wasmPlugin) verdict(ctx context.Context, input []byte) (bool, error) {
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, config)
+	if err != nil {
+		return false, err
+	}
+	defer mod.Close(ctx)
+
+	allocate, verdict := mod.ExportedFunction("allocate"), mod.ExportedFunction("verdict")
+	if allocate == nil || verdict == nil || mod.Memory() == nil {
+		return false, errors.New("plugin does not export allocate, verdict, and memory")
+	}
+
+	results, err := allocate.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return false, err
+	}
+	if len(results) != 1 {
+		return false, errors.New("allocate does not return a pointer")
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, input) {
+		return false, errors.New("allocate returned a pointer out of range")
+	}
+
+	results, err = verdict.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return false, err
+	}
+	if len(results) != 1 {
+		return false, errors.New("verdict does not return a verdict")
+	}
+	return uint32(results[0]) == 1, nil
+}
+
+// wasmMatch asks the WASM plugin of c whether to serve req
+func (c *RequestConditions) wasmMatch(req *http.Request, state *State, gip geoip.DB) bool {
+	if c.WASM.Module == "" || req.URL == nil {
+		return true
+	}
+
+	memoryMB := c.WASM.MaxMemoryMB
+	if memoryMB == 0 {
+		memoryMB = DefaultWASMMemoryMB
+	}
+	timeout := DefaultWASMTimeout
+	if c.WASM.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.WASM.Timeout)
+	}
+
+	plugin, err := loadPlugin(c.WASM.Module, memoryMB)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"module": c.WASM.Module,
+			"error":  err,
+		}).Error("Unable to load WASM plugin")
+		return false
+	}
+	input, err := json.Marshal(summarize(req, state, gip))
+	if err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	host, err := plugin.verdict(ctx, input)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"module": c.WASM.Module,
+			"error":  err,
+		}).Debug("WASM plugin failed")
+		return false
+	}
+	if !host {
+		log.WithFields(log.Fields{
+			"module": c.WASM.Module,
+			"ip":     req.RemoteAddr,
+		}).Debug("WASM plugin denied request")
+	}
+	return host
+}
@@ -0,0 +1,80 @@
+package path_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/geoip"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+// allowPlugin is a plugin whose verdict serves requests when it is given a JSON object
+var allowPlugin = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x1f, 0x03, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x08, 0x61, 0x6c, 0x6c,
+	0x6f, 0x63, 0x61, 0x74, 0x65, 0x00, 0x00, 0x07, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74, 0x00,
+	0x01, 0x0a, 0x13, 0x02, 0x05, 0x00, 0x41, 0x80, 0x08, 0x0b, 0x0b, 0x00, 0x20, 0x00, 0x2d, 0x00,
+	0x00, 0x41, 0xfb, 0x00, 0x46, 0x0b,
+}
+
+// denyPlugin is a plugin whose verdict denies every request
+var denyPlugin = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01, 0x00, 0x01,
+	0x07, 0x1f, 0x03, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00, 0x08, 0x61, 0x6c, 0x6c,
+	0x6f, 0x63, 0x61, 0x74, 0x65, 0x00, 0x00, 0x07, 0x76, 0x65, 0x72, 0x64, 0x69, 0x63, 0x74, 0x00,
+	0x01, 0x0a, 0x0c, 0x02, 0x05, 0x00, 0x41, 0x80, 0x08, 0x0b, 0x04, 0x00, 0x41, 0x00, 0x0b,
+}
+
+func TestRequestConditions_ShouldHost_wasm(t *testing.T) {
+	state, file, err := TemporaryDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveDB(file)
+
+	dir, err := ioutil.TempDir("", "satellite-wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, plugin := range map[string][]byte{"allow.wasm": allowPlugin, "deny.wasm": denyPlugin} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), plugin, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		module string
+		hosted bool
+	}{
+		{"allow.wasm", true},
+		{"deny.wasm", false},
+		{"missing.wasm", false},
+	} {
+		conditions, err := NewRequestConditions([]byte(fmt.Sprintf("wasm:\n  module: %s", filepath.Join(dir, tc.module))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, _ := http.NewRequest("GET", "/stage", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if hosted := conditions.ShouldHost(req, state, geoip.DB{}); hosted != tc.hosted {
+			t.Errorf("%s: expected hosted %t, got %t", tc.module, tc.hosted, hosted)
+		}
+	}
+}
+
+func TestNewRequestConditions_wasm_fail(t *testing.T) {
+	if _, err := NewRequestConditions([]byte("wasm:\n  module: plugin.wasm\n  max_memory_mb: 8192")); err == nil {
+		t.Error("max_memory_mb larger than a module can address was accepted")
+	}
+	if _, err := NewRequestConditions([]byte("wasm:\n  module: plugin.wasm\n  timeout: never")); err == nil {
+		t.Error("invalid timeout was accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package path
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/t94j0/satellite/net/http"
+)
+
+// webdavAllow are the methods answered by WebDAV paths
+const webdavAllow = "OPTIONS, GET, HEAD, PROPFIND"
+
+type davProp struct {
+	DisplayName   string        `xml:"D:displayname"`
+	ResourceType  davCollection `xml:"D:resourcetype"`
+	ContentLength string        `xml:"D:getcontentlength,omitempty"`
+	ContentType   string        `xml:"D:getcontenttype,omitempty"`
+	LastModified  string        `xml:"D:getlastmodified,omitempty"`
+}
+
+type davCollection struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+type davResponse struct {
+	Href     string `xml:"D:href"`
+	PropStat struct {
+		Prop   davProp `xml:"D:prop"`
+		Status string  `xml:"D:status"`
+	} `xml:"D:propstat"`
+}
+
+type davMultistatus struct {
+	XMLName  xml.Name      `xml:"D:multistatus"`
+	XMLNS    string        `xml:"xmlns:D,attr"`
+	Response []davResponse `xml:"D:response"`
+}
+
+// webdavOptions advertises WebDAV support so clients like the Windows
+// WebClient service mount the path
+func webdavOptions(w http.ResponseWriter) {
+	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.Header().Set("Allow", webdavAllow)
+	w.WriteHeader(http.StatusOK)
+}
+
+// webdavPropfind writes the properties of a single resource. Collections never
+// list their members so the names of other files are not disclosed
+func webdavPropfind(w http.ResponseWriter, href string, prop davProp) error {
+	var response davResponse
+	response.Href = href
+	response.PropStat.Prop = prop
+	response.PropStat.Status = "HTTP/1.1 200 OK"
+
+	body, err := xml.Marshal(davMultistatus{XMLNS: "DAV:", Response: []davResponse{response}})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// webdavMetadata returns true when req only asks about the file, so it is not counted as a hit
+func (f *Path) webdavMetadata(req *http.Request) bool {
+	return f.WebDAV && (req.Method == http.MethodOptions || req.Method == "PROPFIND" || req.Method == http.MethodHead)
+}
+
+// webdav answers the WebDAV methods of a path. GET is served like any other path
+func (f *Path) webdav(w http.ResponseWriter, req *http.Request, root string) error {
+	switch req.Method {
+	case http.MethodOptions:
+		webdavOptions(w)
+		return nil
+	case "PROPFIND", http.MethodHead:
+	default:
+		w.Header().Set("Allow", webdavAllow)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	info, err := os.Stat(path.Join(root, f.HostedFile))
+	if err != nil {
+		return err
+	}
+
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if req.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		w.Header().Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	return webdavPropfind(w, req.URL.Path, davProp{
+		DisplayName:   path.Base(req.URL.Path),
+		ContentLength: strconv.FormatInt(info.Size(), 10),
+		ContentType:   contentType,
+		LastModified:  info.ModTime().UTC().Format(http.TimeFormat),
+	})
+}
+
+// webdavDir gets the directory a WebDAV path is in, up to its first glob
+func webdavDir(p string) string {
+	if i := strings.IndexAny(p, "*?[{"); i >= 0 {
+		p = p[:i]
+		if j := strings.LastIndex(p, "/"); j >= 0 {
+			return p[:j+1]
+		}
+		return "/"
+	}
+	return path.Dir(p)
+}
+
+// webdavCollection answers OPTIONS and PROPFIND for the directories containing
+// WebDAV paths, which clients walk before requesting a file. It returns true
+// when req was answered
+func (paths *Paths) webdavCollection(w http.ResponseWriter, req *http.Request) (bool, error) {
+	if req.Method != http.MethodOptions && req.Method != "PROPFIND" {
+		return false, nil
+	}
+
+	uri := strings.TrimSuffix(req.URL.Path, "/")
+	found := false
+	for _, p := range paths.pathList() {
+		if !p.WebDAV {
+			continue
+		}
+		dir := strings.TrimSuffix(webdavDir(p.Path), "/")
+		if dir == uri || strings.HasPrefix(dir, uri+"/") {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	if req.Method == http.MethodOptions {
+		webdavOptions(w)
+		return true, nil
+	}
+
+	return true, webdavPropfind(w, uri+"/", davProp{
+		DisplayName:  path.Base(uri + "/"),
+		ResourceType: davCollection{Collection: &struct{}{}},
+		LastModified: time.Now().UTC().Format(http.TimeFormat),
+	})
+}
@@ -0,0 +1,101 @@
+package path_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/t94j0/satellite/net/http/httptest"
+
+	. "github.com/t94j0/satellite/satellite/path"
+)
+
+const webdavClient = "Microsoft-WebDAV-MiniRedir/10.0.19045"
+
+func TestPaths_MatchAndServe_webdav(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /share/payload.exe
+  hosted_file: payload
+  webdav: true
+  serve: 1
+  authorized_useragents:
+    - ^Microsoft-WebDAV-MiniRedir/`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	request := func(method, uri string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, nil)
+		req.Header.Set("User-Agent", webdavClient)
+		w := httptest.NewRecorder()
+		if _, err := paths.MatchAndServe(w, req); err != nil {
+			t.Error(err)
+		}
+		return w
+	}
+
+	if w := request("OPTIONS", "/"); w.Code != http.StatusOK || w.Header().Get("DAV") == "" {
+		t.Error("WebDAV was not advertised")
+	}
+
+	w := request("PROPFIND", "/share")
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<D:collection></D:collection>") {
+		t.Error("share was not a collection")
+	}
+	if strings.Contains(w.Body.String(), "payload.exe") {
+		t.Error("share listed its files")
+	}
+
+	w = request("PROPFIND", "/share/payload.exe")
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<D:getcontentlength>8</D:getcontentlength>") {
+		t.Error("file properties were not returned")
+	}
+
+	// Looking up the file does not use up its serve limit
+	if w := request("GET", "/share/payload.exe"); w.Body.String() != Sentinal {
+		t.Error("file was not served")
+	}
+	if w := request("GET", "/share/payload.exe"); w.Body.String() == Sentinal {
+		t.Error("serve limit was not applied")
+	}
+
+	if w := request("PROPFIND", "/other"); w.Code == http.StatusMultiStatus {
+		t.Error("unrelated directory was a collection")
+	}
+}
+
+func TestPaths_MatchAndServe_webdav_client(t *testing.T) {
+	tmpdir, err := NewTempDir()
+	if err != nil {
+		t.Error(err)
+	}
+	defer tmpdir.Close()
+	tmpdir.CreateFile("payload", Sentinal)
+	tmpdir.CreatePathList(`- path: /share/payload.exe
+  hosted_file: payload
+  webdav: true
+  authorized_useragents:
+    - ^Microsoft-WebDAV-MiniRedir/`)
+
+	paths, err := NewDefaultTest(tmpdir.Path)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/share/payload.exe", nil)
+	req.Header.Set("User-Agent", "curl/7.68.0")
+	w := httptest.NewRecorder()
+	if _, err := paths.MatchAndServe(w, req); err != nil {
+		t.Error(err)
+	}
+	if w.Code == http.StatusMultiStatus {
+		t.Error("file was described to a client which is not WebDAV")
+	}
+}
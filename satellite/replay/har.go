@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/net/http"
+)
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			Request         struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ReadHAR reads the requests in a HAR file. HAR files do not record the client
+// address, so every request is made from remoteAddr
+func ReadHAR(r io.Reader, remoteAddr string) ([]Entry, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, errors.Wrap(err, "invalid HAR file")
+	}
+
+	entries := make([]Entry, 0, len(har.Log.Entries))
+	for _, e := range har.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid HAR request URL")
+		}
+
+		header := make(http.Header)
+		for _, h := range e.Request.Headers {
+			// HTTP/2 pseudo headers are not HTTP/1 headers
+			if strings.HasPrefix(h.Name, ":") {
+				continue
+			}
+			header.Add(h.Name, h.Value)
+		}
+
+		entries = append(entries, Entry{
+			Time:       e.StartedDateTime,
+			RemoteAddr: remoteAddr,
+			Method:     e.Request.Method,
+			URI:        u.RequestURI(),
+			Host:       u.Host,
+			Header:     header,
+			Body:       []byte(e.Request.PostData.Text),
+			TLS:        u.Scheme == "https",
+			ServerName: u.Hostname(),
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,330 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+)
+
+// ErrNotPcap is returned when a file is not a pcap capture
+var ErrNotPcap = errors.New("not a pcap file")
+
+// Link types of supported captures
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLinuxSLL = 113
+)
+
+// segment is TCP payload captured at a time
+type segment struct {
+	seq     uint32
+	time    time.Time
+	payload []byte
+}
+
+// flow is one direction of a TCP connection
+type flow struct {
+	src      string
+	segments []segment
+}
+
+// ReadPcap reads the plaintext HTTP requests in a pcap capture. TLS connections
+// cannot be decrypted, so they are read as one encrypted entry with the JA3
+// fingerprint and server name of their client hello, and counted in encrypted
+func ReadPcap(r io.Reader) (entries []Entry, encrypted int, err error) {
+	flows, err := readFlows(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, f := range flows {
+		data, times := f.assemble()
+		if len(data) == 0 {
+			continue
+		}
+		// TLS handshake record
+		if data[0] == 0x16 && len(data) > 1 && data[1] == 0x03 {
+			encrypted++
+			entry := Entry{RemoteAddr: f.src, TLS: true, Encrypted: true}
+			if len(times) != 0 {
+				entry.Time = times[0].time
+			}
+			entry.JA3, entry.ServerName, _ = clientHello(data)
+			entries = append(entries, entry)
+			continue
+		}
+		entries = append(entries, f.requests(data, times)...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, encrypted, nil
+}
+
+// readFlows reads the TCP payloads of a capture grouped by flow
+func readFlows(r io.Reader) ([]*flow, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrNotPcap
+	}
+
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4:
+		order = binary.LittleEndian
+	case 0xa1b23c4d:
+		order, nano = binary.LittleEndian, true
+	case 0xd4c3b2a1:
+		order = binary.BigEndian
+	case 0x4d3cb2a1:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, ErrNotPcap
+	}
+	linkType := order.Uint32(header[20:])
+
+	flows := make(map[string]*flow)
+	list := make([]*flow, 0)
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "truncated pcap record")
+		}
+
+		sec, frac := int64(order.Uint32(record)), int64(order.Uint32(record[4:]))
+		if !nano {
+			frac *= 1000
+		}
+		ts := time.Unix(sec, frac)
+
+		packet := make([]byte, order.Uint32(record[8:]))
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return nil, errors.Wrap(err, "truncated pcap packet")
+		}
+
+		src, dst, seg, ok := parsePacket(linkType, packet)
+		if !ok || len(seg.payload) == 0 {
+			continue
+		}
+		seg.time = ts
+
+		key := src + ">" + dst
+		f, exists := flows[key]
+		if !exists {
+			f = &flow{src: src}
+			flows[key] = f
+			list = append(list, f)
+		}
+		f.segments = append(f.segments, seg)
+	}
+
+	return list, nil
+}
+
+// parsePacket gets the addresses and TCP segment of a captured packet
+func parsePacket(linkType uint32, data []byte) (string, string, segment, bool) {
+	var seg segment
+
+	// Find the IP header
+	switch linkType {
+	case linkNull:
+		if len(data) < 4 {
+			return "", "", seg, false
+		}
+		data = data[4:]
+	case linkEthernet:
+		if len(data) < 14 {
+			return "", "", seg, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// 802.1Q VLAN tag
+		if etherType == 0x8100 && len(data) >= 4 {
+			data = data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return "", "", seg, false
+		}
+		data = data[16:]
+	case linkRaw:
+	default:
+		return "", "", seg, false
+	}
+	if len(data) < 1 {
+		return "", "", seg, false
+	}
+
+	var srcIP, dstIP net.IP
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return "", "", seg, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if data[9] != 6 || len(data) < ihl || total < ihl {
+			return "", "", seg, false
+		}
+		if total < len(data) {
+			data = data[:total]
+		}
+		srcIP, dstIP = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[ihl:]
+	case 6:
+		if len(data) < 40 || data[6] != 6 {
+			return "", "", seg, false
+		}
+		srcIP, dstIP = net.IP(data[8:24]), net.IP(data[24:40])
+		payloadLen := int(binary.BigEndian.Uint16(data[4:]))
+		data = data[40:]
+		if payloadLen < len(data) {
+			data = data[:payloadLen]
+		}
+	default:
+		return "", "", seg, false
+	}
+
+	// TCP header
+	if len(data) < 20 {
+		return "", "", seg, false
+	}
+	srcPort := binary.BigEndian.Uint16(data)
+	dstPort := binary.BigEndian.Uint16(data[2:])
+	offset := int(data[12]>>4) * 4
+	if len(data) < offset {
+		return "", "", seg, false
+	}
+	seg.seq = binary.BigEndian.Uint32(data[4:])
+	seg.payload = append([]byte(nil), data[offset:]...)
+
+	src := net.JoinHostPort(srcIP.String(), strconv.Itoa(int(srcPort)))
+	dst := net.JoinHostPort(dstIP.String(), strconv.Itoa(int(dstPort)))
+	return src, dst, seg, true
+}
+
+// stamp is the time the bytes from offset of a flow were captured
+type stamp struct {
+	offset int
+	time   time.Time
+}
+
+// assemble orders the flow's segments and drops retransmitted data
+func (f *flow) assemble() ([]byte, []stamp) {
+	if len(f.segments) == 0 {
+		return nil, nil
+	}
+
+	// The lowest sequence number, allowing for wraparound
+	base := f.segments[0].seq
+	for _, s := range f.segments {
+		if int32(s.seq-base) < 0 {
+			base = s.seq
+		}
+	}
+	sort.SliceStable(f.segments, func(i, j int) bool {
+		return f.segments[i].seq-base < f.segments[j].seq-base
+	})
+
+	var data bytes.Buffer
+	times := make([]stamp, 0, len(f.segments))
+	next := uint32(0)
+	for _, s := range f.segments {
+		start := s.seq - base
+		end := start + uint32(len(s.payload))
+		if end <= next {
+			continue
+		}
+		// Missing data ends the stream
+		if start > next {
+			break
+		}
+		times = append(times, stamp{offset: data.Len(), time: s.time})
+		data.Write(s.payload[next-start:])
+		next = end
+	}
+
+	return data.Bytes(), times
+}
+
+// requests parses the HTTP requests sent in a flow
+func (f *flow) requests(data []byte, times []stamp) []Entry {
+	entries := make([]Entry, 0)
+	reader := bytes.NewReader(data)
+	buf := bufio.NewReader(reader)
+	for {
+		req, err := http.ReadRequest(buf)
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		end := len(data) - reader.Len() - buf.Buffered()
+
+		entry := Entry{
+			RemoteAddr: f.src,
+			Method:     req.Method,
+			URI:        req.RequestURI,
+			Host:       req.Host,
+			Header:     req.Header,
+			Body:       body,
+		}
+		// A request is made once its last segment is captured
+		for _, t := range times {
+			if t.offset >= end {
+				break
+			}
+			if t.time.After(entry.Time) {
+				entry.Time = t.time
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// errClientHello stops a handshake once the client hello is read
+var errClientHello = errors.New("client hello read")
+
+// helloConn is a connection replaying a captured client flow. Writes are discarded
+type helloConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c helloConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c helloConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c helloConn) Close() error                       { return nil }
+func (c helloConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c helloConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c helloConn) SetDeadline(t time.Time) error      { return nil }
+func (c helloConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c helloConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// clientHello gets the JA3 fingerprint and server name of the client hello at
+// the start of a TLS flow, fingerprinted like the server does
+func clientHello(data []byte) (ja3, serverName string, ok bool) {
+	conn := tls.Server(helloConn{r: bytes.NewReader(data)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			ja3, serverName, ok = hello.JA3(), hello.ServerName, true
+			return nil, errClientHello
+		},
+	})
+	conn.Handshake()
+	return ja3, serverName, ok
+}
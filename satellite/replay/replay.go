@@ -0,0 +1,133 @@
+package replay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/path"
+)
+
+// Decisions made for a replayed request
+const (
+	DecisionServed      = path.DecisionServed
+	DecisionDenied      = path.DecisionDenied
+	DecisionRateLimited = path.DecisionRateLimited
+	DecisionOutOfScope  = "out_of_scope"
+	DecisionEncrypted   = "encrypted"
+	DecisionNotFound    = "not_found"
+	DecisionError       = "error"
+)
+
+// Entry is a captured request
+type Entry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	URI        string
+	Host       string
+	Header     http.Header
+	Body       []byte
+	// TLS is set when the request was made over TLS to ServerName
+	TLS        bool
+	ServerName string
+	// JA3 is the JA3 fingerprint of the client hello, when captured
+	JA3 string
+	// Encrypted is set for TLS connections whose requests cannot be read
+	Encrypted bool
+}
+
+// Request creates the HTTP request for the entry
+func (e Entry) Request() (*http.Request, error) {
+	req, err := http.NewRequest(e.Method, e.URI, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+	if e.Header != nil {
+		req.Header = e.Header
+	}
+	req.Host = e.Host
+	req.RemoteAddr = e.RemoteAddr
+	if e.TLS {
+		req.TLS = &tls.ConnectionState{HandshakeComplete: true, ServerName: e.ServerName}
+		req.JA3Fingerprint = e.JA3
+	}
+	return req, nil
+}
+
+// Result is the decision made for a replayed request
+type Result struct {
+	Entry
+	// Path is the matched path
+	Path     string
+	Decision string
+	Error    error
+}
+
+// Run replays entries in order through scope and the conditions of paths, as
+// if each was made at its captured time. scope may be nil
+func Run(paths *path.Paths, entries []Entry, scope *handlers.Scope) []Result {
+	results := make([]Result, 0, len(entries))
+	for _, e := range entries {
+		result := Result{Entry: e}
+
+		if scope.Violation(e.RemoteAddr, paths.GeoIP()) != "" {
+			result.Decision = DecisionOutOfScope
+			results = append(results, result)
+			continue
+		}
+		if e.Encrypted {
+			result.Decision = DecisionEncrypted
+			results = append(results, result)
+			continue
+		}
+
+		req, err := e.Request()
+		if err != nil {
+			result.Decision = DecisionError
+			result.Error = err
+			results = append(results, result)
+			continue
+		}
+
+		matchedPath, decision, err := paths.Decide(req, e.Time)
+		switch {
+		case err != nil:
+			result.Decision = DecisionError
+			result.Error = err
+		case matchedPath == nil:
+			result.Decision = DecisionNotFound
+		default:
+			result.Decision = decision
+		}
+		if matchedPath != nil {
+			result.Path = matchedPath.Path
+		}
+
+		results = append(results, result)
+	}
+	return results
+}
+
+// NewPaths loads the paths in serverRoot with empty state, so replays do not
+// change the state of the live instance
+func NewPaths(serverRoot, gcp string) (*path.Paths, func(), error) {
+	dir, err := ioutil.TempDir("", "satellite-replay")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths, err := path.New(serverRoot, "pathList.yml", dir, gcp)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	// Operators are not asked to approve replayed requests
+	paths.Approvals().OnRequest(nil)
+
+	return paths, func() { os.RemoveAll(dir) }, nil
+}
@@ -0,0 +1,212 @@
+package replay_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/t94j0/satellite/crypto/tls"
+	"github.com/t94j0/satellite/satellite/handlers"
+	. "github.com/t94j0/satellite/satellite/replay"
+)
+
+// tcpPacket creates an Ethernet frame with an IPv4 TCP segment
+func tcpPacket(src, dst [4]byte, srcPort, dstPort uint16, seq uint32, payload string) []byte {
+	var b bytes.Buffer
+	b.Write(make([]byte, 12))
+	b.Write([]byte{0x08, 0x00})
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(40+len(payload)))
+	ip[9] = 6
+	copy(ip[12:], src[:])
+	copy(ip[16:], dst[:])
+	b.Write(ip)
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp, srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	b.Write(tcp)
+	b.WriteString(payload)
+	return b.Bytes()
+}
+
+func pcapFile(packets ...[]byte) []byte {
+	var b bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, 0xa1b2c3d4)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	b.Write(header)
+	for i, p := range packets {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record, uint32(1600000000+i))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(p)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(p)))
+		b.Write(record)
+		b.Write(p)
+	}
+	return b.Bytes()
+}
+
+func TestReadPcap(t *testing.T) {
+	client, server := [4]byte{10, 0, 0, 5}, [4]byte{10, 0, 0, 1}
+	first := "GET /payload HTTP/1.1\r\nHost: example.com\r\n"
+	second := "User-Agent: implant\r\n\r\nPOST /login HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\n\r\nuser"
+
+	data := pcapFile(
+		tcpPacket(client, server, 40000, 80, 1000+uint32(len(first)), second),
+		tcpPacket(client, server, 40000, 80, 1000, first),
+		// Retransmission
+		tcpPacket(client, server, 40000, 80, 1000, first),
+		// Response
+		tcpPacket(server, client, 80, 40000, 5000, "HTTP/1.1 200 OK\r\n\r\n"),
+		// TLS connection
+		tcpPacket(client, server, 40001, 443, 1, "\x16\x03\x01\x00\x05hello"),
+	)
+
+	entries, encrypted, err := ReadPcap(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != 1 {
+		t.Error("TLS connection was not counted:", encrypted)
+	}
+	if len(entries) != 3 {
+		t.Fatal("expected 3 entries, got", len(entries))
+	}
+	if !entries[2].Encrypted || entries[2].RemoteAddr != "10.0.0.5:40001" {
+		t.Error("TLS connection was not read:", entries[2])
+	}
+	if entries[0].URI != "/payload" || entries[0].Header.Get("User-Agent") != "implant" || entries[0].RemoteAddr != "10.0.0.5:40000" {
+		t.Error("first request was not reassembled:", entries[0])
+	}
+	if entries[1].Method != "POST" || string(entries[1].Body) != "user" {
+		t.Error("second request was not read:", entries[1])
+	}
+}
+
+// helloRecorder records what a client writes and fails every read
+type helloRecorder struct {
+	net.Conn
+	bytes.Buffer
+}
+
+func (c *helloRecorder) Read(b []byte) (int, error)  { return 0, io.EOF }
+func (c *helloRecorder) Write(b []byte) (int, error) { return c.Buffer.Write(b) }
+func (c *helloRecorder) Close() error                { return nil }
+
+func TestReadPcap_clientHello(t *testing.T) {
+	conn := &helloRecorder{}
+	tls.Client(conn, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}).Handshake()
+
+	data := pcapFile(tcpPacket([4]byte{10, 0, 0, 5}, [4]byte{10, 0, 0, 1}, 40001, 443, 1, conn.String()))
+	entries, encrypted, err := ReadPcap(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != 1 || len(entries) != 1 {
+		t.Fatal("expected 1 TLS connection, got", len(entries))
+	}
+	if entries[0].ServerName != "example.com" || entries[0].JA3 == "" {
+		t.Error("client hello was not fingerprinted:", entries[0])
+	}
+}
+
+func TestReadPcap_notpcap(t *testing.T) {
+	if _, _, err := ReadPcap(strings.NewReader("{}")); err != ErrNotPcap {
+		t.Fail()
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "payload"), []byte("payload"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "pathList.yml"), []byte(`- path: /payload
+  authorized_useragents:
+    - ^implant$
+  serve: 1`), 0666)
+
+	har := `{"log": {"entries": [
+		{"startedDateTime": "2020-01-01T00:00:00Z", "request": {"method": "GET", "url": "https://example.com/payload", "headers": [{"name": "User-Agent", "value": "implant"}, {"name": ":authority", "value": "example.com"}]}},
+		{"startedDateTime": "2020-01-01T00:00:01Z", "request": {"method": "GET", "url": "https://example.com/payload", "headers": [{"name": "User-Agent", "value": "implant"}]}},
+		{"startedDateTime": "2020-01-01T00:00:02Z", "request": {"method": "GET", "url": "https://example.com/missing?a=b", "headers": []}}
+	]}}`
+	entries, err := ReadHAR(strings.NewReader(har), "10.0.0.5:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, done, err := NewPaths(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+
+	results := Run(paths, entries, nil)
+	expected := []string{DecisionServed, DecisionDenied, DecisionNotFound}
+	for i, r := range results {
+		if r.Decision != expected[i] {
+			t.Error(r.URI, "expected", expected[i], "got", r.Decision)
+		}
+	}
+
+	// Replays do not change the server root's state
+	if _, err := os.Stat(filepath.Join(dir, ".db")); err == nil {
+		t.Error("replay used the live state")
+	}
+}
+
+func TestRun_captureTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "payload"), []byte("payload"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "pathList.yml"), []byte(`- path: /payload
+  serve_before: 2020-01-01T00:00:01Z
+  rate_limit:
+    requests: 1
+    per: 1h`), 0666)
+
+	paths, done, err := NewPaths(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	scope, err := handlers.NewScope([]string{"10.0.0.0/8"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []Entry{
+		{Time: start, RemoteAddr: "10.0.0.5:0", Method: "GET", URI: "/payload", TLS: true, ServerName: "example.com"},
+		{Time: start, RemoteAddr: "10.0.0.5:0", Method: "GET", URI: "/payload"},
+		{Time: start.Add(2 * time.Second), RemoteAddr: "10.0.0.6:0", Method: "GET", URI: "/payload"},
+		{Time: start, RemoteAddr: "192.0.2.1:0", Method: "GET", URI: "/payload"},
+		{Time: start, RemoteAddr: "10.0.0.7:0", TLS: true, Encrypted: true},
+	}
+
+	results := Run(paths, entries, scope)
+	expected := []string{DecisionServed, DecisionRateLimited, DecisionDenied, DecisionOutOfScope, DecisionEncrypted}
+	for i, r := range results {
+		if r.Decision != expected[i] {
+			t.Error(i, "expected", expected[i], "got", r.Decision)
+		}
+	}
+}
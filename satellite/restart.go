@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/server"
+)
+
+// restartTimeout is how long active requests have to finish before restarting
+const restartTimeout = 30 * time.Second
+
+// gracefulRestart shuts down srv when restart is received. done is closed once
+// active requests have finished and the process can be replaced
+func gracefulRestart(srv server.Server, restart <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-restart
+		log.Info("Restarting")
+		ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Requests did not finish before restart")
+		}
+		close(done)
+	}()
+	return done
+}
+
+// execSelf replaces the process with the satellite binary on disk
+func execSelf() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/logfile"
+	"github.com/t94j0/satellite/satellite/retention"
+)
+
+// defaultRetentionInterval is how often old data is purged when retention.interval is not set
+const defaultRetentionInterval = time.Hour
+
+// purge purges data older than retention.days, or the retention period of its
+// campaign, and the rotated logs older than retention.days. A signed receipt is
+// written when anything was purged. Failed purges are logged without a receipt
+func purge(config *Configuration, paths pathSet, logs []*logfile.File) {
+	now := time.Now()
+	// The zero cutoff keeps data forever
+	var cutoff time.Time
+	if config.Retention.Days > 0 {
+		cutoff = now.AddDate(0, 0, -config.Retention.Days)
+	}
+	campaigns := make(map[string]time.Time, len(config.Retention.Campaigns))
+	for campaign, days := range config.Retention.Campaigns {
+		campaigns[campaign] = now.AddDate(0, 0, -days)
+	}
+
+	purged, err := paths.Purge(cutoff, campaigns)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"purged": purged,
+		}).Error("Unable to purge state. No purge receipt was written")
+		return
+	}
+	for _, l := range logs {
+		n, err := l.Purge(cutoff)
+		purged["logs"] += n
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":  err,
+				"purged": purged,
+			}).Error("Unable to purge logs. No purge receipt was written")
+			return
+		}
+	}
+	log.WithFields(log.Fields{
+		"cutoff": cutoff,
+		"purged": purged,
+	}).Debug("Purged data older than the retention period")
+
+	total := 0
+	for _, n := range purged {
+		total += n
+	}
+	if config.Retention.Receipts == "" || total == 0 {
+		return
+	}
+	key, err := retention.ParsePrivateKey(config.Retention.SigningKey)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	receipt := retention.NewReceipt(cutoff, purged)
+	if len(campaigns) != 0 {
+		receipt.Campaigns = make(map[string]time.Time, len(campaigns))
+		for campaign, c := range campaigns {
+			receipt.Campaigns[campaign] = c.UTC()
+		}
+	}
+	if err := receipt.Sign(key); err != nil {
+		log.Error(err)
+		return
+	}
+	if _, err := receipt.Write(config.Retention.Receipts); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to write purge receipt")
+	}
+}
+
+// purgeRetention purges old data every retention.interval
+func purgeRetention(config *Configuration, paths pathSet, logs []*logfile.File) {
+	interval, err := time.ParseDuration(config.Retention.Interval)
+	if err != nil {
+		interval = defaultRetentionInterval
+	}
+
+	for {
+		purge(config, paths, logs)
+		time.Sleep(interval)
+	}
+}
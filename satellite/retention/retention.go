@@ -0,0 +1,139 @@
+package retention
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrBadSignature is returned when a purge receipt does not match its signature
+var ErrBadSignature = errors.New("purge receipt signature does not match")
+
+// ErrNoPrivateKey is returned when no key is configured to sign purge receipts
+var ErrNoPrivateKey = errors.New("no private key to sign purge receipts")
+
+// Receipt records a purge of data older than the retention period, so the
+// engagement can show collected data was destroyed on schedule
+type Receipt struct {
+	// Host is the hostname of the instance which purged the data
+	Host string    `json:"host"`
+	Time time.Time `json:"time"`
+	// Cutoff is the time data collected before was purged
+	Cutoff time.Time `json:"cutoff"`
+	// Campaigns are the cutoffs of the campaigns kept for their own retention period
+	Campaigns map[string]time.Time `json:"campaigns,omitempty"`
+	// Purged is the number of records purged by kind
+	Purged map[string]int `json:"purged"`
+	// Signature is the base64 encoded ed25519 signature of the receipt without the signature
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewReceipt creates an unsigned receipt of a purge of data before cutoff
+func NewReceipt(cutoff time.Time, purged map[string]int) Receipt {
+	host, _ := os.Hostname()
+	return Receipt{
+		Host:   host,
+		Time:   time.Now().UTC(),
+		Cutoff: cutoff.UTC(),
+		Purged: purged,
+	}
+}
+
+// GenerateKey creates a base64 encoded ed25519 key pair for signing purge receipts
+func GenerateKey() (public, private string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(pub), base64.StdEncoding.EncodeToString(priv), nil
+}
+
+// ParsePrivateKey parses a base64 encoded ed25519 private key
+func ParsePrivateKey(key string) (ed25519.PrivateKey, error) {
+	if key == "" {
+		return nil, ErrNoPrivateKey
+	}
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+	if len(data) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid private key length")
+	}
+	return ed25519.PrivateKey(data), nil
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key length")
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// signed gets the bytes of the receipt covered by the signature
+func (r Receipt) signed() ([]byte, error) {
+	r.Signature = ""
+	return json.Marshal(r)
+}
+
+// Sign signs the receipt with key
+func (r *Receipt) Sign(key ed25519.PrivateKey) error {
+	data, err := r.signed()
+	if err != nil {
+		return err
+	}
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// Verify checks the receipt was signed by the private key of key and not modified
+func (r Receipt) Verify(key ed25519.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid receipt signature")
+	}
+	data, err := r.signed()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Write writes the receipt to a new file in dir and returns the file name
+func (r Receipt) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("purge-%s.json", r.Time.Format("20060102T150405Z")))
+	return name, ioutil.WriteFile(name, append(data, '\n'), 0600)
+}
+
+// Read reads the receipt in the file name
+func Read(name string) (Receipt, error) {
+	var r Receipt
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(data, &r)
+}
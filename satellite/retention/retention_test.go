@@ -0,0 +1,62 @@
+package retention_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/t94j0/satellite/satellite/retention"
+)
+
+func TestReceipt_Verify(t *testing.T) {
+	public, private, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ParsePrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParsePublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "satellitetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	receipt := NewReceipt(time.Now().AddDate(0, 0, -30), map[string]int{"hits": 3})
+	if err := receipt.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	name, err := receipt.Write(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := read.Verify(pub); err != nil {
+		t.Error(err)
+	}
+
+	read.Purged["hits"] = 0
+	if err := read.Verify(pub); err != ErrBadSignature {
+		t.Error("modified receipt was verified")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	if _, err := ParsePrivateKey(""); err != ErrNoPrivateKey {
+		t.Error("empty key was parsed")
+	}
+	if _, err := ParsePrivateKey("c2hvcnQ="); err == nil {
+		t.Error("short key was parsed")
+	}
+}
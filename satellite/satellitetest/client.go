@@ -0,0 +1,101 @@
+package satellitetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Header is a request header. Headers are sent in the order they are given
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Client sends requests to a satellite instance
+type Client struct {
+	// Addr is the host:port of the satellite instance
+	Addr string
+	// TLS configures the handshake. Cipher suites, curves, versions, and ALPN
+	// protocols change the JA3 fingerprint the server sees
+	TLS *tls.Config
+	// Proto is the HTTP version, either HTTP/1.1 or HTTP/1.0. The default is HTTP/1.1
+	Proto string
+	// Headers are sent in order. Host is sent first unless it is in Headers
+	Headers []Header
+}
+
+// hasHeader returns true if the client sends the header name
+func (c *Client) hasHeader(name string) bool {
+	for _, h := range c.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do sends a request with body and reads the whole response
+func (c *Client) Do(method, uri string, body []byte) (*http.Response, error) {
+	conf := c.TLS
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+	conf = conf.Clone()
+	conf.InsecureSkipVerify = true
+
+	conn, err := tls.Dial("tcp", c.Addr, conf)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	proto := c.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "%s %s %s\r\n", method, uri, proto)
+	if !c.hasHeader("Host") {
+		fmt.Fprintf(&req, "Host: %s\r\n", c.Addr)
+	}
+	for _, h := range c.Headers {
+		fmt.Fprintf(&req, "%s: %s\r\n", h.Name, h.Value)
+	}
+	if len(body) > 0 && !c.hasHeader("Content-Length") {
+		fmt.Fprintf(&req, "Content-Length: %d\r\n", len(body))
+	}
+	if !c.hasHeader("Connection") {
+		req.WriteString("Connection: close\r\n")
+	}
+	req.WriteString("\r\n")
+	req.Write(body)
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	return resp, nil
+}
+
+// Get sends a GET request
+func (c *Client) Get(uri string) (*http.Response, error) {
+	return c.Do("GET", uri, nil)
+}
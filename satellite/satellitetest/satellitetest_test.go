@@ -0,0 +1,141 @@
+package satellitetest_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/satellitetest"
+)
+
+func createServer(t *testing.T, pathList string) (*Server, string, func()) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "payload"), []byte("payload"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pathList.yml"), []byte(pathList), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClient_JA3(t *testing.T) {
+	s, dir, done := createServer(t, `- path: /probe
+  hosted_file: payload`)
+	defer done()
+
+	// Learn the fingerprint of a client limited to one TLS 1.2 cipher suite
+	implant := s.Client()
+	implant.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	if _, err := implant.Get("/probe"); err != nil {
+		t.Fatal(err)
+	}
+	ja3, ok := s.JA3()
+	if !ok || ja3 == "" {
+		t.Fatal("no fingerprint was recorded")
+	}
+	if _, err := s.Client().Get("/probe"); err != nil {
+		t.Fatal(err)
+	}
+	if browser, _ := s.JA3(); browser == ja3 {
+		t.Fatal("TLS settings did not change the fingerprint")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "pathList.yml"), []byte(`- path: /payload
+  hosted_file: payload
+  authorized_ja3:
+    - `+ja3), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Paths.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Client().Get("/payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("payload was served to the default Go TLS fingerprint")
+	}
+
+	resp, err = implant.Get("/payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Error("payload was not served to the fingerprint of the TLS settings")
+	}
+}
+
+func TestClient_Headers(t *testing.T) {
+	s, _, done := createServer(t, `- path: /payload
+  authorized_useragents:
+    - ^implant$
+  authorized_headers:
+    X-Session: abc`)
+	defer done()
+
+	client := s.Client()
+	client.Proto = "HTTP/1.0"
+	client.Headers = []Header{
+		{Name: "X-Session", Value: "abc"},
+		{Name: "User-Agent", Value: "implant"},
+	}
+
+	resp, err := client.Get("/payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.ProtoMinor != 0 {
+		t.Error("HTTP/1.0 request was not served")
+	}
+
+	client.Headers = client.Headers[1:]
+	resp, err = client.Get("/payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("payload was served without the authorized header")
+	}
+}
+
+func TestServer_JA3S(t *testing.T) {
+	s, _, done := createServer(t, `- path: /payload
+  hosted_file: payload
+  capture_client_hello: true`)
+	defer done()
+
+	if _, err := s.Client().Get("/payload"); err != nil {
+		t.Fatal(err)
+	}
+
+	captures := s.Paths.Captures().List("/payload")
+	if len(captures) != 1 {
+		t.Fatal("client hello was not captured")
+	}
+	// SSLVersion,Cipher,SSLExtension
+	if parts := strings.Split(captures[0].JA3S, ","); len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		t.Errorf("invalid JA3S %q", captures[0].JA3S)
+	}
+}
@@ -0,0 +1,60 @@
+// Package satellitetest runs a local satellite instance and a client with
+// control over its TLS settings, header order, and HTTP version so rule sets
+// can be tested. The instance fingerprints the real TLS handshake of the
+// client, so only fingerprints Go's TLS stack can produce can be tested. JA4
+// rules and HTTP/2 are not supported
+package satellitetest
+
+import (
+	"github.com/t94j0/satellite/net/http/httptest"
+	"github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+// Server is a satellite instance listening with TLS on a local port
+type Server struct {
+	// Paths are the paths served from the server root
+	Paths *path.Paths
+
+	srv *httptest.Server
+}
+
+// NewServer serves serverRoot like satellite does. conditionsDir is the global
+// conditions directory and may be empty
+func NewServer(serverRoot, conditionsDir string) (*Server, error) {
+	paths, err := path.NewDefault(serverRoot, conditionsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := httptest.NewTLSServer(handlers.NewRootHandler(paths, util.NotFound{}, "/index.html", ""))
+
+	return &Server{Paths: paths, srv: srv}, nil
+}
+
+// Addr gets the address the server listens on
+func (s *Server) Addr() string {
+	return s.srv.Listener.Addr().String()
+}
+
+// Client creates a Client for the server
+func (s *Server) Client() *Client {
+	return &Client{Addr: s.Addr()}
+}
+
+// JA3 gets the JA3 digest of the last request handled, which is what
+// authorized_ja3 and blacklist_ja3 match. Send a request with the TLS settings
+// of a client to learn its digest
+func (s *Server) JA3() (string, bool) {
+	hits := s.Paths.Hits().List()
+	if len(hits) == 0 {
+		return "", false
+	}
+	return hits[len(hits)-1].JA3, true
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
@@ -0,0 +1,281 @@
+package scope
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Import gets the in-scope IPs and CIDR ranges of a scoping file. Plain lists
+// of IPs, CIDRs, and IP ranges, Nessus policy targets, and Burp scope exports in
+// XML or JSON are supported. Excluded targets are carved out of the ranges.
+// Hostnames cannot be used as IP ranges and are returned in skipped
+func Import(data []byte) (ranges []string, skipped []string, err error) {
+	var include, exclude []string
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		include, exclude, err = xmlTargets(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		include, exclude, err = burpJSONTargets(trimmed)
+	default:
+		include = listTargets(trimmed)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	networks := func(targets []string) []*net.IPNet {
+		ret := make([]*net.IPNet, 0, len(targets))
+		seen := make(map[string]bool)
+		for _, t := range targets {
+			cidrs, ok := parseTarget(t)
+			if !ok {
+				skipped = append(skipped, t)
+				continue
+			}
+			for _, c := range cidrs {
+				if _, network, err := net.ParseCIDR(c); err == nil && !seen[c] {
+					seen[c] = true
+					ret = append(ret, network)
+				}
+			}
+		}
+		return ret
+	}
+	included, excluded := networks(include), networks(exclude)
+
+	seen := make(map[string]bool)
+	for _, n := range included {
+		for _, c := range carve(n, excluded) {
+			if !seen[c.String()] {
+				seen[c.String()] = true
+				ranges = append(ranges, c.String())
+			}
+		}
+	}
+
+	return ranges, skipped, nil
+}
+
+// carve removes the excluded ranges from n. Ranges which are partly excluded are
+// split in half until each half is excluded or not excluded at all
+func carve(n *net.IPNet, excluded []*net.IPNet) []*net.IPNet {
+	ones, bits := n.Mask.Size()
+	split := false
+	for _, e := range excluded {
+		eOnes, eBits := e.Mask.Size()
+		if eBits != bits {
+			continue
+		}
+		if eOnes <= ones && e.Contains(n.IP) {
+			return nil
+		}
+		if eOnes > ones && n.Contains(e.IP) {
+			split = true
+		}
+	}
+	if !split {
+		return []*net.IPNet{n}
+	}
+
+	mask := net.CIDRMask(ones+1, bits)
+	low := &net.IPNet{IP: n.IP.Mask(mask), Mask: mask}
+	high := &net.IPNet{IP: append(net.IP{}, low.IP...), Mask: mask}
+	high.IP[ones/8] |= 0x80 >> uint(ones%8)
+	return append(carve(low, excluded), carve(high, excluded)...)
+}
+
+// listTargets splits a plain list on lines, commas, and whitespace. Comments start with #
+func listTargets(data []byte) []string {
+	targets := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, t := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// xmlTargets gets the included and excluded targets of a Nessus file or a Burp
+// scope export. Only the policy targets of Nessus files are scope, as its report
+// hosts are only the hosts which answered the scan
+func xmlTargets(data []byte) ([]string, []string, error) {
+	include, exclude := make([]string, 0), make([]string, 0)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	stack := make([]string, 0)
+	inStack := func(name string) bool {
+		for _, s := range stack {
+			if s == name {
+				return true
+			}
+		}
+		return false
+	}
+	var preference string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid scope XML")
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			text := strings.TrimSpace(string(t))
+			switch stack[len(stack)-1] {
+			case "name":
+				if inStack("preference") {
+					preference = text
+				}
+			case "value":
+				// Nessus policy targets
+				if inStack("preference") && preference == "TARGET" {
+					include = append(include, listTargets([]byte(text))...)
+				}
+			case "host":
+				// Burp scope items
+				if text == "" {
+					continue
+				}
+				if inStack("exclude") {
+					exclude = append(exclude, burpHost(text))
+				} else if inStack("include") {
+					include = append(include, burpHost(text))
+				}
+			}
+		}
+	}
+
+	return include, exclude, nil
+}
+
+// burpItem is an include or exclude item of a Burp project options file
+type burpItem struct {
+	Enabled *bool  `json:"enabled"`
+	Host    string `json:"host"`
+	Prefix  string `json:"prefix"`
+}
+
+// burpItemTargets gets the hosts of the enabled items
+func burpItemTargets(items []burpItem) []string {
+	targets := make([]string, 0)
+	for _, item := range items {
+		if item.Enabled != nil && !*item.Enabled {
+			continue
+		}
+		if item.Host != "" {
+			targets = append(targets, burpHost(item.Host))
+		} else if u, err := url.Parse(item.Prefix); err == nil && u.Hostname() != "" {
+			targets = append(targets, u.Hostname())
+		}
+	}
+	return targets
+}
+
+// burpJSONTargets gets the included and excluded hosts of a Burp project options file
+func burpJSONTargets(data []byte) ([]string, []string, error) {
+	var options struct {
+		Target struct {
+			Scope struct {
+				Include []burpItem `json:"include"`
+				Exclude []burpItem `json:"exclude"`
+			} `json:"scope"`
+		} `json:"target"`
+	}
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid Burp scope JSON")
+	}
+
+	return burpItemTargets(options.Target.Scope.Include), burpItemTargets(options.Target.Scope.Exclude), nil
+}
+
+// burpHost removes the regex syntax Burp writes around literal hosts
+func burpHost(host string) string {
+	host = strings.TrimPrefix(host, "^")
+	host = strings.TrimSuffix(host, "$")
+	return strings.Replace(host, `\`, "", -1)
+}
+
+// parseTarget converts an IP, CIDR, or IPv4 range like 10.0.0.1-10.0.0.20 to CIDRs
+func parseTarget(target string) ([]string, bool) {
+	if _, network, err := net.ParseCIDR(target); err == nil {
+		return []string{network.String()}, true
+	}
+
+	if ip := net.ParseIP(target); ip != nil {
+		if ip.To4() != nil {
+			return []string{ip.String() + "/32"}, true
+		}
+		return []string{ip.String() + "/128"}, true
+	}
+
+	parts := strings.SplitN(target, "-", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	start, end := net.ParseIP(parts[0]).To4(), net.ParseIP(parts[1]).To4()
+	// Short form like 10.0.0.1-20
+	if start != nil && end == nil {
+		if i := strings.LastIndex(parts[0], "."); i >= 0 {
+			end = net.ParseIP(parts[0][:i+1] + parts[1]).To4()
+		}
+	}
+	if start == nil || end == nil {
+		return nil, false
+	}
+	return rangeCIDRs(binary.BigEndian.Uint32(start), binary.BigEndian.Uint32(end)), true
+}
+
+// rangeCIDRs gets the smallest list of CIDRs covering the IPv4 range start to end
+func rangeCIDRs(start, end uint32) []string {
+	cidrs := make([]string, 0)
+	for start <= end {
+		// Largest block aligned at start which fits in the range
+		bits := uint(0)
+		for bits < 32 {
+			size := uint64(1) << (bits + 1)
+			if uint64(start)%size != 0 || uint64(start)+size-1 > uint64(end) {
+				break
+			}
+			bits++
+		}
+
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start)
+		cidrs = append(cidrs, (&net.IPNet{IP: ip, Mask: net.CIDRMask(32-int(bits), 32)}).String())
+
+		next := uint64(start) + uint64(1)<<bits
+		if next > uint64(end) {
+			break
+		}
+		start = uint32(next)
+	}
+	return cidrs
+}
@@ -0,0 +1,48 @@
+package scope
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/t94j0/satellite/satellite/path"
+	"gopkg.in/yaml.v2"
+)
+
+// rangeKey is the condition the imported ranges are written to
+const rangeKey = "authorized_iprange"
+
+// WriteRuleSet sets authorized_iprange in the conditions file at target to ranges.
+// Other conditions in an existing file are kept
+func WriteRuleSet(target string, ranges []string) error {
+	var conditions yaml.MapSlice
+
+	data, err := ioutil.ReadFile(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &conditions); err != nil {
+		return errors.Wrap(err, "unable to parse rule set "+target)
+	}
+
+	replaced := false
+	for i, item := range conditions {
+		if item.Key == rangeKey {
+			conditions[i].Value = ranges
+			replaced = true
+		}
+	}
+	if !replaced {
+		conditions = append(conditions, yaml.MapItem{Key: rangeKey, Value: ranges})
+	}
+
+	out, err := yaml.Marshal(conditions)
+	if err != nil {
+		return err
+	}
+	if _, err := path.NewRequestConditions(out); err != nil {
+		return errors.Wrap(err, "invalid rule set")
+	}
+
+	return ioutil.WriteFile(target, out, 0644)
+}
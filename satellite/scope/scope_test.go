@@ -0,0 +1,131 @@
+package scope_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/t94j0/satellite/satellite/path"
+	. "github.com/t94j0/satellite/satellite/scope"
+)
+
+func TestImport_list(t *testing.T) {
+	data := `# in scope
+10.0.0.0/24, 192.168.1.5
+192.168.2.1-192.168.2.6
+172.16.0.10-11
+2001:db8::1
+portal.example.com`
+
+	ranges, skipped, err := Import([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"10.0.0.0/24",
+		"192.168.1.5/32",
+		"192.168.2.1/32",
+		"192.168.2.2/31",
+		"192.168.2.4/31",
+		"192.168.2.6/32",
+		"172.16.0.10/31",
+		"2001:db8::1/128",
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Error("unexpected ranges:", ranges)
+	}
+	if !reflect.DeepEqual(skipped, []string{"portal.example.com"}) {
+		t.Error("hostname was not skipped:", skipped)
+	}
+}
+
+func TestImport_nessus(t *testing.T) {
+	data := `<?xml version="1.0" ?>
+<NessusClientData_v2>
+<Policy><Preferences><ServerPreferences>
+<preference><name>max_hosts</name><value>30</value></preference>
+<preference><name>TARGET</name><value>10.1.0.0/16,10.2.0.1</value></preference>
+</ServerPreferences></Preferences></Policy>
+<Report name="scan"><ReportHost name="10.3.0.1"></ReportHost></Report>
+</NessusClientData_v2>`
+
+	ranges, _, err := Import([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Report hosts are the hosts which answered, not the scope
+	if !reflect.DeepEqual(ranges, []string{"10.1.0.0/16", "10.2.0.1/32"}) {
+		t.Error("unexpected ranges:", ranges)
+	}
+}
+
+func TestImport_burp(t *testing.T) {
+	xml := `<scope><include><item><enabled>true</enabled><host>^10\.4\.0\.1$</host></item>
+<item><enabled>true</enabled><host>10.6.0.0/29</host></item></include>
+<exclude><item><host>^10\.4\.0\.2$</host></item><item><host>10.6.0.2</host></item></exclude></scope>`
+	ranges, _, err := Import([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []string{"10.4.0.1/32", "10.6.0.0/31", "10.6.0.3/32", "10.6.0.4/30"}) {
+		t.Error("unexpected XML ranges:", ranges)
+	}
+
+	json := `{"target": {"scope": {"include": [
+		{"enabled": true, "host": "^10\\.5\\.0\\.1$"},
+		{"enabled": false, "host": "^10\\.5\\.0\\.2$"},
+		{"prefix": "https://10.5.0.3/app"},
+		{"enabled": true, "host": "10.7.0.0/30"}
+	], "exclude": [
+		{"enabled": true, "host": "10.7.0.0/31"},
+		{"enabled": true, "host": "^10\\.5\\.0\\.3$"},
+		{"enabled": false, "host": "^10\\.5\\.0\\.1$"}
+	]}}}`
+	ranges, _, err = Import([]byte(json))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []string{"10.5.0.1/32", "10.7.0.2/31"}) {
+		t.Error("unexpected JSON ranges:", ranges)
+	}
+}
+
+func TestImport_exclude_ipv6(t *testing.T) {
+	xml := `<scope><include><item><host>2001:db8::/126</host></item></include>
+<exclude><item><host>2001:db8::3</host></item><item><host>10.0.0.0/8</host></item></exclude></scope>`
+	ranges, _, err := Import([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ranges, []string{"2001:db8::/127", "2001:db8::2/128"}) {
+		t.Error("unexpected ranges:", ranges)
+	}
+}
+
+func TestWriteRuleSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "scope.yml")
+	ioutil.WriteFile(target, []byte("authorized_iprange:\n- 1.1.1.1\nauthorized_methods:\n- GET\n"), 0644)
+
+	if err := WriteRuleSet(target, []string{"10.0.0.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditions, err := path.NewRequestConditions(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conditions.AuthorizedIPRange, []string{"10.0.0.0/24"}) || !reflect.DeepEqual(conditions.AuthorizedMethods, []string{"GET"}) {
+		t.Error("rule set was not updated:", string(data))
+	}
+}
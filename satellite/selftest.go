@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/net/http"
+	sPath "github.com/t94j0/satellite/satellite/path"
+)
+
+// selfTest checks the GeoIP DBs, the certificate webhook, and the dependencies
+// of the conditions of every paths
+func selfTest(config *Configuration, all pathSet) []sPath.Check {
+	checks := make([]sPath.Check, 0)
+
+	gip := all[0].GeoIP()
+	if config.GeoIPPath != "" {
+		checks = append(checks, dbCheck("geoip", config.GeoIPPath, gip.HasDB()))
+	}
+	if config.ASNPath != "" {
+		checks = append(checks, dbCheck("asn", config.ASNPath, gip.HasASN()))
+	}
+
+	if webhook := config.Certificates.Webhook; webhook != "" {
+		check := sPath.Check{Name: "webhook", Target: webhook}
+		if err := sPath.CheckReachable(&http.Client{Timeout: sPath.WebhookTimeout}, webhook); err != nil {
+			check.Error = err.Error()
+		}
+		checks = append(checks, check)
+	}
+
+	for _, paths := range all {
+		checks = append(checks, paths.SelfTest()...)
+	}
+	return checks
+}
+
+// dbCheck is the check of a GeoIP DB which opened when ok is set
+func dbCheck(name, path string, ok bool) sPath.Check {
+	check := sPath.Check{Name: name, Target: path}
+	if !ok {
+		check.Error = "unable to open " + path
+	}
+	return check
+}
+
+// reportSelfTest logs every failed check and a summary. It returns an error when a critical check failed
+func reportSelfTest(checks []sPath.Check) error {
+	failed, critical := 0, 0
+	for _, c := range checks {
+		if c.OK() {
+			log.WithFields(log.Fields{
+				"check":  c.Name,
+				"target": c.Target,
+			}).Debug("Self-test passed")
+			continue
+		}
+
+		failed++
+		fields := log.Fields{
+			"check":  c.Name,
+			"target": c.Target,
+			"error":  c.Error,
+		}
+		if c.Critical {
+			critical++
+			log.WithFields(fields).Error("Critical self-test failed")
+		} else {
+			log.WithFields(fields).Warn("Self-test failed")
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"checks":   len(checks),
+		"failed":   failed,
+		"critical": critical,
+	}).Info("Self-test complete")
+
+	if critical > 0 {
+		return errors.New(fmt.Sprintf("%d critical self-test(s) failed", critical))
+	}
+	return nil
+}
@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
+	"crypto/x509"
 	"net"
 	rhttp "net/http"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/t94j0/satellite/crypto/tls"
 	"github.com/t94j0/satellite/net/http"
+	"github.com/t94j0/satellite/satellite/assets"
 	"github.com/t94j0/satellite/satellite/handlers"
+	"github.com/t94j0/satellite/satellite/passive"
 	"github.com/t94j0/satellite/satellite/path"
 	"github.com/t94j0/satellite/satellite/util"
 )
@@ -22,6 +27,19 @@ type Server struct {
 	indexPath    string
 	redirectHTTP bool
 	identifier   *path.ClientID
+	maintenance  *util.Maintenance
+	serverError  string
+	scrubber     *handlers.Scrubber
+	hostFilter   *handlers.HostFilter
+	scope        *handlers.Scope
+	varier       *handlers.Varier
+	virtualHosts []handlers.VirtualHost
+	persona      assets.Persona
+	formAck      *handlers.FormAck
+	http2        bool
+	clientCerts  bool
+	clientCAs    *x509.CertPool
+	httpServer   *http.Server
 }
 
 // New creates a new Server object
@@ -37,9 +55,78 @@ func New(paths *path.Paths, ssl SSL, nf util.NotFound, serverPath, port, serverH
 
 		redirectHTTP: redirectHTTP,
 		identifier:   path.NewClientID(),
+		httpServer:   &http.Server{Addr: port},
 	}, nil
 }
 
+// WithMaintenance sets the maintenance mode used by the server
+func (s Server) WithMaintenance(m *util.Maintenance) Server {
+	s.maintenance = m
+	return s
+}
+
+// WithServerError sets the page rendered when a request fails unexpectedly
+func (s Server) WithServerError(render string) Server {
+	s.serverError = render
+	return s
+}
+
+// WithScrubber sets the scrubber which removes leaks from responses
+func (s Server) WithScrubber(scrubber *handlers.Scrubber) Server {
+	s.scrubber = scrubber
+	return s
+}
+
+// WithHostFilter sets the allow-list of hosts served
+func (s Server) WithHostFilter(f *handlers.HostFilter) Server {
+	s.hostFilter = f
+	return s
+}
+
+// WithScope sets the engagement scope clients must be in
+func (s Server) WithScope(scope *handlers.Scope) Server {
+	s.scope = scope
+	return s
+}
+
+// WithVarier sets the varier which adds random variation to decoy responses
+func (s Server) WithVarier(v *handlers.Varier) Server {
+	s.varier = v
+	return s
+}
+
+// WithVirtualHosts sets the virtual hosts served from their own paths
+func (s Server) WithVirtualHosts(vhosts []handlers.VirtualHost) Server {
+	s.virtualHosts = vhosts
+	return s
+}
+
+// WithPersona sets the built in error pages served when no page is rendered
+func (s Server) WithPersona(p assets.Persona) Server {
+	s.persona = p
+	return s
+}
+
+// WithFormAck acknowledges POSTs which no path serves with a thank you page
+func (s Server) WithFormAck(a *handlers.FormAck) Server {
+	s.formAck = a
+	return s
+}
+
+// WithHTTP2 offers HTTP/2 to clients so they can be fingerprinted at the HTTP/2 layer
+func (s Server) WithHTTP2(enabled bool) Server {
+	s.http2 = enabled
+	return s
+}
+
+// WithClientCerts asks HTTPS clients for a certificate so paths can be gated on
+// it. When cas is not nil, certificates which are not signed by cas are rejected
+func (s Server) WithClientCerts(cas *x509.CertPool) Server {
+	s.clientCerts = true
+	s.clientCAs = cas
+	return s
+}
+
 // Start makes the server begin listening
 func (s Server) Start() error {
 	if s.redirectHTTP {
@@ -48,12 +135,28 @@ func (s Server) Start() error {
 		}()
 	}
 
-	rootHandler := handlers.NewRootHandler(s.paths, s.nf, s.indexPath, s.serverHeader)
+	return s.serveHTTPS(s.Handler())
+}
 
-	mux := http.NewServeMux()
-	mux.Handle("/", http.Handler(rootHandler))
+// Handler gets the handler requests are served with. It is not wrapped in a
+// ServeMux, which would redirect paths with repeated slashes or dot segments, so
+// lure variants are routed by the paths and request bodies are not lost
+func (s Server) Handler() http.Handler {
+	return handlers.NewRootHandler(s.paths, s.nf, s.indexPath, s.serverHeader).
+		WithMaintenance(s.maintenance).
+		WithServerError(s.serverError).
+		WithScrubber(s.scrubber).
+		WithHostFilter(s.hostFilter).
+		WithScope(s.scope).
+		WithVarier(s.varier).
+		WithVirtualHosts(s.virtualHosts).
+		WithPersona(s.persona).
+		WithFormAck(s.formAck)
+}
 
-	return s.serveHTTPS(mux)
+// Shutdown gracefully stops the server, waiting for active requests until ctx is done
+func (s Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
 
 // createHTTPRedirect creates a HTTP listener to redirect to HTTPS
@@ -67,20 +170,43 @@ func (s Server) createHTTPRedirect() {
 	}))
 }
 
-// serveHTTPS serves the mux with HTTPS
-func (s Server) serveHTTPS(mux *http.ServeMux) error {
-	server := &http.Server{Addr: s.port, Handler: mux}
+// serveHTTPS serves handler with HTTPS
+func (s Server) serveHTTPS(handler http.Handler) error {
+	server := s.httpServer
+	server.Handler = handler
 	ln, err := net.Listen("tcp", s.port)
 	if err != nil {
 		return err
 	}
 	defer ln.Close()
 
+	// Keep the SYN of connections so clients can be passively fingerprinted
+	var listener net.Listener = ln
+	if pl, err := passive.NewListener(ln.(*net.TCPListener), passive.Default); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Passive OS fingerprinting disabled")
+	} else {
+		listener = pl
+	}
+
 	tlsConfig, err := s.ssl.CreateTLSConfig()
 	if err != nil {
 		return err
 	}
 
-	tlsListener := tls.NewListener(ln, tlsConfig)
+	if s.http2 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if s.clientCerts {
+		tlsConfig.ClientAuth = tls.RequestClientCert
+		if s.clientCAs != nil {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			tlsConfig.ClientCAs = s.clientCAs
+		}
+	}
+
+	tlsListener := tls.NewListener(listener, tlsConfig)
 	return server.Serve(tlsListener)
 }
@@ -10,6 +10,8 @@ import (
 type SSL struct {
 	keyPath  string
 	certPath string
+	// getCertificate serves certificates which are issued while running instead of the key and cert files
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 func NewSSL(keyPath, certPath string) (SSL, error) {
@@ -20,10 +22,19 @@ func NewSSL(keyPath, certPath string) (SSL, error) {
 		return SSL{}, errors.Wrap(err, "SSL cert not found")
 	}
 
-	return SSL{keyPath, certPath}, nil
+	return SSL{keyPath: keyPath, certPath: certPath}, nil
+}
+
+// NewIssuedSSL serves the certificates returned by getCertificate, like those issued with ACME
+func NewIssuedSSL(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) SSL {
+	return SSL{getCertificate: getCertificate}
 }
 
 func (s SSL) CreateTLSConfig() (*tls.Config, error) {
+	if s.getCertificate != nil {
+		return &tls.Config{GetCertificate: s.getCertificate}, nil
+	}
+
 	cert, err := tls.LoadX509KeyPair(s.certPath, s.keyPath)
 	if err != nil {
 		return nil, err
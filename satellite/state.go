@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/metrics"
+	"github.com/t94j0/satellite/satellite/notify"
+)
+
+var (
+	stateUnavailable = metrics.NewGaugeVec("satellite_state_unavailable", "1 while the state DB is unavailable and its conditionals use their fallbacks", "db")
+	stateFailures    = metrics.NewCounterVec("satellite_state_failures_total", "Times the state DB became unavailable", "db")
+)
+
+// stateAlert creates the function alerting state.webhook when the state DB of a paths
+// becomes unavailable, so its conditionals fall back, and when it recovers
+func stateAlert(config *Configuration) func(db string, err error) {
+	notifier := notify.New()
+	conf := notify.Config{Webhook: config.State.Webhook}
+
+	return func(db string, err error) {
+		if err != nil {
+			stateUnavailable.With(db).Set(1)
+			stateFailures.With(db).Inc()
+		} else {
+			stateUnavailable.With(db).Set(0)
+		}
+
+		alert := notify.Alert{Text: fmt.Sprintf("state DB %s recovered", db)}
+		if err != nil {
+			alert.Text = fmt.Sprintf("state DB %s is unavailable, conditionals are using their on_state_error fallbacks: %s", db, err)
+		}
+		if err := notifier.Send(conf, alert); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Unable to send state DB alert")
+		}
+	}
+}
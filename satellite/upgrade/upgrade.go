@@ -0,0 +1,269 @@
+package upgrade
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// ErrBadSignature is returned when the release manifest does not match its signature
+var ErrBadSignature = errors.New("release signature does not match the manifest")
+
+// ErrBadDigest is returned when a downloaded binary does not match the digest in the manifest
+var ErrBadDigest = errors.New("release binary does not match the manifest digest")
+
+// ErrNoPublicKey is returned when no key is configured to verify releases
+var ErrNoPublicKey = errors.New("no public key to verify releases")
+
+// ErrNoBinary is returned when a release has no binary for this OS and architecture
+var ErrNoBinary = errors.New("release has no binary for " + runtime.GOOS + "/" + runtime.GOARCH)
+
+// maxBinarySize is the largest binary downloaded
+const maxBinarySize = 256 << 20
+
+var client = &http.Client{Timeout: 5 * time.Minute}
+
+// SignedManifest is what the release endpoint returns
+type SignedManifest struct {
+	// Manifest is the base64 encoded JSON Manifest
+	Manifest string `json:"manifest"`
+	// Signature is the base64 encoded ed25519 signature of the decoded manifest
+	Signature string `json:"signature"`
+}
+
+// Manifest lists the binaries of a release. The version is signed with the
+// binaries, so an older release can not be served as the latest
+type Manifest struct {
+	Version  string   `json:"version"`
+	Binaries []Binary `json:"binaries"`
+}
+
+// Binary is the binary of a release for one OS and architecture
+type Binary struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// URL is the location of the binary
+	URL string `json:"url"`
+	// SHA256 is the hex encoded SHA-256 digest of the binary
+	SHA256 string `json:"sha256"`
+}
+
+// Release is the binary of the latest release for this OS and architecture
+type Release struct {
+	Version string
+	Binary
+}
+
+// Sign signs manifest with key, for publishing to the release endpoint
+func Sign(manifest Manifest, key ed25519.PrivateKey) (SignedManifest, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return SignedManifest{}, err
+	}
+	return SignedManifest{
+		Manifest:  base64.StdEncoding.EncodeToString(data),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}, nil
+}
+
+// Verify checks the signature of the manifest and parses it
+func (s SignedManifest) Verify(key ed25519.PublicKey) (Manifest, error) {
+	var manifest Manifest
+
+	data, err := base64.StdEncoding.DecodeString(s.Manifest)
+	if err != nil {
+		return manifest, errors.Wrap(err, "invalid release manifest")
+	}
+	signature, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return manifest, errors.Wrap(err, "invalid release signature")
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return manifest, ErrBadSignature
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, errors.Wrap(err, "invalid release manifest")
+	}
+	if manifest.Version == "" {
+		return manifest, errors.New("release manifest is missing the version")
+	}
+	return manifest, nil
+}
+
+// Release gets the binary of the manifest for goos and goarch
+func (m Manifest) Release(goos, goarch string) (Release, error) {
+	for _, b := range m.Binaries {
+		if b.OS == goos && b.Arch == goarch {
+			if b.URL == "" || b.SHA256 == "" {
+				return Release{}, errors.New("release binary is missing url or sha256")
+			}
+			return Release{Version: m.Version, Binary: b}, nil
+		}
+	}
+	return Release{}, ErrNoBinary
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	if key == "" {
+		return nil, ErrNoPublicKey
+	}
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid public key")
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key length")
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// Latest gets the latest release for this OS and architecture from the release
+// endpoint. Its manifest must be signed by key
+func Latest(endpoint string, key ed25519.PublicKey) (Release, error) {
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return Release{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Release{}, fmt.Errorf("release endpoint returned %s", resp.Status)
+	}
+
+	var signed SignedManifest
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return Release{}, errors.Wrap(err, "invalid release")
+	}
+	manifest, err := signed.Verify(key)
+	if err != nil {
+		return Release{}, err
+	}
+	return manifest.Release(runtime.GOOS, runtime.GOARCH)
+}
+
+// parseVersion splits a version like v1.2.3 into its numbers
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	ret := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		ret[i] = n
+	}
+	return ret, true
+}
+
+// Newer returns true when latest is a newer version than current. Development
+// builds without a version are always older
+func Newer(current, latest string) bool {
+	latestParts, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	currentParts, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+
+	for i := 0; i < len(latestParts) || i < len(currentParts); i++ {
+		var l, c int
+		if i < len(latestParts) {
+			l = latestParts[i]
+		}
+		if i < len(currentParts) {
+			c = currentParts[i]
+		}
+		if l != c {
+			return l > c
+		}
+	}
+	return false
+}
+
+// Download gets the release binary and verifies it matches the signed manifest
+func Download(release Release) ([]byte, error) {
+	digest, err := hex.DecodeString(release.SHA256)
+	if err != nil || len(digest) != sha256.Size {
+		return nil, errors.New("invalid release sha256")
+	}
+
+	resp, err := client.Get(release.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release download returned %s", resp.Status)
+	}
+
+	binary, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBinarySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(binary) > maxBinarySize {
+		return nil, errors.New("release binary is too large")
+	}
+
+	sum := sha256.Sum256(binary)
+	if subtle.ConstantTimeCompare(sum[:], digest) != 1 {
+		return nil, ErrBadDigest
+	}
+
+	return binary, nil
+}
+
+// Replace atomically replaces the binary at target
+func Replace(target string, binary []byte) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target))
+	if err != nil {
+		return errors.Wrap(err, "unable to write new binary")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// Apply downloads and verifies the release and replaces the binary at target with it
+func Apply(release Release, target string) error {
+	binary, err := Download(release)
+	if err != nil {
+		return err
+	}
+	return Replace(target, binary)
+}
@@ -0,0 +1,181 @@
+package upgrade_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/t94j0/satellite/satellite/upgrade"
+	"golang.org/x/crypto/ed25519"
+)
+
+func releaseServer(t *testing.T, key ed25519.PrivateKey, binary []byte, digest []byte) *httptest.Server {
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, req *http.Request) {
+		signed, err := Sign(Manifest{
+			Version: "v1.2.0",
+			Binaries: []Binary{
+				{OS: "plan9", Arch: runtime.GOARCH, URL: ts.URL + "/other", SHA256: hex.EncodeToString(digest)},
+				{OS: runtime.GOOS, Arch: runtime.GOARCH, URL: ts.URL + "/satellite", SHA256: hex.EncodeToString(digest)},
+			},
+		}, key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(signed)
+	})
+	mux.HandleFunc("/satellite", func(w http.ResponseWriter, req *http.Request) {
+		w.Write(binary)
+	})
+	return ts
+}
+
+func TestNewer(t *testing.T) {
+	cases := []struct {
+		current, latest string
+		newer           bool
+	}{
+		{"v1.0.0", "v1.0.1", true},
+		{"1.2.0", "v1.10.0", true},
+		{"v1.2", "v1.2.0", false},
+		{"v2.0.0", "v1.9.9", false},
+		{"dev", "v0.0.1", true},
+		{"v1.0.0", "latest", false},
+	}
+	for _, c := range cases {
+		if Newer(c.current, c.latest) != c.newer {
+			t.Error(c.current, c.latest)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new satellite")
+	digest := sha256.Sum256(binary)
+	ts := releaseServer(t, private, binary, digest[:])
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "satellite")
+	if err := ioutil.WriteFile(target, []byte("old satellite"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := Latest(ts.URL+"/latest", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "v1.2.0" || release.URL != ts.URL+"/satellite" {
+		t.Errorf("unexpected release %+v", release)
+	}
+	if err := Apply(release, target); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(binary) {
+		t.Error("binary was not replaced")
+	}
+	if info, err := os.Stat(target); err != nil || info.Mode().Perm() != 0755 {
+		t.Error("binary mode was not kept")
+	}
+}
+
+func TestLatest_badsignature(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("tampered satellite")
+	digest := sha256.Sum256(binary)
+	ts := releaseServer(t, other, binary, digest[:])
+	defer ts.Close()
+
+	if _, err := Latest(ts.URL+"/latest", public); err != ErrBadSignature {
+		t.Error("manifest with a bad signature was accepted:", err)
+	}
+}
+
+func TestApply_baddigest(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("new satellite"))
+	ts := releaseServer(t, private, []byte("tampered satellite"), digest[:])
+	defer ts.Close()
+
+	release, err := Latest(ts.URL+"/latest", public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(release, "/nonexistent"); err != ErrBadDigest {
+		t.Error("binary with a bad digest was accepted:", err)
+	}
+}
+
+func TestManifest_Release(t *testing.T) {
+	manifest := Manifest{Version: "v1.2.0", Binaries: []Binary{
+		{OS: "linux", Arch: "amd64", URL: "https://example.com/amd64", SHA256: "00"},
+		{OS: "linux", Arch: "arm64", URL: "https://example.com/arm64", SHA256: "00"},
+	}}
+	release, err := manifest.Release("linux", "arm64")
+	if err != nil || release.URL != "https://example.com/arm64" || release.Version != "v1.2.0" {
+		t.Errorf("unexpected release %+v: %v", release, err)
+	}
+	if _, err := manifest.Release("windows", "amd64"); err != ErrNoBinary {
+		t.Error("release without a binary for the platform was found")
+	}
+}
+
+func TestSignedManifest_Verify_tampered(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(Manifest{Version: "v1.0.0"}, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An older signed manifest can not be relabeled as a newer version
+	newer, err := Sign(Manifest{Version: "v9.0.0"}, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Manifest = newer.Manifest
+	if _, err := signed.Verify(public); err != ErrBadSignature {
+		t.Error("tampered manifest was accepted:", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	if _, err := ParsePublicKey(""); err != ErrNoPublicKey {
+		t.Fail()
+	}
+	if _, err := ParsePublicKey("c2hvcnQ="); err == nil {
+		t.Fail()
+	}
+}
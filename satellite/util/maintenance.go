@@ -0,0 +1,119 @@
+package util
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Window is a scheduled maintenance window
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseWindow parses an interval in the form <RFC3339 start>/<RFC3339 end>
+func ParseWindow(interval string) (Window, error) {
+	parts := strings.Split(interval, "/")
+	if len(parts) != 2 {
+		return Window{}, errors.New("maintenance window must be in the form start/end: " + interval)
+	}
+
+	start, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return Window{}, errors.Wrap(err, "invalid maintenance window start")
+	}
+	end, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return Window{}, errors.Wrap(err, "invalid maintenance window end")
+	}
+	if !end.After(start) {
+		return Window{}, errors.New("maintenance window must end after it starts: " + interval)
+	}
+
+	return Window{Start: start, End: end}, nil
+}
+
+// Maintenance puts the server into a maintenance persona, either on demand or
+// during scheduled windows
+type Maintenance struct {
+	// Status is the HTTP status code of the maintenance page
+	Status int
+	// Render is the path served as the maintenance page. A bare status is given when empty
+	Render string
+	// RetryAfter is the value of the Retry-After header
+	RetryAfter string
+
+	mu       sync.RWMutex
+	enabled  bool
+	schedule []Window
+}
+
+// NewMaintenance creates a Maintenance object from the configured schedule
+func NewMaintenance(enabled bool, status int, render, retryAfter string, schedule []string) (*Maintenance, error) {
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+
+	m := &Maintenance{
+		Status:     status,
+		Render:     render,
+		RetryAfter: retryAfter,
+		enabled:    enabled,
+	}
+
+	for _, s := range schedule {
+		w, err := ParseWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		m.schedule = append(m.schedule, w)
+	}
+
+	return m, nil
+}
+
+// Set turns on-demand maintenance on or off
+func (m *Maintenance) Set(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = enabled
+}
+
+// Schedule adds a maintenance window
+func (m *Maintenance) Schedule(w Window) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedule = append(m.schedule, w)
+}
+
+// Windows returns the scheduled maintenance windows
+func (m *Maintenance) Windows() []Window {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Window{}, m.schedule...)
+}
+
+// Active returns true when maintenance is turned on or t is inside a scheduled window
+func (m *Maintenance) Active(t time.Time) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.enabled {
+		return true
+	}
+
+	for _, w := range m.schedule {
+		if !t.Before(w.Start) && t.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,17 @@
 package util
 
-import "errors"
+import (
+	"errors"
 
+	"github.com/t94j0/satellite/net/http"
+)
+
+// NotFound is what is served for requests which match no path or are denied
 type NotFound struct {
 	Redirect string
 	Render   string
+	// Handler serves the requests instead, for applications embedding satellite with their own decoy logic
+	Handler http.Handler
 }
 
 var ErrNotFoundConfig = errors.New("both not_found redirect and render cannot be set at the same time")
@@ -20,7 +27,12 @@ func NewNotFound(redirect, render string) (NotFound, error) {
 	}, nil
 }
 
-// ShouldWarn returns true if the redirect or render portion is empty
+// NewNotFoundHandler creates a NotFound which serves requests with handler
+func NewNotFoundHandler(handler http.Handler) NotFound {
+	return NotFound{Handler: handler}
+}
+
+// ShouldWarn returns true if the redirect, render, and handler are all empty
 func (nf NotFound) ShouldWarn() bool {
-	return nf.Redirect == "" && nf.Render == ""
+	return nf.Redirect == "" && nf.Render == "" && nf.Handler == nil
 }
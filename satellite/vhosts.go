@@ -0,0 +1,227 @@
+package main
+
+import (
+	"io"
+	"net"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/t94j0/satellite/satellite/handlers"
+	sPath "github.com/t94j0/satellite/satellite/path"
+	"github.com/t94j0/satellite/satellite/util"
+)
+
+// pathSet are the paths of the server root and every virtual host. Global
+// data, like blocklists and GeoIP databases, is set on all of them
+type pathSet []*sPath.Paths
+
+// SetBlocklist sets the ranges of the blocklist feed name on every paths
+func (ps pathSet) SetBlocklist(name string, ranges []*net.IPNet) {
+	for _, paths := range ps {
+		paths.SetBlocklist(name, ranges)
+	}
+}
+
+// SetScanScope sets the ranges of clients which are scanned on every paths
+func (ps pathSet) SetScanScope(ranges []*net.IPNet) {
+	for _, paths := range ps {
+		paths.SetScanScope(ranges)
+	}
+}
+
+// SetHostingProvider sets the published ranges of the hosting provider name on every paths
+func (ps pathSet) SetHostingProvider(name string, ranges []*net.IPNet) {
+	for _, paths := range ps {
+		paths.SetHostingProvider(name, ranges)
+	}
+}
+
+// SetTorExits sets the Tor exit nodes on every paths
+func (ps pathSet) SetTorExits(ips []net.IP) error {
+	for _, paths := range ps {
+		if err := paths.SetTorExits(ips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddGeoIP adds the GeoIP DB at p to every paths
+func (ps pathSet) AddGeoIP(p string) error {
+	for _, paths := range ps {
+		if err := paths.AddGeoIP(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCountryGroups sets the custom country groups of every paths
+func (ps pathSet) SetCountryGroups(groups map[string][]string) {
+	for _, paths := range ps {
+		paths.SetCountryGroups(groups)
+	}
+}
+
+// AddASN adds the ASN DB at p to every paths
+func (ps pathSet) AddASN(p string) error {
+	for _, paths := range ps {
+		if err := paths.AddASN(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCampaigns sets the campaigns every paths counts against, so quotas are shared by virtual hosts
+func (ps pathSet) SetCampaigns(campaigns *sPath.Campaigns) {
+	for _, paths := range ps {
+		paths.SetCampaigns(campaigns)
+	}
+}
+
+// SetJournal writes every decision of every paths to w
+func (ps pathSet) SetJournal(w io.Writer) {
+	for _, p := range ps {
+		p.Hits().SetJournal(w)
+	}
+}
+
+// SetForwarder sets where every paths forwards denied requests
+func (ps pathSet) SetForwarder(forwarder *sPath.Forwarder) {
+	for _, paths := range ps {
+		paths.SetForwarder(forwarder)
+	}
+}
+
+// SetGlobalConditions sets the conditions merged beneath the conditions of the paths of every paths
+func (ps pathSet) SetGlobalConditions(conditions sPath.RequestConditions) {
+	for _, paths := range ps {
+		paths.SetGlobalConditions(conditions)
+	}
+}
+
+// SetResponseHeaders sets the headers sent with every served path of every paths
+func (ps pathSet) SetResponseHeaders(headers map[string]string) error {
+	for _, paths := range ps {
+		if err := paths.SetResponseHeaders(headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnStateUnavailable sets the function called when the state DB of any paths becomes unavailable or recovers
+func (ps pathSet) OnStateUnavailable(f func(db string, err error)) {
+	for _, paths := range ps {
+		paths.OnStateUnavailable(f)
+	}
+}
+
+// OnBlacklist sets the function called when an IP is added to the global blacklist of any paths
+func (ps pathSet) OnBlacklist(f func(net.IP)) {
+	for _, paths := range ps {
+		paths.OnBlacklist(f)
+	}
+}
+
+// OnUnblacklist sets the function called when an IP is removed from the global blacklist of any paths
+func (ps pathSet) OnUnblacklist(f func(net.IP)) {
+	for _, paths := range ps {
+		paths.OnUnblacklist(f)
+	}
+}
+
+// Unblacklist removes ip from the global blacklist of every paths it is on
+func (ps pathSet) Unblacklist(ip net.IP) error {
+	err := sPath.ErrNotBlacklisted
+	for _, paths := range ps {
+		if perr := paths.Unblacklist(ip); perr != sPath.ErrNotBlacklisted {
+			if perr != nil {
+				return perr
+			}
+			err = nil
+		}
+	}
+	return err
+}
+
+// BlacklistedIPs gets the IPs on the global blacklist of every paths
+func (ps pathSet) BlacklistedIPs() ([]net.IP, error) {
+	ips := make([]net.IP, 0)
+	for _, paths := range ps {
+		blacklisted, err := paths.BlacklistedIPs()
+		if err != nil {
+			return ips, err
+		}
+		ips = append(ips, blacklisted...)
+	}
+	return ips, nil
+}
+
+// Purge purges data older than cutoff, or the cutoff of its campaign, from every
+// paths and totals the records purged by kind
+func (ps pathSet) Purge(cutoff time.Time, campaigns map[string]time.Time) (map[string]int, error) {
+	total := make(map[string]int)
+	var err error
+	for _, paths := range ps {
+		purged, perr := paths.Purge(cutoff, campaigns)
+		if perr != nil {
+			err = perr
+		}
+		for kind, n := range purged {
+			total[kind] += n
+		}
+	}
+	return total, err
+}
+
+// watchPaths reloads paths when files in its server root change
+func watchPaths(serverRoot string, paths *sPath.Paths) {
+	if err := createWatcher(serverRoot, "1s", func() error {
+		return paths.Reload()
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// virtualHosts creates the paths of every virtual host and watches their server roots
+func virtualHosts(config *Configuration, gcp string) ([]handlers.VirtualHost, pathSet, error) {
+	vhosts := make([]handlers.VirtualHost, 0, len(config.VirtualHosts))
+	set := make(pathSet, 0, len(config.VirtualHosts))
+	for _, v := range config.VirtualHosts {
+		paths, err := sPath.NewDefault(v.ServerRoot, gcp)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, v.ServerRoot)
+		}
+		nf, err := util.NewNotFound(v.NotFound.Redirect, v.NotFound.Render)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, v.ServerRoot)
+		}
+		vhost, err := handlers.NewVirtualHost(v.Hosts, paths, nf, v.Index)
+		if err != nil {
+			return nil, nil, err
+		}
+		go watchPaths(v.ServerRoot, paths)
+
+		log.WithFields(log.Fields{
+			"hosts":       v.Hosts,
+			"server_root": v.ServerRoot,
+			"paths":       paths.Len(),
+		}).Debug("Loaded virtual host")
+		vhosts = append(vhosts, vhost)
+		set = append(set, paths)
+	}
+	return vhosts, set, nil
+}
+
+// vhostRoots are the server roots of the virtual hosts, which are scrubbed from responses
+func vhostRoots(config *Configuration) []string {
+	roots := make([]string, 0, len(config.VirtualHosts))
+	for _, v := range config.VirtualHosts {
+		roots = append(roots, path.Clean(v.ServerRoot))
+	}
+	return roots
+}